@@ -17,9 +17,10 @@ func newAnthropicClient(cfg *Config) *anthropicClient {
 	return &anthropicClient{httpClient: newHTTPClient(cfg)}
 }
 
+// anthropicMessage Content 元素为 anthropicTextContent 或 anthropicImageContent
 type anthropicMessage struct {
-	Role    string                 `json:"role"`
-	Content []anthropicTextContent `json:"content"`
+	Role    string `json:"role"`
+	Content []any  `json:"content"`
 }
 
 type anthropicTextContent struct {
@@ -27,6 +28,18 @@ type anthropicTextContent struct {
 	Text string `json:"text"`
 }
 
+type anthropicImageContent struct {
+	Type   string               `json:"type"`
+	Source anthropicImageSource `json:"source"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"`
+	URL       string `json:"url,omitempty"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+}
+
 type anthropicChatRequest struct {
 	Model       string             `json:"model"`
 	MaxTokens   int                `json:"max_tokens"`
@@ -37,6 +50,13 @@ type anthropicChatRequest struct {
 
 type anthropicChatResponse struct {
 	Content []anthropicTextContent `json:"content"`
+	// Usage 中 input_tokens 不含缓存写入与读取的 token
+	Usage *struct {
+		InputTokens              int `json:"input_tokens"`
+		OutputTokens             int `json:"output_tokens"`
+		CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+		CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+	} `json:"usage"`
 }
 
 func (c *anthropicClient) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
@@ -51,17 +71,19 @@ func (c *anthropicClient) Chat(ctx context.Context, req *ChatRequest) (*ChatResp
 
 	var messages []anthropicMessage
 	var userText strings.Builder
+	var images []any
 	for _, m := range req.Messages {
 		if userText.Len() > 0 {
 			userText.WriteString("\n\n")
 		}
 		userText.WriteString(fmt.Sprintf("[%s]\n%s", m.Role, m.Content))
+		for _, img := range m.Images {
+			images = append(images, anthropicImage(img))
+		}
 	}
 	userMsg := anthropicMessage{
-		Role: "user",
-		Content: []anthropicTextContent{
-			{Type: "text", Text: userText.String()},
-		},
+		Role:    "user",
+		Content: append(images, anthropicTextContent{Type: "text", Text: userText.String()}),
 	}
 	messages = append(messages, userMsg)
 
@@ -106,7 +128,7 @@ func (c *anthropicClient) Chat(ctx context.Context, req *ChatRequest) (*ChatResp
 		return nil, fmt.Errorf("读取 Anthropic 响应失败: %w", err)
 	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("anthropic 响应错误: status=%d, body=%s", resp.StatusCode, string(respBytes))
+		return nil, &HTTPError{Provider: ProviderAnthropic, StatusCode: resp.StatusCode, Body: string(respBytes)}
 	}
 
 	var ar anthropicChatResponse
@@ -116,5 +138,27 @@ func (c *anthropicClient) Chat(ctx context.Context, req *ChatRequest) (*ChatResp
 	if len(ar.Content) == 0 {
 		return nil, fmt.Errorf("anthropic 响应中不包含内容")
 	}
-	return &ChatResponse{Content: ar.Content[0].Text}, nil
+	out := &ChatResponse{Content: ar.Content[0].Text}
+	if u := ar.Usage; u != nil {
+		out.Usage = &Usage{
+			InputTokens:       u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+			OutputTokens:      u.OutputTokens,
+			CachedInputTokens: u.CacheReadInputTokens,
+		}
+	}
+	return out, nil
+}
+
+// anthropicImage data URL 转为 base64 图片块，其余按 URL 引用
+func anthropicImage(img ChatImage) anthropicImageContent {
+	if rest, ok := strings.CutPrefix(img.URL, "data:"); ok {
+		if meta, data, found := strings.Cut(rest, ","); found && strings.HasSuffix(meta, ";base64") {
+			return anthropicImageContent{Type: "image", Source: anthropicImageSource{
+				Type:      "base64",
+				MediaType: strings.TrimSuffix(meta, ";base64"),
+				Data:      data,
+			}}
+		}
+	}
+	return anthropicImageContent{Type: "image", Source: anthropicImageSource{Type: "url", URL: img.URL}}
 }
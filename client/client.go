@@ -29,6 +29,14 @@ type Config struct {
 type ChatMessage struct {
 	Role    string
 	Content string
+	// Images 多模态图片，不支持的 provider 忽略
+	Images []ChatImage
+}
+
+// ChatImage 图片内容：URL 为 http(s) 地址或 data URL
+type ChatImage struct {
+	URL      string
+	MimeType string
 }
 
 type ChatRequest struct {
@@ -40,6 +48,15 @@ type ChatRequest struct {
 
 type ChatResponse struct {
 	Content string
+	// Usage provider 返回的 token 用量，未返回时为 nil
+	Usage *Usage
+}
+
+// Usage token 用量；InputTokens 含命中提示缓存的部分，CachedInputTokens 为其中按缓存计费的 token 数
+type Usage struct {
+	InputTokens       int
+	OutputTokens      int
+	CachedInputTokens int
 }
 
 type Client interface {
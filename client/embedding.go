@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// Embedder 文本向量化接口；与 Client 分离，目前支持 openai/openai_compatible 与 mock
+type Embedder interface {
+	// Embed 按输入顺序返回向量
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Model 返回向量模型名称，用于区分不同模型生成的向量
+	Model() string
+}
+
+const defaultOpenAIEmbeddingModel = "text-embedding-3-small"
+
+func NewEmbedder(cfg *Config) (Embedder, error) {
+	if cfg == nil || cfg.Provider == "" {
+		return nil, fmt.Errorf("llm.Config 不能为空且 provider 必须设置")
+	}
+	switch cfg.Provider {
+	case ProviderOpenAI, ProviderOpenAICompatible:
+		return &openAIEmbedder{httpClient: newHTTPClient(cfg)}, nil
+	case ProviderMock:
+		return mockEmbedder{}, nil
+	default:
+		return nil, fmt.Errorf("provider %s 不支持向量化", cfg.Provider)
+	}
+}
+
+type openAIEmbedder struct {
+	*httpClient
+}
+
+func (e *openAIEmbedder) Model() string {
+	if e.cfg.Model == "" {
+		return defaultOpenAIEmbeddingModel
+	}
+	return e.cfg.Model
+}
+
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	if e.cfg.APIKey == "" {
+		return nil, fmt.Errorf("OpenAI API Key 未配置")
+	}
+	baseURL := e.cfg.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.openai.com"
+	}
+	respBytes, err := e.post(ctx, fmt.Sprintf("%s/v1/embeddings", baseURL), map[string]any{
+		"model": e.Model(),
+		"input": texts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBytes, &resp); err != nil {
+		return nil, fmt.Errorf("解析 OpenAI 向量响应失败: %w", err)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("OpenAI 向量响应条数不符: 期望 %d, 实际 %d", len(texts), len(resp.Data))
+	}
+	sort.Slice(resp.Data, func(i, j int) bool { return resp.Data[i].Index < resp.Data[j].Index })
+	vectors := make([][]float32, len(resp.Data))
+	for i, d := range resp.Data {
+		vectors[i] = d.Embedding
+	}
+	return vectors, nil
+}
+
+// mockEmbedder 按字符哈希生成归一化向量，仅用于开发环境
+type mockEmbedder struct{}
+
+const mockEmbeddingDim = 64
+
+func (mockEmbedder) Model() string { return "mock" }
+
+func (mockEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, mockEmbeddingDim)
+		for _, r := range text {
+			h := fnv.New32a()
+			_, _ = h.Write([]byte(string(r)))
+			v[h.Sum32()%mockEmbeddingDim]++
+		}
+		var norm float64
+		for _, x := range v {
+			norm += float64(x * x)
+		}
+		if norm > 0 {
+			n := float32(math.Sqrt(norm))
+			for j := range v {
+				v[j] /= n
+			}
+		}
+		vectors[i] = v
+	}
+	return vectors, nil
+}
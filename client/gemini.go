@@ -37,6 +37,11 @@ type geminiGenerateResponse struct {
 	Candidates []struct {
 		Content geminiContent `json:"content"`
 	} `json:"candidates"`
+	UsageMetadata *struct {
+		PromptTokenCount        int `json:"promptTokenCount"`
+		CandidatesTokenCount    int `json:"candidatesTokenCount"`
+		CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	} `json:"usageMetadata"`
 }
 
 func (c *geminiClient) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
@@ -98,6 +103,14 @@ func (c *geminiClient) Chat(ctx context.Context, req *ChatRequest) (*ChatRespons
 		if len(gr.Candidates) == 0 || len(gr.Candidates[0].Content.Parts) == 0 {
 			return nil, fmt.Errorf("gemini 响应中不包含内容")
 		}
-		return &ChatResponse{Content: gr.Candidates[0].Content.Parts[0].Text}, nil
+		out := &ChatResponse{Content: gr.Candidates[0].Content.Parts[0].Text}
+		if u := gr.UsageMetadata; u != nil {
+			out.Usage = &Usage{
+				InputTokens:       u.PromptTokenCount,
+				OutputTokens:      u.CandidatesTokenCount,
+				CachedInputTokens: u.CachedContentTokenCount,
+			}
+		}
+		return out, nil
 	})
 }
@@ -10,6 +10,21 @@ import (
 	"time"
 )
 
+// HTTPError provider 返回非 2xx 状态码，调用方可据 StatusCode 与 Body 对错误分类
+type HTTPError struct {
+	Provider   Provider
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	name := string(e.Provider)
+	if name == "" {
+		name = "LLM"
+	}
+	return fmt.Sprintf("%s 响应错误: status=%d, body=%s", name, e.StatusCode, e.Body)
+}
+
 type httpClient struct {
 	http *http.Client
 	cfg  *Config
@@ -27,6 +42,15 @@ func newHTTPClient(cfg *Config) *httpClient {
 }
 
 func (c *httpClient) doRequest(ctx context.Context, url string, payload any, parse func([]byte) (*ChatResponse, error)) (*ChatResponse, error) {
+	respBytes, err := c.post(ctx, url, payload)
+	if err != nil {
+		return nil, err
+	}
+	return parse(respBytes)
+}
+
+// post 发送 JSON 请求并返回 2xx 响应体
+func (c *httpClient) post(ctx context.Context, url string, payload any) ([]byte, error) {
 	buf, err := json.Marshal(payload)
 	if err != nil {
 		return nil, fmt.Errorf("序列化请求失败: %w", err)
@@ -56,10 +80,10 @@ func (c *httpClient) doRequest(ctx context.Context, url string, payload any, par
 	}
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("LLM 响应错误: status=%d, body=%s", resp.StatusCode, string(respBytes))
+		return nil, &HTTPError{Provider: c.cfg.Provider, StatusCode: resp.StatusCode, Body: string(respBytes)}
 	}
 
-	return parse(respBytes)
+	return respBytes, nil
 }
 
 func ioReadAll(r io.Reader) ([]byte, error) {
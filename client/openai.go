@@ -15,10 +15,10 @@ func newOpenAIClient(cfg *Config) *openAIClient {
 }
 
 type openAIChatRequest struct {
-	Model       string              `json:"model"`
-	Messages    []openAIChatMessage `json:"messages"`
-	Temperature float32             `json:"temperature,omitempty"`
-	MaxTokens   int                 `json:"max_tokens,omitempty"`
+	Model       string                 `json:"model"`
+	Messages    []openAIRequestMessage `json:"messages"`
+	Temperature float32                `json:"temperature,omitempty"`
+	MaxTokens   int                    `json:"max_tokens,omitempty"`
 }
 
 type openAIChatMessage struct {
@@ -26,10 +26,33 @@ type openAIChatMessage struct {
 	Content string `json:"content"`
 }
 
+// openAIRequestMessage Content 为纯文本，或带图片时为 text/image_url 内容数组
+type openAIRequestMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"`
+}
+
+type openAIContentPart struct {
+	Type     string          `json:"type"`
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
 type openAIChatResponse struct {
 	Choices []struct {
 		Message openAIChatMessage `json:"message"`
 	} `json:"choices"`
+	Usage *struct {
+		PromptTokens        int `json:"prompt_tokens"`
+		CompletionTokens    int `json:"completion_tokens"`
+		PromptTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details"`
+	} `json:"usage"`
 }
 
 func (c *openAIClient) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
@@ -43,18 +66,18 @@ func (c *openAIClient) Chat(ctx context.Context, req *ChatRequest) (*ChatRespons
 	}
 	url := fmt.Sprintf("%s/v1/chat/completions", baseURL)
 
-	var messages []openAIChatMessage
+	var messages []openAIRequestMessage
 	if req.System != "" {
-		messages = append(messages, openAIChatMessage{Role: "system", Content: req.System})
+		messages = append(messages, openAIRequestMessage{Role: "system", Content: req.System})
 	}
 	for _, m := range req.Messages {
 		role := m.Role
 		if role == "" {
 			role = "user"
 		}
-		messages = append(messages, openAIChatMessage{
+		messages = append(messages, openAIRequestMessage{
 			Role:    role,
-			Content: m.Content,
+			Content: openAIContent(m),
 		})
 	}
 
@@ -73,6 +96,29 @@ func (c *openAIClient) Chat(ctx context.Context, req *ChatRequest) (*ChatRespons
 		if len(resp.Choices) == 0 {
 			return nil, fmt.Errorf("OpenAI 响应中不包含 choices")
 		}
-		return &ChatResponse{Content: resp.Choices[0].Message.Content}, nil
+		out := &ChatResponse{Content: resp.Choices[0].Message.Content}
+		if u := resp.Usage; u != nil {
+			out.Usage = &Usage{
+				InputTokens:       u.PromptTokens,
+				OutputTokens:      u.CompletionTokens,
+				CachedInputTokens: u.PromptTokensDetails.CachedTokens,
+			}
+		}
+		return out, nil
 	})
 }
+
+// openAIContent 带图片的消息使用内容数组，否则保持纯文本
+func openAIContent(m ChatMessage) any {
+	if len(m.Images) == 0 {
+		return m.Content
+	}
+	parts := make([]openAIContentPart, 0, len(m.Images)+1)
+	if m.Content != "" {
+		parts = append(parts, openAIContentPart{Type: "text", Text: m.Content})
+	}
+	for _, img := range m.Images {
+		parts = append(parts, openAIContentPart{Type: "image_url", ImageURL: &openAIImageURL{URL: img.URL}})
+	}
+	return parts
+}
@@ -5,18 +5,23 @@ import "time"
 // AuditLog 表示单次 LLM 调用的审计日志记录
 // 主要用于安全审计与问题排查，记录用户、资源、请求与响应等信息。
 type AuditLog struct {
-	ID           int64     `gorm:"primaryKey;autoIncrement"`                           // 主键 ID
-	UserID       int64     `gorm:"index:idx_llm_audit_logs_user_id"`                   // 触发调用的用户 ID
-	Action       string    `gorm:"size:50;not null;index:idx_llm_audit_logs_action"`   // 操作类型，如 "chat"、"admin.update_config"
-	ResourceType string    `gorm:"size:50"`                                            // 资源类型，如 "prompt"、"provider_config"
-	ResourceID   int64     `gorm:""`                                                   // 资源 ID
-	RequestJSON  string    `gorm:"type:text"`                                          // 请求内容序列化（含参数、上下文）
-	ResponseJSON string    `gorm:"type:text"`                                          // 响应内容序列化
-	IPAddress    string    `gorm:"size:50"`                                            // 客户端 IP 地址
-	UserAgent    string    `gorm:"type:text"`                                          // 客户端 User-Agent
-	Status       string    `gorm:"size:20"`                                            // 结果状态，如 "success"、"error"
-	ErrorMessage string    `gorm:"type:text"`                                          // 错误信息（如有）
-	CreatedAt    time.Time `gorm:"autoCreateTime;index:idx_llm_audit_logs_created_at"` // 创建时间
+	ID             int64     `gorm:"primaryKey;autoIncrement"`                           // 主键 ID
+	UserID         int64     `gorm:"index:idx_llm_audit_logs_user_id"`                   // 触发调用的用户 ID
+	RequestID      string    `gorm:"size:64;index:idx_llm_audit_logs_request_id"`        // 调用请求 ID，与同一调用的指标记录一致
+	Action         string    `gorm:"size:50;not null;index:idx_llm_audit_logs_action"`   // 操作类型，如 "chat"、"admin.update_config"
+	ResourceType   string    `gorm:"size:50"`                                            // 资源类型，如 "prompt"、"provider_config"
+	ResourceID     int64     `gorm:""`                                                   // 资源 ID
+	RequestJSON    string    `gorm:"type:text"`                                          // 请求内容序列化（含参数、上下文）
+	ResponseJSON   string    `gorm:"type:text"`                                          // 响应内容序列化
+	IPAddress      string    `gorm:"size:50"`                                            // 客户端 IP 地址
+	UserAgent      string    `gorm:"type:text"`                                          // 客户端 User-Agent
+	Route          string    `gorm:"size:200"`                                           // 触发的 HTTP 路由，如 "PUT /admin/llm/safety"
+	Status         string    `gorm:"size:20"`                                            // 结果状态，如 "success"、"error"
+	ErrorMessage   string    `gorm:"type:text"`                                          // 错误信息（如有）
+	PayloadOmitted bool      `gorm:"not null;default:false"`                             // 请求/响应正文是否因采样未保存
+	PolicyID       int64     `gorm:"not null;default:0"`                                 // 记录时生效的安全策略 ID
+	PolicyVersion  int       `gorm:"not null;default:0"`                                 // 记录时生效的安全策略版本
+	CreatedAt      time.Time `gorm:"autoCreateTime;index:idx_llm_audit_logs_created_at"` // 创建时间
 }
 
 func (AuditLog) TableName() string {
@@ -26,28 +31,53 @@ func (AuditLog) TableName() string {
 // Metrics 表示 LLM 调用的指标统计记录
 // 用于存储单次调用的 Provider、模型、token 用量、时延、成本与结果状态等信息。
 type Metrics struct {
-	ID             int64     `gorm:"primaryKey;autoIncrement"`                        // 主键 ID
-	Provider       string    `gorm:"size:50;not null;index:idx_llm_metrics_provider"` // Provider 名称
-	Model          string    `gorm:"size:100"`                                        // 模型名称
-	UserID         int64     `gorm:"index:idx_llm_metrics_user_id"`                   // 用户 ID
-	ABTestID       int64     `gorm:"index:idx_llm_metrics_ab_test_id"`                // A/B 测试 ID
-	ABVariant      string    `gorm:"size:5"`                                          // A/B 测试变体标识，如 "A"/"B"
-	PromptTemplate int64     `gorm:"index:idx_llm_metrics_prompt_template_id"`        // 使用的提示词模板 ID
-	RequestTokens  int       `gorm:""`                                                // 请求 token 数
-	ResponseTokens int       `gorm:""`                                                // 响应 token 数
-	TotalTokens    int       `gorm:""`                                                // 总 token 数
-	LatencyMs      int       `gorm:""`                                                // 调用耗时（毫秒）
-	CostUSD        float64   `gorm:"type:decimal(10,6)"`                              // 估算花费（USD）
-	Status         string    `gorm:"size:20"`                                         // 调用状态，如 "success"/"error"
-	ErrorType      string    `gorm:"size:50"`                                         // 错误类型，如超时、配额不足等
-	Outcome        string    `gorm:"size:50"`                                         // 额外事件，如 conversion
-	CreatedAt      time.Time `gorm:"autoCreateTime;index:idx_llm_metrics_created_at"` // 创建时间
+	ID              int64     `gorm:"primaryKey;autoIncrement"`                        // 主键 ID
+	Provider        string    `gorm:"size:50;not null;index:idx_llm_metrics_provider"` // Provider 名称
+	Model           string    `gorm:"size:100"`                                        // 模型名称
+	Endpoint        string    `gorm:"size:100;index:idx_llm_metrics_endpoint"`         // 端点名称（同 provider/model 可有多个端点）
+	RequestID       string    `gorm:"size:64;index:idx_llm_metrics_request_id"`        // 调用请求 ID；转化记录为归因的来源调用请求 ID
+	UserID          int64     `gorm:"index:idx_llm_metrics_user_id"`                   // 用户 ID
+	ConversationID  int64     `gorm:"index:idx_llm_metrics_conversation_id"`           // 所属会话 ID（绑定会话的调用）
+	OrgID           int64     `gorm:"index:idx_llm_metrics_org_id"`                    // 调用方所属组织 ID（取自请求上下文的作用域）
+	ABTestID        int64     `gorm:"index:idx_llm_metrics_ab_test_id"`                // A/B 测试 ID
+	ABVariant       string    `gorm:"size:20"`                                         // A/B 测试变体标识，如 "A"/"B"/"holdout"
+	PromptTemplate  int64     `gorm:"index:idx_llm_metrics_prompt_template_id"`        // 使用的提示词模板 ID
+	RequestTokens   int       `gorm:""`                                                // 请求 token 数
+	ResponseTokens  int       `gorm:""`                                                // 响应 token 数
+	TotalTokens     int       `gorm:""`                                                // 总 token 数
+	CachedTokens    int       `gorm:"not null;default:0"`                              // 请求 token 中命中 provider 提示缓存的部分
+	LatencyMs       int       `gorm:""`                                                // 调用耗时（毫秒）
+	CostUSD         float64   `gorm:"type:decimal(10,6)"`                              // 估算花费（USD）
+	Status          string    `gorm:"size:20"`                                         // 调用状态，如 "success"/"error"
+	ErrorType       string    `gorm:"size:50"`                                         // 错误分类（MetricsError*），原始错误信息记入审计日志
+	Outcome         string    `gorm:"size:50"`                                         // 额外事件，如 conversion
+	Score           float64   `gorm:"type:decimal(6,3)"`                               // 评估分数（仅 status=eval 时有效）
+	IsTest          bool      `gorm:"not null;default:false"`                          // 是否为测试流量（如 Playground），默认不计入统计
+	CacheHit        bool      `gorm:"not null;default:false"`                          // 是否复用了缓存/合并请求的结果（未实际调用 provider，token 与成本记为 0）
+	Degraded        bool      `gorm:"not null;default:false"`                          // 是否以降级（兜底）回复响应调用方
+	RetriedAttempts int       `gorm:"not null;default:0"`                              // 首次调用之外的额外调用次数（端点故障转移与重新生成）
+	SampleWeight    int       `gorm:"not null;default:1"`                              // 样本权重：按采样率写入时一条记录代表的调用数，聚合统计按权重累加
+	AgeScore        *float64  `gorm:"type:decimal(6,3)"`                               // 输出适龄分数（0-1，age_rating 检查器启用时记录）
+	ToxicityScore   *float64  `gorm:"type:decimal(6,3)"`                               // 输出毒性分数（0-1，age_rating 检查器启用时记录）
+	CreatedAt       time.Time `gorm:"autoCreateTime;index:idx_llm_metrics_created_at"` // 创建时间
 }
 
 func (Metrics) TableName() string {
 	return "llm_metrics"
 }
 
+// Metrics.ErrorType 的固定分类
+const (
+	MetricsErrorTimeout       = "timeout"        // 调用超时或上游网关超时
+	MetricsErrorRateLimited   = "rate_limited"   // 本地限流或 provider 返回 429
+	MetricsErrorAuth          = "auth"           // 凭证无效或无权限（401/403）
+	MetricsErrorProvider5xx   = "provider_5xx"   // provider 服务端错误
+	MetricsErrorSafetyBlocked = "safety_blocked" // 被安全检查或 provider 内容策略拒绝
+	MetricsErrorContextLength = "context_length" // 超出模型上下文长度
+	MetricsErrorUnavailable   = "unavailable"    // 没有可用端点（未配置、熔断或冷却中）
+	MetricsErrorOther         = "other"          // 无法归类的错误
+)
+
 // RateLimit 表示在特定时间窗口内的限流统计记录
 // 按用户与资源类型维度记录请求次数与已消费令牌数，用于实现令牌桶限流策略。
 type RateLimit struct {
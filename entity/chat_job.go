@@ -0,0 +1,35 @@
+package entity
+
+import "time"
+
+// ChatJob 状态常量
+const (
+	ChatJobStatusPending   = "pending"
+	ChatJobStatusRunning   = "running"
+	ChatJobStatusSucceeded = "succeeded"
+	ChatJobStatusFailed    = "failed"
+)
+
+// ChatJob 异步聊天任务
+// 用于长耗时生成场景：调用方提交后轮询状态或通过回调获取结果。
+type ChatJob struct {
+	ID             int64      `gorm:"primaryKey;autoIncrement"`                                          // 任务主键 ID
+	UserID         int64      `gorm:"index:idx_llm_chat_jobs_user_id"`                                   // 提交用户 ID
+	Status         string     `gorm:"size:20;not null;default:'pending';index:idx_llm_chat_jobs_status"` // 状态：pending/running/succeeded/failed
+	RequestJSON    string     `gorm:"type:text;not null"`                                                // 聊天请求序列化
+	ResponseJSON   string     `gorm:"type:text"`                                                         // 聊天响应序列化
+	ErrorMessage   string     `gorm:"type:text"`                                                         // 错误信息（如有）
+	CallbackURL    string     `gorm:"size:500"`                                                          // 完成后回调地址（可选）
+	CallbackStatus string     `gorm:"size:20"`                                                           // 回调结果：sent/failed
+	Attempts       int        `gorm:"not null;default:0"`                                                // 执行次数
+	StartedAt      *time.Time `gorm:""`                                                                  // 开始执行时间
+	FinishedAt     *time.Time `gorm:""`                                                                  // 完成时间
+	LockedUntil    *time.Time `gorm:"index:idx_llm_chat_jobs_locked_until"`                              // 执行租约截止时间，由心跳续期；running 且租约过期视为执行实例失联，重新排队
+	HeartbeatAt    *time.Time `gorm:""`                                                                  // 最近一次心跳时间
+	CreatedAt      time.Time  `gorm:"autoCreateTime;index:idx_llm_chat_jobs_created_at"`                 // 创建时间
+	UpdatedAt      time.Time  `gorm:"autoUpdateTime"`                                                    // 更新时间
+}
+
+func (ChatJob) TableName() string {
+	return "llm_chat_jobs"
+}
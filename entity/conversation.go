@@ -10,6 +10,13 @@ const (
 	ConversationTypeStory = "story"
 )
 
+// 会话状态
+const (
+	ConversationStatusActive   = "active"
+	ConversationStatusArchived = "archived" // 已归档，默认不出现在会话列表中
+	ConversationStatusDeleted  = "deleted"  // 已删除，保留期满后由清理任务物理删除
+)
+
 // Conversation 会话实体
 // 支持普通聊天和故事生成两种场景
 type Conversation struct {
@@ -26,15 +33,132 @@ type Conversation struct {
 	// PromptTemplateID 关联的提示词模板（如故事世界）
 	PromptTemplateID *int64 `gorm:"index:idx_llm_conversations_prompt_template_id"` // 关联的提示词模板 ID
 
-	MetadataJSON string    `gorm:"type:text"`      // 额外元数据（JSON）
-	CreatedAt    time.Time `gorm:"autoCreateTime"` // 创建时间
-	UpdatedAt    time.Time `gorm:"autoUpdateTime"` // 更新时间
+	// Summary 由模型生成的会话摘要，随新消息增量刷新
+	Summary          string     `gorm:"type:text"`
+	SummaryMessageID int64      `gorm:"not null;default:0"` // 摘要已覆盖到的最后一条消息 ID
+	SummaryAt        *time.Time `gorm:""`                   // 摘要最近刷新时间
+
+	// 用量累计：MessageTokens 为消息内容的估算 token 之和，其余为绑定该会话的模型调用累计用量
+	MessageTokens    int64   `gorm:"not null;default:0"`           // 消息 token 累计
+	PromptTokens     int64   `gorm:"not null;default:0"`           // 模型输入 token 累计
+	CompletionTokens int64   `gorm:"not null;default:0"`           // 模型输出 token 累计
+	RequestCount     int64   `gorm:"not null;default:0"`           // 模型调用次数
+	CostUSD          float64 `gorm:"type:decimal(12,6);default:0"` // 模型调用成本累计（USD）
+
+	// MemoryMessageID 长期记忆提取已处理到的最后一条消息 ID
+	MemoryMessageID int64 `gorm:"not null;default:0"`
+
+	// SettingsJSON 会话级覆盖设置（ConversationSettings 的 JSON），会话内的对话自动应用
+	SettingsJSON string `gorm:"type:text"`
+
+	// StoryStateJSON 故事会话的结构化进度（StoryState 的 JSON），仅通过状态流转修改
+	StoryStateJSON string `gorm:"type:text"`
+	// StoryStateSeq 已应用的状态流转次数，与 StoryStateChange.Seq 对应，用于并发校验
+	StoryStateSeq int64 `gorm:"not null;default:0"`
+
+	// LastMessageAt 最近一条消息的时间，会话列表按此排序
+	LastMessageAt *time.Time `gorm:"index:idx_llm_conversations_last_message_at"`
+	// UnreadCount 当前用户的未读消息数，仅列表等面向用户的接口填充
+	UnreadCount int64 `gorm:"-"`
+	// DeletedAt 软删除时间，非空时会话及其消息对读取接口不可见
+	DeletedAt *time.Time `gorm:"index:idx_llm_conversations_deleted_at"`
+
+	MetadataJSON string    `gorm:"type:text"`                                             // 额外元数据（JSON）
+	CreatedAt    time.Time `gorm:"autoCreateTime"`                                        // 创建时间
+	UpdatedAt    time.Time `gorm:"autoUpdateTime;index:idx_llm_conversations_updated_at"` // 更新时间
 }
 
 func (Conversation) TableName() string {
 	return "llm_conversations"
 }
 
+// ConversationUsage 会话用量；作为增量传给仓储时各字段为本次增加的值
+type ConversationUsage struct {
+	MessageTokens    int64   `json:"message_tokens"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"` // PromptTokens + CompletionTokens
+	RequestCount     int64   `json:"request_count"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// ConversationSettings 会话级覆盖设置，零值字段不生效
+type ConversationSettings struct {
+	// SystemPrompt 追加在会话绑定模板之后、请求自带 System 之前的系统提示
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	// Temperature 非空时覆盖请求的采样温度
+	Temperature *float32 `json:"temperature,omitempty"`
+	// ModelTag 优先使用的端点（匹配端点名称或模型名），不可用时按常规路由
+	ModelTag string `json:"model_tag,omitempty"`
+}
+
+// 会话列表排序方式
+const (
+	ConversationSortLastActivity = "last_activity" // 按最近消息时间倒序（默认）
+	ConversationSortCreated      = "created"       // 按创建时间倒序
+	ConversationSortUpdated      = "updated"       // 按更新时间倒序
+)
+
+// ConversationFilter 会话列表的筛选条件
+type ConversationFilter struct {
+	UserID      int64      // 归属用户 ID（必填）
+	Type        string     // 会话类型（可选）
+	Status      string     // 会话状态（可选），为空时仅列出 active 会话
+	UpdatedFrom *time.Time // 更新时间下限（可选）
+	UpdatedTo   *time.Time // 更新时间上限（可选）
+	Sort        string     // 排序方式，见 ConversationSort*
+	// IncludeShared 同时列出共享给该用户的会话（团队空间）
+	IncludeShared bool
+}
+
+// 会话共享访问级别；会话归属用户拥有全部权限
+const (
+	ConversationAccessViewer  = "viewer"  // 可读取会话与消息
+	ConversationAccessEditor  = "editor"  // 可读取并追加消息
+	ConversationAccessManager = "manager" // 在 editor 基础上可管理 viewer/editor 参与者
+)
+
+// ConversationRoleOwner 参与者列表中会话归属用户的角色
+const ConversationRoleOwner = "owner"
+
+// ConversationParticipant 会话参与者：归属用户与被共享用户
+type ConversationParticipant struct {
+	UserID    int64     `json:"user_id"`
+	Role      string    `json:"role"` // owner 或 ConversationAccess*
+	GrantedBy int64     `json:"granted_by,omitempty"`
+	JoinedAt  time.Time `json:"joined_at"`
+}
+
+// ConversationAccess 会话共享授权：归属用户之外的用户对会话的访问级别
+type ConversationAccess struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement"`                                                                          // 主键 ID
+	ConversationID int64     `gorm:"not null;uniqueIndex:uk_llm_conversation_access,priority:1"`                                        // 会话 ID
+	UserID         int64     `gorm:"not null;uniqueIndex:uk_llm_conversation_access,priority:2;index:idx_llm_conversation_access_user"` // 被授权用户 ID
+	Role           string    `gorm:"size:20;not null"`                                                                                  // 访问级别，见 ConversationAccess*
+	GrantedBy      int64     `gorm:"not null;default:0"`                                                                                // 授权人用户 ID
+	CreatedAt      time.Time `gorm:"autoCreateTime"`                                                                                    // 创建时间
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`                                                                                    // 更新时间
+}
+
+func (ConversationAccess) TableName() string {
+	return "llm_conversation_access"
+}
+
+// ConversationReadState 会话参与者（归属用户与被共享用户）的已读进度，随消息写入在同一事务中更新
+type ConversationReadState struct {
+	ID                int64      `gorm:"primaryKey;autoIncrement"`                                                                        // 主键 ID
+	ConversationID    int64      `gorm:"not null;uniqueIndex:uk_llm_conversation_reads,priority:1"`                                       // 会话 ID
+	UserID            int64      `gorm:"not null;uniqueIndex:uk_llm_conversation_reads,priority:2;index:idx_llm_conversation_reads_user"` // 参与者用户 ID
+	LastReadMessageID int64      `gorm:"not null;default:0"`                                                                              // 已读到的最后一条消息 ID
+	UnreadCount       int64      `gorm:"not null;default:0"`                                                                              // 未读消息数
+	LastReadAt        *time.Time `gorm:""`                                                                                                // 最近标记已读时间
+	UpdatedAt         time.Time  `gorm:"autoUpdateTime"`                                                                                  // 更新时间
+}
+
+func (ConversationReadState) TableName() string {
+	return "llm_conversation_reads"
+}
+
 // StoryConversationMetadata 故事会话的元数据结构（存储在 MetadataJSON 中）
 // 替代原 StorySegmentRecord 的 Chapter/Scene 等字段
 type StoryConversationMetadata struct {
@@ -48,17 +172,141 @@ type Message struct {
 	ConversationID int64     `gorm:"not null;index:idx_llm_messages_conversation_id"`  // 所属会话 ID
 	Role           string    `gorm:"size:20;not null"`                                 // 角色，如 user/system/assistant
 	Content        string    `gorm:"type:text;not null"`                               // 消息内容
+	SenderUserID   int64     `gorm:"not null;default:0"`                               // 发送消息的用户 ID，模型与系统消息为 0；发送者的未读数不增加
 	Tokens         int       `gorm:""`                                                 // 消息 token 数（可选）
 	MetadataJSON   string    `gorm:"type:text"`                                        // 额外元数据（JSON）
 	CreatedAt      time.Time `gorm:"autoCreateTime;index:idx_llm_messages_created_at"` // 创建时间
+	// DeletedAt 软删除时间（随会话删除级联写入）
+	DeletedAt *time.Time `gorm:""`
+	// ClientMessageID 客户端生成的消息 UUID（可选，全局唯一），客户端重试写入时返回已有消息而不重复插入
+	ClientMessageID *string `gorm:"size:64;uniqueIndex:uk_llm_messages_client_message_id"`
+
+	// Attachments 消息附件，单独存储在 llm_message_attachments
+	Attachments []*MessageAttachment `gorm:"-"`
 }
 
 func (Message) TableName() string {
 	return "llm_messages"
 }
 
+// MessageAttachment 消息附件：文件引用、类型与抽取出的文本
+type MessageAttachment struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement"`                                   // 主键 ID
+	MessageID      int64     `gorm:"not null;index:idx_llm_message_attachments_message_id"`      // 所属消息 ID
+	ConversationID int64     `gorm:"not null;index:idx_llm_message_attachments_conversation_id"` // 所属会话 ID
+	FileRef        string    `gorm:"size:1000;not null"`                                         // 文件地址或存储键
+	FileName       string    `gorm:"size:200"`                                                   // 原始文件名
+	MimeType       string    `gorm:"size:100;not null"`                                          // MIME 类型
+	SizeBytes      int64     `gorm:"not null;default:0"`                                         // 文件大小
+	ExtractedText  string    `gorm:"type:text"`                                                  // 抽取出的文本（如文档正文、OCR 结果）
+	CreatedAt      time.Time `gorm:"autoCreateTime"`                                             // 创建时间
+}
+
+func (MessageAttachment) TableName() string {
+	return "llm_message_attachments"
+}
+
+// 消息反馈评价
+const (
+	FeedbackThumbsDown = -1
+	FeedbackNeutral    = 0 // 仅文字反馈
+	FeedbackThumbsUp   = 1
+)
+
+// MessageFeedback 用户对助手消息的反馈，每个用户对每条消息一条（重复提交覆盖）；
+// 产生消息的 provider/模型/模板/A-B 变体取自消息元数据，用于按维度统计反馈率
+type MessageFeedback struct {
+	ID               int64     `gorm:"primaryKey;autoIncrement"`                                          // 主键 ID
+	MessageID        int64     `gorm:"not null;uniqueIndex:uk_llm_message_feedback,priority:1"`           // 消息 ID
+	UserID           int64     `gorm:"not null;uniqueIndex:uk_llm_message_feedback,priority:2"`           // 反馈用户 ID
+	ConversationID   int64     `gorm:"not null;index:idx_llm_message_feedback_conversation_id"`           // 会话 ID
+	Rating           int       `gorm:"not null;default:0"`                                                // 评价，见 Feedback*
+	Comment          string    `gorm:"type:text"`                                                         // 文字反馈
+	Provider         string    `gorm:"size:50"`                                                           // 产生消息的 Provider
+	Model            string    `gorm:"size:100"`                                                          // 产生消息的模型
+	PromptTemplateID int64     `gorm:"not null;default:0;index:idx_llm_message_feedback_prompt_template"` // 产生消息的提示词模板 ID
+	ABTestID         int64     `gorm:"not null;default:0"`                                                // A/B 测试 ID
+	ABVariant        string    `gorm:"size:20"`                                                           // A/B 变体
+	CreatedAt        time.Time `gorm:"autoCreateTime;index:idx_llm_message_feedback_created_at"`          // 创建时间
+	UpdatedAt        time.Time `gorm:"autoUpdateTime"`                                                    // 更新时间
+}
+
+func (MessageFeedback) TableName() string {
+	return "llm_message_feedback"
+}
+
+// MessageQuery 消息分页查询：BeforeID/AfterID 为游标（消息 ID），均为空时从最新消息开始
+type MessageQuery struct {
+	ConversationID int64 // 会话 ID
+	BeforeID       int64 // 仅返回 ID 小于该值的消息（向更早翻页）
+	AfterID        int64 // 仅返回 ID 大于该值的消息（拉取更新的消息）
+	Limit          int   // 每页条数
+	Ascending      bool  // 结果按时间正序返回，默认倒序
+}
+
 // StoryMessageMetadata 故事消息的元数据结构（存储在 MetadataJSON 中）
 // 替代原 StorySegmentRecord 的 HighlightTaskIDsJSON
 type StoryMessageMetadata struct {
 	HighlightTaskIDs []int64 `json:"highlight_task_ids"` // 高亮的任务 ID
 }
+
+// ConversationShare 会话分享链接：创建时生成的只读快照（已脱敏），凭 Token 公开访问
+type ConversationShare struct {
+	ID             int64      `gorm:"primaryKey;autoIncrement"`                                // 主键 ID
+	Token          string     `gorm:"size:64;not null;uniqueIndex:uk_llm_conversation_shares"` // 访问令牌
+	ConversationID int64      `gorm:"not null;index:idx_llm_conversation_shares_conversation"` // 会话 ID
+	UserID         int64      `gorm:"not null"`                                                // 创建分享的用户 ID（会话归属用户）
+	SnapshotJSON   string     `gorm:"type:text;not null"`                                      // 快照内容（JSON）
+	MessageCount   int        `gorm:"not null;default:0"`                                      // 快照中的消息数
+	ExpiresAt      *time.Time `gorm:""`                                                        // 过期时间，为空表示不过期
+	RevokedAt      *time.Time `gorm:""`                                                        // 撤销时间
+	CreatedAt      time.Time  `gorm:"autoCreateTime"`                                          // 创建时间
+}
+
+func (ConversationShare) TableName() string {
+	return "llm_conversation_shares"
+}
+
+// 故事任务状态
+const (
+	StoryTaskActive    = "active"
+	StoryTaskCompleted = "completed"
+	StoryTaskFailed    = "failed"
+)
+
+// 故事状态流转事件
+const (
+	StoryEventStartTask    = "start_task"    // 开始任务，需当前没有进行中的任务
+	StoryEventCompleteTask = "complete_task" // 完成进行中的任务
+	StoryEventFailTask     = "fail_task"     // 进行中的任务失败
+	StoryEventNextScene    = "next_scene"    // 进入下一场景，需当前没有进行中的任务
+	StoryEventNextChapter  = "next_chapter"  // 进入下一章（场景从 1 开始），需当前没有进行中的任务
+	StoryEventFinish       = "finish"        // 故事完结，之后不再接受流转
+)
+
+// StoryState 故事会话的结构化进度：章节/场景从 1 开始，同一时刻至多一个任务
+type StoryState struct {
+	Chapter        int      `json:"chapter"`
+	Scene          int      `json:"scene"`
+	TaskID         string   `json:"task_id,omitempty"`
+	TaskStatus     string   `json:"task_status,omitempty"`     // 见 StoryTask*
+	CompletedTasks []string `json:"completed_tasks,omitempty"` // 已完成的任务 ID，按完成顺序
+	Finished       bool     `json:"finished"`
+}
+
+// StoryStateChange 故事状态流转记录，与会话状态更新在同一事务中写入
+type StoryStateChange struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement"`                                    // 主键 ID
+	ConversationID int64     `gorm:"not null;uniqueIndex:uk_llm_story_state_changes,priority:1"`  // 会话 ID
+	Seq            int64     `gorm:"not null;uniqueIndex:uk_llm_story_state_changes,priority:2"`  // 流转序号，从 1 递增
+	Event          string    `gorm:"size:30;not null"`                                            // 流转事件，见 StoryEvent*
+	FromStateJSON  string    `gorm:"type:text"`                                                   // 流转前状态
+	ToStateJSON    string    `gorm:"type:text;not null"`                                          // 流转后状态
+	ActorID        int64     `gorm:"not null;default:0"`                                          // 操作用户 ID，0 表示系统
+	Reason         string    `gorm:"size:500"`                                                    // 流转说明
+	CreatedAt      time.Time `gorm:"autoCreateTime;index:idx_llm_story_state_changes_created_at"` // 创建时间
+}
+
+func (StoryStateChange) TableName() string {
+	return "llm_story_state_changes"
+}
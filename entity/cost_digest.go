@@ -0,0 +1,29 @@
+package entity
+
+import "time"
+
+// 成本日报的投递状态
+const (
+	CostDigestDeliveryNone   = ""       // 未配置投递渠道
+	CostDigestDeliverySent   = "sent"   // 全部渠道投递成功
+	CostDigestDeliveryFailed = "failed" // 至少一个渠道投递失败
+)
+
+// CostDigest 按 UTC 自然日生成的成本/用量日报；ContentJSON 为完整日报内容（service.CostDigestReport）
+type CostDigest struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement"`                             // 主键 ID
+	Day            string    `gorm:"size:10;not null;uniqueIndex:uk_llm_cost_digests_day"` // 统计日期（UTC），如 2006-01-02
+	TotalCalls     int       `gorm:"not null;default:0"`                                   // 调用次数
+	TotalTokens    int       `gorm:"not null;default:0"`                                   // token 总数
+	TotalCostUSD   float64   `gorm:"type:decimal(14,6);not null;default:0"`                // 总成本（USD）
+	PrevCostUSD    float64   `gorm:"type:decimal(14,6);not null;default:0"`                // 前一日总成本（USD）
+	ContentJSON    string    `gorm:"type:text"`                                            // 完整日报内容
+	DeliveryStatus string    `gorm:"size:20"`                                              // 投递状态（CostDigestDelivery*）
+	DeliveryError  string    `gorm:"size:500"`                                             // 投递失败原因
+	CreatedAt      time.Time `gorm:"autoCreateTime"`                                       // 创建时间
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`                                       // 更新时间
+}
+
+func (CostDigest) TableName() string {
+	return "llm_cost_digests"
+}
@@ -0,0 +1,22 @@
+package entity
+
+import "time"
+
+// MessageEmbedding 会话消息的向量索引（内置向量存储使用），每条消息一行
+type MessageEmbedding struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement"`                                  // 主键 ID
+	MessageID      int64     `gorm:"not null;uniqueIndex:uk_llm_message_embeddings_message_id"` // 消息 ID
+	ConversationID int64     `gorm:"not null;index:idx_llm_message_embeddings_conversation_id"` // 会话 ID
+	UserID         int64     `gorm:"not null;index:idx_llm_message_embeddings_user_id"`         // 会话归属用户 ID
+	Role           string    `gorm:"size:20;not null"`                                          // 消息角色
+	Content        string    `gorm:"type:text"`                                                 // 被向量化的文本（截断后）
+	Model          string    `gorm:"size:100;not null"`                                         // 向量模型
+	Dim            int       `gorm:"not null"`                                                  // 向量维度
+	VectorJSON     string    `gorm:"type:text;not null"`                                        // 向量（JSON 数组）
+	MessageAt      time.Time `gorm:"not null"`                                                  // 消息创建时间
+	CreatedAt      time.Time `gorm:"autoCreateTime"`                                            // 创建时间
+}
+
+func (MessageEmbedding) TableName() string {
+	return "llm_message_embeddings"
+}
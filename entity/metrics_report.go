@@ -7,6 +7,7 @@ import "time"
 type MetricsFilter struct {
 	Provider  string     // Provider 名称
 	Model     string     // 模型名称
+	Endpoint  string     // 端点名称
 	UserID    *int64     // 用户 ID（可选）
 	Status    string     // 调用状态过滤，如 success/error
 	ABTestID  *int64     // A/B 测试 ID（可选）
@@ -14,6 +15,14 @@ type MetricsFilter struct {
 	StartAt   *time.Time // 起始时间（可选）
 	EndAt     *time.Time // 结束时间（可选）
 	Outcome   string     // 目标事件过滤，如 conversion
+
+	ConversationID   *int64 // 会话 ID（可选）
+	OrgID            *int64 // 组织 ID（可选）
+	PromptTemplateID *int64 // 提示词模板 ID（可选）
+	IncludeTest      bool   // 是否包含测试流量（默认排除）
+	RequestID        string // 请求 ID（可选）
+	// CallBased 显著性分析按调用次数计数；默认按去重用户计数，避免重度用户主导结果
+	CallBased bool
 }
 
 // MetricsReport 汇总后的核心指标统计结果
@@ -30,6 +39,78 @@ type MetricsReport struct {
 	TotalTokens         int     `json:"total_tokens"`          // token 总数
 	AvgLatencyMs        float64 `json:"avg_latency_ms"`        // 平均延迟（毫秒）
 	TotalCostUSD        float64 `json:"total_cost_usd"`        // 总成本（USD）
+	CacheHitCalls       int     `json:"cache_hit_calls"`       // 复用缓存结果的调用次数
+	DegradedCalls       int     `json:"degraded_calls"`        // 以降级回复响应的调用次数
+	RetriedCalls        int     `json:"retried_calls"`         // 发生过重试的调用次数
+	RetriedAttempts     int     `json:"retried_attempts"`      // 额外调用次数合计
+}
+
+// GroupMetricsReport 按单一维度分组的指标报告；Key 为分组值（user/template 为 ID，day 为 YYYY-MM-DD）
+type GroupMetricsReport struct {
+	Key     string        `json:"key"`     // 分组值
+	Metrics MetricsReport `json:"metrics"` // 对应分组的汇总指标
+}
+
+// ModelMetricsReport 单个端点模型的指标报告
+type ModelMetricsReport struct {
+	Endpoint string        `json:"endpoint,omitempty"` // 端点名称（按端点分组时）
+	Provider string        `json:"provider"`           // Provider 名称
+	Model    string        `json:"model"`              // 模型名称
+	Metrics  MetricsReport `json:"metrics"`            // 对应模型的汇总指标
+}
+
+// 时间序列的分桶粒度
+const (
+	MetricsIntervalHour = "hour"
+	MetricsIntervalDay  = "day"
+)
+
+// MetricsBucket 时间序列中的一个时间桶（UTC 对齐）；仅统计 ok/error 的实际调用，不含转化与评估记录
+type MetricsBucket struct {
+	Start        time.Time `json:"start"`          // 桶起始时间
+	TotalCalls   int       `json:"total_calls"`    // 调用次数
+	ErrorCalls   int       `json:"error_calls"`    // 失败调用次数
+	ErrorRate    float64   `json:"error_rate"`     // 失败率
+	TotalTokens  int       `json:"total_tokens"`   // token 总数
+	TotalCostUSD float64   `json:"total_cost_usd"` // 总成本（USD）
+	AvgLatencyMs float64   `json:"avg_latency_ms"` // 平均延迟（毫秒）
+}
+
+// CostBreakdown 按用户/组织/模板/模型/端点分组的成本汇总，仅分组维度对应的字段有值
+type CostBreakdown struct {
+	UserID           int64   `json:"user_id,omitempty"`            // 用户 ID（按用户分组时）
+	OrgID            int64   `json:"org_id,omitempty"`             // 组织 ID（按组织分组时）
+	PromptTemplateID int64   `json:"prompt_template_id,omitempty"` // 提示词模板 ID（按模板分组时）
+	Endpoint         string  `json:"endpoint,omitempty"`           // 端点名称（按端点分组时）
+	Provider         string  `json:"provider,omitempty"`           // Provider 名称（按模型/端点分组时）
+	Model            string  `json:"model,omitempty"`              // 模型名称（按模型/端点分组时）
+	Calls            int64   `json:"calls"`                        // 记录数
+	TotalTokens      int64   `json:"total_tokens"`                 // token 总数
+	CostUSD          float64 `json:"cost_usd"`                     // 成本（USD）
+}
+
+// MetricsCounter 进程内按 provider/model/status 累计的指标计数，用于 Prometheus 导出
+type MetricsCounter struct {
+	Provider string  `json:"provider"`
+	Model    string  `json:"model"`
+	Status   string  `json:"status"`
+	Requests int64   `json:"requests"` // 记录数
+	Tokens   int64   `json:"tokens"`   // token 总数
+	CostUSD  float64 `json:"cost_usd"` // 成本（USD）
+}
+
+// FeedbackReport 按模型或提示词模板分组的反馈统计；Responses 为同维度的成功调用数
+type FeedbackReport struct {
+	Provider         string  `json:"provider,omitempty"`           // Provider 名称（按模型分组时）
+	Model            string  `json:"model,omitempty"`              // 模型名称（按模型分组时）
+	PromptTemplateID int64   `json:"prompt_template_id,omitempty"` // 提示词模板 ID（按模板分组时）
+	Responses        int64   `json:"responses"`                    // 成功调用数
+	Feedback         int64   `json:"feedback"`                     // 反馈数
+	ThumbsUp         int64   `json:"thumbs_up"`                    // 点赞数
+	ThumbsDown       int64   `json:"thumbs_down"`                  // 点踩数
+	Comments         int64   `json:"comments"`                     // 带文字的反馈数
+	FeedbackRate     float64 `json:"feedback_rate"`                // 反馈数 / 成功调用数
+	PositiveRate     float64 `json:"positive_rate"`                // 点赞数 / (点赞数 + 点踩数)
 }
 
 // VariantMetricsReport 表示单个实验变体的指标报告
@@ -39,16 +120,105 @@ type VariantMetricsReport struct {
 	Metrics MetricsReport `json:"metrics"` // 对应变体的汇总指标
 }
 
+// ABPairwiseComparison 两个变体之间的转化率比较（双比例 z 检验）
+type ABPairwiseComparison struct {
+	Base           string  `json:"base"`             // 基准变体
+	Variant        string  `json:"variant"`          // 比较变体
+	Lift           float64 `json:"lift"`             // 比较变体相对基准的转化率差值
+	PValue         float64 `json:"p_value"`          // 未校正的 p 值
+	AdjustedPValue float64 `json:"adjusted_p_value"` // 多重比较校正后的 p 值
+	Significant    bool    `json:"significant"`      // 校正后 p 值小于 0.05
+}
+
 // ABSignificanceReport 表示 A/B 测试的显著性分析结果
 // 包含各变体指标、p 值、置信度、胜出方与提升比例等信息。
 type ABSignificanceReport struct {
-	ABTestID   int64                 `json:"ab_test_id"`          // A/B 测试 ID
-	Outcome    string                `json:"outcome,omitempty"`   // 关注的结果事件名称
-	VariantA   *VariantMetricsReport `json:"variant_a,omitempty"` // 变体 A 指标
-	VariantB   *VariantMetricsReport `json:"variant_b,omitempty"` // 变体 B 指标
-	PValue     float64               `json:"p_value"`             // p 值
-	Confidence float64               `json:"confidence"`          // 置信度（0-1）
-	Winner     string                `json:"winner,omitempty"`    // 胜出变体标识
-	Lift       float64               `json:"lift,omitempty"`      // 指标提升比例
-	Note       string                `json:"note,omitempty"`      // 备注说明
+	ABTestID int64                 `json:"ab_test_id"`          // A/B 测试 ID
+	Outcome  string                `json:"outcome,omitempty"`   // 关注的结果事件名称
+	Unit     string                `json:"unit"`                // 计数单位：user（去重用户，默认）或 call（调用次数）
+	VariantA *VariantMetricsReport `json:"variant_a,omitempty"` // 变体 A 指标
+	VariantB *VariantMetricsReport `json:"variant_b,omitempty"` // 变体 B 指标
+
+	Variants         []*VariantMetricsReport `json:"variants,omitempty"` // 全部变体（含留出组）指标，曝光与转化按 Unit 计数
+	ChiSquare        float64                 `json:"chi_square"`         // 卡方统计量（转化/未转化 × 变体）
+	DegreesOfFreedom int                     `json:"degrees_of_freedom"` // 自由度（有样本的变体数 - 1）
+	Pairwise         []*ABPairwiseComparison `json:"pairwise,omitempty"` // 有样本的变体两两比较，p 值经 Holm-Bonferroni 校正
+
+	PValue     float64 `json:"p_value"`          // p 值
+	Confidence float64 `json:"confidence"`       // 置信度（0-1）
+	Winner     string  `json:"winner,omitempty"` // 胜出变体标识
+	Lift       float64 `json:"lift,omitempty"`   // 胜出变体相对首个变体（对照）的转化率提升
+	Note       string  `json:"note,omitempty"`   // 备注说明
+
+	// 贝叶斯分析：最佳挑战者 vs 对照，Beta(1,1) 先验
+	Challenger       string  `json:"challenger,omitempty"` // 最佳非对照变体
+	ProbBeatsControl float64 `json:"prob_beats_control"`   // 挑战者转化率高于对照的后验概率
+	CredibleLow      float64 `json:"credible_low"`         // 转化率差值 95% 可信区间下界
+	CredibleHigh     float64 `json:"credible_high"`        // 转化率差值 95% 可信区间上界
+
+	// 序贯检验（mSPRT）：可随时查看而不放大假阳性，多变体时做 Bonferroni 校正
+	SequentialPValue     float64 `json:"sequential_p_value"`
+	SequentialConfidence float64 `json:"sequential_confidence"`
+}
+
+// ContinuousVariantStats 单个变体在连续指标上的样本统计
+type ContinuousVariantStats struct {
+	Variant string  `json:"variant"` // 变体标识
+	Count   int     `json:"count"`   // 样本数
+	Mean    float64 `json:"mean"`    // 均值
+	StdDev  float64 `json:"std_dev"` // 样本标准差
+	Median  float64 `json:"median"`  // 中位数
+}
+
+// ContinuousComparison 两个变体在连续指标上的比较；p 值均经 Holm-Bonferroni 校正
+type ContinuousComparison struct {
+	Base    string  `json:"base"`    // 基准变体
+	Variant string  `json:"variant"` // 比较变体
+	Diff    float64 `json:"diff"`    // 比较变体均值 - 基准变体均值
+
+	TStat           float64 `json:"t_stat"`             // Welch t 统计量
+	TPValue         float64 `json:"t_p_value"`          // Welch t 检验 p 值（未校正）
+	TAdjustedPValue float64 `json:"t_adjusted_p_value"` // Welch t 检验校正后 p 值
+
+	UStat            float64 `json:"u_stat"`              // Mann-Whitney U 统计量
+	MWPValue         float64 `json:"mw_p_value"`          // Mann-Whitney 检验 p 值（未校正）
+	MWAdjustedPValue float64 `json:"mw_adjusted_p_value"` // Mann-Whitney 检验校正后 p 值
+
+	Significant bool `json:"significant"` // 两种检验校正后 p 值均小于 0.05
+}
+
+// ContinuousSignificanceReport A/B 测试在连续指标（时延、token、评价、评估分数）上的显著性分析
+type ContinuousSignificanceReport struct {
+	ABTestID  int64                     `json:"ab_test_id"`
+	Metric    string                    `json:"metric"`              // 指标，见 repo.SignificanceMetric*
+	Variants  []*ContinuousVariantStats `json:"variants"`            // 各变体样本统计
+	Pairwise  []*ContinuousComparison   `json:"pairwise,omitempty"`  // 变体两两比较
+	Truncated bool                      `json:"truncated,omitempty"` // 部分变体样本超过上限，仅使用最近的样本
+	Note      string                    `json:"note,omitempty"`      // 备注说明
+}
+
+// 漏斗阶段
+const (
+	FunnelStageExposure   = "exposure"   // 发起调用（成功或失败）
+	FunnelStageResponse   = "response"   // 成功返回回复
+	FunnelStageFeedback   = "feedback"   // 对回复给出反馈
+	FunnelStageConversion = "conversion" // 产生转化事件
+)
+
+// FunnelStage 漏斗中的一个阶段
+type FunnelStage struct {
+	Stage       string  `json:"stage"`         // 阶段，见 FunnelStage*
+	Count       int64   `json:"count"`         // 到达该阶段的用户数（按调用计数时为记录数）
+	StepRate    float64 `json:"step_rate"`     // 相对上一阶段的留存率，首个阶段为 1
+	DropOffRate float64 `json:"drop_off_rate"` // 相对上一阶段的流失率（1 - StepRate）
+	OverallRate float64 `json:"overall_rate"`  // 相对曝光阶段的留存率
+}
+
+// FunnelReport 单个提示词模板或 A/B 变体的漏斗；各阶段独立统计筛选时间范围内的事件，
+// 跨越时间边界的用户可能使后一阶段大于前一阶段（此时流失率为负）
+type FunnelReport struct {
+	PromptTemplateID int64          `json:"prompt_template_id,omitempty"` // 提示词模板 ID（按模板分组时）
+	Variant          string         `json:"variant,omitempty"`            // A/B 变体（按变体分组时）
+	Unit             string         `json:"unit"`                         // 计数单位：user/call
+	Stages           []*FunnelStage `json:"stages"`
 }
@@ -0,0 +1,28 @@
+package entity
+
+import "time"
+
+// ModelPricing 价格表中的一条计费规则（单价为 USD / 1k tokens），自 EffectiveFrom 起生效；
+// 调价时新增一条生效时间更晚的记录，旧记录保留用于按调用时间核算历史成本。
+// 单次调用的输入 token 超过 LongContextThreshold 时，整次调用按长上下文单价计费
+type ModelPricing struct {
+	ID                          int64     `gorm:"primaryKey;autoIncrement"`                              // 主键 ID
+	Provider                    string    `gorm:"size:50;not null;index:idx_llm_model_pricing_provider"` // Provider 名称
+	ModelPattern                string    `gorm:"size:100;not null"`                                     // 模型名匹配模式，支持 * 通配，如 gpt-4o*；"*" 匹配该 provider 的全部模型
+	InputPer1k                  float64   `gorm:"type:decimal(12,6);not null;default:0"`                 // 输入单价
+	OutputPer1k                 float64   `gorm:"type:decimal(12,6);not null;default:0"`                 // 输出单价
+	CachedInputPer1k            float64   `gorm:"type:decimal(12,6);not null;default:0"`                 // 命中提示缓存的输入单价（0 表示按输入单价计）
+	LongContextThreshold        int       `gorm:"not null;default:0"`                                    // 长上下文分档的输入 token 阈值（0 表示不分档）
+	LongContextInputPer1k       float64   `gorm:"type:decimal(12,6);not null;default:0"`                 // 长上下文输入单价（0 表示按输入单价计）
+	LongContextOutputPer1k      float64   `gorm:"type:decimal(12,6);not null;default:0"`                 // 长上下文输出单价（0 表示按输出单价计）
+	LongContextCachedInputPer1k float64   `gorm:"type:decimal(12,6);not null;default:0"`                 // 长上下文缓存输入单价（0 表示按长上下文输入单价计）
+	PerRequestUSD               float64   `gorm:"type:decimal(12,6);not null;default:0"`                 // 每次调用的固定费用（USD）
+	EffectiveFrom               time.Time `gorm:"not null"`                                              // 生效时间
+	Note                        string    `gorm:"size:200"`                                              // 备注，如价格来源
+	CreatedAt                   time.Time `gorm:"autoCreateTime"`                                        // 创建时间
+	UpdatedAt                   time.Time `gorm:"autoUpdateTime"`                                        // 更新时间
+}
+
+func (ModelPricing) TableName() string {
+	return "llm_model_pricing"
+}
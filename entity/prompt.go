@@ -13,6 +13,25 @@ const (
 	PromptScopeUser    PromptScope = "user"
 )
 
+// promptScopeRanks 作用域层级，数值越小越具体：user → project → org → global
+var promptScopeRanks = map[PromptScope]int{
+	PromptScopeUser:    1,
+	PromptScopeProject: 2,
+	PromptScopeOrg:     3,
+	PromptScopeGlobal:  4,
+}
+
+// Rank 返回作用域层级，未知作用域返回 0
+func (s PromptScope) Rank() int {
+	return promptScopeRanks[s]
+}
+
+// PromptScopeRef 作用域引用（作用域类型 + 实体 ID），用于描述模板解析的回退链
+type PromptScopeRef struct {
+	Scope   PromptScope `json:"scope"`
+	ScopeID int64       `json:"scope_id"`
+}
+
 // PromptTemplate 提示词模板定义
 // 用于存储和管理 LLM 的 Prompt 模板，支持多级作用域（Scope）和版本控制。
 // 核心属性包括作用域（Scope/ScopeID）、内容（Content）和变量定义（VariablesJSON）。
@@ -21,7 +40,7 @@ type PromptTemplate struct {
 	ID int64 `gorm:"primaryKey;autoIncrement"`
 
 	// Name 模板名称
-	// 在同一作用域（Scope + ScopeID）下应唯一。
+	// 在同一作用域（Scope + ScopeID）与语言区域（Locale）下应唯一。
 	// 用于在代码中引用特定的 Prompt。
 	Name string `gorm:"size:200;not null;index:idx_llm_prompt_templates_name_scope,priority:1"`
 
@@ -34,6 +53,11 @@ type PromptTemplate struct {
 	// 根据 Scope 的不同，分别对应 0 (Global), OrgID, ProjectID, UserID。
 	ScopeID int64 `gorm:"not null;default:0;index:idx_llm_prompt_templates_name_scope,priority:3"`
 
+	// Locale 语言区域
+	// 同名模板的本地化变体，如 "zh-CN"、"en-US"；空字符串表示默认变体。
+	// 解析顺序：完整区域（zh-CN）→ 语言（zh）→ 默认。
+	Locale string `gorm:"size:20;not null;default:'';index:idx_llm_prompt_templates_name_scope,priority:4"`
+
 	// Category 分类
 	// 用于 UI 分组或业务逻辑分类（如 "chat", "summary", "extraction"）。
 	Category string `gorm:"size:50;not null"`
@@ -47,30 +71,41 @@ type PromptTemplate struct {
 	// 示例：[{"name": "input", "type": "string", "description": "用户输入"}]
 	VariablesJSON string `gorm:"type:text"`
 
-	// Version 当前版本号
-	// 每次更新 Content 或 VariablesJSON 时递增。
+	// Version 当前生效的版本号
+	// Content 与 VariablesJSON 为该版本的内容；已发布模板的修改保存为更高版本号的草稿版本（PromptVersion），
+	// 发布后才替换到模板上。
 	Version int `gorm:"not null;default:1"`
 
 	// ParentID 父模板 ID
 	// 用于实现模板继承或分叉（Fork）。
-	// 如果不为 nil，表示该模板是基于 ParentID 模板创建的。
+	// 如果不为 nil，渲染时以父模板为骨架，本模板中的 {{define "x"}} 覆盖父模板的 {{block "x" .}} 片段。
 	ParentID *int64
 
 	// Priority 优先级
-	// 数值越小优先级越高（或越低，需结合业务逻辑确认，通常用于同名模板在不同作用域的覆盖策略）。
-	// 默认 100。
+	// 同名模板先按作用域层级（user → project → org → global）决定，同一层级内数值越小优先级越高，
+	// 再按 ID 升序，保证解析结果确定。默认 100。
 	Priority int `gorm:"not null;default:100"`
 
 	// Enabled 是否启用
 	// false 表示逻辑删除或暂时禁用。
 	Enabled bool `gorm:"not null;default:true;index:idx_llm_prompt_templates_enabled"`
 
+	// Status 当前生效版本（Version）的发布状态
+	// 取值：draft (草稿), in_review (审核中), published (已发布), archived (已归档)
+	// 生产模式下仅 published 的模板可被 FindEffective 解析；历史数据默认为 published。
+	// 各版本的状态见 PromptVersion.Status，待审核的新版本不影响当前生效版本。
+	Status string `gorm:"size:20;not null;default:'published';index:idx_llm_prompt_templates_status"`
+
+	// ApprovedBy / ApprovedAt 最近一次审核通过（发布）的操作人与时间
+	ApprovedBy *int64
+	ApprovedAt *time.Time
+
 	// TagsJSON 标签集合
 	// 存储 JSON 字符串数组，用于灵活检索和分类。
 	TagsJSON string `gorm:"type:text"`
 
 	// MetadataJSON 扩展元数据
-	// 存储额外的配置信息，如推荐的模型参数（Temperature, MaxTokens 等）。
+	// 存储额外的配置信息，如推荐的模型参数（temperature、max_tokens，见 PromptModelParams）。
 	MetadataJSON string `gorm:"type:text"`
 
 	CreatedAt time.Time `gorm:"autoCreateTime"` // 创建时间
@@ -93,31 +128,139 @@ type PromptVersion struct {
 	ChangeLog     string    `gorm:"type:text"` // 版本变更说明
 	CreatedBy     int64     // 创建人用户 ID
 	CreatedAt     time.Time `gorm:"autoCreateTime"` // 创建时间
+
+	// Status 版本的发布状态，取值同 PromptTemplate.Status；历史数据默认为 published
+	Status string `gorm:"size:20;not null;default:'published'"`
+	// ApprovedBy / ApprovedAt 版本审核通过（发布）的操作人与时间
+	ApprovedBy *int64
+	ApprovedAt *time.Time
+
+	// SettingsJSON 随版本暂存的模板设置（PromptSettings）；修改已发布模板时新设置不直接写入模板，
+	// 发布该版本时才生效。为空表示沿用模板当前设置（历史数据）
+	SettingsJSON string `gorm:"type:text"`
+}
+
+// PromptSettings 模板除内容外的可编辑设置（存储在 PromptVersion.SettingsJSON 中）
+type PromptSettings struct {
+	Category     string `json:"category"`
+	ParentID     *int64 `json:"parent_id,omitempty"`
+	Priority     int    `json:"priority"`
+	Enabled      bool   `json:"enabled"`
+	TagsJSON     string `json:"tags_json,omitempty"`
+	MetadataJSON string `json:"metadata_json,omitempty"`
+}
+
+// Settings 提取模板的当前设置
+func (t *PromptTemplate) Settings() PromptSettings {
+	return PromptSettings{
+		Category:     t.Category,
+		ParentID:     t.ParentID,
+		Priority:     t.Priority,
+		Enabled:      t.Enabled,
+		TagsJSON:     t.TagsJSON,
+		MetadataJSON: t.MetadataJSON,
+	}
+}
+
+// ApplySettings 将设置写回模板
+func (t *PromptTemplate) ApplySettings(s PromptSettings) {
+	t.Category = s.Category
+	t.ParentID = s.ParentID
+	t.Priority = s.Priority
+	t.Enabled = s.Enabled
+	t.TagsJSON = s.TagsJSON
+	t.MetadataJSON = s.MetadataJSON
 }
 
 func (PromptVersion) TableName() string {
 	return "llm_prompt_versions"
 }
 
+// PromptStatus 提示词模板发布状态
+const (
+	PromptStatusDraft     = "draft"
+	PromptStatusInReview  = "in_review"
+	PromptStatusPublished = "published"
+	PromptStatusArchived  = "archived"
+)
+
+// PromptReview 提示词模板状态流转记录（提交审核、通过、驳回、归档等）
+type PromptReview struct {
+	ID         int64     `gorm:"primaryKey;autoIncrement"`                       // 记录主键 ID
+	TemplateID int64     `gorm:"not null;index:idx_llm_prompt_reviews_template"` // 关联的模板 ID
+	Version    int       `gorm:"not null"`                                       // 流转时的模板版本号
+	FromStatus string    `gorm:"size:20;not null"`                               // 流转前状态
+	ToStatus   string    `gorm:"size:20;not null"`                               // 流转后状态
+	ActorID    int64     `gorm:"not null"`                                       // 操作人用户 ID
+	Comment    string    `gorm:"type:text"`                                      // 审核意见
+	CreatedAt  time.Time `gorm:"autoCreateTime"`                                 // 创建时间
+}
+
+func (PromptReview) TableName() string {
+	return "llm_prompt_reviews"
+}
+
 // ABTest 提示词 A/B 测试配置
 type ABTest struct {
-	ID           int64     `gorm:"primaryKey;autoIncrement"`                                         // A/B 测试主键 ID
-	Name         string    `gorm:"size:200;not null"`                                                // 测试名称
-	TemplateAID  int64     `gorm:"not null"`                                                         // 变体 A 使用的模板 ID
-	TemplateBID  int64     `gorm:"not null"`                                                         // 变体 B 使用的模板 ID
-	TrafficSplit int       `gorm:"not null;default:50"`                                              // 流量分配比例（A 百分比）
-	Status       string    `gorm:"size:20;not null;default:'running';index:idx_llm_ab_tests_status"` // 状态：running/stopped 等
-	StartAt      time.Time `gorm:""`                                                                 // 开始时间
-	EndAt        time.Time `gorm:""`                                                                 // 结束时间
-	ResultJSON   string    `gorm:"type:text"`                                                        // 统计与分析结果 JSON
-	CreatedAt    time.Time `gorm:"autoCreateTime"`                                                   // 创建时间
-	UpdatedAt    time.Time `gorm:"autoUpdateTime"`                                                   // 更新时间
+	ID                 int64      `gorm:"primaryKey;autoIncrement"`         // A/B 测试主键 ID
+	Name               string     `gorm:"size:200;not null"`                // 测试名称
+	TemplateAID        int64      `gorm:"not null"`                         // 变体 A 使用的模板 ID
+	TemplateBID        int64      `gorm:"not null"`                         // 变体 B 使用的模板 ID
+	TrafficSplit       int        `gorm:"not null;default:50"`              // 流量分配比例（A 百分比），仅在未配置 VariantsJSON 时生效
+	VariantsJSON       string     `gorm:"type:text"`                        // 多变体配置 JSON（[]ABTestVariant），为空时由 A/B 字段推导
+	Holdout            int        `gorm:"not null;default:0"`               // 对照留出组百分比（0-50），留出用户使用首个变体模板并标记为 holdout
+	Mode               string     `gorm:"size:20;not null;default:'fixed'"` // 分配模式：fixed（固定权重）/ thompson / epsilon_greedy
+	Epsilon            float64    `gorm:"not null;default:0"`               // epsilon_greedy 的探索比例，默认 0.1
+	FreezeConfidence   float64    `gorm:"not null;default:0"`               // 老虎机模式下某变体为最优的后验概率达到该阈值时冻结分配（0 不自动冻结）
+	FrozenVariant      string     `gorm:"size:20"`                          // 已冻结的变体，非空时全部流量（留出组除外）分配给该变体
+	FrozenAt           *time.Time // 冻结时间
+	AutoStopConfidence float64    `gorm:"not null;default:0"`                                               // 显著性置信度达到该阈值时自动停止（0 表示仅在 EndAt 到期时停止）
+	PromoteWinner      bool       `gorm:"not null;default:false"`                                           // 自动停止后是否将胜出变体的内容发布到对照组（首个变体）模板名下
+	Status             string     `gorm:"size:20;not null;default:'running';index:idx_llm_ab_tests_status"` // 状态：running/stopped 等
+	StartAt            time.Time  `gorm:""`                                                                 // 开始时间
+	EndAt              time.Time  `gorm:""`                                                                 // 结束时间
+	ResultJSON         string     `gorm:"type:text"`                                                        // 统计与分析结果 JSON
+	CreatedAt          time.Time  `gorm:"autoCreateTime"`                                                   // 创建时间
+	UpdatedAt          time.Time  `gorm:"autoUpdateTime"`                                                   // 更新时间
+
+	Exposures map[string]int64 `gorm:"-"` // 各变体曝光数（来自 llm_ab_exposures，仅查询结果时填充）
 }
 
 func (ABTest) TableName() string {
 	return "llm_ab_tests"
 }
 
+// ABExposure A/B 测试变体曝光计数（每个测试 × 变体一行，行锁内自增）
+type ABExposure struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement"`                                                 // 主键 ID
+	ABTestID  int64     `gorm:"not null;uniqueIndex:uk_llm_ab_exposures_test_variant,priority:1"`         // A/B 测试 ID
+	Variant   string    `gorm:"size:20;not null;uniqueIndex:uk_llm_ab_exposures_test_variant,priority:2"` // 变体标识（含 holdout）
+	Count     int64     `gorm:"not null;default:0"`                                                       // 曝光次数
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`                                                           // 更新时间
+}
+
+func (ABExposure) TableName() string {
+	return "llm_ab_exposures"
+}
+
+// ABVariantHoldout 留出组的变体标识
+const ABVariantHoldout = "holdout"
+
+// ABTestMode A/B 测试的流量分配模式
+const (
+	ABTestModeFixed         = "fixed"
+	ABTestModeThompson      = "thompson"
+	ABTestModeEpsilonGreedy = "epsilon_greedy"
+)
+
+// ABTestVariant A/B/n 测试中的单个变体（存储在 ABTest.VariantsJSON 中）
+type ABTestVariant struct {
+	Key        string `json:"key"`               // 变体标识，如 "A"/"B"/"C"
+	TemplateID int64  `json:"template_id"`       // 使用的模板 ID
+	Version    int    `json:"version,omitempty"` // 固定的模板版本；为 0 时在启动测试时固定为当前版本
+	Weight     int    `json:"weight"`            // 流量权重（相对值）
+}
+
 // PromptCategory 预定义的提示词分类常量
 const (
 	// PromptCategoryStoryWorld 故事世界提示词（原 StoryWorld）
@@ -130,6 +273,10 @@ const (
 	PromptCategoryChat = "chat"
 	// PromptCategorySummary 摘要生成
 	PromptCategorySummary = "summary"
+	// PromptCategoryEval 评估（LLM-as-judge）提示词
+	PromptCategoryEval = "eval"
+	// PromptCategoryFallback 全部端点失败时的兜底回复
+	PromptCategoryFallback = "fallback"
 )
 
 // StoryWorldMetadata 故事世界的元数据结构（存储在 MetadataJSON 中）
@@ -143,6 +290,19 @@ type StoryWorldMetadata struct {
 	SortOrder   int    `json:"sort_order"`   // 排序权重
 }
 
+// EvalJudgeMetadata 裁判提示词的元数据结构（存储在 MetadataJSON 中）
+type EvalJudgeMetadata struct {
+	Endpoint   string   `json:"endpoint"`    // 裁判模型使用的端点名称（为空则按常规路由）
+	SampleRate float64  `json:"sample_rate"` // 在线抽样比例（0-1）
+	Criteria   []string `json:"criteria"`    // 评估维度，如 helpfulness/safety/format
+}
+
+// PromptModelParams 模板推荐的模型参数（MetadataJSON 顶层字段），调用方未指定时由 ChatWithPrompt 采用
+type PromptModelParams struct {
+	Temperature *float32 `json:"temperature,omitempty"` // 推荐温度
+	MaxTokens   int      `json:"max_tokens,omitempty"`  // 推荐最大输出 token 数
+}
+
 // UserPreferencesMetadata 用户偏好的元数据结构（原 GrowthProfile，存储在 MetadataJSON 中）
 type UserPreferencesMetadata struct {
 	Age         int      `json:"age"`          // 年龄
@@ -0,0 +1,36 @@
+package entity
+
+import "time"
+
+// PromptGitSource 状态常量
+const (
+	PromptGitSyncOK     = "ok"
+	PromptGitSyncFailed = "failed"
+)
+
+// PromptGitSource 提示词模板的 Git 同步源
+// 从指定仓库/分支/目录拉取 YAML 模板文件（布局同 YAML 导出），按定时或 Webhook 触发导入为新版本。
+type PromptGitSource struct {
+	ID              int64      `gorm:"primaryKey;autoIncrement"`         // 同步源主键 ID
+	Name            string     `gorm:"size:100;not null;uniqueIndex"`    // 同步源名称
+	RepoURL         string     `gorm:"size:500;not null"`                // 仓库地址（https）
+	Branch          string     `gorm:"size:200;not null;default:'main'"` // 分支
+	Path            string     `gorm:"size:500"`                         // 仓库内模板目录，为空表示根目录
+	Username        string     `gorm:"size:200"`                         // 认证用户名（token 认证时可为空）
+	Token           string     `gorm:"size:500"`                         // 访问令牌/密码，对外展示时需脱敏
+	WebhookSecret   string     `gorm:"size:200"`                         // Webhook HMAC-SHA256 签名密钥
+	IntervalSeconds int        `gorm:"not null;default:0"`               // 定时同步间隔（秒），0 表示仅手动/Webhook 触发
+	Overwrite       bool       `gorm:"not null;default:false"`           // 数据库版本比 Git 更新（库内直接修改）时是否仍以 Git 为准覆盖
+	Enabled         bool       `gorm:"not null;default:true"`            // 是否启用
+	LastCommit      string     `gorm:"size:64"`                          // 最近一次成功同步的提交
+	LastSyncAt      *time.Time `gorm:""`                                 // 最近一次同步时间
+	LastStatus      string     `gorm:"size:20"`                          // 最近一次同步状态：ok/failed
+	LastError       string     `gorm:"type:text"`                        // 最近一次同步错误
+	LastResultJSON  string     `gorm:"type:text"`                        // 最近一次同步的导入结果 JSON
+	CreatedAt       time.Time  `gorm:"autoCreateTime"`                   // 创建时间
+	UpdatedAt       time.Time  `gorm:"autoUpdateTime"`                   // 更新时间
+}
+
+func (PromptGitSource) TableName() string {
+	return "llm_prompt_git_sources"
+}
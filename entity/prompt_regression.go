@@ -0,0 +1,69 @@
+package entity
+
+import "time"
+
+// PromptTestAssertion 断言类型
+const (
+	PromptAssertContains    = "contains"     // 输出包含 Value
+	PromptAssertNotContains = "not_contains" // 输出不包含 Value
+	PromptAssertRegex       = "regex"        // 输出匹配正则 Value
+	PromptAssertJSONField   = "json_field"   // 输出为 JSON 且包含字段 Field（点号路径），Value 非空时需相等
+	PromptAssertMaxLength   = "max_length"   // 输出字符数不超过 Value
+)
+
+// PromptTestRun 触发方式
+const (
+	PromptTestTriggerManual        = "manual"
+	PromptTestTriggerVersionChange = "version_change"
+)
+
+// PromptTestAssertion 单条断言（存储在 PromptTestCase.AssertionsJSON 中）
+type PromptTestAssertion struct {
+	Type  string `json:"type"`
+	Field string `json:"field,omitempty"`
+	Value string `json:"value,omitempty"`
+}
+
+// PromptTestCase 提示词回归测试用例
+// 以固定变量与输入渲染并执行指定模板，按断言与裁判评分标准判定通过与否。
+type PromptTestCase struct {
+	ID             int64     `gorm:"primaryKey;autoIncrement"` // 用例主键 ID
+	TemplateID     int64     `gorm:"not null;index"`           // 被测模板 ID
+	Name           string    `gorm:"size:200;not null"`        // 用例名称
+	VariablesJSON  string    `gorm:"type:text"`                // 渲染变量 JSON 对象
+	MessagesJSON   string    `gorm:"type:text"`                // 输入消息 JSON 数组 [{"role":"user","content":"..."}]
+	AssertionsJSON string    `gorm:"type:text"`                // 断言 JSON 数组，见 PromptTestAssertion
+	JudgeRubric    string    `gorm:"type:text"`                // 裁判评分标准，为空不做裁判评分
+	JudgeMinScore  float64   `gorm:"not null;default:7"`       // 裁判分数（0-10）通过阈值
+	Endpoint       string    `gorm:"size:100"`                 // 默认执行端点，为空按常规路由
+	RunOnChange    bool      `gorm:"not null;default:true"`    // 模板版本变化时自动执行
+	Enabled        bool      `gorm:"not null;default:true"`    // 是否启用
+	CreatedBy      int64     `gorm:"not null;default:0"`       // 创建人
+	CreatedAt      time.Time `gorm:"autoCreateTime"`           // 创建时间
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`           // 更新时间
+}
+
+func (PromptTestCase) TableName() string {
+	return "llm_prompt_test_cases"
+}
+
+// PromptTestRun 回归测试用例的单次执行记录（通过/失败历史）
+type PromptTestRun struct {
+	ID              int64     `gorm:"primaryKey;autoIncrement"`                                      // 执行记录主键 ID
+	CaseID          int64     `gorm:"not null;index:idx_llm_prompt_test_runs_case,priority:1"`       // 用例 ID
+	TemplateID      int64     `gorm:"not null;index"`                                                // 模板 ID
+	TemplateVersion int       `gorm:"not null"`                                                      // 执行时的模板版本
+	Endpoint        string    `gorm:"size:100"`                                                      // 执行端点
+	Trigger         string    `gorm:"size:20;not null"`                                              // 触发方式：manual/version_change
+	Passed          bool      `gorm:"not null;default:false"`                                        // 是否通过
+	Output          string    `gorm:"type:text"`                                                     // 模型输出
+	JudgeScore      *float64  `gorm:""`                                                              // 裁判分数
+	ResultJSON      string    `gorm:"type:text"`                                                     // 各断言结果 JSON
+	Error           string    `gorm:"type:text"`                                                     // 执行错误
+	LatencyMs       int64     `gorm:"not null;default:0"`                                            // 执行耗时
+	CreatedAt       time.Time `gorm:"autoCreateTime;index:idx_llm_prompt_test_runs_case,priority:2"` // 执行时间
+}
+
+func (PromptTestRun) TableName() string {
+	return "llm_prompt_test_runs"
+}
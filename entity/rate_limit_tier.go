@@ -0,0 +1,40 @@
+package entity
+
+import "time"
+
+// 内置限流等级
+const (
+	RateLimitTierFree  = "free"
+	RateLimitTierPro   = "pro"
+	RateLimitTierAdmin = "admin"
+)
+
+// RateLimitTier 限流等级：同一等级的用户共享每分钟请求数、突发额度与 token 上限
+type RateLimitTier struct {
+	ID              int64     `gorm:"primaryKey;autoIncrement"`                             // 主键 ID
+	Name            string    `gorm:"size:50;not null;uniqueIndex:uk_llm_rate_limit_tiers"` // 等级名称，如 free/pro/admin
+	Description     string    `gorm:"size:200"`                                             // 描述
+	PerMinute       int       `gorm:"not null;default:0"`                                   // 每分钟请求数（0 表示不限制）
+	Burst           int       `gorm:"not null;default:0"`                                   // 突发额度
+	TokensPerMinute int       `gorm:"not null;default:0"`                                   // 每分钟 token 上限（0 表示沿用安全策略）
+	CreatedAt       time.Time `gorm:"autoCreateTime"`                                       // 创建时间
+	UpdatedAt       time.Time `gorm:"autoUpdateTime"`                                       // 更新时间
+}
+
+func (RateLimitTier) TableName() string {
+	return "llm_rate_limit_tiers"
+}
+
+// UserRateLimitTier 用户所属的限流等级，未分配的用户使用默认等级
+type UserRateLimitTier struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement"`                               // 主键 ID
+	UserID    int64     `gorm:"not null;uniqueIndex:uk_llm_user_rate_limit_tiers_user"` // 用户 ID
+	Tier      string    `gorm:"size:50;not null"`                                       // 等级名称
+	UpdatedBy int64     `gorm:"not null;default:0"`                                     // 最近修改人用户 ID
+	CreatedAt time.Time `gorm:"autoCreateTime"`                                         // 创建时间
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`                                         // 更新时间
+}
+
+func (UserRateLimitTier) TableName() string {
+	return "llm_user_rate_limit_tiers"
+}
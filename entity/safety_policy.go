@@ -1,29 +1,209 @@
 package entity
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
-// SafetyPolicy 表示系统级的大模型安全策略配置
+// SystemPromptMode 取值
+const (
+	SystemPromptModePrepend  = "prepend"
+	SystemPromptModeAppend   = "append"
+	SystemPromptModeTemplate = "template"
+)
+
+// 安全策略作用域，解析顺序：conversation_type → project → org → global
+const (
+	SafetyScopeGlobal           = "global"
+	SafetyScopeOrg              = "org"
+	SafetyScopeProject          = "project"
+	SafetyScopeConversationType = "conversation_type"
+)
+
+// SafetyScopeRef 安全策略作用域引用；Key 为组织/项目 ID 或会话类型（如 story）
+type SafetyScopeRef struct {
+	Scope string `json:"scope"`
+	Key   string `json:"key"`
+}
+
+// 安全检查结果的处理动作
+const (
+	SafetyActionBlock = "block" // 拒绝
+	SafetyActionMask  = "mask"  // 替换命中内容后放行
+	SafetyActionLog   = "log"   // 仅记录
+	// SafetyActionBlockBan 拒绝并对用户施加冷却期，冷却期内的请求直接被拒绝
+	SafetyActionBlockBan = "block_ban"
+)
+
+// 安全检查结果的严重程度
+const (
+	SafetySeverityLow      = "low"
+	SafetySeverityMedium   = "medium"
+	SafetySeverityHigh     = "high"
+	SafetySeverityCritical = "critical"
+)
+
+// 安全检查方向
+const (
+	SafetyDirectionInput  = "input"
+	SafetyDirectionOutput = "output"
+)
+
+// 审计日志正文（RequestJSON/ResponseJSON）的记录级别，对应 SafetyPolicy.LogLevel
+const (
+	AuditLogLevelNone     = "none"     // 不做处理，完整记录（默认）
+	AuditLogLevelRedacted = "redacted" // 掩码 PII 与凭据，并截断过长字段
+	AuditLogLevelHash     = "hash"     // 仅记录正文的 SHA-256 摘要与长度
+	AuditLogLevelMetadata = "metadata" // 不记录正文，仅保留元数据
+)
+
+// SafetyCheckerConfig 检查链中的单个检查器配置（存储在 SafetyPolicy.CheckersJSON 中，按数组顺序执行）
+type SafetyCheckerConfig struct {
+	Name       string          `json:"name"`                 // 检查器名称：keyword/regex/pii/length/secret/moderation_api/llm_moderation/age_rating 或自定义注册的名称
+	Disabled   bool            `json:"disabled,omitempty"`   // 停用
+	Directions []string        `json:"directions,omitempty"` // 作用方向 input/output，为空使用检查器默认方向
+	Action     string          `json:"action,omitempty"`     // 覆盖检查器给出的动作
+	Config     json.RawMessage `json:"config,omitempty"`     // 检查器自身配置
+}
+
+// SafetyExemption 豁免规则（存储在 SafetyPolicy.ExemptionsJSON 中）：匹配的用户或角色跳过指定检查器，
+// 用于内部红队账号等场景；Checkers 为空表示跳过全部检查器
+type SafetyExemption struct {
+	UserIDs  []int64  `json:"user_ids,omitempty"` // 豁免的用户 ID
+	Roles    []string `json:"roles,omitempty"`    // 豁免的角色，由上层通过 WithSafetyRoles 声明
+	Checkers []string `json:"checkers,omitempty"` // 跳过的检查器名称
+	Note     string   `json:"note,omitempty"`     // 备注，如豁免原因与负责人
+}
+
+// PII 检测命中后的处理方式
+const (
+	PIIActionBlock = SafetyActionBlock // 拒绝请求
+	PIIActionMask  = SafetyActionMask  // 替换为掩码后继续
+	PIIActionLog   = SafetyActionLog   // 仅记录审计日志
+)
+
+// PIIDetector 单个 PII 检测器：Name 为内置检测器名称时可省略 Pattern，否则需提供自定义正则
+type PIIDetector struct {
+	Name     string   `json:"name"`
+	Pattern  string   `json:"pattern,omitempty"`   // 自定义正则（RE2 语法），非空时覆盖同名内置检测器
+	Locales  []string `json:"locales,omitempty"`   // 适用的语言区域，为空表示全部
+	Action   string   `json:"action,omitempty"`    // block/mask/log，默认 mask
+	Mask     string   `json:"mask,omitempty"`      // 掩码文本，默认 [PII:<name>]，仅 replace 策略使用
+	Disabled bool     `json:"disabled,omitempty"`  // 停用（可用于关闭内置检测器）
+	Strategy string   `json:"strategy,omitempty"`  // 掩码策略，见 PIIMask*，默认 replace
+	KeepLast int      `json:"keep_last,omitempty"` // partial 策略保留的末尾字符数（仅计字母数字），默认 4
+}
+
+// PII 掩码策略
+const (
+	PIIMaskReplace          = "replace"           // 整体替换为 Mask
+	PIIMaskPartial          = "partial"           // 保留末尾 KeepLast 个字母数字，其余替换为 *，分隔符保留
+	PIIMaskFormatPreserving = "format_preserving" // 随机替换字母数字，保留长度、大小写与分隔符
+	PIIMaskTokenize         = "tokenize"          // 替换为 [PII:<name>:<token>]，原文存入令牌库，可通过 DetokenizePII 还原
+)
+
+// PIIVaultEntry 可逆令牌化的令牌库记录，原文可经字段加密后存储
+type PIIVaultEntry struct {
+	ID        int64     `gorm:"primaryKey;autoIncrement"`                      // 主键 ID
+	Token     string    `gorm:"size:40;not null;uniqueIndex:uk_llm_pii_vault"` // 令牌
+	UserID    int64     `gorm:"index:idx_llm_pii_vault_user"`                  // 原文所属用户，未知时为 0
+	Detector  string    `gorm:"size:50"`                                       // 检测器名称
+	Value     string    `gorm:"type:text;not null"`                            // 原文（启用字段加密时为密文）
+	CreatedAt time.Time `gorm:"autoCreateTime"`                                // 创建时间
+}
+
+func (PIIVaultEntry) TableName() string {
+	return "llm_pii_vault"
+}
+
+// PIIConfig PII 检测配置（存储在 SafetyPolicy.PIIConfigJSON 中）
+// Locales 为启用的语言区域集合，检测器的 Locales 与之有交集时生效；为空表示全部启用。
+// 未在 Detectors 中出现的内置检测器按默认动作启用，除非 BuiltinsDisabled。
+type PIIConfig struct {
+	Locales          []string      `json:"locales,omitempty"`
+	Detectors        []PIIDetector `json:"detectors,omitempty"`
+	BuiltinsDisabled bool          `json:"builtins_disabled,omitempty"`
+}
+
+// SafetyPolicy 表示大模型安全策略配置
+// 全局策略（scope=global）之外，可按组织、项目或会话类型配置独立策略，解析时取最具体的一条。
 type SafetyPolicy struct {
 	ID int64 `gorm:"primaryKey;autoIncrement"` // 主键 ID
 
+	// 作用域：global / org / project / conversation_type
+	Scope string `gorm:"size:30;not null;default:'global';uniqueIndex:idx_llm_safety_policies_scope,priority:1"` // 作用域类型
+
+	// 作用域键：组织/项目 ID 或会话类型名称，全局策略为空
+	ScopeKey string `gorm:"size:100;not null;default:'';uniqueIndex:idx_llm_safety_policies_scope,priority:2"` // 作用域键
+
+	// 策略名称，便于管理端识别
+	Name string `gorm:"size:100"` // 策略名称
+
+	// 版本号，每次保存递增，历史见 SafetyPolicyVersion
+	Version int `gorm:"not null;default:1"` // 当前版本号
+
+	// 最近一次修改人
+	UpdatedBy int64 `gorm:"not null;default:0"` // 最近修改人用户 ID
+
 	// 是否启用安全策略
 	Enabled bool `gorm:"not null;default:true"` // 是否启用安全策略
 
 	// 全局 System Prompt，优先级高于业务提示词
 	GlobalSystemPrompt string `gorm:"type:text"` // 全局 System Prompt
 
-	// 屏蔽类别（JSON 数组），预留给不同 Provider 的安全设置适配
+	// System Prompt 组合方式：prepend（默认，安全提示在前）/ append（在后）/ template（按模板槽位）
+	SystemPromptMode string `gorm:"size:20;not null;default:'prepend'"` // System Prompt 组合方式
+
+	// 组合模板（Go Template），可用槽位 {{.Safety}} / {{.Business}}，仅 mode=template 时生效
+	SystemPromptTemplate string `gorm:"type:text"` // System Prompt 组合模板
+
+	// 屏蔽类别，供 llm_moderation 检查器按类别阈值判定：
+	// ["hate","violence"]（默认阈值 0.5）或 {"hate":{"threshold":0.4,"action":"block"},"sexual":{"threshold":0.7,"action":"log"}}
 	BlockedCategoriesJSON string `gorm:"type:text"` // 屏蔽类别配置 JSON
 
 	// 屏蔽关键词（JSON 数组），用于输入/输出的简单文本过滤
 	BlockedKeywordsJSON string `gorm:"type:text"` // 屏蔽关键词配置 JSON
 
+	// 安全检查链（JSON 数组，见 SafetyCheckerConfig），为空时执行关键词检查与输出凭据泄露检查
+	CheckersJSON string `gorm:"type:text"` // 安全检查链配置 JSON
+
+	// 白名单短语（JSON 数组），关键词命中完全落在白名单短语内时不视为命中，如屏蔽 "kill" 时放行 "kill process"
+	AllowedPhrasesJSON string `gorm:"type:text"` // 白名单短语 JSON
+
+	// 用户/角色豁免规则（JSON 数组，见 SafetyExemption）
+	ExemptionsJSON string `gorm:"type:text"` // 豁免规则 JSON
+
+	// 按严重程度映射处理动作（JSON 对象），如 {"low":"log","medium":"mask","high":"block","critical":"block_ban"}；
+	// 未配置的严重程度沿用检查器给出的动作，检查链中显式配置的 action 优先
+	SeverityActionsJSON string `gorm:"type:text"` // 严重程度动作映射 JSON
+
+	// block_ban 动作触发的冷却时长（秒，0 使用默认 10 分钟）
+	BanCooldownSeconds int `gorm:"not null;default:0"` // 违规冷却时长
+
+	// 违规升级规则（JSON 数组，见 BanEscalationRule），如 [{"violations":3,"window_seconds":3600,"ban_seconds":900}]
+	BanEscalationJSON string `gorm:"type:text"` // 违规升级规则 JSON
+
+	// PII 检测配置（JSON，见 PIIConfig），为空时聊天请求不做 PII 处理
+	PIIConfigJSON string `gorm:"type:text"` // PII 检测配置 JSON
+
 	// 生成内容的最大长度（字符数，0 表示不限制）
 	MaxContentLength int `gorm:"not null;default:0"` // 最大内容长度限制
 
-	// 日志级别：none / summary / full_violation 等（首版仅记录占位）
+	// 输出后处理器（JSON 数组，按顺序执行），如 ["trim_code_fence","normalize_whitespace"]
+	PostProcessorsJSON string `gorm:"type:text"` // 输出后处理器配置 JSON
+
+	// 每用户每分钟 token 上限（0 表示不限制），基于限流窗口内累计的实际 token 用量
+	TokenLimitPerMinute int `gorm:"not null;default:0"` // 每分钟 token 上限
+
+	// 是否检测用户语言并约束输出语言（不一致时重试一次）
+	EnforceOutputLanguage bool `gorm:"not null;default:false"` // 输出语言约束开关
+
+	// 审计日志正文记录级别：none（完整记录）/ redacted / hash / metadata，见 AuditLogLevel*
 	LogLevel string `gorm:"size:20;not null;default:'none'"` // 日志级别
 
+	// redacted 级别下单个字段保留的最大字符数（0 使用默认 2000）
+	AuditMaxFieldChars int `gorm:"not null;default:0"` // 审计字段截断长度
+
 	CreatedAt time.Time `gorm:"autoCreateTime"` // 创建时间
 	UpdatedAt time.Time `gorm:"autoUpdateTime"` // 更新时间
 }
@@ -31,3 +211,19 @@ type SafetyPolicy struct {
 func (SafetyPolicy) TableName() string {
 	return "llm_safety_policies"
 }
+
+// SafetyPolicyVersion 安全策略的历史版本快照，用于追溯与回滚
+type SafetyPolicyVersion struct {
+	ID            int64     `gorm:"primaryKey;autoIncrement"`                                        // 主键 ID
+	PolicyID      int64     `gorm:"not null;index:idx_llm_safety_policy_versions_policy,priority:1"` // 策略 ID
+	Version       int       `gorm:"not null;index:idx_llm_safety_policy_versions_policy,priority:2"` // 版本号
+	SnapshotJSON  string    `gorm:"type:text;not null"`                                              // 该版本的完整策略 JSON
+	ChangeLog     string    `gorm:"type:text"`                                                       // 变更说明
+	CreatedBy     int64     `gorm:"not null;default:0"`                                              // 修改人用户 ID
+	EffectiveFrom time.Time `gorm:"not null"`                                                        // 生效时间
+	CreatedAt     time.Time `gorm:"autoCreateTime"`                                                  // 创建时间
+}
+
+func (SafetyPolicyVersion) TableName() string {
+	return "llm_safety_policy_versions"
+}
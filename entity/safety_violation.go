@@ -0,0 +1,54 @@
+package entity
+
+import "time"
+
+// SafetyViolation 被安全检查拒绝的一次请求，只记录判定元数据（不含内容），不受审计日志脱敏级别影响
+type SafetyViolation struct {
+	ID               int64     `gorm:"primaryKey;autoIncrement"`                                   // 主键 ID
+	UserID           int64     `gorm:"not null;default:0;index:idx_llm_safety_violations_user_id"` // 用户 ID
+	Direction        string    `gorm:"size:20"`                                                    // 检查方向：input/output
+	Action           string    `gorm:"size:20"`                                                    // 最终动作，如 block/block_ban
+	Reason           string    `gorm:"size:200"`                                                   // 拒绝原因，如 cooldown 或命中检查器给出的说明
+	Checker          string    `gorm:"size:50"`                                                    // 触发拒绝的检查器名称
+	Category         string    `gorm:"size:50;index:idx_llm_safety_violations_category"`           // 判定类别
+	Severity         string    `gorm:"size:20"`                                                    // 严重程度
+	MatchedTermsJSON string    `gorm:"type:text"`                                                  // 命中的关键词/规则（JSON 数组）
+	PolicyID         int64     `gorm:"not null;default:0"`                                         // 生效的安全策略 ID
+	CreatedAt        time.Time `gorm:"autoCreateTime;index:idx_llm_safety_violations_created_at"`  // 创建时间
+}
+
+func (SafetyViolation) TableName() string {
+	return "llm_safety_violations"
+}
+
+// SafetyViolationFilter 违规统计的筛选条件
+type SafetyViolationFilter struct {
+	UserID    *int64     // 用户 ID（可选）
+	Direction string     // 检查方向
+	Category  string     // 判定类别
+	StartAt   *time.Time // 起始时间（可选）
+	EndAt     *time.Time // 结束时间（可选）
+}
+
+// SafetyViolationBucket 单个维度取值的违规次数
+type SafetyViolationBucket struct {
+	Key   string `json:"key" gorm:"column:bucket_key"` // 维度取值（原因/类别/日期等）
+	Count int64  `json:"count"`                        // 违规次数
+}
+
+// SafetyViolationUser 违规次数靠前的用户
+type SafetyViolationUser struct {
+	UserID int64     `json:"user_id"` // 用户 ID
+	Count  int64     `json:"count"`   // 违规次数
+	LastAt time.Time `json:"last_at"` // 最近一次违规时间
+}
+
+// SafetyViolationReport 违规聚合报告，用于识别滥用用户与调整拦截词表
+type SafetyViolationReport struct {
+	Total      int64                    `json:"total"`       // 违规总数
+	ByReason   []*SafetyViolationBucket `json:"by_reason"`   // 按拒绝原因
+	ByCategory []*SafetyViolationBucket `json:"by_category"` // 按判定类别
+	ByTerm     []*SafetyViolationBucket `json:"by_term"`     // 按命中词（基于最近的违规记录抽样统计）
+	ByDay      []*SafetyViolationBucket `json:"by_day"`      // 按日期（YYYY-MM-DD）
+	TopUsers   []*SafetyViolationUser   `json:"top_users"`   // 违规次数最多的用户
+}
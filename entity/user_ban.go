@@ -0,0 +1,36 @@
+package entity
+
+import "time"
+
+// 封禁来源
+const (
+	UserBanSourceBlockBan   = "block_ban"  // 单次判定动作为 block_ban
+	UserBanSourceEscalation = "escalation" // 窗口内违规次数达到升级阈值
+	UserBanSourceManual     = "manual"     // 管理员手动封禁
+)
+
+// UserBan 用户的临时聊天封禁；Until 之前的请求在限流检查中直接拒绝，LiftedAt 非空表示已被提前解除
+type UserBan struct {
+	ID             int64      `gorm:"primaryKey;autoIncrement"`                 // 主键 ID
+	UserID         int64      `gorm:"not null;index:idx_llm_user_bans_user_id"` // 用户 ID
+	Source         string     `gorm:"size:20;not null"`                         // 来源，见 UserBanSource*
+	Reason         string     `gorm:"size:200"`                                 // 封禁原因
+	ViolationCount int        `gorm:"not null;default:0"`                       // 触发升级时窗口内的违规次数
+	Until          time.Time  `gorm:"not null;index:idx_llm_user_bans_until"`   // 封禁截止时间
+	CreatedBy      int64      `gorm:"not null;default:0"`                       // 操作人（自动封禁为 0）
+	LiftedAt       *time.Time `gorm:""`                                         // 提前解除时间
+	LiftedBy       int64      `gorm:"not null;default:0"`                       // 解除人
+	CreatedAt      time.Time  `gorm:"autoCreateTime"`                           // 创建时间
+}
+
+func (UserBan) TableName() string {
+	return "llm_user_bans"
+}
+
+// BanEscalationRule 违规升级规则（存储在 SafetyPolicy.BanEscalationJSON 中）：
+// WindowSeconds 内违规达到 Violations 次时封禁 BanSeconds 秒；多条命中时取封禁时长最长的一条
+type BanEscalationRule struct {
+	Violations    int `json:"violations"`
+	WindowSeconds int `json:"window_seconds"`
+	BanSeconds    int `json:"ban_seconds"`
+}
@@ -0,0 +1,24 @@
+package entity
+
+import "time"
+
+// ErasedMessageContent 用户数据删除后，其在他人会话中发送的消息正文替换为该占位文本
+const ErasedMessageContent = "[该消息已应用户要求删除]"
+
+// UserErasureReport 用户数据删除（ForgetUser）的完成报告；各计数为本次实际删除或匿名化的行数
+type UserErasureReport struct {
+	UserID               int64     `json:"user_id"`
+	ConversationsDeleted int64     `json:"conversations_deleted"` // 用户拥有的会话（连同消息、附件、分享、向量等）
+	MessagesAnonymized   int64     `json:"messages_anonymized"`   // 用户在他人会话中发送的消息（正文与元数据清除）
+	AuditLogsAnonymized  int64     `json:"audit_logs_anonymized"` // 审计日志（用户 ID、请求/响应正文与客户端信息清除）
+	MetricsAnonymized    int64     `json:"metrics_anonymized"`    // 调用指标（用户 ID 与会话 ID 清零，保留聚合统计）
+	ViolationsAnonymized int64     `json:"violations_anonymized"` // 安全违规记录（用户 ID 清零）
+	MemoriesDeleted      int64     `json:"memories_deleted"`      // 长期记忆
+	ChatJobsDeleted      int64     `json:"chat_jobs_deleted"`     // 异步聊天任务
+	RateLimitsDeleted    int64     `json:"rate_limits_deleted"`   // 限流窗口
+	PIITokensDeleted     int64     `json:"pii_tokens_deleted"`    // PII 令牌库中的原文（对应占位符不再可还原）
+	Retained             []string  `json:"retained,omitempty"`    // 按设计保留或未覆盖的数据说明
+	Completed            bool      `json:"completed"`             // 全部步骤成功；失败时可重复执行
+	StartedAt            time.Time `json:"started_at"`
+	FinishedAt           time.Time `json:"finished_at"`
+}
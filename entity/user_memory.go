@@ -0,0 +1,24 @@
+package entity
+
+import "time"
+
+// 长期记忆类别
+const (
+	UserMemoryCategoryFact       = "fact"       // 稳定的个人事实，如职业、所在城市
+	UserMemoryCategoryPreference = "preference" // 偏好，如回答风格、语言
+)
+
+// UserMemory 从会话中提取的用户长期记忆，在后续对话中注入 System Prompt
+type UserMemory struct {
+	ID                   int64     `gorm:"primaryKey;autoIncrement"`                     // 主键 ID
+	UserID               int64     `gorm:"not null;index:idx_llm_user_memories_user_id"` // 用户 ID
+	Category             string    `gorm:"size:20;not null"`                             // 类别，见 UserMemoryCategory*
+	Content              string    `gorm:"size:500;not null"`                            // 记忆内容
+	SourceConversationID int64     `gorm:"not null;default:0"`                           // 提取来源会话
+	CreatedAt            time.Time `gorm:"autoCreateTime"`                               // 创建时间
+	UpdatedAt            time.Time `gorm:"autoUpdateTime"`                               // 更新时间
+}
+
+func (UserMemory) TableName() string {
+	return "llm_user_memories"
+}
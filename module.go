@@ -21,21 +21,59 @@ func NewModule() (server.IModule, error) {
 			repo.NewProviderConfigRepo,
 			repo.NewSafetyPolicyRepo,
 			repo.NewPromptTemplateRepo,
+			repo.NewPromptGitSourceRepo,
 			repo.NewAuditLogRepo,
 			repo.NewRateLimitRepo,
+			repo.NewRateLimitTierRepo,
+			repo.NewSafetyViolationRepo,
+			repo.NewUserBanRepo,
+			repo.NewPIIVaultRepo,
 			repo.NewConversationRepo,
 			repo.NewMetricsRepo,
+			repo.NewChatJobRepo,
+			repo.NewPromptTestRepo,
+			repo.NewUserMemoryRepo,
+			repo.NewMessageEmbeddingRepo,
+			repo.NewModelPricingRepo,
+			repo.NewCostDigestRepo,
 			// Services
 			service.NewProviderManager,
 			service.NewSafetyService,
 			service.NewPromptService,
 			service.NewConversationService,
+			service.NewConversationPurger,
+			service.NewConversationCompactor,
+			service.NewModelPricingService,
 			service.NewCostCalculator,
+			service.NewCostReporter,
+			service.NewCostBackfillService,
+			service.NewCostDigestService,
+			service.NewConversionService,
+			service.NewRecordSamplingService,
+			service.NewEvalService,
 			service.NewChatService,
+			service.NewMemoryService,
+			service.NewEmbeddingIndex,
+			service.NewChatJobService,
+			service.NewABTestMonitor,
+			service.NewMetricsAnomalyDetector,
+			service.NewPromptGitSync,
+			service.NewPromptRegressionService,
+			service.NewPromptTranscriptConverter,
+			service.NewUserErasureService,
 		},
 		RouteRegistrars: []any{
 			router.NewLLMAdminRoutes,
+			router.NewLLMChatRoutes,
+			router.NewPromptAdminRoutes,
+			router.NewPromptGitRoutes,
+			router.NewPromptRegressionRoutes,
 			router.NewMetricsRoutes,
+			router.NewChatJobRoutes,
+			router.NewRateLimitRoutes,
+			router.NewConversationRoutes,
+			router.NewMemoryRoutes,
+			router.NewPrometheusRoutes,
 		},
 		OnInit: func(c server.ModuleContainer) error {
 			container = c
@@ -45,15 +83,59 @@ func NewModule() (server.IModule, error) {
 			if container == nil {
 				return errorx.New(errorx.Internal, "container is nil")
 			}
-			return container.Invoke(func(pm service.ProviderManager) error {
-				return pm.Start(ctx)
+			return container.Invoke(func(pm service.ProviderManager, jobs service.ChatJobService, abMonitor service.ABTestMonitor, anomalies service.MetricsAnomalyDetector, gitSync service.PromptGitSync, regression service.PromptRegressionService, purger service.ConversationPurger, compactor service.ConversationCompactor, memories service.MemoryService, embeddings service.EmbeddingIndex, backfill service.CostBackfillService, digests service.CostDigestService) error {
+				if err := pm.Start(ctx); err != nil {
+					return err
+				}
+				if err := jobs.Start(ctx); err != nil {
+					return err
+				}
+				if err := abMonitor.Start(ctx); err != nil {
+					return err
+				}
+				if err := anomalies.Start(ctx); err != nil {
+					return err
+				}
+				if err := gitSync.Start(ctx); err != nil {
+					return err
+				}
+				if err := regression.Start(ctx); err != nil {
+					return err
+				}
+				if err := purger.Start(ctx); err != nil {
+					return err
+				}
+				if err := compactor.Start(ctx); err != nil {
+					return err
+				}
+				if err := memories.Start(ctx); err != nil {
+					return err
+				}
+				if err := backfill.Start(ctx); err != nil {
+					return err
+				}
+				if err := digests.Start(ctx); err != nil {
+					return err
+				}
+				return embeddings.Start(ctx)
 			})
 		},
 		OnStop: func(ctx context.Context) error {
 			if container == nil {
 				return nil
 			}
-			return container.Invoke(func(pm service.ProviderManager) error {
+			return container.Invoke(func(pm service.ProviderManager, jobs service.ChatJobService, abMonitor service.ABTestMonitor, anomalies service.MetricsAnomalyDetector, gitSync service.PromptGitSync, regression service.PromptRegressionService, purger service.ConversationPurger, compactor service.ConversationCompactor, memories service.MemoryService, embeddings service.EmbeddingIndex, backfill service.CostBackfillService, digests service.CostDigestService) error {
+				_ = digests.Stop(ctx)
+				_ = backfill.Stop(ctx)
+				_ = embeddings.Stop(ctx)
+				_ = memories.Stop(ctx)
+				_ = compactor.Stop(ctx)
+				_ = purger.Stop(ctx)
+				_ = regression.Stop(ctx)
+				_ = gitSync.Stop(ctx)
+				_ = anomalies.Stop(ctx)
+				_ = abMonitor.Stop(ctx)
+				_ = jobs.Stop(ctx)
 				return pm.Stop(ctx)
 			})
 		},
@@ -2,6 +2,7 @@ package repo
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"gochen-llm/entity"
@@ -13,6 +14,14 @@ import (
 type AuditLogRepo interface {
 	Save(ctx context.Context, log *entity.AuditLog) error
 	List(ctx context.Context, filter AuditLogFilter, limit, offset int) ([]*entity.AuditLog, int64, error)
+	// Iterate 按 ID 倒序分批遍历符合条件的审计日志（基于 ID 游标，不使用 offset），fn 返回错误时终止
+	Iterate(ctx context.Context, filter AuditLogFilter, batchSize int, fn func(batch []*entity.AuditLog) error) error
+	// AnonymizeUser 匿名化用户的审计日志：用户 ID 清零，请求/响应正文、客户端信息与错误信息清空，返回影响行数
+	AnonymizeUser(ctx context.Context, userID int64) (int64, error)
+	// SetCipher 启用请求/响应正文的字段加密：写入时加密，读取时透明解密；nil 关闭加密（已加密数据仍需原密钥读取）
+	SetCipher(cipher FieldCipher)
+	// SetSampler 设置正文采样：未被采样的记录只保存元数据并标记 PayloadOmitted；nil 表示全部保存
+	SetSampler(sampler RecordSampler)
 }
 
 // RateLimitRepo 持久化限流窗口
@@ -20,11 +29,20 @@ type RateLimitRepo interface {
 	Increment(ctx context.Context, userID int64, resourceType string, windowStart time.Time, windowSizeSeconds int, deltaReq int, deltaTokens int) (*entity.RateLimit, error)
 	ListRecent(ctx context.Context, resourceType string, limit int) ([]*entity.RateLimit, error)
 	SumSince(ctx context.Context, resourceType string, since time.Time) (int64, error)
+	SumTokensSince(ctx context.Context, resourceType string, since time.Time) (int64, error)
+	// DeleteByUser 删除用户的全部限流窗口，返回删除行数
+	DeleteByUser(ctx context.Context, userID int64) (int64, error)
 }
 
 type auditLogRepoImpl struct {
 	orm   orm.IOrm
 	model ormModel
+
+	cipherMu sync.RWMutex
+	cipher   FieldCipher
+
+	samplerMu sync.RWMutex
+	sampler   RecordSampler
 }
 
 type rateLimitRepoImpl struct {
@@ -34,6 +52,7 @@ type rateLimitRepoImpl struct {
 
 type AuditLogFilter struct {
 	UserID       *int64
+	RequestID    string
 	Action       string
 	Status       string
 	ResourceType string
@@ -63,12 +82,67 @@ func (r *auditLogRepoImpl) Save(ctx context.Context, log *entity.AuditLog) error
 	if err != nil {
 		return errorx.Wrap(err, errorx.Database, "创建审计日志 model 失败")
 	}
+	if sampler := r.recordSampler(); sampler != nil && !sampler.KeepAuditPayload(log) {
+		log.RequestJSON, log.ResponseJSON = "", ""
+		log.PayloadOmitted = true
+	}
+	if c := r.fieldCipher(); c != nil {
+		// 加密后写入，完成后恢复调用方持有的明文
+		request, response := log.RequestJSON, log.ResponseJSON
+		defer func() { log.RequestJSON, log.ResponseJSON = request, response }()
+		if log.RequestJSON, err = c.Encrypt(request); err != nil {
+			return err
+		}
+		if log.ResponseJSON, err = c.Encrypt(response); err != nil {
+			return err
+		}
+	}
 	if err := model.Create(ctx, log); err != nil {
 		return errorx.Wrap(err, errorx.Database, "保存审计日志失败")
 	}
 	return nil
 }
 
+func (r *auditLogRepoImpl) SetCipher(cipher FieldCipher) {
+	r.cipherMu.Lock()
+	defer r.cipherMu.Unlock()
+	r.cipher = cipher
+}
+
+func (r *auditLogRepoImpl) fieldCipher() FieldCipher {
+	r.cipherMu.RLock()
+	defer r.cipherMu.RUnlock()
+	return r.cipher
+}
+
+func (r *auditLogRepoImpl) SetSampler(sampler RecordSampler) {
+	r.samplerMu.Lock()
+	defer r.samplerMu.Unlock()
+	r.sampler = sampler
+}
+
+func (r *auditLogRepoImpl) recordSampler() RecordSampler {
+	r.samplerMu.RLock()
+	defer r.samplerMu.RUnlock()
+	return r.sampler
+}
+
+// decrypt 解密正文字段；解密失败时保留密文，不影响列表查询
+func (r *auditLogRepoImpl) decrypt(list []*entity.AuditLog) {
+	c := r.fieldCipher()
+	if c == nil {
+		return
+	}
+	for _, log := range list {
+		if v, err := c.Decrypt(log.RequestJSON); err == nil {
+			log.RequestJSON = v
+		}
+		if v, err := c.Decrypt(log.ResponseJSON); err == nil {
+			log.ResponseJSON = v
+		}
+	}
+}
+
 func (r *auditLogRepoImpl) List(ctx context.Context, filter AuditLogFilter, limit, offset int) ([]*entity.AuditLog, int64, error) {
 	filterOptions := buildAuditOptions(filter)
 	model, err := r.model.model(r.orm)
@@ -98,9 +172,44 @@ func (r *auditLogRepoImpl) List(ctx context.Context, filter AuditLogFilter, limi
 	if err := model.Find(ctx, &list, listOptions...); err != nil {
 		return nil, 0, errorx.Wrap(err, errorx.Database, "查询审计日志失败")
 	}
+	r.decrypt(list)
 	return list, total, nil
 }
 
+func (r *auditLogRepoImpl) Iterate(ctx context.Context, filter AuditLogFilter, batchSize int, fn func(batch []*entity.AuditLog) error) error {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建审计日志 model 失败")
+	}
+	if batchSize <= 0 || batchSize > 1000 {
+		batchSize = 500
+	}
+	var lastID int64
+	for {
+		opts := buildAuditOptions(filter)
+		if lastID > 0 {
+			opts = append(opts, orm.WithWhere("id < ?", lastID))
+		}
+		opts = append(opts, orm.WithOrderBy("id", true), orm.WithLimit(batchSize))
+
+		var batch []*entity.AuditLog
+		if err := model.Find(ctx, &batch, opts...); err != nil {
+			return errorx.Wrap(err, errorx.Database, "查询审计日志失败")
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		r.decrypt(batch)
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
 func (r *rateLimitRepoImpl) Increment(ctx context.Context, userID int64, resourceType string, windowStart time.Time, windowSizeSeconds int, deltaReq int, deltaTokens int) (*entity.RateLimit, error) {
 	if userID <= 0 {
 		return nil, errorx.New(errorx.InvalidInput, "userID 无效")
@@ -210,6 +319,28 @@ func (r *rateLimitRepoImpl) SumSince(ctx context.Context, resourceType string, s
 	return row.Total, nil
 }
 
+func (r *rateLimitRepoImpl) SumTokensSince(ctx context.Context, resourceType string, since time.Time) (int64, error) {
+	opts := []orm.QueryOption{}
+	if resourceType != "" {
+		opts = append(opts, orm.WithWhere("resource_type = ?", resourceType))
+	}
+	if !since.IsZero() {
+		opts = append(opts, orm.WithWhere("window_start >= ?", since))
+	}
+
+	var row struct {
+		Total int64 `json:"total"`
+	}
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建限流 model 失败")
+	}
+	if err := model.First(ctx, &row, append(opts, orm.WithSelect("COALESCE(SUM(token_count), 0) as total"))...); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "统计限流 token 数失败")
+	}
+	return row.Total, nil
+}
+
 func buildAuditOptions(filter AuditLogFilter) []orm.QueryOption {
 	opts := []orm.QueryOption{}
 	if filter.UserID != nil {
@@ -224,6 +355,9 @@ func buildAuditOptions(filter AuditLogFilter) []orm.QueryOption {
 	if filter.ResourceType != "" {
 		opts = append(opts, orm.WithWhere("resource_type = ?", filter.ResourceType))
 	}
+	if filter.RequestID != "" {
+		opts = append(opts, orm.WithWhere("request_id = ?", filter.RequestID))
+	}
 	if filter.StartAt != nil {
 		opts = append(opts, orm.WithWhere("created_at >= ?", *filter.StartAt))
 	}
@@ -232,3 +366,48 @@ func buildAuditOptions(filter AuditLogFilter) []orm.QueryOption {
 	}
 	return opts
 }
+
+func (r *auditLogRepoImpl) AnonymizeUser(ctx context.Context, userID int64) (int64, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建审计日志 model 失败")
+	}
+	where := orm.WithWhere("user_id = ?", userID)
+	count, err := model.Count(ctx, where)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "统计用户审计日志失败")
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if err := model.UpdateValues(ctx, map[string]any{
+		"user_id":       0,
+		"request_json":  "",
+		"response_json": "",
+		"ip_address":    "",
+		"user_agent":    "",
+		"error_message": "",
+	}, where); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "匿名化用户审计日志失败")
+	}
+	return count, nil
+}
+
+func (r *rateLimitRepoImpl) DeleteByUser(ctx context.Context, userID int64) (int64, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建限流 model 失败")
+	}
+	where := orm.WithWhere("user_id = ?", userID)
+	count, err := model.Count(ctx, where)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "统计用户限流窗口失败")
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if err := model.Delete(ctx, where); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "删除用户限流窗口失败")
+	}
+	return count, nil
+}
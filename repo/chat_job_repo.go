@@ -0,0 +1,188 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/db/orm"
+	"gochen/errorx"
+)
+
+// ChatJobRepo 持久化异步聊天任务
+type ChatJobRepo interface {
+	Create(ctx context.Context, job *entity.ChatJob) error
+	Get(ctx context.Context, id int64) (*entity.ChatJob, error)
+	Update(ctx context.Context, job *entity.ChatJob) error
+	// ClaimPending 以行锁领取最多 limit 个待执行任务，标记为 running 并持有 lease 时长的租约
+	ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]*entity.ChatJob, error)
+	// Heartbeat 续期执行中任务的租约至 lockedUntil
+	Heartbeat(ctx context.Context, id int64, lockedUntil time.Time) error
+	// RequeueExpired 将租约已过期（或未记录租约）的 running 任务重置为 pending，用于恢复失联实例遗留的任务
+	RequeueExpired(ctx context.Context, now time.Time) error
+	// DeleteByUser 删除用户提交的全部任务（含请求与响应正文），返回删除行数
+	DeleteByUser(ctx context.Context, userID int64) (int64, error)
+}
+
+type chatJobRepoImpl struct {
+	orm   orm.IOrm
+	model ormModel
+}
+
+func NewChatJobRepo(o orm.IOrm) ChatJobRepo {
+	return &chatJobRepoImpl{
+		orm:   o,
+		model: newOrmModel(&entity.ChatJob{}, (entity.ChatJob{}).TableName()),
+	}
+}
+
+func (r *chatJobRepoImpl) Create(ctx context.Context, job *entity.ChatJob) error {
+	if job == nil {
+		return errorx.New(errorx.InvalidInput, "chat job 不能为空")
+	}
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 chat job model 失败")
+	}
+	if err := model.Create(ctx, job); err != nil {
+		return errorx.Wrap(err, errorx.Database, "保存异步聊天任务失败")
+	}
+	return nil
+}
+
+func (r *chatJobRepoImpl) Get(ctx context.Context, id int64) (*entity.ChatJob, error) {
+	var job entity.ChatJob
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 chat job model 失败")
+	}
+	err = model.First(ctx, &job, orm.WithWhere("id = ?", id))
+	if err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, nil
+		}
+		return nil, errorx.Wrap(err, errorx.Database, "查询异步聊天任务失败")
+	}
+	return &job, nil
+}
+
+func (r *chatJobRepoImpl) Update(ctx context.Context, job *entity.ChatJob) error {
+	if job == nil || job.ID == 0 {
+		return errorx.New(errorx.InvalidInput, "chat job ID 无效")
+	}
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 chat job model 失败")
+	}
+	if err := model.Save(ctx, job, orm.WithWhere("id = ?", job.ID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新异步聊天任务失败")
+	}
+	return nil
+}
+
+func (r *chatJobRepoImpl) ClaimPending(ctx context.Context, limit int, lease time.Duration) ([]*entity.ChatJob, error) {
+	if limit <= 0 {
+		limit = 1
+	}
+
+	session, err := r.orm.Begin(ctx)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "开启领取任务事务失败")
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = session.Rollback()
+		}
+	}()
+
+	model, err := r.model.model(session)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 chat job model 失败")
+	}
+
+	var jobs []*entity.ChatJob
+	if err := model.Find(ctx, &jobs,
+		orm.WithWhere("status = ?", entity.ChatJobStatusPending),
+		orm.WithOrderBy("id", false),
+		orm.WithLimit(limit),
+		orm.WithForUpdate(),
+	); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询待执行任务失败")
+	}
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	lockedUntil := now.Add(lease)
+	for _, job := range jobs {
+		job.Status = entity.ChatJobStatusRunning
+		job.Attempts++
+		job.StartedAt = &now
+		job.LockedUntil = &lockedUntil
+		job.HeartbeatAt = &now
+		if err := model.UpdateValues(ctx, map[string]any{
+			"status":       job.Status,
+			"attempts":     job.Attempts,
+			"started_at":   now,
+			"locked_until": lockedUntil,
+			"heartbeat_at": now,
+		}, orm.WithWhere("id = ?", job.ID)); err != nil {
+			return nil, errorx.Wrap(err, errorx.Database, "标记任务执行中失败")
+		}
+	}
+
+	if err := session.Commit(); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "提交领取任务事务失败")
+	}
+	committed = true
+	return jobs, nil
+}
+
+func (r *chatJobRepoImpl) Heartbeat(ctx context.Context, id int64, lockedUntil time.Time) error {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 chat job model 失败")
+	}
+	if err := model.UpdateValues(ctx, map[string]any{
+		"locked_until": lockedUntil,
+		"heartbeat_at": time.Now(),
+	}, orm.WithWhere("id = ? AND status = ?", id, entity.ChatJobStatusRunning)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "续期任务租约失败")
+	}
+	return nil
+}
+
+func (r *chatJobRepoImpl) RequeueExpired(ctx context.Context, now time.Time) error {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 chat job model 失败")
+	}
+	if err := model.UpdateValues(ctx, map[string]any{
+		"status":       entity.ChatJobStatusPending,
+		"locked_until": nil,
+	}, orm.WithWhere("status = ? AND (locked_until IS NULL OR locked_until < ?)", entity.ChatJobStatusRunning, now)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "重置租约过期任务失败")
+	}
+	return nil
+}
+
+func (r *chatJobRepoImpl) DeleteByUser(ctx context.Context, userID int64) (int64, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建 chat job model 失败")
+	}
+	where := orm.WithWhere("user_id = ?", userID)
+	count, err := model.Count(ctx, where)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "统计用户聊天任务失败")
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if err := model.Delete(ctx, where); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "删除用户聊天任务失败")
+	}
+	return count, nil
+}
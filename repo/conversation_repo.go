@@ -2,6 +2,8 @@ package repo
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"gochen-llm/entity"
 	"gochen/db/orm"
@@ -13,15 +15,92 @@ type ConversationRepo interface {
 	CreateConversation(ctx context.Context, conv *entity.Conversation) error
 	GetConversation(ctx context.Context, id int64) (*entity.Conversation, error)
 	UpdateConversation(ctx context.Context, conv *entity.Conversation) error
-	AddMessage(ctx context.Context, msg *entity.Message) error
+	// ImportConversation 在同一事务中创建会话及其消息（保留消息的原始时间）
+	ImportConversation(ctx context.Context, conv *entity.Conversation, msgs []*entity.Message) error
+	// ListBranches 返回会话的直接分支（未删除），按 ID 正序
+	ListBranches(ctx context.Context, parentID int64) ([]*entity.Conversation, error)
+	// ListConversations 按筛选条件分页列出会话，返回当前页与总数
+	ListConversations(ctx context.Context, filter entity.ConversationFilter, limit, offset int) ([]*entity.Conversation, int64, error)
+	// AddMessage 在一个事务中写入消息及其附件、更新会话活跃时间，并为发送者之外的参与者累加未读数；
+	// 消息带 ClientMessageID 且已写入过时不重复插入，将已有消息填回 msg 并返回 false
+	AddMessage(ctx context.Context, msg *entity.Message) (bool, error)
+	// ListReadStates 按会话 ID 返回用户的已读进度，没有记录的会话不出现在结果中
+	ListReadStates(ctx context.Context, userID int64, conversationIDs []int64) (map[int64]*entity.ConversationReadState, error)
+	// MarkRead 将用户在会话中的已读进度推进到 messageID（不会回退），并按此重算未读数
+	MarkRead(ctx context.Context, conversationID, userID, messageID int64) (*entity.ConversationReadState, error)
+	// ListAttachments 按消息 ID 分组返回附件
+	ListAttachments(ctx context.Context, messageIDs []int64) (map[int64][]*entity.MessageAttachment, error)
 	GetMessages(ctx context.Context, conversationID int64, limit int) ([]*entity.Message, error)
-	TrimMessages(ctx context.Context, conversationID int64, keepLast int) error
+	// ListMessages 按消息 ID 游标分页，返回当前页、会话消息总数以及游标方向上是否还有更多消息
+	ListMessages(ctx context.Context, query entity.MessageQuery) ([]*entity.Message, int64, bool, error)
+	// TrimMessages 仅保留最近 keepLast 条消息，返回物理删除的消息数
+	TrimMessages(ctx context.Context, conversationID int64, keepLast int) (int64, error)
+	// ListCompactable 返回 inactiveBefore 之后没有新消息、且消息数超过 keepLast 的会话，按 ID 正序从 afterID 之后取
+	ListCompactable(ctx context.Context, inactiveBefore time.Time, keepLast int, afterID int64, limit int) ([]*entity.Conversation, error)
+	// GetMessagesAfter 按 ID 正序返回 afterID 之后的消息
+	GetMessagesAfter(ctx context.Context, conversationID, afterID int64, limit int) ([]*entity.Message, error)
+	// CountMessagesByRole 按角色统计会话中未删除的消息数
+	CountMessagesByRole(ctx context.Context, conversationID int64) (map[string]int64, error)
+	// CountMessagesAfter 统计 afterID 之后的消息数
+	CountMessagesAfter(ctx context.Context, conversationID, afterID int64) (int64, error)
+	// UpdateSummary 写入会话摘要及其覆盖到的最后一条消息 ID
+	UpdateSummary(ctx context.Context, conversationID int64, summary string, lastMessageID int64) error
+	// AddUsage 在事务中累加会话的用量计数
+	AddUsage(ctx context.Context, conversationID int64, delta entity.ConversationUsage) error
+	// ListPendingMemory 返回有未提取长期记忆的新消息、且 idleBefore 之后没有新消息的会话，按最近消息时间正序
+	ListPendingMemory(ctx context.Context, idleBefore time.Time, limit int) ([]*entity.Conversation, error)
+	// UpdateMemoryCursor 记录长期记忆提取已处理到的最后一条消息 ID
+	UpdateMemoryCursor(ctx context.Context, conversationID, lastMessageID int64) error
+	// SetTitle 更新会话标题；onlyIfEmpty 时仅在标题为空时写入，返回是否写入
+	SetTitle(ctx context.Context, conversationID int64, title string, onlyIfEmpty bool) (bool, error)
+	// SetSettings 更新会话级覆盖设置
+	SetSettings(ctx context.Context, conversationID int64, settingsJSON string) error
+	// SetStatus 更新会话状态（不用于删除）
+	SetStatus(ctx context.Context, conversationID int64, status string) error
+	// SoftDelete 将会话标记为已删除，并级联软删除其消息
+	SoftDelete(ctx context.Context, conversationID int64, now time.Time) error
+	// PurgeDeleted 物理删除 before 之前软删除的会话及其消息、附件、授权、已读进度、分享、故事状态记录、消息反馈与内置向量索引，单次最多 limit 个会话，返回删除的会话数
+	PurgeDeleted(ctx context.Context, before time.Time, limit int) (int64, error)
+	// EraseUser 删除用户数据：物理删除其拥有的全部会话（含已软删除），清除其在他人会话中发送的消息正文、附件与向量，
+	// 删除含其消息的会话分享快照并清空这些会话的滚动摘要，并删除其参与授权、已读进度与消息反馈；
+	// 返回删除的会话数与匿名化的消息数
+	EraseUser(ctx context.Context, userID int64) (int64, int64, error)
+	// SearchMessages 在用户本人（未删除）的会话中按关键词检索消息，所有 terms 均需命中；conversationID>0 时限定会话
+	SearchMessages(ctx context.Context, userID, conversationID int64, terms []string, limit int) ([]*entity.Message, error)
+	// GetAccess 返回用户对会话的共享授权，不存在时返回 nil
+	GetAccess(ctx context.Context, conversationID, userID int64) (*entity.ConversationAccess, error)
+	ListAccess(ctx context.Context, conversationID int64) ([]*entity.ConversationAccess, error)
+	// SaveAccess 新增或更新用户对会话的共享授权
+	SaveAccess(ctx context.Context, access *entity.ConversationAccess) error
+	DeleteAccess(ctx context.Context, conversationID, userID int64) error
+	CreateShare(ctx context.Context, share *entity.ConversationShare) error
+	// GetShareByToken 按令牌查询分享（含已撤销、已过期），不存在时返回 nil
+	GetShareByToken(ctx context.Context, token string) (*entity.ConversationShare, error)
+	// ListShares 列出会话的分享（不含快照内容），按 ID 倒序
+	ListShares(ctx context.Context, conversationID int64) ([]*entity.ConversationShare, error)
+	// RevokeShare 撤销会话下的分享，返回是否撤销了未撤销的分享
+	RevokeShare(ctx context.Context, conversationID, shareID int64, at time.Time) (bool, error)
+	// ApplyStoryState 在事务中写入故事状态与流转记录；会话的 StoryStateSeq 与 expectedSeq 不一致时返回 Validation 错误
+	ApplyStoryState(ctx context.Context, conversationID, expectedSeq int64, stateJSON string, change *entity.StoryStateChange) error
+	// SaveFeedback 新增或覆盖用户对消息的反馈，返回覆盖前的反馈（首次提交时为 nil）
+	SaveFeedback(ctx context.Context, feedback *entity.MessageFeedback) (*entity.MessageFeedback, error)
+	// GetFeedback 返回用户对消息的反馈，不存在时返回 nil
+	GetFeedback(ctx context.Context, messageID, userID int64) (*entity.MessageFeedback, error)
+	// ListStoryStateChanges 按序号倒序返回 beforeSeq（0 表示最新）之前的流转记录
+	ListStoryStateChanges(ctx context.Context, conversationID, beforeSeq int64, limit int) ([]*entity.StoryStateChange, error)
 }
 
 type conversationRepoImpl struct {
 	orm               orm.IOrm
 	conversationModel ormModel
 	messageModel      ormModel
+	accessModel       ormModel
+	embeddingModel    ormModel
+	attachmentModel   ormModel
+	readModel         ormModel
+	shareModel        ormModel
+	storyModel        ormModel
+	feedbackModel     ormModel
 }
 
 func NewConversationRepo(o orm.IOrm) ConversationRepo {
@@ -29,6 +108,13 @@ func NewConversationRepo(o orm.IOrm) ConversationRepo {
 		orm:               o,
 		conversationModel: newOrmModel(&entity.Conversation{}, (entity.Conversation{}).TableName()),
 		messageModel:      newOrmModel(&entity.Message{}, (entity.Message{}).TableName()),
+		accessModel:       newOrmModel(&entity.ConversationAccess{}, (entity.ConversationAccess{}).TableName()),
+		embeddingModel:    newOrmModel(&entity.MessageEmbedding{}, (entity.MessageEmbedding{}).TableName()),
+		attachmentModel:   newOrmModel(&entity.MessageAttachment{}, (entity.MessageAttachment{}).TableName()),
+		readModel:         newOrmModel(&entity.ConversationReadState{}, (entity.ConversationReadState{}).TableName()),
+		shareModel:        newOrmModel(&entity.ConversationShare{}, (entity.ConversationShare{}).TableName()),
+		storyModel:        newOrmModel(&entity.StoryStateChange{}, (entity.StoryStateChange{}).TableName()),
+		feedbackModel:     newOrmModel(&entity.MessageFeedback{}, (entity.MessageFeedback{}).TableName()),
 	}
 }
 
@@ -49,7 +135,7 @@ func (r *conversationRepoImpl) GetConversation(ctx context.Context, id int64) (*
 	if err != nil {
 		return nil, errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
 	}
-	err = model.First(ctx, &conv, orm.WithWhere("id = ?", id))
+	err = model.First(ctx, &conv, orm.WithWhere("id = ? AND deleted_at IS NULL", id))
 	if err != nil {
 		if errorx.Is(err, errorx.NotFound) {
 			return nil, nil
@@ -70,17 +156,356 @@ func (r *conversationRepoImpl) UpdateConversation(ctx context.Context, conv *ent
 	return nil
 }
 
-func (r *conversationRepoImpl) AddMessage(ctx context.Context, msg *entity.Message) error {
-	model, err := r.messageModel.model(r.orm)
+func (r *conversationRepoImpl) ImportConversation(ctx context.Context, conv *entity.Conversation, msgs []*entity.Message) error {
+	session, err := r.orm.Begin(ctx)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "开启导入会话事务失败")
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = session.Rollback()
+		}
+	}()
+
+	convModel, err := r.conversationModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	if err := convModel.Create(ctx, conv); err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建会话失败")
+	}
+	msgModel, err := r.messageModel.model(session)
 	if err != nil {
 		return errorx.Wrap(err, errorx.Database, "创建 message model 失败")
 	}
+	for _, msg := range msgs {
+		msg.ConversationID = conv.ID
+		if err := msgModel.Create(ctx, msg); err != nil {
+			return errorx.Wrap(err, errorx.Database, "导入消息失败")
+		}
+	}
+	if err := session.Commit(); err != nil {
+		return errorx.Wrap(err, errorx.Database, "提交导入会话事务失败")
+	}
+	committed = true
+	return nil
+}
+
+func (r *conversationRepoImpl) ListBranches(ctx context.Context, parentID int64) ([]*entity.Conversation, error) {
+	model, err := r.conversationModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	var list []*entity.Conversation
+	if err := model.Find(ctx, &list,
+		orm.WithWhere("parent_id = ? AND deleted_at IS NULL", parentID),
+		orm.WithOrderBy("id", false),
+	); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询会话分支失败")
+	}
+	return list, nil
+}
+
+func (r *conversationRepoImpl) ListConversations(ctx context.Context, filter entity.ConversationFilter, limit, offset int) ([]*entity.Conversation, int64, error) {
+	model, err := r.conversationModel.model(r.orm)
+	if err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	opts := []orm.QueryOption{orm.WithWhere("deleted_at IS NULL")}
+	if filter.IncludeShared {
+		opts = append(opts, orm.WithWhere(
+			"(user_id = ? OR id IN (SELECT conversation_id FROM llm_conversation_access WHERE user_id = ?))",
+			filter.UserID, filter.UserID,
+		))
+	} else {
+		opts = append(opts, orm.WithWhere("user_id = ?", filter.UserID))
+	}
+	if filter.Type != "" {
+		opts = append(opts, orm.WithWhere("type = ?", filter.Type))
+	}
+	status := filter.Status
+	if status == "" {
+		status = entity.ConversationStatusActive
+	}
+	opts = append(opts, orm.WithWhere("status = ?", status))
+	if filter.UpdatedFrom != nil {
+		opts = append(opts, orm.WithWhere("updated_at >= ?", *filter.UpdatedFrom))
+	}
+	if filter.UpdatedTo != nil {
+		opts = append(opts, orm.WithWhere("updated_at <= ?", *filter.UpdatedTo))
+	}
+	total, err := model.Count(ctx, opts...)
+	if err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "统计会话失败")
+	}
+
+	switch filter.Sort {
+	case entity.ConversationSortCreated:
+		opts = append(opts, orm.WithOrderBy("created_at", true))
+	case entity.ConversationSortUpdated:
+		opts = append(opts, orm.WithOrderBy("updated_at", true))
+	default:
+		// 尚无消息的会话以创建时间参与排序
+		opts = append(opts, orm.WithOrderBy("COALESCE(last_message_at, created_at)", true))
+	}
+	opts = append(opts, orm.WithOrderBy("id", true), orm.WithLimit(limit), orm.WithOffset(offset))
+	var list []*entity.Conversation
+	if err := model.Find(ctx, &list, opts...); err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "查询会话列表失败")
+	}
+	return list, total, nil
+}
+
+func (r *conversationRepoImpl) AddMessage(ctx context.Context, msg *entity.Message) (bool, error) {
+	session, err := r.orm.Begin(ctx)
+	if err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "开启添加消息事务失败")
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = session.Rollback()
+		}
+	}()
+
+	// 先锁定会话行，使同一会话的消息写入与已读更新串行
+	convModel, err := r.conversationModel.model(session)
+	if err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	var conv entity.Conversation
+	if err := convModel.First(ctx, &conv,
+		orm.WithWhere("id = ?", msg.ConversationID),
+		orm.WithSelect("id", "user_id"),
+		orm.WithForUpdate(),
+	); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return false, errorx.New(errorx.NotFound, "会话不存在")
+		}
+		return false, errorx.Wrap(err, errorx.Database, "查询会话失败")
+	}
+
+	model, err := r.messageModel.model(session)
+	if err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "创建 message model 失败")
+	}
+	if msg.ClientMessageID != nil {
+		var existing entity.Message
+		err := model.First(ctx, &existing, orm.WithWhere("client_message_id = ?", *msg.ClientMessageID))
+		if err == nil {
+			if existing.ConversationID != msg.ConversationID {
+				return false, errorx.New(errorx.Validation, "client_message_id 已被其他会话使用")
+			}
+			*msg = existing
+			return false, nil
+		}
+		if !errorx.Is(err, errorx.NotFound) {
+			return false, errorx.Wrap(err, errorx.Database, "查询消息失败")
+		}
+	}
 	if err := model.Create(ctx, msg); err != nil {
-		return errorx.Wrap(err, errorx.Database, "添加消息失败")
+		return false, errorx.Wrap(err, errorx.Database, "添加消息失败")
+	}
+	if len(msg.Attachments) > 0 {
+		attachmentModel, err := r.attachmentModel.model(session)
+		if err != nil {
+			return false, errorx.Wrap(err, errorx.Database, "创建消息附件 model 失败")
+		}
+		for _, a := range msg.Attachments {
+			a.MessageID, a.ConversationID = msg.ID, msg.ConversationID
+			if err := attachmentModel.Create(ctx, a); err != nil {
+				return false, errorx.Wrap(err, errorx.Database, "保存消息附件失败")
+			}
+		}
+	}
+	now := time.Now()
+	if err := convModel.UpdateValues(ctx, map[string]any{
+		"last_message_at": now,
+		"updated_at":      now,
+	}, orm.WithWhere("id = ?", msg.ConversationID)); err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "更新会话活跃时间失败")
+	}
+
+	accessModel, err := r.accessModel.model(session)
+	if err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "创建 conversation access model 失败")
+	}
+	var shared []*entity.ConversationAccess
+	if err := accessModel.Find(ctx, &shared, orm.WithWhere("conversation_id = ?", msg.ConversationID)); err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "查询会话授权列表失败")
+	}
+	participants := []int64{conv.UserID}
+	for _, a := range shared {
+		if a.UserID != conv.UserID {
+			participants = append(participants, a.UserID)
+		}
+	}
+	readModel, err := r.readModel.model(session)
+	if err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "创建会话已读 model 失败")
+	}
+	for _, userID := range participants {
+		state, err := r.lockReadState(ctx, readModel, msg.ConversationID, userID)
+		if err != nil {
+			return false, err
+		}
+		if userID == msg.SenderUserID {
+			// 发送者视为已读到自己的消息
+			state.LastReadMessageID, state.UnreadCount, state.LastReadAt = msg.ID, 0, &now
+		} else {
+			state.UnreadCount++
+		}
+		if err := r.saveReadState(ctx, readModel, state); err != nil {
+			return false, err
+		}
+	}
+
+	if err := session.Commit(); err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "提交添加消息事务失败")
+	}
+	committed = true
+	return true, nil
+}
+
+// lockReadState 加锁读取已读进度，不存在时返回未保存的零值记录
+func (r *conversationRepoImpl) lockReadState(ctx context.Context, model orm.IModel, conversationID, userID int64) (*entity.ConversationReadState, error) {
+	var state entity.ConversationReadState
+	if err := model.First(ctx, &state,
+		orm.WithWhere("conversation_id = ? AND user_id = ?", conversationID, userID),
+		orm.WithForUpdate(),
+	); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return &entity.ConversationReadState{ConversationID: conversationID, UserID: userID}, nil
+		}
+		return nil, errorx.Wrap(err, errorx.Database, "查询会话已读进度失败")
+	}
+	return &state, nil
+}
+
+func (r *conversationRepoImpl) saveReadState(ctx context.Context, model orm.IModel, state *entity.ConversationReadState) error {
+	if state.ID == 0 {
+		if err := model.Create(ctx, state); err != nil {
+			return errorx.Wrap(err, errorx.Database, "保存会话已读进度失败")
+		}
+		return nil
+	}
+	if err := model.UpdateValues(ctx, map[string]any{
+		"last_read_message_id": state.LastReadMessageID,
+		"unread_count":         state.UnreadCount,
+		"last_read_at":         state.LastReadAt,
+	}, orm.WithWhere("id = ?", state.ID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新会话已读进度失败")
 	}
 	return nil
 }
 
+func (r *conversationRepoImpl) ListReadStates(ctx context.Context, userID int64, conversationIDs []int64) (map[int64]*entity.ConversationReadState, error) {
+	result := map[int64]*entity.ConversationReadState{}
+	if len(conversationIDs) == 0 {
+		return result, nil
+	}
+	model, err := r.readModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建会话已读 model 失败")
+	}
+	var list []*entity.ConversationReadState
+	if err := model.Find(ctx, &list, orm.WithWhere("user_id = ? AND conversation_id IN ?", userID, conversationIDs)); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询会话已读进度失败")
+	}
+	for _, st := range list {
+		result[st.ConversationID] = st
+	}
+	return result, nil
+}
+
+func (r *conversationRepoImpl) MarkRead(ctx context.Context, conversationID, userID, messageID int64) (*entity.ConversationReadState, error) {
+	session, err := r.orm.Begin(ctx)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "开启会话已读事务失败")
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = session.Rollback()
+		}
+	}()
+
+	convModel, err := r.conversationModel.model(session)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	var conv entity.Conversation
+	if err := convModel.First(ctx, &conv,
+		orm.WithWhere("id = ? AND deleted_at IS NULL", conversationID),
+		orm.WithSelect("id"),
+		orm.WithForUpdate(),
+	); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, errorx.New(errorx.NotFound, "会话不存在")
+		}
+		return nil, errorx.Wrap(err, errorx.Database, "查询会话失败")
+	}
+	readModel, err := r.readModel.model(session)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建会话已读 model 失败")
+	}
+	state, err := r.lockReadState(ctx, readModel, conversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if messageID > state.LastReadMessageID {
+		state.LastReadMessageID = messageID
+	}
+	msgModel, err := r.messageModel.model(session)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 message model 失败")
+	}
+	unread, err := msgModel.Count(ctx, orm.WithWhere("conversation_id = ? AND id > ? AND sender_user_id <> ? AND deleted_at IS NULL",
+		conversationID, state.LastReadMessageID, userID))
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "统计未读消息失败")
+	}
+	now := time.Now()
+	state.UnreadCount, state.LastReadAt = unread, &now
+	if err := r.saveReadState(ctx, readModel, state); err != nil {
+		return nil, err
+	}
+	if err := session.Commit(); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "提交会话已读事务失败")
+	}
+	committed = true
+	return state, nil
+}
+
+func (r *conversationRepoImpl) ListAttachments(ctx context.Context, messageIDs []int64) (map[int64][]*entity.MessageAttachment, error) {
+	result := map[int64][]*entity.MessageAttachment{}
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+	model, err := r.attachmentModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建消息附件 model 失败")
+	}
+	var list []*entity.MessageAttachment
+	if err := model.Find(ctx, &list,
+		orm.WithWhere("message_id IN ?", messageIDs),
+		orm.WithOrderBy("id", false),
+	); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询消息附件失败")
+	}
+	for _, a := range list {
+		result[a.MessageID] = append(result[a.MessageID], a)
+	}
+	return result, nil
+}
+
 func (r *conversationRepoImpl) GetMessages(ctx context.Context, conversationID int64, limit int) ([]*entity.Message, error) {
 	if limit <= 0 {
 		limit = 50
@@ -91,7 +516,7 @@ func (r *conversationRepoImpl) GetMessages(ctx context.Context, conversationID i
 		return nil, errorx.Wrap(err, errorx.Database, "创建 message model 失败")
 	}
 	if err := model.Find(ctx, &messages,
-		orm.WithWhere("conversation_id = ?", conversationID),
+		orm.WithWhere("conversation_id = ? AND deleted_at IS NULL", conversationID),
 		orm.WithOrderBy("created_at", true),
 		orm.WithLimit(limit),
 	); err != nil {
@@ -100,32 +525,909 @@ func (r *conversationRepoImpl) GetMessages(ctx context.Context, conversationID i
 	return messages, nil
 }
 
-func (r *conversationRepoImpl) TrimMessages(ctx context.Context, conversationID int64, keepLast int) error {
+func (r *conversationRepoImpl) ListMessages(ctx context.Context, query entity.MessageQuery) ([]*entity.Message, int64, bool, error) {
+	limit := query.Limit
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	model, err := r.messageModel.model(r.orm)
+	if err != nil {
+		return nil, 0, false, errorx.Wrap(err, errorx.Database, "创建 message model 失败")
+	}
+	base := orm.WithWhere("conversation_id = ? AND deleted_at IS NULL", query.ConversationID)
+	total, err := model.Count(ctx, base)
+	if err != nil {
+		return nil, 0, false, errorx.Wrap(err, errorx.Database, "统计消息数失败")
+	}
+
+	// 向游标方向取 limit+1 条判断是否还有更多：after 游标按 ID 正序取，其余从最新处倒序取
+	opts := []orm.QueryOption{base}
+	forward := query.AfterID > 0 && query.BeforeID <= 0
+	if query.AfterID > 0 {
+		opts = append(opts, orm.WithWhere("id > ?", query.AfterID))
+	}
+	if query.BeforeID > 0 {
+		opts = append(opts, orm.WithWhere("id < ?", query.BeforeID))
+	}
+	opts = append(opts, orm.WithOrderBy("id", !forward), orm.WithLimit(limit+1))
+	var messages []*entity.Message
+	if err := model.Find(ctx, &messages, opts...); err != nil {
+		return nil, 0, false, errorx.Wrap(err, errorx.Database, "查询消息列表失败")
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	if forward != query.Ascending {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, total, hasMore, nil
+}
+
+func (r *conversationRepoImpl) TrimMessages(ctx context.Context, conversationID int64, keepLast int) (int64, error) {
 	if keepLast <= 0 {
 		keepLast = 100
 	}
 
 	model, err := r.messageModel.model(r.orm)
 	if err != nil {
-		return errorx.Wrap(err, errorx.Database, "创建 message model 失败")
+		return 0, errorx.Wrap(err, errorx.Database, "创建 message model 失败")
 	}
 
 	var ids []int64
 	err = model.Find(ctx, &ids,
 		orm.WithSelect("id"),
-		orm.WithWhere("conversation_id = ?", conversationID),
+		orm.WithWhere("conversation_id = ? AND deleted_at IS NULL", conversationID),
 		orm.WithOrderBy("created_at", true),
 		orm.WithOffset(keepLast),
 	)
 	if err != nil {
-		return errorx.Wrap(err, errorx.Database, "查询待删除消息失败")
+		return 0, errorx.Wrap(err, errorx.Database, "查询待删除消息失败")
 	}
 	if len(ids) == 0 {
-		return nil
+		return 0, nil
 	}
 
 	if err := model.Delete(ctx, orm.WithWhere("id IN ?", ids)); err != nil {
-		return errorx.Wrap(err, errorx.Database, "压缩会话消息失败")
+		return 0, errorx.Wrap(err, errorx.Database, "压缩会话消息失败")
+	}
+	attachmentModel, err := r.attachmentModel.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建消息附件 model 失败")
+	}
+	if err := attachmentModel.Delete(ctx, orm.WithWhere("message_id IN ?", ids)); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "清理消息附件失败")
+	}
+	embeddingModel, err := r.embeddingModel.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建消息向量 model 失败")
+	}
+	if err := embeddingModel.Delete(ctx, orm.WithWhere("message_id IN ?", ids)); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "清理消息向量失败")
+	}
+	return int64(len(ids)), nil
+}
+
+func (r *conversationRepoImpl) ListCompactable(ctx context.Context, inactiveBefore time.Time, keepLast int, afterID int64, limit int) ([]*entity.Conversation, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	model, err := r.conversationModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	convTable, msgTable := (entity.Conversation{}).TableName(), (entity.Message{}).TableName()
+	var list []*entity.Conversation
+	if err := model.Find(ctx, &list,
+		orm.WithWhere("id > ? AND deleted_at IS NULL AND last_message_at IS NOT NULL AND last_message_at < ?", afterID, inactiveBefore),
+		orm.WithWhere("(SELECT COUNT(*) FROM "+msgTable+" m WHERE m.conversation_id = "+convTable+".id AND m.deleted_at IS NULL) > ?", keepLast),
+		orm.WithOrderBy("id", false),
+		orm.WithLimit(limit),
+	); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询待压缩会话失败")
+	}
+	return list, nil
+}
+
+func (r *conversationRepoImpl) GetMessagesAfter(ctx context.Context, conversationID, afterID int64, limit int) ([]*entity.Message, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	var messages []*entity.Message
+	model, err := r.messageModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 message model 失败")
+	}
+	if err := model.Find(ctx, &messages,
+		orm.WithWhere("conversation_id = ? AND id > ? AND deleted_at IS NULL", conversationID, afterID),
+		orm.WithOrderBy("id", false),
+		orm.WithLimit(limit),
+	); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询消息列表失败")
+	}
+	return messages, nil
+}
+
+func (r *conversationRepoImpl) CountMessagesByRole(ctx context.Context, conversationID int64) (map[string]int64, error) {
+	model, err := r.messageModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 message model 失败")
+	}
+	var rows []struct {
+		Role  string
+		Count int64
+	}
+	if err := model.Find(ctx, &rows,
+		orm.WithSelect("role", "COUNT(*) as count"),
+		orm.WithWhere("conversation_id = ? AND deleted_at IS NULL", conversationID),
+		orm.WithGroupBy("role"),
+	); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "按角色统计消息数失败")
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Role] = row.Count
+	}
+	return counts, nil
+}
+
+func (r *conversationRepoImpl) CountMessagesAfter(ctx context.Context, conversationID, afterID int64) (int64, error) {
+	model, err := r.messageModel.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建 message model 失败")
+	}
+	count, err := model.Count(ctx, orm.WithWhere("conversation_id = ? AND id > ? AND deleted_at IS NULL", conversationID, afterID))
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "统计消息数失败")
+	}
+	return count, nil
+}
+
+func (r *conversationRepoImpl) UpdateSummary(ctx context.Context, conversationID int64, summary string, lastMessageID int64) error {
+	model, err := r.conversationModel.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	if err := model.UpdateValues(ctx, map[string]any{
+		"summary":            summary,
+		"summary_message_id": lastMessageID,
+		"summary_at":         time.Now(),
+	}, orm.WithWhere("id = ?", conversationID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新会话摘要失败")
+	}
+	return nil
+}
+
+func (r *conversationRepoImpl) AddUsage(ctx context.Context, conversationID int64, delta entity.ConversationUsage) error {
+	session, err := r.orm.Begin(ctx)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "开启会话用量事务失败")
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = session.Rollback()
+		}
+	}()
+
+	model, err := r.conversationModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	var conv entity.Conversation
+	if err := model.First(ctx, &conv,
+		orm.WithWhere("id = ?", conversationID),
+		orm.WithSelect("id", "message_tokens", "prompt_tokens", "completion_tokens", "request_count", "cost_usd"),
+		orm.WithForUpdate(),
+	); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return errorx.New(errorx.NotFound, "会话不存在")
+		}
+		return errorx.Wrap(err, errorx.Database, "查询会话用量失败")
+	}
+	if err := model.UpdateValues(ctx, map[string]any{
+		"message_tokens":    conv.MessageTokens + delta.MessageTokens,
+		"prompt_tokens":     conv.PromptTokens + delta.PromptTokens,
+		"completion_tokens": conv.CompletionTokens + delta.CompletionTokens,
+		"request_count":     conv.RequestCount + delta.RequestCount,
+		"cost_usd":          conv.CostUSD + delta.CostUSD,
+	}, orm.WithWhere("id = ?", conversationID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新会话用量失败")
+	}
+	if err := session.Commit(); err != nil {
+		return errorx.Wrap(err, errorx.Database, "提交会话用量事务失败")
+	}
+	committed = true
+	return nil
+}
+
+func (r *conversationRepoImpl) ListPendingMemory(ctx context.Context, idleBefore time.Time, limit int) ([]*entity.Conversation, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	model, err := r.conversationModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	convTable, msgTable := (entity.Conversation{}).TableName(), (entity.Message{}).TableName()
+	var list []*entity.Conversation
+	if err := model.Find(ctx, &list,
+		orm.WithWhere("deleted_at IS NULL AND last_message_at IS NOT NULL AND last_message_at < ?", idleBefore),
+		orm.WithWhere("EXISTS (SELECT 1 FROM "+msgTable+" m WHERE m.conversation_id = "+convTable+".id AND m.id > "+convTable+".memory_message_id AND m.deleted_at IS NULL)"),
+		orm.WithOrderBy("last_message_at", false),
+		orm.WithLimit(limit),
+	); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询待提取记忆的会话失败")
+	}
+	return list, nil
+}
+
+func (r *conversationRepoImpl) UpdateMemoryCursor(ctx context.Context, conversationID, lastMessageID int64) error {
+	model, err := r.conversationModel.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	if err := model.UpdateValues(ctx, map[string]any{
+		"memory_message_id": lastMessageID,
+	}, orm.WithWhere("id = ?", conversationID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新会话记忆游标失败")
 	}
 	return nil
 }
+
+func (r *conversationRepoImpl) SetTitle(ctx context.Context, conversationID int64, title string, onlyIfEmpty bool) (bool, error) {
+	model, err := r.conversationModel.model(r.orm)
+	if err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	opts := []orm.QueryOption{orm.WithWhere("id = ? AND deleted_at IS NULL", conversationID)}
+	if onlyIfEmpty {
+		// 避免覆盖用户在生成期间手动设置的标题
+		opts = append(opts, orm.WithWhere("(title = '' OR title IS NULL)"))
+		count, err := model.Count(ctx, opts...)
+		if err != nil {
+			return false, errorx.Wrap(err, errorx.Database, "查询会话标题失败")
+		}
+		if count == 0 {
+			return false, nil
+		}
+	}
+	if err := model.UpdateValues(ctx, map[string]any{"title": title}, opts...); err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "更新会话标题失败")
+	}
+	return true, nil
+}
+
+func (r *conversationRepoImpl) SetSettings(ctx context.Context, conversationID int64, settingsJSON string) error {
+	model, err := r.conversationModel.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	if err := model.UpdateValues(ctx, map[string]any{"settings_json": settingsJSON},
+		orm.WithWhere("id = ? AND deleted_at IS NULL", conversationID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新会话设置失败")
+	}
+	return nil
+}
+
+func (r *conversationRepoImpl) SetStatus(ctx context.Context, conversationID int64, status string) error {
+	model, err := r.conversationModel.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	if err := model.UpdateValues(ctx, map[string]any{"status": status},
+		orm.WithWhere("id = ? AND deleted_at IS NULL", conversationID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新会话状态失败")
+	}
+	return nil
+}
+
+func (r *conversationRepoImpl) SoftDelete(ctx context.Context, conversationID int64, now time.Time) error {
+	session, err := r.orm.Begin(ctx)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "开启删除会话事务失败")
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = session.Rollback()
+		}
+	}()
+
+	convModel, err := r.conversationModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	if err := convModel.UpdateValues(ctx, map[string]any{
+		"status":     entity.ConversationStatusDeleted,
+		"deleted_at": now,
+	}, orm.WithWhere("id = ? AND deleted_at IS NULL", conversationID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "删除会话失败")
+	}
+	msgModel, err := r.messageModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 message model 失败")
+	}
+	if err := msgModel.UpdateValues(ctx, map[string]any{"deleted_at": now},
+		orm.WithWhere("conversation_id = ? AND deleted_at IS NULL", conversationID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "删除会话消息失败")
+	}
+
+	if err := session.Commit(); err != nil {
+		return errorx.Wrap(err, errorx.Database, "提交删除会话事务失败")
+	}
+	committed = true
+	return nil
+}
+
+func (r *conversationRepoImpl) PurgeDeleted(ctx context.Context, before time.Time, limit int) (int64, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	convModel, err := r.conversationModel.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	var ids []int64
+	if err := convModel.Find(ctx, &ids,
+		orm.WithSelect("id"),
+		orm.WithWhere("deleted_at IS NOT NULL AND deleted_at < ?", before),
+		orm.WithOrderBy("id", false),
+		orm.WithLimit(limit),
+	); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "查询待清理会话失败")
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	session, err := r.orm.Begin(ctx)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "开启清理会话事务失败")
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = session.Rollback()
+		}
+	}()
+
+	if err := r.purgeConversations(ctx, session, ids); err != nil {
+		return 0, err
+	}
+
+	if err := session.Commit(); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "提交清理会话事务失败")
+	}
+	committed = true
+	return int64(len(ids)), nil
+}
+
+// purgeConversations 在事务中物理删除会话及其消息、附件、授权、已读进度、分享、故事状态记录、消息反馈与内置向量索引
+func (r *conversationRepoImpl) purgeConversations(ctx context.Context, session orm.IOrm, ids []int64) error {
+	msgModel, err := r.messageModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 message model 失败")
+	}
+	if err := msgModel.Delete(ctx, orm.WithWhere("conversation_id IN ?", ids)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "清理会话消息失败")
+	}
+	accessModel, err := r.accessModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 conversation access model 失败")
+	}
+	if err := accessModel.Delete(ctx, orm.WithWhere("conversation_id IN ?", ids)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "清理会话授权失败")
+	}
+	shareModel, err := r.shareModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建会话分享 model 失败")
+	}
+	if err := shareModel.Delete(ctx, orm.WithWhere("conversation_id IN ?", ids)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "清理会话分享失败")
+	}
+	storyModel, err := r.storyModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建故事状态记录 model 失败")
+	}
+	if err := storyModel.Delete(ctx, orm.WithWhere("conversation_id IN ?", ids)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "清理故事状态记录失败")
+	}
+	feedbackModel, err := r.feedbackModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建消息反馈 model 失败")
+	}
+	if err := feedbackModel.Delete(ctx, orm.WithWhere("conversation_id IN ?", ids)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "清理消息反馈失败")
+	}
+	readModel, err := r.readModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建会话已读 model 失败")
+	}
+	if err := readModel.Delete(ctx, orm.WithWhere("conversation_id IN ?", ids)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "清理会话已读进度失败")
+	}
+	attachmentModel, err := r.attachmentModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建消息附件 model 失败")
+	}
+	if err := attachmentModel.Delete(ctx, orm.WithWhere("conversation_id IN ?", ids)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "清理消息附件失败")
+	}
+	embeddingModel, err := r.embeddingModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建消息向量 model 失败")
+	}
+	if err := embeddingModel.Delete(ctx, orm.WithWhere("conversation_id IN ?", ids)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "清理消息向量失败")
+	}
+	convModel, err := r.conversationModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	if err := convModel.Delete(ctx, orm.WithWhere("id IN ?", ids)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "清理会话失败")
+	}
+	return nil
+}
+
+// likeEscaper 转义 LIKE 通配符，配合 ESCAPE '\\' 使用
+var likeEscaper = strings.NewReplacer(`\\`, `\\\\`, `%`, `\\%`, `_`, `\\_`)
+
+func (r *conversationRepoImpl) SearchMessages(ctx context.Context, userID, conversationID int64, terms []string, limit int) ([]*entity.Message, error) {
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	model, err := r.messageModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 message model 失败")
+	}
+	opts := []orm.QueryOption{
+		orm.WithWhere("deleted_at IS NULL"),
+		orm.WithWhere("conversation_id IN (SELECT id FROM "+(entity.Conversation{}).TableName()+" WHERE user_id = ? AND deleted_at IS NULL)", userID),
+	}
+	if conversationID > 0 {
+		opts = append(opts, orm.WithWhere("conversation_id = ?", conversationID))
+	}
+	for _, term := range terms {
+		opts = append(opts, orm.WithWhere(`content LIKE ? ESCAPE '\\'`, "%"+likeEscaper.Replace(term)+"%"))
+	}
+	opts = append(opts, orm.WithOrderBy("id", true), orm.WithLimit(limit))
+	var messages []*entity.Message
+	if err := model.Find(ctx, &messages, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "检索消息失败")
+	}
+	return messages, nil
+}
+
+func (r *conversationRepoImpl) GetAccess(ctx context.Context, conversationID, userID int64) (*entity.ConversationAccess, error) {
+	model, err := r.accessModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 conversation access model 失败")
+	}
+	var access entity.ConversationAccess
+	if err := model.First(ctx, &access, orm.WithWhere("conversation_id = ? AND user_id = ?", conversationID, userID)); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, nil
+		}
+		return nil, errorx.Wrap(err, errorx.Database, "查询会话授权失败")
+	}
+	return &access, nil
+}
+
+func (r *conversationRepoImpl) ListAccess(ctx context.Context, conversationID int64) ([]*entity.ConversationAccess, error) {
+	model, err := r.accessModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 conversation access model 失败")
+	}
+	var list []*entity.ConversationAccess
+	if err := model.Find(ctx, &list,
+		orm.WithWhere("conversation_id = ?", conversationID),
+		orm.WithOrderBy("id", false),
+	); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询会话授权列表失败")
+	}
+	return list, nil
+}
+
+func (r *conversationRepoImpl) SaveAccess(ctx context.Context, access *entity.ConversationAccess) error {
+	if access == nil {
+		return errorx.New(errorx.InvalidInput, "会话授权不能为空")
+	}
+	existing, err := r.GetAccess(ctx, access.ConversationID, access.UserID)
+	if err != nil {
+		return err
+	}
+	model, err := r.accessModel.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 conversation access model 失败")
+	}
+	if existing == nil {
+		if err := model.Create(ctx, access); err != nil {
+			return errorx.Wrap(err, errorx.Database, "保存会话授权失败")
+		}
+		return nil
+	}
+	access.ID = existing.ID
+	if err := model.UpdateValues(ctx, map[string]any{"role": access.Role, "granted_by": access.GrantedBy},
+		orm.WithWhere("id = ?", existing.ID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新会话授权失败")
+	}
+	return nil
+}
+
+func (r *conversationRepoImpl) DeleteAccess(ctx context.Context, conversationID, userID int64) error {
+	model, err := r.accessModel.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 conversation access model 失败")
+	}
+	if err := model.Delete(ctx, orm.WithWhere("conversation_id = ? AND user_id = ?", conversationID, userID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "撤销会话授权失败")
+	}
+	readModel, err := r.readModel.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建会话已读 model 失败")
+	}
+	if err := readModel.Delete(ctx, orm.WithWhere("conversation_id = ? AND user_id = ?", conversationID, userID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "清理会话已读进度失败")
+	}
+	return nil
+}
+
+func (r *conversationRepoImpl) CreateShare(ctx context.Context, share *entity.ConversationShare) error {
+	model, err := r.shareModel.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建会话分享 model 失败")
+	}
+	if err := model.Create(ctx, share); err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建会话分享失败")
+	}
+	return nil
+}
+
+func (r *conversationRepoImpl) GetShareByToken(ctx context.Context, token string) (*entity.ConversationShare, error) {
+	model, err := r.shareModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建会话分享 model 失败")
+	}
+	var share entity.ConversationShare
+	if err := model.First(ctx, &share, orm.WithWhere("token = ?", token)); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, nil
+		}
+		return nil, errorx.Wrap(err, errorx.Database, "查询会话分享失败")
+	}
+	return &share, nil
+}
+
+func (r *conversationRepoImpl) ListShares(ctx context.Context, conversationID int64) ([]*entity.ConversationShare, error) {
+	model, err := r.shareModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建会话分享 model 失败")
+	}
+	var list []*entity.ConversationShare
+	if err := model.Find(ctx, &list,
+		orm.WithSelect("id", "token", "conversation_id", "user_id", "message_count", "expires_at", "revoked_at", "created_at"),
+		orm.WithWhere("conversation_id = ?", conversationID),
+		orm.WithOrderBy("id", true),
+	); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询会话分享列表失败")
+	}
+	return list, nil
+}
+
+func (r *conversationRepoImpl) RevokeShare(ctx context.Context, conversationID, shareID int64, at time.Time) (bool, error) {
+	model, err := r.shareModel.model(r.orm)
+	if err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "创建会话分享 model 失败")
+	}
+	where := orm.WithWhere("id = ? AND conversation_id = ? AND revoked_at IS NULL", shareID, conversationID)
+	count, err := model.Count(ctx, where)
+	if err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "查询会话分享失败")
+	}
+	if count == 0 {
+		return false, nil
+	}
+	if err := model.UpdateValues(ctx, map[string]any{"revoked_at": at}, where); err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "撤销会话分享失败")
+	}
+	return true, nil
+}
+
+func (r *conversationRepoImpl) ApplyStoryState(ctx context.Context, conversationID, expectedSeq int64, stateJSON string, change *entity.StoryStateChange) error {
+	session, err := r.orm.Begin(ctx)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "开启故事状态事务失败")
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = session.Rollback()
+		}
+	}()
+
+	convModel, err := r.conversationModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	var conv entity.Conversation
+	if err := convModel.First(ctx, &conv,
+		orm.WithWhere("id = ? AND deleted_at IS NULL", conversationID),
+		orm.WithForUpdate(),
+	); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return errorx.New(errorx.NotFound, "会话不存在")
+		}
+		return errorx.Wrap(err, errorx.Database, "锁定会话失败")
+	}
+	if conv.StoryStateSeq != expectedSeq {
+		return errorx.New(errorx.Validation, "故事状态已被其他请求更新，请刷新后重试")
+	}
+	seq := expectedSeq + 1
+	if err := convModel.UpdateValues(ctx, map[string]any{
+		"story_state_json": stateJSON,
+		"story_state_seq":  seq,
+	}, orm.WithWhere("id = ?", conversationID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新故事状态失败")
+	}
+
+	storyModel, err := r.storyModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建故事状态记录 model 失败")
+	}
+	change.ConversationID = conversationID
+	change.Seq = seq
+	change.FromStateJSON = conv.StoryStateJSON
+	change.ToStateJSON = stateJSON
+	if err := storyModel.Create(ctx, change); err != nil {
+		return errorx.Wrap(err, errorx.Database, "写入故事状态记录失败")
+	}
+
+	if err := session.Commit(); err != nil {
+		return errorx.Wrap(err, errorx.Database, "提交故事状态事务失败")
+	}
+	committed = true
+	return nil
+}
+
+func (r *conversationRepoImpl) ListStoryStateChanges(ctx context.Context, conversationID, beforeSeq int64, limit int) ([]*entity.StoryStateChange, error) {
+	model, err := r.storyModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建故事状态记录 model 失败")
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	opts := []orm.QueryOption{orm.WithWhere("conversation_id = ?", conversationID)}
+	if beforeSeq > 0 {
+		opts = append(opts, orm.WithWhere("seq < ?", beforeSeq))
+	}
+	opts = append(opts, orm.WithOrderBy("seq", true), orm.WithLimit(limit))
+	var list []*entity.StoryStateChange
+	if err := model.Find(ctx, &list, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询故事状态记录失败")
+	}
+	return list, nil
+}
+
+func (r *conversationRepoImpl) SaveFeedback(ctx context.Context, feedback *entity.MessageFeedback) (*entity.MessageFeedback, error) {
+	session, err := r.orm.Begin(ctx)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "开启消息反馈事务失败")
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = session.Rollback()
+		}
+	}()
+
+	model, err := r.feedbackModel.model(session)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建消息反馈 model 失败")
+	}
+	var previous *entity.MessageFeedback
+	var existing entity.MessageFeedback
+	err = model.First(ctx, &existing,
+		orm.WithWhere("message_id = ? AND user_id = ?", feedback.MessageID, feedback.UserID),
+		orm.WithForUpdate(),
+	)
+	switch {
+	case err == nil:
+		previous = &existing
+		feedback.ID = existing.ID
+		feedback.CreatedAt = existing.CreatedAt
+		if err := model.UpdateValues(ctx, map[string]any{
+			"rating":     feedback.Rating,
+			"comment":    feedback.Comment,
+			"updated_at": time.Now(),
+		}, orm.WithWhere("id = ?", existing.ID)); err != nil {
+			return nil, errorx.Wrap(err, errorx.Database, "更新消息反馈失败")
+		}
+	case errorx.Is(err, errorx.NotFound):
+		if err := model.Create(ctx, feedback); err != nil {
+			return nil, errorx.Wrap(err, errorx.Database, "保存消息反馈失败")
+		}
+	default:
+		return nil, errorx.Wrap(err, errorx.Database, "查询消息反馈失败")
+	}
+
+	if err := session.Commit(); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "提交消息反馈事务失败")
+	}
+	committed = true
+	return previous, nil
+}
+
+func (r *conversationRepoImpl) GetFeedback(ctx context.Context, messageID, userID int64) (*entity.MessageFeedback, error) {
+	model, err := r.feedbackModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建消息反馈 model 失败")
+	}
+	var feedback entity.MessageFeedback
+	if err := model.First(ctx, &feedback, orm.WithWhere("message_id = ? AND user_id = ?", messageID, userID)); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, nil
+		}
+		return nil, errorx.Wrap(err, errorx.Database, "查询消息反馈失败")
+	}
+	return &feedback, nil
+}
+
+func (r *conversationRepoImpl) EraseUser(ctx context.Context, userID int64) (int64, int64, error) {
+	if userID <= 0 {
+		return 0, 0, errorx.New(errorx.InvalidInput, "userID 无效")
+	}
+	var conversations int64
+	for {
+		n, err := r.purgeOwned(ctx, userID, 100)
+		if err != nil {
+			return conversations, 0, err
+		}
+		conversations += n
+		if n < 100 {
+			break
+		}
+	}
+
+	session, err := r.orm.Begin(ctx)
+	if err != nil {
+		return conversations, 0, errorx.Wrap(err, errorx.Database, "开启用户数据删除事务失败")
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = session.Rollback()
+		}
+	}()
+
+	const sentBy = "message_id IN (SELECT id FROM llm_messages WHERE sender_user_id = ?)"
+	attachmentModel, err := r.attachmentModel.model(session)
+	if err != nil {
+		return conversations, 0, errorx.Wrap(err, errorx.Database, "创建消息附件 model 失败")
+	}
+	if err := attachmentModel.Delete(ctx, orm.WithWhere(sentBy, userID)); err != nil {
+		return conversations, 0, errorx.Wrap(err, errorx.Database, "删除用户消息附件失败")
+	}
+	embeddingModel, err := r.embeddingModel.model(session)
+	if err != nil {
+		return conversations, 0, errorx.Wrap(err, errorx.Database, "创建消息向量 model 失败")
+	}
+	if err := embeddingModel.Delete(ctx, orm.WithWhere(sentBy, userID)); err != nil {
+		return conversations, 0, errorx.Wrap(err, errorx.Database, "删除用户消息向量失败")
+	}
+	// 其他用户会话中的分享快照与滚动摘要可能包含该用户的消息原文：删除分享，清空摘要待下次刷新时基于匿名化后的消息重新生成
+	const sentIn = "IN (SELECT conversation_id FROM llm_messages WHERE sender_user_id = ?)"
+	shareModel, err := r.shareModel.model(session)
+	if err != nil {
+		return conversations, 0, errorx.Wrap(err, errorx.Database, "创建会话分享 model 失败")
+	}
+	if err := shareModel.Delete(ctx, orm.WithWhere("user_id = ? OR conversation_id "+sentIn, userID, userID)); err != nil {
+		return conversations, 0, errorx.Wrap(err, errorx.Database, "删除含用户消息的会话分享失败")
+	}
+	convModel, err := r.conversationModel.model(session)
+	if err != nil {
+		return conversations, 0, errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	if err := convModel.UpdateValues(ctx, map[string]any{
+		"summary":            "",
+		"summary_message_id": 0,
+		"summary_at":         nil,
+	}, orm.WithWhere("id "+sentIn, userID)); err != nil {
+		return conversations, 0, errorx.Wrap(err, errorx.Database, "清空含用户消息的会话摘要失败")
+	}
+
+	msgModel, err := r.messageModel.model(session)
+	if err != nil {
+		return conversations, 0, errorx.Wrap(err, errorx.Database, "创建 message model 失败")
+	}
+	messages, err := msgModel.Count(ctx, orm.WithWhere("sender_user_id = ?", userID))
+	if err != nil {
+		return conversations, 0, errorx.Wrap(err, errorx.Database, "统计用户消息失败")
+	}
+	if messages > 0 {
+		if err := msgModel.UpdateValues(ctx, map[string]any{
+			"content":        entity.ErasedMessageContent,
+			"metadata_json":  "",
+			"sender_user_id": 0,
+		}, orm.WithWhere("sender_user_id = ?", userID)); err != nil {
+			return conversations, 0, errorx.Wrap(err, errorx.Database, "匿名化用户消息失败")
+		}
+	}
+
+	for _, m := range []struct {
+		model ormModel
+		name  string
+	}{
+		{r.accessModel, "会话授权"},
+		{r.readModel, "会话已读进度"},
+		{r.feedbackModel, "消息反馈"},
+	} {
+		model, err := m.model.model(session)
+		if err != nil {
+			return conversations, 0, errorx.Wrap(err, errorx.Database, "创建"+m.name+" model 失败")
+		}
+		if err := model.Delete(ctx, orm.WithWhere("user_id = ?", userID)); err != nil {
+			return conversations, 0, errorx.Wrap(err, errorx.Database, "删除用户"+m.name+"失败")
+		}
+	}
+	storyModel, err := r.storyModel.model(session)
+	if err != nil {
+		return conversations, 0, errorx.Wrap(err, errorx.Database, "创建故事状态记录 model 失败")
+	}
+	if err := storyModel.UpdateValues(ctx, map[string]any{"actor_id": 0, "reason": ""},
+		orm.WithWhere("actor_id = ?", userID)); err != nil {
+		return conversations, 0, errorx.Wrap(err, errorx.Database, "匿名化故事状态记录失败")
+	}
+
+	if err := session.Commit(); err != nil {
+		return conversations, 0, errorx.Wrap(err, errorx.Database, "提交用户数据删除事务失败")
+	}
+	committed = true
+	return conversations, messages, nil
+}
+
+// purgeOwned 物理删除用户拥有的一批会话（不区分状态），返回删除数
+func (r *conversationRepoImpl) purgeOwned(ctx context.Context, userID int64, limit int) (int64, error) {
+	convModel, err := r.conversationModel.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建 conversation model 失败")
+	}
+	var ids []int64
+	if err := convModel.Find(ctx, &ids,
+		orm.WithSelect("id"),
+		orm.WithWhere("user_id = ?", userID),
+		orm.WithOrderBy("id", false),
+		orm.WithLimit(limit),
+	); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "查询用户会话失败")
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	session, err := r.orm.Begin(ctx)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "开启删除用户会话事务失败")
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = session.Rollback()
+		}
+	}()
+	if err := r.purgeConversations(ctx, session, ids); err != nil {
+		return 0, err
+	}
+	if err := session.Commit(); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "提交删除用户会话事务失败")
+	}
+	committed = true
+	return int64(len(ids)), nil
+}
@@ -0,0 +1,78 @@
+package repo
+
+import (
+	"context"
+
+	"gochen-llm/entity"
+	"gochen/db/orm"
+	"gochen/errorx"
+)
+
+// CostDigestRepo 管理成本日报
+type CostDigestRepo interface {
+	// GetByDay 按日期读取日报，不存在时返回 nil
+	GetByDay(ctx context.Context, day string) (*entity.CostDigest, error)
+	// List 按日期倒序返回最近 limit 份日报
+	List(ctx context.Context, limit int) ([]*entity.CostDigest, error)
+	// Save ID 为 0 时新增，否则按 ID 覆盖
+	Save(ctx context.Context, d *entity.CostDigest) error
+}
+
+type costDigestRepoImpl struct {
+	orm   orm.IOrm
+	model ormModel
+}
+
+func NewCostDigestRepo(o orm.IOrm) CostDigestRepo {
+	return &costDigestRepoImpl{
+		orm:   o,
+		model: newOrmModel(&entity.CostDigest{}, (entity.CostDigest{}).TableName()),
+	}
+}
+
+func (r *costDigestRepoImpl) GetByDay(ctx context.Context, day string) (*entity.CostDigest, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建成本日报 model 失败")
+	}
+	var d entity.CostDigest
+	if err := model.First(ctx, &d, orm.WithWhere("day = ?", day)); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, nil
+		}
+		return nil, errorx.Wrap(err, errorx.Database, "查询成本日报失败")
+	}
+	return &d, nil
+}
+
+func (r *costDigestRepoImpl) List(ctx context.Context, limit int) ([]*entity.CostDigest, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建成本日报 model 失败")
+	}
+	var list []*entity.CostDigest
+	if err := model.Find(ctx, &list, orm.WithOrderBy("day", true), orm.WithLimit(limit)); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询成本日报失败")
+	}
+	return list, nil
+}
+
+func (r *costDigestRepoImpl) Save(ctx context.Context, d *entity.CostDigest) error {
+	if d == nil {
+		return errorx.New(errorx.InvalidInput, "成本日报不能为空")
+	}
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建成本日报 model 失败")
+	}
+	if d.ID == 0 {
+		if err := model.Create(ctx, d); err != nil {
+			return errorx.Wrap(err, errorx.Database, "创建成本日报失败")
+		}
+		return nil
+	}
+	if err := model.Save(ctx, d, orm.WithWhere("id = ?", d.ID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新成本日报失败")
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package repo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+
+	"gochen/errorx"
+)
+
+// FieldCipher 敏感文本字段的加解密（如审计日志的请求/响应正文）
+type FieldCipher interface {
+	Encrypt(plain string) (string, error)
+	// Decrypt 对未加密的历史数据原样返回
+	Decrypt(stored string) (string, error)
+}
+
+// encryptedFieldPrefix 密文前缀，用于区分加密前写入的明文数据
+const encryptedFieldPrefix = "enc:v1:"
+
+type aesFieldCipher struct {
+	aead cipher.AEAD
+}
+
+// NewAESFieldCipher 基于 AES-GCM 的字段加密，key 长度需为 16/24/32 字节；
+// 密文格式为 enc:v1:base64(nonce|ciphertext)
+func NewAESFieldCipher(key []byte) (FieldCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.InvalidInput, "字段加密密钥无效")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "初始化字段加密失败")
+	}
+	return &aesFieldCipher{aead: aead}, nil
+}
+
+func (c *aesFieldCipher) Encrypt(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", errorx.Wrap(err, errorx.Internal, "生成加密随机数失败")
+	}
+	sealed := c.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return encryptedFieldPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *aesFieldCipher) Decrypt(stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedFieldPrefix) {
+		return stored, nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedFieldPrefix))
+	if err != nil || len(raw) < c.aead.NonceSize() {
+		return "", errorx.New(errorx.Internal, "密文格式无效")
+	}
+	nonce, sealed := raw[:c.aead.NonceSize()], raw[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", errorx.Wrap(err, errorx.Internal, "解密字段失败")
+	}
+	return string(plain), nil
+}
@@ -0,0 +1,93 @@
+package repo
+
+import (
+	"context"
+
+	"gochen-llm/entity"
+	"gochen/db/orm"
+	"gochen/errorx"
+)
+
+// MessageEmbeddingRepo 持久化消息向量（内置向量存储）
+type MessageEmbeddingRepo interface {
+	// Save 新增或覆盖同一消息的向量
+	Save(ctx context.Context, e *entity.MessageEmbedding) error
+	// ListCandidates 返回用户（conversationID>0 时限定会话）指定模型的最近 limit 条向量，供近邻计算
+	ListCandidates(ctx context.Context, userID, conversationID int64, model string, limit int) ([]*entity.MessageEmbedding, error)
+	// IndexedMessageIDs 返回会话中已建立指定模型向量的消息 ID
+	IndexedMessageIDs(ctx context.Context, conversationID int64, model string) (map[int64]bool, error)
+}
+
+type messageEmbeddingRepoImpl struct {
+	orm   orm.IOrm
+	model ormModel
+}
+
+func NewMessageEmbeddingRepo(o orm.IOrm) MessageEmbeddingRepo {
+	return &messageEmbeddingRepoImpl{
+		orm:   o,
+		model: newOrmModel(&entity.MessageEmbedding{}, (entity.MessageEmbedding{}).TableName()),
+	}
+}
+
+func (r *messageEmbeddingRepoImpl) Save(ctx context.Context, e *entity.MessageEmbedding) error {
+	if e == nil || e.MessageID <= 0 {
+		return errorx.New(errorx.InvalidInput, "消息向量无效")
+	}
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建消息向量 model 失败")
+	}
+	var existing entity.MessageEmbedding
+	if err := model.First(ctx, &existing, orm.WithWhere("message_id = ?", e.MessageID)); err != nil {
+		if !errorx.Is(err, errorx.NotFound) {
+			return errorx.Wrap(err, errorx.Database, "查询消息向量失败")
+		}
+		if err := model.Create(ctx, e); err != nil {
+			return errorx.Wrap(err, errorx.Database, "保存消息向量失败")
+		}
+		return nil
+	}
+	e.ID = existing.ID
+	e.CreatedAt = existing.CreatedAt
+	if err := model.Save(ctx, e); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新消息向量失败")
+	}
+	return nil
+}
+
+func (r *messageEmbeddingRepoImpl) ListCandidates(ctx context.Context, userID, conversationID int64, embeddingModel string, limit int) ([]*entity.MessageEmbedding, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建消息向量 model 失败")
+	}
+	opts := []orm.QueryOption{orm.WithWhere("user_id = ? AND model = ?", userID, embeddingModel)}
+	if conversationID > 0 {
+		opts = append(opts, orm.WithWhere("conversation_id = ?", conversationID))
+	}
+	opts = append(opts, orm.WithOrderBy("message_id", true), orm.WithLimit(limit))
+	var list []*entity.MessageEmbedding
+	if err := model.Find(ctx, &list, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询消息向量失败")
+	}
+	return list, nil
+}
+
+func (r *messageEmbeddingRepoImpl) IndexedMessageIDs(ctx context.Context, conversationID int64, embeddingModel string) (map[int64]bool, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建消息向量 model 失败")
+	}
+	var list []*entity.MessageEmbedding
+	if err := model.Find(ctx, &list,
+		orm.WithWhere("conversation_id = ? AND model = ?", conversationID, embeddingModel),
+		orm.WithSelect("message_id"),
+	); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询消息向量失败")
+	}
+	ids := make(map[int64]bool, len(list))
+	for _, e := range list {
+		ids[e.MessageID] = true
+	}
+	return ids, nil
+}
@@ -0,0 +1,198 @@
+package repo
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"gochen-llm/entity"
+	"gochen/db/orm"
+	"gochen/errorx"
+)
+
+// 连续指标显著性分析支持的指标
+const (
+	SignificanceMetricLatency = "latency"
+	SignificanceMetricTokens  = "tokens"
+	SignificanceMetricRating  = "rating"
+	SignificanceMetricScore   = "score"
+)
+
+const (
+	// maxContinuousSamples 每个变体参与检验的样本上限
+	maxContinuousSamples = 20000
+	// maxContinuousScan 单次分析最多扫描的记录数
+	maxContinuousScan   = 200000
+	continuousBatchSize = 1000
+)
+
+func (r *metricsRepoImpl) SignificanceContinuous(ctx context.Context, filter entity.MetricsFilter, metric string) (*entity.ContinuousSignificanceReport, error) {
+	if filter.ABTestID == nil {
+		return nil, errorx.New(errorx.InvalidInput, "ab_test_id 不能为空")
+	}
+
+	var (
+		source ormModel
+		column string
+		opts   []orm.QueryOption
+	)
+	switch metric {
+	case SignificanceMetricLatency, SignificanceMetricTokens, SignificanceMetricScore:
+		source = r.model
+		f := filter
+		f.ABVariant = ""
+		f.Outcome = ""
+		f.Status = "ok"
+		column = "latency_ms"
+		if metric == SignificanceMetricTokens {
+			column = "total_tokens"
+		}
+		if metric == SignificanceMetricScore {
+			f.Status = "eval"
+			column = "score"
+		}
+		opts = buildMetricsOptions(f)
+		// 复用结果的调用未实际请求 provider，时延与 token 不具可比性
+		opts = append(opts, orm.WithWhere("cache_hit = ?", false))
+	case SignificanceMetricRating:
+		source = r.feedbackModel
+		column = "rating"
+		opts = []orm.QueryOption{
+			orm.WithWhere("ab_test_id = ?", *filter.ABTestID),
+			orm.WithWhere("rating <> ?", entity.FeedbackNeutral),
+		}
+		if filter.Provider != "" {
+			opts = append(opts, orm.WithWhere("provider = ?", filter.Provider))
+		}
+		if filter.Model != "" {
+			opts = append(opts, orm.WithWhere("model = ?", filter.Model))
+		}
+		if filter.StartAt != nil {
+			opts = append(opts, orm.WithWhere("created_at >= ?", *filter.StartAt))
+		}
+		if filter.EndAt != nil {
+			opts = append(opts, orm.WithWhere("created_at <= ?", *filter.EndAt))
+		}
+	default:
+		return nil, errorx.New(errorx.InvalidInput, "metric 仅支持 latency/tokens/rating/score")
+	}
+
+	samples, truncated, err := r.loadContinuousSamples(ctx, source, column, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &entity.ContinuousSignificanceReport{
+		ABTestID:  *filter.ABTestID,
+		Metric:    metric,
+		Variants:  []*entity.ContinuousVariantStats{},
+		Truncated: truncated,
+	}
+	keys := make([]string, 0, len(samples))
+	for k := range samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		report.Variants = append(report.Variants, continuousStats(k, samples[k]))
+	}
+	if len(keys) < 2 {
+		report.Note = "样本不足，无法计算显著性"
+		return report, nil
+	}
+
+	var tValues, mwValues []float64
+	for i := 0; i < len(keys); i++ {
+		for j := i + 1; j < len(keys); j++ {
+			base, other := samples[keys[i]], samples[keys[j]]
+			t, tp := welchTTest(base, other)
+			u, mwp := mannWhitneyU(base, other)
+			report.Pairwise = append(report.Pairwise, &entity.ContinuousComparison{
+				Base:     keys[i],
+				Variant:  keys[j],
+				Diff:     report.Variants[j].Mean - report.Variants[i].Mean,
+				TStat:    t,
+				TPValue:  tp,
+				UStat:    u,
+				MWPValue: mwp,
+			})
+			tValues = append(tValues, tp)
+			mwValues = append(mwValues, mwp)
+		}
+	}
+	tAdjusted, mwAdjusted := holmAdjust(tValues), holmAdjust(mwValues)
+	for i, c := range report.Pairwise {
+		c.TAdjustedPValue = tAdjusted[i]
+		c.MWAdjustedPValue = mwAdjusted[i]
+		c.Significant = c.TAdjustedPValue < pairwiseAlpha && c.MWAdjustedPValue < pairwiseAlpha
+	}
+	return report, nil
+}
+
+// loadContinuousSamples 按 ID 倒序分批读取各变体的指标值，优先保留最近的样本；
+// 任一变体超过样本上限或扫描超过上限时 truncated 为 true
+func (r *metricsRepoImpl) loadContinuousSamples(ctx context.Context, source ormModel, column string, opts []orm.QueryOption) (map[string][]float64, bool, error) {
+	model, err := source.model(r.orm)
+	if err != nil {
+		return nil, false, errorx.Wrap(err, errorx.Database, "创建 model 失败")
+	}
+	type row struct {
+		ID      int64
+		Variant string
+		Value   float64
+	}
+	samples := map[string][]float64{}
+	truncated := false
+	var lastID int64
+	for scanned := 0; scanned < maxContinuousScan; {
+		batchOpts := append(append([]orm.QueryOption{}, opts...),
+			orm.WithSelect("id", "ab_variant as variant", column+" as value"),
+			orm.WithOrderBy("id", true),
+			orm.WithLimit(continuousBatchSize),
+		)
+		if lastID > 0 {
+			batchOpts = append(batchOpts, orm.WithWhere("id < ?", lastID))
+		}
+		var rows []row
+		if err := model.Find(ctx, &rows, batchOpts...); err != nil {
+			return nil, false, errorx.Wrap(err, errorx.Database, "读取 A/B 指标样本失败")
+		}
+		for _, rw := range rows {
+			if rw.Variant == "" {
+				continue
+			}
+			if len(samples[rw.Variant]) >= maxContinuousSamples {
+				truncated = true
+				continue
+			}
+			samples[rw.Variant] = append(samples[rw.Variant], rw.Value)
+		}
+		scanned += len(rows)
+		if len(rows) < continuousBatchSize {
+			return samples, truncated, nil
+		}
+		lastID = rows[len(rows)-1].ID
+	}
+	return samples, true, nil
+}
+
+func continuousStats(variant string, xs []float64) *entity.ContinuousVariantStats {
+	mean, variance := meanVariance(xs)
+	stats := &entity.ContinuousVariantStats{
+		Variant: variant,
+		Count:   len(xs),
+		Mean:    mean,
+		StdDev:  math.Sqrt(variance),
+	}
+	if len(xs) > 0 {
+		sorted := append([]float64(nil), xs...)
+		sort.Float64s(sorted)
+		mid := len(sorted) / 2
+		if len(sorted)%2 == 1 {
+			stats.Median = sorted[mid]
+		} else {
+			stats.Median = (sorted[mid-1] + sorted[mid]) / 2
+		}
+	}
+	return stats
+}
@@ -0,0 +1,178 @@
+package repo
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	"gochen-llm/entity"
+	"gochen/db/orm"
+	"gochen/errorx"
+)
+
+// 漏斗的分组方式
+const (
+	FunnelGroupByTemplate = "prompt_template"
+	FunnelGroupByVariant  = "variant"
+)
+
+func (r *metricsRepoImpl) AggregateFunnel(ctx context.Context, filter entity.MetricsFilter, groupBy string) ([]*entity.FunnelReport, error) {
+	var metricsCol, feedbackCol string
+	switch groupBy {
+	case "", FunnelGroupByTemplate:
+		groupBy = FunnelGroupByTemplate
+		metricsCol, feedbackCol = "prompt_template", "prompt_template_id"
+	case FunnelGroupByVariant:
+		if filter.ABTestID == nil {
+			return nil, errorx.New(errorx.InvalidInput, "按变体分组时 ab_test_id 不能为空")
+		}
+		metricsCol, feedbackCol = "ab_variant", "ab_variant"
+	default:
+		return nil, errorx.New(errorx.InvalidInput, "group_by 仅支持 prompt_template/variant")
+	}
+
+	base := filter
+	base.Status = ""
+	base.Outcome = ""
+	exposureOpts := append(buildMetricsOptions(base), orm.WithWhere("status IN ?", []string{"ok", "error"}))
+	exposures, err := r.countFunnelStage(ctx, r.model, metricsCol, exposureOpts, filter.CallBased)
+	if err != nil {
+		return nil, err
+	}
+	responseFilter := base
+	responseFilter.Status = "ok"
+	responses, err := r.countFunnelStage(ctx, r.model, metricsCol, buildMetricsOptions(responseFilter), filter.CallBased)
+	if err != nil {
+		return nil, err
+	}
+	conversionFilter := base
+	conversionFilter.Status = "converted"
+	conversionFilter.Outcome = filter.Outcome
+	conversions, err := r.countFunnelStage(ctx, r.model, metricsCol, buildMetricsOptions(conversionFilter), filter.CallBased)
+	if err != nil {
+		return nil, err
+	}
+	feedback, err := r.countFunnelStage(ctx, r.feedbackModel, feedbackCol, feedbackFunnelOptions(filter), filter.CallBased)
+	if err != nil {
+		return nil, err
+	}
+
+	unit := "user"
+	if filter.CallBased {
+		unit = "call"
+	}
+	keys := make([]string, 0, len(exposures))
+	for k := range exposures {
+		keys = append(keys, k)
+	}
+	// 按曝光倒序，相同时按分组值排序保证输出稳定
+	sort.Slice(keys, func(i, j int) bool {
+		if exposures[keys[i]] != exposures[keys[j]] {
+			return exposures[keys[i]] > exposures[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	result := make([]*entity.FunnelReport, 0, len(keys))
+	for _, k := range keys {
+		// 未使用模板的调用不构成模板漏斗
+		if groupBy == FunnelGroupByTemplate && k == "0" {
+			continue
+		}
+		report := &entity.FunnelReport{Unit: unit}
+		if groupBy == FunnelGroupByVariant {
+			report.Variant = k
+		} else {
+			report.PromptTemplateID, _ = strconv.ParseInt(k, 10, 64)
+		}
+		counts := []struct {
+			stage string
+			count int64
+		}{
+			{entity.FunnelStageExposure, exposures[k]},
+			{entity.FunnelStageResponse, responses[k]},
+			{entity.FunnelStageFeedback, feedback[k]},
+			{entity.FunnelStageConversion, conversions[k]},
+		}
+		top := counts[0].count
+		for i, c := range counts {
+			stage := &entity.FunnelStage{Stage: c.stage, Count: c.count, StepRate: 1}
+			if i > 0 {
+				stage.StepRate = 0
+				if prev := counts[i-1].count; prev > 0 {
+					stage.StepRate = float64(c.count) / float64(prev)
+				}
+			}
+			stage.DropOffRate = 1 - stage.StepRate
+			if top > 0 {
+				stage.OverallRate = float64(c.count) / float64(top)
+			}
+			report.Stages = append(report.Stages, stage)
+		}
+		result = append(result, report)
+	}
+	return result, nil
+}
+
+// countFunnelStage 按分组列统计某一阶段的用户数（callBased 时为记录数）；按用户计数时排除匿名记录
+func (r *metricsRepoImpl) countFunnelStage(ctx context.Context, source ormModel, column string, opts []orm.QueryOption, callBased bool) (map[string]int64, error) {
+	model, err := source.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 model 失败")
+	}
+	count := "COUNT(*) as count"
+	if !callBased {
+		count = "COUNT(DISTINCT user_id) as count"
+		opts = append(opts, orm.WithWhere("user_id > ?", 0))
+	}
+	type row struct {
+		GroupKey string
+		Count    int64
+	}
+	var rows []row
+	opts = append(opts, orm.WithSelect(column+" as group_key", count), orm.WithGroupBy(column))
+	if err := model.Find(ctx, &rows, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "统计漏斗阶段失败")
+	}
+	result := make(map[string]int64, len(rows))
+	for _, rw := range rows {
+		if rw.GroupKey == "" {
+			continue
+		}
+		result[rw.GroupKey] = rw.Count
+	}
+	return result, nil
+}
+
+// feedbackFunnelOptions 反馈阶段只应用反馈表具备的筛选条件
+func feedbackFunnelOptions(filter entity.MetricsFilter) []orm.QueryOption {
+	var opts []orm.QueryOption
+	if filter.Provider != "" {
+		opts = append(opts, orm.WithWhere("provider = ?", filter.Provider))
+	}
+	if filter.Model != "" {
+		opts = append(opts, orm.WithWhere("model = ?", filter.Model))
+	}
+	if filter.UserID != nil {
+		opts = append(opts, orm.WithWhere("user_id = ?", *filter.UserID))
+	}
+	if filter.ConversationID != nil {
+		opts = append(opts, orm.WithWhere("conversation_id = ?", *filter.ConversationID))
+	}
+	if filter.PromptTemplateID != nil {
+		opts = append(opts, orm.WithWhere("prompt_template_id = ?", *filter.PromptTemplateID))
+	}
+	if filter.ABTestID != nil {
+		opts = append(opts, orm.WithWhere("ab_test_id = ?", *filter.ABTestID))
+	}
+	if filter.ABVariant != "" {
+		opts = append(opts, orm.WithWhere("ab_variant = ?", filter.ABVariant))
+	}
+	if filter.StartAt != nil {
+		opts = append(opts, orm.WithWhere("created_at >= ?", *filter.StartAt))
+	}
+	if filter.EndAt != nil {
+		opts = append(opts, orm.WithWhere("created_at <= ?", *filter.EndAt))
+	}
+	return opts
+}
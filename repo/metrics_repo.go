@@ -2,7 +2,11 @@ package repo
 
 import (
 	"context"
+	"fmt"
 	"math"
+	"sort"
+	"sync"
+	"time"
 
 	"gochen-llm/entity"
 	"gochen/db/orm"
@@ -14,19 +18,66 @@ type MetricsRepo interface {
 	Save(ctx context.Context, m *entity.Metrics) error
 	Aggregate(ctx context.Context, filter entity.MetricsFilter) (*entity.MetricsReport, error)
 	AggregateByVariant(ctx context.Context, filter entity.MetricsFilter) ([]*entity.VariantMetricsReport, error)
+	// AggregateByModel 按 provider+model 分组汇总，按调用次数倒序
+	AggregateByModel(ctx context.Context, filter entity.MetricsFilter) ([]*entity.ModelMetricsReport, error)
+	// AggregateBy 按 provider/template/user/day 中的单一维度分组汇总；day 按日期正序，其余按调用次数倒序。
+	// 按模型、端点分组见 AggregateByModel、AggregateByEndpoint
+	AggregateBy(ctx context.Context, filter entity.MetricsFilter, groupBy string) ([]*entity.GroupMetricsReport, error)
+	// AggregateByEndpoint 按端点（含 provider+model）分组汇总，按调用次数倒序；用于对比同模型的不同端点
+	AggregateByEndpoint(ctx context.Context, filter entity.MetricsFilter) ([]*entity.ModelMetricsReport, error)
+	// AggregateCost 按 user/org/prompt_template/model/endpoint 分组汇总成本，按成本倒序返回前 top 组
+	AggregateCost(ctx context.Context, filter entity.MetricsFilter, groupBy string, top int) ([]*entity.CostBreakdown, error)
+	// AggregateTimeSeries 按小时或天分桶汇总 [StartAt, EndAt)，无数据的桶补零；
+	// 未指定时 EndAt 为当前时间，StartAt 按粒度回溯 24 小时或 30 天，桶数超过上限时报错
+	AggregateTimeSeries(ctx context.Context, filter entity.MetricsFilter, interval string) ([]*entity.MetricsBucket, error)
+	// AggregateFeedback 按 model（provider+model）或 prompt_template 分组统计消息反馈，并关联同维度的成功调用数计算反馈率；
+	// 反馈侧仅应用 Provider/Model/ABTestID/ABVariant/时间范围筛选
+	AggregateFeedback(ctx context.Context, filter entity.MetricsFilter, groupBy string) ([]*entity.FeedbackReport, error)
+	// AggregateFunnel 按提示词模板或 A/B 变体（需指定 ABTestID）统计 曝光 → 成功回复 → 反馈 → 转化 各阶段的
+	// 用户数（CallBased 时为记录数）与流失率，按曝光倒序；Outcome 仅作用于转化阶段
+	AggregateFunnel(ctx context.Context, filter entity.MetricsFilter, groupBy string) ([]*entity.FunnelReport, error)
 	List(ctx context.Context, filter entity.MetricsFilter, limit, offset int) ([]*entity.Metrics, int64, error)
+	// Latest 返回符合条件的最新一条指标，不存在时返回 nil
+	Latest(ctx context.Context, filter entity.MetricsFilter) (*entity.Metrics, error)
+	// Iterate 按 ID 倒序分批遍历符合条件的指标（基于 ID 游标，不使用 offset），fn 返回错误时终止
+	Iterate(ctx context.Context, filter entity.MetricsFilter, batchSize int, fn func(batch []*entity.Metrics) error) error
 	Significance(ctx context.Context, filter entity.MetricsFilter) (*entity.ABSignificanceReport, error)
+	// SignificanceContinuous 按变体比较连续指标（latency/tokens/score 取自调用指标，rating 取自消息反馈），
+	// 做 Welch t 检验与 Mann-Whitney U 检验；每个变体最多使用最近的 maxContinuousSamples 个样本
+	SignificanceContinuous(ctx context.Context, filter entity.MetricsFilter, metric string) (*entity.ContinuousSignificanceReport, error)
+	// UpdateCost 修改单条指标的成本，用于按修正后的价格表回填
+	UpdateCost(ctx context.Context, id int64, costUSD float64) error
+	// AnonymizeUser 将用户调用指标的用户 ID 与会话 ID 清零，保留用量与成本用于聚合统计，返回影响行数
+	AnonymizeUser(ctx context.Context, userID int64) (int64, error)
+	// SetSampler 设置写入采样；nil 表示全部写入。采样丢弃的记录仍计入 Counters
+	SetSampler(sampler RecordSampler)
+	// Counters 返回本进程启动以来成功保存的指标按 provider/model/status 累计的计数（不含测试流量），
+	// 不查询数据库，按 provider、model、status 排序
+	Counters() []*entity.MetricsCounter
+}
+
+type metricsCounterKey struct {
+	provider, model, status string
 }
 
 type metricsRepoImpl struct {
-	orm   orm.IOrm
-	model ormModel
+	orm           orm.IOrm
+	model         ormModel
+	feedbackModel ormModel
+
+	countersMu sync.Mutex
+	counters   map[metricsCounterKey]*entity.MetricsCounter
+
+	samplerMu sync.RWMutex
+	sampler   RecordSampler
 }
 
 func NewMetricsRepo(o orm.IOrm) MetricsRepo {
 	return &metricsRepoImpl{
-		orm:   o,
-		model: newOrmModel(&entity.Metrics{}, (entity.Metrics{}).TableName()),
+		orm:           o,
+		model:         newOrmModel(&entity.Metrics{}, (entity.Metrics{}).TableName()),
+		feedbackModel: newOrmModel(&entity.MessageFeedback{}, (entity.MessageFeedback{}).TableName()),
+		counters:      map[metricsCounterKey]*entity.MetricsCounter{},
 	}
 }
 
@@ -38,28 +89,88 @@ func (r *metricsRepoImpl) Save(ctx context.Context, m *entity.Metrics) error {
 	if err != nil {
 		return errorx.Wrap(err, errorx.Database, "创建 metrics model 失败")
 	}
-	if err := model.Create(ctx, m); err != nil {
-		return errorx.Wrap(err, errorx.Database, "保存 LLM 指标失败")
+	m.SampleWeight = 1
+	if sampler := r.recordSampler(); sampler != nil {
+		m.SampleWeight = sampler.MetricsWeight(m)
+	}
+	if m.SampleWeight > 0 {
+		if err := model.Create(ctx, m); err != nil {
+			return errorx.Wrap(err, errorx.Database, "保存 LLM 指标失败")
+		}
+	}
+	if !m.IsTest {
+		r.count(m)
 	}
 	return nil
 }
 
+func (r *metricsRepoImpl) SetSampler(sampler RecordSampler) {
+	r.samplerMu.Lock()
+	defer r.samplerMu.Unlock()
+	r.sampler = sampler
+}
+
+func (r *metricsRepoImpl) recordSampler() RecordSampler {
+	r.samplerMu.RLock()
+	defer r.samplerMu.RUnlock()
+	return r.sampler
+}
+
+func (r *metricsRepoImpl) count(m *entity.Metrics) {
+	key := metricsCounterKey{provider: m.Provider, model: m.Model, status: m.Status}
+	r.countersMu.Lock()
+	defer r.countersMu.Unlock()
+	c, ok := r.counters[key]
+	if !ok {
+		c = &entity.MetricsCounter{Provider: m.Provider, Model: m.Model, Status: m.Status}
+		r.counters[key] = c
+	}
+	c.Requests++
+	c.Tokens += int64(m.TotalTokens)
+	c.CostUSD += m.CostUSD
+}
+
+func (r *metricsRepoImpl) Counters() []*entity.MetricsCounter {
+	r.countersMu.Lock()
+	out := make([]*entity.MetricsCounter, 0, len(r.counters))
+	for _, c := range r.counters {
+		cp := *c
+		out = append(out, &cp)
+	}
+	r.countersMu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Provider != out[j].Provider {
+			return out[i].Provider < out[j].Provider
+		}
+		if out[i].Model != out[j].Model {
+			return out[i].Model < out[j].Model
+		}
+		return out[i].Status < out[j].Status
+	})
+	return out
+}
+
+// metricsReportSelects 汇总为 MetricsReport 的聚合列；按 sample_weight 加权，采样写入的记录还原为总体估计
+var metricsReportSelects = []string{
+	"SUM(sample_weight) as total_calls",
+	"SUM(CASE WHEN status = 'ok' THEN sample_weight ELSE 0 END) AS success_calls",
+	"SUM(CASE WHEN status = 'error' THEN sample_weight ELSE 0 END) AS error_calls",
+	"SUM(CASE WHEN status = 'converted' THEN sample_weight ELSE 0 END) AS conversion_calls",
+	"SUM(request_tokens * sample_weight) as total_request_tokens",
+	"SUM(response_tokens * sample_weight) as total_response_tokens",
+	"SUM(total_tokens * sample_weight) as total_tokens",
+	"SUM(latency_ms * sample_weight) * 1.0 / NULLIF(SUM(sample_weight), 0) as avg_latency_ms",
+	"SUM(cost_usd * sample_weight) as total_cost_usd",
+	"SUM(CASE WHEN cache_hit THEN sample_weight ELSE 0 END) AS cache_hit_calls",
+	"SUM(CASE WHEN degraded THEN sample_weight ELSE 0 END) AS degraded_calls",
+	"SUM(CASE WHEN retried_attempts > 0 THEN sample_weight ELSE 0 END) AS retried_calls",
+	"SUM(retried_attempts * sample_weight) as retried_attempts",
+}
+
 func (r *metricsRepoImpl) Aggregate(ctx context.Context, filter entity.MetricsFilter) (*entity.MetricsReport, error) {
 	report := &entity.MetricsReport{}
 
-	selects := []string{
-		"COUNT(*) as total_calls",
-		"SUM(CASE WHEN status = 'ok' THEN 1 ELSE 0 END) AS success_calls",
-		"SUM(CASE WHEN status = 'error' THEN 1 ELSE 0 END) AS error_calls",
-		"SUM(CASE WHEN status = 'converted' THEN 1 ELSE 0 END) AS conversion_calls",
-		"SUM(request_tokens) as total_request_tokens",
-		"SUM(response_tokens) as total_response_tokens",
-		"SUM(total_tokens) as total_tokens",
-		"AVG(latency_ms) as avg_latency_ms",
-		"SUM(cost_usd) as total_cost_usd",
-	}
-
-	opts := append(buildMetricsOptions(filter), orm.WithSelect(selects...))
+	opts := append(buildMetricsOptions(filter), orm.WithSelect(metricsReportSelects...))
 
 	model, err := r.model.model(r.orm)
 	if err != nil {
@@ -90,18 +201,7 @@ func (r *metricsRepoImpl) AggregateByVariant(ctx context.Context, filter entity.
 		entity.MetricsReport
 	}
 	var rows []row
-	selects := []string{
-		"ab_variant as variant",
-		"COUNT(*) as total_calls",
-		"SUM(CASE WHEN status = 'ok' THEN 1 ELSE 0 END) AS success_calls",
-		"SUM(CASE WHEN status = 'error' THEN 1 ELSE 0 END) AS error_calls",
-		"SUM(CASE WHEN status = 'converted' THEN 1 ELSE 0 END) AS conversion_calls",
-		"SUM(request_tokens) as total_request_tokens",
-		"SUM(response_tokens) as total_response_tokens",
-		"SUM(total_tokens) as total_tokens",
-		"AVG(latency_ms) as avg_latency_ms",
-		"SUM(cost_usd) as total_cost_usd",
-	}
+	selects := append([]string{"ab_variant as variant"}, metricsReportSelects...)
 
 	queryOpts := append(opts, orm.WithSelect(selects...), orm.WithGroupBy("ab_variant"))
 
@@ -126,12 +226,385 @@ func (r *metricsRepoImpl) AggregateByVariant(ctx context.Context, filter entity.
 	return result, nil
 }
 
+func (r *metricsRepoImpl) AggregateByModel(ctx context.Context, filter entity.MetricsFilter) ([]*entity.ModelMetricsReport, error) {
+	return r.aggregateByColumns(ctx, filter, "provider", "model")
+}
+
+func (r *metricsRepoImpl) AggregateByEndpoint(ctx context.Context, filter entity.MetricsFilter) ([]*entity.ModelMetricsReport, error) {
+	return r.aggregateByColumns(ctx, filter, "endpoint", "provider", "model")
+}
+
+// 指标汇总的单维度分组方式
+const (
+	MetricsGroupByProvider = "provider"
+	MetricsGroupByTemplate = "template"
+	MetricsGroupByUser     = "user"
+	MetricsGroupByDay      = "day"
+)
+
+// metricsGroupExprs 分组方式对应的列或表达式
+var metricsGroupExprs = map[string]string{
+	MetricsGroupByProvider: "provider",
+	MetricsGroupByTemplate: "prompt_template",
+	MetricsGroupByUser:     "user_id",
+	MetricsGroupByDay:      "DATE(created_at)",
+}
+
+func (r *metricsRepoImpl) AggregateBy(ctx context.Context, filter entity.MetricsFilter, groupBy string) ([]*entity.GroupMetricsReport, error) {
+	expr, ok := metricsGroupExprs[groupBy]
+	if !ok {
+		return nil, errorx.New(errorx.InvalidInput, "group_by 仅支持 provider/model/endpoint/template/user/day")
+	}
+	type row struct {
+		GroupKey string
+		entity.MetricsReport
+	}
+	var rows []row
+	selects := append([]string{expr + " as group_key"}, metricsReportSelects...)
+	opts := append(buildMetricsOptions(filter), orm.WithSelect(selects...), orm.WithGroupBy(expr))
+	if groupBy == MetricsGroupByDay {
+		opts = append(opts, orm.WithOrderBy(expr, false))
+	} else {
+		opts = append(opts, orm.WithOrderBy("total_calls", true))
+	}
+
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 metrics model 失败")
+	}
+	if err := model.Find(ctx, &rows, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "分组汇总 LLM 指标失败")
+	}
+
+	result := make([]*entity.GroupMetricsReport, 0, len(rows))
+	for _, rrow := range rows {
+		if rrow.MetricsReport.TotalCalls > 0 {
+			rrow.MetricsReport.SuccessRate = float64(rrow.MetricsReport.SuccessCalls) / float64(rrow.MetricsReport.TotalCalls)
+			rrow.MetricsReport.ConversionRate = float64(rrow.MetricsReport.ConversionCalls) / float64(rrow.MetricsReport.TotalCalls)
+		}
+		// 部分驱动将 DATE 返回为时间戳字符串，只保留日期部分
+		if groupBy == MetricsGroupByDay && len(rrow.GroupKey) > 10 {
+			rrow.GroupKey = rrow.GroupKey[:10]
+		}
+		result = append(result, &entity.GroupMetricsReport{Key: rrow.GroupKey, Metrics: rrow.MetricsReport})
+	}
+	return result, nil
+}
+
+// aggregateByColumns 按 ModelMetricsReport 的维度列分组汇总
+func (r *metricsRepoImpl) aggregateByColumns(ctx context.Context, filter entity.MetricsFilter, columns ...string) ([]*entity.ModelMetricsReport, error) {
+	type row struct {
+		Endpoint string
+		Provider string
+		Model    string
+		entity.MetricsReport
+	}
+	var rows []row
+	selects := append(append([]string{}, columns...), metricsReportSelects...)
+	opts := append(buildMetricsOptions(filter),
+		orm.WithSelect(selects...),
+		orm.WithGroupBy(columns...),
+		orm.WithOrderBy("total_calls", true),
+	)
+
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 metrics model 失败")
+	}
+	if err := model.Find(ctx, &rows, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "按模型汇总 LLM 指标失败")
+	}
+
+	result := make([]*entity.ModelMetricsReport, 0, len(rows))
+	for _, rrow := range rows {
+		if rrow.MetricsReport.TotalCalls > 0 {
+			rrow.MetricsReport.SuccessRate = float64(rrow.MetricsReport.SuccessCalls) / float64(rrow.MetricsReport.TotalCalls)
+		}
+		result = append(result, &entity.ModelMetricsReport{
+			Endpoint: rrow.Endpoint,
+			Provider: rrow.Provider,
+			Model:    rrow.Model,
+			Metrics:  rrow.MetricsReport,
+		})
+	}
+	return result, nil
+}
+
+// 成本统计的分组方式
+const (
+	CostGroupByUser           = "user"
+	CostGroupByOrg            = "org"
+	CostGroupByPromptTemplate = "prompt_template"
+	CostGroupByModel          = "model"
+	CostGroupByEndpoint       = "endpoint"
+)
+
+func (r *metricsRepoImpl) AggregateCost(ctx context.Context, filter entity.MetricsFilter, groupBy string, top int) ([]*entity.CostBreakdown, error) {
+	var group, selects []string
+	switch groupBy {
+	case CostGroupByUser:
+		group, selects = []string{"user_id"}, []string{"user_id"}
+	case CostGroupByOrg:
+		group, selects = []string{"org_id"}, []string{"org_id"}
+	case CostGroupByPromptTemplate:
+		group, selects = []string{"prompt_template"}, []string{"prompt_template as prompt_template_id"}
+	case CostGroupByModel:
+		group, selects = []string{"provider", "model"}, []string{"provider", "model"}
+	case CostGroupByEndpoint:
+		group, selects = []string{"endpoint", "provider", "model"}, []string{"endpoint", "provider", "model"}
+	default:
+		return nil, errorx.New(errorx.InvalidInput, "group_by 仅支持 user/org/prompt_template/model/endpoint")
+	}
+	selects = append(selects,
+		"SUM(sample_weight) as calls",
+		"SUM(total_tokens * sample_weight) as total_tokens",
+		"SUM(cost_usd * sample_weight) as cost_usd",
+	)
+	opts := append(buildMetricsOptions(filter),
+		orm.WithSelect(selects...),
+		orm.WithGroupBy(group...),
+		orm.WithOrderBy("cost_usd", true),
+		orm.WithOrderBy("calls", true),
+	)
+	if top > 0 {
+		opts = append(opts, orm.WithLimit(top))
+	}
+
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 metrics model 失败")
+	}
+	var rows []*entity.CostBreakdown
+	if err := model.Find(ctx, &rows, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "按维度汇总 LLM 成本失败")
+	}
+	return rows, nil
+}
+
+const (
+	// maxMetricsHourBuckets/maxMetricsDayBuckets 时间序列的桶数上限
+	maxMetricsHourBuckets = 31 * 24
+	maxMetricsDayBuckets  = 366
+	// metricsScanBatch 时间序列按 ID 游标分批读取的行数
+	metricsScanBatch = 2000
+)
+
+func (r *metricsRepoImpl) AggregateTimeSeries(ctx context.Context, filter entity.MetricsFilter, interval string) ([]*entity.MetricsBucket, error) {
+	var step, lookback time.Duration
+	var maxBuckets int
+	switch interval {
+	case "", entity.MetricsIntervalHour:
+		step, lookback, maxBuckets = time.Hour, 24*time.Hour, maxMetricsHourBuckets
+	case entity.MetricsIntervalDay:
+		step, lookback, maxBuckets = 24*time.Hour, 30*24*time.Hour, maxMetricsDayBuckets
+	default:
+		return nil, errorx.New(errorx.InvalidInput, "不支持的时间粒度: "+interval)
+	}
+	end := time.Now().UTC()
+	if filter.EndAt != nil {
+		end = filter.EndAt.UTC()
+	}
+	start := end.Add(-lookback)
+	if filter.StartAt != nil {
+		start = filter.StartAt.UTC()
+	}
+	if !start.Before(end) {
+		return nil, errorx.New(errorx.InvalidInput, "start 须早于 end")
+	}
+	first := start.Truncate(step)
+	n := int(end.Sub(first) / step)
+	if end.Sub(first)%step != 0 {
+		n++
+	}
+	if n > maxBuckets {
+		return nil, errorx.New(errorx.InvalidInput, fmt.Sprintf("时间范围过大，最多 %d 个桶", maxBuckets))
+	}
+
+	// 不同数据库的时间截断函数不通用，按 ID 游标读取所需列后在内存中分桶
+	buckets := make([]*entity.MetricsBucket, n)
+	for i := range buckets {
+		buckets[i] = &entity.MetricsBucket{Start: first.Add(time.Duration(i) * step)}
+	}
+	latency := make([]int64, n)
+	filter.StartAt, filter.EndAt = nil, nil
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 metrics model 失败")
+	}
+	var lastID int64
+	for {
+		opts := append(buildMetricsOptions(filter),
+			orm.WithWhere("created_at >= ? AND created_at < ?", start, end),
+			orm.WithWhere("status IN ?", []string{"ok", "error"}),
+			orm.WithWhere("id > ?", lastID),
+			orm.WithSelect("id", "status", "total_tokens", "latency_ms", "cost_usd", "sample_weight", "created_at"),
+			orm.WithOrderBy("id", false),
+			orm.WithLimit(metricsScanBatch),
+		)
+		var rows []*entity.Metrics
+		if err := model.Find(ctx, &rows, opts...); err != nil {
+			return nil, errorx.Wrap(err, errorx.Database, "按时间汇总 LLM 指标失败")
+		}
+		for _, m := range rows {
+			i := int(m.CreatedAt.UTC().Sub(first) / step)
+			if i < 0 || i >= n {
+				continue
+			}
+			b := buckets[i]
+			w := m.SampleWeight
+			if w <= 0 {
+				w = 1
+			}
+			b.TotalCalls += w
+			if m.Status == "error" {
+				b.ErrorCalls += w
+			}
+			b.TotalTokens += m.TotalTokens * w
+			b.TotalCostUSD += m.CostUSD * float64(w)
+			latency[i] += int64(m.LatencyMs) * int64(w)
+		}
+		if len(rows) < metricsScanBatch {
+			break
+		}
+		lastID = rows[len(rows)-1].ID
+	}
+	for i, b := range buckets {
+		if b.TotalCalls > 0 {
+			b.ErrorRate = float64(b.ErrorCalls) / float64(b.TotalCalls)
+			b.AvgLatencyMs = float64(latency[i]) / float64(b.TotalCalls)
+		}
+	}
+	return buckets, nil
+}
+
+// 反馈统计的分组方式
+const (
+	FeedbackGroupByModel          = "model"
+	FeedbackGroupByPromptTemplate = "prompt_template"
+)
+
+func (r *metricsRepoImpl) AggregateFeedback(ctx context.Context, filter entity.MetricsFilter, groupBy string) ([]*entity.FeedbackReport, error) {
+	// metricsSelect 为 llm_metrics 侧的分组列，统一别名为反馈表的列名
+	var metricsGroup, metricsSelect, feedbackGroup []string
+	switch groupBy {
+	case "", FeedbackGroupByModel:
+		metricsGroup = []string{"provider", "model"}
+		metricsSelect = []string{"provider", "model"}
+		feedbackGroup = []string{"provider", "model"}
+	case FeedbackGroupByPromptTemplate:
+		metricsGroup = []string{"prompt_template"}
+		metricsSelect = []string{"prompt_template as prompt_template_id"}
+		feedbackGroup = []string{"prompt_template_id"}
+	default:
+		return nil, errorx.New(errorx.InvalidInput, "group_by 仅支持 model/prompt_template")
+	}
+	type row struct {
+		Provider         string
+		Model            string
+		PromptTemplateID int64
+		Responses        int64
+		Feedback         int64
+		ThumbsUp         int64
+		ThumbsDown       int64
+		Comments         int64
+	}
+	key := func(rw row) string {
+		return fmt.Sprintf("%s|%s|%d", rw.Provider, rw.Model, rw.PromptTemplateID)
+	}
+
+	feedbackModel, err := r.feedbackModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建消息反馈 model 失败")
+	}
+	var feedbackRows []row
+	feedbackOpts := []orm.QueryOption{
+		orm.WithSelect(append(append([]string{}, feedbackGroup...),
+			"COUNT(*) as feedback",
+			"SUM(CASE WHEN rating > 0 THEN 1 ELSE 0 END) as thumbs_up",
+			"SUM(CASE WHEN rating < 0 THEN 1 ELSE 0 END) as thumbs_down",
+			"SUM(CASE WHEN comment <> '' THEN 1 ELSE 0 END) as comments",
+		)...),
+		orm.WithGroupBy(feedbackGroup...),
+	}
+	if filter.Provider != "" {
+		feedbackOpts = append(feedbackOpts, orm.WithWhere("provider = ?", filter.Provider))
+	}
+	if filter.Model != "" {
+		feedbackOpts = append(feedbackOpts, orm.WithWhere("model = ?", filter.Model))
+	}
+	if filter.ABTestID != nil {
+		feedbackOpts = append(feedbackOpts, orm.WithWhere("ab_test_id = ?", *filter.ABTestID))
+	}
+	if filter.ABVariant != "" {
+		feedbackOpts = append(feedbackOpts, orm.WithWhere("ab_variant = ?", filter.ABVariant))
+	}
+	if filter.StartAt != nil {
+		feedbackOpts = append(feedbackOpts, orm.WithWhere("created_at >= ?", *filter.StartAt))
+	}
+	if filter.EndAt != nil {
+		feedbackOpts = append(feedbackOpts, orm.WithWhere("created_at <= ?", *filter.EndAt))
+	}
+	if err := feedbackModel.Find(ctx, &feedbackRows, feedbackOpts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "统计消息反馈失败")
+	}
+
+	metricsModel, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 metrics model 失败")
+	}
+	responseFilter := filter
+	responseFilter.Status = "ok"
+	responseFilter.Outcome = ""
+	var responseRows []row
+	if err := metricsModel.Find(ctx, &responseRows, append(buildMetricsOptions(responseFilter),
+		orm.WithSelect(append(metricsSelect, "SUM(sample_weight) as responses")...),
+		orm.WithGroupBy(metricsGroup...),
+	)...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "统计成功调用数失败")
+	}
+
+	reports := make(map[string]*entity.FeedbackReport, len(responseRows))
+	var keys []string
+	get := func(rw row) *entity.FeedbackReport {
+		k := key(rw)
+		if rep, ok := reports[k]; ok {
+			return rep
+		}
+		rep := &entity.FeedbackReport{Provider: rw.Provider, Model: rw.Model, PromptTemplateID: rw.PromptTemplateID}
+		reports[k] = rep
+		keys = append(keys, k)
+		return rep
+	}
+	for _, rw := range responseRows {
+		get(rw).Responses = rw.Responses
+	}
+	for _, rw := range feedbackRows {
+		rep := get(rw)
+		rep.Feedback, rep.ThumbsUp, rep.ThumbsDown, rep.Comments = rw.Feedback, rw.ThumbsUp, rw.ThumbsDown, rw.Comments
+	}
+
+	result := make([]*entity.FeedbackReport, 0, len(keys))
+	for _, k := range keys {
+		rep := reports[k]
+		if rep.Responses > 0 {
+			rep.FeedbackRate = float64(rep.Feedback) / float64(rep.Responses)
+		}
+		if rated := rep.ThumbsUp + rep.ThumbsDown; rated > 0 {
+			rep.PositiveRate = float64(rep.ThumbsUp) / float64(rated)
+		}
+		result = append(result, rep)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Responses > result[j].Responses })
+	return result, nil
+}
+
 func (r *metricsRepoImpl) Significance(ctx context.Context, filter entity.MetricsFilter) (*entity.ABSignificanceReport, error) {
 	if filter.ABTestID == nil {
 		return nil, errorx.New(errorx.InvalidInput, "ab_test_id 不能为空")
 	}
 
-	// 基于成功调用作为曝光，转换事件为 status=converted（可按 outcome 过滤）
+	// 基于成功调用作为曝光，转换事件为 status=converted（可按 outcome 过滤）；
+	// 默认按去重用户计数（曝光/转化过的用户数），CallBased 时按调用次数计数
 	exposureFilter := filter
 	exposureFilter.Status = "ok"
 	exposureFilter.ABVariant = ""
@@ -149,46 +622,105 @@ func (r *metricsRepoImpl) Significance(ctx context.Context, filter entity.Metric
 		return nil, err
 	}
 
-	aTotal := exposures["A"]
-	bTotal := exposures["B"]
-	aConv := conversions["A"]
-	bConv := conversions["B"]
-
 	report := &entity.ABSignificanceReport{
 		ABTestID: *filter.ABTestID,
 		Outcome:  filter.Outcome,
+		Unit:     "user",
+	}
+	if filter.CallBased {
+		report.Unit = "call"
+	}
+
+	keys := make([]string, 0, len(exposures))
+	for k := range exposures {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	totals := make([]int64, 0, len(keys))
+	convs := make([]int64, 0, len(keys))
+	for _, k := range keys {
+		v := buildVariantReport(k, exposures[k], conversions[k])
+		report.Variants = append(report.Variants, v)
+		switch k {
+		case "A":
+			report.VariantA = v
+		case "B":
+			report.VariantB = v
+		}
+		if exposures[k] > 0 {
+			totals = append(totals, exposures[k])
+			convs = append(convs, conversions[k])
+		}
 	}
 
-	report.VariantA = buildVariantReport("A", aTotal, aConv)
-	report.VariantB = buildVariantReport("B", bTotal, bConv)
-
-	if aTotal == 0 || bTotal == 0 {
+	if len(totals) < 2 {
 		report.Note = "样本不足，无法计算显著性"
 		report.PValue = 1
 		report.Confidence = 0
+		report.SequentialPValue = 1
 		return report, nil
 	}
 
-	pValue := calcPValue(aConv, aTotal, bConv, bTotal)
-	report.PValue = pValue
-	report.Confidence = maxFloat(0, 1-pValue)
-
-	rateA := 0.0
-	rateB := 0.0
-	if aTotal > 0 {
-		rateA = float64(aConv) / float64(aTotal)
+	chi2, df := chiSquareStat(convs, totals)
+	report.ChiSquare = chi2
+	report.DegreesOfFreedom = df
+	if len(totals) == 2 {
+		report.PValue = calcPValue(convs[0], totals[0], convs[1], totals[1])
+	} else {
+		report.PValue = chiSquarePValue(chi2, df)
 	}
-	if bTotal > 0 {
-		rateB = float64(bConv) / float64(bTotal)
+	report.Confidence = maxFloat(0, 1-report.PValue)
+	report.Pairwise = pairwiseComparisons(report.Variants, conversions, exposures)
+
+	// 对照组：优先 A，否则取首个非留出组变体
+	control := report.VariantA
+	for _, v := range report.Variants {
+		if control == nil && v.Variant != entity.ABVariantHoldout && v.Metrics.TotalCalls > 0 {
+			control = v
+		}
 	}
-	report.Lift = rateB - rateA
 
-	if rateA > rateB {
-		report.Winner = "A"
-	} else if rateB > rateA {
-		report.Winner = "B"
-	} else {
+	var best *entity.VariantMetricsReport
+	tie := false
+	for _, v := range report.Variants {
+		if v.Metrics.TotalCalls == 0 {
+			continue
+		}
+		switch {
+		case best == nil || v.Metrics.ConversionRate > best.Metrics.ConversionRate:
+			best, tie = v, false
+		case v.Metrics.ConversionRate == best.Metrics.ConversionRate:
+			tie = true
+		}
+	}
+	if tie {
 		report.Winner = "tie"
+	} else if best != nil {
+		report.Winner = best.Variant
+	}
+
+	// 提升：最佳非对照变体相对对照组
+	if control != nil {
+		var challenger *entity.VariantMetricsReport
+		for _, v := range report.Variants {
+			if v == control || v.Variant == entity.ABVariantHoldout || v.Metrics.TotalCalls == 0 {
+				continue
+			}
+			if challenger == nil || v.Metrics.ConversionRate > challenger.Metrics.ConversionRate {
+				challenger = v
+			}
+		}
+		if challenger != nil {
+			report.Lift = challenger.Metrics.ConversionRate - control.Metrics.ConversionRate
+
+			cConv, cTotal := conversions[control.Variant], exposures[control.Variant]
+			xConv, xTotal := conversions[challenger.Variant], exposures[challenger.Variant]
+			report.Challenger = challenger.Variant
+			report.ProbBeatsControl = betaProbGreater(xConv, xTotal, cConv, cTotal)
+			report.CredibleLow, report.CredibleHigh = betaDiffInterval(xConv, xTotal, cConv, cTotal)
+			report.SequentialPValue = math.Min(1, msprtPValue(cConv, cTotal, xConv, xTotal)*float64(len(totals)-1))
+			report.SequentialConfidence = 1 - report.SequentialPValue
+		}
 	}
 	return report, nil
 }
@@ -200,8 +732,15 @@ func (r *metricsRepoImpl) queryVariantCount(ctx context.Context, filter entity.M
 	}
 	var rows []row
 
-	opts := append(buildMetricsOptions(filter),
-		orm.WithSelect("ab_variant as variant", "COUNT(*) as count"),
+	count := "COUNT(*) as count"
+	opts := buildMetricsOptions(filter)
+	if !filter.CallBased {
+		// 匿名调用（user_id = 0）无法区分用户，按用户计数时不参与统计
+		count = "COUNT(DISTINCT user_id) as count"
+		opts = append(opts, orm.WithWhere("user_id > ?", 0))
+	}
+	opts = append(opts,
+		orm.WithSelect("ab_variant as variant", count),
 		orm.WithGroupBy("ab_variant"),
 	)
 
@@ -213,10 +752,7 @@ func (r *metricsRepoImpl) queryVariantCount(ctx context.Context, filter entity.M
 		return nil, errorx.Wrap(err, errorx.Database, "统计 A/B 指标失败")
 	}
 
-	result := map[string]int64{
-		"A": 0,
-		"B": 0,
-	}
+	result := map[string]int64{}
 	for _, rrow := range rows {
 		if rrow.Variant == "" {
 			continue
@@ -226,6 +762,36 @@ func (r *metricsRepoImpl) queryVariantCount(ctx context.Context, filter entity.M
 	return result, nil
 }
 
+// pairwiseComparisons 对有样本的变体两两做双比例 z 检验（按变体名顺序，前者为基准），并做 Holm-Bonferroni 校正
+func pairwiseComparisons(variants []*entity.VariantMetricsReport, conversions, exposures map[string]int64) []*entity.ABPairwiseComparison {
+	var exposed []*entity.VariantMetricsReport
+	for _, v := range variants {
+		if exposures[v.Variant] > 0 {
+			exposed = append(exposed, v)
+		}
+	}
+	var result []*entity.ABPairwiseComparison
+	var pValues []float64
+	for i := 0; i < len(exposed); i++ {
+		for j := i + 1; j < len(exposed); j++ {
+			base, v := exposed[i], exposed[j]
+			p := calcPValue(conversions[base.Variant], exposures[base.Variant], conversions[v.Variant], exposures[v.Variant])
+			result = append(result, &entity.ABPairwiseComparison{
+				Base:    base.Variant,
+				Variant: v.Variant,
+				Lift:    v.Metrics.ConversionRate - base.Metrics.ConversionRate,
+				PValue:  p,
+			})
+			pValues = append(pValues, p)
+		}
+	}
+	for i, adjusted := range holmAdjust(pValues) {
+		result[i].AdjustedPValue = adjusted
+		result[i].Significant = adjusted < pairwiseAlpha
+	}
+	return result
+}
+
 func calcPValue(aConv, aTotal, bConv, bTotal int64) float64 {
 	if aTotal == 0 || bTotal == 0 {
 		return 1
@@ -303,6 +869,55 @@ func (r *metricsRepoImpl) List(ctx context.Context, filter entity.MetricsFilter,
 	return list, total, nil
 }
 
+func (r *metricsRepoImpl) Latest(ctx context.Context, filter entity.MetricsFilter) (*entity.Metrics, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 metrics model 失败")
+	}
+	opts := append(buildMetricsOptions(filter), orm.WithOrderBy("id", true), orm.WithLimit(1))
+	var list []*entity.Metrics
+	if err := model.Find(ctx, &list, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询 LLM 指标失败")
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return list[0], nil
+}
+
+func (r *metricsRepoImpl) Iterate(ctx context.Context, filter entity.MetricsFilter, batchSize int, fn func(batch []*entity.Metrics) error) error {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 metrics model 失败")
+	}
+	if batchSize <= 0 || batchSize > 1000 {
+		batchSize = 500
+	}
+	var lastID int64
+	for {
+		opts := buildMetricsOptions(filter)
+		if lastID > 0 {
+			opts = append(opts, orm.WithWhere("id < ?", lastID))
+		}
+		opts = append(opts, orm.WithOrderBy("id", true), orm.WithLimit(batchSize))
+
+		var batch []*entity.Metrics
+		if err := model.Find(ctx, &batch, opts...); err != nil {
+			return errorx.Wrap(err, errorx.Database, "查询 LLM 指标列表失败")
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		if len(batch) < batchSize {
+			return nil
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
+
 func buildMetricsOptions(filter entity.MetricsFilter) []orm.QueryOption {
 	opts := []orm.QueryOption{}
 	if filter.Provider != "" {
@@ -311,9 +926,24 @@ func buildMetricsOptions(filter entity.MetricsFilter) []orm.QueryOption {
 	if filter.Model != "" {
 		opts = append(opts, orm.WithWhere("model = ?", filter.Model))
 	}
+	if filter.Endpoint != "" {
+		opts = append(opts, orm.WithWhere("endpoint = ?", filter.Endpoint))
+	}
+	if filter.RequestID != "" {
+		opts = append(opts, orm.WithWhere("request_id = ?", filter.RequestID))
+	}
 	if filter.UserID != nil {
 		opts = append(opts, orm.WithWhere("user_id = ?", *filter.UserID))
 	}
+	if filter.ConversationID != nil {
+		opts = append(opts, orm.WithWhere("conversation_id = ?", *filter.ConversationID))
+	}
+	if filter.OrgID != nil {
+		opts = append(opts, orm.WithWhere("org_id = ?", *filter.OrgID))
+	}
+	if filter.PromptTemplateID != nil {
+		opts = append(opts, orm.WithWhere("prompt_template = ?", *filter.PromptTemplateID))
+	}
 	if filter.Status != "" {
 		opts = append(opts, orm.WithWhere("status = ?", filter.Status))
 	}
@@ -332,5 +962,38 @@ func buildMetricsOptions(filter entity.MetricsFilter) []orm.QueryOption {
 	if filter.Outcome != "" {
 		opts = append(opts, orm.WithWhere("outcome = ?", filter.Outcome))
 	}
+	if !filter.IncludeTest {
+		opts = append(opts, orm.WithWhere("is_test = ?", false))
+	}
 	return opts
 }
+
+func (r *metricsRepoImpl) UpdateCost(ctx context.Context, id int64, costUSD float64) error {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 metrics model 失败")
+	}
+	if err := model.UpdateValues(ctx, map[string]any{"cost_usd": costUSD}, orm.WithWhere("id = ?", id)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新 LLM 指标成本失败")
+	}
+	return nil
+}
+
+func (r *metricsRepoImpl) AnonymizeUser(ctx context.Context, userID int64) (int64, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建 metrics model 失败")
+	}
+	where := orm.WithWhere("user_id = ?", userID)
+	count, err := model.Count(ctx, where)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "统计用户调用指标失败")
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if err := model.UpdateValues(ctx, map[string]any{"user_id": 0, "conversation_id": 0}, where); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "匿名化用户调用指标失败")
+	}
+	return count, nil
+}
@@ -0,0 +1,320 @@
+package repo
+
+import (
+	"math"
+	"sort"
+)
+
+// pairwiseAlpha 两两比较校正后的显著性水平
+const pairwiseAlpha = 0.05
+
+// chiSquareStat 计算 2×k 列联表（转化/未转化 × 变体）的卡方统计量与自由度
+func chiSquareStat(convs, totals []int64) (float64, int) {
+	var sumConv, sumTotal int64
+	for i := range totals {
+		sumConv += convs[i]
+		sumTotal += totals[i]
+	}
+	if sumTotal == 0 || sumConv == 0 || sumConv == sumTotal {
+		return 0, len(totals) - 1
+	}
+	rate := float64(sumConv) / float64(sumTotal)
+	chi2 := 0.0
+	for i := range totals {
+		expConv := float64(totals[i]) * rate
+		expMiss := float64(totals[i]) - expConv
+		obsConv := float64(convs[i])
+		obsMiss := float64(totals[i] - convs[i])
+		if expConv > 0 {
+			chi2 += (obsConv - expConv) * (obsConv - expConv) / expConv
+		}
+		if expMiss > 0 {
+			chi2 += (obsMiss - expMiss) * (obsMiss - expMiss) / expMiss
+		}
+	}
+	return chi2, len(totals) - 1
+}
+
+// holmAdjust 返回 Holm-Bonferroni 校正后的 p 值（与输入顺序一致）：按 p 值升序第 i 个（从 0 计）乘以 m-i，
+// 并取前缀最大值保证单调，结果不超过 1
+func holmAdjust(pValues []float64) []float64 {
+	m := len(pValues)
+	order := make([]int, m)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return pValues[order[a]] < pValues[order[b]] })
+	adjusted := make([]float64, m)
+	running := 0.0
+	for rank, idx := range order {
+		running = math.Max(running, math.Min(1, pValues[idx]*float64(m-rank)))
+		adjusted[idx] = running
+	}
+	return adjusted
+}
+
+// chiSquarePValue 卡方分布的右尾概率 P(X >= chi2)
+func chiSquarePValue(chi2 float64, df int) float64 {
+	if df <= 0 || chi2 <= 0 {
+		return 1
+	}
+	return regularizedGammaQ(float64(df)/2, chi2/2)
+}
+
+// regularizedGammaQ 上不完全伽马函数的正则化形式 Q(a, x)，x < a+1 用级数，否则用连分式
+func regularizedGammaQ(a, x float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	lgamma, _ := math.Lgamma(a)
+	if x < a+1 {
+		sum := 1 / a
+		term := sum
+		for n := 1; n < 200; n++ {
+			term *= x / (a + float64(n))
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-12 {
+				break
+			}
+		}
+		p := sum * math.Exp(-x+a*math.Log(x)-lgamma)
+		return math.Max(0, math.Min(1, 1-p))
+	}
+
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for i := 1; i < 200; i++ {
+		an := -float64(i) * (float64(i) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-12 {
+			break
+		}
+	}
+	q := math.Exp(-x+a*math.Log(x)-lgamma) * h
+	return math.Max(0, math.Min(1, q))
+}
+
+// sequentialMixtureVariance mSPRT 混合先验的方差 τ²，对应预期转化率差值约 ±2 个百分点
+const sequentialMixtureVariance = 0.0004
+
+// betaPosterior 返回 Beta(1+conv, 1+total-conv) 后验的均值与方差
+func betaPosterior(conv, total int64) (float64, float64) {
+	a := float64(1 + conv)
+	b := float64(1 + total - conv)
+	mean := a / (a + b)
+	variance := a * b / ((a + b) * (a + b) * (a + b + 1))
+	return mean, variance
+}
+
+// betaProbGreater 后验概率 P(p_x > p_y)，样本量较大时用正态近似
+func betaProbGreater(xConv, xTotal, yConv, yTotal int64) float64 {
+	mx, vx := betaPosterior(xConv, xTotal)
+	my, vy := betaPosterior(yConv, yTotal)
+	sd := math.Sqrt(vx + vy)
+	if sd == 0 {
+		return 0.5
+	}
+	return 0.5 * (1 + math.Erf((mx-my)/(sd*math.Sqrt2)))
+}
+
+// betaDiffInterval p_x - p_y 的 95% 可信区间（正态近似）
+func betaDiffInterval(xConv, xTotal, yConv, yTotal int64) (float64, float64) {
+	mx, vx := betaPosterior(xConv, xTotal)
+	my, vy := betaPosterior(yConv, yTotal)
+	diff := mx - my
+	half := 1.959964 * math.Sqrt(vx+vy)
+	return diff - half, diff + half
+}
+
+// msprtPValue 两比例差值的 mSPRT 始终有效 p 值（正态混合似然比的倒数），
+// 每次查看都可直接使用，不受反复查看导致的假阳性膨胀影响
+func msprtPValue(aConv, aTotal, bConv, bTotal int64) float64 {
+	if aTotal == 0 || bTotal == 0 {
+		return 1
+	}
+	pA := float64(aConv) / float64(aTotal)
+	pB := float64(bConv) / float64(bTotal)
+	v := pA*(1-pA)/float64(aTotal) + pB*(1-pB)/float64(bTotal)
+	if v <= 0 {
+		return 1
+	}
+	theta := pB - pA
+	tau2 := sequentialMixtureVariance
+	logLambda := 0.5*math.Log(v/(v+tau2)) + tau2*theta*theta/(2*v*(v+tau2))
+	if logLambda <= 0 {
+		return 1
+	}
+	return math.Min(1, math.Exp(-logLambda))
+}
+
+// welchTTest Welch 双样本 t 检验（不假设方差相等），返回 t 统计量与双侧 p 值；任一样本少于 2 个时 p 为 1
+func welchTTest(x, y []float64) (float64, float64) {
+	if len(x) < 2 || len(y) < 2 {
+		return 0, 1
+	}
+	mx, vx := meanVariance(x)
+	my, vy := meanVariance(y)
+	nx, ny := float64(len(x)), float64(len(y))
+	sx, sy := vx/nx, vy/ny
+	if sx+sy <= 0 {
+		return 0, 1
+	}
+	t := (my - mx) / math.Sqrt(sx+sy)
+	df := (sx + sy) * (sx + sy) / (sx*sx/(nx-1) + sy*sy/(ny-1))
+	return t, studentTPValue(t, df)
+}
+
+// studentTPValue 自由度为 df 的 t 分布双侧 p 值 P(|T| >= |t|)
+func studentTPValue(t, df float64) float64 {
+	if df <= 0 || math.IsNaN(t) {
+		return 1
+	}
+	return math.Max(0, math.Min(1, regularizedBeta(df/2, 0.5, df/(df+t*t))))
+}
+
+// mannWhitneyU Mann-Whitney U 检验（正态近似，含结校正与连续性校正），返回 y 相对 x 的 U 统计量与双侧 p 值
+func mannWhitneyU(x, y []float64) (float64, float64) {
+	nx, ny := len(x), len(y)
+	if nx == 0 || ny == 0 {
+		return 0, 1
+	}
+	type obs struct {
+		v     float64
+		fromY bool
+	}
+	all := make([]obs, 0, nx+ny)
+	for _, v := range x {
+		all = append(all, obs{v: v})
+	}
+	for _, v := range y {
+		all = append(all, obs{v: v, fromY: true})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].v < all[j].v })
+
+	// 相同取值取平均秩，并累计结校正项 Σ(t³ - t)
+	var rankY, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].v == all[i].v {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if all[k].fromY {
+				rankY += rank
+			}
+		}
+		if t := float64(j - i); t > 1 {
+			ties += t*t*t - t
+		}
+		i = j
+	}
+	n1, n2 := float64(nx), float64(ny)
+	u := rankY - n2*(n2+1)/2
+	n := n1 + n2
+	variance := n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1)))
+	if variance <= 0 {
+		return u, 1
+	}
+	diff := math.Abs(u-n1*n2/2) - 0.5
+	if diff < 0 {
+		diff = 0
+	}
+	z := diff / math.Sqrt(variance)
+	return u, math.Max(0, math.Min(1, 2*(1-0.5*(1+math.Erf(z/math.Sqrt2)))))
+}
+
+func meanVariance(xs []float64) (float64, float64) {
+	if len(xs) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	for _, v := range xs {
+		sum += v
+	}
+	mean := sum / float64(len(xs))
+	if len(xs) < 2 {
+		return mean, 0
+	}
+	var ss float64
+	for _, v := range xs {
+		ss += (v - mean) * (v - mean)
+	}
+	return mean, ss / float64(len(xs)-1)
+}
+
+// regularizedBeta 正则化不完全贝塔函数 I_x(a, b)，用连分式计算
+func regularizedBeta(a, b, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	la, _ := math.Lgamma(a)
+	lb, _ := math.Lgamma(b)
+	lab, _ := math.Lgamma(a + b)
+	front := math.Exp(lab - la - lb + a*math.Log(x) + b*math.Log(1-x))
+	// 连分式在 x < (a+1)/(a+b+2) 时收敛较快，否则利用对称性 I_x(a,b) = 1 - I_{1-x}(b,a)
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(a, b, x) / a
+	}
+	return 1 - front*betaContinuedFraction(b, a, 1-x)/b
+}
+
+func betaContinuedFraction(a, b, x float64) float64 {
+	const tiny = 1e-300
+	qab, qap, qam := a+b, a+1, a-1
+	c := 1.0
+	d := 1 - qab*x/qap
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	h := d
+	for m := 1; m < 300; m++ {
+		fm := float64(m)
+		m2 := 2 * fm
+		aa := fm * (b - fm) * x / ((qam + m2) * (a + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		h *= d * c
+		aa = -(a + fm) * (qab + fm) * x / ((a + m2) * (qap + m2))
+		d = 1 + aa*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + aa/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-12 {
+			break
+		}
+	}
+	return h
+}
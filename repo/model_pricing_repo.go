@@ -0,0 +1,97 @@
+package repo
+
+import (
+	"context"
+
+	"gochen-llm/entity"
+	"gochen/db/orm"
+	"gochen/errorx"
+)
+
+// ModelPricingRepo 管理模型价格表
+type ModelPricingRepo interface {
+	// List 按 provider、model_pattern、生效时间倒序返回价格记录，provider 为空时返回全部
+	List(ctx context.Context, provider string) ([]*entity.ModelPricing, error)
+	Get(ctx context.Context, id int64) (*entity.ModelPricing, error)
+	// Save ID 为 0 时新增，否则按 ID 覆盖
+	Save(ctx context.Context, p *entity.ModelPricing) error
+	Delete(ctx context.Context, id int64) error
+}
+
+type modelPricingRepoImpl struct {
+	orm   orm.IOrm
+	model ormModel
+}
+
+func NewModelPricingRepo(o orm.IOrm) ModelPricingRepo {
+	return &modelPricingRepoImpl{
+		orm:   o,
+		model: newOrmModel(&entity.ModelPricing{}, (entity.ModelPricing{}).TableName()),
+	}
+}
+
+func (r *modelPricingRepoImpl) List(ctx context.Context, provider string) ([]*entity.ModelPricing, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建模型价格 model 失败")
+	}
+	opts := []orm.QueryOption{
+		orm.WithOrderBy("provider", false),
+		orm.WithOrderBy("model_pattern", false),
+		orm.WithOrderBy("effective_from", true),
+	}
+	if provider != "" {
+		opts = append(opts, orm.WithWhere("provider = ?", provider))
+	}
+	var list []*entity.ModelPricing
+	if err := model.Find(ctx, &list, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询模型价格失败")
+	}
+	return list, nil
+}
+
+func (r *modelPricingRepoImpl) Get(ctx context.Context, id int64) (*entity.ModelPricing, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建模型价格 model 失败")
+	}
+	var p entity.ModelPricing
+	if err := model.First(ctx, &p, orm.WithWhere("id = ?", id)); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, nil
+		}
+		return nil, errorx.Wrap(err, errorx.Database, "查询模型价格失败")
+	}
+	return &p, nil
+}
+
+func (r *modelPricingRepoImpl) Save(ctx context.Context, p *entity.ModelPricing) error {
+	if p == nil {
+		return errorx.New(errorx.InvalidInput, "模型价格不能为空")
+	}
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建模型价格 model 失败")
+	}
+	if p.ID == 0 {
+		if err := model.Create(ctx, p); err != nil {
+			return errorx.Wrap(err, errorx.Database, "创建模型价格失败")
+		}
+		return nil
+	}
+	if err := model.Save(ctx, p, orm.WithWhere("id = ?", p.ID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新模型价格失败")
+	}
+	return nil
+}
+
+func (r *modelPricingRepoImpl) Delete(ctx context.Context, id int64) error {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建模型价格 model 失败")
+	}
+	if err := model.Delete(ctx, orm.WithWhere("id = ?", id)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "删除模型价格失败")
+	}
+	return nil
+}
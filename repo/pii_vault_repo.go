@@ -0,0 +1,110 @@
+package repo
+
+import (
+	"context"
+	"sync"
+
+	"gochen-llm/entity"
+	"gochen/db/orm"
+	"gochen/errorx"
+)
+
+// PIIVaultRepo PII 令牌库：保存令牌与原文的映射，供可逆令牌化还原
+type PIIVaultRepo interface {
+	// Put 保存令牌与原文，userID 为原文所属用户（未知时为 0），供删除用户数据时清理
+	Put(ctx context.Context, userID int64, token, detector, value string) error
+	// Get 返回令牌对应的原文，不存在时返回空字符串
+	Get(ctx context.Context, token string) (string, error)
+	// DeleteByUser 删除用户的全部令牌，返回删除行数；删除后对应占位符不再可还原
+	DeleteByUser(ctx context.Context, userID int64) (int64, error)
+	// SetCipher 启用原文字段加密，nil 关闭（已加密数据仍需原密钥读取）
+	SetCipher(cipher FieldCipher)
+}
+
+type piiVaultRepoImpl struct {
+	orm   orm.IOrm
+	model ormModel
+
+	cipherMu sync.RWMutex
+	cipher   FieldCipher
+}
+
+func NewPIIVaultRepo(o orm.IOrm) PIIVaultRepo {
+	return &piiVaultRepoImpl{
+		orm:   o,
+		model: newOrmModel(&entity.PIIVaultEntry{}, (entity.PIIVaultEntry{}).TableName()),
+	}
+}
+
+func (r *piiVaultRepoImpl) SetCipher(cipher FieldCipher) {
+	r.cipherMu.Lock()
+	defer r.cipherMu.Unlock()
+	r.cipher = cipher
+}
+
+func (r *piiVaultRepoImpl) fieldCipher() FieldCipher {
+	r.cipherMu.RLock()
+	defer r.cipherMu.RUnlock()
+	return r.cipher
+}
+
+func (r *piiVaultRepoImpl) Put(ctx context.Context, userID int64, token, detector, value string) error {
+	if token == "" {
+		return errorx.New(errorx.InvalidInput, "PII 令牌不能为空")
+	}
+	if c := r.fieldCipher(); c != nil {
+		enc, err := c.Encrypt(value)
+		if err != nil {
+			return err
+		}
+		value = enc
+	}
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 PII 令牌库 model 失败")
+	}
+	if err := model.Create(ctx, &entity.PIIVaultEntry{Token: token, UserID: userID, Detector: detector, Value: value}); err != nil {
+		return errorx.Wrap(err, errorx.Database, "保存 PII 令牌失败")
+	}
+	return nil
+}
+
+func (r *piiVaultRepoImpl) Get(ctx context.Context, token string) (string, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return "", errorx.Wrap(err, errorx.Database, "创建 PII 令牌库 model 失败")
+	}
+	var entry entity.PIIVaultEntry
+	if err := model.First(ctx, &entry, orm.WithWhere("token = ?", token)); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return "", nil
+		}
+		return "", errorx.Wrap(err, errorx.Database, "查询 PII 令牌失败")
+	}
+	if c := r.fieldCipher(); c != nil {
+		return c.Decrypt(entry.Value)
+	}
+	return entry.Value, nil
+}
+
+func (r *piiVaultRepoImpl) DeleteByUser(ctx context.Context, userID int64) (int64, error) {
+	if userID <= 0 {
+		return 0, errorx.New(errorx.InvalidInput, "user_id 无效")
+	}
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建 PII 令牌库 model 失败")
+	}
+	where := orm.WithWhere("user_id = ?", userID)
+	count, err := model.Count(ctx, where)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "统计 PII 令牌失败")
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if err := model.Delete(ctx, where); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "删除 PII 令牌失败")
+	}
+	return count, nil
+}
@@ -0,0 +1,80 @@
+package repo
+
+import (
+	"context"
+
+	"gochen-llm/entity"
+	"gochen/db/orm"
+	"gochen/errorx"
+)
+
+// PromptGitSourceRepo 持久化提示词 Git 同步源
+type PromptGitSourceRepo interface {
+	Save(ctx context.Context, source *entity.PromptGitSource) error
+	Get(ctx context.Context, id int64) (*entity.PromptGitSource, error)
+	List(ctx context.Context, enabledOnly bool) ([]*entity.PromptGitSource, error)
+}
+
+type promptGitSourceRepoImpl struct {
+	orm   orm.IOrm
+	model ormModel
+}
+
+func NewPromptGitSourceRepo(o orm.IOrm) PromptGitSourceRepo {
+	return &promptGitSourceRepoImpl{
+		orm:   o,
+		model: newOrmModel(&entity.PromptGitSource{}, (entity.PromptGitSource{}).TableName()),
+	}
+}
+
+// Save ID 为 0 时新增，否则整体更新
+func (r *promptGitSourceRepoImpl) Save(ctx context.Context, source *entity.PromptGitSource) error {
+	if source == nil {
+		return errorx.New(errorx.InvalidInput, "Git 同步源不能为空")
+	}
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 Git 同步源 model 失败")
+	}
+	if source.ID == 0 {
+		if err := model.Create(ctx, source); err != nil {
+			return errorx.Wrap(err, errorx.Database, "创建 Git 同步源失败")
+		}
+		return nil
+	}
+	if err := model.Save(ctx, source, orm.WithWhere("id = ?", source.ID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新 Git 同步源失败")
+	}
+	return nil
+}
+
+func (r *promptGitSourceRepoImpl) Get(ctx context.Context, id int64) (*entity.PromptGitSource, error) {
+	var source entity.PromptGitSource
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 Git 同步源 model 失败")
+	}
+	if err := model.First(ctx, &source, orm.WithWhere("id = ?", id)); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, nil
+		}
+		return nil, errorx.Wrap(err, errorx.Database, "查询 Git 同步源失败")
+	}
+	return &source, nil
+}
+
+func (r *promptGitSourceRepoImpl) List(ctx context.Context, enabledOnly bool) ([]*entity.PromptGitSource, error) {
+	opts := []orm.QueryOption{orm.WithOrderBy("id", false)}
+	if enabledOnly {
+		opts = append(opts, orm.WithWhere("enabled = ?", true))
+	}
+	var list []*entity.PromptGitSource
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 Git 同步源 model 失败")
+	}
+	if err := model.Find(ctx, &list, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询 Git 同步源列表失败")
+	}
+	return list, nil
+}
@@ -0,0 +1,135 @@
+package repo
+
+import (
+	"context"
+
+	"gochen-llm/entity"
+	"gochen/db/orm"
+	"gochen/errorx"
+)
+
+// PromptTestRepo 持久化提示词回归测试用例及执行历史
+type PromptTestRepo interface {
+	SaveCase(ctx context.Context, tc *entity.PromptTestCase) error
+	GetCase(ctx context.Context, id int64) (*entity.PromptTestCase, error)
+	// ListCases templateID 为 0 时返回全部用例
+	ListCases(ctx context.Context, templateID int64, enabledOnly bool) ([]*entity.PromptTestCase, error)
+	SaveRun(ctx context.Context, run *entity.PromptTestRun) error
+	// ListRuns 按时间倒序返回执行记录，caseID/templateID 为 0 表示不过滤
+	ListRuns(ctx context.Context, caseID, templateID int64, limit int) ([]*entity.PromptTestRun, error)
+	// LatestRun 返回用例最近一次执行记录，不存在返回 nil
+	LatestRun(ctx context.Context, caseID int64) (*entity.PromptTestRun, error)
+}
+
+type promptTestRepoImpl struct {
+	orm   orm.IOrm
+	cases ormModel
+	runs  ormModel
+}
+
+func NewPromptTestRepo(o orm.IOrm) PromptTestRepo {
+	return &promptTestRepoImpl{
+		orm:   o,
+		cases: newOrmModel(&entity.PromptTestCase{}, (entity.PromptTestCase{}).TableName()),
+		runs:  newOrmModel(&entity.PromptTestRun{}, (entity.PromptTestRun{}).TableName()),
+	}
+}
+
+// SaveCase ID 为 0 时新增，否则整体更新
+func (r *promptTestRepoImpl) SaveCase(ctx context.Context, tc *entity.PromptTestCase) error {
+	if tc == nil {
+		return errorx.New(errorx.InvalidInput, "测试用例不能为空")
+	}
+	model, err := r.cases.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建测试用例 model 失败")
+	}
+	if tc.ID == 0 {
+		if err := model.Create(ctx, tc); err != nil {
+			return errorx.Wrap(err, errorx.Database, "创建测试用例失败")
+		}
+		return nil
+	}
+	if err := model.Save(ctx, tc, orm.WithWhere("id = ?", tc.ID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新测试用例失败")
+	}
+	return nil
+}
+
+func (r *promptTestRepoImpl) GetCase(ctx context.Context, id int64) (*entity.PromptTestCase, error) {
+	var tc entity.PromptTestCase
+	model, err := r.cases.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建测试用例 model 失败")
+	}
+	if err := model.First(ctx, &tc, orm.WithWhere("id = ?", id)); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, nil
+		}
+		return nil, errorx.Wrap(err, errorx.Database, "查询测试用例失败")
+	}
+	return &tc, nil
+}
+
+func (r *promptTestRepoImpl) ListCases(ctx context.Context, templateID int64, enabledOnly bool) ([]*entity.PromptTestCase, error) {
+	opts := []orm.QueryOption{orm.WithOrderBy("id", false)}
+	if templateID > 0 {
+		opts = append(opts, orm.WithWhere("template_id = ?", templateID))
+	}
+	if enabledOnly {
+		opts = append(opts, orm.WithWhere("enabled = ?", true))
+	}
+	var list []*entity.PromptTestCase
+	model, err := r.cases.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建测试用例 model 失败")
+	}
+	if err := model.Find(ctx, &list, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询测试用例列表失败")
+	}
+	return list, nil
+}
+
+func (r *promptTestRepoImpl) SaveRun(ctx context.Context, run *entity.PromptTestRun) error {
+	if run == nil {
+		return errorx.New(errorx.InvalidInput, "测试执行记录不能为空")
+	}
+	model, err := r.runs.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建测试执行记录 model 失败")
+	}
+	if err := model.Create(ctx, run); err != nil {
+		return errorx.Wrap(err, errorx.Database, "保存测试执行记录失败")
+	}
+	return nil
+}
+
+func (r *promptTestRepoImpl) ListRuns(ctx context.Context, caseID, templateID int64, limit int) ([]*entity.PromptTestRun, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	opts := []orm.QueryOption{orm.WithOrderBy("id", true), orm.WithLimit(limit)}
+	if caseID > 0 {
+		opts = append(opts, orm.WithWhere("case_id = ?", caseID))
+	}
+	if templateID > 0 {
+		opts = append(opts, orm.WithWhere("template_id = ?", templateID))
+	}
+	var list []*entity.PromptTestRun
+	model, err := r.runs.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建测试执行记录 model 失败")
+	}
+	if err := model.Find(ctx, &list, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询测试执行记录失败")
+	}
+	return list, nil
+}
+
+func (r *promptTestRepoImpl) LatestRun(ctx context.Context, caseID int64) (*entity.PromptTestRun, error) {
+	list, err := r.ListRuns(ctx, caseID, 0, 1)
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	return list[0], nil
+}
@@ -2,7 +2,11 @@ package repo
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"gochen-llm/entity"
 	"gochen/db/orm"
@@ -15,19 +19,80 @@ type PromptFilter struct {
 	Scope    *entity.PromptScope
 	ScopeID  *int64
 	Enabled  *bool
+	Status   string
+	Locale   *string // 语言区域，空字符串表示默认变体
+
+	Tags     []string          // 需同时包含的标签（TagsJSON）
+	Query    string            // 名称/内容全文模糊匹配
+	Metadata map[string]string // MetadataJSON 顶层字符串字段精确匹配
+
+	SortBy   string // 排序字段，见 promptSortColumns；为空按 name/priority/id
+	SortDesc bool
+	Limit    int // 0 表示不分页
+	Offset   int
+}
+
+// promptSortColumns 允许的排序字段
+var promptSortColumns = map[string]bool{
+	"id":         true,
+	"name":       true,
+	"priority":   true,
+	"version":    true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// ValidPromptSort 判断排序字段是否允许
+func ValidPromptSort(column string) bool {
+	return column == "" || promptSortColumns[column]
 }
 
 // PromptTemplateRepo 持久化提示词模板与版本
 type PromptTemplateRepo interface {
+	// Upsert 新增或更新模板；修改已发布模板且未显式指定 published 时只登记新版本号与草稿状态，
+	// 内容与设置由调用方通过 SaveVersion 保存为待审核版本，模板继续使用当前发布的版本与设置
 	Upsert(ctx context.Context, tmpl *entity.PromptTemplate) error
 	GetByID(ctx context.Context, id int64) (*entity.PromptTemplate, error)
-	FindEffective(ctx context.Context, name string, scope entity.PromptScope, scopeID int64) (*entity.PromptTemplate, error)
+	// FindEffective 沿作用域回退链（由具体到宽泛，全局自动追加在末尾）查找指定语言区域
+	// （精确匹配，空为默认变体）的生效模板
+	FindEffective(ctx context.Context, name string, chain []entity.PromptScopeRef, locale string) (*entity.PromptTemplate, error)
 	List(ctx context.Context, filter PromptFilter) ([]*entity.PromptTemplate, error)
+	Count(ctx context.Context, filter PromptFilter) (int64, error)
 	SaveVersion(ctx context.Context, version *entity.PromptVersion) error
 	GetVersion(ctx context.Context, templateID int64, version int) (*entity.PromptVersion, error)
+	// GetLatestVersion 返回版本号最大的版本记录（可能为尚未发布的草稿），不存在时返回 nil
+	GetLatestVersion(ctx context.Context, templateID int64) (*entity.PromptVersion, error)
+	// UpdateVersionStatus 更新单个版本的发布状态；approvedBy 非空时同时记录审核人与时间
+	UpdateVersionStatus(ctx context.Context, templateID int64, version int, status string, approvedBy *int64, approvedAt *time.Time) error
+	// PublishVersion 发布版本：版本标记为 published，并将其内容（及暂存的设置）替换为模板当前生效的内容
+	PublishVersion(ctx context.Context, version *entity.PromptVersion, approvedBy int64, approvedAt time.Time) error
 	SaveABTest(ctx context.Context, test *entity.ABTest) error
 	UpdateABTest(ctx context.Context, test *entity.ABTest) error
 	GetABTest(ctx context.Context, id int64) (*entity.ABTest, error)
+	ListABTests(ctx context.Context, status string) ([]*entity.ABTest, error)
+	IncrABExposure(ctx context.Context, testID int64, variant string) error
+	ListABExposures(ctx context.Context, testID int64) (map[string]int64, error)
+	UpdateStatus(ctx context.Context, id int64, status string, approvedBy *int64, approvedAt *time.Time) error
+	// SetEnabled 批量启用/停用模板
+	SetEnabled(ctx context.Context, ids []int64, enabled bool) error
+	// UpdateTags 更新模板标签（不生成新版本）
+	UpdateTags(ctx context.Context, id int64, tagsJSON string) error
+	SaveReview(ctx context.Context, review *entity.PromptReview) error
+	ListReviews(ctx context.Context, templateID int64) ([]*entity.PromptReview, error)
+}
+
+type promptPreviewKey struct{}
+
+// WithPromptPreview 标记为预览模式：FindEffective 可解析草稿/审核中的模板（归档除外），
+// 默认（生产模式）仅解析已发布模板。
+func WithPromptPreview(ctx context.Context) context.Context {
+	return context.WithValue(ctx, promptPreviewKey{}, true)
+}
+
+// IsPromptPreview 判断是否处于预览模式
+func IsPromptPreview(ctx context.Context) bool {
+	v, _ := ctx.Value(promptPreviewKey{}).(bool)
+	return v
 }
 
 type promptTemplateRepoImpl struct {
@@ -35,6 +100,8 @@ type promptTemplateRepoImpl struct {
 	templateModel ormModel
 	versionModel  ormModel
 	abTestModel   ormModel
+	reviewModel   ormModel
+	exposureModel ormModel
 }
 
 func NewPromptTemplateRepo(o orm.IOrm) PromptTemplateRepo {
@@ -43,6 +110,8 @@ func NewPromptTemplateRepo(o orm.IOrm) PromptTemplateRepo {
 		templateModel: newOrmModel(&entity.PromptTemplate{}, (entity.PromptTemplate{}).TableName()),
 		versionModel:  newOrmModel(&entity.PromptVersion{}, (entity.PromptVersion{}).TableName()),
 		abTestModel:   newOrmModel(&entity.ABTest{}, (entity.ABTest{}).TableName()),
+		reviewModel:   newOrmModel(&entity.PromptReview{}, (entity.PromptReview{}).TableName()),
+		exposureModel: newOrmModel(&entity.ABExposure{}, (entity.ABExposure{}).TableName()),
 	}
 }
 
@@ -62,7 +131,7 @@ func (r *promptTemplateRepoImpl) GetByID(ctx context.Context, id int64) (*entity
 	return &tmpl, nil
 }
 
-// Upsert 依据 name+scope+scope_id 覆盖或新增模板
+// Upsert 依据 name+scope+scope_id+locale 覆盖或新增模板
 func (r *promptTemplateRepoImpl) Upsert(ctx context.Context, tmpl *entity.PromptTemplate) error {
 	session, err := r.orm.Begin(ctx)
 	if err != nil {
@@ -82,7 +151,7 @@ func (r *promptTemplateRepoImpl) Upsert(ctx context.Context, tmpl *entity.Prompt
 
 	var existing entity.PromptTemplate
 	err = model.First(ctx, &existing,
-		orm.WithWhere("name = ? AND scope = ? AND scope_id = ?", tmpl.Name, tmpl.Scope, tmpl.ScopeID),
+		orm.WithWhere("name = ? AND scope = ? AND scope_id = ? AND locale = ?", tmpl.Name, tmpl.Scope, tmpl.ScopeID, tmpl.Locale),
 		orm.WithForUpdate(),
 	)
 	if err != nil && !errorx.Is(err, errorx.NotFound) {
@@ -93,27 +162,58 @@ func (r *promptTemplateRepoImpl) Upsert(ctx context.Context, tmpl *entity.Prompt
 		if tmpl.Version <= 0 {
 			tmpl.Version = 1
 		}
+		if tmpl.Status == "" {
+			tmpl.Status = entity.PromptStatusPublished
+		}
 		if err := model.Create(ctx, tmpl); err != nil {
 			return errorx.Wrap(err, errorx.Database, "创建提示词模板失败")
 		}
 	} else {
 		tmpl.ID = existing.ID
-		if tmpl.Version <= existing.Version {
-			tmpl.Version = existing.Version + 1
+		latest := existing.Version
+		versionModel, err := r.versionModel.model(session)
+		if err != nil {
+			return errorx.Wrap(err, errorx.Database, "创建提示词版本 model 失败")
+		}
+		var last entity.PromptVersion
+		err = versionModel.First(ctx, &last, orm.WithWhere("template_id = ?", existing.ID), orm.WithOrderBy("version", true))
+		if err != nil && !errorx.Is(err, errorx.NotFound) {
+			return errorx.Wrap(err, errorx.Database, "查询提示词版本失败")
+		}
+		if err == nil && last.Version > latest {
+			latest = last.Version
 		}
-		updateValues := map[string]any{
-			"category":       tmpl.Category,
-			"content":        tmpl.Content,
-			"variables_json": tmpl.VariablesJSON,
-			"version":        tmpl.Version,
-			"parent_id":      tmpl.ParentID,
-			"priority":       tmpl.Priority,
-			"enabled":        tmpl.Enabled,
-			"tags_json":      tmpl.TagsJSON,
-			"metadata_json":  tmpl.MetadataJSON,
+		if tmpl.Version <= latest {
+			tmpl.Version = latest + 1
 		}
-		if err := model.UpdateValues(ctx, updateValues, orm.WithWhere("id = ?", existing.ID)); err != nil {
-			return errorx.Wrap(err, errorx.Database, "更新提示词模板失败")
+		updateValues := map[string]any{}
+		staged := existing.Status == entity.PromptStatusPublished &&
+			(tmpl.Status == "" || tmpl.Status == entity.PromptStatusDraft || tmpl.Status == entity.PromptStatusInReview)
+		if staged {
+			// 已发布的版本继续生效，新内容与设置作为草稿版本等待审核发布
+			if tmpl.Status == "" {
+				tmpl.Status = entity.PromptStatusDraft
+			}
+		} else {
+			updateValues["category"] = tmpl.Category
+			updateValues["parent_id"] = tmpl.ParentID
+			updateValues["priority"] = tmpl.Priority
+			updateValues["enabled"] = tmpl.Enabled
+			updateValues["tags_json"] = tmpl.TagsJSON
+			updateValues["metadata_json"] = tmpl.MetadataJSON
+			updateValues["content"] = tmpl.Content
+			updateValues["variables_json"] = tmpl.VariablesJSON
+			updateValues["version"] = tmpl.Version
+			if tmpl.Status != "" {
+				updateValues["status"] = tmpl.Status
+			} else {
+				tmpl.Status = existing.Status
+			}
+		}
+		if len(updateValues) > 0 {
+			if err := model.UpdateValues(ctx, updateValues, orm.WithWhere("id = ?", existing.ID)); err != nil {
+				return errorx.Wrap(err, errorx.Database, "更新提示词模板失败")
+			}
 		}
 	}
 
@@ -124,31 +224,32 @@ func (r *promptTemplateRepoImpl) Upsert(ctx context.Context, tmpl *entity.Prompt
 	return nil
 }
 
-// FindEffective 获取作用域内优先级最高的提示词模板（避免跨作用域串租）
-// 仅在当前作用域与全局作用域中查找，防止 user/project/org 之间因相同 ID 误匹配。
-func (r *promptTemplateRepoImpl) FindEffective(ctx context.Context, name string, scope entity.PromptScope, scopeID int64) (*entity.PromptTemplate, error) {
-	scopeOrder := fmt.Sprintf(`
-		CASE 
-			WHEN scope = '%s' AND scope_id = %d THEN 1
-			WHEN scope = '%s' THEN 2
-			ELSE 3
-		END`,
-		scope, scopeID,
-		entity.PromptScopeGlobal,
-	)
+// FindEffective 获取作用域回退链上优先级最高的提示词模板
+// 仅在链上显式列出的作用域与全局作用域中查找，防止 user/project/org 之间因相同 ID 误匹配。
+// 排序确定：链上位置（越具体越优先）→ priority → id。
+// 生产模式仅返回已发布模板，见 WithPromptPreview。
+func (r *promptTemplateRepoImpl) FindEffective(ctx context.Context, name string, chain []entity.PromptScopeRef, locale string) (*entity.PromptTemplate, error) {
+	where, args, order := effectiveScopeClause(chain)
 
 	var tmpl entity.PromptTemplate
 	model, err := r.templateModel.model(r.orm)
 	if err != nil {
 		return nil, errorx.Wrap(err, errorx.Database, "创建提示词模板 model 失败")
 	}
-	err = model.First(ctx, &tmpl,
-		orm.WithWhere("name = ? AND enabled = ?", name, true),
-		orm.WithWhere("(scope = ? AND scope_id = 0) OR (scope = ? AND scope_id = ?)", entity.PromptScopeGlobal, scope, scopeID),
-		orm.WithOrderBy(scopeOrder, false),
-		orm.WithOrderBy("priority", false),
-		orm.WithOrderBy("id", false),
-	)
+	statusWhere := orm.WithWhere("status = ?", entity.PromptStatusPublished)
+	if IsPromptPreview(ctx) {
+		statusWhere = orm.WithWhere("status <> ?", entity.PromptStatusArchived)
+	}
+	opts := []orm.QueryOption{
+		orm.WithWhere("name = ? AND enabled = ? AND locale = ?", name, true, locale),
+		orm.WithWhere(where, args...),
+		statusWhere,
+	}
+	if order != "" {
+		opts = append(opts, orm.WithOrderBy(order, false))
+	}
+	opts = append(opts, orm.WithOrderBy("priority", false), orm.WithOrderBy("id", false))
+	err = model.First(ctx, &tmpl, opts...)
 	if err != nil {
 		if errorx.Is(err, errorx.NotFound) {
 			return nil, nil
@@ -158,8 +259,81 @@ func (r *promptTemplateRepoImpl) FindEffective(ctx context.Context, name string,
 	return &tmpl, nil
 }
 
+// effectiveScopeClause 生成作用域回退链的过滤条件与排序表达式：链上作用域按出现顺序排名 1..n，
+// 全局排在最后；非法作用域与链中的全局项忽略（全局总是追加在末尾）。
+// 仅查全局时只有一个候选作用域，返回空排序表达式（CASE 至少需要一个 WHEN 分支）
+func effectiveScopeClause(chain []entity.PromptScopeRef) (string, []any, string) {
+	var (
+		conds []string
+		args  []any
+		order strings.Builder
+	)
+	order.WriteString("CASE")
+	rank := 0
+	for _, ref := range chain {
+		if ref.Scope == entity.PromptScopeGlobal || ref.Scope.Rank() == 0 {
+			continue
+		}
+		rank++
+		conds = append(conds, "(scope = ? AND scope_id = ?)")
+		args = append(args, ref.Scope, ref.ScopeID)
+		// 作用域取值来自常量且已校验，ID 为整数，可安全拼接到排序表达式
+		fmt.Fprintf(&order, " WHEN scope = '%s' AND scope_id = %d THEN %d", ref.Scope, ref.ScopeID, rank)
+	}
+	conds = append(conds, "(scope = ? AND scope_id = 0)")
+	args = append(args, entity.PromptScopeGlobal)
+	where := "(" + strings.Join(conds, " OR ") + ")"
+	if rank == 0 {
+		return where, args, ""
+	}
+	fmt.Fprintf(&order, " ELSE %d END", rank+1)
+	return where, args, order.String()
+}
+
 // List 列出提示词模板
 func (r *promptTemplateRepoImpl) List(ctx context.Context, filter PromptFilter) ([]*entity.PromptTemplate, error) {
+	opts := buildPromptOptions(filter)
+	if filter.SortBy != "" && promptSortColumns[filter.SortBy] {
+		opts = append(opts, orm.WithOrderBy(filter.SortBy, filter.SortDesc), orm.WithOrderBy("id", false))
+	} else {
+		opts = append(opts,
+			orm.WithOrderBy("name", false),
+			orm.WithOrderBy("priority", false),
+			orm.WithOrderBy("id", false),
+		)
+	}
+	if filter.Limit > 0 {
+		opts = append(opts, orm.WithLimit(filter.Limit))
+		if filter.Offset > 0 {
+			opts = append(opts, orm.WithOffset(filter.Offset))
+		}
+	}
+
+	var list []*entity.PromptTemplate
+	model, err := r.templateModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建提示词模板 model 失败")
+	}
+	if err := model.Find(ctx, &list, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询提示词模板列表失败")
+	}
+	return list, nil
+}
+
+// Count 统计满足过滤条件的模板数（忽略分页与排序）
+func (r *promptTemplateRepoImpl) Count(ctx context.Context, filter PromptFilter) (int64, error) {
+	model, err := r.templateModel.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建提示词模板 model 失败")
+	}
+	total, err := model.Count(ctx, buildPromptOptions(filter)...)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "统计提示词模板失败")
+	}
+	return total, nil
+}
+
+func buildPromptOptions(filter PromptFilter) []orm.QueryOption {
 	opts := []orm.QueryOption{}
 	if filter.Name != "" {
 		opts = append(opts, orm.WithWhere("name = ?", filter.Name))
@@ -176,21 +350,52 @@ func (r *promptTemplateRepoImpl) List(ctx context.Context, filter PromptFilter)
 	if filter.Enabled != nil {
 		opts = append(opts, orm.WithWhere("enabled = ?", *filter.Enabled))
 	}
-	opts = append(opts,
-		orm.WithOrderBy("name", false),
-		orm.WithOrderBy("priority", false),
-		orm.WithOrderBy("id", false),
-	)
-
-	var list []*entity.PromptTemplate
-	model, err := r.templateModel.model(r.orm)
-	if err != nil {
-		return nil, errorx.Wrap(err, errorx.Database, "创建提示词模板 model 失败")
+	if filter.Status != "" {
+		opts = append(opts, orm.WithWhere("status = ?", filter.Status))
 	}
-	if err := model.Find(ctx, &list, opts...); err != nil {
-		return nil, errorx.Wrap(err, errorx.Database, "查询提示词模板列表失败")
+	if filter.Locale != nil {
+		opts = append(opts, orm.WithWhere("locale = ?", *filter.Locale))
 	}
-	return list, nil
+	// TagsJSON 为 JSON 字符串数组，按带引号的元素匹配，避免 "ai" 命中 "aide"
+	for _, tag := range filter.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		opts = append(opts, orm.WithWhere("tags_json LIKE ?", "%"+escapeLike(jsonQuote(tag))+"%"))
+	}
+	if q := strings.TrimSpace(filter.Query); q != "" {
+		pattern := "%" + escapeLike(q) + "%"
+		opts = append(opts, orm.WithWhere("(name LIKE ? OR content LIKE ?)", pattern, pattern))
+	}
+	// MetadataJSON 由 json.Marshal 生成（紧凑格式），同时兼容手写的 "key": "value" 格式
+	for _, key := range sortedKeys(filter.Metadata) {
+		compact := escapeLike(jsonQuote(key) + ":" + jsonQuote(filter.Metadata[key]))
+		spaced := escapeLike(jsonQuote(key) + ": " + jsonQuote(filter.Metadata[key]))
+		opts = append(opts, orm.WithWhere("(metadata_json LIKE ? OR metadata_json LIKE ?)", "%"+compact+"%", "%"+spaced+"%"))
+	}
+	return opts
+}
+
+// escapeLike 转义 LIKE 通配符（默认转义符为反斜杠）
+func escapeLike(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "%", `\%`)
+	return strings.ReplaceAll(s, "_", `\_`)
+}
+
+func jsonQuote(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func (r *promptTemplateRepoImpl) SaveVersion(ctx context.Context, version *entity.PromptVersion) error {
@@ -200,6 +405,9 @@ func (r *promptTemplateRepoImpl) SaveVersion(ctx context.Context, version *entit
 	if version.Version == 0 {
 		version.Version = 1
 	}
+	if version.Status == "" {
+		version.Status = entity.PromptStatusPublished
+	}
 	model, err := r.versionModel.model(r.orm)
 	if err != nil {
 		return errorx.Wrap(err, errorx.Database, "创建提示词版本 model 失败")
@@ -228,6 +436,103 @@ func (r *promptTemplateRepoImpl) GetVersion(ctx context.Context, templateID int6
 	return &v, nil
 }
 
+func (r *promptTemplateRepoImpl) GetLatestVersion(ctx context.Context, templateID int64) (*entity.PromptVersion, error) {
+	var v entity.PromptVersion
+	model, err := r.versionModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建提示词版本 model 失败")
+	}
+	err = model.First(ctx, &v,
+		orm.WithWhere("template_id = ?", templateID),
+		orm.WithOrderBy("version", true),
+	)
+	if err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, nil
+		}
+		return nil, errorx.Wrap(err, errorx.Database, "查询提示词版本失败")
+	}
+	return &v, nil
+}
+
+func (r *promptTemplateRepoImpl) UpdateVersionStatus(ctx context.Context, templateID int64, version int, status string, approvedBy *int64, approvedAt *time.Time) error {
+	model, err := r.versionModel.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建提示词版本 model 失败")
+	}
+	values := map[string]any{"status": status}
+	if approvedBy != nil {
+		values["approved_by"] = *approvedBy
+		values["approved_at"] = approvedAt
+	}
+	if err := model.UpdateValues(ctx, values, orm.WithWhere("template_id = ? AND version = ?", templateID, version)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新提示词版本状态失败")
+	}
+	return nil
+}
+
+// PublishVersion 在同一事务内更新版本状态与模板的生效内容
+func (r *promptTemplateRepoImpl) PublishVersion(ctx context.Context, version *entity.PromptVersion, approvedBy int64, approvedAt time.Time) error {
+	if version == nil || version.TemplateID <= 0 {
+		return errorx.New(errorx.InvalidInput, "提示词版本无效")
+	}
+	session, err := r.orm.Begin(ctx)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "开启提示词发布事务失败")
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = session.Rollback()
+		}
+	}()
+
+	versionModel, err := r.versionModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建提示词版本 model 失败")
+	}
+	if err := versionModel.UpdateValues(ctx, map[string]any{
+		"status":      entity.PromptStatusPublished,
+		"approved_by": approvedBy,
+		"approved_at": approvedAt,
+	}, orm.WithWhere("template_id = ? AND version = ?", version.TemplateID, version.Version)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新提示词版本状态失败")
+	}
+	templateModel, err := r.templateModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建提示词模板 model 失败")
+	}
+	values := map[string]any{
+		"content":        version.Content,
+		"variables_json": version.VariablesJSON,
+		"version":        version.Version,
+		"status":         entity.PromptStatusPublished,
+		"approved_by":    approvedBy,
+		"approved_at":    approvedAt,
+	}
+	if version.SettingsJSON != "" {
+		var settings entity.PromptSettings
+		if err := json.Unmarshal([]byte(version.SettingsJSON), &settings); err != nil {
+			return errorx.Wrap(err, errorx.Validation, "解析提示词版本设置失败")
+		}
+		values["category"] = settings.Category
+		values["parent_id"] = settings.ParentID
+		values["priority"] = settings.Priority
+		values["enabled"] = settings.Enabled
+		values["tags_json"] = settings.TagsJSON
+		values["metadata_json"] = settings.MetadataJSON
+	}
+	if err := templateModel.UpdateValues(ctx, values, orm.WithWhere("id = ?", version.TemplateID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "发布提示词版本失败")
+	}
+
+	if err := session.Commit(); err != nil {
+		return errorx.Wrap(err, errorx.Database, "提交提示词发布事务失败")
+	}
+	committed = true
+	return nil
+}
+
 func (r *promptTemplateRepoImpl) SaveABTest(ctx context.Context, test *entity.ABTest) error {
 	if test == nil {
 		return errorx.New(errorx.InvalidInput, "A/B 测试不能为空")
@@ -274,3 +579,162 @@ func (r *promptTemplateRepoImpl) GetABTest(ctx context.Context, id int64) (*enti
 	}
 	return &test, nil
 }
+
+// ListABTests 按状态列出 A/B 测试，status 为空时返回全部
+func (r *promptTemplateRepoImpl) ListABTests(ctx context.Context, status string) ([]*entity.ABTest, error) {
+	opts := []orm.QueryOption{orm.WithOrderBy("id", false)}
+	if status != "" {
+		opts = append(opts, orm.WithWhere("status = ?", status))
+	}
+	var list []*entity.ABTest
+	model, err := r.abTestModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 A/B 测试 model 失败")
+	}
+	if err := model.Find(ctx, &list, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询 A/B 测试列表失败")
+	}
+	return list, nil
+}
+
+// IncrABExposure 在事务内对 (测试, 变体) 行加锁自增曝光数；首次插入遇到并发唯一键冲突时重试一次
+func (r *promptTemplateRepoImpl) IncrABExposure(ctx context.Context, testID int64, variant string) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if err = r.incrABExposure(ctx, testID, variant); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (r *promptTemplateRepoImpl) incrABExposure(ctx context.Context, testID int64, variant string) error {
+	session, err := r.orm.Begin(ctx)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "开启曝光计数事务失败")
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = session.Rollback()
+		}
+	}()
+
+	model, err := r.exposureModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建曝光计数 model 失败")
+	}
+
+	var row entity.ABExposure
+	err = model.First(ctx, &row,
+		orm.WithWhere("ab_test_id = ? AND variant = ?", testID, variant),
+		orm.WithForUpdate(),
+	)
+	if err != nil {
+		if !errorx.Is(err, errorx.NotFound) {
+			return errorx.Wrap(err, errorx.Database, "查询曝光计数失败")
+		}
+		row = entity.ABExposure{ABTestID: testID, Variant: variant, Count: 1}
+		if err := model.Create(ctx, &row); err != nil {
+			return errorx.Wrap(err, errorx.Database, "创建曝光计数失败")
+		}
+	} else {
+		if err := model.UpdateValues(ctx, map[string]any{"count": row.Count + 1}, orm.WithWhere("id = ?", row.ID)); err != nil {
+			return errorx.Wrap(err, errorx.Database, "更新曝光计数失败")
+		}
+	}
+
+	if err := session.Commit(); err != nil {
+		return errorx.Wrap(err, errorx.Database, "提交曝光计数事务失败")
+	}
+	committed = true
+	return nil
+}
+
+// ListABExposures 返回测试各变体的曝光数
+func (r *promptTemplateRepoImpl) ListABExposures(ctx context.Context, testID int64) (map[string]int64, error) {
+	var rows []*entity.ABExposure
+	model, err := r.exposureModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建曝光计数 model 失败")
+	}
+	if err := model.Find(ctx, &rows, orm.WithWhere("ab_test_id = ?", testID)); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询曝光计数失败")
+	}
+	result := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		result[row.Variant] = row.Count
+	}
+	return result, nil
+}
+
+// UpdateStatus 更新模板发布状态；approvedBy 非空时同时记录审核人与时间
+func (r *promptTemplateRepoImpl) UpdateStatus(ctx context.Context, id int64, status string, approvedBy *int64, approvedAt *time.Time) error {
+	model, err := r.templateModel.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建提示词模板 model 失败")
+	}
+	values := map[string]any{"status": status}
+	if approvedBy != nil {
+		values["approved_by"] = *approvedBy
+		values["approved_at"] = approvedAt
+	}
+	if err := model.UpdateValues(ctx, values, orm.WithWhere("id = ?", id)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新提示词模板状态失败")
+	}
+	return nil
+}
+
+func (r *promptTemplateRepoImpl) SetEnabled(ctx context.Context, ids []int64, enabled bool) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	model, err := r.templateModel.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建提示词模板 model 失败")
+	}
+	if err := model.UpdateValues(ctx, map[string]any{"enabled": enabled}, orm.WithWhere("id IN ?", ids)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "批量更新提示词模板启用状态失败")
+	}
+	return nil
+}
+
+func (r *promptTemplateRepoImpl) UpdateTags(ctx context.Context, id int64, tagsJSON string) error {
+	model, err := r.templateModel.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建提示词模板 model 失败")
+	}
+	if err := model.UpdateValues(ctx, map[string]any{"tags_json": tagsJSON}, orm.WithWhere("id = ?", id)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新提示词模板标签失败")
+	}
+	return nil
+}
+
+func (r *promptTemplateRepoImpl) SaveReview(ctx context.Context, review *entity.PromptReview) error {
+	if review == nil {
+		return nil
+	}
+	model, err := r.reviewModel.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建提示词审核记录 model 失败")
+	}
+	if err := model.Create(ctx, review); err != nil {
+		return errorx.Wrap(err, errorx.Database, "保存提示词审核记录失败")
+	}
+	return nil
+}
+
+func (r *promptTemplateRepoImpl) ListReviews(ctx context.Context, templateID int64) ([]*entity.PromptReview, error) {
+	var list []*entity.PromptReview
+	model, err := r.reviewModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建提示词审核记录 model 失败")
+	}
+	if err := model.Find(ctx, &list,
+		orm.WithWhere("template_id = ?", templateID),
+		orm.WithOrderBy("id", true),
+	); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询提示词审核记录失败")
+	}
+	return list, nil
+}
@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"database/sql"
+	"testing"
+
+	"gochen-llm/entity"
+
+	_ "modernc.org/sqlite"
+)
+
+// TestEffectiveScopeClauseSQLite 在 SQLite 上执行与 FindEffective 相同的过滤与排序，验证生成的 SQL 可执行且按
+// user → project → org → global 选取
+func TestEffectiveScopeClauseSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE llm_prompt_templates (
+		id INTEGER PRIMARY KEY, name TEXT, scope TEXT, scope_id INTEGER, priority INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	rows := []struct {
+		id       int64
+		scope    entity.PromptScope
+		scopeID  int64
+		priority int
+	}{
+		{1, entity.PromptScopeGlobal, 0, 100},
+		{2, entity.PromptScopeOrg, 3, 100},
+		{3, entity.PromptScopeProject, 2, 100},
+		{4, entity.PromptScopeUser, 1, 100},
+		{5, entity.PromptScopeUser, 8, 100}, // 其他用户的模板不应命中
+		{6, entity.PromptScopeGlobal, 0, 50},
+	}
+	for _, r := range rows {
+		if _, err := db.Exec(`INSERT INTO llm_prompt_templates (id, name, scope, scope_id, priority) VALUES (?, 'greeting', ?, ?, ?)`,
+			r.id, string(r.scope), r.scopeID, r.priority); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	user := entity.PromptScopeRef{Scope: entity.PromptScopeUser, ScopeID: 1}
+	project := entity.PromptScopeRef{Scope: entity.PromptScopeProject, ScopeID: 2}
+	org := entity.PromptScopeRef{Scope: entity.PromptScopeOrg, ScopeID: 3}
+	tests := []struct {
+		name  string
+		chain []entity.PromptScopeRef
+		want  int64
+	}{
+		{name: "global only picks lowest priority", want: 6},
+		{name: "user first", chain: []entity.PromptScopeRef{user, project, org}, want: 4},
+		{name: "project before org", chain: []entity.PromptScopeRef{{Scope: entity.PromptScopeUser, ScopeID: 9}, project, org}, want: 3},
+		{name: "org before global", chain: []entity.PromptScopeRef{org}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args, order := effectiveScopeClause(tt.chain)
+			query := "SELECT id FROM llm_prompt_templates WHERE name = ? AND " + where + " ORDER BY "
+			if order != "" {
+				query += order + ", "
+			}
+			query += "priority, id LIMIT 1"
+			queryArgs := []any{"greeting"}
+			for _, a := range args {
+				if s, ok := a.(entity.PromptScope); ok {
+					a = string(s)
+				}
+				queryArgs = append(queryArgs, a)
+			}
+			var got int64
+			if err := db.QueryRow(query, queryArgs...).Scan(&got); err != nil {
+				t.Fatalf("query %q: %v", query, err)
+			}
+			if got != tt.want {
+				t.Fatalf("selected template %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package repo
+
+import (
+	"reflect"
+	"testing"
+
+	"gochen-llm/entity"
+)
+
+func TestEffectiveScopeClause(t *testing.T) {
+	tests := []struct {
+		name      string
+		chain     []entity.PromptScopeRef
+		wantWhere string
+		wantArgs  []any
+		wantOrder string
+	}{
+		{
+			name:      "global only",
+			wantWhere: "((scope = ? AND scope_id = 0))",
+			wantArgs:  []any{entity.PromptScopeGlobal},
+			wantOrder: "",
+		},
+		{
+			name: "user then project then org then global",
+			chain: []entity.PromptScopeRef{
+				{Scope: entity.PromptScopeUser, ScopeID: 1},
+				{Scope: entity.PromptScopeProject, ScopeID: 2},
+				{Scope: entity.PromptScopeOrg, ScopeID: 3},
+			},
+			wantWhere: "((scope = ? AND scope_id = ?) OR (scope = ? AND scope_id = ?) OR (scope = ? AND scope_id = ?) OR (scope = ? AND scope_id = 0))",
+			wantArgs: []any{
+				entity.PromptScopeUser, int64(1),
+				entity.PromptScopeProject, int64(2),
+				entity.PromptScopeOrg, int64(3),
+				entity.PromptScopeGlobal,
+			},
+			wantOrder: "CASE WHEN scope = 'user' AND scope_id = 1 THEN 1" +
+				" WHEN scope = 'project' AND scope_id = 2 THEN 2" +
+				" WHEN scope = 'org' AND scope_id = 3 THEN 3 ELSE 4 END",
+		},
+		{
+			name: "global and unknown scopes in chain skipped",
+			chain: []entity.PromptScopeRef{
+				{Scope: entity.PromptScopeUser, ScopeID: 1},
+				{Scope: entity.PromptScopeGlobal},
+				{Scope: "team", ScopeID: 5},
+				{Scope: entity.PromptScopeOrg, ScopeID: 3},
+			},
+			wantWhere: "((scope = ? AND scope_id = ?) OR (scope = ? AND scope_id = ?) OR (scope = ? AND scope_id = 0))",
+			wantArgs: []any{
+				entity.PromptScopeUser, int64(1),
+				entity.PromptScopeOrg, int64(3),
+				entity.PromptScopeGlobal,
+			},
+			wantOrder: "CASE WHEN scope = 'user' AND scope_id = 1 THEN 1" +
+				" WHEN scope = 'org' AND scope_id = 3 THEN 2 ELSE 3 END",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where, args, order := effectiveScopeClause(tt.chain)
+			if where != tt.wantWhere {
+				t.Errorf("where = %q, want %q", where, tt.wantWhere)
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+			if order != tt.wantOrder {
+				t.Errorf("order = %q, want %q", order, tt.wantOrder)
+			}
+		})
+	}
+}
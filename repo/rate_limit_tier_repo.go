@@ -0,0 +1,146 @@
+package repo
+
+import (
+	"context"
+
+	"gochen-llm/entity"
+	"gochen/db/orm"
+	"gochen/errorx"
+)
+
+// RateLimitTierRepo 管理限流等级及用户的等级分配
+type RateLimitTierRepo interface {
+	ListTiers(ctx context.Context) ([]*entity.RateLimitTier, error)
+	// SaveTier 按名称新增或覆盖
+	SaveTier(ctx context.Context, tier *entity.RateLimitTier) error
+	// GetUserTier 返回用户分配的等级名称，未分配时返回空字符串
+	GetUserTier(ctx context.Context, userID int64) (string, error)
+	// SetUserTier 为用户分配等级，tier 为空时取消分配
+	SetUserTier(ctx context.Context, userID int64, tier string, actorID int64) error
+	ListUserTiers(ctx context.Context, tier string, limit, offset int) ([]*entity.UserRateLimitTier, int64, error)
+}
+
+type rateLimitTierRepoImpl struct {
+	orm       orm.IOrm
+	tiers     ormModel
+	userTiers ormModel
+}
+
+func NewRateLimitTierRepo(o orm.IOrm) RateLimitTierRepo {
+	return &rateLimitTierRepoImpl{
+		orm:       o,
+		tiers:     newOrmModel(&entity.RateLimitTier{}, (entity.RateLimitTier{}).TableName()),
+		userTiers: newOrmModel(&entity.UserRateLimitTier{}, (entity.UserRateLimitTier{}).TableName()),
+	}
+}
+
+func (r *rateLimitTierRepoImpl) ListTiers(ctx context.Context) ([]*entity.RateLimitTier, error) {
+	var list []*entity.RateLimitTier
+	model, err := r.tiers.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建限流等级 model 失败")
+	}
+	if err := model.Find(ctx, &list, orm.WithOrderBy("name", false)); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询限流等级失败")
+	}
+	return list, nil
+}
+
+func (r *rateLimitTierRepoImpl) SaveTier(ctx context.Context, tier *entity.RateLimitTier) error {
+	if tier == nil || tier.Name == "" {
+		return errorx.New(errorx.InvalidInput, "限流等级名称不能为空")
+	}
+	model, err := r.tiers.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建限流等级 model 失败")
+	}
+	var existing entity.RateLimitTier
+	err = model.First(ctx, &existing, orm.WithWhere("name = ?", tier.Name))
+	if err != nil && !errorx.Is(err, errorx.NotFound) {
+		return errorx.Wrap(err, errorx.Database, "查询限流等级失败")
+	}
+	if err != nil {
+		tier.ID = 0
+		if err := model.Create(ctx, tier); err != nil {
+			return errorx.Wrap(err, errorx.Database, "创建限流等级失败")
+		}
+		return nil
+	}
+	tier.ID, tier.CreatedAt = existing.ID, existing.CreatedAt
+	if err := model.Save(ctx, tier, orm.WithWhere("id = ?", tier.ID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新限流等级失败")
+	}
+	return nil
+}
+
+func (r *rateLimitTierRepoImpl) GetUserTier(ctx context.Context, userID int64) (string, error) {
+	var row entity.UserRateLimitTier
+	model, err := r.userTiers.model(r.orm)
+	if err != nil {
+		return "", errorx.Wrap(err, errorx.Database, "创建用户限流等级 model 失败")
+	}
+	if err := model.First(ctx, &row, orm.WithWhere("user_id = ?", userID)); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return "", nil
+		}
+		return "", errorx.Wrap(err, errorx.Database, "查询用户限流等级失败")
+	}
+	return row.Tier, nil
+}
+
+func (r *rateLimitTierRepoImpl) SetUserTier(ctx context.Context, userID int64, tier string, actorID int64) error {
+	if userID <= 0 {
+		return errorx.New(errorx.InvalidInput, "userID 无效")
+	}
+	model, err := r.userTiers.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建用户限流等级 model 失败")
+	}
+	if tier == "" {
+		if err := model.Delete(ctx, orm.WithWhere("user_id = ?", userID)); err != nil {
+			return errorx.Wrap(err, errorx.Database, "取消用户限流等级失败")
+		}
+		return nil
+	}
+	var existing entity.UserRateLimitTier
+	err = model.First(ctx, &existing, orm.WithWhere("user_id = ?", userID))
+	if err != nil && !errorx.Is(err, errorx.NotFound) {
+		return errorx.Wrap(err, errorx.Database, "查询用户限流等级失败")
+	}
+	if err != nil {
+		if err := model.Create(ctx, &entity.UserRateLimitTier{UserID: userID, Tier: tier, UpdatedBy: actorID}); err != nil {
+			return errorx.Wrap(err, errorx.Database, "分配用户限流等级失败")
+		}
+		return nil
+	}
+	if err := model.UpdateValues(ctx, map[string]any{"tier": tier, "updated_by": actorID}, orm.WithWhere("id = ?", existing.ID)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "更新用户限流等级失败")
+	}
+	return nil
+}
+
+func (r *rateLimitTierRepoImpl) ListUserTiers(ctx context.Context, tier string, limit, offset int) ([]*entity.UserRateLimitTier, int64, error) {
+	opts := []orm.QueryOption{}
+	if tier != "" {
+		opts = append(opts, orm.WithWhere("tier = ?", tier))
+	}
+	model, err := r.userTiers.model(r.orm)
+	if err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "创建用户限流等级 model 失败")
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	total, err := model.Count(ctx, opts...)
+	if err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "统计用户限流等级失败")
+	}
+	var list []*entity.UserRateLimitTier
+	if err := model.Find(ctx, &list, append(opts, orm.WithOrderBy("user_id", false), orm.WithLimit(limit), orm.WithOffset(offset))...); err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "查询用户限流等级失败")
+	}
+	return list, total, nil
+}
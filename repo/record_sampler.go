@@ -0,0 +1,11 @@
+package repo
+
+import "gochen-llm/entity"
+
+// RecordSampler 写入时对调用指标与审计日志采样，用于控制高流量部署的存储量
+type RecordSampler interface {
+	// MetricsWeight 返回指标记录的样本权重：0 表示不写入，n 表示写入的记录代表 n 条调用
+	MetricsWeight(m *entity.Metrics) int
+	// KeepAuditPayload 返回是否保存审计日志的请求/响应正文；不保存时仍写入审计记录本身
+	KeepAuditPayload(log *entity.AuditLog) bool
+}
@@ -2,37 +2,58 @@ package repo
 
 import (
 	"context"
+	"encoding/json"
+	"strings"
+	"time"
 
 	"gochen-llm/entity"
 	"gochen/db/orm"
 	"gochen/errorx"
 )
 
-// SafetyPolicyRepo 管理系统级 LLM 安全策略
+// SafetyPolicyRepo 管理 LLM 安全策略（全局及组织/项目/会话类型作用域）
 type SafetyPolicyRepo interface {
+	// GetActive 返回全局策略
 	GetActive(ctx context.Context) (*entity.SafetyPolicy, error)
-	Save(ctx context.Context, policy *entity.SafetyPolicy) error
+	// Resolve 按 chain 顺序返回第一条存在的作用域策略，均不存在时返回全局策略
+	Resolve(ctx context.Context, chain []entity.SafetyScopeRef) (*entity.SafetyPolicy, error)
+	Get(ctx context.Context, scope, scopeKey string) (*entity.SafetyPolicy, error)
+	List(ctx context.Context) ([]*entity.SafetyPolicy, error)
+	// Save 按 (scope, scope_key) 新增或覆盖，版本号递增并写入版本快照
+	Save(ctx context.Context, policy *entity.SafetyPolicy, changeLog string) error
+	GetByID(ctx context.Context, id int64) (*entity.SafetyPolicy, error)
+	ListVersions(ctx context.Context, policyID int64) ([]*entity.SafetyPolicyVersion, error)
+	GetVersion(ctx context.Context, policyID int64, version int) (*entity.SafetyPolicyVersion, error)
 }
 
 type safetyPolicyRepoImpl struct {
-	orm   orm.IOrm
-	model ormModel
+	orm          orm.IOrm
+	model        ormModel
+	versionModel ormModel
 }
 
 func NewSafetyPolicyRepo(o orm.IOrm) SafetyPolicyRepo {
 	return &safetyPolicyRepoImpl{
-		orm:   o,
-		model: newOrmModel(&entity.SafetyPolicy{}, (entity.SafetyPolicy{}).TableName()),
+		orm:          o,
+		model:        newOrmModel(&entity.SafetyPolicy{}, (entity.SafetyPolicy{}).TableName()),
+		versionModel: newOrmModel(&entity.SafetyPolicyVersion{}, (entity.SafetyPolicyVersion{}).TableName()),
 	}
 }
 
 func (r *safetyPolicyRepoImpl) GetActive(ctx context.Context) (*entity.SafetyPolicy, error) {
+	return r.Get(ctx, entity.SafetyScopeGlobal, "")
+}
+
+func (r *safetyPolicyRepoImpl) Get(ctx context.Context, scope, scopeKey string) (*entity.SafetyPolicy, error) {
 	var policy entity.SafetyPolicy
 	model, err := r.model.model(r.orm)
 	if err != nil {
 		return nil, errorx.Wrap(err, errorx.Database, "创建 LLM safety policy model 失败")
 	}
-	err = model.First(ctx, &policy, orm.WithWhere("id = ?", 1))
+	err = model.First(ctx, &policy,
+		orm.WithWhere("scope = ? AND scope_key = ?", scope, scopeKey),
+		orm.WithOrderBy("id", false),
+	)
 	if err != nil {
 		if errorx.Is(err, errorx.NotFound) {
 			return nil, nil
@@ -42,17 +63,165 @@ func (r *safetyPolicyRepoImpl) GetActive(ctx context.Context) (*entity.SafetyPol
 	return &policy, nil
 }
 
-func (r *safetyPolicyRepoImpl) Save(ctx context.Context, policy *entity.SafetyPolicy) error {
+func (r *safetyPolicyRepoImpl) Resolve(ctx context.Context, chain []entity.SafetyScopeRef) (*entity.SafetyPolicy, error) {
+	if len(chain) == 0 {
+		return r.GetActive(ctx)
+	}
+	conds := make([]string, 0, len(chain)+1)
+	args := make([]any, 0, 2*len(chain)+2)
+	for _, ref := range chain {
+		conds = append(conds, "(scope = ? AND scope_key = ?)")
+		args = append(args, ref.Scope, ref.Key)
+	}
+	conds = append(conds, "(scope = ? AND scope_key = ?)")
+	args = append(args, entity.SafetyScopeGlobal, "")
+
+	var list []*entity.SafetyPolicy
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 LLM safety policy model 失败")
+	}
+	if err := model.Find(ctx, &list, orm.WithWhere(strings.Join(conds, " OR "), args...)); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询 LLM 安全配置失败")
+	}
+	for _, ref := range append(chain, entity.SafetyScopeRef{Scope: entity.SafetyScopeGlobal}) {
+		for _, p := range list {
+			if p.Scope == ref.Scope && p.ScopeKey == ref.Key {
+				return p, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (r *safetyPolicyRepoImpl) List(ctx context.Context) ([]*entity.SafetyPolicy, error) {
+	var list []*entity.SafetyPolicy
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 LLM safety policy model 失败")
+	}
+	if err := model.Find(ctx, &list, orm.WithOrderBy("scope", false), orm.WithOrderBy("scope_key", false)); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询 LLM 安全配置列表失败")
+	}
+	return list, nil
+}
+
+func (r *safetyPolicyRepoImpl) Save(ctx context.Context, policy *entity.SafetyPolicy, changeLog string) error {
 	if policy == nil {
 		return nil
 	}
-	policy.ID = 1
-	model, err := r.model.model(r.orm)
+	if policy.Scope == "" {
+		policy.Scope = entity.SafetyScopeGlobal
+	}
+	if policy.Scope == entity.SafetyScopeGlobal {
+		policy.ScopeKey = ""
+	}
+
+	session, err := r.orm.Begin(ctx)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "开启 LLM 安全配置事务失败")
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = session.Rollback()
+		}
+	}()
+
+	model, err := r.model.model(session)
 	if err != nil {
 		return errorx.Wrap(err, errorx.Database, "创建 LLM safety policy model 失败")
 	}
-	if err := model.Save(ctx, policy); err != nil {
-		return errorx.Wrap(err, errorx.Database, "保存 LLM 安全配置失败")
+	var existing entity.SafetyPolicy
+	err = model.First(ctx, &existing,
+		orm.WithWhere("scope = ? AND scope_key = ?", policy.Scope, policy.ScopeKey),
+		orm.WithForUpdate(),
+	)
+	if err != nil && !errorx.Is(err, errorx.NotFound) {
+		return errorx.Wrap(err, errorx.Database, "查询 LLM 安全配置失败")
 	}
+	if errorx.Is(err, errorx.NotFound) {
+		policy.ID = 0
+		policy.Version = 1
+		if err := model.Create(ctx, policy); err != nil {
+			return errorx.Wrap(err, errorx.Database, "保存 LLM 安全配置失败")
+		}
+	} else {
+		policy.ID = existing.ID
+		policy.Version = existing.Version + 1
+		policy.CreatedAt = existing.CreatedAt
+		if err := model.Save(ctx, policy, orm.WithWhere("id = ?", policy.ID)); err != nil {
+			return errorx.Wrap(err, errorx.Database, "保存 LLM 安全配置失败")
+		}
+	}
+
+	snapshot, err := json.Marshal(policy)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Internal, "序列化 LLM 安全配置失败")
+	}
+	versionModel, err := r.versionModel.model(session)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建 LLM safety policy version model 失败")
+	}
+	if err := versionModel.Create(ctx, &entity.SafetyPolicyVersion{
+		PolicyID:      policy.ID,
+		Version:       policy.Version,
+		SnapshotJSON:  string(snapshot),
+		ChangeLog:     changeLog,
+		CreatedBy:     policy.UpdatedBy,
+		EffectiveFrom: time.Now(),
+	}); err != nil {
+		return errorx.Wrap(err, errorx.Database, "保存 LLM 安全配置版本失败")
+	}
+
+	if err := session.Commit(); err != nil {
+		return errorx.Wrap(err, errorx.Database, "提交 LLM 安全配置事务失败")
+	}
+	committed = true
 	return nil
 }
+
+func (r *safetyPolicyRepoImpl) GetByID(ctx context.Context, id int64) (*entity.SafetyPolicy, error) {
+	var policy entity.SafetyPolicy
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 LLM safety policy model 失败")
+	}
+	if err := model.First(ctx, &policy, orm.WithWhere("id = ?", id)); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, nil
+		}
+		return nil, errorx.Wrap(err, errorx.Database, "查询 LLM 安全配置失败")
+	}
+	return &policy, nil
+}
+
+func (r *safetyPolicyRepoImpl) ListVersions(ctx context.Context, policyID int64) ([]*entity.SafetyPolicyVersion, error) {
+	var list []*entity.SafetyPolicyVersion
+	model, err := r.versionModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 LLM safety policy version model 失败")
+	}
+	if err := model.Find(ctx, &list,
+		orm.WithWhere("policy_id = ?", policyID),
+		orm.WithOrderBy("version", true),
+	); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询 LLM 安全配置版本失败")
+	}
+	return list, nil
+}
+
+func (r *safetyPolicyRepoImpl) GetVersion(ctx context.Context, policyID int64, version int) (*entity.SafetyPolicyVersion, error) {
+	var v entity.SafetyPolicyVersion
+	model, err := r.versionModel.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建 LLM safety policy version model 失败")
+	}
+	if err := model.First(ctx, &v, orm.WithWhere("policy_id = ? AND version = ?", policyID, version)); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, nil
+		}
+		return nil, errorx.Wrap(err, errorx.Database, "查询 LLM 安全配置版本失败")
+	}
+	return &v, nil
+}
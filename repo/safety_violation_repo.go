@@ -0,0 +1,226 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/db/orm"
+	"gochen/errorx"
+)
+
+// safetyViolationTermSampleSize 统计命中词时读取的最近违规记录数上限
+const safetyViolationTermSampleSize = 5000
+
+// SafetyViolationRepo 持久化安全检查拒绝记录并提供聚合统计
+type SafetyViolationRepo interface {
+	Save(ctx context.Context, v *entity.SafetyViolation) error
+	// Report 按原因/类别/命中词/日期/用户聚合，各维度最多返回 top 项（按日期的维度不截断）
+	Report(ctx context.Context, filter entity.SafetyViolationFilter, top int) (*entity.SafetyViolationReport, error)
+	// CountSince 统计用户自 since 起的违规次数，不含封禁期间被拒绝的请求（reason=cooldown）
+	CountSince(ctx context.Context, userID int64, since time.Time) (int64, error)
+	// AnonymizeUser 将用户的违规记录的用户 ID 清零（记录本身不含内容，保留用于聚合统计），返回影响行数
+	AnonymizeUser(ctx context.Context, userID int64) (int64, error)
+}
+
+type safetyViolationRepoImpl struct {
+	orm   orm.IOrm
+	model ormModel
+}
+
+func NewSafetyViolationRepo(o orm.IOrm) SafetyViolationRepo {
+	return &safetyViolationRepoImpl{
+		orm:   o,
+		model: newOrmModel(&entity.SafetyViolation{}, (entity.SafetyViolation{}).TableName()),
+	}
+}
+
+func (r *safetyViolationRepoImpl) Save(ctx context.Context, v *entity.SafetyViolation) error {
+	if v == nil {
+		return errorx.New(errorx.InvalidInput, "违规记录不能为空")
+	}
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建违规记录 model 失败")
+	}
+	if err := model.Create(ctx, v); err != nil {
+		return errorx.Wrap(err, errorx.Database, "保存违规记录失败")
+	}
+	return nil
+}
+
+func (r *safetyViolationRepoImpl) Report(ctx context.Context, filter entity.SafetyViolationFilter, top int) (*entity.SafetyViolationReport, error) {
+	if top <= 0 || top > 100 {
+		top = 20
+	}
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建违规记录 model 失败")
+	}
+	opts := buildSafetyViolationOptions(filter)
+
+	report := &entity.SafetyViolationReport{}
+	if report.Total, err = model.Count(ctx, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "统计违规记录失败")
+	}
+	if report.ByReason, err = r.countBy(ctx, model, opts, "reason", top); err != nil {
+		return nil, err
+	}
+	if report.ByCategory, err = r.countBy(ctx, model, opts, "category", top); err != nil {
+		return nil, err
+	}
+	if report.ByDay, err = r.countByDay(ctx, model, opts); err != nil {
+		return nil, err
+	}
+	if report.TopUsers, err = r.topUsers(ctx, model, opts, top); err != nil {
+		return nil, err
+	}
+	if report.ByTerm, err = r.countTerms(ctx, model, opts, top); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (r *safetyViolationRepoImpl) CountSince(ctx context.Context, userID int64, since time.Time) (int64, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建违规记录 model 失败")
+	}
+	count, err := model.Count(ctx,
+		orm.WithWhere("user_id = ? AND created_at >= ? AND reason <> ?", userID, since, "cooldown"),
+	)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "统计用户违规次数失败")
+	}
+	return count, nil
+}
+
+func (r *safetyViolationRepoImpl) countBy(ctx context.Context, model orm.IModel, opts []orm.QueryOption, column string, top int) ([]*entity.SafetyViolationBucket, error) {
+	var rows []*entity.SafetyViolationBucket
+	queryOpts := append(append([]orm.QueryOption{}, opts...),
+		orm.WithSelect(column+" as bucket_key", "COUNT(*) as count"),
+		orm.WithGroupBy(column),
+		orm.WithOrderBy("count", true),
+		orm.WithLimit(top),
+	)
+	if err := model.Find(ctx, &rows, queryOpts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "按 "+column+" 统计违规记录失败")
+	}
+	return rows, nil
+}
+
+func (r *safetyViolationRepoImpl) countByDay(ctx context.Context, model orm.IModel, opts []orm.QueryOption) ([]*entity.SafetyViolationBucket, error) {
+	var rows []*entity.SafetyViolationBucket
+	queryOpts := append(append([]orm.QueryOption{}, opts...),
+		orm.WithSelect("DATE(created_at) as bucket_key", "COUNT(*) as count"),
+		orm.WithGroupBy("DATE(created_at)"),
+		orm.WithOrderBy("DATE(created_at)", false),
+	)
+	if err := model.Find(ctx, &rows, queryOpts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "按日期统计违规记录失败")
+	}
+	// 部分驱动将 DATE 返回为时间戳字符串，只保留日期部分
+	for _, row := range rows {
+		if len(row.Key) > 10 {
+			row.Key = row.Key[:10]
+		}
+	}
+	return rows, nil
+}
+
+func (r *safetyViolationRepoImpl) topUsers(ctx context.Context, model orm.IModel, opts []orm.QueryOption, top int) ([]*entity.SafetyViolationUser, error) {
+	var rows []*entity.SafetyViolationUser
+	queryOpts := append(append([]orm.QueryOption{}, opts...),
+		orm.WithWhere("user_id > 0"),
+		orm.WithSelect("user_id", "COUNT(*) as count", "MAX(created_at) as last_at"),
+		orm.WithGroupBy("user_id"),
+		orm.WithOrderBy("count", true),
+		orm.WithLimit(top),
+	)
+	if err := model.Find(ctx, &rows, queryOpts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "按用户统计违规记录失败")
+	}
+	return rows, nil
+}
+
+// countTerms 命中词存储为 JSON 数组，无法在 SQL 中通用地展开，基于最近的违规记录在内存中统计
+func (r *safetyViolationRepoImpl) countTerms(ctx context.Context, model orm.IModel, opts []orm.QueryOption, top int) ([]*entity.SafetyViolationBucket, error) {
+	var rows []*entity.SafetyViolation
+	queryOpts := append(append([]orm.QueryOption{}, opts...),
+		orm.WithWhere("matched_terms_json <> ''"),
+		orm.WithSelect("matched_terms_json"),
+		orm.WithOrderBy("id", true),
+		orm.WithLimit(safetyViolationTermSampleSize),
+	)
+	if err := model.Find(ctx, &rows, queryOpts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询违规命中词失败")
+	}
+	counts := map[string]int64{}
+	for _, row := range rows {
+		var terms []string
+		if err := json.Unmarshal([]byte(row.MatchedTermsJSON), &terms); err != nil {
+			continue
+		}
+		for _, term := range terms {
+			if term = strings.TrimSpace(term); term != "" {
+				counts[term]++
+			}
+		}
+	}
+	result := make([]*entity.SafetyViolationBucket, 0, len(counts))
+	for term, count := range counts {
+		result = append(result, &entity.SafetyViolationBucket{Key: term, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Key < result[j].Key
+	})
+	if len(result) > top {
+		result = result[:top]
+	}
+	return result, nil
+}
+
+func buildSafetyViolationOptions(filter entity.SafetyViolationFilter) []orm.QueryOption {
+	opts := []orm.QueryOption{}
+	if filter.UserID != nil {
+		opts = append(opts, orm.WithWhere("user_id = ?", *filter.UserID))
+	}
+	if filter.Direction != "" {
+		opts = append(opts, orm.WithWhere("direction = ?", filter.Direction))
+	}
+	if filter.Category != "" {
+		opts = append(opts, orm.WithWhere("category = ?", filter.Category))
+	}
+	if filter.StartAt != nil {
+		opts = append(opts, orm.WithWhere("created_at >= ?", *filter.StartAt))
+	}
+	if filter.EndAt != nil {
+		opts = append(opts, orm.WithWhere("created_at <= ?", *filter.EndAt))
+	}
+	return opts
+}
+
+func (r *safetyViolationRepoImpl) AnonymizeUser(ctx context.Context, userID int64) (int64, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建违规记录 model 失败")
+	}
+	where := orm.WithWhere("user_id = ?", userID)
+	count, err := model.Count(ctx, where)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "统计用户违规记录失败")
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if err := model.UpdateValues(ctx, map[string]any{"user_id": 0}, where); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "匿名化用户违规记录失败")
+	}
+	return count, nil
+}
@@ -0,0 +1,115 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/db/orm"
+	"gochen/errorx"
+)
+
+// UserBanRepo 持久化用户临时封禁，多实例部署时各实例据此共享封禁状态
+type UserBanRepo interface {
+	Create(ctx context.Context, ban *entity.UserBan) error
+	// GetActive 返回用户在 now 时刻生效且截止时间最晚的封禁，不存在时返回 nil
+	GetActive(ctx context.Context, userID int64, now time.Time) (*entity.UserBan, error)
+	ListActive(ctx context.Context, now time.Time, limit, offset int) ([]*entity.UserBan, int64, error)
+	// Lift 解除用户当前生效的全部封禁，返回解除的条数
+	Lift(ctx context.Context, userID, actorID int64, now time.Time) (int64, error)
+}
+
+type userBanRepoImpl struct {
+	orm   orm.IOrm
+	model ormModel
+}
+
+func NewUserBanRepo(o orm.IOrm) UserBanRepo {
+	return &userBanRepoImpl{
+		orm:   o,
+		model: newOrmModel(&entity.UserBan{}, (entity.UserBan{}).TableName()),
+	}
+}
+
+func activeBanOptions(now time.Time) []orm.QueryOption {
+	return []orm.QueryOption{orm.WithWhere("until > ? AND lifted_at IS NULL", now)}
+}
+
+func (r *userBanRepoImpl) Create(ctx context.Context, ban *entity.UserBan) error {
+	if ban == nil || ban.UserID <= 0 {
+		return errorx.New(errorx.InvalidInput, "封禁记录无效")
+	}
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建用户封禁 model 失败")
+	}
+	if err := model.Create(ctx, ban); err != nil {
+		return errorx.Wrap(err, errorx.Database, "保存用户封禁失败")
+	}
+	return nil
+}
+
+func (r *userBanRepoImpl) GetActive(ctx context.Context, userID int64, now time.Time) (*entity.UserBan, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建用户封禁 model 失败")
+	}
+	var ban entity.UserBan
+	opts := append(activeBanOptions(now),
+		orm.WithWhere("user_id = ?", userID),
+		orm.WithOrderBy("until", true),
+	)
+	if err := model.First(ctx, &ban, opts...); err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return nil, nil
+		}
+		return nil, errorx.Wrap(err, errorx.Database, "查询用户封禁失败")
+	}
+	return &ban, nil
+}
+
+func (r *userBanRepoImpl) ListActive(ctx context.Context, now time.Time, limit, offset int) ([]*entity.UserBan, int64, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "创建用户封禁 model 失败")
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	total, err := model.Count(ctx, activeBanOptions(now)...)
+	if err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "统计用户封禁失败")
+	}
+	var list []*entity.UserBan
+	opts := append(activeBanOptions(now),
+		orm.WithOrderBy("until", true),
+		orm.WithLimit(limit),
+		orm.WithOffset(offset),
+	)
+	if err := model.Find(ctx, &list, opts...); err != nil {
+		return nil, 0, errorx.Wrap(err, errorx.Database, "查询用户封禁失败")
+	}
+	return list, total, nil
+}
+
+func (r *userBanRepoImpl) Lift(ctx context.Context, userID, actorID int64, now time.Time) (int64, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建用户封禁 model 失败")
+	}
+	opts := append(activeBanOptions(now), orm.WithWhere("user_id = ?", userID))
+	count, err := model.Count(ctx, opts...)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "统计用户封禁失败")
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if err := model.UpdateValues(ctx, map[string]any{"lifted_at": now, "lifted_by": actorID}, opts...); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "解除用户封禁失败")
+	}
+	return count, nil
+}
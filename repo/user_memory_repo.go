@@ -0,0 +1,150 @@
+package repo
+
+import (
+	"context"
+
+	"gochen-llm/entity"
+	"gochen/db/orm"
+	"gochen/errorx"
+)
+
+// UserMemoryRepo 持久化用户长期记忆
+type UserMemoryRepo interface {
+	Create(ctx context.Context, m *entity.UserMemory) error
+	// ListByUser 按更新时间倒序返回用户的记忆，limit<=0 时返回全部
+	ListByUser(ctx context.Context, userID int64, limit int) ([]*entity.UserMemory, error)
+	Count(ctx context.Context, userID int64) (int64, error)
+	// Delete 删除用户的一条记忆，返回是否删除
+	Delete(ctx context.Context, userID, id int64) (bool, error)
+	// DeleteOldest 删除用户最早更新的 n 条记忆
+	DeleteOldest(ctx context.Context, userID int64, n int) error
+	// DeleteByUser 删除用户的全部记忆，返回删除行数
+	DeleteByUser(ctx context.Context, userID int64) (int64, error)
+}
+
+type userMemoryRepoImpl struct {
+	orm   orm.IOrm
+	model ormModel
+}
+
+func NewUserMemoryRepo(o orm.IOrm) UserMemoryRepo {
+	return &userMemoryRepoImpl{
+		orm:   o,
+		model: newOrmModel(&entity.UserMemory{}, (entity.UserMemory{}).TableName()),
+	}
+}
+
+func (r *userMemoryRepoImpl) Create(ctx context.Context, m *entity.UserMemory) error {
+	if m == nil || m.UserID <= 0 {
+		return errorx.New(errorx.InvalidInput, "用户记忆无效")
+	}
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建用户记忆 model 失败")
+	}
+	if err := model.Create(ctx, m); err != nil {
+		return errorx.Wrap(err, errorx.Database, "保存用户记忆失败")
+	}
+	return nil
+}
+
+func (r *userMemoryRepoImpl) ListByUser(ctx context.Context, userID int64, limit int) ([]*entity.UserMemory, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "创建用户记忆 model 失败")
+	}
+	opts := []orm.QueryOption{
+		orm.WithWhere("user_id = ?", userID),
+		orm.WithOrderBy("updated_at", true),
+		orm.WithOrderBy("id", true),
+	}
+	if limit > 0 {
+		opts = append(opts, orm.WithLimit(limit))
+	}
+	var list []*entity.UserMemory
+	if err := model.Find(ctx, &list, opts...); err != nil {
+		return nil, errorx.Wrap(err, errorx.Database, "查询用户记忆失败")
+	}
+	return list, nil
+}
+
+func (r *userMemoryRepoImpl) Count(ctx context.Context, userID int64) (int64, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建用户记忆 model 失败")
+	}
+	count, err := model.Count(ctx, orm.WithWhere("user_id = ?", userID))
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "统计用户记忆失败")
+	}
+	return count, nil
+}
+
+func (r *userMemoryRepoImpl) Delete(ctx context.Context, userID, id int64) (bool, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "创建用户记忆 model 失败")
+	}
+	opts := []orm.QueryOption{orm.WithWhere("id = ? AND user_id = ?", id, userID)}
+	count, err := model.Count(ctx, opts...)
+	if err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "统计用户记忆失败")
+	}
+	if count == 0 {
+		return false, nil
+	}
+	if err := model.Delete(ctx, opts...); err != nil {
+		return false, errorx.Wrap(err, errorx.Database, "删除用户记忆失败")
+	}
+	return true, nil
+}
+
+func (r *userMemoryRepoImpl) DeleteOldest(ctx context.Context, userID int64, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Database, "创建用户记忆 model 失败")
+	}
+	var oldest []*entity.UserMemory
+	if err := model.Find(ctx, &oldest,
+		orm.WithWhere("user_id = ?", userID),
+		orm.WithSelect("id"),
+		orm.WithOrderBy("updated_at", false),
+		orm.WithOrderBy("id", false),
+		orm.WithLimit(n),
+	); err != nil {
+		return errorx.Wrap(err, errorx.Database, "查询用户记忆失败")
+	}
+	if len(oldest) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(oldest))
+	for _, m := range oldest {
+		ids = append(ids, m.ID)
+	}
+	if err := model.Delete(ctx, orm.WithWhere("id IN ?", ids)); err != nil {
+		return errorx.Wrap(err, errorx.Database, "删除用户记忆失败")
+	}
+	return nil
+}
+
+func (r *userMemoryRepoImpl) DeleteByUser(ctx context.Context, userID int64) (int64, error) {
+	model, err := r.model.model(r.orm)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "创建用户记忆 model 失败")
+	}
+	where := orm.WithWhere("user_id = ?", userID)
+	count, err := model.Count(ctx, where)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "统计用户记忆失败")
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if err := model.Delete(ctx, where); err != nil {
+		return 0, errorx.Wrap(err, errorx.Database, "删除用户记忆失败")
+	}
+	return count, nil
+}
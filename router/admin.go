@@ -1,39 +1,59 @@
 package router
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"gochen-llm/entity"
 	"gochen-llm/repo"
 	"gochen-llm/service"
+	"gochen/errorx"
 	"gochen/httpx"
 	hbasic "gochen/httpx/nethttp"
 )
 
 // LLMAdminRoutes 提供 LLM 模块的管理接口
 type LLMAdminRoutes struct {
-	manager    service.ProviderManager
-	safetyRepo repo.SafetyPolicyRepo
-	safetySvc  service.SafetyService
-	metrics    repo.MetricsRepo
-	cfgRepo    repo.ProviderConfigRepo
-	auditRepo  repo.AuditLogRepo
-	rateRepo   repo.RateLimitRepo
-	utils      *hbasic.Utils
+	manager     service.ProviderManager
+	safetyRepo  repo.SafetyPolicyRepo
+	safetySvc   service.SafetyService
+	metrics     repo.MetricsRepo
+	cfgRepo     repo.ProviderConfigRepo
+	auditRepo   repo.AuditLogRepo
+	rateRepo    repo.RateLimitRepo
+	evalSvc     service.EvalService
+	compactor   service.ConversationCompactor
+	erasure     service.UserErasureService
+	pricing     service.ModelPricingService
+	backfill    service.CostBackfillService
+	digests     service.CostDigestService
+	conversions service.ConversionService
+	sampling    service.RecordSamplingService
+	utils       *hbasic.Utils
 }
 
-func NewLLMAdminRoutes(manager service.ProviderManager, safety repo.SafetyPolicyRepo, metrics repo.MetricsRepo, cfgRepo repo.ProviderConfigRepo, audit repo.AuditLogRepo, rate repo.RateLimitRepo, safetySvc service.SafetyService) *LLMAdminRoutes {
+func NewLLMAdminRoutes(manager service.ProviderManager, safety repo.SafetyPolicyRepo, metrics repo.MetricsRepo, cfgRepo repo.ProviderConfigRepo, audit repo.AuditLogRepo, rate repo.RateLimitRepo, safetySvc service.SafetyService, evalSvc service.EvalService, compactor service.ConversationCompactor, erasure service.UserErasureService, pricing service.ModelPricingService, backfill service.CostBackfillService, digests service.CostDigestService, conversions service.ConversionService, sampling service.RecordSamplingService) *LLMAdminRoutes {
 	return &LLMAdminRoutes{
-		manager:    manager,
-		safetyRepo: safety,
-		safetySvc:  safetySvc,
-		metrics:    metrics,
-		cfgRepo:    cfgRepo,
-		auditRepo:  audit,
-		rateRepo:   rate,
-		utils:      &hbasic.Utils{},
+		manager:     manager,
+		safetyRepo:  safety,
+		safetySvc:   safetySvc,
+		metrics:     metrics,
+		cfgRepo:     cfgRepo,
+		auditRepo:   audit,
+		rateRepo:    rate,
+		evalSvc:     evalSvc,
+		compactor:   compactor,
+		erasure:     erasure,
+		pricing:     pricing,
+		backfill:    backfill,
+		digests:     digests,
+		conversions: conversions,
+		sampling:    sampling,
+		utils:       &hbasic.Utils{},
 	}
 }
 
@@ -44,14 +64,41 @@ func (r *LLMAdminRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
 	admin.GET("/llm/config", r.getLLMConfig)
 	admin.PUT("/llm/config", r.updateLLMConfig)
 	admin.PUT("/llm/pricing", r.updatePricing)
+	admin.GET("/llm/model-pricing", r.listModelPricing)
+	admin.PUT("/llm/model-pricing", r.saveModelPricing)
+	admin.POST("/llm/model-pricing/delete", r.deleteModelPricing)
+	admin.GET("/llm/model-pricing/resolve", r.resolveModelPricing)
+	admin.GET("/llm/cost/backfill", r.getCostBackfill)
+	admin.POST("/llm/cost/backfill", r.startCostBackfill)
+	admin.POST("/llm/cost/backfill/cancel", r.cancelCostBackfill)
+	admin.GET("/llm/cost/digests", r.listCostDigests)
+	admin.POST("/llm/cost/digests/run", r.runCostDigest)
+	admin.GET("/llm/cost/digest-config", r.getCostDigestConfig)
+	admin.PUT("/llm/cost/digest-config", r.updateCostDigestConfig)
 	admin.POST("/llm/reload", r.reloadLLMConfig)
 	admin.GET("/llm/safety", r.getLLMSafetyConfig)
 	admin.PUT("/llm/safety", r.updateLLMSafetyConfig)
+	admin.GET("/llm/safety/policies", r.listLLMSafetyPolicies)
+	admin.GET("/llm/safety/versions", r.listLLMSafetyVersions)
+	admin.POST("/llm/safety/rollback", r.rollbackLLMSafetyPolicy)
+	admin.GET("/llm/safety/violations", r.getSafetyViolations)
+	admin.POST("/llm/safety/replay", r.replaySafetyPolicy)
+	admin.POST("/llm/pii/detokenize", r.detokenizePII)
 	admin.GET("/llm/security/overview", r.getSecurityOverview)
 	admin.GET("/llm/status", r.getLLMStatus)
 	admin.GET("/llm/metrics", r.getLLMMetrics)
 	admin.POST("/llm/metrics/convert", r.markConversion)
+	admin.GET("/llm/metrics/conversion-config", r.getConversionConfig)
+	admin.PUT("/llm/metrics/conversion-config", r.updateConversionConfig)
+	admin.GET("/llm/sampling", r.getSamplingConfig)
+	admin.PUT("/llm/sampling", r.updateSamplingConfig)
 	admin.GET("/llm/audit", r.listAuditLogs)
+	admin.GET("/llm/audit/export", r.exportAuditLogs)
+	admin.POST("/llm/eval/audit", r.evaluateAuditLogs)
+	admin.GET("/llm/conversations/compaction", r.getCompaction)
+	admin.POST("/llm/conversations/compaction", r.updateCompaction)
+	admin.POST("/llm/conversations/compaction/run", r.runCompaction)
+	admin.POST("/llm/users/forget", r.forgetUser)
 	// TODO: 接口文档补充健康/限流字段说明
 	return nil
 }
@@ -91,9 +138,11 @@ func (r *LLMAdminRoutes) updateLLMConfig(ctx httpx.IContext) error {
 		return r.respondError(ctx, 400, err)
 	}
 
+	before := r.listConfigsForAudit(ctx)
 	if err := r.manager.ReplaceConfigs(ctx.GetContext(), body.Configs); err != nil {
 		return r.respondError(ctx, 500, err)
 	}
+	r.auditChange(ctx, "admin.replace_configs", "provider_config", 0, before, r.listConfigsForAudit(ctx))
 
 	if err := r.manager.Reload(ctx.GetContext()); err != nil {
 		return r.respondError(ctx, 500, err)
@@ -120,9 +169,11 @@ func (r *LLMAdminRoutes) updatePricing(ctx httpx.IContext) error {
 			return r.respondError(ctx, 400, err)
 		}
 	}
+	before := r.listConfigsForAudit(ctx)
 	if err := r.cfgRepo.UpdatePricing(ctx.GetContext(), body.Pricing); err != nil {
 		return r.respondError(ctx, 500, err)
 	}
+	r.auditChange(ctx, "admin.update_pricing", "provider_config", 0, before, r.listConfigsForAudit(ctx))
 	if r.manager != nil {
 		_ = r.manager.Reload(ctx.GetContext())
 	}
@@ -146,7 +197,15 @@ func (r *LLMAdminRoutes) getLLMSafetyConfig(ctx httpx.IContext) error {
 		return ctx.JSON(500, map[string]string{"message": "LLM safety repo 未配置"})
 	}
 
-	cfg, err := r.safetyRepo.GetActive(ctx.GetContext())
+	q := ctx.GetRequest().URL.Query()
+	scope, scopeKey := q.Get("scope"), q.Get("scope_key")
+	if !service.ValidSafetyScope(scope, scopeKey) {
+		return r.respondError(ctx, 400, fmt.Errorf("scope/scope_key 无效"))
+	}
+	if scope == "" {
+		scope = entity.SafetyScopeGlobal
+	}
+	cfg, err := r.safetyRepo.Get(ctx.GetContext(), scope, scopeKey)
 	if err != nil {
 		return r.respondError(ctx, 500, err)
 	}
@@ -155,13 +214,28 @@ func (r *LLMAdminRoutes) getLLMSafetyConfig(ctx httpx.IContext) error {
 	})
 }
 
+// listLLMSafetyPolicies 列出全局及各作用域的安全策略
+func (r *LLMAdminRoutes) listLLMSafetyPolicies(ctx httpx.IContext) error {
+	if r.safetyRepo == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM safety repo 未配置"})
+	}
+	list, err := r.safetyRepo.List(ctx.GetContext())
+	if err != nil {
+		return r.respondError(ctx, 500, err)
+	}
+	return ctx.JSON(200, map[string]any{
+		"policies": list,
+	})
+}
+
 func (r *LLMAdminRoutes) updateLLMSafetyConfig(ctx httpx.IContext) error {
 	if r.safetyRepo == nil {
 		return ctx.JSON(500, map[string]string{"message": "LLM safety repo 未配置"})
 	}
 
 	var body struct {
-		Config *entity.SafetyPolicy `json:"config"`
+		Config    *entity.SafetyPolicy `json:"config"`
+		ChangeLog string               `json:"change_log"`
 	}
 	if err := ctx.BindJSON(&body); err != nil {
 		return r.respondError(ctx, 400, err)
@@ -169,21 +243,157 @@ func (r *LLMAdminRoutes) updateLLMSafetyConfig(ctx httpx.IContext) error {
 	if body.Config == nil {
 		return r.respondError(ctx, 400, fmt.Errorf("config 不能为空"))
 	}
+	if err := r.validateSafetyPolicy(body.Config); err != nil {
+		return r.respondError(ctx, 400, err)
+	}
 
 	cfg := &entity.SafetyPolicy{
+		Scope:                 body.Config.Scope,
+		ScopeKey:              body.Config.ScopeKey,
+		Name:                  body.Config.Name,
 		Enabled:               body.Config.Enabled,
 		GlobalSystemPrompt:    body.Config.GlobalSystemPrompt,
+		SystemPromptMode:      body.Config.SystemPromptMode,
+		SystemPromptTemplate:  body.Config.SystemPromptTemplate,
 		BlockedCategoriesJSON: body.Config.BlockedCategoriesJSON,
 		BlockedKeywordsJSON:   body.Config.BlockedKeywordsJSON,
+		CheckersJSON:          body.Config.CheckersJSON,
+		AllowedPhrasesJSON:    body.Config.AllowedPhrasesJSON,
+		ExemptionsJSON:        body.Config.ExemptionsJSON,
+		SeverityActionsJSON:   body.Config.SeverityActionsJSON,
+		BanCooldownSeconds:    body.Config.BanCooldownSeconds,
+		BanEscalationJSON:     body.Config.BanEscalationJSON,
+		PIIConfigJSON:         body.Config.PIIConfigJSON,
 		MaxContentLength:      body.Config.MaxContentLength,
+		PostProcessorsJSON:    body.Config.PostProcessorsJSON,
+		EnforceOutputLanguage: body.Config.EnforceOutputLanguage,
+		TokenLimitPerMinute:   body.Config.TokenLimitPerMinute,
 		LogLevel:              body.Config.LogLevel,
+		AuditMaxFieldChars:    body.Config.AuditMaxFieldChars,
+		UpdatedBy:             ctx.GetContext().GetUserID(),
 	}
 
-	if err := r.safetyRepo.Save(ctx.GetContext(), cfg); err != nil {
+	before, err := r.safetyRepo.Get(ctx.GetContext(), cfg.Scope, cfg.ScopeKey)
+	if err != nil {
+		return r.respondError(ctx, 500, err)
+	}
+	if err := r.safetyRepo.Save(ctx.GetContext(), cfg, body.ChangeLog); err != nil {
 		return r.respondError(ctx, 500, err)
 	}
+	if r.safetySvc != nil {
+		r.safetySvc.InvalidatePolicyCache()
+	}
+	r.auditChange(ctx, "admin.update_safety_policy", "safety_policy", cfg.ID, before, cfg)
 
-	return ctx.JSON(200, map[string]string{"message": "ok"})
+	return ctx.JSON(200, map[string]any{"message": "ok", "version": cfg.Version})
+}
+
+// validateSafetyPolicy 校验安全策略各配置字段，保存与回放共用
+func (r *LLMAdminRoutes) validateSafetyPolicy(cfg *entity.SafetyPolicy) error {
+	if !service.ValidSafetyScope(cfg.Scope, cfg.ScopeKey) {
+		return fmt.Errorf("scope/scope_key 无效")
+	}
+	if err := service.ValidateSystemPromptComposition(cfg.SystemPromptMode, cfg.SystemPromptTemplate); err != nil {
+		return err
+	}
+	if err := service.ValidateBlockedCategories(cfg.BlockedCategoriesJSON); err != nil {
+		return err
+	}
+	if err := service.ValidatePIIConfig(cfg.PIIConfigJSON); err != nil {
+		return err
+	}
+	if err := service.ValidateSeverityActions(cfg.SeverityActionsJSON); err != nil {
+		return err
+	}
+	if err := service.ValidateAuditLogLevel(cfg.LogLevel); err != nil {
+		return err
+	}
+	if err := service.ValidateAllowedPhrases(cfg.AllowedPhrasesJSON); err != nil {
+		return err
+	}
+	if err := service.ValidateSafetyExemptions(cfg.ExemptionsJSON); err != nil {
+		return err
+	}
+	if err := service.ValidateBanEscalation(cfg.BanEscalationJSON); err != nil {
+		return err
+	}
+	if cfg.BanCooldownSeconds < 0 || cfg.AuditMaxFieldChars < 0 {
+		return fmt.Errorf("BanCooldownSeconds/AuditMaxFieldChars 不能为负数")
+	}
+	if r.safetySvc != nil {
+		if err := r.safetySvc.ValidateCheckers(cfg.CheckersJSON); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listLLMSafetyVersions 列出策略的历史版本：?policy_id=
+func (r *LLMAdminRoutes) listLLMSafetyVersions(ctx httpx.IContext) error {
+	if r.safetyRepo == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM safety repo 未配置"})
+	}
+	policyID, err := strconv.ParseInt(ctx.GetRequest().URL.Query().Get("policy_id"), 10, 64)
+	if err != nil || policyID <= 0 {
+		return r.respondError(ctx, 400, fmt.Errorf("policy_id 无效"))
+	}
+	versions, err := r.safetyRepo.ListVersions(ctx.GetContext(), policyID)
+	if err != nil {
+		return r.respondError(ctx, 500, err)
+	}
+	return ctx.JSON(200, map[string]any{
+		"versions": versions,
+	})
+}
+
+// rollbackLLMSafetyPolicy 回滚策略到指定版本
+func (r *LLMAdminRoutes) rollbackLLMSafetyPolicy(ctx httpx.IContext) error {
+	if r.safetySvc == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM safety service 未配置"})
+	}
+	var body struct {
+		PolicyID int64 `json:"policy_id"`
+		Version  int   `json:"version"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return r.respondError(ctx, 400, err)
+	}
+	policy, err := r.safetySvc.RollbackPolicy(auditContext(ctx), body.PolicyID, body.Version, ctx.GetContext().GetUserID())
+	if err != nil {
+		return r.respondError(ctx, 400, err)
+	}
+	return ctx.JSON(200, map[string]any{
+		"config": policy,
+	})
+}
+
+// detokenizePII 还原 tokenize 策略生成的 PII 占位符；还原操作本身写入审计日志（不记录原文）
+func (r *LLMAdminRoutes) detokenizePII(ctx httpx.IContext) error {
+	if r.safetySvc == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM safety service 未配置"})
+	}
+	var body struct {
+		Text   string `json:"text"`
+		Reason string `json:"reason"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return r.respondError(ctx, 400, err)
+	}
+	if strings.TrimSpace(body.Reason) == "" {
+		return r.respondError(ctx, 400, fmt.Errorf("reason 不能为空"))
+	}
+	text, err := r.safetySvc.DetokenizePII(ctx.GetContext(), body.Text)
+	if err != nil {
+		return r.respondError(ctx, 500, err)
+	}
+	detail, _ := json.Marshal(map[string]any{"reason": body.Reason, "text_length": len([]rune(body.Text))})
+	_ = r.safetySvc.RecordAuditLog(auditContext(ctx), &entity.AuditLog{
+		Action:       "admin.detokenize_pii",
+		ResourceType: "pii_vault",
+		RequestJSON:  string(detail),
+		Status:       "ok",
+	})
+	return ctx.JSON(200, map[string]any{"text": text})
 }
 
 func (r *LLMAdminRoutes) getLLMStatus(ctx httpx.IContext) error {
@@ -242,20 +452,15 @@ func (r *LLMAdminRoutes) getLLMMetrics(ctx httpx.IContext) error {
 	})
 }
 
-// markConversion 记录一次转化事件（例如 A/B 测试的成功/点击）
+// markConversion 记录一次转化事件（例如 A/B 测试的成功/点击）：优先提供 Chat 响应元数据中的 request_id，
+// 其次为 user_id + ab_test_id；归因窗口内的重复转化返回 duplicate 且不计数
 func (r *LLMAdminRoutes) markConversion(ctx httpx.IContext) error {
-	if r.metrics == nil {
-		return ctx.JSON(500, map[string]string{"message": "LLM metrics repo 未配置"})
+	if r.conversions == nil {
+		return ctx.JSON(500, map[string]string{"message": "转化服务未配置"})
 	}
 	var body struct {
-		UserID           int64  `json:"user_id"`
-		ABTestID         int64  `json:"ab_test_id"`
-		ABVariant        string `json:"ab_variant"`
-		PromptTemplateID int64  `json:"prompt_template_id"`
-		Provider         string `json:"provider"`
-		Model            string `json:"model"`
-		Outcome          string `json:"outcome"`
-		ConversionType   string `json:"conversion_type"`
+		service.ConversionRequest
+		ConversionType string `json:"conversion_type"`
 	}
 	if err := ctx.BindJSON(&body); err != nil {
 		return r.respondError(ctx, 400, err)
@@ -263,24 +468,66 @@ func (r *LLMAdminRoutes) markConversion(ctx httpx.IContext) error {
 	if body.Outcome == "" {
 		body.Outcome = body.ConversionType
 	}
-	if body.Outcome == "" {
-		body.Outcome = "conversion"
+	result, err := r.conversions.MarkConversion(ctx.GetContext(), &body.ConversionRequest)
+	if err != nil {
+		return r.respondError(ctx, adminErrorStatus(err), err)
+	}
+	message := "ok"
+	if result.Duplicate {
+		message = "duplicate"
 	}
+	return ctx.JSON(200, map[string]any{"message": message, "result": result})
+}
 
-	record := &entity.Metrics{
-		UserID:         body.UserID,
-		ABTestID:       body.ABTestID,
-		ABVariant:      body.ABVariant,
-		PromptTemplate: body.PromptTemplateID,
-		Provider:       body.Provider,
-		Model:          body.Model,
-		Status:         "converted",
-		Outcome:        body.Outcome,
+// getConversionConfig 转化归因与去重配置
+func (r *LLMAdminRoutes) getConversionConfig(ctx httpx.IContext) error {
+	if r.conversions == nil {
+		return ctx.JSON(500, map[string]string{"message": "转化服务未配置"})
 	}
-	if err := r.metrics.Save(ctx.GetContext(), record); err != nil {
-		return r.respondError(ctx, 500, err)
+	return ctx.JSON(200, map[string]any{"config": r.conversions.GetConfig()})
+}
+
+// updateConversionConfig 更新转化配置：{"attribution_window_hours": 72, "dedup_window_hours": 0, "require_attribution": false}
+func (r *LLMAdminRoutes) updateConversionConfig(ctx httpx.IContext) error {
+	if r.conversions == nil {
+		return ctx.JSON(500, map[string]string{"message": "转化服务未配置"})
 	}
-	return ctx.JSON(200, map[string]string{"message": "ok"})
+	var cfg service.ConversionConfig
+	if err := ctx.BindJSON(&cfg); err != nil {
+		return r.respondError(ctx, 400, err)
+	}
+	before := r.conversions.GetConfig()
+	if err := r.conversions.SetConfig(cfg); err != nil {
+		return r.respondError(ctx, adminErrorStatus(err), err)
+	}
+	r.auditChange(ctx, "admin.update_conversion_config", "conversion_config", 0, before, r.conversions.GetConfig())
+	return ctx.JSON(200, map[string]any{"config": r.conversions.GetConfig()})
+}
+
+// getSamplingConfig 调用指标与审计日志的写入采样配置
+func (r *LLMAdminRoutes) getSamplingConfig(ctx httpx.IContext) error {
+	if r.sampling == nil {
+		return ctx.JSON(500, map[string]string{"message": "采样服务未配置"})
+	}
+	return ctx.JSON(200, map[string]any{"config": r.sampling.GetConfig()})
+}
+
+// updateSamplingConfig 更新采样配置：{"metrics_success_rate": 0.1, "metrics_error_rate": 1, "audit_payload_rate": 0.1}；
+// 采样率按样本权重取整，返回实际生效的值
+func (r *LLMAdminRoutes) updateSamplingConfig(ctx httpx.IContext) error {
+	if r.sampling == nil {
+		return ctx.JSON(500, map[string]string{"message": "采样服务未配置"})
+	}
+	var cfg service.RecordSamplingConfig
+	if err := ctx.BindJSON(&cfg); err != nil {
+		return r.respondError(ctx, 400, err)
+	}
+	before := r.sampling.GetConfig()
+	if err := r.sampling.SetConfig(cfg); err != nil {
+		return r.respondError(ctx, adminErrorStatus(err), err)
+	}
+	r.auditChange(ctx, "admin.update_sampling_config", "sampling_config", 0, before, r.sampling.GetConfig())
+	return ctx.JSON(200, map[string]any{"config": r.sampling.GetConfig()})
 }
 
 func (r *LLMAdminRoutes) listAuditLogs(ctx httpx.IContext) error {
@@ -288,8 +535,37 @@ func (r *LLMAdminRoutes) listAuditLogs(ctx httpx.IContext) error {
 		return ctx.JSON(500, map[string]string{"message": "LLM audit repo 未配置"})
 	}
 
-	var filter repo.AuditLogFilter
 	q := ctx.GetRequest().URL.Query()
+	filter := parseAuditLogFilter(q)
+
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 200 {
+			limit = n
+		}
+	}
+	offset := 0
+	if v := q.Get("offset"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			offset = n
+		}
+	}
+
+	list, total, err := r.auditRepo.List(ctx.GetContext(), filter, limit, offset)
+	if err != nil {
+		return r.respondError(ctx, 500, err)
+	}
+	return ctx.JSON(200, map[string]any{
+		"total":  total,
+		"list":   list,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// parseAuditLogFilter 解析审计日志查询参数：user_id/request_id/action/status/resource_type/start/end（RFC3339）
+func parseAuditLogFilter(q url.Values) repo.AuditLogFilter {
+	var filter repo.AuditLogFilter
 	if v := q.Get("user_id"); v != "" {
 		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
 			filter.UserID = &id
@@ -298,6 +574,9 @@ func (r *LLMAdminRoutes) listAuditLogs(ctx httpx.IContext) error {
 	if v := q.Get("action"); v != "" {
 		filter.Action = v
 	}
+	if v := q.Get("request_id"); v != "" {
+		filter.RequestID = v
+	}
 	if v := q.Get("status"); v != "" {
 		filter.Status = v
 	}
@@ -314,29 +593,46 @@ func (r *LLMAdminRoutes) listAuditLogs(ctx httpx.IContext) error {
 			filter.EndAt = &t
 		}
 	}
+	return filter
+}
 
-	limit := 50
-	if v := q.Get("limit"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 200 {
-			limit = n
+// evaluateAuditLogs 离线评估历史聊天审计日志（LLM-as-judge）
+func (r *LLMAdminRoutes) evaluateAuditLogs(ctx httpx.IContext) error {
+	if r.evalSvc == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM eval service 未配置"})
+	}
+	var body struct {
+		UserID *int64 `json:"user_id"`
+		Start  string `json:"start"`
+		End    string `json:"end"`
+		Limit  int    `json:"limit"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return r.respondError(ctx, 400, err)
+	}
+
+	filter := repo.AuditLogFilter{UserID: body.UserID}
+	if body.Start != "" {
+		if t, err := time.Parse(time.RFC3339, body.Start); err == nil {
+			filter.StartAt = &t
 		}
 	}
-	offset := 0
-	if v := q.Get("offset"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
-			offset = n
+	if body.End != "" {
+		if t, err := time.Parse(time.RFC3339, body.End); err == nil {
+			filter.EndAt = &t
 		}
 	}
+	limit := body.Limit
+	if limit <= 0 || limit > 200 {
+		limit = 20
+	}
 
-	list, total, err := r.auditRepo.List(ctx.GetContext(), filter, limit, offset)
+	results, err := r.evalSvc.EvaluateAuditLogs(ctx.GetContext(), filter, limit)
 	if err != nil {
 		return r.respondError(ctx, 500, err)
 	}
 	return ctx.JSON(200, map[string]any{
-		"total":  total,
-		"list":   list,
-		"limit":  limit,
-		"offset": offset,
+		"results": results,
 	})
 }
 
@@ -356,12 +652,20 @@ func (r *LLMAdminRoutes) getSecurityOverview(ctx httpx.IContext) error {
 		settings := r.safetySvc.GetRateLimitSettings()
 		rateSummary["per_minute"] = settings.PerMinute
 		rateSummary["burst"] = settings.Burst
+		rateSummary["fail_closed"] = settings.FailClosed
+		rateSummary["backend_failures"] = settings.BackendFailures
+	}
+	if policy != nil {
+		rateSummary["tokens_per_minute"] = policy.TokenLimitPerMinute
 	}
 	if r.rateRepo != nil {
 		since := time.Now().Add(-1 * time.Hour)
 		if total, err := r.rateRepo.SumSince(ctx.GetContext(), "chat", since); err == nil {
 			rateSummary["requests_last_hour"] = total
 		}
+		if tokens, err := r.rateRepo.SumTokensSince(ctx.GetContext(), "chat", since); err == nil {
+			rateSummary["tokens_last_hour"] = tokens
+		}
 		if recent, err := r.rateRepo.ListRecent(ctx.GetContext(), "chat", 20); err == nil {
 			rateSummary["recent_windows"] = recent
 		}
@@ -374,10 +678,103 @@ func (r *LLMAdminRoutes) getSecurityOverview(ctx httpx.IContext) error {
 	})
 }
 
+// auditChange 记录管理端写操作的审计日志（含变更前后差异），审计失败不影响请求结果
+func (r *LLMAdminRoutes) auditChange(ctx httpx.IContext, action, resourceType string, resourceID int64, before, after any) {
+	if r.safetySvc == nil {
+		return
+	}
+	r.safetySvc.RecordAdminChange(auditContext(ctx), action, resourceType, resourceID, before, after)
+}
+
+// listConfigsForAudit 读取当前全部 Provider 配置作为审计快照，读取失败时返回 nil
+func (r *LLMAdminRoutes) listConfigsForAudit(ctx httpx.IContext) []*entity.ProviderConfig {
+	if r.cfgRepo == nil || r.safetySvc == nil {
+		return nil
+	}
+	list, err := r.cfgRepo.ListAll(ctx.GetContext())
+	if err != nil {
+		return nil
+	}
+	return list
+}
+
+// getCompaction 会话定时压缩的配置与累计指标
+func (r *LLMAdminRoutes) getCompaction(ctx httpx.IContext) error {
+	if r.compactor == nil {
+		return ctx.JSON(500, map[string]string{"message": "会话压缩任务未配置"})
+	}
+	return ctx.JSON(200, map[string]any{
+		"config": r.compactor.GetConfig(),
+		"stats":  r.compactor.Stats(),
+	})
+}
+
+// updateCompaction 更新会话定时压缩配置：{"enabled": true, "inactive_days": 30, "keep_last": 100, "max_conversations": 0}
+func (r *LLMAdminRoutes) updateCompaction(ctx httpx.IContext) error {
+	if r.compactor == nil {
+		return ctx.JSON(500, map[string]string{"message": "会话压缩任务未配置"})
+	}
+	var cfg service.ConversationCompactionConfig
+	if err := ctx.BindJSON(&cfg); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	before := r.compactor.GetConfig()
+	r.compactor.SetConfig(cfg)
+	r.auditChange(ctx, "admin.update_conversation_compaction", "conversation_compaction", 0, before, r.compactor.GetConfig())
+	return ctx.JSON(200, map[string]any{"config": r.compactor.GetConfig()})
+}
+
+// runCompaction 立即执行一轮会话压缩
+func (r *LLMAdminRoutes) runCompaction(ctx httpx.IContext) error {
+	if r.compactor == nil {
+		return ctx.JSON(500, map[string]string{"message": "会话压缩任务未配置"})
+	}
+	result, err := r.compactor.CompactOnce(ctx.GetContext())
+	if err != nil {
+		return r.respondError(ctx, 500, err)
+	}
+	return ctx.JSON(200, map[string]any{"result": result})
+}
+
+// forgetUser 删除指定用户的个人数据：{"user_id": 1}；部分步骤失败时返回 500 与已完成部分的报告，可重复调用
+func (r *LLMAdminRoutes) forgetUser(ctx httpx.IContext) error {
+	if r.erasure == nil {
+		return ctx.JSON(500, map[string]string{"message": "用户数据删除服务未配置"})
+	}
+	var body struct {
+		UserID int64 `json:"user_id"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if body.UserID <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "user_id 无效"})
+	}
+	report, err := r.erasure.ForgetUser(auditContext(ctx), body.UserID)
+	if report != nil {
+		r.auditChange(ctx, "admin.forget_user", "user", body.UserID, nil, report)
+	}
+	if err != nil {
+		return ctx.JSON(500, map[string]any{"message": err.Error(), "report": report})
+	}
+	return ctx.JSON(200, map[string]any{"report": report})
+}
+
 func (r *LLMAdminRoutes) respondError(ctx httpx.IContext, status int, err error) error {
 	return ctx.JSON(status, map[string]string{"message": err.Error()})
 }
 
+// adminErrorStatus 按服务返回的错误码映射 HTTP 状态
+func adminErrorStatus(err error) int {
+	switch {
+	case errorx.Is(err, errorx.Validation), errorx.Is(err, errorx.InvalidInput):
+		return 400
+	case errorx.Is(err, errorx.NotFound):
+		return 404
+	}
+	return 500
+}
+
 func (r *LLMAdminRoutes) validatePricing(p entity.ProviderPricing) error {
 	if p.ID <= 0 {
 		return fmt.Errorf("pricing id 无效")
@@ -0,0 +1,111 @@
+package router
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/httpx"
+)
+
+// auditExportBatchSize 导出时每批读取的行数，内存占用与之成正比
+const auditExportBatchSize = 500
+
+var auditExportColumns = []string{
+	"id", "created_at", "user_id", "action", "resource_type", "resource_id", "status",
+	"policy_id", "policy_version", "ip_address", "user_agent", "route", "error_message", "request_json", "response_json",
+}
+
+// exportAuditLogs 以 CSV 或 JSONL 流式导出审计日志：?format=csv|jsonl，过滤参数同 /llm/audit；
+// 按批读取并逐批刷新，不受列表接口 200 行的分页上限限制
+func (r *LLMAdminRoutes) exportAuditLogs(ctx httpx.IContext) error {
+	if r.auditRepo == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM audit repo 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = "jsonl"
+	}
+	if format != "csv" && format != "jsonl" {
+		return r.respondError(ctx, 400, fmt.Errorf("format 仅支持 csv/jsonl"))
+	}
+	filter := parseAuditLogFilter(q)
+
+	w := ctx.GetResponse()
+	filename := fmt.Sprintf("llm_audit_%s.%s", time.Now().Format("20060102150405"), format)
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	var write func(batch []*entity.AuditLog) error
+	if format == "csv" {
+		cw := csv.NewWriter(w)
+		if err := cw.Write(auditExportColumns); err != nil {
+			return nil
+		}
+		write = func(batch []*entity.AuditLog) error {
+			for _, log := range batch {
+				if err := cw.Write(auditLogCSVRow(log)); err != nil {
+					return err
+				}
+			}
+			cw.Flush()
+			return cw.Error()
+		}
+	} else {
+		enc := json.NewEncoder(w)
+		write = func(batch []*entity.AuditLog) error {
+			for _, log := range batch {
+				if err := enc.Encode(log); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+
+	err := r.auditRepo.Iterate(ctx.GetContext(), filter, auditExportBatchSize, func(batch []*entity.AuditLog) error {
+		if err := write(batch); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	// 响应头已发送，无法再改写状态码；JSONL 追加一行错误记录，便于下游识别导出不完整
+	if err != nil && format == "jsonl" {
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+	}
+	return nil
+}
+
+func auditLogCSVRow(log *entity.AuditLog) []string {
+	return []string{
+		strconv.FormatInt(log.ID, 10),
+		log.CreatedAt.Format(time.RFC3339),
+		strconv.FormatInt(log.UserID, 10),
+		log.Action,
+		log.ResourceType,
+		strconv.FormatInt(log.ResourceID, 10),
+		log.Status,
+		strconv.FormatInt(log.PolicyID, 10),
+		strconv.Itoa(log.PolicyVersion),
+		log.IPAddress,
+		log.UserAgent,
+		log.Route,
+		log.ErrorMessage,
+		log.RequestJSON,
+		log.ResponseJSON,
+	}
+}
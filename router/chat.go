@@ -0,0 +1,315 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen-llm/service"
+	"gochen/errorx"
+	"gochen/httpx"
+	runtime "gochen/task"
+)
+
+// wsRequestTimeout WebSocket 握手后等待客户端发送请求消息的时间
+const wsRequestTimeout = 30 * time.Second
+
+// LLMChatRoutes 提供面向用户的聊天接口，请求一律以认证用户身份调用；
+// 会话的创建、读取与删除见 ConversationRoutes
+type LLMChatRoutes struct {
+	chat          service.ChatService
+	conversations service.ConversationService
+}
+
+func NewLLMChatRoutes(chat service.ChatService, conversations service.ConversationService) *LLMChatRoutes {
+	return &LLMChatRoutes{chat: chat, conversations: conversations}
+}
+
+func (r *LLMChatRoutes) GetName() string { return "llm_chat" }
+
+func (r *LLMChatRoutes) GetPriority() int { return 314 }
+
+func (r *LLMChatRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
+	api := group.Group("/llm/chat")
+	api.Use(AuthenticatedMiddleware())
+	api.POST("", r.chatOnce)
+	api.POST("/stream", r.stream)
+	api.GET("/ws", r.websocket)
+	api.POST("/prompt", r.promptChat)
+	return nil
+}
+
+// chatBody 公开聊天请求体。不接受 system 与 metadata：系统提示来自会话绑定的模板与会话设置，
+// 元数据中的 A/B、测试流量等标记只能由服务端设置；messages 的 role 仅限 user/assistant（见 validateChatMessages）
+type chatBody struct {
+	ConversationID int64             `json:"conversation_id"`
+	Messages       []service.Message `json:"messages"`
+	Temperature    float32           `json:"temperature"`
+	MaxTokens      int               `json:"max_tokens"`
+	Language       string            `json:"language"`
+	// Persist 为 true 且指定会话时，将最后一条用户消息与模型回复追加到会话（需写入权限）
+	Persist bool `json:"persist"`
+}
+
+// validateChatMessages 公开接口的消息只能是用户或助手消息，system 角色会绕过会话系统提示与安全策略
+func validateChatMessages(messages []service.Message) error {
+	if len(messages) == 0 {
+		return errorx.New(errorx.InvalidInput, "messages 不能为空")
+	}
+	for _, m := range messages {
+		if m.Role != "user" && m.Role != "assistant" {
+			return errorx.New(errorx.InvalidInput, "messages 的 role 仅支持 user/assistant")
+		}
+	}
+	return nil
+}
+
+func (b *chatBody) request(userID int64) *service.ChatRequest {
+	return &service.ChatRequest{
+		UserID:         userID,
+		ConversationID: b.ConversationID,
+		Messages:       b.Messages,
+		Temperature:    b.Temperature,
+		MaxTokens:      b.MaxTokens,
+		Language:       b.Language,
+	}
+}
+
+// chatOnce 同步聊天：{"conversation_id": 1, "messages": [{"role": "user", "content": "..."}], "persist": true}
+func (r *LLMChatRoutes) chatOnce(ctx httpx.IContext) error {
+	if r.chat == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM chat service 未配置"})
+	}
+	var body chatBody
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if err := validateChatMessages(body.Messages); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	userID := ctx.GetContext().GetUserID()
+	reqCtx := auditContext(ctx)
+	if body.Persist {
+		if err := r.persistUserMessage(ctx, &body, userID); err != nil {
+			return r.respondError(ctx, err)
+		}
+	}
+
+	resp, err := r.chat.Chat(reqCtx, body.request(userID))
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	setRequestIDHeader(ctx, resp)
+	if body.Persist && body.ConversationID > 0 {
+		if err := r.conversations.AddMessageForUser(reqCtx, userID, body.ConversationID, assistantMessage(resp)); err != nil {
+			return r.respondError(ctx, err)
+		}
+	}
+	return ctx.JSON(200, map[string]any{"response": resp})
+}
+
+// stream 以 SSE 推送回复分片：分片为 message 事件，结束时发送携带用量与 request_id 的 done 事件，失败时发送 error 事件；
+// 空闲时定时发送心跳注释，客户端断开后终止上游调用。请求体同 /llm/chat，不支持 persist
+func (r *LLMChatRoutes) stream(ctx httpx.IContext) error {
+	if r.chat == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM chat service 未配置"})
+	}
+	var body chatBody
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if err := validateChatMessages(body.Messages); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	streamCtx, cancel := context.WithCancel(auditContext(ctx))
+	ch, err := r.chat.StreamChat(streamCtx, body.request(ctx.GetContext().GetUserID()))
+	if err != nil {
+		cancel()
+		return r.respondError(ctx, err)
+	}
+	pumpChatStream(ch, newSSEChatWriter(ctx.GetResponse()), ctx.GetRequest().Context().Done(), cancel)
+	return nil
+}
+
+// websocket 通过 WebSocket 流式聊天：握手后客户端发送一条与 /llm/chat/stream 请求体相同的 JSON 文本消息，
+// 服务端依次推送 {"type": "chunk"}、{"type": "done"} 或 {"type": "error"} 消息后关闭连接；
+// 空闲时发送 ping，客户端关闭连接后终止上游调用
+func (r *LLMChatRoutes) websocket(ctx httpx.IContext) error {
+	if r.chat == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM chat service 未配置"})
+	}
+	conn, err := upgradeWebSocket(ctx.GetResponse(), ctx.GetRequest())
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	w := &wsChatWriter{conn: conn}
+
+	_ = conn.conn.SetReadDeadline(time.Now().Add(wsRequestTimeout))
+	raw, err := conn.readMessage()
+	if err != nil {
+		_ = conn.conn.Close()
+		return nil
+	}
+	_ = conn.conn.SetReadDeadline(time.Time{})
+	var body chatBody
+	if err := json.Unmarshal(raw, &body); err != nil {
+		_ = w.fail(newStreamError(errorx.Wrap(err, errorx.InvalidInput, "请求消息无效")))
+		conn.close(wsCloseUnsupported, "invalid request")
+		return nil
+	}
+	if err := validateChatMessages(body.Messages); err != nil {
+		_ = w.fail(newStreamError(err))
+		conn.close(wsCloseUnsupported, "invalid request")
+		return nil
+	}
+
+	streamCtx, cancel := context.WithCancel(auditContext(ctx))
+	ch, err := r.chat.StreamChat(streamCtx, body.request(ctx.GetContext().GetUserID()))
+	if err != nil {
+		cancel()
+		_ = w.fail(newStreamError(err))
+		conn.close(wsCloseInternal, "")
+		return nil
+	}
+	// 持续读取客户端帧以应答 ping 并感知断开
+	closed := make(chan struct{})
+	super := runtime.NewTaskSupervisor("llm.chat_ws")
+	super.Go(streamCtx, "read", func(context.Context) {
+		defer close(closed)
+		for {
+			if _, err := conn.readMessage(); err != nil {
+				return
+			}
+		}
+	})
+	pumpChatStream(ch, w, closed, cancel)
+	conn.close(wsCloseNormal, "")
+	super.Stop()
+	return nil
+}
+
+// promptChatBody 基于提示词模板的聊天请求体；公开接口仅可使用全局模板与本人的模板
+type promptChatBody struct {
+	PromptName    string                 `json:"prompt_name"`
+	PromptScope   entity.PromptScope     `json:"prompt_scope"`
+	PromptVersion int                    `json:"prompt_version"`
+	Variables     map[string]interface{} `json:"variables"`
+	Messages      []service.Message      `json:"messages"`
+	Temperature   *float32               `json:"temperature"`
+	MaxTokens     int                    `json:"max_tokens"`
+	Language      string                 `json:"language"`
+	Locale        string                 `json:"locale"`
+}
+
+// promptChat 基于提示词模板聊天：{"prompt_name": "greeting", "prompt_scope": "global", "variables": {...}, "messages": [...]}
+func (r *LLMChatRoutes) promptChat(ctx httpx.IContext) error {
+	if r.chat == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM chat service 未配置"})
+	}
+	var body promptChatBody
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if body.PromptName == "" {
+		return ctx.JSON(400, map[string]string{"message": "prompt_name 不能为空"})
+	}
+	if len(body.Messages) > 0 {
+		if err := validateChatMessages(body.Messages); err != nil {
+			return ctx.JSON(400, map[string]string{"message": err.Error()})
+		}
+	}
+	userID := ctx.GetContext().GetUserID()
+	req := &service.PromptChatRequest{
+		UserID:        userID,
+		PromptName:    body.PromptName,
+		PromptVersion: body.PromptVersion,
+		Variables:     body.Variables,
+		Messages:      body.Messages,
+		Temperature:   body.Temperature,
+		MaxTokens:     body.MaxTokens,
+		Language:      body.Language,
+		Locale:        body.Locale,
+	}
+	switch body.PromptScope {
+	case "", entity.PromptScopeGlobal:
+		req.PromptScope = entity.PromptScopeGlobal
+	case entity.PromptScopeUser:
+		req.PromptScope, req.PromptScopeID = entity.PromptScopeUser, userID
+	default:
+		return ctx.JSON(400, map[string]string{"message": "prompt_scope 仅支持 global/user"})
+	}
+
+	resp, err := r.chat.ChatWithPrompt(auditContext(ctx), req)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	setRequestIDHeader(ctx, resp)
+	return ctx.JSON(200, map[string]any{"response": resp})
+}
+
+// persistUserMessage 追加请求中的最后一条用户消息；同时校验写入权限，无权限时不发起调用
+func (r *LLMChatRoutes) persistUserMessage(ctx httpx.IContext, body *chatBody, userID int64) error {
+	if body.ConversationID <= 0 {
+		return errorx.New(errorx.InvalidInput, "persist 需指定 conversation_id")
+	}
+	if r.conversations == nil {
+		return errorx.New(errorx.Internal, "LLM conversation service 未配置")
+	}
+	last := body.Messages[len(body.Messages)-1]
+	if last.Role != "user" {
+		return errorx.New(errorx.InvalidInput, "persist 时最后一条消息须为用户消息")
+	}
+	return r.conversations.AddMessageForUser(auditContext(ctx), userID, body.ConversationID, &entity.Message{
+		Role:         "user",
+		Content:      last.Content,
+		SenderUserID: userID,
+	})
+}
+
+func assistantMessage(resp *service.ChatResponse) *entity.Message {
+	msg := &entity.Message{Role: "assistant", Content: resp.Content}
+	if resp.Usage != nil {
+		msg.Tokens = resp.Usage.ResponseTokens
+	}
+	return msg
+}
+
+// setRequestIDHeader 通过 X-Request-ID 响应头返回调用的请求 ID
+func setRequestIDHeader(ctx httpx.IContext, resp *service.ChatResponse) {
+	if id, ok := resp.Metadata["request_id"].(string); ok && id != "" {
+		ctx.GetResponse().Header().Set("X-Request-ID", id)
+	}
+}
+
+// respondError 按错误类型映射状态码；限流与封禁返回 429 与 Retry-After
+func (r *LLMChatRoutes) respondError(ctx httpx.IContext, err error) error {
+	return respondUserError(ctx, err)
+}
+
+// respondUserError 面向用户接口的错误响应：限流错误交由 respondRateLimited，其余按 userErrorStatus 映射
+func respondUserError(ctx httpx.IContext, err error) error {
+	if handled, respErr := respondRateLimited(ctx, err); handled {
+		return respErr
+	}
+	return ctx.JSON(userErrorStatus(err), map[string]string{"message": err.Error()})
+}
+
+// userErrorStatus 面向用户接口的错误状态码，流式响应在错误帧中携带；
+// 限流错误包装了 Validation，须先于其判断
+func userErrorStatus(err error) int {
+	if _, ok := service.AsRateLimited(err); ok {
+		return 429
+	}
+	switch {
+	case errorx.Is(err, errorx.Unauthorized):
+		return 401
+	case errorx.Is(err, errorx.Forbidden):
+		return 403
+	case errorx.Is(err, errorx.Validation), errorx.Is(err, errorx.InvalidInput):
+		return 400
+	case errorx.Is(err, errorx.NotFound):
+		return 404
+	}
+	return 500
+}
@@ -0,0 +1,93 @@
+package router
+
+import (
+	"fmt"
+	"strconv"
+
+	"gochen-llm/service"
+	"gochen/httpx"
+)
+
+// ChatJobRoutes 提供异步聊天任务的提交与轮询接口
+type ChatJobRoutes struct {
+	jobs service.ChatJobService
+}
+
+func NewChatJobRoutes(jobs service.ChatJobService) *ChatJobRoutes {
+	return &ChatJobRoutes{jobs: jobs}
+}
+
+func (r *ChatJobRoutes) GetName() string { return "llm_chat_jobs" }
+
+func (r *ChatJobRoutes) GetPriority() int { return 315 }
+
+func (r *ChatJobRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
+	api := group.Group("/llm/jobs")
+	api.Use(AuthenticatedMiddleware())
+	api.POST("", r.submit)
+	api.GET("/status", r.status)
+	return nil
+}
+
+// chatJobBody 异步任务请求体，字段同 chatBody（不支持 persist），另可指定完成回调地址；消息角色同样仅限 user/assistant
+type chatJobBody struct {
+	ConversationID int64             `json:"conversation_id"`
+	Messages       []service.Message `json:"messages"`
+	Temperature    float32           `json:"temperature"`
+	MaxTokens      int               `json:"max_tokens"`
+	Language       string            `json:"language"`
+	CallbackURL    string            `json:"callback_url"`
+}
+
+func (r *ChatJobRoutes) submit(ctx httpx.IContext) error {
+	if r.jobs == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM chat job service 未配置"})
+	}
+	var body chatJobBody
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if err := validateChatMessages(body.Messages); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	// 以认证用户为准，避免替他人提交任务
+	req := &service.ChatJobRequest{
+		ChatRequest: service.ChatRequest{
+			UserID:         ctx.GetContext().GetUserID(),
+			ConversationID: body.ConversationID,
+			Messages:       body.Messages,
+			Temperature:    body.Temperature,
+			MaxTokens:      body.MaxTokens,
+			Language:       body.Language,
+		},
+		CallbackURL: body.CallbackURL,
+	}
+
+	jobID, err := r.jobs.SubmitChat(ctx.GetContext(), req)
+	if err != nil {
+		return respondUserError(ctx, err)
+	}
+	return ctx.JSON(202, map[string]any{
+		"job_id": jobID,
+		"status": "pending",
+	})
+}
+
+func (r *ChatJobRoutes) status(ctx httpx.IContext) error {
+	if r.jobs == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM chat job service 未配置"})
+	}
+	jobID, err := strconv.ParseInt(ctx.GetRequest().URL.Query().Get("id"), 10, 64)
+	if err != nil || jobID <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+
+	job, err := r.jobs.GetJob(ctx.GetContext(), jobID)
+	if err != nil {
+		return ctx.JSON(404, map[string]string{"message": err.Error()})
+	}
+	if job.UserID != ctx.GetContext().GetUserID() {
+		return ctx.JSON(404, map[string]string{"message": fmt.Sprintf("任务 %d 不存在", jobID)})
+	}
+	return ctx.JSON(200, map[string]any{"job": job})
+}
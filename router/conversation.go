@@ -0,0 +1,753 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen-llm/service"
+	"gochen/errorx"
+	"gochen/httpx"
+)
+
+// ConversationRoutes 提供面向用户的会话接口（仅可访问本人或被共享的会话）
+type ConversationRoutes struct {
+	conversations service.ConversationService
+}
+
+var (
+	convTypesMu       sync.RWMutex
+	creatableConvType = map[string]bool{entity.ConversationTypeChat: true}
+)
+
+// SetCreatableConversationTypes 设置用户可通过 /llm/conversations/create 创建的会话类型，默认仅 chat。
+// 会话类型可绑定独立的安全策略（优先于组织/项目策略），只应开放不比组织策略宽松的类型；
+// 需要更严格策略的产品应由宿主按真实归属设置组织/项目作用域，而非依赖用户选择的类型
+func SetCreatableConversationTypes(types ...string) {
+	allowed := make(map[string]bool, len(types)+1)
+	allowed[entity.ConversationTypeChat] = true
+	for _, t := range types {
+		if t = strings.TrimSpace(t); t != "" {
+			allowed[t] = true
+		}
+	}
+	convTypesMu.Lock()
+	defer convTypesMu.Unlock()
+	creatableConvType = allowed
+}
+
+func creatableConversationType(t string) bool {
+	convTypesMu.RLock()
+	defer convTypesMu.RUnlock()
+	return creatableConvType[t]
+}
+
+func NewConversationRoutes(conversations service.ConversationService) *ConversationRoutes {
+	return &ConversationRoutes{conversations: conversations}
+}
+
+func (r *ConversationRoutes) GetName() string { return "llm_conversations" }
+
+func (r *ConversationRoutes) GetPriority() int { return 316 }
+
+func (r *ConversationRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
+	api := group.Group("/llm/conversations")
+	api.Use(AuthenticatedMiddleware())
+	api.GET("", r.list)
+	api.POST("/create", r.create)
+	api.GET("/search", r.search)
+	api.GET("/get", r.get)
+	api.GET("/messages", r.messages)
+	api.GET("/messages/feedback", r.messageFeedback)
+	api.POST("/messages/feedback", r.submitFeedback)
+	api.GET("/usage", r.usage)
+	api.GET("/stats", r.stats)
+	api.GET("/settings", r.settings)
+	api.POST("/settings", r.updateSettings)
+	api.GET("/branches", r.branches)
+	api.GET("/branches/tree", r.branchTree)
+	api.GET("/branches/messages", r.branchMessages)
+	api.POST("/title", r.generateTitle)
+	api.GET("/export", r.export)
+	api.POST("/import", r.importConversation)
+	api.POST("/read", r.markRead)
+	api.POST("/archive", r.archive)
+	api.POST("/unarchive", r.unarchive)
+	api.POST("/delete", r.delete)
+	api.GET("/access", r.listAccess)
+	api.POST("/access/grant", r.grantAccess)
+	api.POST("/access/revoke", r.revokeAccess)
+	api.GET("/participants", r.participants)
+	api.GET("/story", r.storyState)
+	api.POST("/story/transition", r.storyTransition)
+	api.GET("/story/history", r.storyHistory)
+	api.POST("/participants/leave", r.leave)
+	api.GET("/shares", r.listShares)
+	api.POST("/shares/create", r.createShare)
+	api.POST("/shares/revoke", r.revokeShare)
+
+	// 分享链接的公开访问入口，不要求登录
+	public := group.Group("/llm/shared")
+	public.GET("", r.sharedConversation)
+	return nil
+}
+
+// list 会话列表：?type=&status=&updated_from=&updated_to=（RFC3339）&sort=last_activity|created|updated&shared=true（含共享给我的）&limit=&offset=
+func (r *ConversationRoutes) list(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	filter := entity.ConversationFilter{
+		UserID: ctx.GetContext().GetUserID(),
+		Type:   q.Get("type"),
+		Status: q.Get("status"),
+		Sort:   q.Get("sort"),
+	}
+	filter.IncludeShared = q.Get("shared") == "true"
+	if v := q.Get("updated_from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return ctx.JSON(400, map[string]string{"message": "updated_from 需为 RFC3339 时间"})
+		}
+		filter.UpdatedFrom = &t
+	}
+	if v := q.Get("updated_to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return ctx.JSON(400, map[string]string{"message": "updated_to 需为 RFC3339 时间"})
+		}
+		filter.UpdatedTo = &t
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	offset, _ := strconv.Atoi(q.Get("offset"))
+
+	list, total, err := r.conversations.ListConversations(ctx.GetContext(), filter, limit, offset)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"conversations": list, "total": total})
+}
+
+// create 创建本人的会话：{"type": "chat", "title": "...", "metadata": {...}}；type 与 title 优先于 metadata 中的同名字段，
+// type 须在 SetCreatableConversationTypes 允许的范围内
+func (r *ConversationRoutes) create(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	var body struct {
+		Type     string         `json:"type"`
+		Title    string         `json:"title"`
+		Metadata map[string]any `json:"metadata"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	metadata := body.Metadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	if body.Type != "" {
+		metadata["type"] = body.Type
+	}
+	if body.Title != "" {
+		metadata["title"] = body.Title
+	}
+	if t, ok := metadata["type"]; ok {
+		if s, _ := t.(string); s != "" && !creatableConversationType(s) {
+			return ctx.JSON(400, map[string]string{"message": fmt.Sprintf("不允许创建类型为 %v 的会话", t)})
+		}
+	}
+	conv, err := r.conversations.CreateConversation(auditContext(ctx), ctx.GetContext().GetUserID(), metadata)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"conversation": conv})
+}
+
+// search 检索本人会话中的消息：?q=&mode=keyword|semantic|hybrid&conversation_id=&limit=
+func (r *ConversationRoutes) search(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	req := service.ConversationSearchRequest{
+		UserID: ctx.GetContext().GetUserID(),
+		Query:  q.Get("q"),
+		Mode:   q.Get("mode"),
+	}
+	if v := q.Get("conversation_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return ctx.JSON(400, map[string]string{"message": "conversation_id 无效"})
+		}
+		req.ConversationID = id
+	}
+	req.Limit, _ = strconv.Atoi(q.Get("limit"))
+
+	hits, err := r.conversations.SearchConversations(ctx.GetContext(), req)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"hits": hits})
+}
+
+// get 读取会话详情：?id=
+func (r *ConversationRoutes) get(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	id, err := strconv.ParseInt(ctx.GetRequest().URL.Query().Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	conv, err := r.conversations.GetConversationForUser(ctx.GetContext(), ctx.GetContext().GetUserID(), id)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"conversation": conv})
+}
+
+// messages 分页读取会话消息：?id=&before=&after=（消息 ID 游标）&limit=&order=asc|desc（默认 desc）
+func (r *ConversationRoutes) messages(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	id, err := strconv.ParseInt(q.Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	query := entity.MessageQuery{ConversationID: id, Ascending: q.Get("order") == "asc"}
+	if v := q.Get("before"); v != "" {
+		if query.BeforeID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return ctx.JSON(400, map[string]string{"message": "before 无效"})
+		}
+	}
+	if v := q.Get("after"); v != "" {
+		if query.AfterID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return ctx.JSON(400, map[string]string{"message": "after 无效"})
+		}
+	}
+	query.Limit, _ = strconv.Atoi(q.Get("limit"))
+
+	page, err := r.conversations.ListMessages(ctx.GetContext(), ctx.GetContext().GetUserID(), query)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, page)
+}
+
+// usage 会话累计用量（token 与成本）：?id=
+func (r *ConversationRoutes) usage(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	id, err := strconv.ParseInt(ctx.GetRequest().URL.Query().Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	usage, err := r.conversations.GetConversationUsage(ctx.GetContext(), ctx.GetContext().GetUserID(), id)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, usage)
+}
+
+// stats 会话统计（消息数、用量、成本、模型、持续时间）：?id=
+func (r *ConversationRoutes) stats(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	id, err := strconv.ParseInt(ctx.GetRequest().URL.Query().Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	stats, err := r.conversations.GetConversationStats(ctx.GetContext(), ctx.GetContext().GetUserID(), id)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, stats)
+}
+
+// branches 会话的直接分支：?id=
+func (r *ConversationRoutes) branches(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	id, err := strconv.ParseInt(ctx.GetRequest().URL.Query().Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	list, err := r.conversations.ListBranches(ctx.GetContext(), ctx.GetContext().GetUserID(), id)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"branches": list})
+}
+
+// branchTree 会话所在的分支树：?id=
+func (r *ConversationRoutes) branchTree(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	id, err := strconv.ParseInt(ctx.GetRequest().URL.Query().Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	tree, err := r.conversations.GetBranchTree(ctx.GetContext(), ctx.GetContext().GetUserID(), id)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"tree": tree})
+}
+
+// branchMessages 分支视角下的最近消息（含继承自父会话的历史）：?id=&limit=
+func (r *ConversationRoutes) branchMessages(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	id, err := strconv.ParseInt(q.Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	msgs, err := r.conversations.GetBranchMessages(ctx.GetContext(), ctx.GetContext().GetUserID(), id, limit)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, msgs)
+}
+
+// settings 会话级覆盖设置：?id=
+func (r *ConversationRoutes) settings(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	id, err := strconv.ParseInt(ctx.GetRequest().URL.Query().Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	settings, err := r.conversations.GetConversationSettings(ctx.GetContext(), ctx.GetContext().GetUserID(), id)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"settings": settings})
+}
+
+// updateSettings 替换会话级覆盖设置：{"id": 1, "settings": {"system_prompt": "", "temperature": 0.3, "model_tag": ""}}
+func (r *ConversationRoutes) updateSettings(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	var body struct {
+		ID       int64                        `json:"id"`
+		Settings *entity.ConversationSettings `json:"settings"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	settings, err := r.conversations.UpdateConversationSettings(ctx.GetContext(), ctx.GetContext().GetUserID(), body.ID, body.Settings)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"settings": settings})
+}
+
+// generateTitle 生成（force 时重新生成）会话标题：{"id": 1, "force": false}
+func (r *ConversationRoutes) generateTitle(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	var body struct {
+		ID    int64 `json:"id"`
+		Force bool  `json:"force"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	title, err := r.conversations.GenerateTitle(ctx.GetContext(), ctx.GetContext().GetUserID(), body.ID, body.Force)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]string{"title": title})
+}
+
+// export 导出会话：?id=&format=json|markdown&branches=true
+func (r *ConversationRoutes) export(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	id, err := strconv.ParseInt(q.Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	format := q.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "markdown" {
+		return ctx.JSON(400, map[string]string{"message": "format 仅支持 json/markdown"})
+	}
+	doc, err := r.conversations.ExportConversation(ctx.GetContext(), ctx.GetContext().GetUserID(), id, q.Get("branches") == "true")
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	if format == "json" {
+		return ctx.JSON(200, doc)
+	}
+	w := ctx.GetResponse()
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="conversation_%d.md"`, id))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(service.RenderConversationMarkdown(doc)))
+	return nil
+}
+
+// importConversation 导入会话：请求体为 export 接口返回的 JSON 文档
+func (r *ConversationRoutes) importConversation(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	var doc service.ConversationExport
+	if err := ctx.BindJSON(&doc); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	conv, err := r.conversations.ImportConversation(ctx.GetContext(), ctx.GetContext().GetUserID(), &doc)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"conversation": conv})
+}
+
+type conversationIDBody struct {
+	ID int64 `json:"id"`
+}
+
+func (r *ConversationRoutes) bindConversationID(ctx httpx.IContext) (int64, error) {
+	var body conversationIDBody
+	if err := ctx.BindJSON(&body); err != nil {
+		return 0, errorx.Wrap(err, errorx.InvalidInput, "请求体无效")
+	}
+	if body.ID <= 0 {
+		return 0, errorx.New(errorx.InvalidInput, "id 无效")
+	}
+	return body.ID, nil
+}
+
+// archive 归档会话：{"id": 1}
+func (r *ConversationRoutes) archive(ctx httpx.IContext) error {
+	return r.mutate(ctx, func(c context.Context, userID, id int64) error {
+		return r.conversations.ArchiveConversation(c, userID, id)
+	})
+}
+
+// markRead 标记已读：{"id": 1, "message_id": 0}，message_id 为 0 时标记到最新消息
+func (r *ConversationRoutes) markRead(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	var body struct {
+		ID        int64 `json:"id"`
+		MessageID int64 `json:"message_id"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	state, err := r.conversations.MarkConversationRead(ctx.GetContext(), ctx.GetContext().GetUserID(), body.ID, body.MessageID)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{
+		"last_read_message_id": state.LastReadMessageID,
+		"unread_count":         state.UnreadCount,
+	})
+}
+
+// unarchive 取消归档：{"id": 1}
+func (r *ConversationRoutes) unarchive(ctx httpx.IContext) error {
+	return r.mutate(ctx, func(c context.Context, userID, id int64) error {
+		return r.conversations.UnarchiveConversation(c, userID, id)
+	})
+}
+
+// delete 删除会话（软删除，保留期满后物理删除）：{"id": 1}
+func (r *ConversationRoutes) delete(ctx httpx.IContext) error {
+	return r.mutate(ctx, func(c context.Context, userID, id int64) error {
+		return r.conversations.DeleteConversation(c, userID, id)
+	})
+}
+
+func (r *ConversationRoutes) mutate(ctx httpx.IContext, fn func(ctx context.Context, userID, conversationID int64) error) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	id, err := r.bindConversationID(ctx)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	if err := fn(ctx.GetContext(), ctx.GetContext().GetUserID(), id); err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]string{"message": "ok"})
+}
+
+// listAccess 查看会话的共享授权（仅归属用户）：?id=
+func (r *ConversationRoutes) listAccess(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	id, err := strconv.ParseInt(ctx.GetRequest().URL.Query().Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	list, err := r.conversations.ListConversationAccess(ctx.GetContext(), ctx.GetContext().GetUserID(), id)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"access": list})
+}
+
+type conversationAccessBody struct {
+	ID     int64  `json:"id"`
+	UserID int64  `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+// grantAccess 将会话共享给其他用户（归属用户或 manager）：{"id": 1, "user_id": 2, "role": "viewer|editor|manager"}
+func (r *ConversationRoutes) grantAccess(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	var body conversationAccessBody
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if err := r.conversations.GrantConversationAccess(ctx.GetContext(), ctx.GetContext().GetUserID(), body.ID, body.UserID, body.Role); err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]string{"message": "ok"})
+}
+
+// revokeAccess 撤销共享授权（归属用户或 manager）：{"id": 1, "user_id": 2}
+func (r *ConversationRoutes) revokeAccess(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	var body conversationAccessBody
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if err := r.conversations.RevokeConversationAccess(ctx.GetContext(), ctx.GetContext().GetUserID(), body.ID, body.UserID); err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]string{"message": "ok"})
+}
+
+// participants 会话参与者列表（任一参与者）：?id=
+func (r *ConversationRoutes) participants(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	id, err := strconv.ParseInt(ctx.GetRequest().URL.Query().Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	list, err := r.conversations.ListParticipants(ctx.GetContext(), ctx.GetContext().GetUserID(), id)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"participants": list})
+}
+
+// leave 被共享用户退出会话：{"id": 1}
+func (r *ConversationRoutes) leave(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	var body conversationAccessBody
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if err := r.conversations.LeaveConversation(ctx.GetContext(), ctx.GetContext().GetUserID(), body.ID); err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]string{"message": "ok"})
+}
+
+// messageFeedback 当前用户对消息的反馈：?id=&message_id=
+func (r *ConversationRoutes) messageFeedback(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	id, err := strconv.ParseInt(q.Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	messageID, err := strconv.ParseInt(q.Get("message_id"), 10, 64)
+	if err != nil || messageID <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "message_id 无效"})
+	}
+	feedback, err := r.conversations.GetMessageFeedback(ctx.GetContext(), ctx.GetContext().GetUserID(), id, messageID)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"feedback": feedback})
+}
+
+// submitFeedback 对助手消息点赞/点踩或提交文字反馈：{"id": 1, "message_id": 2, "rating": 1, "comment": ""}
+func (r *ConversationRoutes) submitFeedback(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	var body struct {
+		ID int64 `json:"id"`
+		service.MessageFeedbackRequest
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	feedback, err := r.conversations.SubmitMessageFeedback(ctx.GetContext(), ctx.GetContext().GetUserID(), body.ID, body.MessageFeedbackRequest)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"feedback": feedback})
+}
+
+// storyState 故事会话的当前进度：?id=
+func (r *ConversationRoutes) storyState(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	id, err := strconv.ParseInt(ctx.GetRequest().URL.Query().Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	view, err := r.conversations.GetStoryState(ctx.GetContext(), ctx.GetContext().GetUserID(), id)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, view)
+}
+
+// storyTransition 故事状态流转：{"id": 1, "event": "start_task", "task_id": "t1", "reason": "", "expected_seq": 3}
+func (r *ConversationRoutes) storyTransition(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	var body struct {
+		ID int64 `json:"id"`
+		service.StoryTransition
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	view, err := r.conversations.TransitionStoryState(ctx.GetContext(), ctx.GetContext().GetUserID(), body.ID, body.StoryTransition)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, view)
+}
+
+// storyHistory 故事状态流转历史：?id=&before_seq=&limit=
+func (r *ConversationRoutes) storyHistory(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	id, err := strconv.ParseInt(q.Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	beforeSeq, _ := strconv.ParseInt(q.Get("before_seq"), 10, 64)
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	changes, err := r.conversations.ListStoryStateChanges(ctx.GetContext(), ctx.GetContext().GetUserID(), id, beforeSeq, limit)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"changes": changes})
+}
+
+// listShares 会话的分享链接（仅归属用户）：?id=
+func (r *ConversationRoutes) listShares(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	id, err := strconv.ParseInt(ctx.GetRequest().URL.Query().Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	list, err := r.conversations.ListShareLinks(ctx.GetContext(), ctx.GetContext().GetUserID(), id)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"shares": list})
+}
+
+// createShare 生成分享链接：{"id": 1, "expires_in_hours": 72}，expires_in_hours 为 0 表示不过期
+func (r *ConversationRoutes) createShare(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	var body struct {
+		ID             int64 `json:"id"`
+		ExpiresInHours int   `json:"expires_in_hours"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	share, err := r.conversations.CreateShareLink(ctx.GetContext(), ctx.GetContext().GetUserID(), body.ID, time.Duration(body.ExpiresInHours)*time.Hour)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{
+		"id":            share.ID,
+		"token":         share.Token,
+		"path":          "/llm/shared?token=" + share.Token,
+		"message_count": share.MessageCount,
+		"expires_at":    share.ExpiresAt,
+	})
+}
+
+// revokeShare 撤销分享链接：{"id": 1, "share_id": 2}
+func (r *ConversationRoutes) revokeShare(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	var body struct {
+		ID      int64 `json:"id"`
+		ShareID int64 `json:"share_id"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if err := r.conversations.RevokeShareLink(ctx.GetContext(), ctx.GetContext().GetUserID(), body.ID, body.ShareID); err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]string{"message": "ok"})
+}
+
+// sharedConversation 公开读取分享快照：?token=
+func (r *ConversationRoutes) sharedConversation(ctx httpx.IContext) error {
+	if r.conversations == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM conversation service 未配置"})
+	}
+	shared, err := r.conversations.GetSharedConversation(ctx.GetContext(), ctx.GetRequest().URL.Query().Get("token"))
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, shared)
+}
+
+// respondError 按错误类型映射状态码，与聊天接口一致
+func (r *ConversationRoutes) respondError(ctx httpx.IContext, err error) error {
+	return respondUserError(ctx, err)
+}
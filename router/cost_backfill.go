@@ -0,0 +1,41 @@
+package router
+
+import (
+	"gochen-llm/service"
+	"gochen/httpx"
+)
+
+// startCostBackfill 启动成本回填任务：{"start_at": "...", "end_at": "...", "provider": "", "model": "", "dry_run": false}
+func (r *LLMAdminRoutes) startCostBackfill(ctx httpx.IContext) error {
+	if r.backfill == nil {
+		return ctx.JSON(500, map[string]string{"message": "成本回填服务未配置"})
+	}
+	var body service.CostBackfillRequest
+	if err := ctx.BindJSON(&body); err != nil {
+		return r.respondError(ctx, 400, err)
+	}
+	status, err := r.backfill.StartBackfill(auditContext(ctx), &body)
+	if err != nil {
+		return r.respondError(ctx, adminErrorStatus(err), err)
+	}
+	return ctx.JSON(202, map[string]any{"status": status})
+}
+
+// getCostBackfill 当前或最近一次成本回填任务的进度，从未运行时 status 为 null
+func (r *LLMAdminRoutes) getCostBackfill(ctx httpx.IContext) error {
+	if r.backfill == nil {
+		return ctx.JSON(500, map[string]string{"message": "成本回填服务未配置"})
+	}
+	return ctx.JSON(200, map[string]any{"status": r.backfill.Status()})
+}
+
+func (r *LLMAdminRoutes) cancelCostBackfill(ctx httpx.IContext) error {
+	if r.backfill == nil {
+		return ctx.JSON(500, map[string]string{"message": "成本回填服务未配置"})
+	}
+	if !r.backfill.Cancel() {
+		return ctx.JSON(404, map[string]string{"message": "没有运行中的成本回填任务"})
+	}
+	r.auditChange(ctx, "admin.cancel_cost_backfill", "metrics", 0, nil, nil)
+	return ctx.JSON(200, map[string]any{"status": r.backfill.Status()})
+}
@@ -0,0 +1,89 @@
+package router
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"gochen-llm/service"
+	"gochen/httpx"
+)
+
+// getCostDigestConfig 成本日报配置，Webhook 密钥不回显
+func (r *LLMAdminRoutes) getCostDigestConfig(ctx httpx.IContext) error {
+	if r.digests == nil {
+		return ctx.JSON(500, map[string]string{"message": "成本日报服务未配置"})
+	}
+	return ctx.JSON(200, costDigestConfigView(r.digests.GetConfig()))
+}
+
+// updateCostDigestConfig 更新成本日报配置：{"enabled": true, "hour": 1, "top_users": 10, "webhook_url": "", "webhook_secret": ""}；
+// webhook_secret 为空且 webhook_url 未变时保留原密钥
+func (r *LLMAdminRoutes) updateCostDigestConfig(ctx httpx.IContext) error {
+	if r.digests == nil {
+		return ctx.JSON(500, map[string]string{"message": "成本日报服务未配置"})
+	}
+	var cfg service.CostDigestConfig
+	if err := ctx.BindJSON(&cfg); err != nil {
+		return r.respondError(ctx, 400, err)
+	}
+	before := r.digests.GetConfig()
+	if cfg.WebhookSecret == "" && cfg.WebhookURL == before.WebhookURL {
+		cfg.WebhookSecret = before.WebhookSecret
+	}
+	if err := r.digests.SetConfig(cfg); err != nil {
+		return r.respondError(ctx, adminErrorStatus(err), err)
+	}
+	after := r.digests.GetConfig()
+	r.auditChange(ctx, "admin.update_cost_digest", "cost_digest", 0, before, after)
+	return ctx.JSON(200, costDigestConfigView(after))
+}
+
+// listCostDigests 最近的成本日报：?limit=30
+func (r *LLMAdminRoutes) listCostDigests(ctx httpx.IContext) error {
+	if r.digests == nil {
+		return ctx.JSON(500, map[string]string{"message": "成本日报服务未配置"})
+	}
+	limit, _ := strconv.Atoi(ctx.GetRequest().URL.Query().Get("limit"))
+	list, err := r.digests.ListDigests(ctx.GetContext(), limit)
+	if err != nil {
+		return r.respondError(ctx, 500, err)
+	}
+	return ctx.JSON(200, map[string]any{"digests": list})
+}
+
+// runCostDigest 立即生成并投递指定日期（UTC）的日报：{"day": "2006-01-02"}，day 为空时为前一日
+func (r *LLMAdminRoutes) runCostDigest(ctx httpx.IContext) error {
+	if r.digests == nil {
+		return ctx.JSON(500, map[string]string{"message": "成本日报服务未配置"})
+	}
+	var body struct {
+		Day string `json:"day"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return r.respondError(ctx, 400, err)
+	}
+	day := time.Now().UTC().AddDate(0, 0, -1)
+	if body.Day != "" {
+		d, err := time.Parse("2006-01-02", body.Day)
+		if err != nil {
+			return r.respondError(ctx, 400, fmt.Errorf("day 格式无效，应为 YYYY-MM-DD"))
+		}
+		day = d
+	}
+	digest, err := r.digests.RunOnce(ctx.GetContext(), day)
+	if err != nil {
+		return r.respondError(ctx, 500, err)
+	}
+	return ctx.JSON(200, map[string]any{"digest": digest})
+}
+
+func costDigestConfigView(cfg service.CostDigestConfig) map[string]any {
+	return map[string]any{
+		"enabled":            cfg.Enabled,
+		"hour":               cfg.Hour,
+		"top_users":          cfg.TopUsers,
+		"webhook_url":        cfg.WebhookURL,
+		"has_webhook_secret": cfg.WebhookSecret != "",
+	}
+}
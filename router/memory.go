@@ -0,0 +1,91 @@
+package router
+
+import (
+	"gochen-llm/service"
+	"gochen/errorx"
+	"gochen/httpx"
+)
+
+// MemoryRoutes 提供面向用户的长期记忆接口（查看、删除、立即从会话提取）
+type MemoryRoutes struct {
+	memories service.MemoryService
+}
+
+func NewMemoryRoutes(memories service.MemoryService) *MemoryRoutes {
+	return &MemoryRoutes{memories: memories}
+}
+
+func (r *MemoryRoutes) GetName() string { return "llm_memories" }
+
+func (r *MemoryRoutes) GetPriority() int { return 317 }
+
+func (r *MemoryRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
+	api := group.Group("/llm/memories")
+	api.Use(AuthenticatedMiddleware())
+	api.GET("", r.list)
+	api.POST("/delete", r.delete)
+	api.POST("/extract", r.extract)
+	return nil
+}
+
+// list 查看本人的长期记忆
+func (r *MemoryRoutes) list(ctx httpx.IContext) error {
+	if r.memories == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM memory service 未配置"})
+	}
+	list, err := r.memories.ListMemories(ctx.GetContext(), ctx.GetContext().GetUserID())
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"memories": list})
+}
+
+// delete 删除一条记忆：{"id": 1}
+func (r *MemoryRoutes) delete(ctx httpx.IContext) error {
+	if r.memories == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM memory service 未配置"})
+	}
+	var body struct {
+		ID int64 `json:"id"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if err := r.memories.DeleteMemory(ctx.GetContext(), ctx.GetContext().GetUserID(), body.ID); err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]string{"message": "ok"})
+}
+
+// extract 立即从本人的会话中提取记忆：{"conversation_id": 1}
+func (r *MemoryRoutes) extract(ctx httpx.IContext) error {
+	if r.memories == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM memory service 未配置"})
+	}
+	var body struct {
+		ConversationID int64 `json:"conversation_id"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if body.ConversationID <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "conversation_id 无效"})
+	}
+	created, err := r.memories.ExtractConversation(ctx.GetContext(), ctx.GetContext().GetUserID(), body.ConversationID)
+	if err != nil {
+		return r.respondError(ctx, err)
+	}
+	return ctx.JSON(200, map[string]any{"created": created})
+}
+
+// respondError 按错误类型映射状态码
+func (r *MemoryRoutes) respondError(ctx httpx.IContext, err error) error {
+	status := 500
+	switch {
+	case errorx.Is(err, errorx.Validation), errorx.Is(err, errorx.InvalidInput):
+		status = 400
+	case errorx.Is(err, errorx.NotFound):
+		status = 404
+	}
+	return ctx.JSON(status, map[string]string{"message": err.Error()})
+}
@@ -1,21 +1,26 @@
 package router
 
 import (
+	"net/url"
 	"strconv"
 	"time"
 
 	"gochen-llm/entity"
 	"gochen-llm/repo"
+	"gochen-llm/service"
+	"gochen/errorx"
 	"gochen/httpx"
 )
 
 // MetricsRoutes 提供指标看板接口（时间窗口聚合与原始日志分页）
 type MetricsRoutes struct {
-	metrics repo.MetricsRepo
+	metrics   repo.MetricsRepo
+	costs     service.CostReporter
+	anomalies service.MetricsAnomalyDetector
 }
 
-func NewMetricsRoutes(metrics repo.MetricsRepo) *MetricsRoutes {
-	return &MetricsRoutes{metrics: metrics}
+func NewMetricsRoutes(metrics repo.MetricsRepo, costs service.CostReporter, anomalies service.MetricsAnomalyDetector) *MetricsRoutes {
+	return &MetricsRoutes{metrics: metrics, costs: costs, anomalies: anomalies}
 }
 
 func (r *MetricsRoutes) GetName() string { return "llm_metrics" }
@@ -27,6 +32,13 @@ func (r *MetricsRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
 	api.GET("/agg", r.aggregate)
 	api.GET("/list", r.list)
 	api.GET("/significance", r.significance)
+	api.GET("/feedback", r.feedback)
+	api.GET("/funnel", r.funnel)
+	api.GET("/timeseries", r.timeSeries)
+	api.GET("/cost", r.cost)
+	api.GET("/anomalies", r.listAnomalies)
+	api.GET("/export", r.exportMetrics)
+	api.GET("/agg/export", r.exportAggregate)
 	return nil
 }
 
@@ -35,6 +47,85 @@ func (r *MetricsRoutes) aggregate(ctx httpx.IContext) error {
 		return ctx.JSON(500, map[string]string{"message": "LLM metrics repo 未配置"})
 	}
 
+	q := ctx.GetRequest().URL.Query()
+	filter := parseMetricsFilter(q)
+
+	group := q.Get("group_by")
+	if group == "variant" && filter.ABTestID != nil {
+		rows, err := r.metrics.AggregateByVariant(ctx.GetContext(), filter)
+		if err != nil {
+			return ctx.JSON(500, map[string]string{"message": err.Error()})
+		}
+		return ctx.JSON(200, map[string]any{"variants": rows})
+	}
+	if group != "" && group != "variant" {
+		var rows any
+		var err error
+		switch group {
+		case "model":
+			rows, err = r.metrics.AggregateByModel(ctx.GetContext(), filter)
+		case "endpoint":
+			rows, err = r.metrics.AggregateByEndpoint(ctx.GetContext(), filter)
+		default:
+			rows, err = r.metrics.AggregateBy(ctx.GetContext(), filter, group)
+		}
+		if err != nil {
+			if errorx.Is(err, errorx.InvalidInput) {
+				return ctx.JSON(400, map[string]string{"message": err.Error()})
+			}
+			return ctx.JSON(500, map[string]string{"message": err.Error()})
+		}
+		return ctx.JSON(200, map[string]any{"group_by": group, "groups": rows})
+	}
+
+	report, err := r.metrics.Aggregate(ctx.GetContext(), filter)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]any{"report": report})
+}
+
+func (r *MetricsRoutes) list(ctx httpx.IContext) error {
+	if r.metrics == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM metrics repo 未配置"})
+	}
+
+	q := ctx.GetRequest().URL.Query()
+	filter := parseMetricsFilter(q)
+
+	limit := 50
+	if v := q.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 500 {
+			limit = n
+		}
+	}
+	offset := 0
+	if v := q.Get("offset"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			offset = n
+		}
+	}
+
+	list, total, err := r.metrics.List(ctx.GetContext(), filter, limit, offset)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
+	}
+
+	return ctx.JSON(200, map[string]any{
+		"total":  total,
+		"list":   list,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+// significance A/B 显著性：?ab_test_id=&metric=conversion|latency|tokens|rating|score&count_by=user|call&provider=&model=&outcome=&start=&end=，
+// metric 默认为 conversion；转化分析默认按去重用户计数，count_by=call 时按调用次数
+func (r *MetricsRoutes) significance(ctx httpx.IContext) error {
+	if r.metrics == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM metrics repo 未配置"})
+	}
+
 	var filter entity.MetricsFilter
 	q := ctx.GetRequest().URL.Query()
 	if v := q.Get("provider"); v != "" {
@@ -43,15 +134,12 @@ func (r *MetricsRoutes) aggregate(ctx httpx.IContext) error {
 	if v := q.Get("model"); v != "" {
 		filter.Model = v
 	}
-	if v := q.Get("status"); v != "" {
-		filter.Status = v
-	}
-	if v := q.Get("ab_variant"); v != "" {
-		filter.ABVariant = v
-	}
 	if v := q.Get("outcome"); v != "" {
 		filter.Outcome = v
 	}
+	if v := q.Get("request_id"); v != "" {
+		filter.RequestID = v
+	}
 	if v := q.Get("conversion_type"); v != "" {
 		filter.Outcome = v
 	}
@@ -60,12 +148,10 @@ func (r *MetricsRoutes) aggregate(ctx httpx.IContext) error {
 			filter.ABTestID = &id
 		}
 	}
-	if v := q.Get("user_id"); v != "" {
-		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
-			filter.UserID = &id
-		}
+	if filter.ABTestID == nil {
+		return ctx.JSON(400, map[string]string{"message": "ab_test_id 不能为空"})
 	}
-	// 时间窗口，可选 start/end
+	filter.CallBased = q.Get("count_by") == "call"
 	if v := q.Get("start"); v != "" {
 		if t, err := time.Parse(time.RFC3339, v); err == nil {
 			filter.StartAt = &t
@@ -77,47 +163,96 @@ func (r *MetricsRoutes) aggregate(ctx httpx.IContext) error {
 		}
 	}
 
-	group := q.Get("group_by")
-	if group == "variant" && filter.ABTestID != nil {
-		rows, err := r.metrics.AggregateByVariant(ctx.GetContext(), filter)
+	// 连续指标（时延/token/评价/评估分数）走 t 检验与 Mann-Whitney 检验
+	if metric := q.Get("metric"); metric != "" && metric != "conversion" {
+		report, err := r.metrics.SignificanceContinuous(ctx.GetContext(), filter, metric)
 		if err != nil {
+			if errorx.Is(err, errorx.InvalidInput) {
+				return ctx.JSON(400, map[string]string{"message": err.Error()})
+			}
 			return ctx.JSON(500, map[string]string{"message": err.Error()})
 		}
-		return ctx.JSON(200, map[string]any{"variants": rows})
+		return ctx.JSON(200, map[string]any{
+			"report": report,
+		})
 	}
 
-	report, err := r.metrics.Aggregate(ctx.GetContext(), filter)
+	report, err := r.metrics.Significance(ctx.GetContext(), filter)
 	if err != nil {
 		return ctx.JSON(500, map[string]string{"message": err.Error()})
 	}
-	return ctx.JSON(200, map[string]any{"report": report})
+	return ctx.JSON(200, map[string]any{
+		"report": report,
+	})
 }
 
-func (r *MetricsRoutes) list(ctx httpx.IContext) error {
+// feedback 消息反馈统计：?group_by=model|prompt_template&provider=&model=&ab_test_id=&ab_variant=&start=&end=
+func (r *MetricsRoutes) feedback(ctx httpx.IContext) error {
 	if r.metrics == nil {
 		return ctx.JSON(500, map[string]string{"message": "LLM metrics repo 未配置"})
 	}
 
 	var filter entity.MetricsFilter
 	q := ctx.GetRequest().URL.Query()
-	if v := q.Get("provider"); v != "" {
-		filter.Provider = v
+	filter.Provider = q.Get("provider")
+	filter.Model = q.Get("model")
+	filter.ABVariant = q.Get("ab_variant")
+	if v := q.Get("ab_test_id"); v != "" {
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			filter.ABTestID = &id
+		}
 	}
-	if v := q.Get("model"); v != "" {
-		filter.Model = v
+	if v := q.Get("start"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			filter.StartAt = &t
+		}
 	}
-	if v := q.Get("status"); v != "" {
-		filter.Status = v
+	if v := q.Get("end"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			filter.EndAt = &t
+		}
 	}
-	if v := q.Get("ab_variant"); v != "" {
-		filter.ABVariant = v
+
+	rows, err := r.metrics.AggregateFeedback(ctx.GetContext(), filter, q.Get("group_by"))
+	if err != nil {
+		if errorx.Is(err, errorx.InvalidInput) {
+			return ctx.JSON(400, map[string]string{"message": err.Error()})
+		}
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
 	}
-	if v := q.Get("outcome"); v != "" {
-		filter.Outcome = v
+	return ctx.JSON(200, map[string]any{"feedback": rows})
+}
+
+// funnel 曝光 → 回复 → 反馈 → 转化漏斗：?group_by=prompt_template|variant&count_by=user|call，其余筛选参数同 /agg
+func (r *MetricsRoutes) funnel(ctx httpx.IContext) error {
+	if r.metrics == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM metrics repo 未配置"})
 	}
-	if v := q.Get("conversion_type"); v != "" {
-		filter.Outcome = v
+	q := ctx.GetRequest().URL.Query()
+	filter := parseMetricsFilter(q)
+	filter.CallBased = q.Get("count_by") == "call"
+	rows, err := r.metrics.AggregateFunnel(ctx.GetContext(), filter, q.Get("group_by"))
+	if err != nil {
+		if errorx.Is(err, errorx.InvalidInput) {
+			return ctx.JSON(400, map[string]string{"message": err.Error()})
+		}
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
 	}
+	return ctx.JSON(200, map[string]any{"funnel": rows})
+}
+
+// timeSeries 按时间分桶的指标趋势：?interval=hour|day&provider=&model=&endpoint=&user_id=&ab_test_id=&ab_variant=&start=&end=
+func (r *MetricsRoutes) timeSeries(ctx httpx.IContext) error {
+	if r.metrics == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM metrics repo 未配置"})
+	}
+
+	var filter entity.MetricsFilter
+	q := ctx.GetRequest().URL.Query()
+	filter.Provider = q.Get("provider")
+	filter.Model = q.Get("model")
+	filter.Endpoint = q.Get("endpoint")
+	filter.ABVariant = q.Get("ab_variant")
 	if v := q.Get("ab_test_id"); v != "" {
 		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
 			filter.ABTestID = &id
@@ -129,55 +264,108 @@ func (r *MetricsRoutes) list(ctx httpx.IContext) error {
 		}
 	}
 	if v := q.Get("start"); v != "" {
-		if t, err := time.Parse(time.RFC3339, v); err == nil {
-			filter.StartAt = &t
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return ctx.JSON(400, map[string]string{"message": "start 须为 RFC3339 时间"})
 		}
+		filter.StartAt = &t
 	}
 	if v := q.Get("end"); v != "" {
-		if t, err := time.Parse(time.RFC3339, v); err == nil {
-			filter.EndAt = &t
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return ctx.JSON(400, map[string]string{"message": "end 须为 RFC3339 时间"})
 		}
+		filter.EndAt = &t
 	}
 
-	limit := 50
-	if v := q.Get("limit"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 500 {
-			limit = n
+	interval := q.Get("interval")
+	if interval == "" {
+		interval = entity.MetricsIntervalHour
+	}
+	buckets, err := r.metrics.AggregateTimeSeries(ctx.GetContext(), filter, interval)
+	if err != nil {
+		if errorx.Is(err, errorx.InvalidInput) {
+			return ctx.JSON(400, map[string]string{"message": err.Error()})
 		}
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
 	}
-	offset := 0
-	if v := q.Get("offset"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
-			offset = n
+	return ctx.JSON(200, map[string]any{"interval": interval, "buckets": buckets})
+}
+
+// cost 成本归集报表：?group_by=user|org|prompt_template|model|endpoint&top=10&provider=&model=&endpoint=&user_id=&org_id=&prompt_template_id=&start=&end=
+func (r *MetricsRoutes) cost(ctx httpx.IContext) error {
+	if r.costs == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM 成本报表未配置"})
+	}
+
+	q := ctx.GetRequest().URL.Query()
+	filter := service.CostFilter{
+		Provider: q.Get("provider"),
+		Model:    q.Get("model"),
+		Endpoint: q.Get("endpoint"),
+		GroupBy:  q.Get("group_by"),
+	}
+	for key, dst := range map[string]**int64{
+		"user_id":            &filter.UserID,
+		"org_id":             &filter.OrgID,
+		"prompt_template_id": &filter.PromptTemplateID,
+	} {
+		if v := q.Get(key); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return ctx.JSON(400, map[string]string{"message": key + " 无效"})
+			}
+			*dst = &id
+		}
+	}
+	if v := q.Get("top"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			filter.Top = n
 		}
 	}
+	if v := q.Get("start"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return ctx.JSON(400, map[string]string{"message": "start 须为 RFC3339 时间"})
+		}
+		filter.StartAt = &t
+	}
+	if v := q.Get("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return ctx.JSON(400, map[string]string{"message": "end 须为 RFC3339 时间"})
+		}
+		filter.EndAt = &t
+	}
 
-	list, total, err := r.metrics.List(ctx.GetContext(), filter, limit, offset)
+	report, err := r.costs.CostReport(ctx.GetContext(), filter)
 	if err != nil {
+		if errorx.Is(err, errorx.InvalidInput) {
+			return ctx.JSON(400, map[string]string{"message": err.Error()})
+		}
 		return ctx.JSON(500, map[string]string{"message": err.Error()})
 	}
-
-	return ctx.JSON(200, map[string]any{
-		"total":  total,
-		"list":   list,
-		"limit":  limit,
-		"offset": offset,
-	})
+	return ctx.JSON(200, map[string]any{"report": report})
 }
 
-func (r *MetricsRoutes) significance(ctx httpx.IContext) error {
-	if r.metrics == nil {
-		return ctx.JSON(500, map[string]string{"message": "LLM metrics repo 未配置"})
-	}
-
+// parseMetricsFilter 解析 /agg、/list 与导出接口共用的筛选参数，无法解析的值被忽略
+func parseMetricsFilter(q url.Values) entity.MetricsFilter {
 	var filter entity.MetricsFilter
-	q := ctx.GetRequest().URL.Query()
 	if v := q.Get("provider"); v != "" {
 		filter.Provider = v
 	}
 	if v := q.Get("model"); v != "" {
 		filter.Model = v
 	}
+	if v := q.Get("endpoint"); v != "" {
+		filter.Endpoint = v
+	}
+	if v := q.Get("status"); v != "" {
+		filter.Status = v
+	}
+	if v := q.Get("ab_variant"); v != "" {
+		filter.ABVariant = v
+	}
 	if v := q.Get("outcome"); v != "" {
 		filter.Outcome = v
 	}
@@ -189,8 +377,20 @@ func (r *MetricsRoutes) significance(ctx httpx.IContext) error {
 			filter.ABTestID = &id
 		}
 	}
-	if filter.ABTestID == nil {
-		return ctx.JSON(400, map[string]string{"message": "ab_test_id 不能为空"})
+	if v := q.Get("user_id"); v != "" {
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			filter.UserID = &id
+		}
+	}
+	if v := q.Get("org_id"); v != "" {
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			filter.OrgID = &id
+		}
+	}
+	if v := q.Get("prompt_template_id"); v != "" {
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			filter.PromptTemplateID = &id
+		}
 	}
 	if v := q.Get("start"); v != "" {
 		if t, err := time.Parse(time.RFC3339, v); err == nil {
@@ -202,12 +402,20 @@ func (r *MetricsRoutes) significance(ctx httpx.IContext) error {
 			filter.EndAt = &t
 		}
 	}
+	return filter
+}
 
-	report, err := r.metrics.Significance(ctx.GetContext(), filter)
+// listAnomalies 返回各 provider/model 当前偏离基线的指标，不发出告警
+func (r *MetricsRoutes) listAnomalies(ctx httpx.IContext) error {
+	if r.anomalies == nil {
+		return ctx.JSON(500, map[string]string{"message": "指标异常检测未配置"})
+	}
+	list, err := r.anomalies.Detect(ctx.GetContext())
 	if err != nil {
 		return ctx.JSON(500, map[string]string{"message": err.Error()})
 	}
-	return ctx.JSON(200, map[string]any{
-		"report": report,
-	})
+	if list == nil {
+		list = []*service.MetricsAnomaly{}
+	}
+	return ctx.JSON(200, map[string]any{"anomalies": list})
 }
@@ -0,0 +1,225 @@
+package router
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+	"gochen/httpx"
+)
+
+// metricsExportBatchSize 导出原始指标时每批读取的行数
+const metricsExportBatchSize = 500
+
+// utf8BOM format=excel 时写在 CSV 开头，Excel 据此按 UTF-8 识别中文
+const utf8BOM = "\ufeff"
+
+var metricsExportColumns = []string{
+	"id", "created_at", "provider", "model", "endpoint", "user_id", "org_id", "conversation_id", "ab_test_id", "ab_variant",
+	"prompt_template_id", "request_tokens", "response_tokens", "total_tokens", "latency_ms", "cost_usd",
+	"status", "error_type", "outcome", "score", "is_test", "age_score", "toxicity_score",
+	"cache_hit", "degraded", "retried_attempts",
+}
+
+var metricsReportColumns = []string{
+	"total_calls", "success_calls", "error_calls", "success_rate", "conversion_calls", "conversion_rate",
+	"total_request_tokens", "total_response_tokens", "total_tokens", "avg_latency_ms", "total_cost_usd",
+	"cache_hit_calls", "degraded_calls", "retried_calls", "retried_attempts",
+}
+
+// exportMetrics 以 CSV 流式导出原始指标：?format=csv|excel，过滤参数同 /list；
+// 按 ID 倒序分批读取并逐批刷新，不受列表接口 500 行的分页上限限制
+func (r *MetricsRoutes) exportMetrics(ctx httpx.IContext) error {
+	if r.metrics == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM metrics repo 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	format, err := metricsExportFormat(q.Get("format"))
+	if err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	cw := startMetricsCSV(ctx, format, "llm_metrics", metricsExportColumns)
+	flusher, _ := ctx.GetResponse().(http.Flusher)
+
+	err = r.metrics.Iterate(ctx.GetContext(), parseMetricsFilter(q), metricsExportBatchSize, func(batch []*entity.Metrics) error {
+		for _, m := range batch {
+			if err := cw.Write(metricsCSVRow(m)); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	// 响应头已发送，无法再改写状态码；追加一行错误记录，便于下游识别导出不完整
+	if err != nil {
+		_ = cw.Write([]string{"error", err.Error()})
+		cw.Flush()
+	}
+	return nil
+}
+
+// exportAggregate 以 CSV 导出汇总指标：?group_by=provider|model|template|user|day|endpoint|variant&format=csv|excel，过滤参数同 /agg；
+// 不分组时只有一行，group_by=variant 需指定 ab_test_id
+func (r *MetricsRoutes) exportAggregate(ctx httpx.IContext) error {
+	if r.metrics == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM metrics repo 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	filter := parseMetricsFilter(q)
+	format, err := metricsExportFormat(q.Get("format"))
+	if err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+
+	// 汇总结果行数有限，先查询再写出，失败时仍可返回错误状态码
+	var keys []string
+	var rows [][]string
+	switch group := q.Get("group_by"); group {
+	case "":
+		report, err := r.metrics.Aggregate(ctx.GetContext(), filter)
+		if err != nil {
+			return ctx.JSON(500, map[string]string{"message": err.Error()})
+		}
+		rows = append(rows, metricsReportCSVRow(nil, report))
+	case "model":
+		keys = []string{"provider", "model"}
+		list, err := r.metrics.AggregateByModel(ctx.GetContext(), filter)
+		if err != nil {
+			return ctx.JSON(500, map[string]string{"message": err.Error()})
+		}
+		for _, m := range list {
+			rows = append(rows, metricsReportCSVRow([]string{m.Provider, m.Model}, &m.Metrics))
+		}
+	case "endpoint":
+		keys = []string{"endpoint", "provider", "model"}
+		list, err := r.metrics.AggregateByEndpoint(ctx.GetContext(), filter)
+		if err != nil {
+			return ctx.JSON(500, map[string]string{"message": err.Error()})
+		}
+		for _, m := range list {
+			rows = append(rows, metricsReportCSVRow([]string{m.Endpoint, m.Provider, m.Model}, &m.Metrics))
+		}
+	case "variant":
+		if filter.ABTestID == nil {
+			return ctx.JSON(400, map[string]string{"message": "ab_test_id 不能为空"})
+		}
+		keys = []string{"variant"}
+		list, err := r.metrics.AggregateByVariant(ctx.GetContext(), filter)
+		if err != nil {
+			return ctx.JSON(500, map[string]string{"message": err.Error()})
+		}
+		for _, v := range list {
+			rows = append(rows, metricsReportCSVRow([]string{v.Variant}, &v.Metrics))
+		}
+	default:
+		keys = []string{group}
+		list, err := r.metrics.AggregateBy(ctx.GetContext(), filter, group)
+		if err != nil {
+			if errorx.Is(err, errorx.InvalidInput) {
+				return ctx.JSON(400, map[string]string{"message": err.Error()})
+			}
+			return ctx.JSON(500, map[string]string{"message": err.Error()})
+		}
+		for _, g := range list {
+			rows = append(rows, metricsReportCSVRow([]string{g.Key}, &g.Metrics))
+		}
+	}
+
+	cw := startMetricsCSV(ctx, format, "llm_metrics_agg", append(keys, metricsReportColumns...))
+	_ = cw.WriteAll(rows)
+	return nil
+}
+
+func metricsExportFormat(format string) (string, error) {
+	switch format {
+	case "", "csv":
+		return "csv", nil
+	case "excel":
+		return format, nil
+	}
+	return "", fmt.Errorf("format 仅支持 csv/excel")
+}
+
+// startMetricsCSV 写出响应头与表头，返回写入响应体的 CSV writer
+func startMetricsCSV(ctx httpx.IContext, format, name string, header []string) *csv.Writer {
+	w := ctx.GetResponse()
+	filename := fmt.Sprintf("%s_%s.csv", name, time.Now().Format("20060102150405"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.WriteHeader(http.StatusOK)
+	if format == "excel" {
+		_, _ = io.WriteString(w, utf8BOM)
+	}
+	cw := csv.NewWriter(w)
+	_ = cw.Write(header)
+	return cw
+}
+
+func metricsCSVRow(m *entity.Metrics) []string {
+	return []string{
+		strconv.FormatInt(m.ID, 10),
+		m.CreatedAt.Format(time.RFC3339),
+		m.Provider,
+		m.Model,
+		m.Endpoint,
+		strconv.FormatInt(m.UserID, 10),
+		strconv.FormatInt(m.OrgID, 10),
+		strconv.FormatInt(m.ConversationID, 10),
+		strconv.FormatInt(m.ABTestID, 10),
+		m.ABVariant,
+		strconv.FormatInt(m.PromptTemplate, 10),
+		strconv.Itoa(m.RequestTokens),
+		strconv.Itoa(m.ResponseTokens),
+		strconv.Itoa(m.TotalTokens),
+		strconv.Itoa(m.LatencyMs),
+		strconv.FormatFloat(m.CostUSD, 'f', 6, 64),
+		m.Status,
+		m.ErrorType,
+		m.Outcome,
+		strconv.FormatFloat(m.Score, 'f', 3, 64),
+		strconv.FormatBool(m.IsTest),
+		optionalScore(m.AgeScore),
+		optionalScore(m.ToxicityScore),
+		strconv.FormatBool(m.CacheHit),
+		strconv.FormatBool(m.Degraded),
+		strconv.Itoa(m.RetriedAttempts),
+	}
+}
+
+func metricsReportCSVRow(keys []string, report *entity.MetricsReport) []string {
+	return append(keys,
+		strconv.Itoa(report.TotalCalls),
+		strconv.Itoa(report.SuccessCalls),
+		strconv.Itoa(report.ErrorCalls),
+		strconv.FormatFloat(report.SuccessRate, 'f', 4, 64),
+		strconv.Itoa(report.ConversionCalls),
+		strconv.FormatFloat(report.ConversionRate, 'f', 4, 64),
+		strconv.Itoa(report.TotalRequestTokens),
+		strconv.Itoa(report.TotalResponseTokens),
+		strconv.Itoa(report.TotalTokens),
+		strconv.FormatFloat(report.AvgLatencyMs, 'f', 1, 64),
+		strconv.FormatFloat(report.TotalCostUSD, 'f', 6, 64),
+		strconv.Itoa(report.CacheHitCalls),
+		strconv.Itoa(report.DegradedCalls),
+		strconv.Itoa(report.RetriedCalls),
+		strconv.Itoa(report.RetriedAttempts),
+	)
+}
+
+func optionalScore(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', 3, 64)
+}
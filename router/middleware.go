@@ -1,6 +1,15 @@
 package router
 
 import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"gochen-llm/entity"
+	"gochen-llm/service"
 	"gochen/errorx"
 	"gochen/httpx"
 )
@@ -8,10 +17,170 @@ import (
 // AdminOnlyMiddleware 默认仅检查用户已认证，角色校验由上层应用按需追加
 func AdminOnlyMiddleware() httpx.Middleware {
 	return func(ctx httpx.IContext, next func() error) error {
-		reqCtx := ctx.GetContext()
-		if reqCtx == nil || reqCtx.GetUserID() == 0 {
-			return errorx.New(errorx.Unauthorized, "用户未认证")
+		return requireAuthenticated(ctx, next)
+	}
+}
+
+// AuthenticatedMiddleware 仅要求用户已认证，用于面向普通用户的接口
+func AuthenticatedMiddleware() httpx.Middleware {
+	return func(ctx httpx.IContext, next func() error) error {
+		return requireAuthenticated(ctx, next)
+	}
+}
+
+func requireAuthenticated(ctx httpx.IContext, next func() error) error {
+	reqCtx := ctx.GetContext()
+	if reqCtx == nil || reqCtx.GetUserID() == 0 {
+		return errorx.New(errorx.Unauthorized, "用户未认证")
+	}
+	return next()
+}
+
+// RequestTrustConfig HTTP 层的信任配置，由宿主应用在启动时通过 SetRequestTrustConfig 设置；
+// 未设置时不信任任何代理头，WebSocket 只接受同源请求
+type RequestTrustConfig struct {
+	// TrustedProxies 可信反向代理的 IP 或 CIDR；仅当连接来自其中时才采信 X-Forwarded-For、X-Real-IP 与 X-Request-ID
+	TrustedProxies []string
+	// WebSocketOrigins 允许跨源发起 WebSocket 连接的 Origin，如 "https://app.example.com"
+	WebSocketOrigins []string
+}
+
+var (
+	trustMu          sync.RWMutex
+	trustedProxyNets []*net.IPNet
+	wsAllowedOrigins map[string]bool
+)
+
+// SetRequestTrustConfig 替换 HTTP 层的信任配置，地址格式无效时报错且不修改现有配置
+func SetRequestTrustConfig(cfg RequestTrustConfig) error {
+	nets := make([]*net.IPNet, 0, len(cfg.TrustedProxies))
+	for _, v := range cfg.TrustedProxies {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return errorx.New(errorx.Validation, "可信代理地址无效: "+v)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(v)
+		if err != nil {
+			return errorx.Wrap(err, errorx.Validation, "可信代理网段无效: "+v)
+		}
+		nets = append(nets, ipNet)
+	}
+	origins := make(map[string]bool, len(cfg.WebSocketOrigins))
+	for _, o := range cfg.WebSocketOrigins {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			origins[strings.ToLower(o)] = true
+		}
+	}
+
+	trustMu.Lock()
+	defer trustMu.Unlock()
+	trustedProxyNets = nets
+	wsAllowedOrigins = origins
+	return nil
+}
+
+// fromTrustedProxy 判断请求连接是否来自可信代理
+func fromTrustedProxy(req *http.Request) bool {
+	ip := net.ParseIP(remoteHost(req))
+	if ip == nil {
+		return false
+	}
+	trustMu.RLock()
+	defer trustMu.RUnlock()
+	for _, n := range trustedProxyNets {
+		if n.Contains(ip) {
+			return true
 		}
-		return next()
 	}
+	return false
+}
+
+// PromptScopeResolver 返回认证用户所属的上级作用域（项目、组织），由宿主应用按真实归属实现，不应取自请求参数
+type PromptScopeResolver func(ctx httpx.IContext) []entity.PromptScopeRef
+
+var (
+	scopeMu       sync.RWMutex
+	scopeResolver PromptScopeResolver
+)
+
+// SetPromptScopeResolver 设置上级作用域解析；设置后各接口的服务层 ctx 携带 service.WithPromptScopeChain，
+// 模板按 user → project → org → global 回退，安全策略同时按其中的组织/项目解析。nil 表示不解析
+func SetPromptScopeResolver(resolver PromptScopeResolver) {
+	scopeMu.Lock()
+	defer scopeMu.Unlock()
+	scopeResolver = resolver
+}
+
+// auditContext 返回携带调用来源（客户端 IP、User-Agent、路由）的服务层 ctx，
+// 服务层写入审计日志时据此自动补全；需要记录资源时再叠加 service.WithAuditResource。
+// 请求经可信代理转发且带 X-Request-ID 头时沿用为调用的请求 ID，便于与上游链路追踪关联；
+// 已认证且设置了 SetPromptScopeResolver 时附带用户的上级作用域
+func auditContext(ctx httpx.IContext) context.Context {
+	req := ctx.GetRequest()
+	reqCtx := context.Context(ctx.GetContext())
+	if fromTrustedProxy(req) {
+		reqCtx = service.WithRequestID(reqCtx, strings.TrimSpace(req.Header.Get("X-Request-ID")))
+	}
+	scopeMu.RLock()
+	resolver := scopeResolver
+	scopeMu.RUnlock()
+	if resolver != nil && ctx.GetContext().GetUserID() > 0 {
+		reqCtx = service.WithPromptScopeChain(reqCtx, resolver(ctx)...)
+	}
+	return service.WithAuditCallsite(reqCtx, service.AuditCallsite{
+		UserID:    ctx.GetContext().GetUserID(),
+		IPAddress: clientIP(req),
+		UserAgent: req.UserAgent(),
+		Route:     req.Method + " " + req.URL.Path,
+	})
+}
+
+// clientIP 连接来自可信代理时取代理头中的首个地址（X-Forwarded-For / X-Real-IP），否则取连接地址
+func clientIP(req *http.Request) string {
+	if fromTrustedProxy(req) {
+		if v := req.Header.Get("X-Forwarded-For"); v != "" {
+			if ip := strings.TrimSpace(strings.Split(v, ",")[0]); ip != "" {
+				return ip
+			}
+		}
+		if v := strings.TrimSpace(req.Header.Get("X-Real-IP")); v != "" {
+			return v
+		}
+	}
+	return remoteHost(req)
+}
+
+// allowedWebSocketOrigin 同源（Origin 的主机与请求 Host 一致）或在 WebSocketOrigins 中时允许；
+// 非浏览器客户端不带 Origin，放行
+func allowedWebSocketOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, req.Host) {
+		return true
+	}
+	trustMu.RLock()
+	defer trustMu.RUnlock()
+	return wsAllowedOrigins[strings.ToLower(strings.TrimRight(origin, "/"))]
+}
+
+func remoteHost(req *http.Request) string {
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+	return req.RemoteAddr
 }
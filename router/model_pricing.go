@@ -0,0 +1,80 @@
+package router
+
+import (
+	"fmt"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/httpx"
+)
+
+// listModelPricing 列出价格表：?provider=
+func (r *LLMAdminRoutes) listModelPricing(ctx httpx.IContext) error {
+	if r.pricing == nil {
+		return ctx.JSON(500, map[string]string{"message": "模型价格服务未配置"})
+	}
+	list, err := r.pricing.ListPricing(ctx.GetContext(), ctx.GetRequest().URL.Query().Get("provider"))
+	if err != nil {
+		return r.respondError(ctx, 500, err)
+	}
+	return ctx.JSON(200, map[string]any{"pricing": list})
+}
+
+// saveModelPricing 新增（ID 为 0）或修改价格记录；调价建议新增一条 EffectiveFrom 更晚的记录，以保留历史单价
+func (r *LLMAdminRoutes) saveModelPricing(ctx httpx.IContext) error {
+	if r.pricing == nil {
+		return ctx.JSON(500, map[string]string{"message": "模型价格服务未配置"})
+	}
+	var body entity.ModelPricing
+	if err := ctx.BindJSON(&body); err != nil {
+		return r.respondError(ctx, 400, err)
+	}
+	if err := r.pricing.SavePricing(auditContext(ctx), &body); err != nil {
+		return r.respondError(ctx, adminErrorStatus(err), err)
+	}
+	return ctx.JSON(200, map[string]any{"pricing": body})
+}
+
+func (r *LLMAdminRoutes) deleteModelPricing(ctx httpx.IContext) error {
+	if r.pricing == nil {
+		return ctx.JSON(500, map[string]string{"message": "模型价格服务未配置"})
+	}
+	var body struct {
+		ID int64 `json:"id"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return r.respondError(ctx, 400, err)
+	}
+	if body.ID <= 0 {
+		return r.respondError(ctx, 400, fmt.Errorf("id 无效"))
+	}
+	if err := r.pricing.DeletePricing(auditContext(ctx), body.ID); err != nil {
+		return r.respondError(ctx, adminErrorStatus(err), err)
+	}
+	return ctx.JSON(200, map[string]string{"message": "ok"})
+}
+
+// resolveModelPricing 查询某时刻生效的单价：?provider=&model=&at=（RFC3339，默认当前时间）
+func (r *LLMAdminRoutes) resolveModelPricing(ctx httpx.IContext) error {
+	if r.pricing == nil {
+		return ctx.JSON(500, map[string]string{"message": "模型价格服务未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	provider, model := q.Get("provider"), q.Get("model")
+	if provider == "" || model == "" {
+		return r.respondError(ctx, 400, fmt.Errorf("provider 与 model 不能为空"))
+	}
+	at := time.Now()
+	if v := q.Get("at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return r.respondError(ctx, 400, fmt.Errorf("at 格式无效"))
+		}
+		at = t
+	}
+	p, err := r.pricing.ResolvePricing(ctx.GetContext(), provider, model, at)
+	if err != nil {
+		return r.respondError(ctx, 500, err)
+	}
+	return ctx.JSON(200, map[string]any{"pricing": p})
+}
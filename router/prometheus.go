@@ -0,0 +1,70 @@
+package router
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/httpx"
+)
+
+// prometheusContentType Prometheus 文本暴露格式
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// PrometheusRoutes 以 Prometheus 文本格式暴露指标计数，数据来自 MetricsRepo 的进程内计数器，不查询数据库；
+// 计数随进程重启归零，多实例部署时由 Prometheus 按实例抓取后汇总
+type PrometheusRoutes struct {
+	metrics repo.MetricsRepo
+}
+
+func NewPrometheusRoutes(metrics repo.MetricsRepo) *PrometheusRoutes {
+	return &PrometheusRoutes{metrics: metrics}
+}
+
+func (r *PrometheusRoutes) GetName() string { return "llm_prometheus" }
+
+func (r *PrometheusRoutes) GetPriority() int { return 318 }
+
+func (r *PrometheusRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
+	api := group.Group("/admin/llm")
+	api.GET("/prometheus", r.scrape)
+	return nil
+}
+
+func (r *PrometheusRoutes) scrape(ctx httpx.IContext) error {
+	if r.metrics == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM metrics repo 未配置"})
+	}
+	counters := r.metrics.Counters()
+	w := ctx.GetResponse()
+	w.Header().Set("Content-Type", prometheusContentType)
+	w.WriteHeader(http.StatusOK)
+
+	writePrometheusCounter(w, "gochen_llm_requests_total", "LLM 调用记录数", counters, func(c *entity.MetricsCounter) string {
+		return strconv.FormatInt(c.Requests, 10)
+	})
+	writePrometheusCounter(w, "gochen_llm_tokens_total", "LLM token 用量", counters, func(c *entity.MetricsCounter) string {
+		return strconv.FormatInt(c.Tokens, 10)
+	})
+	writePrometheusCounter(w, "gochen_llm_cost_usd_total", "LLM 估算成本（USD）", counters, func(c *entity.MetricsCounter) string {
+		return strconv.FormatFloat(c.CostUSD, 'f', -1, 64)
+	})
+	return nil
+}
+
+func writePrometheusCounter(w io.Writer, name, help string, counters []*entity.MetricsCounter, value func(c *entity.MetricsCounter) string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	for _, c := range counters {
+		fmt.Fprintf(w, "%s{provider=\"%s\",model=\"%s\",status=\"%s\"} %s\n",
+			name, prometheusLabel(c.Provider), prometheusLabel(c.Model), prometheusLabel(c.Status), value(c))
+	}
+}
+
+// prometheusLabel 按文本格式转义标签值中的反斜杠、双引号与换行
+func prometheusLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,342 @@
+package router
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen-llm/service"
+	"gochen/errorx"
+	"gochen/httpx"
+)
+
+// PromptAdminRoutes 提供提示词模板的管理接口
+type PromptAdminRoutes struct {
+	prompts    service.PromptService
+	chat       service.ChatService
+	transcript service.PromptTranscriptConverter
+}
+
+func NewPromptAdminRoutes(prompts service.PromptService, chat service.ChatService, transcript service.PromptTranscriptConverter) *PromptAdminRoutes {
+	return &PromptAdminRoutes{prompts: prompts, chat: chat, transcript: transcript}
+}
+
+func (r *PromptAdminRoutes) GetName() string { return "llm_prompt_admin" }
+
+func (r *PromptAdminRoutes) GetPriority() int { return 306 }
+
+func (r *PromptAdminRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
+	admin := group.Group("/admin/llm/prompts")
+	admin.Use(AdminOnlyMiddleware())
+	admin.GET("", r.list)
+	admin.POST("/validate", r.validate)
+	admin.POST("/transition", r.transition)
+	admin.GET("/reviews", r.listReviews)
+	admin.POST("/playground", r.playground)
+	admin.GET("/export", r.export)
+	admin.POST("/import", r.importPrompts)
+	admin.POST("/bulk/enable", r.bulkEnable)
+	admin.POST("/bulk/tags", r.bulkTags)
+	admin.POST("/bulk/copy", r.bulkCopy)
+	admin.POST("/from-conversation", r.fromConversation)
+	return nil
+}
+
+// list 检索模板：name/category/scope/scope_id/status/enabled 精确过滤，
+// tags=a,b（需全部包含）、q=全文、meta=key:value（可重复），page/page_size 分页，sort/order 排序
+func (r *PromptAdminRoutes) list(ctx httpx.IContext) error {
+	if r.prompts == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt service 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	filter := repo.PromptFilter{
+		Name:     q.Get("name"),
+		Category: q.Get("category"),
+		Status:   q.Get("status"),
+		Query:    q.Get("q"),
+		SortBy:   q.Get("sort"),
+		SortDesc: q.Get("order") == "desc",
+	}
+	if scope := q.Get("scope"); scope != "" {
+		s := entity.PromptScope(scope)
+		filter.Scope = &s
+	}
+	if raw := q.Get("scope_id"); raw != "" {
+		scopeID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return ctx.JSON(400, map[string]string{"message": "scope_id 无效"})
+		}
+		filter.ScopeID = &scopeID
+	}
+	if q.Has("locale") {
+		locale := q.Get("locale")
+		filter.Locale = &locale
+	}
+	if raw := q.Get("enabled"); raw != "" {
+		enabled := raw == "true"
+		filter.Enabled = &enabled
+	}
+	if raw := q.Get("tags"); raw != "" {
+		filter.Tags = strings.Split(raw, ",")
+	}
+	for _, kv := range q["meta"] {
+		key, value, ok := strings.Cut(kv, ":")
+		if !ok || key == "" {
+			return ctx.JSON(400, map[string]string{"message": "meta 需为 key:value 格式"})
+		}
+		if filter.Metadata == nil {
+			filter.Metadata = map[string]string{}
+		}
+		filter.Metadata[key] = value
+	}
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page <= 0 {
+		page = 1
+	}
+	pageSize, _ := strconv.Atoi(q.Get("page_size"))
+	if pageSize <= 0 || pageSize > 200 {
+		pageSize = 50
+	}
+	filter.Limit = pageSize
+	filter.Offset = (page - 1) * pageSize
+
+	list, total, err := r.prompts.SearchPrompts(ctx.GetContext(), filter)
+	if err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]any{
+		"items":     list,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// validate 校验并试渲染提示词模板；仅传 template.id 时校验已保存的模板
+func (r *PromptAdminRoutes) validate(ctx httpx.IContext) error {
+	if r.prompts == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt service 未配置"})
+	}
+	var body struct {
+		Template   *entity.PromptTemplate `json:"template"`
+		SampleVars map[string]any         `json:"sample_vars"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if body.Template == nil {
+		return ctx.JSON(400, map[string]string{"message": "template 不能为空"})
+	}
+
+	tmpl := body.Template
+	if tmpl.ID > 0 && tmpl.Content == "" {
+		stored, err := r.prompts.GetPromptByID(ctx.GetContext(), tmpl.ID)
+		if err != nil {
+			return ctx.JSON(500, map[string]string{"message": err.Error()})
+		}
+		if stored == nil {
+			return ctx.JSON(404, map[string]string{"message": "提示词模板不存在"})
+		}
+		tmpl = stored
+	}
+
+	result, err := r.prompts.ValidatePrompt(ctx.GetContext(), tmpl, body.SampleVars)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, result)
+}
+
+// transition 变更模板版本的发布状态（提交审核/通过/驳回/归档）；未指定 version 时为最新版本
+func (r *PromptAdminRoutes) transition(ctx httpx.IContext) error {
+	if r.prompts == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt service 未配置"})
+	}
+	var body struct {
+		ID      int64  `json:"id"`
+		Version int    `json:"version"`
+		Status  string `json:"status"`
+		Comment string `json:"comment"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	actorID := ctx.GetContext().GetUserID()
+	tmpl, err := r.prompts.TransitionPrompt(auditContext(ctx), body.ID, body.Version, body.Status, actorID, body.Comment)
+	if err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]any{"template": tmpl})
+}
+
+func (r *PromptAdminRoutes) listReviews(ctx httpx.IContext) error {
+	if r.prompts == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt service 未配置"})
+	}
+	id, err := strconv.ParseInt(ctx.GetRequest().URL.Query().Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	reviews, err := r.prompts.ListPromptReviews(ctx.GetContext(), id)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]any{"reviews": reviews})
+}
+
+// playground 渲染指定模板版本，execute=true 时调用模型（记为测试流量）
+func (r *PromptAdminRoutes) playground(ctx httpx.IContext) error {
+	if r.chat == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM chat service 未配置"})
+	}
+	var body service.PlaygroundRequest
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	body.UserID = ctx.GetContext().GetUserID()
+
+	result, err := r.chat.RunPlayground(auditContext(ctx), &body)
+	if err != nil {
+		if handled, respErr := respondRateLimited(ctx, err); handled {
+			return respErr
+		}
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, result)
+}
+
+// export 导出提示词模板；format=yaml 时按目录布局返回 路径 -> YAML 文本，默认返回 JSON 数组
+func (r *PromptAdminRoutes) export(ctx httpx.IContext) error {
+	if r.prompts == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt service 未配置"})
+	}
+	query := ctx.GetRequest().URL.Query()
+	filter := repo.PromptFilter{
+		Name:     query.Get("name"),
+		Category: query.Get("category"),
+		Status:   query.Get("status"),
+	}
+	if scope := query.Get("scope"); scope != "" {
+		s := entity.PromptScope(scope)
+		filter.Scope = &s
+	}
+
+	if query.Get("format") != "yaml" {
+		data, err := r.prompts.ExportPrompts(ctx.GetContext(), filter)
+		if err != nil {
+			return ctx.JSON(500, map[string]string{"message": err.Error()})
+		}
+		return ctx.JSON(200, json.RawMessage(data))
+	}
+	files, err := r.prompts.ExportPromptsYAML(ctx.GetContext(), filter)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
+	}
+	out := make(map[string]string, len(files))
+	for p, data := range files {
+		out[p] = string(data)
+	}
+	return ctx.JSON(200, map[string]any{"files": out})
+}
+
+// importPrompts 导入 YAML 文件集合（路径 -> YAML 文本），返回逐项结果
+func (r *PromptAdminRoutes) importPrompts(ctx httpx.IContext) error {
+	if r.prompts == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt service 未配置"})
+	}
+	var body struct {
+		Files map[string]string `json:"files"`
+		service.PromptImportOptions
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if len(body.Files) == 0 {
+		return ctx.JSON(400, map[string]string{"message": "files 不能为空"})
+	}
+	files := make(map[string][]byte, len(body.Files))
+	for p, content := range body.Files {
+		files[p] = []byte(content)
+	}
+	report, err := r.prompts.ImportPromptsYAML(auditContext(ctx), files, body.PromptImportOptions)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, report)
+}
+
+// bulkEnable 批量启用/停用模板
+func (r *PromptAdminRoutes) bulkEnable(ctx httpx.IContext) error {
+	if r.prompts == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt service 未配置"})
+	}
+	var body struct {
+		IDs     []int64 `json:"ids"`
+		Enabled bool    `json:"enabled"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	result, err := r.prompts.BulkSetEnabled(auditContext(ctx), body.IDs, body.Enabled)
+	if err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, result)
+}
+
+// bulkTags 批量添加/移除标签
+func (r *PromptAdminRoutes) bulkTags(ctx httpx.IContext) error {
+	if r.prompts == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt service 未配置"})
+	}
+	var body struct {
+		IDs    []int64  `json:"ids"`
+		Add    []string `json:"add"`
+		Remove []string `json:"remove"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	result, err := r.prompts.BulkUpdateTags(auditContext(ctx), body.IDs, body.Add, body.Remove)
+	if err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, result)
+}
+
+// bulkCopy 将一组模板复制到目标作用域（新租户初始化）
+func (r *PromptAdminRoutes) bulkCopy(ctx httpx.IContext) error {
+	if r.prompts == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt service 未配置"})
+	}
+	var body service.PromptScopeCopyRequest
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	result, err := r.prompts.CopyPromptsToScope(auditContext(ctx), &body)
+	if err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, result)
+}
+
+// fromConversation 将会话片段转换为草稿模板（系统部分 + few-shot 示例）
+func (r *PromptAdminRoutes) fromConversation(ctx httpx.IContext) error {
+	if r.transcript == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt transcript converter 未配置"})
+	}
+	var body service.TranscriptPromptRequest
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	tmpl, err := r.transcript.ConvertTranscript(auditContext(ctx), &body)
+	if err != nil {
+		if errorx.Is(err, errorx.NotFound) {
+			return ctx.JSON(404, map[string]string{"message": err.Error()})
+		}
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]any{"template": tmpl})
+}
@@ -0,0 +1,177 @@
+package router
+
+import (
+	"io"
+	"strconv"
+
+	"gochen-llm/entity"
+	"gochen-llm/service"
+	"gochen/errorx"
+	"gochen/httpx"
+)
+
+// maxWebhookBody Webhook 请求体上限
+const maxWebhookBody = 1 << 20
+
+// PromptGitRoutes 提供提示词 Git 同步源管理、手动同步、漂移检测与 Webhook 接口
+type PromptGitRoutes struct {
+	sync service.PromptGitSync
+}
+
+func NewPromptGitRoutes(sync service.PromptGitSync) *PromptGitRoutes {
+	return &PromptGitRoutes{sync: sync}
+}
+
+func (r *PromptGitRoutes) GetName() string { return "llm_prompt_git" }
+
+func (r *PromptGitRoutes) GetPriority() int { return 307 }
+
+func (r *PromptGitRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
+	admin := group.Group("/admin/llm/prompts/git")
+	admin.Use(AdminOnlyMiddleware())
+	admin.GET("/sources", r.listSources)
+	admin.POST("/sources", r.saveSource)
+	admin.POST("/sync", r.syncSource)
+	admin.GET("/drift", r.drift)
+
+	// Webhook 由 Git 平台调用，不走登录态，依赖 HMAC 签名校验
+	hook := group.Group("/llm/prompts/git")
+	hook.POST("/webhook", r.webhook)
+	return nil
+}
+
+// maskGitSource 脱敏展示：不返回令牌与 Webhook 密钥原文
+func maskGitSource(src *entity.PromptGitSource) map[string]any {
+	view := map[string]any{
+		"id":               src.ID,
+		"name":             src.Name,
+		"repo_url":         src.RepoURL,
+		"branch":           src.Branch,
+		"path":             src.Path,
+		"username":         src.Username,
+		"has_token":        src.Token != "",
+		"has_webhook":      src.WebhookSecret != "",
+		"interval_seconds": src.IntervalSeconds,
+		"overwrite":        src.Overwrite,
+		"enabled":          src.Enabled,
+		"last_commit":      src.LastCommit,
+		"last_status":      src.LastStatus,
+		"last_error":       src.LastError,
+	}
+	if src.LastSyncAt != nil {
+		view["last_sync_at"] = src.LastSyncAt
+	}
+	return view
+}
+
+func (r *PromptGitRoutes) listSources(ctx httpx.IContext) error {
+	if r.sync == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt git sync 未配置"})
+	}
+	sources, err := r.sync.ListSources(ctx.GetContext())
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
+	}
+	views := make([]map[string]any, 0, len(sources))
+	for _, src := range sources {
+		views = append(views, maskGitSource(src))
+	}
+	return ctx.JSON(200, map[string]any{"sources": views})
+}
+
+func (r *PromptGitRoutes) saveSource(ctx httpx.IContext) error {
+	if r.sync == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt git sync 未配置"})
+	}
+	var body struct {
+		ID              int64  `json:"id"`
+		Name            string `json:"name"`
+		RepoURL         string `json:"repo_url"`
+		Branch          string `json:"branch"`
+		Path            string `json:"path"`
+		Username        string `json:"username"`
+		Token           string `json:"token"`
+		WebhookSecret   string `json:"webhook_secret"`
+		IntervalSeconds int    `json:"interval_seconds"`
+		Overwrite       bool   `json:"overwrite"`
+		Enabled         *bool  `json:"enabled"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	src := &entity.PromptGitSource{
+		ID:              body.ID,
+		Name:            body.Name,
+		RepoURL:         body.RepoURL,
+		Branch:          body.Branch,
+		Path:            body.Path,
+		Username:        body.Username,
+		Token:           body.Token,
+		WebhookSecret:   body.WebhookSecret,
+		IntervalSeconds: body.IntervalSeconds,
+		Overwrite:       body.Overwrite,
+		Enabled:         body.Enabled == nil || *body.Enabled,
+	}
+	if err := r.sync.SaveSource(ctx.GetContext(), src); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]any{"source": maskGitSource(src)})
+}
+
+func (r *PromptGitRoutes) syncSource(ctx httpx.IContext) error {
+	if r.sync == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt git sync 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	id, err := strconv.ParseInt(q.Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	result, err := r.sync.Sync(ctx.GetContext(), id, q.Get("force") == "true")
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, result)
+}
+
+func (r *PromptGitRoutes) drift(ctx httpx.IContext) error {
+	if r.sync == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt git sync 未配置"})
+	}
+	id, err := strconv.ParseInt(ctx.GetRequest().URL.Query().Get("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "id 无效"})
+	}
+	report, err := r.sync.Drift(ctx.GetContext(), id)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, report)
+}
+
+// webhook 接收 push 事件：?source_id=，签名放在 X-Hub-Signature-256（sha256=<hex>）
+func (r *PromptGitRoutes) webhook(ctx httpx.IContext) error {
+	if r.sync == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt git sync 未配置"})
+	}
+	req := ctx.GetRequest()
+	id, err := strconv.ParseInt(req.URL.Query().Get("source_id"), 10, 64)
+	if err != nil || id <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "source_id 无效"})
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxWebhookBody))
+	if err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if err := r.sync.HandleWebhook(ctx.GetContext(), id, body, req.Header.Get("X-Hub-Signature-256")); err != nil {
+		status := 400
+		switch {
+		case errorx.Is(err, errorx.Unauthorized):
+			status = 401
+		case errorx.Is(err, errorx.NotFound):
+			status = 404
+		}
+		return ctx.JSON(status, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(202, map[string]string{"message": "accepted"})
+}
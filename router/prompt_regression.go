@@ -0,0 +1,142 @@
+package router
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"gochen-llm/entity"
+	"gochen-llm/service"
+	"gochen/httpx"
+)
+
+// PromptRegressionRoutes 提供提示词回归测试用例管理、执行与历史查询接口
+type PromptRegressionRoutes struct {
+	regression service.PromptRegressionService
+}
+
+func NewPromptRegressionRoutes(regression service.PromptRegressionService) *PromptRegressionRoutes {
+	return &PromptRegressionRoutes{regression: regression}
+}
+
+func (r *PromptRegressionRoutes) GetName() string { return "llm_prompt_regression" }
+
+func (r *PromptRegressionRoutes) GetPriority() int { return 308 }
+
+func (r *PromptRegressionRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
+	admin := group.Group("/admin/llm/prompts/tests")
+	admin.Use(AdminOnlyMiddleware())
+	admin.GET("", r.listCases)
+	admin.POST("", r.saveCase)
+	admin.POST("/run", r.run)
+	admin.GET("/runs", r.listRuns)
+	return nil
+}
+
+func (r *PromptRegressionRoutes) listCases(ctx httpx.IContext) error {
+	if r.regression == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt regression service 未配置"})
+	}
+	templateID, _ := strconv.ParseInt(ctx.GetRequest().URL.Query().Get("template_id"), 10, 64)
+	cases, err := r.regression.ListCases(ctx.GetContext(), templateID)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]any{"cases": cases})
+}
+
+// saveCase 新增/更新用例；variables/messages/assertions 以 JSON 结构提交
+func (r *PromptRegressionRoutes) saveCase(ctx httpx.IContext) error {
+	if r.regression == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt regression service 未配置"})
+	}
+	var body struct {
+		ID            int64                        `json:"id"`
+		TemplateID    int64                        `json:"template_id"`
+		Name          string                       `json:"name"`
+		Variables     map[string]any               `json:"variables"`
+		Messages      []service.Message            `json:"messages"`
+		Assertions    []entity.PromptTestAssertion `json:"assertions"`
+		JudgeRubric   string                       `json:"judge_rubric"`
+		JudgeMinScore *float64                     `json:"judge_min_score"`
+		Endpoint      string                       `json:"endpoint"`
+		RunOnChange   *bool                        `json:"run_on_change"`
+		Enabled       *bool                        `json:"enabled"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	tc := &entity.PromptTestCase{
+		ID:            body.ID,
+		TemplateID:    body.TemplateID,
+		Name:          body.Name,
+		JudgeRubric:   body.JudgeRubric,
+		JudgeMinScore: 7,
+		Endpoint:      body.Endpoint,
+		RunOnChange:   body.RunOnChange == nil || *body.RunOnChange,
+		Enabled:       body.Enabled == nil || *body.Enabled,
+		CreatedBy:     ctx.GetContext().GetUserID(),
+	}
+	if body.JudgeMinScore != nil {
+		tc.JudgeMinScore = *body.JudgeMinScore
+	}
+	if len(body.Variables) > 0 {
+		data, _ := json.Marshal(body.Variables)
+		tc.VariablesJSON = string(data)
+	}
+	if len(body.Messages) > 0 {
+		data, _ := json.Marshal(body.Messages)
+		tc.MessagesJSON = string(data)
+	}
+	if len(body.Assertions) > 0 {
+		data, _ := json.Marshal(body.Assertions)
+		tc.AssertionsJSON = string(data)
+	}
+	if err := r.regression.SaveCase(ctx.GetContext(), tc); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]any{"case": tc})
+}
+
+// run 执行用例：?case_id= 执行单个用例，?template_id= 执行模板下全部用例；endpoint 可覆盖用例配置的端点
+func (r *PromptRegressionRoutes) run(ctx httpx.IContext) error {
+	if r.regression == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt regression service 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	caseID, _ := strconv.ParseInt(q.Get("case_id"), 10, 64)
+	templateID, _ := strconv.ParseInt(q.Get("template_id"), 10, 64)
+	endpoint := q.Get("endpoint")
+	actorID := ctx.GetContext().GetUserID()
+
+	switch {
+	case caseID > 0:
+		run, err := r.regression.RunCase(ctx.GetContext(), caseID, endpoint, entity.PromptTestTriggerManual, actorID)
+		if err != nil {
+			return ctx.JSON(400, map[string]string{"message": err.Error()})
+		}
+		return ctx.JSON(200, map[string]any{"run": run})
+	case templateID > 0:
+		result, err := r.regression.RunSuite(ctx.GetContext(), templateID, endpoint, entity.PromptTestTriggerManual, actorID)
+		if err != nil {
+			return ctx.JSON(400, map[string]string{"message": err.Error()})
+		}
+		return ctx.JSON(200, result)
+	default:
+		return ctx.JSON(400, map[string]string{"message": "需指定 case_id 或 template_id"})
+	}
+}
+
+func (r *PromptRegressionRoutes) listRuns(ctx httpx.IContext) error {
+	if r.regression == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM prompt regression service 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	caseID, _ := strconv.ParseInt(q.Get("case_id"), 10, 64)
+	templateID, _ := strconv.ParseInt(q.Get("template_id"), 10, 64)
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	runs, err := r.regression.ListRuns(ctx.GetContext(), caseID, templateID, limit)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]any{"runs": runs})
+}
@@ -0,0 +1,204 @@
+package router
+
+import (
+	"strconv"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen-llm/service"
+	"gochen/errorx"
+	"gochen/httpx"
+)
+
+// RateLimitRoutes 提供限流等级配置、用户等级分配与用户封禁的管理接口
+type RateLimitRoutes struct {
+	safety service.SafetyService
+	tiers  repo.RateLimitTierRepo
+}
+
+func NewRateLimitRoutes(safety service.SafetyService, tiers repo.RateLimitTierRepo) *RateLimitRoutes {
+	return &RateLimitRoutes{safety: safety, tiers: tiers}
+}
+
+func (r *RateLimitRoutes) GetName() string { return "llm_rate_limit" }
+
+func (r *RateLimitRoutes) GetPriority() int { return 309 }
+
+func (r *RateLimitRoutes) RegisterRoutes(group httpx.IRouteGroup) error {
+	admin := group.Group("/admin/llm/rate-limit")
+	admin.Use(AdminOnlyMiddleware())
+	admin.GET("/tiers", r.listTiers)
+	admin.PUT("/tiers", r.saveTier)
+	admin.GET("/users", r.listUserTiers)
+	admin.PUT("/users", r.setUserTier)
+	admin.GET("/users/resolve", r.resolveUserTier)
+	admin.GET("/bans", r.listBans)
+	admin.POST("/bans", r.banUser)
+	admin.POST("/bans/lift", r.liftBan)
+	return nil
+}
+
+func (r *RateLimitRoutes) listTiers(ctx httpx.IContext) error {
+	if r.safety == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM safety service 未配置"})
+	}
+	tiers, err := r.safety.ListRateLimitTiers(ctx.GetContext())
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]any{"tiers": tiers})
+}
+
+func (r *RateLimitRoutes) saveTier(ctx httpx.IContext) error {
+	if r.safety == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM safety service 未配置"})
+	}
+	var body entity.RateLimitTier
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if err := r.safety.SaveRateLimitTier(auditContext(ctx), &body); err != nil {
+		status := 500
+		if errorx.Is(err, errorx.Validation) {
+			status = 400
+		}
+		return ctx.JSON(status, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]any{"tier": body})
+}
+
+// listUserTiers 列出已分配等级的用户：?tier=&limit=&offset=
+func (r *RateLimitRoutes) listUserTiers(ctx httpx.IContext) error {
+	if r.tiers == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM rate limit tier repo 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	list, total, err := r.tiers.ListUserTiers(ctx.GetContext(), q.Get("tier"), limit, offset)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]any{"users": list, "total": total})
+}
+
+// setUserTier 为用户分配等级，tier 为空时恢复默认等级
+func (r *RateLimitRoutes) setUserTier(ctx httpx.IContext) error {
+	if r.safety == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM safety service 未配置"})
+	}
+	var body struct {
+		UserID int64  `json:"user_id"`
+		Tier   string `json:"tier"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if body.UserID <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "user_id 无效"})
+	}
+	if err := r.safety.SetUserRateLimitTier(auditContext(ctx), body.UserID, body.Tier, ctx.GetContext().GetUserID()); err != nil {
+		status := 500
+		if errorx.Is(err, errorx.Validation) || errorx.Is(err, errorx.InvalidInput) {
+			status = 400
+		}
+		return ctx.JSON(status, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]string{"message": "ok"})
+}
+
+// resolveUserTier 查看用户当前生效的等级：?user_id=
+func (r *RateLimitRoutes) resolveUserTier(ctx httpx.IContext) error {
+	if r.safety == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM safety service 未配置"})
+	}
+	userID, err := strconv.ParseInt(ctx.GetRequest().URL.Query().Get("user_id"), 10, 64)
+	if err != nil || userID <= 0 {
+		return ctx.JSON(400, map[string]string{"message": "user_id 无效"})
+	}
+	tier, err := r.safety.ResolveRateLimitTier(ctx.GetContext(), userID)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]any{"user_id": userID, "tier": tier})
+}
+
+// listBans 列出当前生效的用户封禁：?limit=&offset=
+func (r *RateLimitRoutes) listBans(ctx httpx.IContext) error {
+	if r.safety == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM safety service 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	list, total, err := r.safety.ListUserBans(ctx.GetContext(), limit, offset)
+	if err != nil {
+		return ctx.JSON(500, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]any{"bans": list, "total": total})
+}
+
+// banUser 手动封禁用户
+func (r *RateLimitRoutes) banUser(ctx httpx.IContext) error {
+	if r.safety == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM safety service 未配置"})
+	}
+	var body struct {
+		UserID  int64  `json:"user_id"`
+		Seconds int    `json:"seconds"`
+		Reason  string `json:"reason"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	ban, err := r.safety.BanUser(auditContext(ctx), body.UserID, body.Seconds, body.Reason, ctx.GetContext().GetUserID())
+	if err != nil {
+		status := 500
+		if errorx.Is(err, errorx.Validation) || errorx.Is(err, errorx.InvalidInput) {
+			status = 400
+		}
+		return ctx.JSON(status, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]any{"ban": ban})
+}
+
+// liftBan 提前解除用户封禁
+func (r *RateLimitRoutes) liftBan(ctx httpx.IContext) error {
+	if r.safety == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM safety service 未配置"})
+	}
+	var body struct {
+		UserID int64 `json:"user_id"`
+	}
+	if err := ctx.BindJSON(&body); err != nil {
+		return ctx.JSON(400, map[string]string{"message": err.Error()})
+	}
+	if err := r.safety.LiftUserBan(auditContext(ctx), body.UserID, ctx.GetContext().GetUserID()); err != nil {
+		status := 500
+		switch {
+		case errorx.Is(err, errorx.InvalidInput):
+			status = 400
+		case errorx.Is(err, errorx.NotFound):
+			status = 404
+		}
+		return ctx.JSON(status, map[string]string{"message": err.Error()})
+	}
+	return ctx.JSON(200, map[string]string{"message": "ok"})
+}
+
+// respondRateLimited err 为限流错误时返回 429：设置 Retry-After 头并输出结构化的限流信息；
+// 非限流错误返回 handled=false，由调用方按原逻辑处理
+func respondRateLimited(ctx httpx.IContext, err error) (handled bool, respErr error) {
+	rl, ok := service.AsRateLimited(err)
+	if !ok {
+		return false, nil
+	}
+	if rl.RetryAfter > 0 {
+		ctx.GetResponse().Header().Set("Retry-After", strconv.Itoa(rl.RetryAfter))
+	}
+	return true, ctx.JSON(429, map[string]any{
+		"message":    err.Error(),
+		"code":       "rate_limited",
+		"rate_limit": rl,
+	})
+}
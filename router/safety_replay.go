@@ -0,0 +1,37 @@
+package router
+
+import (
+	"fmt"
+
+	"gochen-llm/entity"
+	"gochen-llm/service"
+	"gochen/httpx"
+)
+
+// replaySafetyPolicy 用候选策略回放历史聊天审计日志，报告新增拒绝/放行的请求；
+// 审计日志筛选参数同 /llm/audit（?user_id=&start=&end=...），候选策略与回放选项在请求体中
+func (r *LLMAdminRoutes) replaySafetyPolicy(ctx httpx.IContext) error {
+	if r.safetySvc == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM safety service 未配置"})
+	}
+	var body service.SafetyReplayRequest
+	if err := ctx.BindJSON(&body); err != nil {
+		return r.respondError(ctx, 400, err)
+	}
+	if body.Candidate == nil {
+		return r.respondError(ctx, 400, fmt.Errorf("candidate 不能为空"))
+	}
+	if body.Candidate.Scope == "" {
+		body.Candidate.Scope = entity.SafetyScopeGlobal
+	}
+	if err := r.validateSafetyPolicy(body.Candidate); err != nil {
+		return r.respondError(ctx, 400, err)
+	}
+	body.Filter = parseAuditLogFilter(ctx.GetRequest().URL.Query())
+
+	report, err := r.safetySvc.ReplaySafetyPolicy(ctx.GetContext(), &body)
+	if err != nil {
+		return r.respondError(ctx, 500, err)
+	}
+	return ctx.JSON(200, map[string]any{"report": report})
+}
@@ -0,0 +1,53 @@
+package router
+
+import (
+	"strconv"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/httpx"
+)
+
+// defaultViolationWindow 未指定 start 时的统计窗口
+const defaultViolationWindow = 7 * 24 * time.Hour
+
+// getSafetyViolations 违规聚合报告：?start=&end=（RFC3339，默认最近 7 天）&user_id=&direction=&category=&top=
+func (r *LLMAdminRoutes) getSafetyViolations(ctx httpx.IContext) error {
+	if r.safetySvc == nil {
+		return ctx.JSON(500, map[string]string{"message": "LLM safety service 未配置"})
+	}
+	q := ctx.GetRequest().URL.Query()
+	filter := entity.SafetyViolationFilter{
+		Direction: q.Get("direction"),
+		Category:  q.Get("category"),
+	}
+	if v := q.Get("user_id"); v != "" {
+		if id, err := strconv.ParseInt(v, 10, 64); err == nil {
+			filter.UserID = &id
+		}
+	}
+	if v := q.Get("start"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			filter.StartAt = &t
+		}
+	}
+	if filter.StartAt == nil {
+		start := time.Now().Add(-defaultViolationWindow)
+		filter.StartAt = &start
+	}
+	if v := q.Get("end"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			filter.EndAt = &t
+		}
+	}
+	top, _ := strconv.Atoi(q.Get("top"))
+
+	report, err := r.safetySvc.SafetyViolationReport(ctx.GetContext(), filter, top)
+	if err != nil {
+		return r.respondError(ctx, 500, err)
+	}
+	return ctx.JSON(200, map[string]any{
+		"report": report,
+		"start":  filter.StartAt.UTC().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,138 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gochen-llm/service"
+	"gochen/errorx"
+)
+
+// chatStreamHeartbeat 流式响应的心跳间隔，避免代理与负载均衡因连接空闲而断开
+const chatStreamHeartbeat = 15 * time.Second
+
+// chatStreamWriter 流式聊天的传输编码（SSE / WebSocket）
+type chatStreamWriter interface {
+	chunk(c *service.ChatChunk) error
+	done(c *service.ChatChunk) error
+	fail(e *streamError) error
+	heartbeat() error
+}
+
+// streamError 流式响应的错误帧；限流或封禁时带 reason 与 retry_after，同非流式接口的 429 响应
+type streamError struct {
+	Status     int    `json:"status"`
+	Message    string `json:"message"`
+	Reason     string `json:"reason,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+func newStreamError(err error) *streamError {
+	e := &streamError{Status: userErrorStatus(err), Message: err.Error()}
+	if rl, ok := service.AsRateLimited(err); ok {
+		e.Reason, e.RetryAfter = rl.Reason, rl.RetryAfter
+	}
+	return e
+}
+
+// pumpChatStream 将分片写入 w 并定时发送心跳，直到流结束、客户端断开（closed 关闭）或写入失败；
+// 返回前调用 cancel，客户端提前断开时随之终止上游调用
+func pumpChatStream(ch <-chan *service.ChatChunk, w chatStreamWriter, closed <-chan struct{}, cancel context.CancelFunc) {
+	defer cancel()
+	ticker := time.NewTicker(chatStreamHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+			if err := w.heartbeat(); err != nil {
+				return
+			}
+		case c, ok := <-ch:
+			if !ok {
+				// 上游未发送结束分片即关闭通道
+				_ = w.fail(newStreamError(errorx.New(errorx.Internal, "流式响应中断")))
+				return
+			}
+			var err error
+			switch {
+			case c.Err != nil:
+				err = w.fail(newStreamError(c.Err))
+			case c.Done:
+				err = w.done(c)
+			default:
+				err = w.chunk(c)
+			}
+			if err != nil || c.Done {
+				return
+			}
+		}
+	}
+}
+
+// sseChatWriter 以 Server-Sent Events 编码：分片为默认 message 事件，结束为 done 事件，失败为 error 事件，
+// 心跳为注释行；每次写入后立即刷新
+type sseChatWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func newSSEChatWriter(w http.ResponseWriter) *sseChatWriter {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// 关闭 nginx 等反向代理的响应缓冲
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	s := &sseChatWriter{w: w, flusher: flusher}
+	s.flush()
+	return s
+}
+
+func (s *sseChatWriter) chunk(c *service.ChatChunk) error {
+	return s.event("", c)
+}
+
+func (s *sseChatWriter) done(c *service.ChatChunk) error {
+	return s.event("done", c)
+}
+
+func (s *sseChatWriter) fail(e *streamError) error {
+	return s.event("error", e)
+}
+
+func (s *sseChatWriter) heartbeat() error {
+	if _, err := fmt.Fprint(s.w, ": ping\n\n"); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+func (s *sseChatWriter) event(name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if name != "" {
+		if _, err := fmt.Fprintf(s.w, "event: %s\n", name); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(s.w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+func (s *sseChatWriter) flush() {
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
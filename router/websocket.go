@@ -0,0 +1,234 @@
+package router
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gochen-llm/service"
+	"gochen/errorx"
+)
+
+// websocketGUID RFC 6455 握手计算 Sec-WebSocket-Accept 使用的固定串
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	// maxWebSocketMessage 客户端单条消息的字节上限
+	maxWebSocketMessage = 1 << 20
+	// wsWriteTimeout 单帧写入超时，客户端长时间不读时放弃连接
+	wsWriteTimeout = 10 * time.Second
+)
+
+// WebSocket 帧类型
+const (
+	wsOpContinuation byte = 0x0
+	wsOpText         byte = 0x1
+	wsOpClose        byte = 0x8
+	wsOpPing         byte = 0x9
+	wsOpPong         byte = 0xA
+)
+
+// WebSocket 关闭码
+const (
+	wsCloseNormal      uint16 = 1000
+	wsCloseUnsupported uint16 = 1003
+	wsCloseInternal    uint16 = 1011
+)
+
+// wsConn 服务端 WebSocket 连接，仅实现流式聊天所需的文本消息、ping/pong 与关闭握手
+type wsConn struct {
+	conn    net.Conn
+	rw      *bufio.ReadWriter
+	writeMu sync.Mutex
+}
+
+// isWebSocketUpgrade 判断请求是否为 WebSocket 升级请求
+func isWebSocketUpgrade(req *http.Request) bool {
+	if !strings.EqualFold(req.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	for _, token := range strings.Split(req.Header.Get("Connection"), ",") {
+		if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+			return true
+		}
+	}
+	return false
+}
+
+// upgradeWebSocket 校验来源后完成握手并接管连接；返回错误时尚未写入响应，调用方仍可按普通 HTTP 响应
+func upgradeWebSocket(w http.ResponseWriter, req *http.Request) (*wsConn, error) {
+	if req.Method != http.MethodGet || !isWebSocketUpgrade(req) {
+		return nil, errorx.New(errorx.InvalidInput, "需要 WebSocket 升级请求")
+	}
+	// 浏览器发起 WebSocket 时会携带 Cookie 但无法设置认证头，拒绝非白名单的跨源请求以防跨站劫持
+	if !allowedWebSocketOrigin(req) {
+		return nil, errorx.New(errorx.Forbidden, "不允许的 WebSocket 来源: "+req.Header.Get("Origin"))
+	}
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if key == "" || req.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, errorx.New(errorx.InvalidInput, "WebSocket 握手参数无效")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errorx.New(errorx.Internal, "当前 HTTP 服务不支持 WebSocket")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "接管连接失败")
+	}
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " +
+		base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, rw: rw}, nil
+}
+
+// writeFrame 写入单个未分片、无掩码的帧；可并发调用
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	header := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := c.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := c.rw.Write(payload); err != nil {
+		return err
+	}
+	return c.rw.Flush()
+}
+
+// readMessage 读取下一条文本消息（合并分片），期间自动应答 ping；对方关闭时回应关闭帧并返回 io.EOF
+func (c *wsConn) readMessage() ([]byte, error) {
+	var msg []byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+		case wsOpPong:
+		case wsOpClose:
+			_ = c.writeFrame(wsOpClose, nil)
+			return nil, io.EOF
+		case wsOpText, wsOpContinuation:
+			msg = append(msg, payload...)
+			if len(msg) > maxWebSocketMessage {
+				return nil, errorx.New(errorx.InvalidInput, "WebSocket 消息过大")
+			}
+			if fin {
+				return msg, nil
+			}
+		default:
+			return nil, errorx.New(errorx.InvalidInput, "仅支持文本消息")
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (bool, byte, []byte, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.rw, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op := head[0]&0x80 != 0, head[0]&0x0F
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, errorx.New(errorx.InvalidInput, "客户端帧须使用掩码")
+	}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxWebSocketMessage {
+		return false, 0, nil, errorx.New(errorx.InvalidInput, "WebSocket 消息过大")
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.rw, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// close 发送关闭帧后断开连接
+func (c *wsConn) close(code uint16, reason string) {
+	payload := binary.BigEndian.AppendUint16(nil, code)
+	_ = c.writeFrame(wsOpClose, append(payload, reason...))
+	_ = c.conn.Close()
+}
+
+// wsChatFrame 流式聊天的 WebSocket 消息：type 为 chunk/done/error，其余字段同 SSE 事件的数据
+type wsChatFrame struct {
+	Type string `json:"type"`
+	*streamError
+	*service.ChatChunk
+}
+
+type wsChatWriter struct {
+	conn *wsConn
+}
+
+func (w *wsChatWriter) chunk(c *service.ChatChunk) error {
+	return w.write(&wsChatFrame{Type: "chunk", ChatChunk: c})
+}
+
+func (w *wsChatWriter) done(c *service.ChatChunk) error {
+	return w.write(&wsChatFrame{Type: "done", ChatChunk: c})
+}
+
+func (w *wsChatWriter) fail(e *streamError) error {
+	return w.write(&wsChatFrame{Type: "error", streamError: e})
+}
+
+func (w *wsChatWriter) heartbeat() error {
+	return w.conn.writeFrame(wsOpPing, nil)
+}
+
+func (w *wsChatWriter) write(frame *wsChatFrame) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	return w.conn.writeFrame(wsOpText, data)
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+const (
+	defaultBanditEpsilon = 0.1
+	// banditStatsTTL 变体转化统计的缓存时长，避免每次分配都查询指标表
+	banditStatsTTL = 30 * time.Second
+	// banditFreezeMinExposures 自动冻结前每个变体至少需要的曝光数
+	banditFreezeMinExposures = 100
+	banditMonteCarloDraws    = 2000
+)
+
+// banditArm 单个变体的观测数据
+type banditArm struct {
+	exposures   int64
+	conversions int64
+}
+
+type banditStats struct {
+	arms      map[string]banditArm
+	fetchedAt time.Time
+}
+
+// banditStatsCache 按测试 ID 缓存变体观测数据
+type banditStatsCache struct {
+	mu    sync.Mutex
+	items map[int64]*banditStats
+}
+
+func newBanditStatsCache() *banditStatsCache {
+	return &banditStatsCache{items: map[int64]*banditStats{}}
+}
+
+// loadBanditStats 从 MetricsRepo 读取各变体的曝光与转化（带缓存）
+func (s *promptServiceImpl) loadBanditStats(ctx context.Context, testID int64) (map[string]banditArm, error) {
+	s.bandit.mu.Lock()
+	cached, ok := s.bandit.items[testID]
+	s.bandit.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < banditStatsTTL {
+		return cached.arms, nil
+	}
+	if s.metrics == nil {
+		return nil, errorx.New(errorx.Internal, "LLM MetricsRepo 未配置")
+	}
+
+	report, err := s.metrics.Significance(ctx, entity.MetricsFilter{ABTestID: &testID})
+	if err != nil {
+		return nil, err
+	}
+	arms := map[string]banditArm{}
+	for _, v := range report.Variants {
+		arms[v.Variant] = banditArm{
+			exposures:   int64(v.Metrics.TotalCalls),
+			conversions: int64(v.Metrics.ConversionCalls),
+		}
+	}
+	s.bandit.mu.Lock()
+	s.bandit.items[testID] = &banditStats{arms: arms, fetchedAt: time.Now()}
+	s.bandit.mu.Unlock()
+	return arms, nil
+}
+
+// banditPick 按观测到的转化率自适应选择变体；达到冻结条件时冻结测试
+func (s *promptServiceImpl) banditPick(ctx context.Context, test *entity.ABTest, variants []entity.ABTestVariant) (entity.ABTestVariant, error) {
+	arms, err := s.loadBanditStats(ctx, test.ID)
+	if err != nil {
+		return entity.ABTestVariant{}, err
+	}
+
+	if test.FreezeConfidence > 0 {
+		if key, prob := banditProbBest(variants, arms); key != "" && prob >= test.FreezeConfidence {
+			if err := s.FreezeABTest(ctx, test.ID, key); err == nil {
+				v, _ := findABVariant(variants, key)
+				return v, nil
+			}
+		}
+	}
+
+	switch test.Mode {
+	case entity.ABTestModeEpsilonGreedy:
+		epsilon := test.Epsilon
+		if epsilon <= 0 || epsilon >= 1 {
+			epsilon = defaultBanditEpsilon
+		}
+		if rand.Float64() < epsilon {
+			return variants[rand.Intn(len(variants))], nil
+		}
+		best := variants[0]
+		bestRate := -1.0
+		for _, v := range variants {
+			arm := arms[v.Key]
+			rate := 0.0
+			if arm.exposures > 0 {
+				rate = float64(arm.conversions) / float64(arm.exposures)
+			}
+			if rate > bestRate {
+				best, bestRate = v, rate
+			}
+		}
+		return best, nil
+	default: // thompson
+		best := variants[0]
+		bestSample := -1.0
+		for _, v := range variants {
+			arm := arms[v.Key]
+			sample := sampleBeta(float64(1+arm.conversions), float64(1+arm.exposures-arm.conversions))
+			if sample > bestSample {
+				best, bestSample = v, sample
+			}
+		}
+		return best, nil
+	}
+}
+
+// banditProbBest 用蒙特卡洛估计各变体为最优的后验概率，返回概率最高的变体；样本不足时返回空
+func banditProbBest(variants []entity.ABTestVariant, arms map[string]banditArm) (string, float64) {
+	for _, v := range variants {
+		if arms[v.Key].exposures < banditFreezeMinExposures {
+			return "", 0
+		}
+	}
+	wins := map[string]int{}
+	for i := 0; i < banditMonteCarloDraws; i++ {
+		bestKey := ""
+		bestSample := -1.0
+		for _, v := range variants {
+			arm := arms[v.Key]
+			sample := sampleBeta(float64(1+arm.conversions), float64(1+arm.exposures-arm.conversions))
+			if sample > bestSample {
+				bestKey, bestSample = v.Key, sample
+			}
+		}
+		wins[bestKey]++
+	}
+	bestKey := ""
+	bestWins := 0
+	for k, n := range wins {
+		if n > bestWins {
+			bestKey, bestWins = k, n
+		}
+	}
+	return bestKey, float64(bestWins) / banditMonteCarloDraws
+}
+
+// FreezeABTest 冻结测试分配：后续流量（留出组除外）全部分配给指定变体
+func (s *promptServiceImpl) FreezeABTest(ctx context.Context, testID int64, variant string) error {
+	test, err := s.repo.GetABTest(ctx, testID)
+	if err != nil {
+		return err
+	}
+	if test == nil {
+		return errorx.New(errorx.NotFound, "A/B 测试不存在")
+	}
+	variants, err := abTestVariants(test)
+	if err != nil {
+		return err
+	}
+	if _, ok := findABVariant(variants, variant); !ok {
+		return errorx.New(errorx.Validation, "变体不存在: "+variant)
+	}
+	now := time.Now()
+	test.FrozenVariant = variant
+	test.FrozenAt = &now
+	return s.repo.UpdateABTest(ctx, test)
+}
+
+// sampleBeta 通过两个 Gamma 样本生成 Beta(a, b) 样本
+func sampleBeta(a, b float64) float64 {
+	x := sampleGamma(a)
+	y := sampleGamma(b)
+	if x+y == 0 {
+		return 0.5
+	}
+	return x / (x + y)
+}
+
+// sampleGamma Marsaglia-Tsang 方法生成 Gamma(shape, 1) 样本
+func sampleGamma(shape float64) float64 {
+	if shape < 1 {
+		return sampleGamma(shape+1) * math.Pow(rand.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rand.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rand.Float64()
+		if u < 1-0.0331*x*x*x*x || math.Log(u) < 0.5*x*x+d*(1-v+math.Log(v)) {
+			return d * v
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+	"gochen/logging"
+	runtime "gochen/task"
+)
+
+const (
+	defaultABMonitorInterval = 10 * time.Minute
+	// abAutoStopMinExposures 按置信度自动停止前，每个变体至少需要的曝光数
+	abAutoStopMinExposures = 100
+)
+
+// ABTestMonitor 周期性评估运行中的 A/B 测试：置信度达标或到期时停止测试、记录结果并按配置发布胜出变体
+type ABTestMonitor interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	// EvaluateOnce 立即评估一轮，返回本轮停止的测试 ID
+	EvaluateOnce(ctx context.Context) ([]int64, error)
+}
+
+type abTestMonitorImpl struct {
+	repo    repo.PromptTemplateRepo
+	metrics repo.MetricsRepo
+	prompt  PromptService
+	logger  logging.ILogger
+	super   *runtime.TaskSupervisor
+
+	interval time.Duration
+
+	lifecycleMu sync.Mutex
+	started     bool
+	stopped     bool
+	cancel      context.CancelFunc
+}
+
+func NewABTestMonitor(repo repo.PromptTemplateRepo, metrics repo.MetricsRepo, prompt PromptService, logger logging.ILogger) ABTestMonitor {
+	return &abTestMonitorImpl{
+		repo:     repo,
+		metrics:  metrics,
+		prompt:   prompt,
+		logger:   logger,
+		super:    runtime.NewTaskSupervisor("gochen-llm.ab_test_monitor"),
+		interval: defaultABMonitorInterval,
+	}
+}
+
+func (m *abTestMonitorImpl) Start(ctx context.Context) error {
+	if ctx == nil {
+		return errorx.New(errorx.InvalidInput, "ctx 不能为空")
+	}
+
+	m.lifecycleMu.Lock()
+	defer m.lifecycleMu.Unlock()
+
+	if m.stopped {
+		return errorx.New(errorx.Internal, "ABTestMonitor 已停止，无法再次启动")
+	}
+	if m.started {
+		return nil
+	}
+	loopCtx, cancel := context.WithCancel(ctx)
+	m.cancel = cancel
+	m.started = true
+
+	m.super.GoLoop(loopCtx, "evaluate_loop", m.interval, func(ctx context.Context) error {
+		if _, err := m.EvaluateOnce(ctx); err != nil && m.logger != nil {
+			m.logger.Warn(ctx, "A/B 测试自动评估失败", logging.Error(err))
+		}
+		return nil
+	})
+	return nil
+}
+
+func (m *abTestMonitorImpl) Stop(ctx context.Context) error {
+	m.lifecycleMu.Lock()
+	if !m.started || m.stopped {
+		m.lifecycleMu.Unlock()
+		return nil
+	}
+	m.stopped = true
+	cancel := m.cancel
+	m.lifecycleMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	m.super.Stop()
+	return nil
+}
+
+func (m *abTestMonitorImpl) EvaluateOnce(ctx context.Context) ([]int64, error) {
+	if m.repo == nil || m.metrics == nil {
+		return nil, errorx.New(errorx.Internal, "A/B 测试仓储未配置")
+	}
+	tests, err := m.repo.ListABTests(ctx, "running")
+	if err != nil {
+		return nil, err
+	}
+
+	var stoppedIDs []int64
+	now := time.Now()
+	for _, test := range tests {
+		testID := test.ID
+		report, err := m.metrics.Significance(ctx, entity.MetricsFilter{ABTestID: &testID})
+		if err != nil {
+			if m.logger != nil {
+				m.logger.Warn(ctx, "计算 A/B 测试显著性失败", logging.Int("ab_test_id", int(testID)), logging.Error(err))
+			}
+			continue
+		}
+
+		reason := ""
+		switch {
+		case !test.EndAt.IsZero() && now.After(test.EndAt):
+			reason = "expired"
+		// 监控会反复查看结果，按序贯检验置信度判断，避免假阳性膨胀
+		case test.AutoStopConfidence > 0 && report.SequentialConfidence >= test.AutoStopConfidence && enoughExposures(report):
+			reason = "confident"
+		}
+		if reason == "" {
+			continue
+		}
+		if err := m.stopTest(ctx, test, report, reason, now); err != nil {
+			if m.logger != nil {
+				m.logger.Warn(ctx, "自动停止 A/B 测试失败", logging.Int("ab_test_id", int(testID)), logging.Error(err))
+			}
+			continue
+		}
+		stoppedIDs = append(stoppedIDs, testID)
+	}
+	return stoppedIDs, nil
+}
+
+func enoughExposures(report *entity.ABSignificanceReport) bool {
+	n := 0
+	for _, v := range report.Variants {
+		if v.Variant == entity.ABVariantHoldout {
+			continue
+		}
+		if v.Metrics.TotalCalls < abAutoStopMinExposures {
+			return false
+		}
+		n++
+	}
+	return n >= 2
+}
+
+// stopTest 停止测试并将最终结果写入 ResultJSON.final；达到置信度且配置了 PromoteWinner 时发布胜出变体
+func (m *abTestMonitorImpl) stopTest(ctx context.Context, test *entity.ABTest, report *entity.ABSignificanceReport, reason string, now time.Time) error {
+	final := map[string]any{
+		"reason":                reason,
+		"winner":                report.Winner,
+		"p_value":               report.PValue,
+		"confidence":            report.Confidence,
+		"sequential_confidence": report.SequentialConfidence,
+		"prob_beats_control":    report.ProbBeatsControl,
+		"lift":                  report.Lift,
+		"variants":              report.Variants,
+		"stopped_at":            now.Format(time.RFC3339),
+	}
+
+	if reason == "confident" && test.PromoteWinner {
+		promotedID, err := m.promoteWinner(ctx, test, report.Winner)
+		if err != nil {
+			final["promote_error"] = err.Error()
+		} else if promotedID > 0 {
+			final["promoted_template_id"] = promotedID
+		}
+	}
+
+	result := map[string]any{}
+	if strings.TrimSpace(test.ResultJSON) != "" {
+		_ = json.Unmarshal([]byte(test.ResultJSON), &result)
+	}
+	result["final"] = final
+	data, _ := json.Marshal(result)
+
+	test.ResultJSON = string(data)
+	test.Status = "stopped"
+	if test.EndAt.IsZero() || test.EndAt.After(now) {
+		test.EndAt = now
+	}
+	if err := m.repo.UpdateABTest(ctx, test); err != nil {
+		return err
+	}
+	if m.logger != nil {
+		m.logger.Info(ctx, "A/B 测试已自动停止",
+			logging.Int("ab_test_id", int(test.ID)),
+			logging.String("reason", reason),
+			logging.String("winner", report.Winner),
+		)
+	}
+	return nil
+}
+
+// promoteWinner 将胜出变体模板的内容保存到对照组模板（同名同作用域，生成新版本），胜出方为对照组时不做任何事
+func (m *abTestMonitorImpl) promoteWinner(ctx context.Context, test *entity.ABTest, winner string) (int64, error) {
+	if m.prompt == nil || winner == "" || winner == "tie" || winner == entity.ABVariantHoldout {
+		return 0, nil
+	}
+	variants, err := abTestVariants(test)
+	if err != nil {
+		return 0, err
+	}
+	control := variants[0]
+	chosen, ok := findABVariant(variants, winner)
+	// 变体可以是同一模板的不同固定版本，模板与版本都相同才视为对照组
+	if !ok || (chosen.TemplateID == control.TemplateID && chosen.Version == control.Version) {
+		return 0, nil
+	}
+
+	target, err := m.prompt.GetPromptByID(ctx, control.TemplateID)
+	if err != nil {
+		return 0, err
+	}
+	// 发布实验中实际使用的（固定）版本，而非模板当前内容
+	source, err := m.prompt.GetPromptAtVersion(ctx, chosen.TemplateID, chosen.Version)
+	if err != nil {
+		return 0, err
+	}
+	if target == nil || source == nil {
+		return 0, errorx.New(errorx.NotFound, "A/B 变体模板不存在")
+	}
+
+	target.Content = source.Content
+	target.VariablesJSON = source.VariablesJSON
+	target.MetadataJSON = source.MetadataJSON
+	target.Version++
+	if err := m.prompt.SavePrompt(ctx, target); err != nil {
+		return 0, errorx.Wrap(err, errorx.Internal, "发布胜出变体失败")
+	}
+	return target.ID, nil
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+const maxABHoldout = 50
+
+// abTestVariants 解析测试的变体列表；未配置 VariantsJSON 时由 TemplateAID/TemplateBID 与 TrafficSplit 推导
+func abTestVariants(test *entity.ABTest) ([]entity.ABTestVariant, error) {
+	if strings.TrimSpace(test.VariantsJSON) != "" {
+		var variants []entity.ABTestVariant
+		if err := json.Unmarshal([]byte(test.VariantsJSON), &variants); err != nil {
+			return nil, errorx.Wrap(err, errorx.Validation, "解析 A/B 测试变体配置失败")
+		}
+		return variants, nil
+	}
+	traffic := test.TrafficSplit
+	if traffic <= 0 || traffic >= 100 {
+		traffic = 50
+	}
+	return []entity.ABTestVariant{
+		{Key: "A", TemplateID: test.TemplateAID, Weight: traffic},
+		{Key: "B", TemplateID: test.TemplateBID, Weight: 100 - traffic},
+	}, nil
+}
+
+// validateABVariants 校验变体配置：至少两个变体、标识唯一、权重为正
+func validateABVariants(variants []entity.ABTestVariant, holdout int) error {
+	if len(variants) < 2 {
+		return errorx.New(errorx.Validation, "A/B 测试至少需要两个变体")
+	}
+	if holdout < 0 || holdout > maxABHoldout {
+		return errorx.New(errorx.Validation, fmt.Sprintf("留出组比例需在 0-%d 之间", maxABHoldout))
+	}
+	seen := map[string]bool{}
+	for _, v := range variants {
+		key := strings.TrimSpace(v.Key)
+		if key == "" || len(key) > 20 || key == entity.ABVariantHoldout {
+			return errorx.New(errorx.Validation, fmt.Sprintf("变体标识无效: %q", v.Key))
+		}
+		if seen[key] {
+			return errorx.New(errorx.Validation, fmt.Sprintf("变体标识重复: %s", key))
+		}
+		seen[key] = true
+		if v.TemplateID <= 0 {
+			return errorx.New(errorx.Validation, fmt.Sprintf("变体 %s 的模板 ID 无效", key))
+		}
+		if v.Weight <= 0 {
+			return errorx.New(errorx.Validation, fmt.Sprintf("变体 %s 的权重必须为正数", key))
+		}
+	}
+	return nil
+}
+
+// inABHoldout 留出组使用独立的 (testID, userID) 哈希判定，与变体分桶互不影响
+func inABHoldout(testID int64, userID int64, holdout int) bool {
+	if holdout <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	_, _ = fmt.Fprintf(h, "%d:%d", testID, userID)
+	return int(h.Sum32()%100) < holdout
+}
+
+// pickWeightedVariant 按权重为用户稳定分配变体；分桶沿用 userID 取模，保证旧的两变体测试分配不变
+func pickWeightedVariant(userID int64, variants []entity.ABTestVariant) entity.ABTestVariant {
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+	hash := userID
+	if hash < 0 {
+		hash = -hash
+	}
+	slot := int(hash % int64(total))
+	for _, v := range variants {
+		if slot < v.Weight {
+			return v
+		}
+		slot -= v.Weight
+	}
+	return variants[len(variants)-1]
+}
+
+func findABVariant(variants []entity.ABTestVariant, key string) (entity.ABTestVariant, bool) {
+	for _, v := range variants {
+		if v.Key == key {
+			return v, true
+		}
+	}
+	return entity.ABTestVariant{}, false
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gochen-llm/entity"
+)
+
+// auditDiffIgnoredFields 不参与差异比较的字段
+var auditDiffIgnoredFields = map[string]bool{"CreatedAt": true, "UpdatedAt": true}
+
+// auditSensitiveSuffixes 字段名（小写）以这些后缀结尾时视为敏感字段，快照中仅保留摘要
+var auditSensitiveSuffixes = []string{"apikey", "api_key", "token", "secret", "password"}
+
+// RecordAdminChange 记录管理端写操作：before 为变更前的对象（新增时为 nil），after 为变更后的对象（删除时为 nil）。
+// RequestJSON 记录字段级差异，ResponseJSON 记录变更后的快照；敏感字段仅以摘要形式出现。
+func (s *safetyServiceImpl) RecordAdminChange(ctx context.Context, action, resourceType string, resourceID int64, before, after any) {
+	recordAdminChange(ctx, s, action, resourceType, resourceID, before, after)
+}
+
+// recordAdminChange 供未直接持有 SafetyService 实现的服务复用；safety 为 nil 时忽略
+func recordAdminChange(ctx context.Context, safety SafetyService, action, resourceType string, resourceID int64, before, after any) {
+	if safety == nil {
+		return
+	}
+	b, a := auditSnapshot(before), auditSnapshot(after)
+	diff := auditDiff(b, a)
+	if len(diff) == 0 && before != nil && after != nil {
+		return
+	}
+	diffJSON, _ := json.Marshal(diff)
+	afterJSON := ""
+	if a != nil {
+		raw, _ := json.Marshal(a)
+		afterJSON = string(raw)
+	}
+	_ = safety.RecordAuditLog(ctx, &entity.AuditLog{
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+		RequestJSON:  string(diffJSON),
+		ResponseJSON: afterJSON,
+		Status:       "ok",
+	})
+}
+
+// auditSnapshot 将对象转为 JSON 通用结构并脱敏
+func auditSnapshot(v any) any {
+	if v == nil {
+		return nil
+	}
+	if rv := reflect.ValueOf(v); (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Slice || rv.Kind() == reflect.Map) && rv.IsNil() {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out any
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil
+	}
+	return maskAuditSensitive(out)
+}
+
+func maskAuditSensitive(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			if str, ok := val.(string); ok && str != "" && isAuditSensitiveField(k) {
+				sum := sha256.Sum256([]byte(str))
+				t[k] = "***" + hex.EncodeToString(sum[:4])
+				continue
+			}
+			t[k] = maskAuditSensitive(val)
+		}
+		return t
+	case []any:
+		for i := range t {
+			t[i] = maskAuditSensitive(t[i])
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+func isAuditSensitiveField(name string) bool {
+	name = strings.ToLower(name)
+	for _, suffix := range auditSensitiveSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// auditDiff 计算字段级差异 {"字段": {"before": x, "after": y}}；
+// 均为带 ID 的对象数组时按 ID 逐项比较（键为 "ID=<id>"），其他类型整体比较
+func auditDiff(before, after any) map[string]any {
+	diff := map[string]any{}
+	bm, bok := before.(map[string]any)
+	am, aok := after.(map[string]any)
+	if (bok || before == nil) && (aok || after == nil) && (bok || aok) {
+		keys := map[string]bool{}
+		for k := range bm {
+			keys[k] = true
+		}
+		for k := range am {
+			keys[k] = true
+		}
+		for k := range keys {
+			if auditDiffIgnoredFields[k] || reflect.DeepEqual(bm[k], am[k]) {
+				continue
+			}
+			diff[k] = map[string]any{"before": bm[k], "after": am[k]}
+		}
+		return diff
+	}
+	if bi, ok := auditIndexByID(before); ok {
+		if ai, ok := auditIndexByID(after); ok {
+			keys := map[string]bool{}
+			for k := range bi {
+				keys[k] = true
+			}
+			for k := range ai {
+				keys[k] = true
+			}
+			for k := range keys {
+				if d := auditDiff(bi[k], ai[k]); len(d) > 0 {
+					diff[k] = d
+				}
+			}
+			return diff
+		}
+	}
+	if !reflect.DeepEqual(before, after) {
+		diff["value"] = map[string]any{"before": before, "after": after}
+	}
+	return diff
+}
+
+func auditIndexByID(v any) (map[string]any, bool) {
+	if v == nil {
+		return map[string]any{}, true
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, false
+	}
+	index := make(map[string]any, len(list))
+	for _, item := range list {
+		m, ok := item.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		id, ok := m["ID"]
+		if !ok {
+			return nil, false
+		}
+		index[fmt.Sprintf("ID=%v", id)] = m
+	}
+	return index, true
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+
+	"gochen-llm/entity"
+)
+
+type auditCallsiteKey struct{}
+
+// AuditCallsite 调用来源信息，由 HTTP 层写入 ctx；RecordAuditLog 据此补全审计日志中未填写的字段
+type AuditCallsite struct {
+	UserID       int64 // 操作者，管理端请求时为当前登录用户
+	IPAddress    string
+	UserAgent    string
+	Route        string // 如 "PUT /admin/llm/safety"
+	ResourceType string
+	ResourceID   int64
+}
+
+// WithAuditCallsite 声明当前请求的调用来源
+func WithAuditCallsite(ctx context.Context, callsite AuditCallsite) context.Context {
+	return context.WithValue(ctx, auditCallsiteKey{}, callsite)
+}
+
+// WithAuditResource 声明当前操作的目标资源（如管理端修改的配置、提示词），保留已有的调用来源
+func WithAuditResource(ctx context.Context, resourceType string, resourceID int64) context.Context {
+	callsite, _ := ctx.Value(auditCallsiteKey{}).(AuditCallsite)
+	callsite.ResourceType, callsite.ResourceID = resourceType, resourceID
+	return context.WithValue(ctx, auditCallsiteKey{}, callsite)
+}
+
+// applyAuditCallsite 用 ctx 中的调用来源补全审计日志，已显式设置的字段不覆盖
+func applyAuditCallsite(ctx context.Context, log *entity.AuditLog) {
+	callsite, ok := ctx.Value(auditCallsiteKey{}).(AuditCallsite)
+	if !ok {
+		return
+	}
+	if log.UserID == 0 {
+		log.UserID = callsite.UserID
+	}
+	if log.IPAddress == "" {
+		log.IPAddress = callsite.IPAddress
+	}
+	if log.UserAgent == "" {
+		log.UserAgent = callsite.UserAgent
+	}
+	if log.Route == "" {
+		log.Route = callsite.Route
+	}
+	if log.ResourceType == "" {
+		log.ResourceType = callsite.ResourceType
+	}
+	if log.ResourceID == 0 {
+		log.ResourceID = callsite.ResourceID
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+// defaultAuditMaxFieldChars redacted 级别下单个字符串字段默认保留的字符数
+const defaultAuditMaxFieldChars = 2000
+
+// ValidateAuditLogLevel 校验审计日志记录级别
+func ValidateAuditLogLevel(level string) error {
+	switch level {
+	case "", entity.AuditLogLevelNone, entity.AuditLogLevelRedacted, entity.AuditLogLevelHash, entity.AuditLogLevelMetadata:
+		return nil
+	default:
+		return errorx.New(errorx.Validation, "日志级别仅支持 none/redacted/hash/metadata: "+level)
+	}
+}
+
+// redactAuditLog 按策略的 LogLevel 处理审计日志的请求/响应正文
+func (s *safetyServiceImpl) redactAuditLog(policy *entity.SafetyPolicy, log *entity.AuditLog) {
+	if policy == nil || !policy.Enabled {
+		return
+	}
+	switch policy.LogLevel {
+	case entity.AuditLogLevelMetadata:
+		log.RequestJSON, log.ResponseJSON = "", ""
+	case entity.AuditLogLevelHash:
+		log.RequestJSON, log.ResponseJSON = hashAuditPayload(log.RequestJSON), hashAuditPayload(log.ResponseJSON)
+	case entity.AuditLogLevelRedacted:
+		detectors, err := s.pii.get(policy.PIIConfigJSON)
+		if err != nil {
+			detectors = defaultPIIDetectors
+		}
+		maxChars := policy.AuditMaxFieldChars
+		if maxChars <= 0 {
+			maxChars = defaultAuditMaxFieldChars
+		}
+		redact := func(text string) string {
+			text = maskSecrets(text)
+			text = scanPII(detectors, text, true).Content
+			if runes := []rune(text); len(runes) > maxChars {
+				text = string(runes[:maxChars]) + fmt.Sprintf("…[truncated %d chars]", len(runes)-maxChars)
+			}
+			return text
+		}
+		log.RequestJSON = redactAuditPayload(log.RequestJSON, redact)
+		log.ResponseJSON = redactAuditPayload(log.ResponseJSON, redact)
+		log.ErrorMessage = redact(log.ErrorMessage)
+	}
+}
+
+// redactAuditPayload 正文为 JSON 时逐个处理字符串值以保留结构，否则按纯文本处理
+func redactAuditPayload(payload string, redact func(string) string) string {
+	if payload == "" {
+		return ""
+	}
+	var v any
+	if err := json.Unmarshal([]byte(payload), &v); err != nil {
+		return redact(payload)
+	}
+	out, err := json.Marshal(redactJSONValue(v, redact))
+	if err != nil {
+		return redact(payload)
+	}
+	return string(out)
+}
+
+func redactJSONValue(v any, redact func(string) string) any {
+	switch t := v.(type) {
+	case string:
+		return redact(t)
+	case []any:
+		for i := range t {
+			t[i] = redactJSONValue(t[i], redact)
+		}
+		return t
+	case map[string]any:
+		for k := range t {
+			t[k] = redactJSONValue(t[k], redact)
+		}
+		return t
+	default:
+		return v
+	}
+}
+
+func hashAuditPayload(payload string) string {
+	if payload == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(payload))
+	out, _ := json.Marshal(map[string]any{
+		"sha256": hex.EncodeToString(sum[:]),
+		"length": len(payload),
+	})
+	return string(out)
+}
+
+// maskSecrets 按内置凭据规则掩码文本
+func maskSecrets(text string) string {
+	for _, p := range secretPatterns {
+		text = p.re.ReplaceAllString(text, "[SECRET:"+p.name+"]")
+	}
+	return text
+}
@@ -0,0 +1,342 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gochen-llm/client"
+	"gochen-llm/entity"
+	"gochen/errorx"
+	runtime "gochen/task"
+)
+
+const (
+	defaultBestOfN = 3
+	maxBestOfN     = 8
+)
+
+// ChatBestOfN 将同一请求分发为 N 个候选（重复采样或多端点），再按打分函数/裁判模型择优返回。
+// 限流与输入检查按一次请求计；部分候选失败不影响结果，降级（兜底）回复不参与打分，
+// 没有正常候选时返回降级回复，全部失败时返回首个错误。
+func (s *chatServiceImpl) ChatBestOfN(ctx context.Context, req *BestOfNRequest) (*ChatResponse, error) {
+	if req == nil {
+		return nil, errorx.New(errorx.InvalidInput, "BestOfNRequest 不能为空")
+	}
+	if s.manager == nil {
+		return nil, errorx.New(errorx.Internal, "LLM ProviderManager 未配置")
+	}
+
+	n := req.N
+	if n <= 0 {
+		n = defaultBestOfN
+	}
+	if n > maxBestOfN {
+		n = maxBestOfN
+	}
+
+	var endpoints []string
+	if req.Mode == BestOfNModeProviders {
+		names, err := s.pickFanOutEndpoints(ctx, n)
+		if err != nil {
+			return nil, err
+		}
+		if len(names) == 0 {
+			return nil, errorx.New(errorx.Internal, "没有可用的 LLM 端点")
+		}
+		endpoints = names
+		n = len(names)
+	}
+
+	// 限流与输入检查只对父请求执行一次，候选不再重复扣减额度、写审计
+	ctx, _ = withRequestID(ctx)
+	if err := s.precheckBestOfN(ctx, &req.ChatRequest); err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, bestOfNCandidateKey{}, true)
+
+	candidates := make([]*ChatResponse, n)
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	super := runtime.NewTaskSupervisor("llm.best_of_n")
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		idx := i
+		super.Go(ctx, fmt.Sprintf("candidate_%d", idx), func(ctx context.Context) {
+			defer wg.Done()
+			cctx := ctx
+			if endpoints != nil {
+				cctx = WithPinnedEndpoint(ctx, endpoints[idx])
+			}
+			cctx, cancel := context.WithTimeout(cctx, 60*time.Second)
+			defer cancel()
+
+			sub := req.ChatRequest
+			sub.Metadata = cloneMetadata(req.Metadata)
+			sub.Metadata["best_of_n_index"] = idx
+			sub.NoDedup = true
+			candidates[idx], errs[idx] = s.Chat(cctx, &sub)
+		})
+	}
+	wg.Wait()
+	super.Stop()
+
+	valid := make([]*ChatResponse, 0, n)
+	var firstErr error
+	var degraded *ChatResponse
+	for i := range candidates {
+		if errs[i] != nil {
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		switch {
+		case candidates[i] == nil:
+		case candidates[i].Degraded:
+			// 降级（兜底）回复不是模型生成的候选，不参与打分
+			if degraded == nil {
+				degraded = candidates[i]
+			}
+		default:
+			valid = append(valid, candidates[i])
+		}
+	}
+	if len(valid) == 0 {
+		if degraded != nil {
+			return degraded, nil
+		}
+		if firstErr == nil {
+			firstErr = errorx.New(errorx.Internal, "best-of-N 未产生任何候选")
+		}
+		return nil, firstErr
+	}
+
+	scorer := req.Scorer
+	if scorer == nil && strings.TrimSpace(req.JudgePrompt) != "" {
+		scorer = s.judgeScorer(req.JudgePrompt)
+	}
+	if scorer == nil {
+		scorer = consensusScorer
+	}
+
+	bestIdx := 0
+	bestScore := 0.0
+	scores := make([]float64, len(valid))
+	for i, cand := range valid {
+		score, err := scorer(ctx, &req.ChatRequest, cand, valid)
+		if err != nil {
+			score = 0
+		}
+		scores[i] = score
+		if i == 0 || score > bestScore {
+			bestIdx = i
+			bestScore = score
+		}
+	}
+
+	best := valid[bestIdx]
+	if best.Metadata == nil {
+		best.Metadata = map[string]interface{}{}
+	}
+	best.Metadata["best_of_n"] = map[string]any{
+		"candidates": len(valid),
+		"requested":  n,
+		"scores":     scores,
+		"selected":   bestIdx,
+	}
+	s.recordBestOfNAudit(ctx, req, best, len(valid))
+	return best, nil
+}
+
+type bestOfNCandidateKey struct{}
+
+// isBestOfNCandidate 是否为 best-of-N 的候选调用（限流、输入检查与审计由父请求负责）
+func isBestOfNCandidate(ctx context.Context) bool {
+	v, _ := ctx.Value(bestOfNCandidateKey{}).(bool)
+	return v
+}
+
+// precheckBestOfN 以父请求的身份与会话作用域执行一次限流与输入检查
+func (s *chatServiceImpl) precheckBestOfN(ctx context.Context, req *ChatRequest) error {
+	if s.safety == nil {
+		return nil
+	}
+	ctx = WithSafetyUser(ctx, req.UserID)
+	if req.ConversationID > 0 && s.conversations != nil {
+		var conv *entity.Conversation
+		var err error
+		if req.UserID > 0 {
+			conv, err = s.conversations.GetConversationForUser(ctx, req.UserID, req.ConversationID)
+		} else {
+			conv, err = s.conversations.GetConversation(ctx, req.ConversationID)
+		}
+		if err != nil {
+			return err
+		}
+		if conv == nil {
+			return errorx.New(errorx.NotFound, "会话不存在")
+		}
+		ctx = WithSafetyConversationType(ctx, conv.Type)
+	}
+	checked := *req
+	if hasAttachments(req.Messages) {
+		checked.Messages = renderAttachments(req.Messages)
+	}
+	return s.checkRequestSafety(ctx, &checked)
+}
+
+// recordBestOfNAudit 为整个 best-of-N 请求记录一条聊天审计，响应为选中的候选
+func (s *chatServiceImpl) recordBestOfNAudit(ctx context.Context, req *BestOfNRequest, best *ChatResponse, candidates int) {
+	if s.safety == nil {
+		return
+	}
+	bodyJSON, _ := json.Marshal(map[string]any{
+		"system":    req.System,
+		"messages":  req.Messages,
+		"best_of_n": candidates,
+		"mode":      req.Mode,
+	})
+	respJSON, _ := json.Marshal(best)
+	resourceType := "chat"
+	if req.ConversationID > 0 {
+		resourceType = "conversation"
+	}
+	_ = s.safety.RecordAuditLog(ctx, &entity.AuditLog{
+		UserID:       req.UserID,
+		Action:       "llm.chat",
+		ResourceType: resourceType,
+		ResourceID:   req.ConversationID,
+		RequestJSON:  string(bodyJSON),
+		ResponseJSON: string(respJSON),
+		Status:       "ok",
+	})
+}
+
+// pickFanOutEndpoints 按优先级挑选最多 n 个当前可用（非冷却/熔断）的端点名称
+func (s *chatServiceImpl) pickFanOutEndpoints(ctx context.Context, n int) ([]string, error) {
+	status, err := s.manager.ListStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	available := make([]*EndpointStatus, 0, len(status))
+	for _, st := range status {
+		if st == nil || !st.Enabled || st.InCooldown || st.InCircuitOpen || st.Name == "" {
+			continue
+		}
+		available = append(available, st)
+	}
+	sort.SliceStable(available, func(i, j int) bool {
+		return available[i].Priority < available[j].Priority
+	})
+
+	seen := map[string]bool{}
+	names := make([]string, 0, n)
+	for _, st := range available {
+		if seen[st.Name] {
+			continue
+		}
+		seen[st.Name] = true
+		names = append(names, st.Name)
+		if len(names) >= n {
+			break
+		}
+	}
+	return names, nil
+}
+
+var judgeScoreRegex = regexp.MustCompile(`-?\d+(\.\d+)?`)
+
+// judgeScorer 使用裁判模型为候选打分（0-10），返回解析出的第一个数值
+func (s *chatServiceImpl) judgeScorer(judgePrompt string) CandidateScorer {
+	return func(ctx context.Context, req *ChatRequest, candidate *ChatResponse, all []*ChatResponse) (float64, error) {
+		var question string
+		for i := len(req.Messages) - 1; i >= 0; i-- {
+			if req.Messages[i].Role == "" || req.Messages[i].Role == "user" {
+				question = req.Messages[i].Content
+				break
+			}
+		}
+		prompt := fmt.Sprintf("[问题]\n%s\n\n[回答]\n%s\n\n请仅输出 0-10 之间的分数。", question, candidate.Content)
+		resp, _, _, _, _, _, err := s.manager.ChatForUser(ctx, req.UserID, &client.ChatRequest{
+			System:      judgePrompt,
+			Messages:    []client.ChatMessage{{Role: "user", Content: prompt}},
+			Temperature: 0,
+			MaxTokens:   16,
+		})
+		if err != nil {
+			return 0, err
+		}
+		return parseJudgeScore(resp.Content)
+	}
+}
+
+func parseJudgeScore(text string) (float64, error) {
+	m := judgeScoreRegex.FindString(text)
+	if m == "" {
+		return 0, errorx.New(errorx.Internal, "裁判模型未返回分数")
+	}
+	return strconv.ParseFloat(m, 64)
+}
+
+// consensusScorer 默认打分：与其他候选的平均词集相似度（Jaccard），越接近共识分数越高
+func consensusScorer(ctx context.Context, req *ChatRequest, candidate *ChatResponse, all []*ChatResponse) (float64, error) {
+	if len(all) <= 1 {
+		return 1, nil
+	}
+	self := wordSet(candidate.Content)
+	total := 0.0
+	for _, other := range all {
+		if other == candidate {
+			continue
+		}
+		total += jaccard(self, wordSet(other.Content))
+	}
+	return total / float64(len(all)-1), nil
+}
+
+func wordSet(text string) map[string]struct{} {
+	set := map[string]struct{}{}
+	for _, f := range strings.Fields(strings.ToLower(text)) {
+		set[f] = struct{}{}
+	}
+	// 中文等无空格文本按字符计
+	if len(set) <= 1 {
+		for _, r := range text {
+			set[string(r)] = struct{}{}
+		}
+	}
+	return set
+}
+
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	inter := 0
+	for k := range a {
+		if _, ok := b[k]; ok {
+			inter++
+		}
+	}
+	union := len(a) + len(b) - inter
+	if union == 0 {
+		return 0
+	}
+	return float64(inter) / float64(union)
+}
+
+func cloneMetadata(src map[string]interface{}) map[string]interface{} {
+	dst := make(map[string]interface{}, len(src)+1)
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"gochen/errorx"
+)
+
+// validateCallbackURL 提交时校验回调地址：须为 http(s)，且主机解析出的地址均为公网地址，
+// 防止借回调访问内网服务（SSRF）
+func validateCallbackURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errorx.New(errorx.Validation, "callback_url 必须为 http(s) 地址")
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return errorx.New(errorx.Validation, "callback_url 主机无法解析: "+u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !publicCallbackIP(addr.IP) {
+			return errorx.New(errorx.Validation, "callback_url 不能指向内网、回环或链路本地地址")
+		}
+	}
+	return nil
+}
+
+// publicCallbackIP 排除回环、私有、链路本地、组播与未指定地址
+func publicCallbackIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// newCallbackClient 回调使用的 HTTP 客户端：建立连接时再次校验目标地址，
+// 避免提交后 DNS 记录被改为内网地址；不使用环境代理，以免绕过校验
+func newCallbackClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicCallbackIP(ip) {
+				return errorx.New(errorx.Validation, "回调地址指向非公网地址: "+host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+	}
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+	"gochen/logging"
+	runtime "gochen/task"
+)
+
+// ChatJobRequest 异步聊天任务请求
+type ChatJobRequest struct {
+	ChatRequest
+	CallbackURL string `json:"callback_url,omitempty"` // 完成后以 POST JSON 回调（可选）
+}
+
+// ChatJobView 对外暴露的任务状态
+type ChatJobView struct {
+	ID         int64         `json:"id"`
+	UserID     int64         `json:"user_id"`
+	Status     string        `json:"status"`
+	Response   *ChatResponse `json:"response,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Attempts   int           `json:"attempts"`
+	CreatedAt  string        `json:"created_at"`
+	StartedAt  string        `json:"started_at,omitempty"`
+	FinishedAt string        `json:"finished_at,omitempty"`
+}
+
+// ChatJobService 异步聊天任务：提交、持久化、工作池执行、轮询与回调
+type ChatJobService interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	SubmitChat(ctx context.Context, req *ChatJobRequest) (int64, error)
+	GetJob(ctx context.Context, jobID int64) (*ChatJobView, error)
+}
+
+const (
+	// chatJobLease 任务租约时长，执行实例失联超过该时长后任务重新排队
+	chatJobLease = time.Minute
+	// chatJobHeartbeatEvery 租约续期间隔，需明显短于 chatJobLease
+	chatJobHeartbeatEvery = 20 * time.Second
+)
+
+type chatJobServiceImpl struct {
+	repo   repo.ChatJobRepo
+	chat   ChatService
+	logger logging.ILogger
+	super  *runtime.TaskSupervisor
+	http   *http.Client
+
+	workers   int
+	pollEvery time.Duration
+	wakeup    chan struct{}
+	slots     chan struct{}
+
+	lifecycleMu sync.Mutex
+	started     bool
+	stopped     bool
+	cancel      context.CancelFunc
+}
+
+func NewChatJobService(repo repo.ChatJobRepo, chat ChatService, logger logging.ILogger) ChatJobService {
+	workers := 4
+	return &chatJobServiceImpl{
+		repo:      repo,
+		chat:      chat,
+		logger:    logger,
+		super:     runtime.NewTaskSupervisor("gochen-llm.chat_jobs"),
+		http:      newCallbackClient(),
+		workers:   workers,
+		pollEvery: 2 * time.Second,
+		wakeup:    make(chan struct{}, 1),
+		slots:     make(chan struct{}, workers),
+	}
+}
+
+func (s *chatJobServiceImpl) Start(ctx context.Context) error {
+	if ctx == nil {
+		return errorx.New(errorx.InvalidInput, "ctx 不能为空")
+	}
+
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+
+	if s.stopped {
+		return errorx.New(errorx.Internal, "ChatJobService 已停止，无法再次启动")
+	}
+	if s.started {
+		return nil
+	}
+
+	// 将失联实例遗留（租约已过期）的 running 任务重新排队；其他实例仍在执行的任务持有有效租约，不受影响
+	if err := s.repo.RequeueExpired(ctx, time.Now()); err != nil {
+		return err
+	}
+
+	loopCtx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.started = true
+
+	s.super.Go(loopCtx, "dispatch_loop", s.dispatchLoop)
+	return nil
+}
+
+func (s *chatJobServiceImpl) Stop(ctx context.Context) error {
+	s.lifecycleMu.Lock()
+	if !s.started || s.stopped {
+		s.lifecycleMu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	cancel := s.cancel
+	s.lifecycleMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.super.Stop()
+	return nil
+}
+
+func (s *chatJobServiceImpl) SubmitChat(ctx context.Context, req *ChatJobRequest) (int64, error) {
+	if req == nil {
+		return 0, errorx.New(errorx.InvalidInput, "ChatJobRequest 不能为空")
+	}
+	if req.CallbackURL != "" {
+		if err := validateCallbackURL(ctx, req.CallbackURL); err != nil {
+			return 0, err
+		}
+	}
+
+	reqJSON, err := json.Marshal(req.ChatRequest)
+	if err != nil {
+		return 0, errorx.Wrap(err, errorx.InvalidInput, "序列化聊天请求失败")
+	}
+	job := &entity.ChatJob{
+		UserID:      req.UserID,
+		Status:      entity.ChatJobStatusPending,
+		RequestJSON: string(reqJSON),
+		CallbackURL: req.CallbackURL,
+	}
+	if err := s.repo.Create(ctx, job); err != nil {
+		return 0, err
+	}
+
+	select {
+	case s.wakeup <- struct{}{}:
+	default:
+	}
+	return job.ID, nil
+}
+
+func (s *chatJobServiceImpl) GetJob(ctx context.Context, jobID int64) (*ChatJobView, error) {
+	if jobID <= 0 {
+		return nil, errorx.New(errorx.InvalidInput, "jobID 无效")
+	}
+	job, err := s.repo.Get(ctx, jobID)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, errorx.New(errorx.NotFound, "任务不存在")
+	}
+	return toChatJobView(job), nil
+}
+
+// dispatchLoop 定时或在提交后被唤醒，按空闲工作槽位领取任务执行
+func (s *chatJobServiceImpl) dispatchLoop(ctx context.Context) {
+	ticker := time.NewTicker(s.pollEvery)
+	defer ticker.Stop()
+	for {
+		s.dispatchOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.requeueExpired(ctx)
+		case <-s.wakeup:
+		}
+	}
+}
+
+// requeueExpired 定期回收租约过期的任务，实例崩溃后其任务由存活实例接管
+func (s *chatJobServiceImpl) requeueExpired(ctx context.Context) {
+	if err := s.repo.RequeueExpired(ctx, time.Now()); err != nil && s.logger != nil {
+		s.logger.Warn(ctx, "[LLMChatJobs] 回收租约过期任务失败", logging.Error(err))
+	}
+}
+
+func (s *chatJobServiceImpl) dispatchOnce(ctx context.Context) {
+	free := s.workers - len(s.slots)
+	if free <= 0 {
+		return
+	}
+	jobs, err := s.repo.ClaimPending(ctx, free, chatJobLease)
+	if err != nil {
+		if s.logger != nil {
+			s.logger.Warn(ctx, "[LLMChatJobs] 领取任务失败", logging.Error(err))
+		}
+		return
+	}
+	for _, job := range jobs {
+		s.slots <- struct{}{}
+		j := job
+		s.super.Go(ctx, fmt.Sprintf("job_%d", j.ID), func(ctx context.Context) {
+			defer func() { <-s.slots }()
+			s.runJob(ctx, j)
+		})
+	}
+}
+
+func (s *chatJobServiceImpl) runJob(ctx context.Context, job *entity.ChatJob) {
+	hbCtx, stopHeartbeat := context.WithCancel(ctx)
+	s.super.Go(hbCtx, fmt.Sprintf("job_%d_heartbeat", job.ID), func(ctx context.Context) {
+		s.heartbeat(ctx, job.ID)
+	})
+
+	var req ChatRequest
+	var resp *ChatResponse
+	err := json.Unmarshal([]byte(job.RequestJSON), &req)
+	if err != nil {
+		err = errorx.Wrap(err, errorx.InvalidInput, "解析任务请求失败")
+	} else {
+		cctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+		resp, err = s.chat.Chat(cctx, &req)
+		cancel()
+	}
+	stopHeartbeat()
+	if ctx.Err() != nil {
+		// 服务停止导致中断，保持 running，租约过期后由存活实例或下次启动重新排队
+		return
+	}
+
+	now := time.Now()
+	job.FinishedAt = &now
+	job.LockedUntil = nil
+	if err != nil {
+		job.Status = entity.ChatJobStatusFailed
+		job.ErrorMessage = err.Error()
+	} else {
+		respJSON, _ := json.Marshal(resp)
+		job.Status = entity.ChatJobStatusSucceeded
+		job.ResponseJSON = string(respJSON)
+	}
+
+	if job.CallbackURL != "" {
+		if cbErr := s.sendCallback(ctx, job); cbErr != nil {
+			job.CallbackStatus = "failed"
+			if s.logger != nil {
+				s.logger.Warn(ctx, "[LLMChatJobs] 任务回调失败",
+					logging.String("callback_url", job.CallbackURL),
+					logging.Error(cbErr),
+				)
+			}
+		} else {
+			job.CallbackStatus = "sent"
+		}
+	}
+
+	if err := s.repo.Update(ctx, job); err != nil && s.logger != nil {
+		s.logger.Warn(ctx, "[LLMChatJobs] 更新任务状态失败", logging.Error(err))
+	}
+}
+
+// heartbeat 执行期间按 chatJobHeartbeatEvery 续期租约
+func (s *chatJobServiceImpl) heartbeat(ctx context.Context, jobID int64) {
+	ticker := time.NewTicker(chatJobHeartbeatEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.repo.Heartbeat(ctx, jobID, time.Now().Add(chatJobLease)); err != nil && s.logger != nil {
+				s.logger.Warn(ctx, "[LLMChatJobs] 续期任务租约失败", logging.Int("job_id", int(jobID)), logging.Error(err))
+			}
+		}
+	}
+}
+
+func (s *chatJobServiceImpl) sendCallback(ctx context.Context, job *entity.ChatJob) error {
+	payload, err := json.Marshal(toChatJobView(job))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.CallbackURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("callback status=%d", resp.StatusCode)
+	}
+	return nil
+}
+
+func toChatJobView(job *entity.ChatJob) *ChatJobView {
+	view := &ChatJobView{
+		ID:        job.ID,
+		UserID:    job.UserID,
+		Status:    job.Status,
+		Error:     job.ErrorMessage,
+		Attempts:  job.Attempts,
+		CreatedAt: job.CreatedAt.UTC().Format(time.RFC3339),
+	}
+	if job.StartedAt != nil {
+		view.StartedAt = job.StartedAt.UTC().Format(time.RFC3339)
+	}
+	if job.FinishedAt != nil {
+		view.FinishedAt = job.FinishedAt.UTC().Format(time.RFC3339)
+	}
+	if job.ResponseJSON != "" {
+		var resp ChatResponse
+		if err := json.Unmarshal([]byte(job.ResponseJSON), &resp); err == nil {
+			view.Response = &resp
+		}
+	}
+	return view
+}
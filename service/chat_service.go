@@ -15,29 +15,62 @@ import (
 	runtime "gochen/task"
 )
 
+// FallbackPromptName 兜底回复提示词模板名称前缀（可追加 .<category> 做分类覆盖）
+const FallbackPromptName = "llm.fallback"
+
 type ChatService interface {
 	Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error)
 	ChatWithPrompt(ctx context.Context, req *PromptChatRequest) (*ChatResponse, error)
+	// StreamChat 分片推送回复，推送完毕或 ctx 取消后关闭通道；失败时最后一个分片携带错误
 	StreamChat(ctx context.Context, req *ChatRequest) (<-chan *ChatChunk, error)
 	BatchChat(ctx context.Context, reqs []*ChatRequest) ([]*ChatResponse, error)
+	ChatBestOfN(ctx context.Context, req *BestOfNRequest) (*ChatResponse, error)
+	// AddContextProvider 注册检索增强上下文提供者（RAG）
+	AddContextProvider(p ContextProvider)
+	// SetTrimPolicy 设置某会话类型的历史裁剪策略，policy 为 nil 时恢复默认
+	SetTrimPolicy(conversationType string, policy *TrimPolicy)
+	// RunPlayground 渲染并（可选）执行提示词调试，调用记为测试流量
+	RunPlayground(ctx context.Context, req *PlaygroundRequest) (*PlaygroundResult, error)
 }
 
 type chatServiceImpl struct {
-	manager     ProviderManager
-	prompt      PromptService
-	safety      SafetyService
-	metricsRepo repo.MetricsRepo
-	costCalc    CostCalculator
+	manager       ProviderManager
+	prompt        PromptService
+	safety        SafetyService
+	metricsRepo   repo.MetricsRepo
+	costCalc      CostCalculator
+	eval          EvalService
+	conversations ConversationService
+	dedup         *requestDeduper
+
+	contextMu        sync.RWMutex
+	contextProviders []ContextProvider
+
+	trimMu       sync.RWMutex
+	trimPolicies map[string]*TrimPolicy
+	// trimSummaries summarize_oldest 的早期对话摘要缓存，见 summarizeDropped
+	trimSummaries        map[string]trimSummaryEntry
+	trimSummariesSweptAt time.Time
 }
 
-func NewChatService(manager ProviderManager, prompt PromptService, safety SafetyService, metrics repo.MetricsRepo, costCalc CostCalculator) ChatService {
-	return &chatServiceImpl{
-		manager:     manager,
-		prompt:      prompt,
-		safety:      safety,
-		metricsRepo: metrics,
-		costCalc:    costCalc,
-	}
+func NewChatService(manager ProviderManager, prompt PromptService, safety SafetyService, metrics repo.MetricsRepo, costCalc CostCalculator, eval EvalService, conversations ConversationService) ChatService {
+	svc := &chatServiceImpl{
+		manager:       manager,
+		prompt:        prompt,
+		safety:        safety,
+		metricsRepo:   metrics,
+		costCalc:      costCalc,
+		eval:          eval,
+		conversations: conversations,
+		dedup:         newRequestDeduper(defaultDedupWindow),
+		trimPolicies:  defaultTrimPolicies(),
+		trimSummaries: map[string]trimSummaryEntry{},
+	}
+	if conversations != nil {
+		// 会话摘要经由 ChatService 生成，复用安全检查、限流与指标记录
+		conversations.SetSummaryChat(svc)
+	}
+	return svc
 }
 
 func (s *chatServiceImpl) Chat(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
@@ -47,86 +80,271 @@ func (s *chatServiceImpl) Chat(ctx context.Context, req *ChatRequest) (*ChatResp
 	if s.manager == nil {
 		return nil, errorx.New(errorx.Internal, "LLM ProviderManager 未配置")
 	}
+	ctx, requestID := withRequestID(ctx)
+	if req.NoDedup || s.dedup == nil {
+		return s.chatOnce(ctx, req)
+	}
+	key, ok := dedupKey(ctx, req)
+	if !ok {
+		return s.chatOnce(ctx, req)
+	}
 
-	// 安全策略：输入验证与系统提示拼接
+	// 窗口期内相同请求复用进行中/刚完成的结果，避免重复调用 provider
+	start := time.Now()
+	resp, shared, err := s.dedup.Do(ctx, key, func(ctx context.Context) (*ChatResponse, error) {
+		return s.chatOnce(ctx, req)
+	})
+	if err != nil || !shared {
+		return resp, err
+	}
+	// Do 返回的是独立副本，可直接修改
+	if resp.Metadata == nil {
+		resp.Metadata = map[string]interface{}{}
+	}
+	resp.Metadata["deduplicated"] = true
+	resp.Metadata["request_id"] = requestID
+	s.recordCacheHit(ctx, req, resp, time.Since(start))
+	return resp, nil
+}
+
+// recordCacheHit 为复用结果的请求记录一条 cache_hit 指标，未实际调用 provider，token 与成本记为 0
+func (s *chatServiceImpl) recordCacheHit(ctx context.Context, req *ChatRequest, resp *ChatResponse, latency time.Duration) {
+	if s.metricsRepo == nil {
+		return
+	}
+	provider, _ := resp.Metadata["provider"].(string)
+	model, _ := resp.Metadata["model"].(string)
+	_ = s.metricsRepo.Save(ctx, &entity.Metrics{
+		Provider:       provider,
+		Model:          model,
+		RequestID:      requestIDFromContext(ctx),
+		UserID:         req.UserID,
+		ConversationID: req.ConversationID,
+		OrgID:          safetyScopeFrom(ctx).orgID,
+		LatencyMs:      int(latency.Milliseconds()),
+		Status:         "ok",
+		CacheHit:       true,
+		Degraded:       resp.Degraded,
+		IsTest:         isTestTraffic(req),
+		CreatedAt:      time.Now(),
+	})
+}
+
+func (s *chatServiceImpl) chatOnce(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+	// 附件文本先渲染进消息正文，后续的裁剪、安全检查与 token 估算均基于渲染结果
+	if hasAttachments(req.Messages) {
+		rendered := *req
+		rendered.Messages = renderAttachments(req.Messages)
+		req = &rendered
+	}
 	finalSystem := strings.TrimSpace(req.System)
-	if s.safety != nil {
-		if _, err := s.safety.CheckRateLimit(ctx, req.UserID); err != nil {
-			return nil, err
+	messages := req.Messages
+	var historySummary string
+	var settings *entity.ConversationSettings
+
+	// 会话绑定的提示词模板作为基础 System Prompt，请求自带的 System 追加在后；
+	// 历史消息按会话类型的 TrimPolicy 裁剪
+	if req.ConversationID > 0 && s.conversations != nil {
+		// 带用户的请求只能使用本人或被共享的会话
+		var conv *entity.Conversation
+		var err error
+		if req.UserID > 0 {
+			conv, err = s.conversations.GetConversationForUser(ctx, req.UserID, req.ConversationID)
+		} else {
+			conv, err = s.conversations.GetConversation(ctx, req.ConversationID)
 		}
-		if _, err := s.safety.ValidateInput(ctx, joinMessages(req.Messages)); err != nil {
+		if err != nil {
 			return nil, err
 		}
-		safetyPrompt, err := s.safety.BuildSystemPrompt(ctx)
+		if conv == nil {
+			return nil, errorx.New(errorx.NotFound, "会话不存在")
+		}
+		ctx = WithSafetyConversationType(ctx, conv.Type)
+		bound, err := s.conversationSystemPrompt(ctx, req, conv)
 		if err != nil {
 			return nil, err
 		}
-		if safetyPrompt != "" {
-			if finalSystem != "" {
-				finalSystem = safetyPrompt + "\n\n" + finalSystem
-			} else {
-				finalSystem = safetyPrompt
+		// 会话级设置：系统提示追加在模板之后，偏好端点仅在未显式指定端点时生效
+		settings = parseConversationSettings(conv.SettingsJSON)
+		finalSystem = joinNonEmpty(joinNonEmpty(bound, settings.SystemPrompt), finalSystem)
+		if settings.ModelTag != "" && pinnedEndpointFromContext(ctx) == "" {
+			ctx = WithPreferredEndpoint(ctx, settings.ModelTag)
+		}
+		messages, historySummary = s.trimHistory(ctx, req, conv)
+	}
+
+	// 安全策略：输入验证与系统提示拼接
+	if s.safety != nil {
+		ctx = WithSafetyUser(ctx, req.UserID)
+		// best-of-N 候选由父请求统一完成限流与输入检查，见 ChatBestOfN
+		if !isBestOfNCandidate(ctx) {
+			if err := s.checkRequestSafety(ctx, req); err != nil {
+				return nil, err
 			}
 		}
+		scanned, err := s.applyInputPII(ctx, req.UserID, messages)
+		if err != nil {
+			return nil, err
+		}
+		messages = scanned
+		composed, err := s.safety.ComposeSystemPrompt(ctx, finalSystem)
+		if err != nil {
+			return nil, err
+		}
+		finalSystem = composed
+	}
+	if historySummary != "" {
+		finalSystem = appendSystemPrompt(finalSystem, historySummary)
+	}
+
+	// 检索增强：注入外部 ContextProvider 提供的参考资料
+	if ragContext, sources := s.retrieveContext(ctx, req); ragContext != "" {
+		finalSystem = appendSystemPrompt(finalSystem, ragContext)
+		if req.Metadata == nil {
+			req.Metadata = map[string]interface{}{}
+		}
+		req.Metadata["context_sources"] = sources
+	}
+
+	// 输出语言约束：显式指定或按策略检测用户语言
+	targetLang := s.resolveOutputLanguage(ctx, req)
+	if targetLang != "" {
+		finalSystem = appendSystemPrompt(finalSystem, languageInstruction(targetLang))
 	}
 
 	maxTokens := req.MaxTokens
 	if maxTokens <= 0 {
 		maxTokens = 1024
 	}
+	// 每个 token 至少对应 1 个字符，按字符上限封顶 token 数不会截断合规输出
+	maxContentLength := s.maxContentLength(ctx)
+	if maxContentLength > 0 && maxTokens > maxContentLength {
+		maxTokens = maxContentLength
+	}
 	temperature := req.Temperature
+	if settings != nil && settings.Temperature != nil {
+		temperature = *settings.Temperature
+	}
 	if temperature < 0 {
 		temperature = 0.7
 	}
 
 	clientReq := &client.ChatRequest{
 		System:      finalSystem,
-		Messages:    convertMessages(req.Messages),
+		Messages:    convertMessages(messages),
 		Temperature: temperature,
 		MaxTokens:   maxTokens,
 	}
+	ctx, endpoints := withCallEndpointSink(ctx)
 	resp, provider, model, latencyMs, inPricePer1k, outPricePer1k, err := s.manager.ChatForUser(ctx, req.UserID, clientReq)
+	endpoint := endpoints.take()
 	if err != nil {
-		if s.metricsRepo != nil {
-			var abTestID int64
-			var abVariant string
-			if v, ok := req.Metadata["ab_test_id"].(int64); ok {
-				abTestID = v
-			}
-			if v, ok := req.Metadata["ab_variant"].(string); ok {
-				abVariant = v
-			}
-			_ = s.metricsRepo.Save(ctx, &entity.Metrics{
-				Provider:  provider,
-				Model:     model,
-				UserID:    req.UserID,
-				ABTestID:  abTestID,
-				ABVariant: abVariant,
-				Status:    "error",
-				ErrorType: err.Error(),
-				CreatedAt: time.Now(),
-			})
+		fallback := s.fallbackResponse(ctx, req)
+		s.recordCallError(ctx, req, endpoint, classifyCallError(err), err, fallback != nil)
+		if fallback != nil {
+			return fallback, nil
 		}
 		return nil, err
 	}
+	// retried 首次调用之外的额外调用次数：端点故障转移与下方的重新生成
+	retried := endpoint.Failovers
+
+	// 输出语言不一致时以更强的指令重试一次，重试失败则保留首次结果
+	if targetLang != "" && !languageMatches(resp.Content, targetLang) {
+		retryReq := *clientReq
+		retryReq.System = appendSystemPrompt(clientReq.System, strictLanguageInstruction(targetLang))
+		retryResp, p, m, l, in, out, rerr := s.manager.ChatForUser(ctx, req.UserID, &retryReq)
+		retryEndpoint := endpoints.take()
+		retried += 1 + retryEndpoint.Failovers
+		if rerr == nil {
+			resp, provider, model, inPricePer1k, outPricePer1k = retryResp, p, m, in, out
+			endpoint = retryEndpoint
+			latencyMs += l
+		}
+	}
 
 	content := resp.Content
+	var rating *ContentRating
 	if s.safety != nil {
-		filtered, err := s.safety.FilterContent(ctx, content)
+		rctx, sink := withContentRatingSink(ctx)
+		filtered, err := s.safety.FilterContent(rctx, content)
+		rating = sink.take()
+		// 适龄评分不达标且配置了重新生成时，以更严格的指令重试一次，重试失败则沿用首次的过滤结果
+		if rating != nil && rating.Regenerate {
+			retryReq := *clientReq
+			retryReq.System = appendSystemPrompt(clientReq.System, ageRatingRetryInstruction(rating))
+			retryResp, p, m, l, in, out, rerr := s.manager.ChatForUser(ctx, req.UserID, &retryReq)
+			retryEndpoint := endpoints.take()
+			retried += 1 + retryEndpoint.Failovers
+			if rerr == nil {
+				resp, provider, model, inPricePer1k, outPricePer1k = retryResp, p, m, in, out
+				endpoint = retryEndpoint
+				latencyMs += l
+				content = resp.Content
+				filtered, err = s.safety.FilterContent(rctx, content)
+				if r := sink.take(); r != nil {
+					rating = r
+				}
+			}
+		}
 		if err != nil && filtered == "" {
+			s.recordCallError(ctx, req, endpoint, entity.MetricsErrorSafetyBlocked, err, false)
 			return nil, err
 		}
 		if filtered != "" {
 			content = filtered
 		}
 	}
+	content, err = s.postProcess(ctx, content)
+	if err != nil {
+		return nil, err
+	}
+	originalLength := len([]rune(content))
+	content, truncated := truncateRunes(content, maxContentLength)
 
 	result := &ChatResponse{
 		Content:  content,
-		Usage:    estimateUsage(finalSystem, req.Messages, content),
+		Usage:    providerUsage(resp.Usage),
 		Metadata: req.Metadata,
 	}
+	if result.Usage == nil {
+		result.Usage = estimateUsage(finalSystem, messages, content)
+	}
+	if result.Metadata == nil {
+		result.Metadata = map[string]interface{}{}
+	}
+	// 调用方将响应元数据存入助手消息后，消息反馈可据此关联到模型
+	result.Metadata["provider"] = provider
+	if id := requestIDFromContext(ctx); id != "" {
+		result.Metadata["request_id"] = id
+	}
+	result.Metadata["model"] = model
+	if rating != nil {
+		result.Metadata["content_rating"] = rating
+	}
+	if truncated {
+		result.FinishReason = "length"
+		result.Metadata["truncated"] = true
+		result.Metadata["original_length"] = originalLength
+		if s.safety != nil {
+			detail, _ := json.Marshal(map[string]any{
+				"max_content_length": maxContentLength,
+				"original_length":    originalLength,
+			})
+			_ = s.safety.RecordAuditLog(ctx, &entity.AuditLog{
+				UserID:       req.UserID,
+				Action:       "llm.output_truncated",
+				ResourceType: "chat",
+				RequestJSON:  string(detail),
+				Status:       "truncated",
+			})
+		}
+	}
 
+	cost := 0.0
+	if s.costCalc != nil && result.Usage != nil {
+		cost = s.costCalc.EstimateCost(ctx, provider, model, result.Usage, inPricePer1k, outPricePer1k)
+	}
 	if s.metricsRepo != nil && result.Usage != nil {
 		var abTestID int64
 		var abVariant string
@@ -140,38 +358,77 @@ func (s *chatServiceImpl) Chat(ctx context.Context, req *ChatRequest) (*ChatResp
 		if v, ok := req.Metadata["prompt_template_id"].(int64); ok {
 			promptTemplateID = v
 		}
-		cost := 0.0
-		if s.costCalc != nil {
-			cost = s.costCalc.EstimateCost(provider, model, result.Usage.RequestTokens, result.Usage.ResponseTokens, inPricePer1k, outPricePer1k)
-		}
 		_ = s.metricsRepo.Save(ctx, &entity.Metrics{
-			Provider:       provider,
-			Model:          model,
-			UserID:         req.UserID,
-			ABTestID:       abTestID,
-			ABVariant:      abVariant,
-			PromptTemplate: promptTemplateID,
-			RequestTokens:  result.Usage.RequestTokens,
-			ResponseTokens: result.Usage.ResponseTokens,
-			TotalTokens:    result.Usage.TotalTokens,
-			LatencyMs:      int(latencyMs),
-			Status:         "ok",
-			ErrorType:      "",
-			CreatedAt:      time.Now(),
-			CostUSD:        cost,
+			Provider:        provider,
+			Model:           model,
+			Endpoint:        endpoint.Name,
+			RequestID:       requestIDFromContext(ctx),
+			UserID:          req.UserID,
+			ConversationID:  req.ConversationID,
+			OrgID:           safetyScopeFrom(ctx).orgID,
+			ABTestID:        abTestID,
+			ABVariant:       abVariant,
+			PromptTemplate:  promptTemplateID,
+			RequestTokens:   result.Usage.RequestTokens,
+			ResponseTokens:  result.Usage.ResponseTokens,
+			TotalTokens:     result.Usage.TotalTokens,
+			CachedTokens:    result.Usage.CachedTokens,
+			LatencyMs:       int(latencyMs),
+			Status:          "ok",
+			ErrorType:       "",
+			CreatedAt:       time.Now(),
+			CostUSD:         cost,
+			IsTest:          isTestTraffic(req),
+			RetriedAttempts: retried,
+			AgeScore:        ratingScore(rating, true),
+			ToxicityScore:   ratingScore(rating, false),
 		})
 	}
 
-	if s.safety != nil {
+	if s.safety != nil && result.Usage != nil {
+		_ = s.safety.RecordTokenUsage(ctx, req.UserID, result.Usage.TotalTokens)
+	}
+	if req.ConversationID > 0 && s.conversations != nil && result.Usage != nil {
+		_ = s.conversations.RecordUsage(ctx, req.ConversationID, result.Usage, cost)
+	}
+
+	if s.eval != nil {
+		evalReq := &EvalRequest{
+			UserID:   req.UserID,
+			System:   finalSystem,
+			Messages: messages,
+			Response: content,
+			Provider: provider,
+			Model:    model,
+		}
+		if v, ok := req.Metadata["ab_test_id"].(int64); ok {
+			evalReq.ABTestID = v
+		}
+		if v, ok := req.Metadata["ab_variant"].(string); ok {
+			evalReq.ABVariant = v
+		}
+		if v, ok := req.Metadata["prompt_template_id"].(int64); ok {
+			evalReq.PromptTemplateID = v
+		}
+		s.eval.MaybeEvaluate(ctx, evalReq)
+	}
+
+	if s.safety != nil && !isBestOfNCandidate(ctx) {
 		body := map[string]any{
 			"system":   finalSystem,
-			"messages": req.Messages,
+			"messages": messages,
 		}
 		bodyJSON, _ := json.Marshal(body)
 		respJSON, _ := json.Marshal(result)
+		resourceType := "chat"
+		if req.ConversationID > 0 {
+			resourceType = "conversation"
+		}
 		_ = s.safety.RecordAuditLog(ctx, &entity.AuditLog{
 			UserID:       req.UserID,
 			Action:       "llm.chat",
+			ResourceType: resourceType,
+			ResourceID:   req.ConversationID,
 			RequestJSON:  string(bodyJSON),
 			ResponseJSON: string(respJSON),
 			Status:       "ok",
@@ -181,6 +438,15 @@ func (s *chatServiceImpl) Chat(ctx context.Context, req *ChatRequest) (*ChatResp
 	return result, nil
 }
 
+// checkRequestSafety 请求级安全检查：限流（消耗一次请求额度）与输入内容验证；ctx 需已带 WithSafetyUser
+func (s *chatServiceImpl) checkRequestSafety(ctx context.Context, req *ChatRequest) error {
+	if _, err := s.safety.CheckRateLimit(ctx, req.UserID); err != nil {
+		return err
+	}
+	_, err := s.safety.ValidateInput(ctx, joinMessages(req.Messages))
+	return err
+}
+
 func (s *chatServiceImpl) ChatWithPrompt(ctx context.Context, req *PromptChatRequest) (*ChatResponse, error) {
 	if req == nil {
 		return nil, errorx.New(errorx.InvalidInput, "PromptChatRequest 不能为空")
@@ -189,6 +455,12 @@ func (s *chatServiceImpl) ChatWithPrompt(ctx context.Context, req *PromptChatReq
 		return nil, errorx.New(errorx.Internal, "PromptService 未配置")
 	}
 
+	locale := req.Locale
+	if locale == "" {
+		locale = req.Language
+	}
+	ctx = WithPromptLocale(ctx, locale)
+
 	tmpl, err := s.prompt.GetPrompt(ctx, req.PromptName, req.PromptScope, req.PromptScopeID)
 	if err != nil {
 		return nil, err
@@ -196,6 +468,11 @@ func (s *chatServiceImpl) ChatWithPrompt(ctx context.Context, req *PromptChatReq
 	if tmpl == nil {
 		return nil, errorx.New(errorx.NotFound, "提示词不存在")
 	}
+	if req.PromptVersion > 0 {
+		if tmpl, err = s.prompt.GetPromptAtVersion(ctx, tmpl.ID, req.PromptVersion); err != nil {
+			return nil, err
+		}
+	}
 
 	// A/B 分配（可选）
 	var abVariant string
@@ -211,10 +488,27 @@ func (s *chatServiceImpl) ChatWithPrompt(ctx context.Context, req *PromptChatReq
 		return nil, err
 	}
 
+	// 请求未指定的参数（温度为空、max_tokens 为零值）采用模板推荐值
+	var temperature float32
+	maxTokens := req.MaxTokens
+	params := promptModelParams(tmpl)
+	switch {
+	case req.Temperature != nil:
+		temperature = *req.Temperature
+	case params.Temperature != nil:
+		temperature = *params.Temperature
+	}
+	if maxTokens == 0 && params.MaxTokens > 0 {
+		maxTokens = params.MaxTokens
+	}
+
 	metadata := req.Metadata
 	if metadata == nil {
 		metadata = map[string]interface{}{}
 	}
+	if _, ok := metadata["category"]; !ok && tmpl.Category != "" {
+		metadata["category"] = tmpl.Category
+	}
 	if abVariant != "" {
 		metadata["ab_test_id"] = req.ABTestID
 		metadata["ab_variant"] = abVariant
@@ -225,9 +519,10 @@ func (s *chatServiceImpl) ChatWithPrompt(ctx context.Context, req *PromptChatReq
 		UserID:      req.UserID,
 		System:      systemPrompt,
 		Messages:    req.Messages,
-		Temperature: req.Temperature,
-		MaxTokens:   req.MaxTokens,
+		Temperature: temperature,
+		MaxTokens:   maxTokens,
 		Metadata:    metadata,
+		Language:    req.Language,
 	})
 	if err != nil {
 		return nil, err
@@ -254,19 +549,27 @@ func (s *chatServiceImpl) StreamChat(ctx context.Context, req *ChatRequest) (<-c
 	super.Go(ctx, "stream", func(ctx context.Context) {
 		defer close(ch)
 
+		send := func(chunk *ChatChunk) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case ch <- chunk:
+				return true
+			}
+		}
 		resp, err := s.Chat(ctx, req)
 		if err != nil {
+			send(&ChatChunk{Done: true, Err: err})
 			return
 		}
 
 		segments := chunkContent(resp.Content, 200)
 		for _, seg := range segments {
-			select {
-			case <-ctx.Done():
+			if !send(&ChatChunk{Content: seg}) {
 				return
-			case ch <- &ChatChunk{Content: seg}:
 			}
 		}
+		send(&ChatChunk{Done: true, FinishReason: resp.FinishReason, Usage: resp.Usage, Metadata: resp.Metadata})
 	})
 	return ch, nil
 }
@@ -321,6 +624,110 @@ func (s *chatServiceImpl) BatchChat(ctx context.Context, reqs []*ChatRequest) ([
 	return result, nil
 }
 
+// conversationSystemPrompt 解析会话绑定的提示词模板，以会话元数据为变量渲染。
+// 会话未绑定模板时返回空字符串；渲染成功时在 Metadata 中记录 prompt_template_id。
+func (s *chatServiceImpl) conversationSystemPrompt(ctx context.Context, req *ChatRequest, conv *entity.Conversation) (string, error) {
+	if s.prompt == nil {
+		return "", nil
+	}
+	if conv.PromptTemplateID == nil || *conv.PromptTemplateID <= 0 {
+		return "", nil
+	}
+	tmpl, err := s.prompt.GetPromptByID(ctx, *conv.PromptTemplateID)
+	if err != nil {
+		return "", err
+	}
+	if tmpl == nil || !tmpl.Enabled {
+		return "", nil
+	}
+
+	vars := map[string]any{}
+	if strings.TrimSpace(conv.MetadataJSON) != "" {
+		_ = json.Unmarshal([]byte(conv.MetadataJSON), &vars)
+	}
+	vars["conversation_id"] = conv.ID
+	vars["conversation_title"] = conv.Title
+	vars["conversation_type"] = conv.Type
+
+	rendered, err := s.prompt.RenderPrompt(ctx, tmpl, vars)
+	if err != nil {
+		return "", err
+	}
+	if req.Metadata == nil {
+		req.Metadata = map[string]interface{}{}
+	}
+	if _, ok := req.Metadata["prompt_template_id"]; !ok {
+		req.Metadata["prompt_template_id"] = tmpl.ID
+	}
+	return strings.TrimSpace(rendered), nil
+}
+
+// fallbackResponse 在所有端点失败时返回兜底回复（来自提示词模板），未配置则返回 nil。
+// 优先查找 llm.fallback.<category>，其次 llm.fallback；按用户作用域覆盖全局。
+func (s *chatServiceImpl) fallbackResponse(ctx context.Context, req *ChatRequest) *ChatResponse {
+	if s.prompt == nil {
+		return nil
+	}
+	names := []string{FallbackPromptName}
+	if category, ok := req.Metadata["category"].(string); ok && category != "" {
+		names = append([]string{FallbackPromptName + "." + category}, names...)
+	}
+
+	ctx = WithPromptLocale(ctx, req.Language)
+	for _, name := range names {
+		tmpl, err := s.prompt.GetPrompt(ctx, name, entity.PromptScopeUser, req.UserID)
+		if err != nil || tmpl == nil {
+			continue
+		}
+		content, err := s.prompt.RenderPrompt(ctx, tmpl, req.Metadata)
+		if err != nil || strings.TrimSpace(content) == "" {
+			continue
+		}
+		metadata := cloneMetadata(req.Metadata)
+		metadata["fallback_template_id"] = tmpl.ID
+		if id := requestIDFromContext(ctx); id != "" {
+			metadata["request_id"] = id
+		}
+		return &ChatResponse{
+			Content:      content,
+			FinishReason: "fallback",
+			Degraded:     true,
+			Metadata:     metadata,
+		}
+	}
+	return nil
+}
+
+// maxContentLength 返回当前安全策略的输出字符上限（0 表示不限制）
+func (s *chatServiceImpl) maxContentLength(ctx context.Context) int {
+	if s.safety == nil {
+		return 0
+	}
+	policy, err := s.safety.GetActivePolicy(ctx)
+	if err != nil || policy == nil || !policy.Enabled || policy.MaxContentLength < 0 {
+		return 0
+	}
+	return policy.MaxContentLength
+}
+
+// postProcess 按当前安全策略执行输出后处理（去围栏、去免责声明等）
+func (s *chatServiceImpl) postProcess(ctx context.Context, content string) (string, error) {
+	if s.safety == nil {
+		return content, nil
+	}
+	policy, err := s.safety.GetActivePolicy(ctx)
+	if err != nil {
+		return content, err
+	}
+	return buildPostProcessPipeline(policy).Run(ctx, content)
+}
+
+// isTestTraffic 请求是否为测试流量（Metadata.test_traffic=true，如 Playground）
+func isTestTraffic(req *ChatRequest) bool {
+	v, _ := req.Metadata["test_traffic"].(bool)
+	return v
+}
+
 func convertMessages(msgs []Message) []client.ChatMessage {
 	result := make([]client.ChatMessage, 0, len(msgs))
 	for _, m := range msgs {
@@ -331,11 +738,119 @@ func convertMessages(msgs []Message) []client.ChatMessage {
 		result = append(result, client.ChatMessage{
 			Role:    role,
 			Content: m.Content,
+			Images:  attachmentImages(m.Attachments),
 		})
 	}
 	return result
 }
 
+// recordCallError 记录失败调用：指标中只保存错误分类，原始错误信息（密钥脱敏、截断）记入审计日志；
+// 所有端点均失败时 endpoint 为首个失败的端点
+func (s *chatServiceImpl) recordCallError(ctx context.Context, req *ChatRequest, endpoint *callEndpoint, errorType string, err error, degraded bool) {
+	if s.metricsRepo != nil {
+		var abTestID int64
+		var abVariant string
+		if v, ok := req.Metadata["ab_test_id"].(int64); ok {
+			abTestID = v
+		}
+		if v, ok := req.Metadata["ab_variant"].(string); ok {
+			abVariant = v
+		}
+		_ = s.metricsRepo.Save(ctx, &entity.Metrics{
+			Provider:        endpoint.Provider,
+			Model:           endpoint.Model,
+			Endpoint:        endpoint.Name,
+			RequestID:       requestIDFromContext(ctx),
+			UserID:          req.UserID,
+			ConversationID:  req.ConversationID,
+			OrgID:           safetyScopeFrom(ctx).orgID,
+			ABTestID:        abTestID,
+			ABVariant:       abVariant,
+			Status:          "error",
+			ErrorType:       errorType,
+			Degraded:        degraded,
+			RetriedAttempts: endpoint.Failovers,
+			IsTest:          isTestTraffic(req),
+			CreatedAt:       time.Now(),
+		})
+	}
+	if s.safety != nil {
+		detail, _ := json.Marshal(map[string]any{
+			"provider":   endpoint.Provider,
+			"model":      endpoint.Model,
+			"endpoint":   endpoint.Name,
+			"error_type": errorType,
+		})
+		message, _ := truncateRunes(maskSecrets(err.Error()), maxCallErrorRunes)
+		resourceType := "chat"
+		if req.ConversationID > 0 {
+			resourceType = "conversation"
+		}
+		_ = s.safety.RecordAuditLog(ctx, &entity.AuditLog{
+			UserID:       req.UserID,
+			Action:       "llm.chat",
+			ResourceType: resourceType,
+			ResourceID:   req.ConversationID,
+			RequestJSON:  string(detail),
+			Status:       "error",
+			ErrorMessage: message,
+		})
+	}
+}
+
+// applyInputPII 按策略 PII 配置处理输入消息：block 拒绝请求，mask 替换命中内容，命中情况记入审计日志（不含原文）
+func (s *chatServiceImpl) applyInputPII(ctx context.Context, userID int64, messages []Message) ([]Message, error) {
+	var out []Message
+	var hits []PIIHit
+	blocked := false
+	for i, m := range messages {
+		res, err := s.safety.ScanPII(ctx, m.Content)
+		if err != nil {
+			return nil, err
+		}
+		if res == nil {
+			return messages, nil
+		}
+		if len(res.Hits) == 0 {
+			continue
+		}
+		hits = append(hits, res.Hits...)
+		blocked = blocked || res.Blocked
+		if res.Content != m.Content {
+			if out == nil {
+				out = append([]Message(nil), messages...)
+			}
+			out[i].Content = res.Content
+		}
+	}
+	if len(hits) == 0 {
+		return messages, nil
+	}
+
+	status := "logged"
+	switch {
+	case blocked:
+		status = "blocked"
+	case out != nil:
+		status = "masked"
+	}
+	detail, _ := json.Marshal(map[string]any{"hits": hits})
+	_ = s.safety.RecordAuditLog(ctx, &entity.AuditLog{
+		UserID:       userID,
+		Action:       "llm.pii_detected",
+		ResourceType: "chat",
+		RequestJSON:  string(detail),
+		Status:       status,
+	})
+	if blocked {
+		return nil, errorx.New(errorx.Validation, "内容包含敏感信息")
+	}
+	if out == nil {
+		return messages, nil
+	}
+	return out, nil
+}
+
 func joinMessages(msgs []Message) string {
 	var sb strings.Builder
 	for _, m := range msgs {
@@ -349,6 +864,23 @@ func joinMessages(msgs []Message) string {
 	return sb.String()
 }
 
+// providerUsage 转换 provider 返回的用量，未返回或全为 0 时返回 nil
+func providerUsage(u *client.Usage) *TokenUsage {
+	if u == nil || u.InputTokens+u.OutputTokens <= 0 {
+		return nil
+	}
+	cached := u.CachedInputTokens
+	if cached > u.InputTokens {
+		cached = u.InputTokens
+	}
+	return &TokenUsage{
+		RequestTokens:  u.InputTokens,
+		ResponseTokens: u.OutputTokens,
+		TotalTokens:    u.InputTokens + u.OutputTokens,
+		CachedTokens:   cached,
+	}
+}
+
 // estimateUsage 基于字符数的粗略 token 估算，避免缺少 provider usage 时完全空白。
 func estimateUsage(system string, msgs []Message, content string) *TokenUsage {
 	countRunes := func(s string) int {
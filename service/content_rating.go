@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"gochen-llm/client"
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+const (
+	// defaultAgeRatingAudience 未配置受众时的默认描述
+	defaultAgeRatingAudience = "6-12 岁儿童"
+	// defaultAgeRatingMinScore 适龄分数低于该值判定为不适宜
+	defaultAgeRatingMinScore = 0.7
+	// defaultAgeRatingMaxToxicity 毒性分数高于该值判定为不适宜
+	defaultAgeRatingMaxToxicity = 0.3
+)
+
+const ageRatingPrompt = `你是儿童内容审核员。目标读者：%s。请评估用户给出的文本：
+- age_appropriateness：对目标读者的适龄程度（0 到 1，1 表示完全适合）
+- toxicity：暴力、恐怖、粗俗、歧视等有害内容的程度（0 到 1，0 表示完全没有）
+仅输出一个 JSON 对象，例如：{"age_appropriateness": 0.95, "toxicity": 0.02, "comment": "简短理由"}`
+
+// ageRatingConfig age_rating 检查器配置
+type ageRatingConfig struct {
+	Audience    string   `json:"audience"`     // 目标读者描述，默认 6-12 岁儿童
+	Endpoint    string   `json:"endpoint"`     // 打分使用的端点名称，为空按常规路由
+	MinScore    *float64 `json:"min_score"`    // 适龄分数下限，默认 0.7
+	MaxToxicity *float64 `json:"max_toxicity"` // 毒性分数上限，默认 0.3
+	Regenerate  bool     `json:"regenerate"`   // 不达标时由聊天流程以更严格的指令重新生成一次，仍不达标再按动作处理
+	MaxChars    int      `json:"max_chars"`    // 送审文本字符上限
+}
+
+func (c ageRatingConfig) thresholds() (minScore, maxToxicity float64) {
+	minScore, maxToxicity = defaultAgeRatingMinScore, defaultAgeRatingMaxToxicity
+	if c.MinScore != nil {
+		minScore = *c.MinScore
+	}
+	if c.MaxToxicity != nil {
+		maxToxicity = *c.MaxToxicity
+	}
+	return minScore, maxToxicity
+}
+
+// ContentRating 输出内容的适龄与毒性评分
+type ContentRating struct {
+	AgeAppropriateness float64 `json:"age_appropriateness"`
+	Toxicity           float64 `json:"toxicity"`
+	Passed             bool    `json:"passed"`
+	Audience           string  `json:"audience,omitempty"`
+	Comment            string  `json:"comment,omitempty"`
+	// Regenerate 未达标且配置要求重新生成
+	Regenerate bool `json:"-"`
+}
+
+type contentRatingKey struct{}
+
+// contentRatingSink 收集本次请求中 age_rating 检查器的评分，供聊天流程重新生成与写入指标
+type contentRatingSink struct {
+	mu     sync.Mutex
+	rating *ContentRating
+}
+
+func (s *contentRatingSink) set(r *ContentRating) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rating = r
+}
+
+// take 取出并清空评分，重新生成后再次检查时不会读到旧结果
+func (s *contentRatingSink) take() *ContentRating {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := s.rating
+	s.rating = nil
+	return r
+}
+
+// withContentRatingSink 在 ctx 中挂载评分收集器
+func withContentRatingSink(ctx context.Context) (context.Context, *contentRatingSink) {
+	sink := &contentRatingSink{}
+	return context.WithValue(ctx, contentRatingKey{}, sink), sink
+}
+
+// ageRatingChecker 使用裁判模型对输出评估适龄程度与毒性（面向儿童故事等场景），
+// 低于阈值时按动作拒绝；评分写入 ctx 中的收集器
+type ageRatingChecker struct {
+	manager ProviderManager
+}
+
+func (ageRatingChecker) Name() string         { return "age_rating" }
+func (ageRatingChecker) Directions() []string { return []string{entity.SafetyDirectionOutput} }
+
+func (ageRatingChecker) parse(config json.RawMessage) (ageRatingConfig, error) {
+	var cfg ageRatingConfig
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &cfg); err != nil {
+			return cfg, errorx.Wrap(err, errorx.Validation, "age_rating 检查器配置无效")
+		}
+	}
+	minScore, maxToxicity := cfg.thresholds()
+	if minScore < 0 || minScore > 1 || maxToxicity < 0 || maxToxicity > 1 {
+		return cfg, errorx.New(errorx.Validation, "age_rating 阈值需在 0-1 之间")
+	}
+	return cfg, nil
+}
+
+func (c ageRatingChecker) ValidateConfig(config json.RawMessage) error {
+	_, err := c.parse(config)
+	return err
+}
+
+func (c ageRatingChecker) Check(ctx context.Context, in *SafetyCheckInput) (*SafetyCheckOutput, error) {
+	cfg, err := c.parse(in.Config)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimSpace(in.Text)
+	if text == "" {
+		return &SafetyCheckOutput{}, nil
+	}
+	rating, err := c.rate(ctx, cfg, text)
+	if err != nil {
+		return nil, err
+	}
+	if sink, ok := ctx.Value(contentRatingKey{}).(*contentRatingSink); ok {
+		sink.set(rating)
+	}
+	if rating.Passed {
+		return &SafetyCheckOutput{}, nil
+	}
+	minScore, maxToxicity := cfg.thresholds()
+	return &SafetyCheckOutput{Findings: []*SafetyFinding{{
+		Category: "age_inappropriate",
+		Severity: entity.SafetySeverityHigh,
+		Action:   entity.SafetyActionBlock,
+		Message: fmt.Sprintf("age_appropriateness=%.2f(min %.2f) toxicity=%.2f(max %.2f)",
+			rating.AgeAppropriateness, minScore, rating.Toxicity, maxToxicity),
+	}}}, nil
+}
+
+// rate 调用裁判模型打分，调用不计入用户限流
+func (c ageRatingChecker) rate(ctx context.Context, cfg ageRatingConfig, text string) (*ContentRating, error) {
+	if c.manager == nil {
+		return nil, errorx.New(errorx.Internal, "LLM ProviderManager 未配置")
+	}
+	maxChars := cfg.MaxChars
+	if maxChars <= 0 {
+		maxChars = defaultModerationMaxChars
+	}
+	text, _ = truncateRunes(text, maxChars)
+	audience := cfg.Audience
+	if audience == "" {
+		audience = defaultAgeRatingAudience
+	}
+	mctx := ctx
+	if cfg.Endpoint != "" {
+		mctx = WithPinnedEndpoint(ctx, cfg.Endpoint)
+	}
+	resp, _, _, _, _, _, err := c.manager.ChatForUser(mctx, 0, &client.ChatRequest{
+		System:      fmt.Sprintf(ageRatingPrompt, audience),
+		Messages:    []client.ChatMessage{{Role: "user", Content: text}},
+		Temperature: 0,
+		MaxTokens:   200,
+	})
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseEvalScores(resp.Content, []string{"age_appropriateness", "toxicity"})
+	if err != nil {
+		return nil, err
+	}
+	age, ok := parsed.Scores["age_appropriateness"]
+	if !ok {
+		return nil, errorx.New(errorx.Internal, "裁判模型未返回适龄分数")
+	}
+	minScore, maxToxicity := cfg.thresholds()
+	rating := &ContentRating{
+		AgeAppropriateness: age,
+		Toxicity:           parsed.Scores["toxicity"],
+		Audience:           audience,
+		Comment:            parsed.Comment,
+	}
+	rating.Passed = rating.AgeAppropriateness >= minScore && rating.Toxicity <= maxToxicity
+	rating.Regenerate = !rating.Passed && cfg.Regenerate
+	return rating, nil
+}
+
+// ratingScore 返回写入指标的适龄（age=true）或毒性分数，未评分时为 nil
+func ratingScore(rating *ContentRating, age bool) *float64 {
+	if rating == nil {
+		return nil
+	}
+	v := rating.Toxicity
+	if age {
+		v = rating.AgeAppropriateness
+	}
+	return &v
+}
+
+// ageRatingRetryInstruction 重新生成时追加的系统指令
+func ageRatingRetryInstruction(rating *ContentRating) string {
+	return fmt.Sprintf("上一版内容被判定为不适合%s阅读。请重新创作：避免暴力、恐怖、粗俗或不适龄的情节与用词，语言温和积极。", rating.Audience)
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// maxInjectedContextRunes 注入到 System Prompt 的检索上下文总字符上限
+const maxInjectedContextRunes = 4000
+
+// ContextQuery 检索上下文的查询参数
+type ContextQuery struct {
+	UserID         int64                  `json:"user_id"`
+	ConversationID int64                  `json:"conversation_id,omitempty"`
+	Query          string                 `json:"query"`
+	Metadata       map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// ContextSnippet 检索得到的上下文片段
+type ContextSnippet struct {
+	Source  string  `json:"source"`  // 来源标识，如文档 ID/URL
+	Content string  `json:"content"` // 片段内容
+	Score   float64 `json:"score"`   // 相关度，越大越相关
+}
+
+// ContextProvider 检索增强（RAG）扩展点：根据用户问题返回相关上下文片段。
+// ChatService 在调用模型前依次调用已注册的 provider，并将结果注入 System Prompt。
+type ContextProvider interface {
+	Name() string
+	Retrieve(ctx context.Context, query *ContextQuery) ([]*ContextSnippet, error)
+}
+
+func (s *chatServiceImpl) AddContextProvider(p ContextProvider) {
+	if p == nil {
+		return
+	}
+	s.contextMu.Lock()
+	defer s.contextMu.Unlock()
+	s.contextProviders = append(s.contextProviders, p)
+}
+
+// retrieveContext 汇总各 provider 的检索结果，按相关度排序并截断为可注入的文本。
+// 单个 provider 失败不影响主流程。
+func (s *chatServiceImpl) retrieveContext(ctx context.Context, req *ChatRequest) (string, []string) {
+	s.contextMu.RLock()
+	providers := append([]ContextProvider(nil), s.contextProviders...)
+	s.contextMu.RUnlock()
+	if len(providers) == 0 {
+		return "", nil
+	}
+
+	var query string
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		if req.Messages[i].Role == "" || req.Messages[i].Role == "user" {
+			query = strings.TrimSpace(req.Messages[i].Content)
+			break
+		}
+	}
+	if query == "" {
+		return "", nil
+	}
+
+	q := &ContextQuery{
+		UserID:         req.UserID,
+		ConversationID: req.ConversationID,
+		Query:          query,
+		Metadata:       req.Metadata,
+	}
+	var snippets []*ContextSnippet
+	for _, p := range providers {
+		list, err := p.Retrieve(ctx, q)
+		if err != nil {
+			continue
+		}
+		for _, sn := range list {
+			if sn != nil && strings.TrimSpace(sn.Content) != "" {
+				snippets = append(snippets, sn)
+			}
+		}
+	}
+	if len(snippets) == 0 {
+		return "", nil
+	}
+	sort.SliceStable(snippets, func(i, j int) bool {
+		return snippets[i].Score > snippets[j].Score
+	})
+
+	var sb strings.Builder
+	sb.WriteString("[参考资料]\n以下内容由检索系统提供，仅在与问题相关时使用：\n")
+	used := 0
+	sources := make([]string, 0, len(snippets))
+	for i, sn := range snippets {
+		content := strings.TrimSpace(sn.Content)
+		n := len([]rune(content))
+		if used+n > maxInjectedContextRunes {
+			if used > 0 {
+				break
+			}
+			content = string([]rune(content)[:maxInjectedContextRunes])
+			n = maxInjectedContextRunes
+		}
+		used += n
+		if sn.Source != "" {
+			sb.WriteString(fmt.Sprintf("%d. (%s) %s\n", i+1, sn.Source, content))
+		} else {
+			sb.WriteString(fmt.Sprintf("%d. %s\n", i+1, content))
+		}
+		sources = append(sources, sn.Source)
+	}
+	return strings.TrimSpace(sb.String()), sources
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+// conversationAccessOwner 仅会话归属用户可执行的操作（归档、删除、分享链接、管理 manager）
+const conversationAccessOwner = entity.ConversationRoleOwner
+
+// conversationAccessRank 访问级别的强弱，高级别包含低级别的权限
+func conversationAccessRank(role string) int {
+	switch role {
+	case entity.ConversationAccessViewer:
+		return 1
+	case entity.ConversationAccessEditor:
+		return 2
+	case entity.ConversationAccessManager:
+		return 3
+	case conversationAccessOwner:
+		return 4
+	default:
+		return 0
+	}
+}
+
+// authorize 校验用户对会话至少具有 need 级别的权限并返回会话；
+// 会话不存在与无权访问均返回 NotFound，避免泄露会话是否存在
+func (s *conversationServiceImpl) authorize(ctx context.Context, userID, conversationID int64, need string) (*entity.Conversation, error) {
+	notFound := errorx.New(errorx.NotFound, "会话不存在")
+	if userID <= 0 || conversationID <= 0 {
+		return nil, notFound
+	}
+	conv, err := s.repo.GetConversation(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil {
+		return nil, notFound
+	}
+	if conv.UserID == userID {
+		return conv, nil
+	}
+	if need == conversationAccessOwner {
+		return nil, notFound
+	}
+	access, err := s.repo.GetAccess(ctx, conversationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if access == nil || conversationAccessRank(access.Role) < conversationAccessRank(need) {
+		return nil, notFound
+	}
+	return conv, nil
+}
+
+func (s *conversationServiceImpl) GetConversationForUser(ctx context.Context, userID, conversationID int64) (*entity.Conversation, error) {
+	return s.authorize(ctx, userID, conversationID, entity.ConversationAccessViewer)
+}
+
+func (s *conversationServiceImpl) AddMessageForUser(ctx context.Context, userID, conversationID int64, msg *entity.Message) error {
+	if _, err := s.authorize(ctx, userID, conversationID, entity.ConversationAccessEditor); err != nil {
+		return err
+	}
+	if msg != nil && msg.SenderUserID == 0 {
+		msg.SenderUserID = userID
+	}
+	return s.AddMessage(ctx, conversationID, msg)
+}
+
+// GrantConversationAccess 归属用户可授予任意角色；manager 只能授予或调整 viewer/editor，且不能变更其他 manager
+func (s *conversationServiceImpl) GrantConversationAccess(ctx context.Context, actorID, conversationID, targetUserID int64, role string) error {
+	switch role {
+	case entity.ConversationAccessViewer, entity.ConversationAccessEditor, entity.ConversationAccessManager:
+	default:
+		return errorx.New(errorx.Validation, "role 仅支持 viewer/editor/manager")
+	}
+	if targetUserID <= 0 || targetUserID == actorID {
+		return errorx.New(errorx.Validation, "被授权用户无效")
+	}
+	conv, err := s.authorize(ctx, actorID, conversationID, entity.ConversationAccessManager)
+	if err != nil {
+		return err
+	}
+	if targetUserID == conv.UserID {
+		return errorx.New(errorx.Validation, "不能变更会话归属用户的权限")
+	}
+	if conv.UserID != actorID {
+		if role == entity.ConversationAccessManager {
+			return errorx.New(errorx.Validation, "仅会话归属用户可授予 manager")
+		}
+		if err := s.checkManagedTarget(ctx, conversationID, targetUserID); err != nil {
+			return err
+		}
+	}
+	return s.repo.SaveAccess(ctx, &entity.ConversationAccess{
+		ConversationID: conversationID,
+		UserID:         targetUserID,
+		Role:           role,
+		GrantedBy:      actorID,
+	})
+}
+
+// RevokeConversationAccess 撤销其他参与者的授权，权限规则同 GrantConversationAccess；撤销自己的授权请使用 LeaveConversation
+func (s *conversationServiceImpl) RevokeConversationAccess(ctx context.Context, actorID, conversationID, targetUserID int64) error {
+	conv, err := s.authorize(ctx, actorID, conversationID, entity.ConversationAccessManager)
+	if err != nil {
+		return err
+	}
+	if conv.UserID != actorID {
+		if err := s.checkManagedTarget(ctx, conversationID, targetUserID); err != nil {
+			return err
+		}
+	}
+	return s.repo.DeleteAccess(ctx, conversationID, targetUserID)
+}
+
+// checkManagedTarget manager 不能变更其他 manager 的授权
+func (s *conversationServiceImpl) checkManagedTarget(ctx context.Context, conversationID, targetUserID int64) error {
+	existing, err := s.repo.GetAccess(ctx, conversationID, targetUserID)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Role == entity.ConversationAccessManager {
+		return errorx.New(errorx.Validation, "仅会话归属用户可变更 manager 的授权")
+	}
+	return nil
+}
+
+func (s *conversationServiceImpl) ListConversationAccess(ctx context.Context, actorID, conversationID int64) ([]*entity.ConversationAccess, error) {
+	if _, err := s.authorize(ctx, actorID, conversationID, entity.ConversationAccessManager); err != nil {
+		return nil, err
+	}
+	return s.repo.ListAccess(ctx, conversationID)
+}
+
+// ListParticipants 返回归属用户（首位）与全部被共享用户，任一参与者均可查看
+func (s *conversationServiceImpl) ListParticipants(ctx context.Context, userID, conversationID int64) ([]*entity.ConversationParticipant, error) {
+	conv, err := s.authorize(ctx, userID, conversationID, entity.ConversationAccessViewer)
+	if err != nil {
+		return nil, err
+	}
+	list, err := s.repo.ListAccess(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	participants := make([]*entity.ConversationParticipant, 0, len(list)+1)
+	participants = append(participants, &entity.ConversationParticipant{
+		UserID:   conv.UserID,
+		Role:     entity.ConversationRoleOwner,
+		JoinedAt: conv.CreatedAt,
+	})
+	for _, a := range list {
+		participants = append(participants, &entity.ConversationParticipant{
+			UserID:    a.UserID,
+			Role:      a.Role,
+			GrantedBy: a.GrantedBy,
+			JoinedAt:  a.CreatedAt,
+		})
+	}
+	return participants, nil
+}
+
+// LeaveConversation 被共享用户退出会话；归属用户不能退出
+func (s *conversationServiceImpl) LeaveConversation(ctx context.Context, userID, conversationID int64) error {
+	conv, err := s.authorize(ctx, userID, conversationID, entity.ConversationAccessViewer)
+	if err != nil {
+		return err
+	}
+	if conv.UserID == userID {
+		return errorx.New(errorx.Validation, "会话归属用户不能退出会话")
+	}
+	return s.repo.DeleteAccess(ctx, conversationID, userID)
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+const (
+	// maxBranchTreeNodes 分支树最多返回的会话数
+	maxBranchTreeNodes = 500
+	// defaultBranchMessages/maxBranchMessages 分支消息解析返回的消息条数
+	defaultBranchMessages = 50
+	maxBranchMessages     = 200
+)
+
+// ConversationBranchNode 分支树节点
+type ConversationBranchNode struct {
+	Conversation *entity.Conversation `json:"conversation"`
+	// BranchFromMessageID 分支起点（父会话中的消息 ID），根节点为 0
+	BranchFromMessageID int64                     `json:"branch_from_message_id,omitempty"`
+	Children            []*ConversationBranchNode `json:"children,omitempty"`
+}
+
+// BranchMessages 分支视角下的消息：先是各级祖先会话在分支起点（含）之前的消息，再是分支自身的消息
+type BranchMessages struct {
+	ConversationID int64             `json:"conversation_id"`
+	Messages       []*entity.Message `json:"messages"`
+	// HasMore 更早的历史因条数上限未返回
+	HasMore bool `json:"has_more"`
+}
+
+// ListBranches 返回用户有读取权限的会话的直接分支，仅包含用户可读的分支
+func (s *conversationServiceImpl) ListBranches(ctx context.Context, userID, conversationID int64) ([]*entity.Conversation, error) {
+	if _, err := s.authorize(ctx, userID, conversationID, entity.ConversationAccessViewer); err != nil {
+		return nil, err
+	}
+	return s.visibleBranches(ctx, userID, conversationID)
+}
+
+// GetBranchTree 从会话向上找到用户可读的最上层祖先，返回以其为根的分支树；
+// 树深度与节点数分别受 maxConversationBranchDepth、maxBranchTreeNodes 限制
+func (s *conversationServiceImpl) GetBranchTree(ctx context.Context, userID, conversationID int64) (*ConversationBranchNode, error) {
+	conv, err := s.authorize(ctx, userID, conversationID, entity.ConversationAccessViewer)
+	if err != nil {
+		return nil, err
+	}
+	root := conv
+	for depth := 0; root.ParentID != nil && depth < maxConversationBranchDepth; depth++ {
+		parent, err := s.repo.GetConversation(ctx, *root.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil || !s.canView(ctx, userID, parent) {
+			break
+		}
+		root = parent
+	}
+	nodes := 1
+	return s.branchTree(ctx, userID, root, 0, &nodes)
+}
+
+func (s *conversationServiceImpl) branchTree(ctx context.Context, userID int64, conv *entity.Conversation, depth int, nodes *int) (*ConversationBranchNode, error) {
+	node := &ConversationBranchNode{Conversation: conv}
+	if conv.ParentID != nil {
+		node.BranchFromMessageID = branchFromMessageID(conv.MetadataJSON)
+	}
+	if depth >= maxConversationBranchDepth {
+		return node, nil
+	}
+	branches, err := s.visibleBranches(ctx, userID, conv.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range branches {
+		if *nodes >= maxBranchTreeNodes {
+			break
+		}
+		*nodes++
+		child, err := s.branchTree(ctx, userID, b, depth+1, nodes)
+		if err != nil {
+			return nil, err
+		}
+		node.Children = append(node.Children, child)
+	}
+	return node, nil
+}
+
+// GetBranchMessages 解析分支视角下最近的 limit 条消息（按时间正序）：分支自身的消息不足时，
+// 回溯父会话中分支起点（含）之前的消息，逐级向上直到根会话；分支起点为 0 的分支不继承父会话消息。
+// 祖先会话与分支同属一个用户时才回溯，其历史视为分支内容的一部分
+func (s *conversationServiceImpl) GetBranchMessages(ctx context.Context, userID, conversationID int64, limit int) (*BranchMessages, error) {
+	conv, err := s.authorize(ctx, userID, conversationID, entity.ConversationAccessViewer)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultBranchMessages
+	}
+	if limit > maxBranchMessages {
+		limit = maxBranchMessages
+	}
+
+	result := &BranchMessages{ConversationID: conv.ID, Messages: []*entity.Message{}}
+	var segments [][]*entity.Message
+	remaining := limit
+	current, beforeID := conv, int64(0)
+	for depth := 0; ; depth++ {
+		msgs, _, hasMore, err := s.repo.ListMessages(ctx, entity.MessageQuery{
+			ConversationID: current.ID,
+			BeforeID:       beforeID,
+			Limit:          remaining,
+			Ascending:      true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, msgs)
+		remaining -= len(msgs)
+		if hasMore {
+			result.HasMore = true
+			break
+		}
+		if current.ParentID == nil {
+			break
+		}
+		from := branchFromMessageID(current.MetadataJSON)
+		if from <= 0 {
+			break
+		}
+		if depth >= maxConversationBranchDepth {
+			result.HasMore = true
+			break
+		}
+		parent, err := s.repo.GetConversation(ctx, *current.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil || parent.UserID != conv.UserID {
+			break
+		}
+		if remaining <= 0 {
+			result.HasMore = true
+			break
+		}
+		current, beforeID = parent, from+1
+	}
+	for i := len(segments) - 1; i >= 0; i-- {
+		result.Messages = append(result.Messages, segments[i]...)
+	}
+	return result, nil
+}
+
+// visibleBranches 返回会话的直接分支中用户可读的部分
+func (s *conversationServiceImpl) visibleBranches(ctx context.Context, userID, conversationID int64) ([]*entity.Conversation, error) {
+	branches, err := s.repo.ListBranches(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	visible := make([]*entity.Conversation, 0, len(branches))
+	for _, b := range branches {
+		if s.canView(ctx, userID, b) {
+			visible = append(visible, b)
+		}
+	}
+	return visible, nil
+}
+
+// canView 用户为会话归属者或拥有共享授权；查询授权出错时按不可读处理
+func (s *conversationServiceImpl) canView(ctx context.Context, userID int64, conv *entity.Conversation) bool {
+	if conv.UserID == userID {
+		return true
+	}
+	access, err := s.repo.GetAccess(ctx, conv.ID, userID)
+	return err == nil && access != nil && conversationAccessRank(access.Role) >= conversationAccessRank(entity.ConversationAccessViewer)
+}
+
+// validateBranchPoint 分支起点须为基础会话中的消息
+func (s *conversationServiceImpl) validateBranchPoint(ctx context.Context, conversationID, messageID int64) error {
+	if messageID <= 0 {
+		return nil
+	}
+	msgs, err := s.repo.GetMessagesAfter(ctx, conversationID, messageID-1, 1)
+	if err != nil {
+		return err
+	}
+	if len(msgs) == 0 || msgs[0].ID != messageID {
+		return errorx.New(errorx.Validation, "分支起点消息不属于该会话")
+	}
+	return nil
+}
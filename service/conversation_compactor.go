@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gochen-llm/repo"
+	"gochen/errorx"
+	"gochen/logging"
+	runtime "gochen/task"
+)
+
+const (
+	defaultCompactionInactiveDays = 30
+	defaultCompactionKeepLast     = 100
+	defaultCompactionInterval     = 6 * time.Hour
+	// conversationCompactionBatch 每批查询的待压缩会话数
+	conversationCompactionBatch = 100
+)
+
+// ConversationCompactionConfig 定时压缩配置；零值字段使用默认值
+type ConversationCompactionConfig struct {
+	// Enabled 是否在后台周期执行；关闭时仍可通过 CompactOnce 手动触发。默认关闭
+	Enabled bool `json:"enabled"`
+	// InactiveDays 会话最近一条消息早于该天数才会被压缩，默认 30
+	InactiveDays int `json:"inactive_days"`
+	// KeepLast 每个会话保留的最近消息数，默认 100
+	KeepLast int `json:"keep_last"`
+	// MaxConversations 每轮最多压缩的会话数，<=0 不限制
+	MaxConversations int `json:"max_conversations"`
+}
+
+// ConversationCompactionStats 压缩任务累计指标（进程内，重启清零）
+type ConversationCompactionStats struct {
+	Runs                   int64      `json:"runs"`
+	ConversationsCompacted int64      `json:"conversations_compacted"`
+	MessagesRemoved        int64      `json:"messages_removed"`
+	Failures               int64      `json:"failures"`
+	LastRunAt              *time.Time `json:"last_run_at,omitempty"`
+	LastMessagesRemoved    int64      `json:"last_messages_removed"`
+	LastError              string     `json:"last_error,omitempty"`
+}
+
+// ConversationCompactionResult 单轮压缩结果
+type ConversationCompactionResult struct {
+	Conversations   int64 `json:"conversations"`
+	MessagesRemoved int64 `json:"messages_removed"`
+	Failures        int64 `json:"failures"`
+}
+
+// ConversationCompactor 周期性压缩长期不活跃的会话：先刷新摘要使被删除的早期消息纳入摘要，再仅保留最近的消息
+type ConversationCompactor interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	SetConfig(cfg ConversationCompactionConfig)
+	GetConfig() ConversationCompactionConfig
+	// CompactOnce 立即压缩一轮（不受 Enabled 影响）
+	CompactOnce(ctx context.Context) (*ConversationCompactionResult, error)
+	Stats() ConversationCompactionStats
+}
+
+type conversationCompactorImpl struct {
+	repo          repo.ConversationRepo
+	conversations ConversationService
+	logger        logging.ILogger
+	super         *runtime.TaskSupervisor
+
+	interval time.Duration
+
+	cfgMu sync.RWMutex
+	cfg   ConversationCompactionConfig
+
+	// runMu 保证同一时间只有一轮压缩
+	runMu sync.Mutex
+
+	runs                   int64
+	conversationsCompacted int64
+	messagesRemoved        int64
+	failures               int64
+	lastRunAt              int64 // UnixNano
+	lastMessagesRemoved    int64
+	lastError              atomic.Value // string
+
+	lifecycleMu sync.Mutex
+	started     bool
+	stopped     bool
+	cancel      context.CancelFunc
+}
+
+func NewConversationCompactor(repo repo.ConversationRepo, conversations ConversationService, logger logging.ILogger) ConversationCompactor {
+	return &conversationCompactorImpl{
+		repo:          repo,
+		conversations: conversations,
+		logger:        logger,
+		super:         runtime.NewTaskSupervisor("gochen-llm.conversation_compactor"),
+		interval:      defaultCompactionInterval,
+		cfg:           normalizeCompactionConfig(ConversationCompactionConfig{}),
+	}
+}
+
+func (c *conversationCompactorImpl) Start(ctx context.Context) error {
+	if ctx == nil {
+		return errorx.New(errorx.InvalidInput, "ctx 不能为空")
+	}
+
+	c.lifecycleMu.Lock()
+	defer c.lifecycleMu.Unlock()
+
+	if c.stopped {
+		return errorx.New(errorx.Internal, "ConversationCompactor 已停止，无法再次启动")
+	}
+	if c.started {
+		return nil
+	}
+	loopCtx, cancel := context.WithCancel(ctx)
+	c.cancel = cancel
+	c.started = true
+
+	c.super.GoLoop(loopCtx, "compact_loop", c.interval, func(ctx context.Context) error {
+		if !c.GetConfig().Enabled {
+			return nil
+		}
+		if _, err := c.CompactOnce(ctx); err != nil && c.logger != nil {
+			c.logger.Warn(ctx, "压缩不活跃会话失败", logging.Error(err))
+		}
+		return nil
+	})
+	return nil
+}
+
+func (c *conversationCompactorImpl) Stop(ctx context.Context) error {
+	c.lifecycleMu.Lock()
+	if !c.started || c.stopped {
+		c.lifecycleMu.Unlock()
+		return nil
+	}
+	c.stopped = true
+	cancel := c.cancel
+	c.lifecycleMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	c.super.Stop()
+	return nil
+}
+
+func (c *conversationCompactorImpl) SetConfig(cfg ConversationCompactionConfig) {
+	cfg = normalizeCompactionConfig(cfg)
+	c.cfgMu.Lock()
+	defer c.cfgMu.Unlock()
+	c.cfg = cfg
+}
+
+func (c *conversationCompactorImpl) GetConfig() ConversationCompactionConfig {
+	c.cfgMu.RLock()
+	defer c.cfgMu.RUnlock()
+	return c.cfg
+}
+
+func normalizeCompactionConfig(cfg ConversationCompactionConfig) ConversationCompactionConfig {
+	if cfg.InactiveDays <= 0 {
+		cfg.InactiveDays = defaultCompactionInactiveDays
+	}
+	if cfg.KeepLast <= 0 {
+		cfg.KeepLast = defaultCompactionKeepLast
+	}
+	return cfg
+}
+
+func (c *conversationCompactorImpl) CompactOnce(ctx context.Context) (*ConversationCompactionResult, error) {
+	if c.repo == nil {
+		return nil, errorx.New(errorx.Internal, "会话仓储未配置")
+	}
+	c.runMu.Lock()
+	defer c.runMu.Unlock()
+
+	cfg := c.GetConfig()
+	before := time.Now().AddDate(0, 0, -cfg.InactiveDays)
+	result := &ConversationCompactionResult{}
+	var lastErr error
+	var afterID int64
+scan:
+	for ctx.Err() == nil {
+		list, err := c.repo.ListCompactable(ctx, before, cfg.KeepLast, afterID, conversationCompactionBatch)
+		if err != nil {
+			lastErr = err
+			break
+		}
+		for _, conv := range list {
+			afterID = conv.ID
+			if cfg.MaxConversations > 0 && result.Conversations+result.Failures >= int64(cfg.MaxConversations) {
+				break scan
+			}
+			// 摘要刷新失败时跳过该会话，避免早期消息未纳入摘要即被删除
+			if c.conversations != nil {
+				if _, err := c.conversations.SummarizeConversation(ctx, conv.ID); err != nil {
+					result.Failures++
+					lastErr = err
+					continue
+				}
+			}
+			removed, err := c.repo.TrimMessages(ctx, conv.ID, cfg.KeepLast)
+			if err != nil {
+				result.Failures++
+				lastErr = err
+				continue
+			}
+			result.Conversations++
+			result.MessagesRemoved += removed
+		}
+		if len(list) < conversationCompactionBatch {
+			break
+		}
+	}
+
+	atomic.AddInt64(&c.runs, 1)
+	atomic.AddInt64(&c.conversationsCompacted, result.Conversations)
+	atomic.AddInt64(&c.messagesRemoved, result.MessagesRemoved)
+	atomic.AddInt64(&c.failures, result.Failures)
+	atomic.StoreInt64(&c.lastRunAt, time.Now().UnixNano())
+	atomic.StoreInt64(&c.lastMessagesRemoved, result.MessagesRemoved)
+	if lastErr != nil {
+		c.lastError.Store(lastErr.Error())
+	} else {
+		c.lastError.Store("")
+	}
+	return result, lastErr
+}
+
+func (c *conversationCompactorImpl) Stats() ConversationCompactionStats {
+	stats := ConversationCompactionStats{
+		Runs:                   atomic.LoadInt64(&c.runs),
+		ConversationsCompacted: atomic.LoadInt64(&c.conversationsCompacted),
+		MessagesRemoved:        atomic.LoadInt64(&c.messagesRemoved),
+		Failures:               atomic.LoadInt64(&c.failures),
+		LastMessagesRemoved:    atomic.LoadInt64(&c.lastMessagesRemoved),
+	}
+	if ts := atomic.LoadInt64(&c.lastRunAt); ts > 0 {
+		at := time.Unix(0, ts)
+		stats.LastRunAt = &at
+	}
+	stats.LastError, _ = c.lastError.Load().(string)
+	return stats
+}
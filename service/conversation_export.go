@@ -0,0 +1,331 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+// ConversationExportVersion 导出格式版本，导入时校验
+const ConversationExportVersion = 1
+
+const (
+	// conversationExportBatch 导出时每批读取的消息数
+	conversationExportBatch = 200
+	// maxConversationBranchDepth 导出/导入的分支嵌套层数上限
+	maxConversationBranchDepth = 10
+	// maxImportMessages 单次导入的消息总数上限（含分支）
+	maxImportMessages = 10000
+)
+
+// ConversationExport 会话导出文档，可直接作为导入请求体
+type ConversationExport struct {
+	Version      int                   `json:"version"`
+	ExportedAt   time.Time             `json:"exported_at"`
+	Conversation *ExportedConversation `json:"conversation"`
+}
+
+// ExportedConversation 导出的会话；ID 与消息 ID 为原环境中的值，导入时重新分配
+type ExportedConversation struct {
+	ID        int64                   `json:"id"`
+	Type      string                  `json:"type"`
+	Title     string                  `json:"title"`
+	Status    string                  `json:"status"`
+	Summary   string                  `json:"summary,omitempty"`
+	Metadata  json.RawMessage         `json:"metadata,omitempty"`
+	CreatedAt time.Time               `json:"created_at"`
+	Messages  []*ExportedMessage      `json:"messages"`
+	Branches  []*ExportedConversation `json:"branches,omitempty"`
+	// BranchFromMessageID 分支起点（父会话中的消息 ID），仅分支有值
+	BranchFromMessageID int64 `json:"branch_from_message_id,omitempty"`
+}
+
+// ExportedMessage 导出的消息
+type ExportedMessage struct {
+	ID        int64           `json:"id"`
+	Role      string          `json:"role"`
+	Content   string          `json:"content"`
+	Tokens    int             `json:"tokens,omitempty"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// ExportConversation 导出用户有读取权限的会话及其全部消息；includeBranches 时递归包含同一用户的分支
+func (s *conversationServiceImpl) ExportConversation(ctx context.Context, userID, conversationID int64, includeBranches bool) (*ConversationExport, error) {
+	conv, err := s.authorize(ctx, userID, conversationID, entity.ConversationAccessViewer)
+	if err != nil {
+		return nil, err
+	}
+	exported, err := s.exportTree(ctx, conv, includeBranches, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &ConversationExport{
+		Version:      ConversationExportVersion,
+		ExportedAt:   time.Now(),
+		Conversation: exported,
+	}, nil
+}
+
+func (s *conversationServiceImpl) exportTree(ctx context.Context, conv *entity.Conversation, includeBranches bool, depth int) (*ExportedConversation, error) {
+	out := &ExportedConversation{
+		ID:        conv.ID,
+		Type:      conv.Type,
+		Title:     conv.Title,
+		Status:    conv.Status,
+		Summary:   conv.Summary,
+		Metadata:  rawJSON(conv.MetadataJSON),
+		CreatedAt: conv.CreatedAt,
+		Messages:  []*ExportedMessage{},
+	}
+	if conv.ParentID != nil {
+		out.BranchFromMessageID = branchFromMessageID(conv.MetadataJSON)
+	}
+	var lastID int64
+	for {
+		msgs, err := s.repo.GetMessagesAfter(ctx, conv.ID, lastID, conversationExportBatch)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range msgs {
+			out.Messages = append(out.Messages, &ExportedMessage{
+				ID:        m.ID,
+				Role:      m.Role,
+				Content:   m.Content,
+				Tokens:    m.Tokens,
+				Metadata:  rawJSON(m.MetadataJSON),
+				CreatedAt: m.CreatedAt,
+			})
+		}
+		if len(msgs) < conversationExportBatch {
+			break
+		}
+		lastID = msgs[len(msgs)-1].ID
+	}
+	if !includeBranches || depth >= maxConversationBranchDepth {
+		return out, nil
+	}
+	branches, err := s.repo.ListBranches(ctx, conv.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range branches {
+		if b.UserID != conv.UserID {
+			continue
+		}
+		child, err := s.exportTree(ctx, b, true, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		out.Branches = append(out.Branches, child)
+	}
+	return out, nil
+}
+
+// ImportConversation 将导出文档导入为 userID 的新会话（含分支），返回根会话；
+// 每个会话单独提交，任一会话导入失败时删除本次已导入的会话
+func (s *conversationServiceImpl) ImportConversation(ctx context.Context, userID int64, doc *ConversationExport) (*entity.Conversation, error) {
+	if userID <= 0 {
+		return nil, errorx.New(errorx.Validation, "userID 无效")
+	}
+	if doc == nil || doc.Conversation == nil {
+		return nil, errorx.New(errorx.Validation, "导入内容不能为空")
+	}
+	if doc.Version != ConversationExportVersion {
+		return nil, errorx.New(errorx.Validation, fmt.Sprintf("不支持的导出格式版本 %d", doc.Version))
+	}
+	if err := validateConversationImport(doc.Conversation, 0, new(int)); err != nil {
+		return nil, err
+	}
+	var imported []int64
+	root, err := s.importTree(ctx, userID, doc.Conversation, nil, nil, &imported)
+	if err != nil {
+		now := time.Now()
+		for _, id := range imported {
+			_ = s.repo.SoftDelete(ctx, id, now)
+		}
+		return nil, err
+	}
+	return root, nil
+}
+
+func validateConversationImport(c *ExportedConversation, depth int, total *int) error {
+	if depth > maxConversationBranchDepth {
+		return errorx.New(errorx.Validation, fmt.Sprintf("分支嵌套超过 %d 层", maxConversationBranchDepth))
+	}
+	if len(c.Type) > 20 {
+		return errorx.New(errorx.Validation, "会话 type 过长")
+	}
+	if len(c.Metadata) > 0 && !json.Valid(c.Metadata) {
+		return errorx.New(errorx.Validation, "会话 metadata 不是有效的 JSON")
+	}
+	for i, m := range c.Messages {
+		if m == nil {
+			return errorx.New(errorx.Validation, fmt.Sprintf("第 %d 条消息为空", i+1))
+		}
+		switch m.Role {
+		case "user", "assistant", "system":
+		default:
+			return errorx.New(errorx.Validation, fmt.Sprintf("第 %d 条消息的 role 无效: %s", i+1, m.Role))
+		}
+		if len(m.Metadata) > 0 && !json.Valid(m.Metadata) {
+			return errorx.New(errorx.Validation, fmt.Sprintf("第 %d 条消息的 metadata 不是有效的 JSON", i+1))
+		}
+	}
+	*total += len(c.Messages)
+	if *total > maxImportMessages {
+		return errorx.New(errorx.Validation, fmt.Sprintf("导入的消息总数超过 %d", maxImportMessages))
+	}
+	for _, b := range c.Branches {
+		if b == nil {
+			continue
+		}
+		if err := validateConversationImport(b, depth+1, total); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importTree 先导入会话本身，再以新消息 ID 重写分支起点后导入分支；已导入的会话 ID 记录在 imported 中
+func (s *conversationServiceImpl) importTree(ctx context.Context, userID int64, c *ExportedConversation, parent *entity.Conversation, parentIDs map[int64]int64, imported *[]int64) (*entity.Conversation, error) {
+	meta := map[string]any{}
+	if len(c.Metadata) > 0 {
+		_ = json.Unmarshal(c.Metadata, &meta)
+	}
+	meta["imported_from_id"] = c.ID
+	delete(meta, "branch_from_message_id")
+	if parent != nil && c.BranchFromMessageID > 0 {
+		if id, ok := parentIDs[c.BranchFromMessageID]; ok {
+			meta["branch_from_message_id"] = id
+		}
+	}
+	metaJSON, _ := json.Marshal(meta)
+
+	conv := &entity.Conversation{
+		UserID:       userID,
+		Type:         c.Type,
+		Title:        c.Title,
+		Status:       entity.ConversationStatusActive,
+		MetadataJSON: string(metaJSON),
+	}
+	if conv.Type == "" {
+		conv.Type = entity.ConversationTypeChat
+	}
+	if c.Status == entity.ConversationStatusArchived {
+		conv.Status = entity.ConversationStatusArchived
+	}
+	conv.Title, _ = truncateRunes(conv.Title, 200)
+	if parent != nil {
+		conv.ParentID = &parent.ID
+	}
+	if !c.CreatedAt.IsZero() {
+		conv.CreatedAt = c.CreatedAt
+	}
+
+	msgs := make([]*entity.Message, 0, len(c.Messages))
+	for _, m := range c.Messages {
+		msg := &entity.Message{
+			Role:         m.Role,
+			Content:      m.Content,
+			Tokens:       m.Tokens,
+			MetadataJSON: string(m.Metadata),
+			CreatedAt:    m.CreatedAt,
+		}
+		if msg.Tokens <= 0 {
+			msg.Tokens = estimateMessageTokens(Message{Content: msg.Content})
+		}
+		conv.MessageTokens += int64(msg.Tokens)
+		if !msg.CreatedAt.IsZero() && (conv.LastMessageAt == nil || msg.CreatedAt.After(*conv.LastMessageAt)) {
+			at := msg.CreatedAt
+			conv.LastMessageAt = &at
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) > 0 && conv.LastMessageAt == nil {
+		now := time.Now()
+		conv.LastMessageAt = &now
+	}
+	if err := s.repo.ImportConversation(ctx, conv, msgs); err != nil {
+		return nil, err
+	}
+	*imported = append(*imported, conv.ID)
+
+	ids := make(map[int64]int64, len(msgs))
+	for i, m := range c.Messages {
+		if m.ID > 0 {
+			ids[m.ID] = msgs[i].ID
+		}
+	}
+	for _, b := range c.Branches {
+		if b == nil {
+			continue
+		}
+		if _, err := s.importTree(ctx, userID, b, conv, ids, imported); err != nil {
+			return nil, err
+		}
+	}
+	return conv, nil
+}
+
+// RenderConversationMarkdown 将导出文档渲染为 Markdown，分支按层级追加在父会话之后
+func RenderConversationMarkdown(doc *ConversationExport) string {
+	var sb strings.Builder
+	if doc != nil && doc.Conversation != nil {
+		renderConversationMarkdown(&sb, doc.Conversation, 1)
+	}
+	return sb.String()
+}
+
+func renderConversationMarkdown(sb *strings.Builder, c *ExportedConversation, level int) {
+	if level > 6 {
+		level = 6
+	}
+	title := c.Title
+	if title == "" {
+		title = fmt.Sprintf("会话 %d", c.ID)
+	}
+	if level > 1 {
+		title = "分支：" + title
+	}
+	sb.WriteString(strings.Repeat("#", level) + " " + title + "\n\n")
+	sb.WriteString(fmt.Sprintf("> 类型：%s · 创建于 %s", c.Type, c.CreatedAt.Format(time.RFC3339)))
+	if c.BranchFromMessageID > 0 {
+		sb.WriteString(fmt.Sprintf(" · 自消息 #%d 分支", c.BranchFromMessageID))
+	}
+	sb.WriteString("\n\n")
+	if c.Summary != "" {
+		sb.WriteString("**摘要**：" + c.Summary + "\n\n")
+	}
+	for _, m := range c.Messages {
+		sb.WriteString(fmt.Sprintf("**%s** · #%d · %s\n\n", m.Role, m.ID, m.CreatedAt.Format(time.RFC3339)))
+		sb.WriteString(m.Content)
+		sb.WriteString("\n\n---\n\n")
+	}
+	for _, b := range c.Branches {
+		renderConversationMarkdown(sb, b, level+1)
+	}
+}
+
+// rawJSON 将 JSON 文本原样嵌入导出文档，无效或为空时省略
+func rawJSON(s string) json.RawMessage {
+	s = strings.TrimSpace(s)
+	if s == "" || !json.Valid([]byte(s)) {
+		return nil
+	}
+	return json.RawMessage(s)
+}
+
+// branchFromMessageID 读取分支会话 metadata 中记录的分支起点消息 ID
+func branchFromMessageID(metadataJSON string) int64 {
+	var meta struct {
+		BranchFromMessageID int64 `json:"branch_from_message_id"`
+	}
+	_ = json.Unmarshal([]byte(metadataJSON), &meta)
+	return meta.BranchFromMessageID
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gochen-llm/repo"
+	"gochen/errorx"
+	"gochen/logging"
+	runtime "gochen/task"
+)
+
+const (
+	// defaultConversationRetention 软删除会话的默认保留期
+	defaultConversationRetention     = 30 * 24 * time.Hour
+	defaultConversationPurgeInterval = time.Hour
+	// conversationPurgeBatch 每批物理删除的会话数
+	conversationPurgeBatch = 100
+)
+
+// ConversationPurger 周期性物理删除超过保留期的软删除会话及其消息
+type ConversationPurger interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	// SetRetention 设置软删除数据的保留期，<=0 恢复默认 30 天
+	SetRetention(retention time.Duration)
+	// PurgeOnce 立即清理一轮，返回删除的会话数
+	PurgeOnce(ctx context.Context) (int64, error)
+}
+
+type conversationPurgerImpl struct {
+	repo   repo.ConversationRepo
+	logger logging.ILogger
+	super  *runtime.TaskSupervisor
+
+	interval time.Duration
+
+	retentionMu sync.RWMutex
+	retention   time.Duration
+
+	lifecycleMu sync.Mutex
+	started     bool
+	stopped     bool
+	cancel      context.CancelFunc
+}
+
+func NewConversationPurger(repo repo.ConversationRepo, logger logging.ILogger) ConversationPurger {
+	return &conversationPurgerImpl{
+		repo:      repo,
+		logger:    logger,
+		super:     runtime.NewTaskSupervisor("gochen-llm.conversation_purger"),
+		interval:  defaultConversationPurgeInterval,
+		retention: defaultConversationRetention,
+	}
+}
+
+func (p *conversationPurgerImpl) Start(ctx context.Context) error {
+	if ctx == nil {
+		return errorx.New(errorx.InvalidInput, "ctx 不能为空")
+	}
+
+	p.lifecycleMu.Lock()
+	defer p.lifecycleMu.Unlock()
+
+	if p.stopped {
+		return errorx.New(errorx.Internal, "ConversationPurger 已停止，无法再次启动")
+	}
+	if p.started {
+		return nil
+	}
+	loopCtx, cancel := context.WithCancel(ctx)
+	p.cancel = cancel
+	p.started = true
+
+	p.super.GoLoop(loopCtx, "purge_loop", p.interval, func(ctx context.Context) error {
+		if _, err := p.PurgeOnce(ctx); err != nil && p.logger != nil {
+			p.logger.Warn(ctx, "清理已删除会话失败", logging.Error(err))
+		}
+		return nil
+	})
+	return nil
+}
+
+func (p *conversationPurgerImpl) Stop(ctx context.Context) error {
+	p.lifecycleMu.Lock()
+	if !p.started || p.stopped {
+		p.lifecycleMu.Unlock()
+		return nil
+	}
+	p.stopped = true
+	cancel := p.cancel
+	p.lifecycleMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	p.super.Stop()
+	return nil
+}
+
+func (p *conversationPurgerImpl) SetRetention(retention time.Duration) {
+	if retention <= 0 {
+		retention = defaultConversationRetention
+	}
+	p.retentionMu.Lock()
+	defer p.retentionMu.Unlock()
+	p.retention = retention
+}
+
+func (p *conversationPurgerImpl) PurgeOnce(ctx context.Context) (int64, error) {
+	if p.repo == nil {
+		return 0, errorx.New(errorx.Internal, "会话仓储未配置")
+	}
+	p.retentionMu.RLock()
+	before := time.Now().Add(-p.retention)
+	p.retentionMu.RUnlock()
+
+	var total int64
+	for {
+		n, err := p.repo.PurgeDeleted(ctx, before, conversationPurgeBatch)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < conversationPurgeBatch || ctx.Err() != nil {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+// 会话检索模式
+const (
+	ConversationSearchKeyword  = "keyword"  // 关键词精确匹配（SQL LIKE）
+	ConversationSearchSemantic = "semantic" // 语义检索，需注册 ConversationSemanticSearcher
+	ConversationSearchHybrid   = "hybrid"   // 两者合并，未注册语义检索时退化为关键词
+)
+
+const (
+	// searchMaxTerms 关键词检索最多使用的词数
+	searchMaxTerms = 5
+	// searchSnippetRunes 命中片段在命中词前后各保留的字符数
+	searchSnippetRunes = 40
+	// defaultSearchLimit/maxSearchLimit 单次检索返回的命中条数
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// ConversationSearchRequest 检索用户本人会话中的消息
+type ConversationSearchRequest struct {
+	UserID int64
+	Query  string
+	// Mode keyword/semantic/hybrid，默认 keyword
+	Mode string
+	// ConversationID 大于 0 时仅在该会话内检索
+	ConversationID int64
+	Limit          int
+}
+
+// ConversationSearchHit 一条消息命中
+type ConversationSearchHit struct {
+	ConversationID    int64     `json:"conversation_id"`
+	ConversationTitle string    `json:"conversation_title"`
+	MessageID         int64     `json:"message_id"`
+	Role              string    `json:"role"`
+	Snippet           string    `json:"snippet"`
+	Score             float64   `json:"score"`
+	Source            string    `json:"source"` // keyword/semantic
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// ConversationSemanticSearcher 语义检索扩展点（如基于向量索引）。
+// 返回的命中需填写 ConversationID/MessageID/Role/Snippet/Score/CreatedAt，标题由服务层补全；
+// 服务层会再次校验会话归属，实现方仍应按 userID 过滤以免无效命中占用名额
+type ConversationSemanticSearcher interface {
+	SearchMessages(ctx context.Context, userID int64, query string, conversationID int64, limit int) ([]*ConversationSearchHit, error)
+}
+
+// MessageIndexer 消息写入后的索引扩展点（如向量索引）；实现方应异步处理，不阻塞消息写入
+type MessageIndexer interface {
+	IndexMessage(ctx context.Context, conv *entity.Conversation, msg *entity.Message)
+}
+
+func (s *conversationServiceImpl) SetMessageIndexer(indexer MessageIndexer) {
+	s.summaryMu.Lock()
+	defer s.summaryMu.Unlock()
+	s.indexer = indexer
+}
+
+func (s *conversationServiceImpl) messageIndexer() MessageIndexer {
+	s.summaryMu.Lock()
+	defer s.summaryMu.Unlock()
+	return s.indexer
+}
+
+func (s *conversationServiceImpl) SetSemanticSearcher(searcher ConversationSemanticSearcher) {
+	s.summaryMu.Lock()
+	defer s.summaryMu.Unlock()
+	s.semantic = searcher
+}
+
+func (s *conversationServiceImpl) semanticSearcher() ConversationSemanticSearcher {
+	s.summaryMu.Lock()
+	defer s.summaryMu.Unlock()
+	return s.semantic
+}
+
+func (s *conversationServiceImpl) SearchConversations(ctx context.Context, req ConversationSearchRequest) ([]*ConversationSearchHit, error) {
+	if req.UserID <= 0 {
+		return nil, errorx.New(errorx.Validation, "userID 无效")
+	}
+	query := strings.TrimSpace(req.Query)
+	if query == "" {
+		return nil, errorx.New(errorx.Validation, "检索内容不能为空")
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+	if req.ConversationID > 0 {
+		if _, err := s.authorize(ctx, req.UserID, req.ConversationID, conversationAccessOwner); err != nil {
+			return nil, err
+		}
+	}
+
+	semantic := s.semanticSearcher()
+	mode := req.Mode
+	switch mode {
+	case "", ConversationSearchKeyword:
+		mode = ConversationSearchKeyword
+	case ConversationSearchSemantic:
+		if semantic == nil {
+			return nil, errorx.New(errorx.Validation, "未配置语义检索")
+		}
+	case ConversationSearchHybrid:
+		if semantic == nil {
+			mode = ConversationSearchKeyword
+		}
+	default:
+		return nil, errorx.New(errorx.Validation, "mode 仅支持 keyword/semantic/hybrid")
+	}
+
+	var hits []*ConversationSearchHit
+	if mode != ConversationSearchSemantic {
+		keywordHits, err := s.keywordSearch(ctx, req.UserID, req.ConversationID, query, limit)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, keywordHits...)
+	}
+	if mode != ConversationSearchKeyword {
+		semanticHits, err := s.semanticSearch(ctx, semantic, req.UserID, req.ConversationID, query, limit)
+		if err != nil {
+			return nil, err
+		}
+		hits = mergeSearchHits(hits, semanticHits)
+	}
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	if err := s.fillSearchTitles(ctx, hits); err != nil {
+		return nil, err
+	}
+	return hits, nil
+}
+
+// keywordSearch 所有词均需命中；得分随命中次数递增并归一到 [0,1)，便于与语义结果合并排序
+func (s *conversationServiceImpl) keywordSearch(ctx context.Context, userID, conversationID int64, query string, limit int) ([]*ConversationSearchHit, error) {
+	terms := searchTerms(query)
+	msgs, err := s.repo.SearchMessages(ctx, userID, conversationID, terms, limit)
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]*ConversationSearchHit, 0, len(msgs))
+	for _, m := range msgs {
+		lower := strings.ToLower(m.Content)
+		occurrences := 0
+		for _, t := range terms {
+			occurrences += strings.Count(lower, strings.ToLower(t))
+		}
+		hits = append(hits, &ConversationSearchHit{
+			ConversationID: m.ConversationID,
+			MessageID:      m.ID,
+			Role:           m.Role,
+			Snippet:        searchSnippet(m.Content, terms),
+			Score:          float64(occurrences) / float64(occurrences+1),
+			Source:         ConversationSearchKeyword,
+			CreatedAt:      m.CreatedAt,
+		})
+	}
+	return hits, nil
+}
+
+// semanticSearch 丢弃不属于用户本人会话的命中
+func (s *conversationServiceImpl) semanticSearch(ctx context.Context, searcher ConversationSemanticSearcher, userID, conversationID int64, query string, limit int) ([]*ConversationSearchHit, error) {
+	raw, err := searcher.SearchMessages(ctx, userID, query, conversationID, limit)
+	if err != nil {
+		return nil, err
+	}
+	owned := map[int64]bool{}
+	hits := make([]*ConversationSearchHit, 0, len(raw))
+	for _, h := range raw {
+		if h == nil || (conversationID > 0 && h.ConversationID != conversationID) {
+			continue
+		}
+		ok, seen := owned[h.ConversationID]
+		if !seen {
+			conv, err := s.repo.GetConversation(ctx, h.ConversationID)
+			if err != nil {
+				return nil, err
+			}
+			ok = conv != nil && conv.UserID == userID
+			owned[h.ConversationID] = ok
+		}
+		if !ok {
+			continue
+		}
+		h.Source = ConversationSearchSemantic
+		h.Snippet, _ = truncateRunes(h.Snippet, 2*searchSnippetRunes)
+		hits = append(hits, h)
+	}
+	return hits, nil
+}
+
+// fillSearchTitles 补全命中所属会话的标题
+func (s *conversationServiceImpl) fillSearchTitles(ctx context.Context, hits []*ConversationSearchHit) error {
+	titles := map[int64]string{}
+	for _, h := range hits {
+		title, ok := titles[h.ConversationID]
+		if !ok {
+			conv, err := s.repo.GetConversation(ctx, h.ConversationID)
+			if err != nil {
+				return err
+			}
+			if conv != nil {
+				title = conv.Title
+			}
+			titles[h.ConversationID] = title
+		}
+		h.ConversationTitle = title
+	}
+	return nil
+}
+
+// mergeSearchHits 按消息去重（同一消息保留较高得分），再按得分与时间倒序排列
+func mergeSearchHits(a, b []*ConversationSearchHit) []*ConversationSearchHit {
+	byMessage := map[int64]*ConversationSearchHit{}
+	merged := make([]*ConversationSearchHit, 0, len(a)+len(b))
+	for _, h := range append(append([]*ConversationSearchHit{}, a...), b...) {
+		if prev, ok := byMessage[h.MessageID]; ok {
+			if h.Score > prev.Score {
+				prev.Score = h.Score
+			}
+			continue
+		}
+		byMessage[h.MessageID] = h
+		merged = append(merged, h)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		if merged[i].Score != merged[j].Score {
+			return merged[i].Score > merged[j].Score
+		}
+		return merged[i].CreatedAt.After(merged[j].CreatedAt)
+	})
+	return merged
+}
+
+// searchTerms 按空白切分检索词并去重，最多取 searchMaxTerms 个
+func searchTerms(query string) []string {
+	seen := map[string]bool{}
+	var terms []string
+	for _, t := range strings.FieldsFunc(query, unicode.IsSpace) {
+		key := strings.ToLower(t)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		terms = append(terms, t)
+		if len(terms) == searchMaxTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// searchSnippet 截取首个命中词前后的片段，两端被截断时加省略号
+func searchSnippet(content string, terms []string) string {
+	runes := []rune(content)
+	lower := lowerRunes(content)
+	pos, length := -1, 0
+	for _, t := range terms {
+		tr := lowerRunes(t)
+		if i := indexRunes(lower, tr); i >= 0 && (pos < 0 || i < pos) {
+			pos, length = i, len(tr)
+		}
+	}
+	if pos < 0 {
+		snippet, truncated := truncateRunes(content, 2*searchSnippetRunes)
+		if truncated {
+			snippet += "…"
+		}
+		return snippet
+	}
+	start := pos - searchSnippetRunes
+	if start < 0 {
+		start = 0
+	}
+	end := pos + length + searchSnippetRunes
+	if end > len(runes) {
+		end = len(runes)
+	}
+	snippet := string(runes[start:end])
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// lowerRunes 逐字符转小写，保持与原文相同的字符下标
+func lowerRunes(s string) []rune {
+	runes := []rune(s)
+	for i, r := range runes {
+		runes[i] = unicode.ToLower(r)
+	}
+	return runes
+}
+
+func indexRunes(s, sub []rune) int {
+	if len(sub) == 0 {
+		return -1
+	}
+	for i := 0; i+len(sub) <= len(s); i++ {
+		match := true
+		for j := range sub {
+			if s[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
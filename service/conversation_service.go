@@ -4,29 +4,142 @@ import (
 	"context"
 	"encoding/json"
 	"strings"
+	"sync"
+	"time"
 
 	"gochen-llm/entity"
 	"gochen-llm/repo"
 	"gochen/errorx"
+	runtime "gochen/task"
 )
 
 // ConversationService 会话服务
 type ConversationService interface {
 	CreateConversation(ctx context.Context, userID int64, metadata map[string]any) (*entity.Conversation, error)
+	// GetConversation 不校验归属，仅供内部流程使用；面向用户的接口应使用 GetConversationForUser
 	GetConversation(ctx context.Context, conversationID int64) (*entity.Conversation, error)
+	// GetConversationForUser 返回用户有读取权限（归属或共享授权）的会话，无权访问时返回 NotFound
+	GetConversationForUser(ctx context.Context, userID, conversationID int64) (*entity.Conversation, error)
+	// AddMessageForUser 校验用户对会话有写入权限（归属或 editor 授权）后追加消息
+	AddMessageForUser(ctx context.Context, userID, conversationID int64, msg *entity.Message) error
+	// GrantConversationAccess 由归属用户或 manager 将会话共享给其他用户，role 为 viewer/editor/manager（manager 仅归属用户可授予）
+	GrantConversationAccess(ctx context.Context, actorID, conversationID, targetUserID int64, role string) error
+	// RevokeConversationAccess 由归属用户或 manager 撤销共享授权（manager 的授权仅归属用户可撤销）
+	RevokeConversationAccess(ctx context.Context, actorID, conversationID, targetUserID int64) error
+	// ListConversationAccess 由归属用户或 manager 查看共享授权
+	ListConversationAccess(ctx context.Context, actorID, conversationID int64) ([]*entity.ConversationAccess, error)
+	// ListParticipants 列出会话参与者（归属用户与被共享用户），任一参与者可查看
+	ListParticipants(ctx context.Context, userID, conversationID int64) ([]*entity.ConversationParticipant, error)
+	// LeaveConversation 被共享用户退出会话
+	LeaveConversation(ctx context.Context, userID, conversationID int64) error
+	// ListConversations 分页列出用户的会话（IncludeShared 时含共享给用户的会话），默认按最近活跃时间倒序，并填充用户的未读数
+	ListConversations(ctx context.Context, filter entity.ConversationFilter, limit, offset int) ([]*entity.Conversation, int64, error)
+	// MarkConversationRead 将用户在会话中的已读进度推进到 messageID（0 表示最新消息），返回重算后的已读状态
+	MarkConversationRead(ctx context.Context, userID, conversationID, messageID int64) (*entity.ConversationReadState, error)
+	// SearchConversations 在用户本人的会话中检索消息，返回带片段的命中
+	SearchConversations(ctx context.Context, req ConversationSearchRequest) ([]*ConversationSearchHit, error)
+	// SetSemanticSearcher 注册语义检索实现，nil 关闭语义检索
+	SetSemanticSearcher(searcher ConversationSemanticSearcher)
+	// SetMessageIndexer 注册消息写入后的索引实现（如 EmbeddingIndex），nil 关闭
+	SetMessageIndexer(indexer MessageIndexer)
+	// AddMessage 不校验归属，仅供内部流程使用；带 ClientMessageID 的重复写入返回已有消息（填回 msg）
 	AddMessage(ctx context.Context, conversationID int64, msg *entity.Message) error
 	GetMessages(ctx context.Context, conversationID int64, limit int) ([]*entity.Message, error)
+	// GetMessagesAfter 不校验归属，按 ID 正序读取 afterID 之后的至多 limit 条消息，仅供内部流程使用
+	GetMessagesAfter(ctx context.Context, conversationID, afterID int64, limit int) ([]*entity.Message, error)
+	// ListMessages 以消息 ID 为游标分页读取用户有权访问的会话消息，用于前端无限滚动
+	ListMessages(ctx context.Context, userID int64, query entity.MessageQuery) (*MessagePage, error)
+	// SummarizeConversation 将摘要之后的新消息交由模型增量合并进会话摘要并保存，返回最新摘要
 	SummarizeConversation(ctx context.Context, conversationID int64) (string, error)
+	// SetSummaryChat 注册生成摘要与标题所用的 ChatService
+	SetSummaryChat(chat ChatService)
+	// SetTitleConfig 配置自动标题生成（开关、使用的端点、长度）
+	SetTitleConfig(cfg ConversationTitleConfig)
+	// GenerateTitle 基于首轮对话生成标题，需写入权限，模型调用计入 userID；
+	// 会话已有标题时直接返回（force 时重新生成并覆盖）
+	GenerateTitle(ctx context.Context, userID, conversationID int64, force bool) (string, error)
+	// GetConversationSettings 返回会话级覆盖设置（系统提示追加、温度、偏好端点）
+	GetConversationSettings(ctx context.Context, userID, conversationID int64) (*entity.ConversationSettings, error)
+	// UpdateConversationSettings 整体替换会话级覆盖设置，需写入权限
+	UpdateConversationSettings(ctx context.Context, userID, conversationID int64, settings *entity.ConversationSettings) (*entity.ConversationSettings, error)
+	// RecordUsage 累加一次绑定该会话的模型调用用量与成本
+	RecordUsage(ctx context.Context, conversationID int64, usage *TokenUsage, costUSD float64) error
+	// GetConversationUsage 返回用户有读取权限的会话的累计用量，用于前端用量展示
+	GetConversationUsage(ctx context.Context, userID, conversationID int64) (*entity.ConversationUsage, error)
+	// GetConversationStats 汇总会话的消息数、用量、成本、使用过的模型与持续时间，用于聊天界面的用量面板
+	GetConversationStats(ctx context.Context, userID, conversationID int64) (*ConversationStats, error)
+	// ExportConversation 导出用户有读取权限的会话及其消息，includeBranches 时包含分支
+	ExportConversation(ctx context.Context, userID, conversationID int64, includeBranches bool) (*ConversationExport, error)
+	// ImportConversation 将导出文档导入为用户的新会话（消息与分支重新分配 ID）
+	ImportConversation(ctx context.Context, userID int64, doc *ConversationExport) (*entity.Conversation, error)
+	// CreateBranch 自 fromMessageID（须属于该会话，0 表示不继承历史）处创建分支
 	CreateBranch(ctx context.Context, conversationID int64, fromMessageID int64) (*entity.Conversation, error)
+	// ListBranches 列出用户有读取权限的会话的直接分支
+	ListBranches(ctx context.Context, userID, conversationID int64) ([]*entity.Conversation, error)
+	// GetBranchTree 返回会话所在的分支树（以用户可读的最上层祖先为根）
+	GetBranchTree(ctx context.Context, userID, conversationID int64) (*ConversationBranchNode, error)
+	// GetBranchMessages 解析分支视角下最近的消息，不足时回溯父会话分支起点之前的消息
+	GetBranchMessages(ctx context.Context, userID, conversationID int64, limit int) (*BranchMessages, error)
+	// CreateShareLink 由归属用户为会话生成脱敏的只读快照与分享令牌，ttl 为 0 表示不过期
+	CreateShareLink(ctx context.Context, userID, conversationID int64, ttl time.Duration) (*entity.ConversationShare, error)
+	// ListShareLinks 由归属用户列出会话的分享（不含快照内容）
+	ListShareLinks(ctx context.Context, userID, conversationID int64) ([]*entity.ConversationShare, error)
+	// RevokeShareLink 由归属用户撤销分享
+	RevokeShareLink(ctx context.Context, userID, conversationID, shareID int64) error
+	// GetSharedConversation 无需登录，按令牌读取未撤销、未过期的分享快照
+	GetSharedConversation(ctx context.Context, token string) (*SharedConversation, error)
+	// SubmitMessageFeedback 提交或覆盖用户对助手消息的反馈，并按消息来源关联模型/模板；带 A/B 信息的首次点赞记为转化
+	SubmitMessageFeedback(ctx context.Context, userID, conversationID int64, req MessageFeedbackRequest) (*entity.MessageFeedback, error)
+	// GetMessageFeedback 返回用户对消息的反馈，未反馈时返回 nil
+	GetMessageFeedback(ctx context.Context, userID, conversationID, messageID int64) (*entity.MessageFeedback, error)
+	// GetStoryState 返回故事会话的结构化进度（章节/场景/任务）
+	GetStoryState(ctx context.Context, userID, conversationID int64) (*StoryStateView, error)
+	// TransitionStoryState 校验并应用故事状态流转，同时记录流转历史；需写入权限
+	TransitionStoryState(ctx context.Context, userID, conversationID int64, req StoryTransition) (*StoryStateView, error)
+	// ListStoryStateChanges 按序号倒序分页读取故事状态流转历史
+	ListStoryStateChanges(ctx context.Context, userID, conversationID, beforeSeq int64, limit int) ([]*entity.StoryStateChange, error)
+	// ArchiveConversation 归档会话，归档后默认不出现在会话列表中，仍可读取与继续对话
+	ArchiveConversation(ctx context.Context, userID, conversationID int64) error
+	// UnarchiveConversation 取消归档
+	UnarchiveConversation(ctx context.Context, userID, conversationID int64) error
+	// DeleteConversation 软删除会话及其消息，保留期满后由 ConversationPurger 物理删除
+	DeleteConversation(ctx context.Context, userID, conversationID int64) error
 	CompressHistory(ctx context.Context, conversationID int64) error
 }
 
+// MessagePage 消息分页结果；NextBeforeID/NextAfterID 为继续向更早/更新方向翻页的游标，
+// HasMore 描述请求方向（仅指定 after 时为更新方向，否则为更早方向）是否还有更多消息
+type MessagePage struct {
+	Messages     []*entity.Message `json:"messages"`
+	Total        int64             `json:"total"`
+	HasMore      bool              `json:"has_more"`
+	NextBeforeID int64             `json:"next_before_id,omitempty"`
+	NextAfterID  int64             `json:"next_after_id,omitempty"`
+}
+
 type conversationServiceImpl struct {
-	repo repo.ConversationRepo
+	repo    repo.ConversationRepo
+	metrics repo.MetricsRepo
+	super   *runtime.TaskSupervisor
+
+	summaryMu   sync.Mutex
+	chat        ChatService
+	summarizing map[int64]bool // 正在后台刷新摘要的会话
+	titling     map[int64]bool // 正在后台生成标题的会话
+	titleConfig ConversationTitleConfig
+	semantic    ConversationSemanticSearcher
+	indexer     MessageIndexer
 }
 
-func NewConversationService(repo repo.ConversationRepo) ConversationService {
-	return &conversationServiceImpl{repo: repo}
+func NewConversationService(repo repo.ConversationRepo, metrics repo.MetricsRepo) ConversationService {
+	return &conversationServiceImpl{
+		repo:        repo,
+		metrics:     metrics,
+		super:       runtime.NewTaskSupervisor("llm.conversation"),
+		summarizing: map[int64]bool{},
+		titling:     map[int64]bool{},
+		titleConfig: ConversationTitleConfig{Enabled: true},
+	}
 }
 
 func (s *conversationServiceImpl) CreateConversation(ctx context.Context, userID int64, metadata map[string]any) (*entity.Conversation, error) {
@@ -36,7 +149,7 @@ func (s *conversationServiceImpl) CreateConversation(ctx context.Context, userID
 
 	conv := &entity.Conversation{
 		UserID: userID,
-		Status: "active",
+		Status: entity.ConversationStatusActive,
 	}
 
 	// 处理 metadata
@@ -65,12 +178,105 @@ func (s *conversationServiceImpl) GetConversation(ctx context.Context, conversat
 	return s.repo.GetConversation(ctx, conversationID)
 }
 
+func (s *conversationServiceImpl) ListConversations(ctx context.Context, filter entity.ConversationFilter, limit, offset int) ([]*entity.Conversation, int64, error) {
+	if filter.UserID <= 0 {
+		return nil, 0, errorx.New(errorx.Validation, "userID 无效")
+	}
+	if filter.Status == entity.ConversationStatusDeleted {
+		return nil, 0, errorx.New(errorx.Validation, "不支持列出已删除的会话")
+	}
+	switch filter.Sort {
+	case "", entity.ConversationSortLastActivity, entity.ConversationSortCreated, entity.ConversationSortUpdated:
+	default:
+		return nil, 0, errorx.New(errorx.Validation, "sort 仅支持 last_activity/created/updated")
+	}
+	list, total, err := s.repo.ListConversations(ctx, filter, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := s.fillUnread(ctx, filter.UserID, list); err != nil {
+		return nil, 0, err
+	}
+	return list, total, nil
+}
+
+// fillUnread 一次查询填充列表中各会话的未读数
+func (s *conversationServiceImpl) fillUnread(ctx context.Context, userID int64, list []*entity.Conversation) error {
+	if len(list) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(list))
+	for i, c := range list {
+		ids[i] = c.ID
+	}
+	states, err := s.repo.ListReadStates(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+	for _, c := range list {
+		if st, ok := states[c.ID]; ok {
+			c.UnreadCount = st.UnreadCount
+		}
+	}
+	return nil
+}
+
+func (s *conversationServiceImpl) MarkConversationRead(ctx context.Context, userID, conversationID, messageID int64) (*entity.ConversationReadState, error) {
+	if messageID < 0 {
+		return nil, errorx.New(errorx.Validation, "message_id 无效")
+	}
+	if _, err := s.authorize(ctx, userID, conversationID, entity.ConversationAccessViewer); err != nil {
+		return nil, err
+	}
+	if messageID == 0 {
+		latest, _, _, err := s.repo.ListMessages(ctx, entity.MessageQuery{ConversationID: conversationID, Limit: 1})
+		if err != nil {
+			return nil, err
+		}
+		if len(latest) > 0 {
+			messageID = latest[0].ID
+		}
+	}
+	return s.repo.MarkRead(ctx, conversationID, userID, messageID)
+}
+
 func (s *conversationServiceImpl) AddMessage(ctx context.Context, conversationID int64, msg *entity.Message) error {
 	if msg == nil {
 		return errorx.New(errorx.Validation, "消息不能为空")
 	}
 	msg.ConversationID = conversationID
-	return s.repo.AddMessage(ctx, msg)
+	if msg.ClientMessageID != nil {
+		id := strings.TrimSpace(*msg.ClientMessageID)
+		if len(id) > 64 {
+			return errorx.New(errorx.Validation, "client_message_id 过长")
+		}
+		if id == "" {
+			msg.ClientMessageID = nil
+		} else {
+			msg.ClientMessageID = &id
+		}
+	}
+	if msg.Tokens <= 0 {
+		msg.Tokens = estimateMessageTokens(Message{Content: msg.Content})
+	}
+	created, err := s.repo.AddMessage(ctx, msg)
+	if err != nil {
+		return err
+	}
+	// 客户端重试的重复写入：msg 已填充为已有消息，不再重复计量与触发后续任务
+	if !created {
+		return nil
+	}
+	// 用量计数失败不影响消息写入
+	_ = s.repo.AddUsage(ctx, conversationID, entity.ConversationUsage{MessageTokens: int64(msg.Tokens)})
+	if conv, err := s.repo.GetConversation(ctx, conversationID); err == nil && conv != nil {
+		s.maybeRefreshSummary(ctx, conv)
+		s.maybeGenerateTitle(ctx, conv, msg)
+		if indexer := s.messageIndexer(); indexer != nil {
+			indexer.IndexMessage(ctx, conv, msg)
+		}
+	}
+	return nil
 }
 
 func (s *conversationServiceImpl) GetMessages(ctx context.Context, conversationID int64, limit int) ([]*entity.Message, error) {
@@ -80,31 +286,48 @@ func (s *conversationServiceImpl) GetMessages(ctx context.Context, conversationI
 	return s.repo.GetMessages(ctx, conversationID, limit)
 }
 
-func (s *conversationServiceImpl) SummarizeConversation(ctx context.Context, conversationID int64) (string, error) {
-	msgs, err := s.repo.GetMessages(ctx, conversationID, 50)
+func (s *conversationServiceImpl) GetMessagesAfter(ctx context.Context, conversationID, afterID int64, limit int) ([]*entity.Message, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if afterID < 0 {
+		afterID = 0
+	}
+	return s.repo.GetMessagesAfter(ctx, conversationID, afterID, limit)
+}
+
+func (s *conversationServiceImpl) ListMessages(ctx context.Context, userID int64, query entity.MessageQuery) (*MessagePage, error) {
+	if query.BeforeID < 0 || query.AfterID < 0 {
+		return nil, errorx.New(errorx.Validation, "游标无效")
+	}
+	if _, err := s.authorize(ctx, userID, query.ConversationID, entity.ConversationAccessViewer); err != nil {
+		return nil, err
+	}
+	msgs, total, hasMore, err := s.repo.ListMessages(ctx, query)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	page := &MessagePage{Messages: msgs, Total: total, HasMore: hasMore}
 	if len(msgs) == 0 {
-		return "", nil
-	}
-
-	var sb strings.Builder
-	for i := len(msgs) - 1; i >= 0; i-- {
-		m := msgs[i]
-		sb.WriteString(m.Role)
-		sb.WriteString(": ")
-		sb.WriteString(m.Content)
-		sb.WriteString("\n")
-		if sb.Len() > 800 {
-			break
-		}
+		return page, nil
+	}
+	ids := make([]int64, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
 	}
-	summary := sb.String()
-	if len(summary) > 800 {
-		summary = summary[:800]
+	attachments, err := s.repo.ListAttachments(ctx, ids)
+	if err != nil {
+		return nil, err
 	}
-	return summary, nil
+	for _, m := range msgs {
+		m.Attachments = attachments[m.ID]
+	}
+	oldest, newest := msgs[0].ID, msgs[len(msgs)-1].ID
+	if !query.Ascending {
+		oldest, newest = newest, oldest
+	}
+	page.NextBeforeID, page.NextAfterID = oldest, newest
+	return page, nil
 }
 
 func (s *conversationServiceImpl) CreateBranch(ctx context.Context, conversationID int64, fromMessageID int64) (*entity.Conversation, error) {
@@ -115,6 +338,9 @@ func (s *conversationServiceImpl) CreateBranch(ctx context.Context, conversation
 	if base == nil {
 		return nil, errorx.New(errorx.NotFound, "会话不存在")
 	}
+	if err := s.validateBranchPoint(ctx, conversationID, fromMessageID); err != nil {
+		return nil, err
+	}
 
 	meta := map[string]any{}
 	if strings.TrimSpace(base.MetadataJSON) != "" {
@@ -128,8 +354,9 @@ func (s *conversationServiceImpl) CreateBranch(ctx context.Context, conversation
 		ParentID:         &base.ID,
 		Type:             base.Type,
 		Title:            base.Title + " (branch)",
-		Status:           "active",
+		Status:           entity.ConversationStatusActive,
 		PromptTemplateID: base.PromptTemplateID,
+		SettingsJSON:     base.SettingsJSON,
 		MetadataJSON:     string(metaJSON),
 	}
 	if err := s.repo.CreateConversation(ctx, branch); err != nil {
@@ -140,5 +367,32 @@ func (s *conversationServiceImpl) CreateBranch(ctx context.Context, conversation
 
 func (s *conversationServiceImpl) CompressHistory(ctx context.Context, conversationID int64) error {
 	// 默认保留最近 100 条消息
-	return s.repo.TrimMessages(ctx, conversationID, 100)
+	_, err := s.repo.TrimMessages(ctx, conversationID, 100)
+	return err
+}
+
+func (s *conversationServiceImpl) ArchiveConversation(ctx context.Context, userID, conversationID int64) error {
+	return s.setStatus(ctx, userID, conversationID, entity.ConversationStatusArchived)
+}
+
+func (s *conversationServiceImpl) UnarchiveConversation(ctx context.Context, userID, conversationID int64) error {
+	return s.setStatus(ctx, userID, conversationID, entity.ConversationStatusActive)
+}
+
+func (s *conversationServiceImpl) setStatus(ctx context.Context, userID, conversationID int64, status string) error {
+	conv, err := s.authorize(ctx, userID, conversationID, conversationAccessOwner)
+	if err != nil {
+		return err
+	}
+	if conv.Status == status {
+		return nil
+	}
+	return s.repo.SetStatus(ctx, conversationID, status)
+}
+
+func (s *conversationServiceImpl) DeleteConversation(ctx context.Context, userID, conversationID int64) error {
+	if _, err := s.authorize(ctx, userID, conversationID, conversationAccessOwner); err != nil {
+		return err
+	}
+	return s.repo.SoftDelete(ctx, conversationID, time.Now())
 }
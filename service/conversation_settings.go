@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+const (
+	// maxSettingsSystemPromptRunes 会话级系统提示的字符上限
+	maxSettingsSystemPromptRunes = 4000
+	// maxSettingsModelTagLength 偏好端点标识的长度上限（与端点名称/模型名字段一致）
+	maxSettingsModelTagLength = 100
+)
+
+// GetConversationSettings 返回用户有读取权限的会话的覆盖设置，未设置时为零值
+func (s *conversationServiceImpl) GetConversationSettings(ctx context.Context, userID, conversationID int64) (*entity.ConversationSettings, error) {
+	conv, err := s.authorize(ctx, userID, conversationID, entity.ConversationAccessViewer)
+	if err != nil {
+		return nil, err
+	}
+	return parseConversationSettings(conv.SettingsJSON), nil
+}
+
+// UpdateConversationSettings 整体替换会话覆盖设置，需写入权限；settings 为 nil 时清空
+func (s *conversationServiceImpl) UpdateConversationSettings(ctx context.Context, userID, conversationID int64, settings *entity.ConversationSettings) (*entity.ConversationSettings, error) {
+	if _, err := s.authorize(ctx, userID, conversationID, entity.ConversationAccessEditor); err != nil {
+		return nil, err
+	}
+	if settings == nil {
+		settings = &entity.ConversationSettings{}
+	}
+	normalized := *settings
+	normalized.SystemPrompt = strings.TrimSpace(normalized.SystemPrompt)
+	normalized.ModelTag = strings.TrimSpace(normalized.ModelTag)
+	if len([]rune(normalized.SystemPrompt)) > maxSettingsSystemPromptRunes {
+		return nil, errorx.New(errorx.Validation, "会话系统提示过长")
+	}
+	if len(normalized.ModelTag) > maxSettingsModelTagLength {
+		return nil, errorx.New(errorx.Validation, "model_tag 过长")
+	}
+	if t := normalized.Temperature; t != nil && (*t < 0 || *t > 2) {
+		return nil, errorx.New(errorx.Validation, "temperature 须在 0 到 2 之间")
+	}
+
+	settingsJSON := ""
+	if normalized != (entity.ConversationSettings{}) {
+		data, err := json.Marshal(normalized)
+		if err != nil {
+			return nil, errorx.Wrap(err, errorx.Internal, "序列化会话设置失败")
+		}
+		settingsJSON = string(data)
+	}
+	if err := s.repo.SetSettings(ctx, conversationID, settingsJSON); err != nil {
+		return nil, err
+	}
+	return &normalized, nil
+}
+
+// parseConversationSettings 解析会话设置，为空或无效时返回零值
+func parseConversationSettings(settingsJSON string) *entity.ConversationSettings {
+	settings := &entity.ConversationSettings{}
+	if strings.TrimSpace(settingsJSON) != "" {
+		_ = json.Unmarshal([]byte(settingsJSON), settings)
+	}
+	return settings
+}
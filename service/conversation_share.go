@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+const (
+	// maxShareTTL 分享链接的最长有效期
+	maxShareTTL = 365 * 24 * time.Hour
+	// maxShareMessages 快照最多包含的消息数，超出时保留最近的消息
+	maxShareMessages = 2000
+)
+
+// ConversationShareSnapshot 分享快照：仅包含用户与助手消息，正文已做 PII 与密钥脱敏
+type ConversationShareSnapshot struct {
+	Title     string           `json:"title"`
+	Type      string           `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	SharedAt  time.Time        `json:"shared_at"`
+	Messages  []*SharedMessage `json:"messages"`
+	// Truncated 会话消息超过 maxShareMessages，快照仅保留最近的消息
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// SharedMessage 快照中的消息
+type SharedMessage struct {
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SharedConversation 公开访问分享链接时返回的内容
+type SharedConversation struct {
+	ExpiresAt *time.Time                 `json:"expires_at,omitempty"`
+	Snapshot  *ConversationShareSnapshot `json:"snapshot"`
+}
+
+// CreateShareLink 由会话归属用户为会话当前内容生成只读快照与分享令牌；ttl 为 0 表示不过期
+func (s *conversationServiceImpl) CreateShareLink(ctx context.Context, userID, conversationID int64, ttl time.Duration) (*entity.ConversationShare, error) {
+	if ttl < 0 || ttl > maxShareTTL {
+		return nil, errorx.New(errorx.Validation, "分享有效期须在 0 到 365 天之间")
+	}
+	conv, err := s.authorize(ctx, userID, conversationID, conversationAccessOwner)
+	if err != nil {
+		return nil, err
+	}
+	exported, err := s.exportTree(ctx, conv, false, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	snapshot := &ConversationShareSnapshot{
+		Title:     maskShareText(conv.Title),
+		Type:      conv.Type,
+		CreatedAt: conv.CreatedAt,
+		SharedAt:  now,
+		Messages:  []*SharedMessage{},
+	}
+	// 系统消息可能包含提示词等内部内容，不进入快照
+	for _, m := range exported.Messages {
+		if m.Role == "system" {
+			continue
+		}
+		snapshot.Messages = append(snapshot.Messages, &SharedMessage{
+			Role:      m.Role,
+			Content:   maskShareText(m.Content),
+			CreatedAt: m.CreatedAt,
+		})
+	}
+	if len(snapshot.Messages) > maxShareMessages {
+		snapshot.Messages = snapshot.Messages[len(snapshot.Messages)-maxShareMessages:]
+		snapshot.Truncated = true
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "序列化分享快照失败")
+	}
+	token, err := newShareToken()
+	if err != nil {
+		return nil, err
+	}
+	share := &entity.ConversationShare{
+		Token:          token,
+		ConversationID: conv.ID,
+		UserID:         userID,
+		SnapshotJSON:   string(data),
+		MessageCount:   len(snapshot.Messages),
+	}
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		share.ExpiresAt = &expires
+	}
+	if err := s.repo.CreateShare(ctx, share); err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+func (s *conversationServiceImpl) ListShareLinks(ctx context.Context, userID, conversationID int64) ([]*entity.ConversationShare, error) {
+	if _, err := s.authorize(ctx, userID, conversationID, conversationAccessOwner); err != nil {
+		return nil, err
+	}
+	return s.repo.ListShares(ctx, conversationID)
+}
+
+func (s *conversationServiceImpl) RevokeShareLink(ctx context.Context, userID, conversationID, shareID int64) error {
+	if _, err := s.authorize(ctx, userID, conversationID, conversationAccessOwner); err != nil {
+		return err
+	}
+	revoked, err := s.repo.RevokeShare(ctx, conversationID, shareID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return errorx.New(errorx.NotFound, "分享不存在或已撤销")
+	}
+	return nil
+}
+
+// GetSharedConversation 按令牌读取分享快照；令牌不存在、已撤销、已过期或会话已删除时均返回 NotFound
+func (s *conversationServiceImpl) GetSharedConversation(ctx context.Context, token string) (*SharedConversation, error) {
+	notFound := errorx.New(errorx.NotFound, "分享不存在或已失效")
+	if token == "" || len(token) > 64 {
+		return nil, notFound
+	}
+	share, err := s.repo.GetShareByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if share == nil || share.RevokedAt != nil || (share.ExpiresAt != nil && time.Now().After(*share.ExpiresAt)) {
+		return nil, notFound
+	}
+	conv, err := s.repo.GetConversation(ctx, share.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil {
+		return nil, notFound
+	}
+	var snapshot ConversationShareSnapshot
+	if err := json.Unmarshal([]byte(share.SnapshotJSON), &snapshot); err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "解析分享快照失败")
+	}
+	return &SharedConversation{ExpiresAt: share.ExpiresAt, Snapshot: &snapshot}, nil
+}
+
+// maskShareText 分享快照对外公开，无论策略如何配置都使用内置检测器掩码全部 PII 命中与密钥
+func maskShareText(text string) string {
+	return scanPII(defaultPIIDetectors, maskSecrets(text), true).Content
+}
+
+func newShareToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errorx.Wrap(err, errorx.Internal, "生成分享令牌失败")
+	}
+	return hex.EncodeToString(buf), nil
+}
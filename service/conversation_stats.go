@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"gochen-llm/entity"
+)
+
+// ConversationStats 会话统计：消息数来自消息表，用量与成本来自会话累计值，模型分布来自调用指标
+type ConversationStats struct {
+	ConversationID int64                     `json:"conversation_id"`
+	MessageCount   int64                     `json:"message_count"`
+	MessagesByRole map[string]int64          `json:"messages_by_role"`
+	Usage          *entity.ConversationUsage `json:"usage"`
+	// Models 绑定该会话的模型调用按 provider+model 的汇总（含测试流量与失败调用）
+	Models []*entity.ModelMetricsReport `json:"models"`
+	// FirstMessageAt/LastMessageAt 首条与最近一条消息的时间，DurationSeconds 为两者之差
+	FirstMessageAt  *time.Time `json:"first_message_at,omitempty"`
+	LastMessageAt   *time.Time `json:"last_message_at,omitempty"`
+	DurationSeconds int64      `json:"duration_seconds"`
+}
+
+func (s *conversationServiceImpl) GetConversationStats(ctx context.Context, userID, conversationID int64) (*ConversationStats, error) {
+	conv, err := s.authorize(ctx, userID, conversationID, entity.ConversationAccessViewer)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := s.repo.CountMessagesByRole(ctx, conv.ID)
+	if err != nil {
+		return nil, err
+	}
+	stats := &ConversationStats{
+		ConversationID: conv.ID,
+		MessagesByRole: counts,
+		Usage:          conversationUsage(conv),
+		Models:         []*entity.ModelMetricsReport{},
+		LastMessageAt:  conv.LastMessageAt,
+	}
+	for _, n := range counts {
+		stats.MessageCount += n
+	}
+
+	if stats.MessageCount > 0 {
+		first, err := s.repo.GetMessagesAfter(ctx, conv.ID, 0, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(first) > 0 {
+			at := first[0].CreatedAt
+			stats.FirstMessageAt = &at
+		}
+	}
+	if stats.FirstMessageAt != nil && stats.LastMessageAt != nil && stats.LastMessageAt.After(*stats.FirstMessageAt) {
+		stats.DurationSeconds = int64(stats.LastMessageAt.Sub(*stats.FirstMessageAt) / time.Second)
+	}
+
+	if s.metrics != nil {
+		id := conv.ID
+		models, err := s.metrics.AggregateByModel(ctx, entity.MetricsFilter{ConversationID: &id, IncludeTest: true})
+		if err != nil {
+			return nil, err
+		}
+		stats.Models = models
+	}
+	return stats, nil
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+// StoryStateView 故事会话的当前进度
+type StoryStateView struct {
+	ConversationID int64              `json:"conversation_id"`
+	State          *entity.StoryState `json:"state"`
+	// Seq 已应用的流转次数，提交流转时作为 expected_seq 传回以检测并发修改
+	Seq int64 `json:"seq"`
+}
+
+// StoryTransition 故事状态流转请求
+type StoryTransition struct {
+	Event  string `json:"event"`             // 见 entity.StoryEvent*
+	TaskID string `json:"task_id,omitempty"` // start_task 时必填
+	Reason string `json:"reason,omitempty"`
+	// ExpectedSeq 调用方看到的状态序号；为空时以服务端当前序号为准（不检测并发修改）
+	ExpectedSeq *int64 `json:"expected_seq,omitempty"`
+}
+
+func (s *conversationServiceImpl) GetStoryState(ctx context.Context, userID, conversationID int64) (*StoryStateView, error) {
+	conv, err := s.storyConversation(ctx, userID, conversationID, entity.ConversationAccessViewer)
+	if err != nil {
+		return nil, err
+	}
+	state, err := parseStoryState(conv.StoryStateJSON)
+	if err != nil {
+		return nil, err
+	}
+	return &StoryStateView{ConversationID: conv.ID, State: state, Seq: conv.StoryStateSeq}, nil
+}
+
+func (s *conversationServiceImpl) TransitionStoryState(ctx context.Context, userID, conversationID int64, req StoryTransition) (*StoryStateView, error) {
+	conv, err := s.storyConversation(ctx, userID, conversationID, entity.ConversationAccessEditor)
+	if err != nil {
+		return nil, err
+	}
+	if len([]rune(req.Reason)) > 500 {
+		return nil, errorx.New(errorx.Validation, "reason 不能超过 500 个字符")
+	}
+	expected := conv.StoryStateSeq
+	if req.ExpectedSeq != nil {
+		if *req.ExpectedSeq != expected {
+			return nil, errorx.New(errorx.Validation, "故事状态已被其他请求更新，请刷新后重试")
+		}
+		expected = *req.ExpectedSeq
+	}
+	current, err := parseStoryState(conv.StoryStateJSON)
+	if err != nil {
+		return nil, err
+	}
+	next, err := applyStoryEvent(*current, req.Event, strings.TrimSpace(req.TaskID))
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(next)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "序列化故事状态失败")
+	}
+	if err := s.repo.ApplyStoryState(ctx, conv.ID, expected, string(data), &entity.StoryStateChange{
+		Event:   req.Event,
+		ActorID: userID,
+		Reason:  req.Reason,
+	}); err != nil {
+		return nil, err
+	}
+	return &StoryStateView{ConversationID: conv.ID, State: &next, Seq: expected + 1}, nil
+}
+
+func (s *conversationServiceImpl) ListStoryStateChanges(ctx context.Context, userID, conversationID, beforeSeq int64, limit int) ([]*entity.StoryStateChange, error) {
+	if _, err := s.storyConversation(ctx, userID, conversationID, entity.ConversationAccessViewer); err != nil {
+		return nil, err
+	}
+	return s.repo.ListStoryStateChanges(ctx, conversationID, beforeSeq, limit)
+}
+
+func (s *conversationServiceImpl) storyConversation(ctx context.Context, userID, conversationID int64, need string) (*entity.Conversation, error) {
+	conv, err := s.authorize(ctx, userID, conversationID, need)
+	if err != nil {
+		return nil, err
+	}
+	if conv.Type != entity.ConversationTypeStory {
+		return nil, errorx.New(errorx.Validation, "仅故事会话支持故事状态")
+	}
+	return conv, nil
+}
+
+// parseStoryState 尚无流转记录的故事从第 1 章第 1 场景开始
+func parseStoryState(raw string) (*entity.StoryState, error) {
+	state := &entity.StoryState{Chapter: 1, Scene: 1}
+	if strings.TrimSpace(raw) == "" {
+		return state, nil
+	}
+	if err := json.Unmarshal([]byte(raw), state); err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "解析故事状态失败")
+	}
+	return state, nil
+}
+
+// applyStoryEvent 校验并应用一次流转，返回新状态；不修改入参
+func applyStoryEvent(state entity.StoryState, event, taskID string) (entity.StoryState, error) {
+	if state.Finished {
+		return state, errorx.New(errorx.Validation, "故事已完结，不能继续流转")
+	}
+	taskActive := state.TaskStatus == entity.StoryTaskActive
+	state.CompletedTasks = append([]string(nil), state.CompletedTasks...)
+	switch event {
+	case entity.StoryEventStartTask:
+		if taskID == "" || len(taskID) > 100 {
+			return state, errorx.New(errorx.Validation, "task_id 不能为空且不超过 100 个字符")
+		}
+		if taskActive {
+			return state, errorx.New(errorx.Validation, fmt.Sprintf("任务 %s 仍在进行中", state.TaskID))
+		}
+		for _, id := range state.CompletedTasks {
+			if id == taskID {
+				return state, errorx.New(errorx.Validation, fmt.Sprintf("任务 %s 已完成", taskID))
+			}
+		}
+		state.TaskID, state.TaskStatus = taskID, entity.StoryTaskActive
+	case entity.StoryEventCompleteTask, entity.StoryEventFailTask:
+		if !taskActive {
+			return state, errorx.New(errorx.Validation, "当前没有进行中的任务")
+		}
+		if taskID != "" && taskID != state.TaskID {
+			return state, errorx.New(errorx.Validation, fmt.Sprintf("进行中的任务为 %s", state.TaskID))
+		}
+		if event == entity.StoryEventCompleteTask {
+			state.TaskStatus = entity.StoryTaskCompleted
+			state.CompletedTasks = append(state.CompletedTasks, state.TaskID)
+		} else {
+			state.TaskStatus = entity.StoryTaskFailed
+		}
+	case entity.StoryEventNextScene, entity.StoryEventNextChapter, entity.StoryEventFinish:
+		if taskActive {
+			return state, errorx.New(errorx.Validation, fmt.Sprintf("任务 %s 仍在进行中", state.TaskID))
+		}
+		switch event {
+		case entity.StoryEventNextScene:
+			state.Scene++
+		case entity.StoryEventNextChapter:
+			state.Chapter, state.Scene = state.Chapter+1, 1
+		default:
+			state.Finished = true
+		}
+		state.TaskID, state.TaskStatus = "", ""
+	default:
+		return state, errorx.New(errorx.Validation, "不支持的故事事件: "+event)
+	}
+	return state, nil
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+// ConversationSummaryPromptName 会话摘要提示词模板名称（用户作用域可覆盖），
+// 模板变量：previous_summary、conversation_title、conversation_type；未配置时使用内置提示
+const ConversationSummaryPromptName = "llm.conversation_summary"
+
+const (
+	// summaryRefreshEvery 未纳入摘要的消息累计达到该条数时后台刷新摘要
+	summaryRefreshEvery = 10
+	// summaryBatchMessages 单次送入模型的新消息条数上限
+	summaryBatchMessages = 50
+	// summaryBatchRunes 单次送入模型的新消息字符数上限
+	summaryBatchRunes = 12000
+	// summaryMaxRounds 单次刷新最多调用模型的轮数，剩余消息留待下次刷新
+	summaryMaxRounds = 5
+	// summaryMessageRunes 单条消息送入模型的字符上限
+	summaryMessageRunes = 2000
+)
+
+const defaultConversationSummaryPrompt = `你负责维护一段对话的滚动摘要。
+已有摘要（可能为空）：
+%s
+
+请结合用户给出的新增对话更新摘要：保留人物、事实、约定、偏好与未完成的问题，删除已过时的内容，不要添加对话中没有的信息。
+仅输出更新后的摘要正文，不超过 300 字。`
+
+// SetSummaryChat 注册生成摘要与标题所用的 ChatService；由 NewChatService 自动注册，未注册时摘要退化为截取最近消息、不自动生成标题
+func (s *conversationServiceImpl) SetSummaryChat(chat ChatService) {
+	s.summaryMu.Lock()
+	defer s.summaryMu.Unlock()
+	s.chat = chat
+}
+
+func (s *conversationServiceImpl) summaryChat() ChatService {
+	s.summaryMu.Lock()
+	defer s.summaryMu.Unlock()
+	return s.chat
+}
+
+func (s *conversationServiceImpl) SummarizeConversation(ctx context.Context, conversationID int64) (string, error) {
+	conv, err := s.repo.GetConversation(ctx, conversationID)
+	if err != nil {
+		return "", err
+	}
+	if conv == nil {
+		return "", errorx.New(errorx.NotFound, "会话不存在")
+	}
+	chat := s.summaryChat()
+	if chat == nil {
+		return s.truncatedSummary(ctx, conversationID)
+	}
+	return s.refreshSummary(ctx, chat, conv)
+}
+
+// refreshSummary 将摘要之后的新消息分批送入模型，在已有摘要的基础上增量更新并持久化
+func (s *conversationServiceImpl) refreshSummary(ctx context.Context, chat ChatService, conv *entity.Conversation) (string, error) {
+	summary, lastID := conv.Summary, conv.SummaryMessageID
+	for round := 0; round < summaryMaxRounds; round++ {
+		msgs, err := s.repo.GetMessagesAfter(ctx, conv.ID, lastID, summaryBatchMessages)
+		if err != nil {
+			return summary, err
+		}
+		if len(msgs) == 0 {
+			break
+		}
+		transcript, covered := summaryTranscript(msgs)
+		next, err := s.generateSummary(ctx, chat, conv, summary, transcript)
+		if err != nil {
+			return summary, err
+		}
+		summary, lastID = next, covered
+		if err := s.repo.UpdateSummary(ctx, conv.ID, summary, lastID); err != nil {
+			return summary, err
+		}
+		if len(msgs) < summaryBatchMessages {
+			break
+		}
+	}
+	return summary, nil
+}
+
+// generateSummary 优先使用 llm.conversation_summary 模板，模板不存在时使用内置提示
+func (s *conversationServiceImpl) generateSummary(ctx context.Context, chat ChatService, conv *entity.Conversation, previous, transcript string) (string, error) {
+	metadata := map[string]interface{}{"category": "conversation_summary", "conversation_id": conv.ID}
+	messages := []Message{{Role: "user", Content: transcript}}
+	resp, err := chat.ChatWithPrompt(ctx, &PromptChatRequest{
+		UserID:        conv.UserID,
+		PromptName:    ConversationSummaryPromptName,
+		PromptScope:   entity.PromptScopeUser,
+		PromptScopeID: conv.UserID,
+		Variables: map[string]interface{}{
+			"previous_summary":   previous,
+			"conversation_title": conv.Title,
+			"conversation_type":  conv.Type,
+		},
+		Messages: messages,
+		Metadata: metadata,
+	})
+	if errorx.Is(err, errorx.NotFound) {
+		if previous == "" {
+			previous = "（无）"
+		}
+		resp, err = chat.Chat(ctx, &ChatRequest{
+			UserID:      conv.UserID,
+			System:      fmt.Sprintf(defaultConversationSummaryPrompt, previous),
+			Messages:    messages,
+			Temperature: 0,
+			MaxTokens:   512,
+			Metadata:    metadata,
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+	if resp.Degraded {
+		return "", errorx.New(errorx.Internal, "摘要生成降级，保留原摘要")
+	}
+	summary := strings.TrimSpace(resp.Content)
+	if summary == "" {
+		return "", errorx.New(errorx.Internal, "模型返回的摘要为空")
+	}
+	return summary, nil
+}
+
+// summaryTranscript 按字符预算拼接新消息，返回文本与实际纳入的最后一条消息 ID（至少纳入一条）
+func summaryTranscript(msgs []*entity.Message) (string, int64) {
+	var sb strings.Builder
+	var lastID int64
+	used := 0
+	for i, m := range msgs {
+		content, _ := truncateRunes(m.Content, summaryMessageRunes)
+		line := m.Role + ": " + content + "\n"
+		n := len([]rune(line))
+		if i > 0 && used+n > summaryBatchRunes {
+			break
+		}
+		sb.WriteString(line)
+		used += n
+		lastID = m.ID
+	}
+	return sb.String(), lastID
+}
+
+// maybeRefreshSummary 新增消息后检查未纳入摘要的消息数，达到阈值时在后台刷新；同一会话同时只有一个刷新任务
+func (s *conversationServiceImpl) maybeRefreshSummary(ctx context.Context, conv *entity.Conversation) {
+	chat := s.summaryChat()
+	if chat == nil {
+		return
+	}
+	conversationID := conv.ID
+	pending, err := s.repo.CountMessagesAfter(ctx, conversationID, conv.SummaryMessageID)
+	if err != nil || pending < summaryRefreshEvery {
+		return
+	}
+	s.summaryMu.Lock()
+	if s.summarizing[conversationID] {
+		s.summaryMu.Unlock()
+		return
+	}
+	s.summarizing[conversationID] = true
+	s.summaryMu.Unlock()
+
+	bg := context.WithoutCancel(ctx)
+	s.super.Go(bg, "conversation_summary", func(ctx context.Context) {
+		defer func() {
+			s.summaryMu.Lock()
+			delete(s.summarizing, conversationID)
+			s.summaryMu.Unlock()
+		}()
+		cctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+		defer cancel()
+		_, _ = s.refreshSummary(cctx, chat, conv)
+	})
+}
+
+// truncatedSummary 未配置 ChatService 时的兜底：截取最近消息拼接
+func (s *conversationServiceImpl) truncatedSummary(ctx context.Context, conversationID int64) (string, error) {
+	msgs, err := s.repo.GetMessages(ctx, conversationID, 50)
+	if err != nil {
+		return "", err
+	}
+	if len(msgs) == 0 {
+		return "", nil
+	}
+
+	var sb strings.Builder
+	for i := len(msgs) - 1; i >= 0; i-- {
+		m := msgs[i]
+		sb.WriteString(m.Role)
+		sb.WriteString(": ")
+		sb.WriteString(m.Content)
+		sb.WriteString("\n")
+		if sb.Len() > 800 {
+			break
+		}
+	}
+	summary := sb.String()
+	if len(summary) > 800 {
+		summary = summary[:800]
+	}
+	return summary, nil
+}
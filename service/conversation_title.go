@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+const (
+	defaultConversationTitleRunes = 20
+	// conversationTitleInputRunes 送入模型的首轮对话字符上限
+	conversationTitleInputRunes = 1000
+)
+
+const conversationTitlePrompt = `请为下面的对话拟一个简短的标题，概括用户的主要意图。
+要求：使用与对话相同的语言，不超过 %d 个字，不加引号、书名号或句末标点，只输出标题本身。`
+
+// ConversationTitleConfig 自动标题生成配置
+type ConversationTitleConfig struct {
+	Enabled  bool   `json:"enabled"`   // 是否在首轮对话完成后自动生成标题
+	Endpoint string `json:"endpoint"`  // 使用的端点名称（建议配置低成本模型），为空按常规路由
+	MaxRunes int    `json:"max_runes"` // 标题字符上限，默认 20
+}
+
+func (s *conversationServiceImpl) SetTitleConfig(cfg ConversationTitleConfig) {
+	s.summaryMu.Lock()
+	defer s.summaryMu.Unlock()
+	s.titleConfig = cfg
+}
+
+func (s *conversationServiceImpl) currentTitleConfig() ConversationTitleConfig {
+	s.summaryMu.Lock()
+	defer s.summaryMu.Unlock()
+	cfg := s.titleConfig
+	if cfg.MaxRunes <= 0 {
+		cfg.MaxRunes = defaultConversationTitleRunes
+	}
+	return cfg
+}
+
+// maybeGenerateTitle 会话尚无标题且写入的是助手回复（首轮对话已完成）时，在后台生成标题
+func (s *conversationServiceImpl) maybeGenerateTitle(ctx context.Context, conv *entity.Conversation, msg *entity.Message) {
+	if conv.Title != "" || msg.Role != "assistant" || s.summaryChat() == nil || !s.currentTitleConfig().Enabled {
+		return
+	}
+	s.summaryMu.Lock()
+	if s.titling[conv.ID] {
+		s.summaryMu.Unlock()
+		return
+	}
+	s.titling[conv.ID] = true
+	s.summaryMu.Unlock()
+
+	conversationID := conv.ID
+	bg := context.WithoutCancel(ctx)
+	s.super.Go(bg, "conversation_title", func(ctx context.Context) {
+		defer func() {
+			s.summaryMu.Lock()
+			delete(s.titling, conversationID)
+			s.summaryMu.Unlock()
+		}()
+		cctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		conv, err := s.repo.GetConversation(cctx, conversationID)
+		if err != nil || conv == nil {
+			return
+		}
+		// 自动标题由系统触发，计入会话归属用户
+		_, _ = s.generateTitle(cctx, conv, conv.UserID, false)
+	})
+}
+
+func (s *conversationServiceImpl) GenerateTitle(ctx context.Context, userID, conversationID int64, force bool) (string, error) {
+	conv, err := s.authorize(ctx, userID, conversationID, entity.ConversationAccessEditor)
+	if err != nil {
+		return "", err
+	}
+	return s.generateTitle(ctx, conv, userID, force)
+}
+
+// generateTitle 生成并写入标题，模型调用的限流、配额与审计计入 billUserID
+func (s *conversationServiceImpl) generateTitle(ctx context.Context, conv *entity.Conversation, billUserID int64, force bool) (string, error) {
+	conversationID := conv.ID
+	if conv.Title != "" && !force {
+		return conv.Title, nil
+	}
+	chat := s.summaryChat()
+	if chat == nil {
+		return "", errorx.New(errorx.Internal, "ChatService 未配置")
+	}
+	msgs, err := s.repo.GetMessagesAfter(ctx, conversationID, 0, 10)
+	if err != nil {
+		return "", err
+	}
+	exchange := firstExchange(msgs)
+	if exchange == "" {
+		return "", errorx.New(errorx.Validation, "会话尚无可用于生成标题的对话")
+	}
+
+	cfg := s.currentTitleConfig()
+	cctx := ctx
+	if cfg.Endpoint != "" {
+		cctx = WithPinnedEndpoint(ctx, cfg.Endpoint)
+	}
+	resp, err := chat.Chat(cctx, &ChatRequest{
+		UserID:      billUserID,
+		System:      fmt.Sprintf(conversationTitlePrompt, cfg.MaxRunes),
+		Messages:    []Message{{Role: "user", Content: exchange}},
+		Temperature: 0.3,
+		MaxTokens:   64,
+		Metadata:    map[string]interface{}{"category": "conversation_title", "conversation_id": conv.ID},
+	})
+	if err != nil {
+		return "", err
+	}
+	if resp.Degraded {
+		return "", errorx.New(errorx.Internal, "标题生成降级")
+	}
+	title := cleanConversationTitle(resp.Content, cfg.MaxRunes)
+	if title == "" {
+		return "", errorx.New(errorx.Internal, "模型返回的标题为空")
+	}
+	written, err := s.repo.SetTitle(ctx, conversationID, title, !force)
+	if err != nil {
+		return "", err
+	}
+	if !written {
+		// 生成期间用户已手动命名，以现有标题为准
+		if latest, err := s.repo.GetConversation(ctx, conversationID); err == nil && latest != nil {
+			return latest.Title, nil
+		}
+	}
+	return title, nil
+}
+
+// firstExchange 取第一条用户消息与其后第一条助手回复
+func firstExchange(msgs []*entity.Message) string {
+	var user, assistant string
+	for _, m := range msgs {
+		switch {
+		case user == "" && m.Role == "user":
+			user = m.Content
+		case user != "" && assistant == "" && m.Role == "assistant":
+			assistant = m.Content
+		}
+	}
+	if strings.TrimSpace(user) == "" {
+		return ""
+	}
+	user, _ = truncateRunes(user, conversationTitleInputRunes)
+	text := "user: " + user
+	if assistant != "" {
+		assistant, _ = truncateRunes(assistant, conversationTitleInputRunes)
+		text += "\nassistant: " + assistant
+	}
+	return text
+}
+
+// cleanConversationTitle 只取首行，去掉模型常加的前缀、引号与句末标点
+func cleanConversationTitle(text string, maxRunes int) string {
+	text = strings.TrimSpace(text)
+	if i := strings.IndexAny(text, "\r\n"); i >= 0 {
+		text = text[:i]
+	}
+	for _, prefix := range []string{"标题：", "标题:", "Title:", "title:"} {
+		text = strings.TrimPrefix(text, prefix)
+	}
+	text = strings.Trim(strings.TrimSpace(text), "\"'“”‘’《》「」*#")
+	text = strings.TrimRight(text, "。.!！?？")
+	text, _ = truncateRunes(strings.TrimSpace(text), maxRunes)
+	return text
+}
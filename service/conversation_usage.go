@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+func (s *conversationServiceImpl) RecordUsage(ctx context.Context, conversationID int64, usage *TokenUsage, costUSD float64) error {
+	if usage == nil {
+		return nil
+	}
+	if conversationID <= 0 {
+		return errorx.New(errorx.InvalidInput, "conversationID 无效")
+	}
+	return s.repo.AddUsage(ctx, conversationID, entity.ConversationUsage{
+		PromptTokens:     int64(usage.RequestTokens),
+		CompletionTokens: int64(usage.ResponseTokens),
+		RequestCount:     1,
+		CostUSD:          costUSD,
+	})
+}
+
+func (s *conversationServiceImpl) GetConversationUsage(ctx context.Context, userID, conversationID int64) (*entity.ConversationUsage, error) {
+	conv, err := s.authorize(ctx, userID, conversationID, entity.ConversationAccessViewer)
+	if err != nil {
+		return nil, err
+	}
+	return conversationUsage(conv), nil
+}
+
+func conversationUsage(conv *entity.Conversation) *entity.ConversationUsage {
+	return &entity.ConversationUsage{
+		MessageTokens:    conv.MessageTokens,
+		PromptTokens:     conv.PromptTokens,
+		CompletionTokens: conv.CompletionTokens,
+		TotalTokens:      conv.PromptTokens + conv.CompletionTokens,
+		RequestCount:     conv.RequestCount,
+		CostUSD:          conv.CostUSD,
+	}
+}
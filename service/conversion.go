@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+)
+
+const (
+	defaultAttributionWindowHours = 72
+	maxAttributionWindowHours     = 90 * 24
+	defaultConversionOutcome      = "conversion"
+)
+
+// 转化的归因方式
+const (
+	ConversionAttributionRequest  = "request"  // 按请求 ID 关联到来源调用
+	ConversionAttributionExposure = "exposure" // 关联到用户在该 A/B 测试中最近一次曝光
+	ConversionAttributionNone     = "none"     // 未能关联来源调用
+)
+
+// ConversionConfig 转化归因与去重配置；零值字段使用默认值
+type ConversionConfig struct {
+	// AttributionWindowHours 转化须发生在来源调用之后的该小时数内，默认 72
+	AttributionWindowHours int `json:"attribution_window_hours"`
+	// DedupWindowHours 同一用户在同一 A/B 测试与模板下的同类转化在该小时数内只计一次；
+	// 0 表示与归因窗口相同，<0 表示不去重
+	DedupWindowHours int `json:"dedup_window_hours"`
+	// RequireAttribution 拒绝无法关联来源调用的转化；默认关闭以兼容只提供 A/B 字段的调用方
+	RequireAttribution bool `json:"require_attribution"`
+}
+
+// ConversionRequest 转化事件；提供 RequestID（Chat 响应元数据中的 request_id）时其余归因字段取自来源调用
+type ConversionRequest struct {
+	RequestID        string `json:"request_id"`
+	UserID           int64  `json:"user_id"`
+	ABTestID         int64  `json:"ab_test_id"`
+	ABVariant        string `json:"ab_variant"`
+	PromptTemplateID int64  `json:"prompt_template_id"`
+	Provider         string `json:"provider"`
+	Model            string `json:"model"`
+	Outcome          string `json:"outcome"`
+}
+
+// ConversionResult 转化记录结果；Duplicate 为 true 时未写入新记录
+type ConversionResult struct {
+	Recorded    bool            `json:"recorded"`
+	Duplicate   bool            `json:"duplicate"`
+	Attribution string          `json:"attribution"`
+	Metrics     *entity.Metrics `json:"metrics"`
+}
+
+// ConversionService 记录转化事件：关联来源调用，校验归因窗口，并按用户去重，避免重复事件抬高转化率
+type ConversionService interface {
+	SetConfig(cfg ConversionConfig) error
+	GetConfig() ConversionConfig
+	MarkConversion(ctx context.Context, req *ConversionRequest) (*ConversionResult, error)
+}
+
+type conversionServiceImpl struct {
+	metrics repo.MetricsRepo
+
+	cfgMu sync.RWMutex
+	cfg   ConversionConfig
+
+	// markMu 串行化去重检查与写入，避免同一转化并发上报时重复计数（仅限本进程）
+	markMu sync.Mutex
+}
+
+func NewConversionService(metrics repo.MetricsRepo) ConversionService {
+	cfg, _ := normalizeConversionConfig(ConversionConfig{})
+	return &conversionServiceImpl{metrics: metrics, cfg: cfg}
+}
+
+func (s *conversionServiceImpl) SetConfig(cfg ConversionConfig) error {
+	cfg, err := normalizeConversionConfig(cfg)
+	if err != nil {
+		return err
+	}
+	s.cfgMu.Lock()
+	defer s.cfgMu.Unlock()
+	s.cfg = cfg
+	return nil
+}
+
+func (s *conversionServiceImpl) GetConfig() ConversionConfig {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.cfg
+}
+
+func normalizeConversionConfig(cfg ConversionConfig) (ConversionConfig, error) {
+	if cfg.AttributionWindowHours <= 0 {
+		cfg.AttributionWindowHours = defaultAttributionWindowHours
+	}
+	if cfg.AttributionWindowHours > maxAttributionWindowHours || cfg.DedupWindowHours > maxAttributionWindowHours {
+		return cfg, errorx.New(errorx.Validation, "归因与去重窗口不能超过 90 天")
+	}
+	if cfg.DedupWindowHours == 0 {
+		cfg.DedupWindowHours = cfg.AttributionWindowHours
+	}
+	return cfg, nil
+}
+
+func (s *conversionServiceImpl) MarkConversion(ctx context.Context, req *ConversionRequest) (*ConversionResult, error) {
+	if s.metrics == nil {
+		return nil, errorx.New(errorx.Internal, "LLM metrics repo 未配置")
+	}
+	if req == nil {
+		return nil, errorx.New(errorx.Validation, "转化事件不能为空")
+	}
+	cfg := s.GetConfig()
+	now := time.Now()
+	windowStart := now.Add(-time.Duration(cfg.AttributionWindowHours) * time.Hour)
+
+	outcome := strings.TrimSpace(req.Outcome)
+	if outcome == "" {
+		outcome = defaultConversionOutcome
+	}
+	record := &entity.Metrics{
+		UserID:         req.UserID,
+		ABTestID:       req.ABTestID,
+		ABVariant:      req.ABVariant,
+		PromptTemplate: req.PromptTemplateID,
+		Provider:       req.Provider,
+		Model:          req.Model,
+		Status:         "converted",
+		Outcome:        outcome,
+	}
+
+	origin, attribution, err := s.attribute(ctx, req, windowStart)
+	if err != nil {
+		return nil, err
+	}
+	if origin != nil {
+		record.RequestID = origin.RequestID
+		record.UserID = origin.UserID
+		record.OrgID = origin.OrgID
+		record.ConversationID = origin.ConversationID
+		record.ABTestID = origin.ABTestID
+		record.ABVariant = origin.ABVariant
+		record.PromptTemplate = origin.PromptTemplate
+		record.Provider = origin.Provider
+		record.Model = origin.Model
+		record.Endpoint = origin.Endpoint
+		record.IsTest = origin.IsTest
+	} else if cfg.RequireAttribution {
+		return nil, errorx.New(errorx.Validation, "无法关联来源调用：请提供 request_id，或提供 user_id 与 ab_test_id")
+	}
+
+	s.markMu.Lock()
+	defer s.markMu.Unlock()
+
+	if cfg.DedupWindowHours > 0 {
+		dup, err := s.findDuplicate(ctx, record, now.Add(-time.Duration(cfg.DedupWindowHours)*time.Hour))
+		if err != nil {
+			return nil, err
+		}
+		if dup != nil {
+			return &ConversionResult{Duplicate: true, Attribution: attribution, Metrics: dup}, nil
+		}
+	}
+	if err := s.metrics.Save(ctx, record); err != nil {
+		return nil, err
+	}
+	return &ConversionResult{Recorded: true, Attribution: attribution, Metrics: record}, nil
+}
+
+// attribute 查找转化的来源调用：优先按请求 ID，其次为用户在该 A/B 测试中归因窗口内最近一次成功调用
+func (s *conversionServiceImpl) attribute(ctx context.Context, req *ConversionRequest, windowStart time.Time) (*entity.Metrics, string, error) {
+	if req.RequestID != "" {
+		origin, err := s.metrics.Latest(ctx, entity.MetricsFilter{RequestID: req.RequestID, Status: "ok", IncludeTest: true})
+		if err != nil {
+			return nil, "", err
+		}
+		if origin == nil {
+			return nil, "", errorx.New(errorx.NotFound, "来源调用不存在: "+req.RequestID)
+		}
+		if origin.CreatedAt.Before(windowStart) {
+			return nil, "", errorx.New(errorx.Validation, "转化超出归因窗口")
+		}
+		if req.UserID > 0 && origin.UserID > 0 && req.UserID != origin.UserID {
+			return nil, "", errorx.New(errorx.Validation, "user_id 与来源调用不一致")
+		}
+		return origin, ConversionAttributionRequest, nil
+	}
+	if req.UserID > 0 && req.ABTestID > 0 {
+		abTestID, userID := req.ABTestID, req.UserID
+		origin, err := s.metrics.Latest(ctx, entity.MetricsFilter{
+			UserID:      &userID,
+			ABTestID:    &abTestID,
+			ABVariant:   req.ABVariant,
+			Status:      "ok",
+			StartAt:     &windowStart,
+			IncludeTest: true,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		if origin != nil {
+			return origin, ConversionAttributionExposure, nil
+		}
+	}
+	return nil, ConversionAttributionNone, nil
+}
+
+// findDuplicate 去重键：有用户时为 用户 + A/B 测试 + 模板 + 事件类型，匿名转化为来源请求 ID + 事件类型；
+// 两者都没有时不去重
+func (s *conversionServiceImpl) findDuplicate(ctx context.Context, record *entity.Metrics, since time.Time) (*entity.Metrics, error) {
+	filter := entity.MetricsFilter{
+		Status:      "converted",
+		Outcome:     record.Outcome,
+		StartAt:     &since,
+		IncludeTest: true,
+	}
+	switch {
+	case record.UserID > 0:
+		userID, abTestID, templateID := record.UserID, record.ABTestID, record.PromptTemplate
+		filter.UserID = &userID
+		filter.ABTestID = &abTestID
+		filter.PromptTemplateID = &templateID
+	case record.RequestID != "":
+		filter.RequestID = record.RequestID
+	default:
+		return nil, nil
+	}
+	return s.metrics.Latest(ctx, filter)
+}
@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+	"gochen/logging"
+	runtime "gochen/task"
+)
+
+const (
+	costBackfillBatchSize = 500
+	// maxCostBackfillRange 单次回填的最大时间跨度
+	maxCostBackfillRange = 366 * 24 * time.Hour
+)
+
+// 回填任务状态
+const (
+	CostBackfillRunning   = "running"
+	CostBackfillCompleted = "completed"
+	CostBackfillFailed    = "failed"
+	CostBackfillCanceled  = "canceled"
+)
+
+// CostBackfillRequest 成本回填请求：重算 [StartAt, EndAt] 内（可按 provider/model 限定）调用指标的 CostUSD
+type CostBackfillRequest struct {
+	StartAt  time.Time `json:"start_at"`
+	EndAt    time.Time `json:"end_at"`
+	Provider string    `json:"provider,omitempty"`
+	Model    string    `json:"model,omitempty"`
+	// DryRun 只统计差异，不写回
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+// CostBackfillStatus 回填任务进度
+type CostBackfillStatus struct {
+	Request *CostBackfillRequest `json:"request"`
+	State   string               `json:"state"`
+	// Total 开始时范围内的指标总数；Processed 已扫描条数，Updated 成本发生变化（DryRun 时为将变化）的条数，
+	// Skipped 价格表中没有调用时刻生效单价而保持原值的条数
+	Total     int `json:"total"`
+	Processed int `json:"processed"`
+	Updated   int `json:"updated"`
+	Skipped   int `json:"skipped"`
+	// CostBeforeUSD/CostAfterUSD 已扫描指标重算前后的成本合计
+	CostBeforeUSD float64    `json:"cost_before_usd"`
+	CostAfterUSD  float64    `json:"cost_after_usd"`
+	Error         string     `json:"error,omitempty"`
+	StartedAt     time.Time  `json:"started_at"`
+	FinishedAt    *time.Time `json:"finished_at,omitempty"`
+}
+
+// CostBackfillService 价格修正后按价格表中调用时刻生效的单价重算历史调用成本。
+// 任务在后台执行，同一时间只运行一个；重算完全以价格表为准，调用时端点配置的单价不再保留。
+// 仅修改数据库中的指标，本进程的累计计数（Prometheus）不受影响
+type CostBackfillService interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	// StartBackfill 校验请求并启动后台任务，已有任务运行时报错
+	StartBackfill(ctx context.Context, req *CostBackfillRequest) (*CostBackfillStatus, error)
+	// Status 返回当前或最近一次任务的进度，从未运行时返回 nil
+	Status() *CostBackfillStatus
+	// Cancel 取消运行中的任务，已写回的行保持新值；没有运行中的任务时返回 false
+	Cancel() bool
+}
+
+type costBackfillServiceImpl struct {
+	metrics repo.MetricsRepo
+	pricing ModelPricingService
+	safety  SafetyService
+	logger  logging.ILogger
+	super   *runtime.TaskSupervisor
+
+	mu        sync.Mutex
+	status    *CostBackfillStatus
+	jobCancel context.CancelFunc
+
+	lifecycleMu sync.Mutex
+	started     bool
+	stopped     bool
+	loopCtx     context.Context
+	cancel      context.CancelFunc
+}
+
+func NewCostBackfillService(metrics repo.MetricsRepo, pricing ModelPricingService, safety SafetyService, logger logging.ILogger) CostBackfillService {
+	return &costBackfillServiceImpl{
+		metrics: metrics,
+		pricing: pricing,
+		safety:  safety,
+		logger:  logger,
+		super:   runtime.NewTaskSupervisor("gochen-llm.cost_backfill"),
+	}
+}
+
+func (s *costBackfillServiceImpl) Start(ctx context.Context) error {
+	if ctx == nil {
+		return errorx.New(errorx.InvalidInput, "ctx 不能为空")
+	}
+
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+
+	if s.stopped {
+		return errorx.New(errorx.Internal, "CostBackfillService 已停止，无法再次启动")
+	}
+	if s.started {
+		return nil
+	}
+	loopCtx, cancel := context.WithCancel(ctx)
+	s.loopCtx = loopCtx
+	s.cancel = cancel
+	s.started = true
+	return nil
+}
+
+func (s *costBackfillServiceImpl) Stop(ctx context.Context) error {
+	s.lifecycleMu.Lock()
+	if !s.started || s.stopped {
+		s.lifecycleMu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	cancel := s.cancel
+	s.lifecycleMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.super.Stop()
+	return nil
+}
+
+func (s *costBackfillServiceImpl) StartBackfill(ctx context.Context, req *CostBackfillRequest) (*CostBackfillStatus, error) {
+	if s.metrics == nil || s.pricing == nil {
+		return nil, errorx.New(errorx.Internal, "成本回填依赖未配置")
+	}
+	if req == nil || req.StartAt.IsZero() || req.EndAt.IsZero() {
+		return nil, errorx.New(errorx.Validation, "start_at 与 end_at 不能为空")
+	}
+	if !req.EndAt.After(req.StartAt) {
+		return nil, errorx.New(errorx.Validation, "end_at 须晚于 start_at")
+	}
+	if req.EndAt.Sub(req.StartAt) > maxCostBackfillRange {
+		return nil, errorx.New(errorx.Validation, "单次回填的时间跨度不能超过 366 天")
+	}
+
+	s.lifecycleMu.Lock()
+	loopCtx := s.loopCtx
+	s.lifecycleMu.Unlock()
+	if loopCtx == nil {
+		return nil, errorx.New(errorx.Internal, "CostBackfillService 未启动")
+	}
+
+	filter := s.filter(req)
+	// 进度按记录行数计，不使用按样本权重还原的调用数
+	_, total, err := s.metrics.List(ctx, filter, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.status != nil && s.status.State == CostBackfillRunning {
+		s.mu.Unlock()
+		return nil, errorx.New(errorx.Validation, "已有成本回填任务在运行")
+	}
+	reqCopy := *req
+	status := &CostBackfillStatus{
+		Request:   &reqCopy,
+		State:     CostBackfillRunning,
+		Total:     int(total),
+		StartedAt: time.Now(),
+	}
+	jobCtx, jobCancel := context.WithCancel(loopCtx)
+	s.status = status
+	s.jobCancel = jobCancel
+	snapshot := *status
+	s.mu.Unlock()
+
+	if s.safety != nil {
+		s.safety.RecordAdminChange(ctx, "admin.cost_backfill", "metrics", 0, nil, &reqCopy)
+	}
+	s.super.Go(jobCtx, "backfill", func(ctx context.Context) {
+		defer jobCancel()
+		s.run(ctx, filter, reqCopy.DryRun)
+	})
+	return &snapshot, nil
+}
+
+func (s *costBackfillServiceImpl) Status() *CostBackfillStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status == nil {
+		return nil
+	}
+	out := *s.status
+	return &out
+}
+
+func (s *costBackfillServiceImpl) Cancel() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status == nil || s.status.State != CostBackfillRunning || s.jobCancel == nil {
+		return false
+	}
+	s.jobCancel()
+	return true
+}
+
+func (s *costBackfillServiceImpl) filter(req *CostBackfillRequest) entity.MetricsFilter {
+	start, end := req.StartAt, req.EndAt
+	return entity.MetricsFilter{
+		Provider:    req.Provider,
+		Model:       req.Model,
+		StartAt:     &start,
+		EndAt:       &end,
+		IncludeTest: true,
+	}
+}
+
+// run 按 ID 游标分批扫描并逐行重算，每批结束后更新进度
+func (s *costBackfillServiceImpl) run(ctx context.Context, filter entity.MetricsFilter, dryRun bool) {
+	err := s.metrics.Iterate(ctx, filter, costBackfillBatchSize, func(batch []*entity.Metrics) error {
+		var processed, updated, skipped int
+		var before, after float64
+		for _, m := range batch {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			processed++
+			before += m.CostUSD
+			cost, ok, err := s.recompute(ctx, m)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				skipped++
+				after += m.CostUSD
+				continue
+			}
+			after += cost
+			// 列精度为 6 位小数，差异小于精度时视为未变化
+			if math.Abs(cost-m.CostUSD) < 5e-7 {
+				continue
+			}
+			updated++
+			if !dryRun {
+				if err := s.metrics.UpdateCost(ctx, m.ID, cost); err != nil {
+					return err
+				}
+			}
+		}
+		s.mu.Lock()
+		s.status.Processed += processed
+		s.status.Updated += updated
+		s.status.Skipped += skipped
+		s.status.CostBeforeUSD += before
+		s.status.CostAfterUSD += after
+		s.mu.Unlock()
+		return nil
+	})
+
+	now := time.Now()
+	s.mu.Lock()
+	s.status.FinishedAt = &now
+	switch {
+	case err == nil:
+		s.status.State = CostBackfillCompleted
+	case ctx.Err() != nil:
+		s.status.State = CostBackfillCanceled
+	default:
+		s.status.State = CostBackfillFailed
+		s.status.Error = err.Error()
+	}
+	status := *s.status
+	s.mu.Unlock()
+
+	if s.logger != nil {
+		s.logger.Info(ctx, "成本回填任务结束",
+			logging.String("state", status.State),
+			logging.Int("processed", status.Processed),
+			logging.Int("updated", status.Updated),
+			logging.Int("skipped", status.Skipped),
+		)
+	}
+}
+
+// recompute 按调用时刻生效的单价计算成本；复用结果或没有 token 的调用成本为 0，
+// 价格表中没有匹配的单价时 ok 为 false
+func (s *costBackfillServiceImpl) recompute(ctx context.Context, m *entity.Metrics) (float64, bool, error) {
+	if m.CacheHit || m.RequestTokens+m.ResponseTokens <= 0 {
+		return 0, true, nil
+	}
+	p, err := s.pricing.ResolvePricing(ctx, m.Provider, m.Model, m.CreatedAt)
+	if err != nil {
+		return 0, false, err
+	}
+	if p == nil {
+		return 0, false, nil
+	}
+	return ModelPricingCost(p, m.RequestTokens, m.CachedTokens, m.ResponseTokens), true, nil
+}
@@ -0,0 +1,455 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+	"gochen/logging"
+	runtime "gochen/task"
+)
+
+const (
+	defaultCostDigestInterval = 10 * time.Minute
+	defaultCostDigestHour     = 1
+	defaultCostDigestTopUsers = 10
+	maxCostDigestTopUsers     = 100
+	// maxCostDigestModels 日报中按成本保留的模型数，其余模型只计入总计
+	maxCostDigestModels = 50
+	costDigestDayLayout = "2006-01-02"
+)
+
+// CostDigestConfig 成本日报配置；零值字段使用默认值
+type CostDigestConfig struct {
+	// Enabled 是否每天自动生成并投递前一日（UTC）的日报；关闭时仍可通过 RunOnce 手动生成。默认关闭
+	Enabled bool `json:"enabled"`
+	// Hour 每天在该小时（UTC，0-23）之后生成前一日的日报，默认 1
+	Hour *int `json:"hour,omitempty"`
+	// TopUsers 日报列出的成本最高的用户数，默认 10
+	TopUsers int `json:"top_users"`
+	// WebhookURL 非空时以 POST JSON 投递日报；配置 WebhookSecret 时附带
+	// X-Gochen-Signature: sha256=<HMAC-SHA256(body)> 签名头
+	WebhookURL    string `json:"webhook_url,omitempty"`
+	WebhookSecret string `json:"webhook_secret,omitempty"`
+}
+
+// CostDigestGroup 日报中单个 provider 或模型的用量与环比
+type CostDigestGroup struct {
+	Provider    string  `json:"provider"`
+	Model       string  `json:"model,omitempty"`
+	Calls       int     `json:"calls"`
+	ErrorCalls  int     `json:"error_calls"`
+	TotalTokens int     `json:"total_tokens"`
+	CostUSD     float64 `json:"cost_usd"`
+	PrevCostUSD float64 `json:"prev_cost_usd"`
+	// CostDeltaPct 相对前一日的成本变化比例，前一日成本为 0 时为空
+	CostDeltaPct *float64 `json:"cost_delta_pct,omitempty"`
+}
+
+// CostDigestReport 成本日报内容
+type CostDigestReport struct {
+	Day          string   `json:"day"`
+	TotalCalls   int      `json:"total_calls"`
+	ErrorCalls   int      `json:"error_calls"`
+	TotalTokens  int      `json:"total_tokens"`
+	TotalCostUSD float64  `json:"total_cost_usd"`
+	PrevCalls    int      `json:"prev_calls"`
+	PrevCostUSD  float64  `json:"prev_cost_usd"`
+	CostDeltaPct *float64 `json:"cost_delta_pct,omitempty"`
+	// Providers 按成本倒序；Models 按成本倒序，最多 maxCostDigestModels 个
+	Providers []*CostDigestGroup      `json:"providers"`
+	Models    []*CostDigestGroup      `json:"models"`
+	TopUsers  []*entity.CostBreakdown `json:"top_users"`
+}
+
+// CostDigestHandler 接收生成的日报，由宿主应用接入邮件等通知渠道；返回错误时日报记为投递失败
+type CostDigestHandler func(ctx context.Context, digest *CostDigestReport) error
+
+// CostDigestService 每天汇总前一日（UTC）的成本与用量（按 provider、模型、用户及环比），
+// 持久化后投递到 Webhook 与已注册的处理器，供运维在不打开看板的情况下掌握用量变化
+type CostDigestService interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	SetConfig(cfg CostDigestConfig) error
+	GetConfig() CostDigestConfig
+	// OnDigest 注册日报处理器，须在 Start 前调用
+	OnDigest(handler CostDigestHandler)
+	// Compile 汇总指定日期（UTC）的日报，不持久化也不投递
+	Compile(ctx context.Context, day time.Time) (*CostDigestReport, error)
+	// RunOnce 生成指定日期的日报并持久化（同一日期覆盖旧记录）后投递；投递失败记录在返回的日报中，不返回错误
+	RunOnce(ctx context.Context, day time.Time) (*entity.CostDigest, error)
+	// ListDigests 按日期倒序返回最近的日报
+	ListDigests(ctx context.Context, limit int) ([]*entity.CostDigest, error)
+}
+
+type costDigestServiceImpl struct {
+	metrics repo.MetricsRepo
+	repo    repo.CostDigestRepo
+	logger  logging.ILogger
+	super   *runtime.TaskSupervisor
+	http    *http.Client
+
+	interval time.Duration
+
+	cfgMu    sync.RWMutex
+	cfg      CostDigestConfig
+	handlers []CostDigestHandler
+
+	// runMu 保证同一时间只生成一份日报
+	runMu sync.Mutex
+
+	lifecycleMu sync.Mutex
+	started     bool
+	stopped     bool
+	cancel      context.CancelFunc
+}
+
+func NewCostDigestService(metrics repo.MetricsRepo, digests repo.CostDigestRepo, logger logging.ILogger) CostDigestService {
+	cfg, _ := normalizeCostDigestConfig(CostDigestConfig{})
+	return &costDigestServiceImpl{
+		metrics:  metrics,
+		repo:     digests,
+		logger:   logger,
+		super:    runtime.NewTaskSupervisor("gochen-llm.cost_digest"),
+		http:     &http.Client{Timeout: 10 * time.Second},
+		interval: defaultCostDigestInterval,
+		cfg:      cfg,
+	}
+}
+
+func (s *costDigestServiceImpl) Start(ctx context.Context) error {
+	if ctx == nil {
+		return errorx.New(errorx.InvalidInput, "ctx 不能为空")
+	}
+
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+
+	if s.stopped {
+		return errorx.New(errorx.Internal, "CostDigestService 已停止，无法再次启动")
+	}
+	if s.started {
+		return nil
+	}
+	loopCtx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.started = true
+
+	s.super.GoLoop(loopCtx, "digest_loop", s.interval, func(ctx context.Context) error {
+		if err := s.tick(ctx, time.Now()); err != nil && s.logger != nil {
+			s.logger.Warn(ctx, "生成成本日报失败", logging.Error(err))
+		}
+		return nil
+	})
+	return nil
+}
+
+func (s *costDigestServiceImpl) Stop(ctx context.Context) error {
+	s.lifecycleMu.Lock()
+	if !s.started || s.stopped {
+		s.lifecycleMu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	cancel := s.cancel
+	s.lifecycleMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.super.Stop()
+	return nil
+}
+
+func (s *costDigestServiceImpl) SetConfig(cfg CostDigestConfig) error {
+	cfg, err := normalizeCostDigestConfig(cfg)
+	if err != nil {
+		return err
+	}
+	s.cfgMu.Lock()
+	defer s.cfgMu.Unlock()
+	s.cfg = cfg
+	return nil
+}
+
+func (s *costDigestServiceImpl) GetConfig() CostDigestConfig {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.cfg
+}
+
+func normalizeCostDigestConfig(cfg CostDigestConfig) (CostDigestConfig, error) {
+	if cfg.Hour == nil {
+		hour := defaultCostDigestHour
+		cfg.Hour = &hour
+	}
+	if *cfg.Hour < 0 || *cfg.Hour > 23 {
+		return cfg, errorx.New(errorx.Validation, "hour 须在 0 到 23 之间")
+	}
+	if cfg.TopUsers <= 0 {
+		cfg.TopUsers = defaultCostDigestTopUsers
+	}
+	if cfg.TopUsers > maxCostDigestTopUsers {
+		cfg.TopUsers = maxCostDigestTopUsers
+	}
+	cfg.WebhookURL = strings.TrimSpace(cfg.WebhookURL)
+	if cfg.WebhookURL != "" && !strings.HasPrefix(cfg.WebhookURL, "https://") && !strings.HasPrefix(cfg.WebhookURL, "http://") {
+		return cfg, errorx.New(errorx.Validation, "webhook_url 须为 http(s) 地址")
+	}
+	return cfg, nil
+}
+
+func (s *costDigestServiceImpl) OnDigest(handler CostDigestHandler) {
+	if handler == nil {
+		return
+	}
+	s.cfgMu.Lock()
+	defer s.cfgMu.Unlock()
+	s.handlers = append(s.handlers, handler)
+}
+
+// tick 到达配置的小时后，前一日的日报尚未生成时生成并投递
+func (s *costDigestServiceImpl) tick(ctx context.Context, now time.Time) error {
+	cfg := s.GetConfig()
+	if !cfg.Enabled || s.repo == nil {
+		return nil
+	}
+	now = now.UTC()
+	if now.Hour() < *cfg.Hour {
+		return nil
+	}
+	day := costDigestDay(now).AddDate(0, 0, -1)
+	existing, err := s.repo.GetByDay(ctx, day.Format(costDigestDayLayout))
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+	_, err = s.RunOnce(ctx, day)
+	return err
+}
+
+func (s *costDigestServiceImpl) Compile(ctx context.Context, day time.Time) (*CostDigestReport, error) {
+	if s.metrics == nil {
+		return nil, errorx.New(errorx.Internal, "LLM MetricsRepo 未配置")
+	}
+	day = costDigestDay(day)
+	cur := costDigestFilter(day)
+	prev := costDigestFilter(day.AddDate(0, 0, -1))
+
+	total, err := s.metrics.Aggregate(ctx, cur)
+	if err != nil {
+		return nil, err
+	}
+	prevTotal, err := s.metrics.Aggregate(ctx, prev)
+	if err != nil {
+		return nil, err
+	}
+	models, err := s.metrics.AggregateByModel(ctx, cur)
+	if err != nil {
+		return nil, err
+	}
+	prevModels, err := s.metrics.AggregateByModel(ctx, prev)
+	if err != nil {
+		return nil, err
+	}
+	topUsers, err := s.metrics.AggregateCost(ctx, cur, repo.CostGroupByUser, s.GetConfig().TopUsers)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CostDigestReport{
+		Day:          day.Format(costDigestDayLayout),
+		TotalCalls:   total.TotalCalls,
+		ErrorCalls:   total.ErrorCalls,
+		TotalTokens:  total.TotalTokens,
+		TotalCostUSD: total.TotalCostUSD,
+		PrevCalls:    prevTotal.TotalCalls,
+		PrevCostUSD:  prevTotal.TotalCostUSD,
+		CostDeltaPct: costDeltaPct(total.TotalCostUSD, prevTotal.TotalCostUSD),
+		Providers:    []*CostDigestGroup{},
+		Models:       []*CostDigestGroup{},
+		TopUsers:     topUsers,
+	}
+	if report.TopUsers == nil {
+		report.TopUsers = []*entity.CostBreakdown{}
+	}
+
+	prevModelCost := make(map[string]float64, len(prevModels))
+	prevProviderCost := map[string]float64{}
+	for _, m := range prevModels {
+		prevModelCost[m.Provider+"/"+m.Model] = m.Metrics.TotalCostUSD
+		prevProviderCost[m.Provider] += m.Metrics.TotalCostUSD
+	}
+	providers := map[string]*CostDigestGroup{}
+	for _, m := range models {
+		g := &CostDigestGroup{
+			Provider:    m.Provider,
+			Model:       m.Model,
+			Calls:       m.Metrics.TotalCalls,
+			ErrorCalls:  m.Metrics.ErrorCalls,
+			TotalTokens: m.Metrics.TotalTokens,
+			CostUSD:     m.Metrics.TotalCostUSD,
+			PrevCostUSD: prevModelCost[m.Provider+"/"+m.Model],
+		}
+		g.CostDeltaPct = costDeltaPct(g.CostUSD, g.PrevCostUSD)
+		report.Models = append(report.Models, g)
+
+		p := providers[m.Provider]
+		if p == nil {
+			p = &CostDigestGroup{Provider: m.Provider, PrevCostUSD: prevProviderCost[m.Provider]}
+			providers[m.Provider] = p
+			report.Providers = append(report.Providers, p)
+		}
+		p.Calls += g.Calls
+		p.ErrorCalls += g.ErrorCalls
+		p.TotalTokens += g.TotalTokens
+		p.CostUSD += g.CostUSD
+	}
+	for _, p := range report.Providers {
+		p.CostDeltaPct = costDeltaPct(p.CostUSD, p.PrevCostUSD)
+	}
+	byCost := func(list []*CostDigestGroup) {
+		sort.SliceStable(list, func(i, j int) bool { return list[i].CostUSD > list[j].CostUSD })
+	}
+	byCost(report.Providers)
+	byCost(report.Models)
+	if len(report.Models) > maxCostDigestModels {
+		report.Models = report.Models[:maxCostDigestModels]
+	}
+	return report, nil
+}
+
+func (s *costDigestServiceImpl) RunOnce(ctx context.Context, day time.Time) (*entity.CostDigest, error) {
+	if s.repo == nil {
+		return nil, errorx.New(errorx.Internal, "成本日报仓储未配置")
+	}
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	report, err := s.Compile(ctx, day)
+	if err != nil {
+		return nil, err
+	}
+	content, err := json.Marshal(report)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "序列化成本日报失败")
+	}
+	digest, err := s.repo.GetByDay(ctx, report.Day)
+	if err != nil {
+		return nil, err
+	}
+	if digest == nil {
+		digest = &entity.CostDigest{Day: report.Day}
+	}
+	digest.TotalCalls = report.TotalCalls
+	digest.TotalTokens = report.TotalTokens
+	digest.TotalCostUSD = report.TotalCostUSD
+	digest.PrevCostUSD = report.PrevCostUSD
+	digest.ContentJSON = string(content)
+	digest.DeliveryStatus, digest.DeliveryError = s.deliver(ctx, report, content)
+	if err := s.repo.Save(ctx, digest); err != nil {
+		return nil, err
+	}
+	if digest.DeliveryStatus == entity.CostDigestDeliveryFailed && s.logger != nil {
+		s.logger.Warn(ctx, "投递成本日报失败", logging.String("day", digest.Day), logging.String("error", digest.DeliveryError))
+	}
+	return digest, nil
+}
+
+func (s *costDigestServiceImpl) ListDigests(ctx context.Context, limit int) ([]*entity.CostDigest, error) {
+	if s.repo == nil {
+		return nil, errorx.New(errorx.Internal, "成本日报仓储未配置")
+	}
+	if limit <= 0 || limit > 366 {
+		limit = 30
+	}
+	return s.repo.List(ctx, limit)
+}
+
+// deliver 投递到 Webhook 与处理器，返回投递状态与失败原因
+func (s *costDigestServiceImpl) deliver(ctx context.Context, report *CostDigestReport, payload []byte) (string, string) {
+	s.cfgMu.RLock()
+	cfg := s.cfg
+	handlers := append([]CostDigestHandler(nil), s.handlers...)
+	s.cfgMu.RUnlock()
+
+	if cfg.WebhookURL == "" && len(handlers) == 0 {
+		return entity.CostDigestDeliveryNone, ""
+	}
+	var errs []string
+	if cfg.WebhookURL != "" {
+		if err := s.sendWebhook(ctx, cfg, payload); err != nil {
+			errs = append(errs, "webhook: "+err.Error())
+		}
+	}
+	for _, h := range handlers {
+		if err := h(ctx, report); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		msg := strings.Join(errs, "; ")
+		if len(msg) > 500 {
+			msg = msg[:500]
+		}
+		return entity.CostDigestDeliveryFailed, msg
+	}
+	return entity.CostDigestDeliverySent, ""
+}
+
+func (s *costDigestServiceImpl) sendWebhook(ctx context.Context, cfg CostDigestConfig, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.WebhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(cfg.WebhookSecret))
+		mac.Write(payload)
+		req.Header.Set("X-Gochen-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status=%d", resp.StatusCode)
+	}
+	return nil
+}
+
+// costDigestDay 截断为 UTC 自然日的零点
+func costDigestDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// costDigestFilter 覆盖 day 当天的筛选条件；EndAt 为闭区间，取次日零点前 1 纳秒
+func costDigestFilter(day time.Time) entity.MetricsFilter {
+	start := day
+	end := day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	return entity.MetricsFilter{StartAt: &start, EndAt: &end}
+}
+
+func costDeltaPct(cur, prev float64) *float64 {
+	if prev <= 0 {
+		return nil
+	}
+	v := (cur - prev) / prev
+	return &v
+}
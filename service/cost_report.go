@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"math"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+)
+
+const (
+	// defaultCostReportTop/maxCostReportTop 成本报表返回的分组数
+	defaultCostReportTop = 10
+	maxCostReportTop     = 100
+)
+
+// CostReporter 基于调用指标按用户/组织/模板/模型归集成本，供财务分摊费用
+type CostReporter interface {
+	// CostReport 汇总筛选范围内的成本并返回成本最高的前 Top 组；GroupBy 为空时按用户分组
+	CostReport(ctx context.Context, filter CostFilter) (*CostReport, error)
+}
+
+type costReporterImpl struct {
+	metrics repo.MetricsRepo
+}
+
+func NewCostReporter(metrics repo.MetricsRepo) CostReporter {
+	return &costReporterImpl{metrics: metrics}
+}
+
+func (c *costReporterImpl) CostReport(ctx context.Context, filter CostFilter) (*CostReport, error) {
+	if c.metrics == nil {
+		return nil, errorx.New(errorx.Internal, "LLM MetricsRepo 未配置")
+	}
+	if filter.StartAt != nil && filter.EndAt != nil && filter.EndAt.Before(*filter.StartAt) {
+		return nil, errorx.New(errorx.InvalidInput, "end 不能早于 start")
+	}
+	if filter.GroupBy == "" {
+		filter.GroupBy = repo.CostGroupByUser
+	}
+	if filter.Top <= 0 {
+		filter.Top = defaultCostReportTop
+	}
+	if filter.Top > maxCostReportTop {
+		filter.Top = maxCostReportTop
+	}
+	mf := entity.MetricsFilter{
+		Provider:         filter.Provider,
+		Model:            filter.Model,
+		Endpoint:         filter.Endpoint,
+		UserID:           filter.UserID,
+		OrgID:            filter.OrgID,
+		PromptTemplateID: filter.PromptTemplateID,
+		StartAt:          filter.StartAt,
+		EndAt:            filter.EndAt,
+	}
+	items, err := c.metrics.AggregateCost(ctx, mf, filter.GroupBy, filter.Top)
+	if err != nil {
+		return nil, err
+	}
+	total, err := c.metrics.Aggregate(ctx, mf)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CostReport{
+		EstimatedCostUSD: total.TotalCostUSD,
+		TotalTokens:      total.TotalTokens,
+		TotalCalls:       total.TotalCalls,
+		GroupBy:          filter.GroupBy,
+		Items:            items,
+	}
+	if report.Items == nil {
+		report.Items = []*entity.CostBreakdown{}
+	}
+	others := &entity.CostBreakdown{
+		Calls:       int64(total.TotalCalls),
+		TotalTokens: int64(total.TotalTokens),
+		CostUSD:     total.TotalCostUSD,
+	}
+	for _, item := range items {
+		others.Calls -= item.Calls
+		others.TotalTokens -= item.TotalTokens
+		others.CostUSD -= item.CostUSD
+	}
+	// 两次查询之间可能有新写入，剩余部分只在为正时返回
+	if others.Calls > 0 {
+		others.CostUSD = math.Max(math.Round(others.CostUSD*1e6)/1e6, 0)
+		report.Others = others
+	}
+	return report, nil
+}
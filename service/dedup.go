@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"gochen/errorx"
+)
+
+// defaultDedupWindow 已完成请求的结果保留时长，覆盖 UI 双击等短时间重复提交
+const defaultDedupWindow = 5 * time.Second
+
+type dedupEntry struct {
+	done chan struct{}
+	// resp 结果快照，只读；返回给调用方的均为其副本
+	resp     *ChatResponse
+	err      error
+	finished time.Time
+}
+
+// requestDeduper 合并窗口期内相同请求（见 dedupKey）：
+// 进行中的请求直接等待其结果，刚完成的请求在窗口内复用结果（失败结果不复用）。
+type requestDeduper struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[string]*dedupEntry
+}
+
+func newRequestDeduper(window time.Duration) *requestDeduper {
+	if window <= 0 {
+		window = defaultDedupWindow
+	}
+	return &requestDeduper{
+		window:  window,
+		entries: map[string]*dedupEntry{},
+	}
+}
+
+// Do 执行或复用 key 对应的请求，shared 表示结果来自其他调用。
+// fn 在脱离取消信号的 ctx 下执行：发起方断开不会让共享同一结果的其他调用随之失败；
+// fn panic 时以错误结束该条目并唤醒等待方，随后继续向上抛出。
+func (d *requestDeduper) Do(ctx context.Context, key string, fn func(ctx context.Context) (*ChatResponse, error)) (resp *ChatResponse, shared bool, err error) {
+	now := time.Now()
+
+	d.mu.Lock()
+	d.evictLocked(now)
+	if e, ok := d.entries[key]; ok {
+		d.mu.Unlock()
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return nil, true, ctx.Err()
+		}
+		if e.err != nil {
+			return nil, true, e.err
+		}
+		return copyChatResponse(e.resp), true, nil
+	}
+	e := &dedupEntry{done: make(chan struct{})}
+	d.entries[key] = e
+	d.mu.Unlock()
+
+	completed := false
+	defer func() {
+		if completed {
+			return
+		}
+		r := recover()
+		e.err = errorx.New(errorx.Internal, fmt.Sprintf("请求执行异常: %v", r))
+		d.mu.Lock()
+		delete(d.entries, key)
+		d.mu.Unlock()
+		close(e.done)
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	resp, err = fn(context.WithoutCancel(ctx))
+	e.resp, e.err = copyChatResponse(resp), err
+
+	d.mu.Lock()
+	e.finished = time.Now()
+	if e.err != nil {
+		delete(d.entries, key)
+	}
+	d.mu.Unlock()
+	close(e.done)
+	completed = true
+	return copyChatResponse(e.resp), false, e.err
+}
+
+// copyChatResponse 返回响应的浅拷贝，Metadata 与 Usage 单独复制，调用方修改副本不影响快照
+func copyChatResponse(resp *ChatResponse) *ChatResponse {
+	if resp == nil {
+		return nil
+	}
+	out := *resp
+	if resp.Metadata != nil {
+		out.Metadata = cloneMetadata(resp.Metadata)
+	}
+	if resp.Usage != nil {
+		usage := *resp.Usage
+		out.Usage = &usage
+	}
+	return &out
+}
+
+func (d *requestDeduper) evictLocked(now time.Time) {
+	for k, e := range d.entries {
+		if !e.finished.IsZero() && now.Sub(e.finished) > d.window {
+			delete(d.entries, k)
+		}
+	}
+}
+
+// dedupKey 基于用户、系统提示、消息列表、指定端点与请求元数据生成请求指纹；
+// 无法序列化（如元数据含不可编码的值）时 ok 为 false，调用方应跳过合并
+func dedupKey(ctx context.Context, req *ChatRequest) (key string, ok bool) {
+	payload, err := json.Marshal(struct {
+		UserID            int64                  `json:"u"`
+		ConversationID    int64                  `json:"c"`
+		System            string                 `json:"s"`
+		Messages          []Message              `json:"m"`
+		Temperature       float32                `json:"t"`
+		MaxTokens         int                    `json:"x"`
+		Language          string                 `json:"l"`
+		PinnedEndpoint    string                 `json:"pe"`
+		PreferredEndpoint string                 `json:"pf"`
+		Metadata          map[string]interface{} `json:"md"`
+	}{
+		req.UserID, req.ConversationID, req.System, req.Messages, req.Temperature, req.MaxTokens, req.Language,
+		pinnedEndpointFromContext(ctx), preferredEndpointFromContext(ctx), req.Metadata,
+	})
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), true
+}
@@ -0,0 +1,501 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gochen-llm/client"
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+	"gochen/logging"
+	runtime "gochen/task"
+)
+
+const (
+	// embeddingFlushInterval 后台批量向量化待索引消息的间隔
+	embeddingFlushInterval = 2 * time.Second
+	// embeddingBatchSize 单次调用向量化接口的文本条数
+	embeddingBatchSize = 32
+	// maxPendingEmbeddings 待索引队列上限，超出时丢弃新消息（可通过 ReindexConversation 补建）
+	maxPendingEmbeddings = 5000
+	// embeddingTextRunes 单条消息参与向量化的字符上限
+	embeddingTextRunes = 2000
+	// dbVectorScanLimit 内置向量存储单次近邻计算扫描的向量条数上限（按消息由新到旧）
+	dbVectorScanLimit = 5000
+	// embeddingContextLimit/embeddingContextMinScore 注入对话的历史消息条数与最低相似度
+	embeddingContextLimit    = 3
+	embeddingContextMinScore = 0.75
+)
+
+// VectorRecord 向量存储中的一条消息
+type VectorRecord struct {
+	MessageID      int64
+	ConversationID int64
+	UserID         int64
+	Role           string
+	Content        string
+	Vector         []float32
+	MessageAt      time.Time
+}
+
+// VectorQuery 近邻检索参数；检索范围限定为 UserID 的会话
+type VectorQuery struct {
+	UserID                int64
+	ConversationID        int64 // 大于 0 时仅检索该会话
+	ExcludeConversationID int64 // 大于 0 时排除该会话
+	Model                 string
+	Vector                []float32
+	Limit                 int
+}
+
+// VectorMatch 近邻检索结果，Score 为余弦相似度
+type VectorMatch struct {
+	Record *VectorRecord
+	Score  float64
+}
+
+// VectorStore 向量存储扩展点；默认使用数据库表并在内存中计算余弦近邻，
+// 数据量较大时可替换为 pgvector 等专用后端
+type VectorStore interface {
+	Upsert(ctx context.Context, model string, records []*VectorRecord) error
+	Search(ctx context.Context, query *VectorQuery) ([]*VectorMatch, error)
+	// IndexedMessageIDs 返回会话中已建立指定模型向量的消息 ID
+	IndexedMessageIDs(ctx context.Context, conversationID int64, model string) (map[int64]bool, error)
+}
+
+// EmbeddingIndex 会话消息向量索引：消息写入后异步向量化，提供语义检索与基于历史会话的检索增强。
+// 注册 Embedder 前不做任何处理
+type EmbeddingIndex interface {
+	ContextProvider
+	ConversationSemanticSearcher
+	MessageIndexer
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	// SetEmbedder 设置向量化模型，nil 关闭索引与语义检索；更换模型后旧向量不再参与检索
+	SetEmbedder(embedder client.Embedder)
+	// SetVectorStore 替换向量存储后端，nil 恢复内置存储
+	SetVectorStore(store VectorStore)
+	// ReindexConversation 为会话中尚未建立向量的消息补建索引，返回新建的条数
+	ReindexConversation(ctx context.Context, conversationID int64) (int, error)
+}
+
+type embeddingIndexImpl struct {
+	conversations repo.ConversationRepo
+	convService   ConversationService
+	defaultStore  VectorStore
+	logger        logging.ILogger
+	super         *runtime.TaskSupervisor
+
+	mu       sync.RWMutex
+	embedder client.Embedder
+	store    VectorStore
+
+	pendingMu sync.Mutex
+	pending   []*VectorRecord
+
+	lifecycleMu sync.Mutex
+	started     bool
+	stopped     bool
+	cancel      context.CancelFunc
+}
+
+func NewEmbeddingIndex(embeddings repo.MessageEmbeddingRepo, conversations repo.ConversationRepo, convService ConversationService, chat ChatService, logger logging.ILogger) EmbeddingIndex {
+	store := &dbVectorStore{repo: embeddings}
+	idx := &embeddingIndexImpl{
+		conversations: conversations,
+		convService:   convService,
+		defaultStore:  store,
+		store:         store,
+		logger:        logger,
+		super:         runtime.NewTaskSupervisor("gochen-llm.embedding_index"),
+	}
+	if convService != nil {
+		convService.SetMessageIndexer(idx)
+	}
+	if chat != nil {
+		chat.AddContextProvider(idx)
+	}
+	return idx
+}
+
+func (x *embeddingIndexImpl) SetEmbedder(embedder client.Embedder) {
+	x.mu.Lock()
+	x.embedder = embedder
+	x.mu.Unlock()
+	if x.convService == nil {
+		return
+	}
+	if embedder == nil {
+		x.convService.SetSemanticSearcher(nil)
+	} else {
+		x.convService.SetSemanticSearcher(x)
+	}
+}
+
+func (x *embeddingIndexImpl) SetVectorStore(store VectorStore) {
+	if store == nil {
+		store = x.defaultStore
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.store = store
+}
+
+func (x *embeddingIndexImpl) backend() (client.Embedder, VectorStore) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.embedder, x.store
+}
+
+func (x *embeddingIndexImpl) Start(ctx context.Context) error {
+	if ctx == nil {
+		return errorx.New(errorx.InvalidInput, "ctx 不能为空")
+	}
+
+	x.lifecycleMu.Lock()
+	defer x.lifecycleMu.Unlock()
+
+	if x.stopped {
+		return errorx.New(errorx.Internal, "EmbeddingIndex 已停止，无法再次启动")
+	}
+	if x.started {
+		return nil
+	}
+	loopCtx, cancel := context.WithCancel(ctx)
+	x.cancel = cancel
+	x.started = true
+
+	x.super.GoLoop(loopCtx, "flush_loop", embeddingFlushInterval, func(ctx context.Context) error {
+		if err := x.flush(ctx); err != nil && x.logger != nil {
+			x.logger.Warn(ctx, "写入消息向量失败", logging.Error(err))
+		}
+		return nil
+	})
+	return nil
+}
+
+func (x *embeddingIndexImpl) Stop(ctx context.Context) error {
+	x.lifecycleMu.Lock()
+	if !x.started || x.stopped {
+		x.lifecycleMu.Unlock()
+		return nil
+	}
+	x.stopped = true
+	cancel := x.cancel
+	x.lifecycleMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	x.super.Stop()
+	return nil
+}
+
+// IndexMessage 将用户与助手的消息加入待索引队列，由后台批量向量化
+func (x *embeddingIndexImpl) IndexMessage(ctx context.Context, conv *entity.Conversation, msg *entity.Message) {
+	if embedder, _ := x.backend(); embedder == nil {
+		return
+	}
+	record := embeddingRecord(conv, msg)
+	if record == nil {
+		return
+	}
+	x.pendingMu.Lock()
+	defer x.pendingMu.Unlock()
+	if len(x.pending) >= maxPendingEmbeddings {
+		return
+	}
+	x.pending = append(x.pending, record)
+}
+
+// flush 按批取出待索引消息写入向量；失败的批次丢弃，避免单条异常数据阻塞队列
+func (x *embeddingIndexImpl) flush(ctx context.Context) error {
+	embedder, store := x.backend()
+	if embedder == nil {
+		x.pendingMu.Lock()
+		x.pending = nil
+		x.pendingMu.Unlock()
+		return nil
+	}
+	for ctx.Err() == nil {
+		x.pendingMu.Lock()
+		n := len(x.pending)
+		if n > embeddingBatchSize {
+			n = embeddingBatchSize
+		}
+		batch := x.pending[:n:n]
+		x.pending = x.pending[n:]
+		x.pendingMu.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := embedRecords(ctx, embedder, store, batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *embeddingIndexImpl) ReindexConversation(ctx context.Context, conversationID int64) (int, error) {
+	embedder, store := x.backend()
+	if embedder == nil {
+		return 0, errorx.New(errorx.Validation, "未配置向量化模型")
+	}
+	if x.conversations == nil {
+		return 0, errorx.New(errorx.Internal, "会话仓储未配置")
+	}
+	conv, err := x.conversations.GetConversation(ctx, conversationID)
+	if err != nil {
+		return 0, err
+	}
+	if conv == nil {
+		return 0, errorx.New(errorx.NotFound, "会话不存在")
+	}
+	indexed, err := store.IndexedMessageIDs(ctx, conversationID, embedder.Model())
+	if err != nil {
+		return 0, err
+	}
+	created := 0
+	var lastID int64
+	for {
+		msgs, err := x.conversations.GetMessagesAfter(ctx, conversationID, lastID, summaryBatchMessages)
+		if err != nil {
+			return created, err
+		}
+		if len(msgs) == 0 {
+			return created, nil
+		}
+		lastID = msgs[len(msgs)-1].ID
+		var batch []*VectorRecord
+		for _, m := range msgs {
+			if indexed[m.ID] {
+				continue
+			}
+			if record := embeddingRecord(conv, m); record != nil {
+				batch = append(batch, record)
+			}
+		}
+		for start := 0; start < len(batch); start += embeddingBatchSize {
+			end := start + embeddingBatchSize
+			if end > len(batch) {
+				end = len(batch)
+			}
+			if err := embedRecords(ctx, embedder, store, batch[start:end]); err != nil {
+				return created, err
+			}
+			created += end - start
+		}
+		if len(msgs) < summaryBatchMessages {
+			return created, nil
+		}
+	}
+}
+
+// SearchMessages 实现 ConversationSemanticSearcher
+func (x *embeddingIndexImpl) SearchMessages(ctx context.Context, userID int64, query string, conversationID int64, limit int) ([]*ConversationSearchHit, error) {
+	matches, err := x.search(ctx, &VectorQuery{UserID: userID, ConversationID: conversationID, Limit: limit}, query)
+	if err != nil {
+		return nil, err
+	}
+	hits := make([]*ConversationSearchHit, 0, len(matches))
+	for _, m := range matches {
+		hits = append(hits, &ConversationSearchHit{
+			ConversationID: m.Record.ConversationID,
+			MessageID:      m.Record.MessageID,
+			Role:           m.Record.Role,
+			Snippet:        m.Record.Content,
+			Score:          m.Score,
+			CreatedAt:      m.Record.MessageAt,
+		})
+	}
+	return hits, nil
+}
+
+func (x *embeddingIndexImpl) Name() string { return "conversation_history" }
+
+// Retrieve 检索用户其他会话中与当前问题相近的消息，作为参考资料注入
+func (x *embeddingIndexImpl) Retrieve(ctx context.Context, query *ContextQuery) ([]*ContextSnippet, error) {
+	if embedder, _ := x.backend(); embedder == nil || query == nil || query.UserID <= 0 {
+		return nil, nil
+	}
+	if category, _ := query.Metadata["category"].(string); internalChatCategories[category] {
+		return nil, nil
+	}
+	matches, err := x.search(ctx, &VectorQuery{
+		UserID:                query.UserID,
+		ExcludeConversationID: query.ConversationID,
+		Limit:                 embeddingContextLimit,
+	}, query.Query)
+	if err != nil {
+		return nil, err
+	}
+	var snippets []*ContextSnippet
+	for _, m := range matches {
+		if m.Score < embeddingContextMinScore {
+			continue
+		}
+		snippets = append(snippets, &ContextSnippet{
+			Source:  fmt.Sprintf("conversation:%d", m.Record.ConversationID),
+			Content: m.Record.Role + ": " + m.Record.Content,
+			Score:   m.Score,
+		})
+	}
+	return snippets, nil
+}
+
+func (x *embeddingIndexImpl) search(ctx context.Context, q *VectorQuery, text string) ([]*VectorMatch, error) {
+	embedder, store := x.backend()
+	if embedder == nil {
+		return nil, errorx.New(errorx.Validation, "未配置向量化模型")
+	}
+	text, _ = truncateRunes(strings.TrimSpace(text), embeddingTextRunes)
+	if text == "" || q.UserID <= 0 {
+		return nil, nil
+	}
+	vectors, err := embedder.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "向量化检索内容失败")
+	}
+	if len(vectors) != 1 {
+		return nil, errorx.New(errorx.Internal, "向量化结果条数不符")
+	}
+	q.Model, q.Vector = embedder.Model(), vectors[0]
+	return store.Search(ctx, q)
+}
+
+// embeddingRecord 仅索引用户与助手的非空消息
+func embeddingRecord(conv *entity.Conversation, msg *entity.Message) *VectorRecord {
+	if conv == nil || msg == nil || msg.ID <= 0 || (msg.Role != "user" && msg.Role != "assistant") {
+		return nil
+	}
+	content, _ := truncateRunes(strings.TrimSpace(msg.Content), embeddingTextRunes)
+	if content == "" {
+		return nil
+	}
+	return &VectorRecord{
+		MessageID:      msg.ID,
+		ConversationID: conv.ID,
+		UserID:         conv.UserID,
+		Role:           msg.Role,
+		Content:        content,
+		MessageAt:      msg.CreatedAt,
+	}
+}
+
+func embedRecords(ctx context.Context, embedder client.Embedder, store VectorStore, records []*VectorRecord) error {
+	texts := make([]string, len(records))
+	for i, r := range records {
+		texts[i] = r.Content
+	}
+	vectors, err := embedder.Embed(ctx, texts)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Internal, "向量化消息失败")
+	}
+	if len(vectors) != len(records) {
+		return errorx.New(errorx.Internal, "向量化结果条数不符")
+	}
+	for i, r := range records {
+		r.Vector = vectors[i]
+	}
+	return store.Upsert(ctx, embedder.Model(), records)
+}
+
+// dbVectorStore 内置向量存储：向量以 JSON 保存在 llm_message_embeddings，检索时扫描用户最近的向量计算余弦相似度
+type dbVectorStore struct {
+	repo repo.MessageEmbeddingRepo
+}
+
+func (d *dbVectorStore) Upsert(ctx context.Context, model string, records []*VectorRecord) error {
+	if d.repo == nil {
+		return errorx.New(errorx.Internal, "消息向量 repo 未配置")
+	}
+	for _, r := range records {
+		data, err := json.Marshal(r.Vector)
+		if err != nil {
+			return errorx.Wrap(err, errorx.Internal, "序列化向量失败")
+		}
+		if err := d.repo.Save(ctx, &entity.MessageEmbedding{
+			MessageID:      r.MessageID,
+			ConversationID: r.ConversationID,
+			UserID:         r.UserID,
+			Role:           r.Role,
+			Content:        r.Content,
+			Model:          model,
+			Dim:            len(r.Vector),
+			VectorJSON:     string(data),
+			MessageAt:      r.MessageAt,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *dbVectorStore) Search(ctx context.Context, q *VectorQuery) ([]*VectorMatch, error) {
+	if d.repo == nil {
+		return nil, errorx.New(errorx.Internal, "消息向量 repo 未配置")
+	}
+	candidates, err := d.repo.ListCandidates(ctx, q.UserID, q.ConversationID, q.Model, dbVectorScanLimit)
+	if err != nil {
+		return nil, err
+	}
+	var matches []*VectorMatch
+	for _, c := range candidates {
+		if q.ExcludeConversationID > 0 && c.ConversationID == q.ExcludeConversationID {
+			continue
+		}
+		if c.Dim != len(q.Vector) {
+			continue
+		}
+		var vector []float32
+		if err := json.Unmarshal([]byte(c.VectorJSON), &vector); err != nil {
+			continue
+		}
+		matches = append(matches, &VectorMatch{
+			Record: &VectorRecord{
+				MessageID:      c.MessageID,
+				ConversationID: c.ConversationID,
+				UserID:         c.UserID,
+				Role:           c.Role,
+				Content:        c.Content,
+				MessageAt:      c.MessageAt,
+			},
+			Score: cosineSimilarity(q.Vector, vector),
+		})
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	if q.Limit > 0 && len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+	}
+	return matches, nil
+}
+
+func (d *dbVectorStore) IndexedMessageIDs(ctx context.Context, conversationID int64, model string) (map[int64]bool, error) {
+	if d.repo == nil {
+		return nil, errorx.New(errorx.Internal, "消息向量 repo 未配置")
+	}
+	return d.repo.IndexedMessageIDs(ctx, conversationID, model)
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gochen-llm/client"
+	"gochen-llm/entity"
+)
+
+// maxCallErrorRunes 记入审计日志的原始错误信息字符上限
+const maxCallErrorRunes = 2000
+
+var (
+	// errorStatusPattern 从错误文本中提取 HTTP 状态码，用于错误链不支持 errors.As 的情况
+	errorStatusPattern = regexp.MustCompile(`status=(\d{3})`)
+
+	contextLengthMarkers = []string{"context_length", "context length", "maximum context", "context window", "too many tokens", "prompt is too long", "input is too long"}
+	contentPolicyMarkers = []string{"content_policy", "content policy", "content_filter", "responsible ai", "safety"}
+	timeoutMarkers       = []string{"timeout", "timed out", "deadline exceeded"}
+)
+
+// classifyCallError 将 provider 调用错误归入 entity.MetricsError* 固定分类，避免指标中出现无界的原始错误文本
+func classifyCallError(err error) string {
+	if err == nil {
+		return ""
+	}
+	if _, ok := AsRateLimited(err); ok {
+		return entity.MetricsErrorRateLimited
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return entity.MetricsErrorTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return entity.MetricsErrorTimeout
+	}
+	var httpErr *client.HTTPError
+	if errors.As(err, &httpErr) {
+		return classifyHTTPStatus(httpErr.StatusCode, strings.ToLower(httpErr.Body))
+	}
+
+	msg := strings.ToLower(err.Error())
+	if m := errorStatusPattern.FindStringSubmatch(msg); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		return classifyHTTPStatus(code, msg)
+	}
+	switch {
+	case containsAny(msg, timeoutMarkers):
+		return entity.MetricsErrorTimeout
+	case containsAny(msg, contextLengthMarkers):
+		return entity.MetricsErrorContextLength
+	case strings.Contains(msg, "没有可用的 llm 端点"), strings.Contains(msg, "llm 未配置"):
+		return entity.MetricsErrorUnavailable
+	}
+	return entity.MetricsErrorOther
+}
+
+func classifyHTTPStatus(code int, body string) string {
+	switch {
+	case code == 401 || code == 403:
+		return entity.MetricsErrorAuth
+	case code == 429:
+		return entity.MetricsErrorRateLimited
+	case code == 408 || code == 504:
+		return entity.MetricsErrorTimeout
+	case code >= 500:
+		return entity.MetricsErrorProvider5xx
+	case containsAny(body, contextLengthMarkers):
+		return entity.MetricsErrorContextLength
+	case containsAny(body, contentPolicyMarkers):
+		return entity.MetricsErrorSafetyBlocked
+	}
+	return entity.MetricsErrorOther
+}
+
+func containsAny(s string, markers []string) bool {
+	for _, m := range markers {
+		if strings.Contains(s, m) {
+			return true
+		}
+	}
+	return false
+}
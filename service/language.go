@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// 支持检测的语言代码
+const (
+	LanguageAuto     = "auto"
+	LanguageChinese  = "zh"
+	LanguageEnglish  = "en"
+	LanguageJapanese = "ja"
+	LanguageKorean   = "ko"
+	LanguageRussian  = "ru"
+)
+
+var languageDisplayNames = map[string]string{
+	LanguageChinese:  "简体中文",
+	LanguageEnglish:  "English",
+	LanguageJapanese: "日本語",
+	LanguageKorean:   "한국어",
+	LanguageRussian:  "Русский",
+}
+
+// detectLanguage 基于文字系统的粗略语言检测，无法判断时返回空字符串。
+// 拉丁字母按单词计数、CJK 按字计数，避免中文夹杂英文术语时被误判。
+func detectLanguage(text string) string {
+	var han, kana, hangul, cyrillic, latinWords int
+	inLatinWord := false
+	for _, r := range text {
+		isLatin := r < unicode.MaxASCII && unicode.IsLetter(r)
+		if isLatin && !inLatinWord {
+			latinWords++
+		}
+		inLatinWord = isLatin
+		switch {
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		}
+	}
+
+	// 日文通常混用汉字与假名，出现一定比例假名即判定为日文
+	if kana > 0 && kana*5 >= kana+han {
+		return LanguageJapanese
+	}
+	counts := []struct {
+		lang  string
+		count int
+	}{
+		{LanguageChinese, han + kana},
+		{LanguageKorean, hangul},
+		{LanguageRussian, cyrillic},
+		{LanguageEnglish, latinWords},
+	}
+	best := ""
+	bestCount := 1
+	for _, c := range counts {
+		if c.count > bestCount {
+			best = c.lang
+			bestCount = c.count
+		}
+	}
+	return best
+}
+
+// languageMatches 判断文本是否符合目标语言，按主语言子标签比较（zh-CN 与 zh 等价）；
+// 无法判断文本语言或目标语言不在检测范围内时视为匹配，避免误重试
+func languageMatches(text string, lang string) bool {
+	base := baseLanguage(lang)
+	if _, ok := languageDisplayNames[base]; !ok {
+		return true
+	}
+	detected := detectLanguage(text)
+	if detected == "" {
+		return true
+	}
+	return detected == base
+}
+
+// baseLanguage 归一化语言标签并取主语言子标签，如 zh-CN、zh_Hans → zh
+func baseLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "-_"); i >= 0 {
+		lang = lang[:i]
+	}
+	return lang
+}
+
+func languageDisplayName(lang string) string {
+	if name, ok := languageDisplayNames[lang]; ok {
+		return name
+	}
+	return lang
+}
+
+func languageInstruction(lang string) string {
+	return fmt.Sprintf("请使用%s（%s）回答。", languageDisplayName(lang), lang)
+}
+
+func strictLanguageInstruction(lang string) string {
+	return fmt.Sprintf("重要：无论输入或上下文使用何种语言，你的回答必须完全使用%s（%s）。", languageDisplayName(lang), lang)
+}
+
+// resolveOutputLanguage 确定期望的输出语言：请求显式指定优先，
+// 否则在安全策略开启 EnforceOutputLanguage 时按最近一条用户消息自动检测。
+func (s *chatServiceImpl) resolveOutputLanguage(ctx context.Context, req *ChatRequest) string {
+	lang := strings.ToLower(strings.TrimSpace(req.Language))
+	if lang != "" && lang != LanguageAuto {
+		// 保留完整标签（如 zh-tw）用于提示模型，校验时由 languageMatches 归一到主语言子标签
+		return lang
+	}
+	if s.safety == nil {
+		return ""
+	}
+	policy, err := s.safety.GetActivePolicy(ctx)
+	if err != nil || policy == nil || !policy.Enabled || !policy.EnforceOutputLanguage {
+		return ""
+	}
+	for i := len(req.Messages) - 1; i >= 0; i-- {
+		m := req.Messages[i]
+		if m.Role == "" || m.Role == "user" {
+			return detectLanguage(m.Content)
+		}
+	}
+	return ""
+}
+
+func appendSystemPrompt(system string, extra string) string {
+	if system == "" {
+		return extra
+	}
+	return system + "\n\n" + extra
+}
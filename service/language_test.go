@@ -0,0 +1,27 @@
+package service
+
+import "testing"
+
+func TestLanguageMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		lang string
+		want bool
+	}{
+		{name: "same language", text: "这是一个中文回答", lang: "zh", want: true},
+		{name: "region subtag", text: "这是一个中文回答", lang: "zh-CN", want: true},
+		{name: "underscore subtag", text: "This is an English answer", lang: "en_US", want: true},
+		{name: "mismatch", text: "This is an English answer", lang: "zh-tw", want: false},
+		{name: "undetectable target", text: "This is an English answer", lang: "fr", want: true},
+		{name: "undetectable text", text: "1234", lang: "en", want: true},
+		{name: "empty target", text: "这是一个中文回答", lang: "", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := languageMatches(tt.text, tt.lang); got != tt.want {
+				t.Fatalf("languageMatches(%q, %q) = %v, want %v", tt.text, tt.lang, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+	"gochen/logging"
+	runtime "gochen/task"
+)
+
+// MemoryExtractionPromptName 长期记忆提取提示词模板名称（用户作用域可覆盖），
+// 模板变量：existing_memories；模型需输出 JSON 数组 [{"category":"fact|preference","content":"..."}]
+const MemoryExtractionPromptName = "llm.memory_extraction"
+
+const (
+	defaultMemoryExtractInterval = 10 * time.Minute
+	// memoryIdleDelay 会话最近一条消息超过该时长后才提取，避免对进行中的对话反复调用模型
+	memoryIdleDelay = 10 * time.Minute
+	// memoryExtractBatch 每轮处理的会话数
+	memoryExtractBatch = 20
+	// maxUserMemories 每个用户保留的记忆条数上限，超出时淘汰最早更新的记忆
+	maxUserMemories = 50
+	// memoryInjectLimit 注入对话的记忆条数上限
+	memoryInjectLimit = 20
+	// memoryContentRunes 单条记忆的字符上限
+	memoryContentRunes = 200
+)
+
+const defaultMemoryExtractionPrompt = `你负责从用户与助手的对话中提取关于用户的长期记忆。
+已知记忆：
+%s
+
+只提取对后续对话长期有用、且由用户明确表达的稳定事实（fact）或偏好（preference），忽略一次性的任务内容、助手的发言与已知记忆中已有的信息。
+仅输出 JSON 数组，例如 [{"category":"preference","content":"希望回答尽量简洁"}]；没有新记忆时输出 []。`
+
+// internalChatCategories 内部生成类请求（摘要、标题、记忆提取），不注入用户记忆与历史检索结果
+var internalChatCategories = map[string]bool{
+	"conversation_summary": true,
+	"conversation_title":   true,
+	"memory_extraction":    true,
+}
+
+// MemoryService 周期性地从会话中提取用户的稳定事实与偏好，并作为 ContextProvider 注入后续对话
+type MemoryService interface {
+	ContextProvider
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	// ExtractOnce 立即处理一批待提取的会话，返回处理的会话数
+	ExtractOnce(ctx context.Context) (int, error)
+	// ExtractConversation 立即从用户本人的会话中提取记忆，返回新增的记忆
+	ExtractConversation(ctx context.Context, userID, conversationID int64) ([]*entity.UserMemory, error)
+	ListMemories(ctx context.Context, userID int64) ([]*entity.UserMemory, error)
+	DeleteMemory(ctx context.Context, userID, memoryID int64) error
+}
+
+type memoryServiceImpl struct {
+	repo          repo.UserMemoryRepo
+	conversations repo.ConversationRepo
+	chat          ChatService
+	logger        logging.ILogger
+	super         *runtime.TaskSupervisor
+
+	interval time.Duration
+	// userMu 串行化同一用户的提取，避免并发写入重复记忆
+	userMu sync.Map
+
+	lifecycleMu sync.Mutex
+	started     bool
+	stopped     bool
+	cancel      context.CancelFunc
+}
+
+func NewMemoryService(memories repo.UserMemoryRepo, conversations repo.ConversationRepo, chat ChatService, logger logging.ILogger) MemoryService {
+	svc := &memoryServiceImpl{
+		repo:          memories,
+		conversations: conversations,
+		chat:          chat,
+		logger:        logger,
+		super:         runtime.NewTaskSupervisor("gochen-llm.memory"),
+		interval:      defaultMemoryExtractInterval,
+	}
+	if chat != nil {
+		chat.AddContextProvider(svc)
+	}
+	return svc
+}
+
+func (s *memoryServiceImpl) Start(ctx context.Context) error {
+	if ctx == nil {
+		return errorx.New(errorx.InvalidInput, "ctx 不能为空")
+	}
+
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+
+	if s.stopped {
+		return errorx.New(errorx.Internal, "MemoryService 已停止，无法再次启动")
+	}
+	if s.started {
+		return nil
+	}
+	loopCtx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.started = true
+
+	s.super.GoLoop(loopCtx, "extract_loop", s.interval, func(ctx context.Context) error {
+		if _, err := s.ExtractOnce(ctx); err != nil && s.logger != nil {
+			s.logger.Warn(ctx, "提取用户长期记忆失败", logging.Error(err))
+		}
+		return nil
+	})
+	return nil
+}
+
+func (s *memoryServiceImpl) Stop(ctx context.Context) error {
+	s.lifecycleMu.Lock()
+	if !s.started || s.stopped {
+		s.lifecycleMu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	cancel := s.cancel
+	s.lifecycleMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.super.Stop()
+	return nil
+}
+
+func (s *memoryServiceImpl) ExtractOnce(ctx context.Context) (int, error) {
+	if s.repo == nil || s.conversations == nil || s.chat == nil {
+		return 0, errorx.New(errorx.Internal, "MemoryService 依赖未配置")
+	}
+	list, err := s.conversations.ListPendingMemory(ctx, time.Now().Add(-memoryIdleDelay), memoryExtractBatch)
+	if err != nil {
+		return 0, err
+	}
+	processed := 0
+	for _, conv := range list {
+		if ctx.Err() != nil {
+			break
+		}
+		if _, err := s.extract(ctx, conv); err != nil {
+			// 单个会话失败不影响其他会话，游标未推进，下一轮重试
+			if s.logger != nil {
+				s.logger.Warn(ctx, "从会话提取长期记忆失败", logging.Error(err))
+			}
+			continue
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+func (s *memoryServiceImpl) ExtractConversation(ctx context.Context, userID, conversationID int64) ([]*entity.UserMemory, error) {
+	if s.repo == nil || s.conversations == nil || s.chat == nil {
+		return nil, errorx.New(errorx.Internal, "MemoryService 依赖未配置")
+	}
+	conv, err := s.conversations.GetConversation(ctx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil || userID <= 0 || conv.UserID != userID {
+		return nil, errorx.New(errorx.NotFound, "会话不存在")
+	}
+	return s.extract(ctx, conv)
+}
+
+// extract 将游标之后的新消息送入模型提取记忆，与已有记忆去重后保存并推进游标；
+// 单次最多处理 summaryBatchMessages 条消息，剩余消息留待下一轮
+func (s *memoryServiceImpl) extract(ctx context.Context, conv *entity.Conversation) ([]*entity.UserMemory, error) {
+	mu, _ := s.userMu.LoadOrStore(conv.UserID, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	msgs, err := s.conversations.GetMessagesAfter(ctx, conv.ID, conv.MemoryMessageID, summaryBatchMessages)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+	transcript, lastID := summaryTranscript(msgs)
+	existing, err := s.repo.ListByUser(ctx, conv.UserID, 0)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := s.generate(ctx, conv, existing, transcript)
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{}
+	for _, m := range existing {
+		known[normalizeMemory(m.Content)] = true
+	}
+	var created []*entity.UserMemory
+	for _, c := range candidates {
+		key := normalizeMemory(c.Content)
+		if key == "" || known[key] {
+			continue
+		}
+		known[key] = true
+		if err := s.repo.Create(ctx, c); err != nil {
+			return created, err
+		}
+		created = append(created, c)
+	}
+	if len(created) > 0 {
+		if over := len(existing) + len(created) - maxUserMemories; over > 0 {
+			if err := s.repo.DeleteOldest(ctx, conv.UserID, over); err != nil {
+				return created, err
+			}
+		}
+	}
+	if err := s.conversations.UpdateMemoryCursor(ctx, conv.ID, lastID); err != nil {
+		return created, err
+	}
+	conv.MemoryMessageID = lastID
+	return created, nil
+}
+
+// generate 优先使用 llm.memory_extraction 模板，模板不存在时使用内置提示
+func (s *memoryServiceImpl) generate(ctx context.Context, conv *entity.Conversation, existing []*entity.UserMemory, transcript string) ([]*entity.UserMemory, error) {
+	var sb strings.Builder
+	for _, m := range existing {
+		sb.WriteString("- ")
+		sb.WriteString(m.Content)
+		sb.WriteString("\n")
+	}
+	known := strings.TrimSpace(sb.String())
+	metadata := map[string]interface{}{"category": "memory_extraction", "conversation_id": conv.ID}
+	messages := []Message{{Role: "user", Content: transcript}}
+	resp, err := s.chat.ChatWithPrompt(ctx, &PromptChatRequest{
+		UserID:        conv.UserID,
+		PromptName:    MemoryExtractionPromptName,
+		PromptScope:   entity.PromptScopeUser,
+		PromptScopeID: conv.UserID,
+		Variables:     map[string]interface{}{"existing_memories": known},
+		Messages:      messages,
+		Metadata:      metadata,
+	})
+	if errorx.Is(err, errorx.NotFound) {
+		if known == "" {
+			known = "（无）"
+		}
+		resp, err = s.chat.Chat(ctx, &ChatRequest{
+			UserID:      conv.UserID,
+			System:      fmt.Sprintf(defaultMemoryExtractionPrompt, known),
+			Messages:    messages,
+			Temperature: 0,
+			MaxTokens:   512,
+			Metadata:    metadata,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.Degraded {
+		return nil, errorx.New(errorx.Internal, "记忆提取降级，稍后重试")
+	}
+	return parseMemories(resp.Content, conv)
+}
+
+// parseMemories 解析模型输出的 JSON 数组，容忍前后的说明文字与代码块标记
+func parseMemories(content string, conv *entity.Conversation) ([]*entity.UserMemory, error) {
+	start, end := strings.Index(content, "["), strings.LastIndex(content, "]")
+	if start < 0 || end < start {
+		return nil, errorx.New(errorx.Internal, "模型返回的记忆不是 JSON 数组")
+	}
+	var items []struct {
+		Category string `json:"category"`
+		Content  string `json:"content"`
+	}
+	if err := json.Unmarshal([]byte(content[start:end+1]), &items); err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "解析模型返回的记忆失败")
+	}
+	memories := make([]*entity.UserMemory, 0, len(items))
+	for _, item := range items {
+		text, _ := truncateRunes(strings.TrimSpace(item.Content), memoryContentRunes)
+		if text == "" {
+			continue
+		}
+		category := item.Category
+		if category != entity.UserMemoryCategoryPreference {
+			category = entity.UserMemoryCategoryFact
+		}
+		memories = append(memories, &entity.UserMemory{
+			UserID:               conv.UserID,
+			Category:             category,
+			Content:              text,
+			SourceConversationID: conv.ID,
+		})
+	}
+	return memories, nil
+}
+
+func normalizeMemory(content string) string {
+	return strings.ToLower(strings.Join(strings.Fields(content), " "))
+}
+
+func (s *memoryServiceImpl) ListMemories(ctx context.Context, userID int64) ([]*entity.UserMemory, error) {
+	if userID <= 0 {
+		return nil, errorx.New(errorx.Validation, "userID 无效")
+	}
+	if s.repo == nil {
+		return nil, errorx.New(errorx.Internal, "用户记忆 repo 未配置")
+	}
+	return s.repo.ListByUser(ctx, userID, 0)
+}
+
+func (s *memoryServiceImpl) DeleteMemory(ctx context.Context, userID, memoryID int64) error {
+	if userID <= 0 || memoryID <= 0 {
+		return errorx.New(errorx.Validation, "参数无效")
+	}
+	if s.repo == nil {
+		return errorx.New(errorx.Internal, "用户记忆 repo 未配置")
+	}
+	deleted, err := s.repo.Delete(ctx, userID, memoryID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errorx.New(errorx.NotFound, "记忆不存在")
+	}
+	return nil
+}
+
+func (s *memoryServiceImpl) Name() string { return "user_memory" }
+
+// Retrieve 将用户最近更新的记忆合并为一个片段注入；记忆与问题的相关性交由模型判断
+func (s *memoryServiceImpl) Retrieve(ctx context.Context, query *ContextQuery) ([]*ContextSnippet, error) {
+	if s.repo == nil || query == nil || query.UserID <= 0 {
+		return nil, nil
+	}
+	if category, _ := query.Metadata["category"].(string); internalChatCategories[category] {
+		return nil, nil
+	}
+	list, err := s.repo.ListByUser(ctx, query.UserID, memoryInjectLimit)
+	if err != nil || len(list) == 0 {
+		return nil, err
+	}
+	var sb strings.Builder
+	sb.WriteString("关于用户的已知信息：")
+	for _, m := range list {
+		sb.WriteString("\n- ")
+		sb.WriteString(m.Content)
+	}
+	return []*ContextSnippet{{Source: "user_memory", Content: sb.String(), Score: 1}}, nil
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"gochen-llm/client"
+	"gochen-llm/entity"
+)
+
+const (
+	// attachmentTextRunes 单个附件渲染进提示词的抽取文本字符上限
+	attachmentTextRunes = 8000
+	// attachmentTotalRunes 单条消息所有附件渲染文本的字符上限，超出部分仅保留附件标题
+	attachmentTotalRunes = 20000
+)
+
+// Attachment 消息附件：FileRef 为文件地址或存储键，ExtractedText 为预先抽取的正文（如文档内容、OCR 结果）
+type Attachment struct {
+	FileRef       string `json:"file_ref"`
+	FileName      string `json:"file_name,omitempty"`
+	MimeType      string `json:"mime_type"`
+	SizeBytes     int64  `json:"size_bytes,omitempty"`
+	ExtractedText string `json:"extracted_text,omitempty"`
+}
+
+// AttachmentsFromEntity 将持久化的附件转换为聊天请求中的附件，用于以历史消息构造请求
+func AttachmentsFromEntity(list []*entity.MessageAttachment) []*Attachment {
+	if len(list) == 0 {
+		return nil
+	}
+	out := make([]*Attachment, 0, len(list))
+	for _, a := range list {
+		out = append(out, &Attachment{
+			FileRef:       a.FileRef,
+			FileName:      a.FileName,
+			MimeType:      a.MimeType,
+			SizeBytes:     a.SizeBytes,
+			ExtractedText: a.ExtractedText,
+		})
+	}
+	return out
+}
+
+func hasAttachments(msgs []Message) bool {
+	for _, m := range msgs {
+		if len(m.Attachments) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// renderAttachments 返回新的消息列表：附件标题与抽取文本追加到正文之后；
+// 仅保留可直接引用的图片附件，供 convertMessages 作为多模态内容传递
+func renderAttachments(msgs []Message) []Message {
+	out := make([]Message, len(msgs))
+	for i, m := range msgs {
+		out[i] = m
+		if len(m.Attachments) == 0 {
+			continue
+		}
+		var sb strings.Builder
+		sb.WriteString(m.Content)
+		var images []*Attachment
+		budget := attachmentTotalRunes
+		for _, a := range m.Attachments {
+			if a == nil {
+				continue
+			}
+			if sb.Len() > 0 {
+				sb.WriteString("\n\n")
+			}
+			sb.WriteString(attachmentHeader(a))
+			if isImageAttachment(a) {
+				images = append(images, a)
+			}
+			text := strings.TrimSpace(a.ExtractedText)
+			if text == "" || budget <= 0 {
+				continue
+			}
+			limit := attachmentTextRunes
+			if limit > budget {
+				limit = budget
+			}
+			text, truncated := truncateRunes(text, limit)
+			budget -= len([]rune(text))
+			sb.WriteString("\n")
+			sb.WriteString(text)
+			if truncated {
+				sb.WriteString("\n（附件内容过长，已截断）")
+			}
+		}
+		out[i].Content = sb.String()
+		out[i].Attachments = images
+	}
+	return out
+}
+
+func attachmentHeader(a *Attachment) string {
+	name := a.FileName
+	if name == "" {
+		name = a.FileRef
+		if strings.HasPrefix(name, "data:") {
+			name = "inline"
+		}
+	}
+	if a.MimeType == "" {
+		return fmt.Sprintf("[附件: %s]", name)
+	}
+	return fmt.Sprintf("[附件: %s (%s)]", name, a.MimeType)
+}
+
+// isImageAttachment 图片附件且 FileRef 可由 provider 直接读取（http(s) 地址或 data URL）
+func isImageAttachment(a *Attachment) bool {
+	if !strings.HasPrefix(strings.ToLower(a.MimeType), "image/") {
+		return false
+	}
+	ref := strings.ToLower(a.FileRef)
+	return strings.HasPrefix(ref, "https://") || strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "data:image/")
+}
+
+func attachmentImages(list []*Attachment) []client.ChatImage {
+	var images []client.ChatImage
+	for _, a := range list {
+		if a != nil && isImageAttachment(a) {
+			images = append(images, client.ChatImage{URL: a.FileRef, MimeType: a.MimeType})
+		}
+	}
+	return images
+}
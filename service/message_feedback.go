@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+// maxFeedbackCommentRunes 文字反馈的字符上限
+const maxFeedbackCommentRunes = 2000
+
+// FeedbackConversionOutcome 带 A/B 信息的助手消息首次被点赞时记录的转化事件
+const FeedbackConversionOutcome = "thumbs_up"
+
+// MessageFeedbackRequest 对助手消息的反馈：rating 为 1（赞）/-1（踩）/0（仅文字，comment 必填）
+type MessageFeedbackRequest struct {
+	MessageID int64  `json:"message_id"`
+	Rating    int    `json:"rating"`
+	Comment   string `json:"comment"`
+}
+
+// messageOrigin 助手消息元数据中记录的生成来源（即聊天响应的 Metadata）
+type messageOrigin struct {
+	Provider         string `json:"provider"`
+	Model            string `json:"model"`
+	PromptTemplateID int64  `json:"prompt_template_id"`
+	ABTestID         int64  `json:"ab_test_id"`
+	ABVariant        string `json:"ab_variant"`
+}
+
+func (s *conversationServiceImpl) SubmitMessageFeedback(ctx context.Context, userID, conversationID int64, req MessageFeedbackRequest) (*entity.MessageFeedback, error) {
+	if req.Rating < entity.FeedbackThumbsDown || req.Rating > entity.FeedbackThumbsUp {
+		return nil, errorx.New(errorx.Validation, "rating 仅支持 1/-1/0")
+	}
+	comment := strings.TrimSpace(req.Comment)
+	if req.Rating == entity.FeedbackNeutral && comment == "" {
+		return nil, errorx.New(errorx.Validation, "未评价时 comment 不能为空")
+	}
+	if len([]rune(comment)) > maxFeedbackCommentRunes {
+		return nil, errorx.New(errorx.Validation, "comment 不能超过 2000 个字符")
+	}
+	conv, err := s.authorize(ctx, userID, conversationID, entity.ConversationAccessViewer)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := s.assistantMessage(ctx, conv.ID, req.MessageID)
+	if err != nil {
+		return nil, err
+	}
+
+	var origin messageOrigin
+	_ = json.Unmarshal([]byte(msg.MetadataJSON), &origin)
+	feedback := &entity.MessageFeedback{
+		MessageID:        msg.ID,
+		UserID:           userID,
+		ConversationID:   conv.ID,
+		Rating:           req.Rating,
+		Comment:          comment,
+		Provider:         origin.Provider,
+		Model:            origin.Model,
+		PromptTemplateID: origin.PromptTemplateID,
+		ABTestID:         origin.ABTestID,
+		ABVariant:        origin.ABVariant,
+	}
+	previous, err := s.repo.SaveFeedback(ctx, feedback)
+	if err != nil {
+		return nil, err
+	}
+
+	// 点赞计为 A/B 转化；同一用户对同一消息只计一次
+	firstThumbsUp := req.Rating == entity.FeedbackThumbsUp && (previous == nil || previous.Rating != entity.FeedbackThumbsUp)
+	if firstThumbsUp && origin.ABTestID > 0 && s.metrics != nil {
+		_ = s.metrics.Save(ctx, &entity.Metrics{
+			Provider:       origin.Provider,
+			Model:          origin.Model,
+			UserID:         userID,
+			ConversationID: conv.ID,
+			ABTestID:       origin.ABTestID,
+			ABVariant:      origin.ABVariant,
+			PromptTemplate: origin.PromptTemplateID,
+			Status:         "converted",
+			Outcome:        FeedbackConversionOutcome,
+			CreatedAt:      time.Now(),
+		})
+	}
+	return feedback, nil
+}
+
+func (s *conversationServiceImpl) GetMessageFeedback(ctx context.Context, userID, conversationID, messageID int64) (*entity.MessageFeedback, error) {
+	conv, err := s.authorize(ctx, userID, conversationID, entity.ConversationAccessViewer)
+	if err != nil {
+		return nil, err
+	}
+	feedback, err := s.repo.GetFeedback(ctx, messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if feedback == nil || feedback.ConversationID != conv.ID {
+		return nil, nil
+	}
+	return feedback, nil
+}
+
+// assistantMessage 读取会话中的助手消息，消息不存在或不属于该会话时返回 NotFound
+func (s *conversationServiceImpl) assistantMessage(ctx context.Context, conversationID, messageID int64) (*entity.Message, error) {
+	if messageID <= 0 {
+		return nil, errorx.New(errorx.Validation, "message_id 无效")
+	}
+	msgs, err := s.repo.GetMessagesAfter(ctx, conversationID, messageID-1, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 || msgs[0].ID != messageID {
+		return nil, errorx.New(errorx.NotFound, "消息不存在")
+	}
+	if msgs[0].Role != "assistant" {
+		return nil, errorx.New(errorx.Validation, "仅支持对助手消息反馈")
+	}
+	return msgs[0], nil
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+	"gochen/logging"
+	runtime "gochen/task"
+)
+
+const (
+	defaultAnomalyInterval = 5 * time.Minute
+	// defaultAnomalyWindow 当前窗口长度；基线为当前窗口之前的 defaultAnomalyBaseline
+	defaultAnomalyWindow   = 15 * time.Minute
+	defaultAnomalyBaseline = 24 * time.Hour
+	// defaultAnomalyCooldown 同一模型同一指标两次告警的最小间隔
+	defaultAnomalyCooldown = time.Hour
+)
+
+// 异常检测的指标
+const (
+	AnomalyMetricErrorRate   = "error_rate"
+	AnomalyMetricLatency     = "latency"
+	AnomalyMetricCostPerCall = "cost_per_call"
+)
+
+// MetricsAnomalyThresholds 异常判定阈值：当前值超过基线的 Factor 倍且满足最小样本量时视为异常
+type MetricsAnomalyThresholds struct {
+	// MinCurrentCalls/MinBaselineCalls 当前窗口与基线的最小调用次数，样本不足时不做判定
+	MinCurrentCalls  int
+	MinBaselineCalls int
+	// ErrorRateFactor 错误率倍数；ErrorRateDelta 错误率需同时高出基线的绝对值，避免低基线时的误报
+	ErrorRateFactor float64
+	ErrorRateDelta  float64
+	LatencyFactor   float64
+	CostFactor      float64
+}
+
+// DefaultMetricsAnomalyThresholds 默认阈值
+func DefaultMetricsAnomalyThresholds() MetricsAnomalyThresholds {
+	return MetricsAnomalyThresholds{
+		MinCurrentCalls:  20,
+		MinBaselineCalls: 100,
+		ErrorRateFactor:  2,
+		ErrorRateDelta:   0.05,
+		LatencyFactor:    2,
+		CostFactor:       1.5,
+	}
+}
+
+// MetricsAnomaly 单个 provider/model 在当前窗口内偏离基线的指标
+type MetricsAnomaly struct {
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	Metric       string    `json:"metric"`
+	Current      float64   `json:"current"`
+	Baseline     float64   `json:"baseline"`
+	Ratio        float64   `json:"ratio"` // Current / Baseline，基线为 0 时为 0
+	CurrentCalls int       `json:"current_calls"`
+	WindowStart  time.Time `json:"window_start"`
+	DetectedAt   time.Time `json:"detected_at"`
+}
+
+// MetricsAnomalyHandler 接收异常告警事件，由宿主应用接入通知渠道
+type MetricsAnomalyHandler func(ctx context.Context, anomaly *MetricsAnomaly)
+
+// MetricsAnomalyDetector 周期性将各 provider/model 当前窗口的错误率、时延与单次成本与滚动基线对比，
+// 偏离超过阈值时发出告警事件（记入审计日志并通知已注册的处理器），同一模型同一指标在冷却期内只告警一次
+type MetricsAnomalyDetector interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	// OnAnomaly 注册告警处理器，须在 Start 前调用
+	OnAnomaly(handler MetricsAnomalyHandler)
+	// Detect 计算当前的异常，不发出告警
+	Detect(ctx context.Context) ([]*MetricsAnomaly, error)
+	// DetectOnce 立即检测一轮并发出告警，返回本轮告警的异常（不含冷却期内的重复异常）
+	DetectOnce(ctx context.Context) ([]*MetricsAnomaly, error)
+}
+
+type metricsAnomalyDetectorImpl struct {
+	metrics repo.MetricsRepo
+	safety  SafetyService
+	logger  logging.ILogger
+	super   *runtime.TaskSupervisor
+
+	interval   time.Duration
+	window     time.Duration
+	baseline   time.Duration
+	cooldown   time.Duration
+	thresholds MetricsAnomalyThresholds
+
+	mu        sync.Mutex
+	handlers  []MetricsAnomalyHandler
+	lastAlert map[string]time.Time
+
+	lifecycleMu sync.Mutex
+	started     bool
+	stopped     bool
+	cancel      context.CancelFunc
+}
+
+func NewMetricsAnomalyDetector(metrics repo.MetricsRepo, safety SafetyService, logger logging.ILogger) MetricsAnomalyDetector {
+	return &metricsAnomalyDetectorImpl{
+		metrics:    metrics,
+		safety:     safety,
+		logger:     logger,
+		super:      runtime.NewTaskSupervisor("gochen-llm.metrics_anomaly"),
+		interval:   defaultAnomalyInterval,
+		window:     defaultAnomalyWindow,
+		baseline:   defaultAnomalyBaseline,
+		cooldown:   defaultAnomalyCooldown,
+		thresholds: DefaultMetricsAnomalyThresholds(),
+		lastAlert:  map[string]time.Time{},
+	}
+}
+
+func (d *metricsAnomalyDetectorImpl) Start(ctx context.Context) error {
+	if ctx == nil {
+		return errorx.New(errorx.InvalidInput, "ctx 不能为空")
+	}
+
+	d.lifecycleMu.Lock()
+	defer d.lifecycleMu.Unlock()
+
+	if d.stopped {
+		return errorx.New(errorx.Internal, "MetricsAnomalyDetector 已停止，无法再次启动")
+	}
+	if d.started {
+		return nil
+	}
+	loopCtx, cancel := context.WithCancel(ctx)
+	d.cancel = cancel
+	d.started = true
+
+	d.super.GoLoop(loopCtx, "detect_loop", d.interval, func(ctx context.Context) error {
+		if _, err := d.DetectOnce(ctx); err != nil && d.logger != nil {
+			d.logger.Warn(ctx, "指标异常检测失败", logging.Error(err))
+		}
+		return nil
+	})
+	return nil
+}
+
+func (d *metricsAnomalyDetectorImpl) Stop(ctx context.Context) error {
+	d.lifecycleMu.Lock()
+	if !d.started || d.stopped {
+		d.lifecycleMu.Unlock()
+		return nil
+	}
+	d.stopped = true
+	cancel := d.cancel
+	d.lifecycleMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	d.super.Stop()
+	return nil
+}
+
+func (d *metricsAnomalyDetectorImpl) OnAnomaly(handler MetricsAnomalyHandler) {
+	if handler == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers = append(d.handlers, handler)
+}
+
+func (d *metricsAnomalyDetectorImpl) Detect(ctx context.Context) ([]*MetricsAnomaly, error) {
+	if d.metrics == nil {
+		return nil, errorx.New(errorx.Internal, "LLM metrics repo 未配置")
+	}
+	now := time.Now()
+	windowStart := now.Add(-d.window)
+	baselineStart := windowStart.Add(-d.baseline)
+
+	// 错误率与单次成本按全部调用计算，时延只看成功调用（失败记录的时延为 0）
+	current, err := d.byModel(ctx, windowStart, now, "")
+	if err != nil {
+		return nil, err
+	}
+	base, err := d.byModel(ctx, baselineStart, windowStart, "")
+	if err != nil {
+		return nil, err
+	}
+	currentOK, err := d.byModel(ctx, windowStart, now, "ok")
+	if err != nil {
+		return nil, err
+	}
+	baseOK, err := d.byModel(ctx, baselineStart, windowStart, "ok")
+	if err != nil {
+		return nil, err
+	}
+
+	t := d.thresholds
+	var anomalies []*MetricsAnomaly
+	for key, cur := range current {
+		b, ok := base[key]
+		if !ok {
+			continue
+		}
+		add := func(metric string, curValue, baseValue float64) {
+			a := &MetricsAnomaly{
+				Provider:     cur.Provider,
+				Model:        cur.Model,
+				Metric:       metric,
+				Current:      curValue,
+				Baseline:     baseValue,
+				CurrentCalls: cur.Metrics.SuccessCalls + cur.Metrics.ErrorCalls,
+				WindowStart:  windowStart,
+				DetectedAt:   now,
+			}
+			if baseValue > 0 {
+				a.Ratio = curValue / baseValue
+			}
+			anomalies = append(anomalies, a)
+		}
+
+		curCalls := cur.Metrics.SuccessCalls + cur.Metrics.ErrorCalls
+		baseCalls := b.Metrics.SuccessCalls + b.Metrics.ErrorCalls
+		if curCalls >= t.MinCurrentCalls && baseCalls >= t.MinBaselineCalls {
+			curRate := float64(cur.Metrics.ErrorCalls) / float64(curCalls)
+			baseRate := float64(b.Metrics.ErrorCalls) / float64(baseCalls)
+			if curRate-baseRate >= t.ErrorRateDelta && curRate >= baseRate*t.ErrorRateFactor {
+				add(AnomalyMetricErrorRate, curRate, baseRate)
+			}
+		}
+
+		curSuccess, baseSuccess := cur.Metrics.SuccessCalls, b.Metrics.SuccessCalls
+		if curSuccess >= t.MinCurrentCalls && baseSuccess >= t.MinBaselineCalls {
+			curCost := cur.Metrics.TotalCostUSD / float64(curSuccess)
+			baseCost := b.Metrics.TotalCostUSD / float64(baseSuccess)
+			if baseCost > 0 && curCost >= baseCost*t.CostFactor {
+				add(AnomalyMetricCostPerCall, curCost, baseCost)
+			}
+		}
+
+		curOK, baseOKReport := currentOK[key], baseOK[key]
+		if curOK != nil && baseOKReport != nil &&
+			curOK.Metrics.TotalCalls >= t.MinCurrentCalls && baseOKReport.Metrics.TotalCalls >= t.MinBaselineCalls &&
+			baseOKReport.Metrics.AvgLatencyMs > 0 && curOK.Metrics.AvgLatencyMs >= baseOKReport.Metrics.AvgLatencyMs*t.LatencyFactor {
+			add(AnomalyMetricLatency, curOK.Metrics.AvgLatencyMs, baseOKReport.Metrics.AvgLatencyMs)
+		}
+	}
+	return anomalies, nil
+}
+
+func (d *metricsAnomalyDetectorImpl) DetectOnce(ctx context.Context) ([]*MetricsAnomaly, error) {
+	anomalies, err := d.Detect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	var fresh []*MetricsAnomaly
+	for _, a := range anomalies {
+		key := a.Provider + "/" + a.Model + "/" + a.Metric
+		if last, ok := d.lastAlert[key]; ok && a.DetectedAt.Sub(last) < d.cooldown {
+			continue
+		}
+		d.lastAlert[key] = a.DetectedAt
+		fresh = append(fresh, a)
+	}
+	for key, last := range d.lastAlert {
+		if time.Since(last) > d.cooldown {
+			delete(d.lastAlert, key)
+		}
+	}
+	handlers := append([]MetricsAnomalyHandler(nil), d.handlers...)
+	d.mu.Unlock()
+
+	for _, a := range fresh {
+		d.emit(ctx, a, handlers)
+	}
+	return fresh, nil
+}
+
+// emit 记录日志与审计并通知处理器
+func (d *metricsAnomalyDetectorImpl) emit(ctx context.Context, a *MetricsAnomaly, handlers []MetricsAnomalyHandler) {
+	if d.logger != nil {
+		d.logger.Warn(ctx, "LLM 指标异常",
+			logging.String("provider", a.Provider),
+			logging.String("model", a.Model),
+			logging.String("metric", a.Metric),
+			logging.String("current", fmt.Sprintf("%.4f", a.Current)),
+			logging.String("baseline", fmt.Sprintf("%.4f", a.Baseline)),
+		)
+	}
+	if d.safety != nil {
+		detail, _ := json.Marshal(a)
+		_ = d.safety.RecordAuditLog(ctx, &entity.AuditLog{
+			Action:       "llm.metrics_anomaly",
+			ResourceType: "model",
+			RequestJSON:  string(detail),
+			Status:       "alert",
+		})
+	}
+	for _, h := range handlers {
+		h(ctx, a)
+	}
+}
+
+// byModel 按 provider/model 汇总 start 至 end 之间的指标
+func (d *metricsAnomalyDetectorImpl) byModel(ctx context.Context, start, end time.Time, status string) (map[string]*entity.ModelMetricsReport, error) {
+	rows, err := d.metrics.AggregateByModel(ctx, entity.MetricsFilter{StartAt: &start, EndAt: &end, Status: status})
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]*entity.ModelMetricsReport, len(rows))
+	for _, r := range rows {
+		out[r.Provider+"/"+r.Model] = r
+	}
+	return out, nil
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+)
+
+// modelPricingCacheTTL 价格表的缓存时间，管理端修改后立即失效
+const modelPricingCacheTTL = time.Minute
+
+// ModelPricingService 管理模型价格表，并按调用时间解析生效的单价
+type ModelPricingService interface {
+	ListPricing(ctx context.Context, provider string) ([]*entity.ModelPricing, error)
+	// SavePricing 新增或修改价格记录，EffectiveFrom 为空时取当前时间
+	SavePricing(ctx context.Context, p *entity.ModelPricing) error
+	DeletePricing(ctx context.Context, id int64) error
+	// ResolvePricing 返回 provider/model 在 at 时刻生效的单价，未配置时返回 nil；
+	// 多条匹配时优先模式更具体（非通配部分更长）的记录，其次生效时间更晚的记录
+	ResolvePricing(ctx context.Context, provider, model string, at time.Time) (*entity.ModelPricing, error)
+}
+
+type modelPricingServiceImpl struct {
+	repo   repo.ModelPricingRepo
+	safety SafetyService
+
+	mu       sync.RWMutex
+	cache    []*entity.ModelPricing
+	loadedAt time.Time
+}
+
+func NewModelPricingService(repo repo.ModelPricingRepo, safety SafetyService) ModelPricingService {
+	return &modelPricingServiceImpl{repo: repo, safety: safety}
+}
+
+// ValidateModelPricing 校验价格记录
+func ValidateModelPricing(p *entity.ModelPricing) error {
+	if p == nil {
+		return errorx.New(errorx.Validation, "模型价格不能为空")
+	}
+	p.Provider = strings.TrimSpace(p.Provider)
+	p.ModelPattern = strings.TrimSpace(p.ModelPattern)
+	if p.Provider == "" || p.ModelPattern == "" {
+		return errorx.New(errorx.Validation, "provider 与 model_pattern 不能为空")
+	}
+	if _, err := path.Match(p.ModelPattern, ""); err != nil {
+		return errorx.New(errorx.Validation, "model_pattern 格式无效: "+p.ModelPattern)
+	}
+	for _, v := range []float64{p.InputPer1k, p.OutputPer1k, p.CachedInputPer1k, p.LongContextInputPer1k, p.LongContextOutputPer1k, p.LongContextCachedInputPer1k} {
+		if v < 0 {
+			return errorx.New(errorx.Validation, "单价不能为负数")
+		}
+		if v > 100 {
+			return errorx.New(errorx.Validation, "单价超出合理范围，请检查输入")
+		}
+	}
+	if p.PerRequestUSD < 0 || p.PerRequestUSD > 10 {
+		return errorx.New(errorx.Validation, "per_request_usd 须在 0 到 10 之间")
+	}
+	if p.LongContextThreshold < 0 {
+		return errorx.New(errorx.Validation, "long_context_threshold 不能为负数")
+	}
+	if p.LongContextThreshold == 0 && (p.LongContextInputPer1k > 0 || p.LongContextOutputPer1k > 0 || p.LongContextCachedInputPer1k > 0) {
+		return errorx.New(errorx.Validation, "配置长上下文单价时须设置 long_context_threshold")
+	}
+	return nil
+}
+
+// ModelPricingCost 按计费规则计算单次调用的成本：cachedTokens 为 requestTokens 中命中提示缓存的部分，
+// 输入 token 超过长上下文阈值时输入、输出与缓存输入均按长上下文单价计，另加每次调用的固定费用
+func ModelPricingCost(p *entity.ModelPricing, requestTokens, cachedTokens, responseTokens int) float64 {
+	if p == nil {
+		return 0
+	}
+	requestTokens = max(requestTokens, 0)
+	responseTokens = max(responseTokens, 0)
+	cachedTokens = min(max(cachedTokens, 0), requestTokens)
+
+	in, out, cached := p.InputPer1k, p.OutputPer1k, p.CachedInputPer1k
+	if p.LongContextThreshold > 0 && requestTokens > p.LongContextThreshold {
+		if p.LongContextInputPer1k > 0 {
+			in = p.LongContextInputPer1k
+		}
+		if p.LongContextOutputPer1k > 0 {
+			out = p.LongContextOutputPer1k
+		}
+		cached = p.LongContextCachedInputPer1k
+	}
+	if cached == 0 {
+		cached = in
+	}
+	return in*float64(requestTokens-cachedTokens)/1000 +
+		cached*float64(cachedTokens)/1000 +
+		out*float64(responseTokens)/1000 +
+		p.PerRequestUSD
+}
+
+func (s *modelPricingServiceImpl) ListPricing(ctx context.Context, provider string) ([]*entity.ModelPricing, error) {
+	if s.repo == nil {
+		return nil, errorx.New(errorx.Internal, "模型价格 repo 未配置")
+	}
+	return s.repo.List(ctx, provider)
+}
+
+func (s *modelPricingServiceImpl) SavePricing(ctx context.Context, p *entity.ModelPricing) error {
+	if err := ValidateModelPricing(p); err != nil {
+		return err
+	}
+	if s.repo == nil {
+		return errorx.New(errorx.Internal, "模型价格 repo 未配置")
+	}
+	if p.EffectiveFrom.IsZero() {
+		p.EffectiveFrom = time.Now()
+	}
+	var before any
+	if p.ID > 0 {
+		prev, err := s.repo.Get(ctx, p.ID)
+		if err != nil {
+			return err
+		}
+		if prev == nil {
+			return errorx.New(errorx.NotFound, "模型价格不存在")
+		}
+		p.CreatedAt = prev.CreatedAt
+		before = prev
+	}
+	if err := s.repo.Save(ctx, p); err != nil {
+		return err
+	}
+	s.invalidate()
+	if s.safety != nil {
+		s.safety.RecordAdminChange(ctx, "admin.save_model_pricing", "model_pricing", p.ID, before, p)
+	}
+	return nil
+}
+
+func (s *modelPricingServiceImpl) DeletePricing(ctx context.Context, id int64) error {
+	if s.repo == nil {
+		return errorx.New(errorx.Internal, "模型价格 repo 未配置")
+	}
+	prev, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if prev == nil {
+		return errorx.New(errorx.NotFound, "模型价格不存在")
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	s.invalidate()
+	if s.safety != nil {
+		s.safety.RecordAdminChange(ctx, "admin.delete_model_pricing", "model_pricing", id, prev, nil)
+	}
+	return nil
+}
+
+func (s *modelPricingServiceImpl) ResolvePricing(ctx context.Context, provider, model string, at time.Time) (*entity.ModelPricing, error) {
+	list, err := s.pricing(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var best *entity.ModelPricing
+	bestSpecificity := -1
+	for _, p := range list {
+		if p.Provider != provider || p.EffectiveFrom.After(at) {
+			continue
+		}
+		if ok, _ := path.Match(p.ModelPattern, model); !ok {
+			continue
+		}
+		specificity := len(strings.ReplaceAll(p.ModelPattern, "*", ""))
+		if specificity > bestSpecificity || (specificity == bestSpecificity && p.EffectiveFrom.After(best.EffectiveFrom)) {
+			best, bestSpecificity = p, specificity
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	cp := *best
+	return &cp, nil
+}
+
+// pricing 读取全部价格记录，结果缓存 modelPricingCacheTTL
+func (s *modelPricingServiceImpl) pricing(ctx context.Context) ([]*entity.ModelPricing, error) {
+	s.mu.RLock()
+	if s.cache != nil && time.Since(s.loadedAt) < modelPricingCacheTTL {
+		list := s.cache
+		s.mu.RUnlock()
+		return list, nil
+	}
+	s.mu.RUnlock()
+	if s.repo == nil {
+		return nil, nil
+	}
+	list, err := s.repo.List(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		list = []*entity.ModelPricing{}
+	}
+	s.mu.Lock()
+	s.cache, s.loadedAt = list, time.Now()
+	s.mu.Unlock()
+	return list, nil
+}
+
+func (s *modelPricingServiceImpl) invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+}
@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+// PIIHit 单个检测器的命中情况（不含原文，便于写入审计日志）
+type PIIHit struct {
+	Detector string `json:"detector"`
+	Action   string `json:"action"`
+	Count    int    `json:"count"`
+}
+
+// PIIScanResult PII 扫描结果
+type PIIScanResult struct {
+	Content string   `json:"content"` // 按 mask/block 检测器掩码后的内容
+	Blocked bool     `json:"blocked"` // 存在 block 动作的命中
+	Hits    []PIIHit `json:"hits,omitempty"`
+}
+
+type builtinPIIDetector struct {
+	pattern string
+	locales []string
+	// validate 对正则命中做二次校验（如校验位），返回 false 时忽略该命中
+	validate func(match string) bool
+}
+
+// builtinPIIDetectors 内置检测器；Go 正则不支持环视，边界用 \b 近似
+var builtinPIIDetectors = map[string]builtinPIIDetector{
+	"email": {pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+	"cn_mobile": {
+		pattern: `(?:\+86[- ]?|\b)1[3-9]\d[- ]?\d{4}[- ]?\d{4}\b`,
+		locales: []string{"zh-CN"},
+	},
+	"cn_landline": {
+		pattern: `\b0\d{2,3}-\d{7,8}\b`,
+		locales: []string{"zh-CN"},
+	},
+	"cn_id_card": {
+		pattern:  `\b[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`,
+		locales:  []string{"zh-CN"},
+		validate: validCNIDCard,
+	},
+	"cn_address": {
+		pattern: `\p{Han}{2,8}(?:省|自治区|市)\p{Han}{0,12}?(?:市|区|县|旗)[\p{Han}\d]{0,20}?(?:路|街|道|巷|弄|村)[\d一二三四五六七八九十百-]+号`,
+		locales: []string{"zh-CN"},
+	},
+	"us_phone": {
+		pattern: `(?:\+1[- .]?)?\(?\b\d{3}\)?[- .]\d{3}[- .]\d{4}\b`,
+		locales: []string{"en-US"},
+	},
+	"us_ssn": {
+		pattern: `\b\d{3}-\d{2}-\d{4}\b`,
+		locales: []string{"en-US"},
+	},
+	"credit_card": {
+		pattern:  `\b\d(?:[ -]?\d){12,18}\b`,
+		validate: validLuhn,
+	},
+}
+
+type compiledPIIDetector struct {
+	name     string
+	re       *regexp.Regexp
+	action   string
+	mask     string
+	strategy string
+	keepLast int
+	validate func(string) bool
+}
+
+// piiDetectorCache 按配置 JSON 缓存编译结果，策略变更后自动重新编译
+type piiDetectorCache struct {
+	mu        sync.Mutex
+	key       string
+	detectors []*compiledPIIDetector
+}
+
+var defaultPIIDetectors = mustCompilePIIDetectors(&entity.PIIConfig{})
+
+func mustCompilePIIDetectors(cfg *entity.PIIConfig) []*compiledPIIDetector {
+	detectors, err := compilePIIDetectors(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return detectors
+}
+
+func (c *piiDetectorCache) get(raw string) ([]*compiledPIIDetector, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return defaultPIIDetectors, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.detectors != nil && c.key == raw {
+		return c.detectors, nil
+	}
+	cfg, err := parsePIIConfig(raw)
+	if err != nil {
+		return nil, err
+	}
+	detectors, err := compilePIIDetectors(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.key, c.detectors = raw, detectors
+	return detectors, nil
+}
+
+func parsePIIConfig(raw string) (*entity.PIIConfig, error) {
+	var cfg entity.PIIConfig
+	if err := json.Unmarshal([]byte(raw), &cfg); err != nil {
+		return nil, errorx.Wrap(err, errorx.Validation, "PII 配置需为 JSON 对象")
+	}
+	return &cfg, nil
+}
+
+// ValidatePIIConfig 校验 PII 配置（检测器名称、动作与自定义正则）
+func ValidatePIIConfig(raw string) error {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	cfg, err := parsePIIConfig(raw)
+	if err != nil {
+		return err
+	}
+	_, err = compilePIIDetectors(cfg)
+	return err
+}
+
+// compilePIIDetectors 合并内置与配置的检测器，并按启用的语言区域过滤；结果按名称排序保证掩码顺序稳定
+func compilePIIDetectors(cfg *entity.PIIConfig) ([]*compiledPIIDetector, error) {
+	configured := map[string]entity.PIIDetector{}
+	for _, d := range cfg.Detectors {
+		name := strings.TrimSpace(d.Name)
+		if name == "" {
+			return nil, errorx.New(errorx.Validation, "PII 检测器 name 不能为空")
+		}
+		if _, dup := configured[name]; dup {
+			return nil, errorx.New(errorx.Validation, "PII 检测器重复: "+name)
+		}
+		switch d.Action {
+		case "", entity.PIIActionBlock, entity.PIIActionMask, entity.PIIActionLog:
+		default:
+			return nil, errorx.New(errorx.Validation, "PII 检测器动作仅支持 block/mask/log: "+name)
+		}
+		switch d.Strategy {
+		case "", entity.PIIMaskReplace, entity.PIIMaskPartial, entity.PIIMaskFormatPreserving, entity.PIIMaskTokenize:
+		default:
+			return nil, errorx.New(errorx.Validation, "PII 掩码策略仅支持 replace/partial/format_preserving/tokenize: "+name)
+		}
+		if d.KeepLast < 0 {
+			return nil, errorx.New(errorx.Validation, "PII 检测器 keep_last 不能为负数: "+name)
+		}
+		if _, builtin := builtinPIIDetectors[name]; !builtin && strings.TrimSpace(d.Pattern) == "" {
+			return nil, errorx.New(errorx.Validation, "自定义 PII 检测器需提供 pattern: "+name)
+		}
+		d.Name = name
+		configured[name] = d
+	}
+	if !cfg.BuiltinsDisabled {
+		for name, b := range builtinPIIDetectors {
+			if _, ok := configured[name]; !ok {
+				configured[name] = entity.PIIDetector{Name: name, Locales: b.locales}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(configured))
+	for name := range configured {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	detectors := make([]*compiledPIIDetector, 0, len(names))
+	for _, name := range names {
+		d := configured[name]
+		builtin, isBuiltin := builtinPIIDetectors[name]
+		if d.Disabled {
+			continue
+		}
+		locales := d.Locales
+		if len(locales) == 0 && isBuiltin && d.Pattern == "" {
+			locales = builtin.locales
+		}
+		if !piiLocalesEnabled(cfg.Locales, locales) {
+			continue
+		}
+		cd := &compiledPIIDetector{name: name, action: d.Action, mask: d.Mask, strategy: d.Strategy, keepLast: d.KeepLast}
+		pattern := d.Pattern
+		if pattern == "" {
+			pattern, cd.validate = builtin.pattern, builtin.validate
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errorx.Wrap(err, errorx.Validation, "PII 检测器正则无效: "+name)
+		}
+		cd.re = re
+		if cd.action == "" {
+			cd.action = entity.PIIActionMask
+		}
+		if cd.mask == "" {
+			cd.mask = "[PII:" + name + "]"
+		}
+		if cd.keepLast == 0 {
+			cd.keepLast = defaultPIIKeepLast
+		}
+		detectors = append(detectors, cd)
+	}
+	return detectors, nil
+}
+
+// piiLocalesEnabled enabled 为空表示全部启用；检测器未限定语言区域时总是启用；zh 与 zh-CN 视为匹配
+func piiLocalesEnabled(enabled, detector []string) bool {
+	if len(enabled) == 0 || len(detector) == 0 {
+		return true
+	}
+	for _, a := range enabled {
+		for _, b := range detector {
+			if piiLocaleMatches(a, b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func piiLocaleMatches(a, b string) bool {
+	a, b = normalizeLocale(a), normalizeLocale(b)
+	if a == "" || b == "" {
+		return false
+	}
+	if a == b {
+		return true
+	}
+	langA, regionA, _ := strings.Cut(a, "-")
+	langB, regionB, _ := strings.Cut(b, "-")
+	return langA == langB && (regionA == "" || regionB == "")
+}
+
+// scanPII 依次执行检测器；maskAll 为 true 时 log 动作的命中也会被掩码。
+// 不使用令牌库，tokenize 策略退化为 replace
+func scanPII(detectors []*compiledPIIDetector, content string, maskAll bool) *PIIScanResult {
+	return scanPIIWithVault(context.Background(), detectors, content, maskAll, nil)
+}
+
+// scanPIIWithVault 同 scanPII，tokenize 策略的命中原文写入 vault
+func scanPIIWithVault(ctx context.Context, detectors []*compiledPIIDetector, content string, maskAll bool, vault PIIVault) *PIIScanResult {
+	result := &PIIScanResult{Content: content}
+	for _, d := range detectors {
+		count := 0
+		masked := d.re.ReplaceAllStringFunc(result.Content, func(match string) string {
+			if d.validate != nil && !d.validate(match) {
+				return match
+			}
+			count++
+			if d.action == entity.PIIActionLog && !maskAll {
+				return match
+			}
+			return d.maskMatch(ctx, match, vault)
+		})
+		if count == 0 {
+			continue
+		}
+		result.Content = masked
+		result.Hits = append(result.Hits, PIIHit{Detector: d.name, Action: d.action, Count: count})
+		if d.action == entity.PIIActionBlock {
+			result.Blocked = true
+		}
+	}
+	return result
+}
+
+// validCNIDCard 校验 18 位身份证号的校验位（GB 11643）
+func validCNIDCard(id string) bool {
+	if len(id) != 18 {
+		return false
+	}
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	const checks = "10X98765432"
+	sum := 0
+	for i := 0; i < 17; i++ {
+		sum += int(id[i]-'0') * weights[i]
+	}
+	return checks[sum%11] == strings.ToUpper(id[17:])[0]
+}
+
+// validLuhn 银行卡号 Luhn 校验
+func validLuhn(number string) bool {
+	sum, n := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"math/big"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"gochen-llm/entity"
+)
+
+// defaultPIIKeepLast partial 策略默认保留的末尾字符数
+const defaultPIIKeepLast = 4
+
+// PIIVault 可逆令牌化的令牌库，repo.PIIVaultRepo 即为基于数据库的实现
+type PIIVault interface {
+	// Put 保存令牌与原文，userID 为原文所属用户（未知时为 0）
+	Put(ctx context.Context, userID int64, token, detector, value string) error
+	// Get 返回令牌对应的原文，不存在时返回空字符串
+	Get(ctx context.Context, token string) (string, error)
+}
+
+// piiTokenPattern 匹配 tokenize 策略生成的占位符，第 1 组为令牌
+var piiTokenPattern = regexp.MustCompile(`\[PII:[^:\]]+:(tk_[0-9a-f]{24})\]`)
+
+// piiVaultHolder 可在运行时替换的令牌库
+type piiVaultHolder struct {
+	mu    sync.RWMutex
+	vault PIIVault
+}
+
+func (h *piiVaultHolder) get() PIIVault {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.vault
+}
+
+func (h *piiVaultHolder) set(vault PIIVault) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.vault = vault
+}
+
+// maskMatch 按检测器的掩码策略处理单个命中；tokenize 在未配置令牌库或写入失败时退化为 replace，保证原文不外泄。
+// 令牌记录归属 WithSafetyUser 声明的用户，删除用户数据时一并清理
+func (d *compiledPIIDetector) maskMatch(ctx context.Context, match string, vault PIIVault) string {
+	switch d.strategy {
+	case entity.PIIMaskPartial:
+		return partialMaskPII(match, d.keepLast)
+	case entity.PIIMaskFormatPreserving:
+		return formatPreservingPII(match)
+	case entity.PIIMaskTokenize:
+		if vault != nil {
+			token := newPIIToken()
+			if err := vault.Put(ctx, safetyScopeFrom(ctx).userID, token, d.name, match); err == nil {
+				return "[PII:" + d.name + ":" + token + "]"
+			}
+		}
+	}
+	return d.mask
+}
+
+// partialMaskPII 保留末尾 keep 个字母数字，其余字母数字替换为 *，分隔符原样保留，如 138-1234-5678 → ***-****-5678
+func partialMaskPII(match string, keep int) string {
+	runes := []rune(match)
+	kept := 0
+	for i := len(runes) - 1; i >= 0; i-- {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			continue
+		}
+		if kept < keep {
+			kept++
+			continue
+		}
+		runes[i] = '*'
+	}
+	return string(runes)
+}
+
+// formatPreservingPII 将数字替换为随机数字、字母替换为同大小写的随机字母，保留长度与分隔符
+func formatPreservingPII(match string) string {
+	var b strings.Builder
+	for _, r := range match {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune('0' + randomRuneOffset(10))
+		case r >= 'a' && r <= 'z':
+			b.WriteRune('a' + randomRuneOffset(26))
+		case r >= 'A' && r <= 'Z':
+			b.WriteRune('A' + randomRuneOffset(26))
+		case unicode.IsLetter(r):
+			b.WriteRune('*')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func randomRuneOffset(n int64) rune {
+	v, err := rand.Int(rand.Reader, big.NewInt(n))
+	if err != nil {
+		return 0
+	}
+	return rune(v.Int64())
+}
+
+func newPIIToken() string {
+	buf := make([]byte, 12)
+	_, _ = rand.Read(buf)
+	return "tk_" + hex.EncodeToString(buf)
+}
+
+func (s *safetyServiceImpl) SetPIIVault(vault PIIVault) {
+	s.vault.set(vault)
+}
+
+// DetokenizePII 将文本中 tokenize 策略生成的占位符还原为原文；令牌不存在时保留占位符
+func (s *safetyServiceImpl) DetokenizePII(ctx context.Context, text string) (string, error) {
+	vault := s.vault.get()
+	if vault == nil || !strings.Contains(text, "[PII:") {
+		return text, nil
+	}
+	var firstErr error
+	restored := piiTokenPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		token := piiTokenPattern.FindStringSubmatch(placeholder)[1]
+		value, err := vault.Get(ctx, token)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return placeholder
+		}
+		if value == "" {
+			return placeholder
+		}
+		return value
+	})
+	return restored, firstErr
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"gochen-llm/repo"
+	"gochen/errorx"
+)
+
+// PlaygroundRequest 提示词调试请求：渲染指定模板版本，可选地在指定端点上执行
+type PlaygroundRequest struct {
+	UserID      int64                  `json:"-"`                  // 操作人（管理员）
+	TemplateID  int64                  `json:"template_id"`        // 模板 ID
+	Version     int                    `json:"version,omitempty"`  // 历史版本号，为空使用当前内容
+	Content     string                 `json:"content,omitempty"`  // 临时内容，非空时覆盖模板内容（不落库）
+	Variables   map[string]interface{} `json:"variables"`          // 渲染变量
+	Execute     bool                   `json:"execute"`            // 是否调用模型
+	Endpoint    string                 `json:"endpoint,omitempty"` // 指定端点名称，为空按常规路由
+	Messages    []Message              `json:"messages"`
+	Temperature float32                `json:"temperature"`
+	MaxTokens   int                    `json:"max_tokens"`
+}
+
+// PlaygroundResult 调试结果
+type PlaygroundResult struct {
+	Rendered        string        `json:"rendered"`
+	EstimatedTokens int           `json:"estimated_tokens"`
+	Version         int           `json:"version"`
+	Response        *ChatResponse `json:"response,omitempty"`
+}
+
+// RunPlayground 以预览模式渲染模板（可引用未发布模板），执行时的调用记为测试流量，不计入常规统计
+func (s *chatServiceImpl) RunPlayground(ctx context.Context, req *PlaygroundRequest) (*PlaygroundResult, error) {
+	if req == nil || req.TemplateID <= 0 {
+		return nil, errorx.New(errorx.InvalidInput, "template_id 无效")
+	}
+	if s.prompt == nil {
+		return nil, errorx.New(errorx.Internal, "LLM PromptService 未配置")
+	}
+	ctx = repo.WithPromptPreview(ctx)
+
+	tmpl, err := s.prompt.GetPromptByID(ctx, req.TemplateID)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl == nil {
+		return nil, errorx.New(errorx.NotFound, "提示词模板不存在")
+	}
+	// 使用副本渲染，避免历史版本/临时内容写入编译缓存
+	draft := *tmpl
+	draft.ID = 0
+	if req.Version > 0 && req.Version != tmpl.Version {
+		v, err := s.prompt.GetPromptVersion(ctx, tmpl.ID, req.Version)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			return nil, errorx.New(errorx.NotFound, "指定版本不存在")
+		}
+		draft.Content = v.Content
+		draft.VariablesJSON = v.VariablesJSON
+		draft.Version = v.Version
+	}
+	if strings.TrimSpace(req.Content) != "" {
+		draft.Content = req.Content
+	}
+
+	rendered, err := s.prompt.RenderPrompt(ctx, &draft, req.Variables)
+	if err != nil {
+		return nil, err
+	}
+	result := &PlaygroundResult{
+		Rendered:        rendered,
+		EstimatedTokens: (len([]rune(rendered)) + 3) / 4,
+		Version:         draft.Version,
+	}
+	if !req.Execute {
+		return result, nil
+	}
+	if len(req.Messages) == 0 {
+		return nil, errorx.New(errorx.Validation, "执行调试需要提供 messages")
+	}
+
+	if req.Endpoint != "" {
+		ctx = WithPinnedEndpoint(ctx, req.Endpoint)
+	}
+	resp, err := s.Chat(ctx, &ChatRequest{
+		UserID:      req.UserID,
+		System:      rendered,
+		Messages:    req.Messages,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+		Metadata: map[string]interface{}{
+			"test_traffic":       true,
+			"playground":         true,
+			"prompt_template_id": tmpl.ID,
+		},
+		NoDedup: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result.Response = resp
+	return result, nil
+}
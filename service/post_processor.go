@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gochen-llm/entity"
+)
+
+// PostProcessor 对模型输出（ChatResponse.Content）做后处理
+type PostProcessor interface {
+	Name() string
+	Process(ctx context.Context, content string) (string, error)
+}
+
+// 内置后处理器名称，可写入 SafetyPolicy.PostProcessorsJSON 启用
+const (
+	PostProcessorTrimCodeFence       = "trim_code_fence"
+	PostProcessorStripDisclaimer     = "strip_disclaimer"
+	PostProcessorNormalizeWhitespace = "normalize_whitespace"
+)
+
+var (
+	postProcessorMu       sync.RWMutex
+	postProcessorRegistry = map[string]PostProcessor{
+		PostProcessorTrimCodeFence:       trimCodeFenceProcessor{},
+		PostProcessorStripDisclaimer:     stripDisclaimerProcessor{},
+		PostProcessorNormalizeWhitespace: normalizeWhitespaceProcessor{},
+	}
+)
+
+// RegisterPostProcessor 注册自定义后处理器，同名覆盖内置实现
+func RegisterPostProcessor(p PostProcessor) {
+	if p == nil || p.Name() == "" {
+		return
+	}
+	postProcessorMu.Lock()
+	defer postProcessorMu.Unlock()
+	postProcessorRegistry[p.Name()] = p
+}
+
+func lookupPostProcessor(name string) (PostProcessor, bool) {
+	postProcessorMu.RLock()
+	defer postProcessorMu.RUnlock()
+	p, ok := postProcessorRegistry[name]
+	return p, ok
+}
+
+// PostProcessPipeline 按顺序执行一组后处理器
+type PostProcessPipeline struct {
+	processors []PostProcessor
+}
+
+func NewPostProcessPipeline(processors ...PostProcessor) *PostProcessPipeline {
+	list := make([]PostProcessor, 0, len(processors))
+	for _, p := range processors {
+		if p != nil {
+			list = append(list, p)
+		}
+	}
+	return &PostProcessPipeline{processors: list}
+}
+
+// Run 依次执行后处理器，任一处理器出错即中断并返回已处理的内容
+func (p *PostProcessPipeline) Run(ctx context.Context, content string) (string, error) {
+	if p == nil {
+		return content, nil
+	}
+	for _, proc := range p.processors {
+		out, err := proc.Process(ctx, content)
+		if err != nil {
+			return content, err
+		}
+		content = out
+	}
+	return content, nil
+}
+
+// buildPostProcessPipeline 根据安全策略构建后处理流水线
+// PostProcessorsJSON 决定启用的处理器及顺序；MaxContentLength 由 ChatService 单独强制执行并记录审计。
+func buildPostProcessPipeline(policy *entity.SafetyPolicy) *PostProcessPipeline {
+	if policy == nil || !policy.Enabled {
+		return nil
+	}
+
+	var names []string
+	if strings.TrimSpace(policy.PostProcessorsJSON) != "" {
+		_ = json.Unmarshal([]byte(policy.PostProcessorsJSON), &names)
+	}
+
+	processors := make([]PostProcessor, 0, len(names))
+	for _, name := range names {
+		if p, ok := lookupPostProcessor(strings.TrimSpace(name)); ok {
+			processors = append(processors, p)
+		}
+	}
+	if len(processors) == 0 {
+		return nil
+	}
+	return NewPostProcessPipeline(processors...)
+}
+
+// trimCodeFenceProcessor 去掉包裹整段输出的 markdown 代码块围栏（如 ```json ... ```）
+type trimCodeFenceProcessor struct{}
+
+var codeFenceRegex = regexp.MustCompile("(?s)^```[A-Za-z0-9_+-]*[ \t]*\r?\n(.*?)\r?\n?```$")
+
+func (trimCodeFenceProcessor) Name() string { return PostProcessorTrimCodeFence }
+
+func (trimCodeFenceProcessor) Process(ctx context.Context, content string) (string, error) {
+	trimmed := strings.TrimSpace(content)
+	if m := codeFenceRegex.FindStringSubmatch(trimmed); m != nil {
+		return m[1], nil
+	}
+	return content, nil
+}
+
+// stripDisclaimerProcessor 去掉常见的模型免责声明开头/结尾
+type stripDisclaimerProcessor struct{}
+
+var disclaimerRegexes = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)^\s*(as an ai( language model)?|i'm just an ai|i am an ai)[^\n.。]*[.。,，]\s*`),
+	regexp.MustCompile(`^\s*(作为一个?(AI|人工智能)(语言模型|助手)?)[^\n。]*[。，,]\s*`),
+	regexp.MustCompile(`(?i)\s*(please note|disclaimer|免责声明|请注意)[:：][^\n]*$`),
+}
+
+func (stripDisclaimerProcessor) Name() string { return PostProcessorStripDisclaimer }
+
+func (stripDisclaimerProcessor) Process(ctx context.Context, content string) (string, error) {
+	for _, re := range disclaimerRegexes {
+		content = re.ReplaceAllString(content, "")
+	}
+	return content, nil
+}
+
+// normalizeWhitespaceProcessor 统一换行、去掉行尾空白并压缩多余空行
+type normalizeWhitespaceProcessor struct{}
+
+var multiBlankLineRegex = regexp.MustCompile(`\n{3,}`)
+
+func (normalizeWhitespaceProcessor) Name() string { return PostProcessorNormalizeWhitespace }
+
+func (normalizeWhitespaceProcessor) Process(ctx context.Context, content string) (string, error) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	content = strings.Join(lines, "\n")
+	content = multiBlankLineRegex.ReplaceAllString(content, "\n\n")
+	return strings.TrimSpace(content), nil
+}
+
+// truncateRunes 按字符数截断文本，返回截断后的文本以及是否发生截断（limit <= 0 表示不限制）
+func truncateRunes(content string, limit int) (string, bool) {
+	if limit <= 0 {
+		return content, false
+	}
+	runes := []rune(content)
+	if len(runes) <= limit {
+		return content, false
+	}
+	return string(runes[:limit]), true
+}
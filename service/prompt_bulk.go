@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+)
+
+// maxPromptBulkItems 单次批量操作的模板数上限
+const maxPromptBulkItems = 500
+
+// 批量操作结果动作
+const (
+	PromptBulkUpdated = "updated"
+	PromptBulkCreated = "created"
+	PromptBulkSkipped = "skipped"
+	PromptBulkFailed  = "failed"
+)
+
+// PromptBulkItem 单个模板的批量操作结果
+type PromptBulkItem struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Action  string `json:"action"`
+	Message string `json:"message,omitempty"`
+	NewID   int64  `json:"new_id,omitempty"` // 复制生成/覆盖的目标模板 ID
+}
+
+// PromptBulkResult 批量操作汇总
+type PromptBulkResult struct {
+	Succeeded int               `json:"succeeded"`
+	Skipped   int               `json:"skipped"`
+	Failed    int               `json:"failed"`
+	Items     []*PromptBulkItem `json:"items"`
+}
+
+func (r *PromptBulkResult) add(item *PromptBulkItem) {
+	switch item.Action {
+	case PromptBulkFailed:
+		r.Failed++
+	case PromptBulkSkipped:
+		r.Skipped++
+	default:
+		r.Succeeded++
+	}
+	r.Items = append(r.Items, item)
+}
+
+// PromptScopeCopyRequest 将一组模板复制到目标作用域（如为新租户初始化全局模板）
+type PromptScopeCopyRequest struct {
+	IDs           []int64            `json:"ids"`             // 指定模板；为空时按 Source 过滤
+	SourceScope   entity.PromptScope `json:"source_scope"`    // 未指定 IDs 时的来源作用域，默认 global
+	SourceScopeID int64              `json:"source_scope_id"` // 来源作用域 ID
+	Category      string             `json:"category"`        // 来源过滤：分类
+	Tags          []string           `json:"tags"`            // 来源过滤：需全部包含的标签
+	TargetScope   entity.PromptScope `json:"target_scope"`
+	TargetScopeID int64              `json:"target_scope_id"`
+	Overwrite     bool               `json:"overwrite"` // 目标已存在同名模板时覆盖（生成新版本），否则跳过
+	Status        string             `json:"status"`    // 新模板状态，默认 published；可设为 draft 以便审核后发布
+}
+
+func checkBulkIDs(ids []int64) error {
+	if len(ids) == 0 {
+		return errorx.New(errorx.InvalidInput, "ids 不能为空")
+	}
+	if len(ids) > maxPromptBulkItems {
+		return errorx.New(errorx.Validation, fmt.Sprintf("单次最多操作 %d 个模板", maxPromptBulkItems))
+	}
+	return nil
+}
+
+// BulkSetEnabled 批量启用/停用模板
+func (s *promptServiceImpl) BulkSetEnabled(ctx context.Context, ids []int64, enabled bool) (*PromptBulkResult, error) {
+	if err := checkBulkIDs(ids); err != nil {
+		return nil, err
+	}
+	result := &PromptBulkResult{}
+	var found []*entity.PromptTemplate
+	for _, id := range ids {
+		tmpl, err := s.repo.GetByID(ctx, id)
+		switch {
+		case err != nil:
+			result.add(&PromptBulkItem{ID: id, Action: PromptBulkFailed, Message: err.Error()})
+		case tmpl == nil:
+			result.add(&PromptBulkItem{ID: id, Action: PromptBulkFailed, Message: "提示词模板不存在"})
+		case tmpl.Enabled == enabled:
+			result.add(&PromptBulkItem{ID: id, Name: tmpl.Name, Action: PromptBulkSkipped})
+		default:
+			found = append(found, tmpl)
+		}
+	}
+	if len(found) == 0 {
+		return result, nil
+	}
+	foundIDs := make([]int64, len(found))
+	for i, tmpl := range found {
+		foundIDs[i] = tmpl.ID
+	}
+	if err := s.repo.SetEnabled(ctx, foundIDs, enabled); err != nil {
+		return nil, err
+	}
+	for _, tmpl := range found {
+		s.cache.invalidate(tmpl)
+		recordAdminChange(ctx, s.safety, "admin.set_prompt_enabled", "prompt_template", tmpl.ID,
+			map[string]bool{"Enabled": tmpl.Enabled}, map[string]bool{"Enabled": enabled})
+		result.add(&PromptBulkItem{ID: tmpl.ID, Name: tmpl.Name, Action: PromptBulkUpdated})
+	}
+	return result, nil
+}
+
+// BulkUpdateTags 批量添加/移除标签，标签变化不生成新版本
+func (s *promptServiceImpl) BulkUpdateTags(ctx context.Context, ids []int64, add, remove []string) (*PromptBulkResult, error) {
+	if err := checkBulkIDs(ids); err != nil {
+		return nil, err
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		return nil, errorx.New(errorx.InvalidInput, "add 与 remove 不能同时为空")
+	}
+	result := &PromptBulkResult{}
+	for _, id := range ids {
+		tmpl, err := s.repo.GetByID(ctx, id)
+		if err != nil {
+			result.add(&PromptBulkItem{ID: id, Action: PromptBulkFailed, Message: err.Error()})
+			continue
+		}
+		if tmpl == nil {
+			result.add(&PromptBulkItem{ID: id, Action: PromptBulkFailed, Message: "提示词模板不存在"})
+			continue
+		}
+		item := &PromptBulkItem{ID: id, Name: tmpl.Name}
+		tags, changed := mergeTags(tmpl.TagsJSON, add, remove)
+		if !changed {
+			item.Action = PromptBulkSkipped
+			result.add(item)
+			continue
+		}
+		data, _ := json.Marshal(tags)
+		if err := s.repo.UpdateTags(ctx, id, string(data)); err != nil {
+			item.Action, item.Message = PromptBulkFailed, err.Error()
+		} else {
+			item.Action = PromptBulkUpdated
+			recordAdminChange(ctx, s.safety, "admin.update_prompt_tags", "prompt_template", id,
+				map[string]string{"TagsJSON": tmpl.TagsJSON}, map[string]string{"TagsJSON": string(data)})
+		}
+		result.add(item)
+	}
+	return result, nil
+}
+
+// mergeTags 合并标签并排序去重，返回新标签与是否变化
+func mergeTags(tagsJSON string, add, remove []string) ([]string, bool) {
+	var current []string
+	if strings.TrimSpace(tagsJSON) != "" {
+		_ = json.Unmarshal([]byte(tagsJSON), &current)
+	}
+	set := map[string]bool{}
+	for _, t := range current {
+		set[t] = true
+	}
+	changed := false
+	for _, t := range add {
+		if t = strings.TrimSpace(t); t != "" && !set[t] {
+			set[t] = true
+			changed = true
+		}
+	}
+	for _, t := range remove {
+		if t = strings.TrimSpace(t); set[t] {
+			delete(set, t)
+			changed = true
+		}
+	}
+	if !changed {
+		return current, false
+	}
+	tags := make([]string, 0, len(set))
+	for t := range set {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	return tags, true
+}
+
+// CopyPromptsToScope 将模板复制到目标作用域；目标同名（同语言区域）模板存在时按 Overwrite 覆盖或跳过
+func (s *promptServiceImpl) CopyPromptsToScope(ctx context.Context, req *PromptScopeCopyRequest) (*PromptBulkResult, error) {
+	if req == nil {
+		return nil, errorx.New(errorx.InvalidInput, "复制请求不能为空")
+	}
+	if req.TargetScope.Rank() == 0 {
+		return nil, errorx.New(errorx.Validation, "target_scope 无效")
+	}
+	if req.TargetScope == entity.PromptScopeGlobal {
+		req.TargetScopeID = 0
+	}
+	switch req.Status {
+	case "":
+		req.Status = entity.PromptStatusPublished
+	case entity.PromptStatusDraft, entity.PromptStatusPublished:
+	default:
+		return nil, errorx.New(errorx.Validation, "status 仅支持 draft/published")
+	}
+
+	var sources []*entity.PromptTemplate
+	if len(req.IDs) > 0 {
+		if err := checkBulkIDs(req.IDs); err != nil {
+			return nil, err
+		}
+		for _, id := range req.IDs {
+			tmpl, err := s.repo.GetByID(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if tmpl == nil {
+				return nil, errorx.New(errorx.NotFound, fmt.Sprintf("提示词模板不存在: %d", id))
+			}
+			sources = append(sources, tmpl)
+		}
+	} else {
+		scope := req.SourceScope
+		if scope == "" {
+			scope = entity.PromptScopeGlobal
+		}
+		scopeID := req.SourceScopeID
+		list, err := s.repo.List(ctx, repo.PromptFilter{
+			Scope:    &scope,
+			ScopeID:  &scopeID,
+			Category: req.Category,
+			Tags:     req.Tags,
+			Limit:    maxPromptBulkItems + 1,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(list) > maxPromptBulkItems {
+			return nil, errorx.New(errorx.Validation, fmt.Sprintf("单次最多复制 %d 个模板，请缩小过滤范围", maxPromptBulkItems))
+		}
+		sources = list
+	}
+	if len(sources) == 0 {
+		return nil, errorx.New(errorx.NotFound, "没有可复制的模板")
+	}
+
+	result := &PromptBulkResult{}
+	for _, src := range sources {
+		item := &PromptBulkItem{ID: src.ID, Name: src.Name}
+		if src.Scope == req.TargetScope && src.ScopeID == req.TargetScopeID {
+			item.Action, item.Message = PromptBulkSkipped, "来源与目标作用域相同"
+			result.add(item)
+			continue
+		}
+		targetScope, targetID, locale := req.TargetScope, req.TargetScopeID, src.Locale
+		existing, err := s.repo.List(ctx, repo.PromptFilter{Name: src.Name, Scope: &targetScope, ScopeID: &targetID, Locale: &locale})
+		if err != nil {
+			item.Action, item.Message = PromptBulkFailed, err.Error()
+			result.add(item)
+			continue
+		}
+		if len(existing) > 0 && !req.Overwrite {
+			item.Action, item.Message, item.NewID = PromptBulkSkipped, "目标作用域已存在同名模板", existing[0].ID
+			result.add(item)
+			continue
+		}
+
+		clone := *src
+		clone.ID = 0
+		clone.Scope = req.TargetScope
+		clone.ScopeID = req.TargetScopeID
+		clone.Status = req.Status
+		clone.Version = 1
+		clone.ApprovedBy = nil
+		clone.ApprovedAt = nil
+		item.Action = PromptBulkCreated
+		if len(existing) > 0 {
+			clone.Version = existing[0].Version + 1
+			item.Action = PromptBulkUpdated
+		}
+		if err := s.SavePrompt(ctx, &clone); err != nil {
+			item.Action, item.Message = PromptBulkFailed, err.Error()
+		} else {
+			item.NewID = clone.ID
+		}
+		result.add(item)
+	}
+	return result, nil
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"text/template"
+
+	"gochen-llm/entity"
+)
+
+// defaultPromptCacheSize 编译缓存容量（模板数）
+const defaultPromptCacheSize = 256
+
+// compiledPrompt 已解析的模板集（含继承链与引用的模板），可并发执行
+type compiledPrompt struct {
+	root    *template.Template
+	names   []string        // 继承链上各层的模板名，按祖先到子模板排序
+	content string          // 编译时叶子模板的内容，用于识别未保存的内存修改
+	ids     map[int64]bool  // 依赖的模板 ID（继承链）
+	refs    map[string]bool // 依赖的模板名称（继承链与引用）
+}
+
+type promptCacheEntry struct {
+	key   string
+	value *compiledPrompt
+}
+
+// promptCache 按模板 ID+版本缓存编译结果的 LRU；模板保存时按依赖失效
+type promptCache struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+func newPromptCache(capacity int) *promptCache {
+	if capacity <= 0 {
+		capacity = defaultPromptCacheSize
+	}
+	return &promptCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+func promptCacheKey(tmpl *entity.PromptTemplate) string {
+	if tmpl == nil || tmpl.ID <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", tmpl.ID, tmpl.Version)
+}
+
+func (c *promptCache) get(tmpl *entity.PromptTemplate) *compiledPrompt {
+	key := promptCacheKey(tmpl)
+	if c == nil || key == "" {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil
+	}
+	entry := el.Value.(*promptCacheEntry)
+	if entry.value.content != tmpl.Content {
+		return nil
+	}
+	c.ll.MoveToFront(el)
+	return entry.value
+}
+
+func (c *promptCache) put(tmpl *entity.PromptTemplate, value *compiledPrompt) {
+	key := promptCacheKey(tmpl)
+	if c == nil || key == "" || value == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		el.Value.(*promptCacheEntry).value = value
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&promptCacheEntry{key: key, value: value})
+	for c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*promptCacheEntry).key)
+	}
+}
+
+// invalidate 移除依赖该模板（按 ID 或名称）的全部缓存项
+func (c *promptCache) invalidate(tmpl *entity.PromptTemplate) {
+	if c == nil || tmpl == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, el := range c.items {
+		v := el.Value.(*promptCacheEntry).value
+		if v.ids[tmpl.ID] || v.refs[tmpl.Name] {
+			c.ll.Remove(el)
+			delete(c.items, key)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"gochen-llm/entity"
+)
+
+const benchPromptContent = `你是{{.role}}。
+{{if .rules}}请遵守以下规则：
+{{range $i, $r := .rules}}{{$i}}. {{$r}}
+{{end}}{{end}}用户的问题：{{.question}}`
+
+func benchPromptVars() map[string]any {
+	return map[string]any{
+		"role":     "客服助手",
+		"rules":    []string{"回答简洁", "不透露内部信息", "无法回答时转人工"},
+		"question": "如何修改收货地址？",
+	}
+}
+
+// BenchmarkRenderPrompt 对比命中编译缓存与每次重新解析模板的渲染耗时
+func BenchmarkRenderPrompt(b *testing.B) {
+	ctx := context.Background()
+	vars := benchPromptVars()
+
+	b.Run("cached", func(b *testing.B) {
+		s := &promptServiceImpl{cache: newPromptCache(defaultPromptCacheSize)}
+		tmpl := &entity.PromptTemplate{ID: 1, Name: "bench", Version: 1, Content: benchPromptContent}
+		if _, err := s.RenderPrompt(ctx, tmpl, vars); err != nil {
+			b.Fatal(err)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := s.RenderPrompt(ctx, tmpl, vars); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		s := &promptServiceImpl{}
+		tmpl := &entity.PromptTemplate{ID: 1, Name: "bench", Version: 1, Content: benchPromptContent}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := s.RenderPrompt(ctx, tmpl, vars); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// promptFuncs 提示词模板可用的辅助函数，参数顺序按管道用法设计（被处理的值放在最后），例如：
+//
+//	{{.name | default "同学"}}  {{.text | truncate 200}}  {{.tags | join "、"}}
+//	{{date "2006-01-02" .created_at}}  {{.profile | json}}  {{.title | upper}}
+var promptFuncs = template.FuncMap{
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"trim":     strings.TrimSpace,
+	"join":     promptJoin,
+	"date":     promptDate,
+	"now":      time.Now,
+	"truncate": promptTruncate,
+	"json":     promptJSON,
+	"default":  promptDefault,
+}
+
+// promptJoin 拼接任意切片元素
+func promptJoin(sep string, list any) string {
+	v := reflect.ValueOf(list)
+	if !v.IsValid() {
+		return ""
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Sprint(list)
+	}
+	parts := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		parts = append(parts, fmt.Sprint(v.Index(i).Interface()))
+	}
+	return strings.Join(parts, sep)
+}
+
+// promptDate 格式化时间，支持 time.Time、RFC3339 字符串与 Unix 秒
+func promptDate(layout string, value any) string {
+	var t time.Time
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		t = *v
+	case string:
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return v
+		}
+		t = parsed
+	case int64:
+		t = time.Unix(v, 0)
+	case int:
+		t = time.Unix(int64(v), 0)
+	case float64: // JSON 反序列化的数字
+		t = time.Unix(int64(v), 0)
+	default:
+		return fmt.Sprint(value)
+	}
+	return t.Format(layout)
+}
+
+// promptTruncate 按字符数截断，超出部分以省略号结尾
+func promptTruncate(n int, value any) string {
+	s := fmt.Sprint(value)
+	if value == nil {
+		s = ""
+	}
+	if out, truncated := truncateRunes(s, n); truncated {
+		return out + "…"
+	}
+	return s
+}
+
+func promptJSON(value any) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// promptDefault 值为空（nil、零值、空字符串/集合）时返回默认值
+func promptDefault(def any, value any) any {
+	if value == nil {
+		return def
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		if v.Len() == 0 {
+			return def
+		}
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return def
+		}
+	default:
+		if v.IsZero() {
+			return def
+		}
+	}
+	return value
+}
@@ -0,0 +1,560 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+	"gochen/logging"
+	runtime "gochen/task"
+)
+
+const (
+	promptGitSchedulerTick = time.Minute
+	promptGitFetchTimeout  = 2 * time.Minute
+	promptGitMaxFiles      = 2000
+	promptGitMaxFileSize   = 1 << 20
+)
+
+// 漂移状态
+const (
+	PromptDriftInSync      = "in_sync"       // 数据库与 Git 一致
+	PromptDriftMissingInDB = "missing_in_db" // Git 中存在，数据库中不存在
+	PromptDriftGitAhead    = "git_ahead"     // Git 内容较新，同步后会生成新版本
+	PromptDriftDBAhead     = "db_ahead"      // 数据库在导出后被直接修改（版本高于 Git）
+	PromptDriftDBOnly      = "db_only"       // 仅存在于数据库
+	PromptDriftInvalid     = "invalid"       // Git 文件无法解析
+)
+
+// PromptGitSyncResult 单次同步结果
+type PromptGitSyncResult struct {
+	SourceID int64               `json:"source_id"`
+	Commit   string              `json:"commit"`
+	UpToDate bool                `json:"up_to_date"` // 提交未变化，未重新导入
+	Import   *PromptImportReport `json:"import,omitempty"`
+}
+
+// PromptDriftItem 单个模板的漂移状态
+type PromptDriftItem struct {
+	Path    string             `json:"path"`
+	Name    string             `json:"name,omitempty"`
+	Scope   entity.PromptScope `json:"scope,omitempty"`
+	ScopeID int64              `json:"scope_id,omitempty"`
+	State   string             `json:"state"`
+	Message string             `json:"message,omitempty"`
+}
+
+// PromptDriftReport 数据库与 Git 的差异报告
+type PromptDriftReport struct {
+	SourceID int64              `json:"source_id"`
+	Commit   string             `json:"commit"`
+	InSync   int                `json:"in_sync"`
+	Drifted  int                `json:"drifted"`
+	Items    []*PromptDriftItem `json:"items"`
+}
+
+// PromptGitSync 从 Git 仓库同步提示词模板（定时 / Webhook / 手动），并检测数据库与 Git 的漂移
+type PromptGitSync interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	SaveSource(ctx context.Context, source *entity.PromptGitSource) error
+	ListSources(ctx context.Context) ([]*entity.PromptGitSource, error)
+	// Sync 拉取并导入；force=false 且提交未变化时跳过
+	Sync(ctx context.Context, sourceID int64, force bool) (*PromptGitSyncResult, error)
+	Drift(ctx context.Context, sourceID int64) (*PromptDriftReport, error)
+	// HandleWebhook 校验 X-Hub-Signature-256 风格签名后异步触发同步
+	HandleWebhook(ctx context.Context, sourceID int64, body []byte, signature string) error
+}
+
+type promptGitSyncImpl struct {
+	repo   repo.PromptGitSourceRepo
+	prompt PromptService
+	logger logging.ILogger
+	super  *runtime.TaskSupervisor
+
+	// syncMu 串行化同步，避免定时与 Webhook 并发导入同一批模板
+	syncMu sync.Mutex
+
+	lifecycleMu sync.Mutex
+	started     bool
+	stopped     bool
+	loopCtx     context.Context
+	cancel      context.CancelFunc
+}
+
+func NewPromptGitSync(repo repo.PromptGitSourceRepo, prompt PromptService, logger logging.ILogger) PromptGitSync {
+	return &promptGitSyncImpl{
+		repo:   repo,
+		prompt: prompt,
+		logger: logger,
+		super:  runtime.NewTaskSupervisor("gochen-llm.prompt_git_sync"),
+	}
+}
+
+func (s *promptGitSyncImpl) Start(ctx context.Context) error {
+	if ctx == nil {
+		return errorx.New(errorx.InvalidInput, "ctx 不能为空")
+	}
+
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+
+	if s.stopped {
+		return errorx.New(errorx.Internal, "PromptGitSync 已停止，无法再次启动")
+	}
+	if s.started {
+		return nil
+	}
+	loopCtx, cancel := context.WithCancel(ctx)
+	s.loopCtx = loopCtx
+	s.cancel = cancel
+	s.started = true
+
+	s.super.GoLoop(loopCtx, "schedule_loop", promptGitSchedulerTick, func(ctx context.Context) error {
+		s.syncDue(ctx)
+		return nil
+	})
+	return nil
+}
+
+func (s *promptGitSyncImpl) Stop(ctx context.Context) error {
+	s.lifecycleMu.Lock()
+	if !s.started || s.stopped {
+		s.lifecycleMu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	cancel := s.cancel
+	s.lifecycleMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.super.Stop()
+	return nil
+}
+
+func (s *promptGitSyncImpl) SaveSource(ctx context.Context, source *entity.PromptGitSource) error {
+	if source == nil {
+		return errorx.New(errorx.InvalidInput, "Git 同步源不能为空")
+	}
+	source.Name = strings.TrimSpace(source.Name)
+	source.RepoURL = strings.TrimSpace(source.RepoURL)
+	if source.Name == "" {
+		return errorx.New(errorx.Validation, "name 不能为空")
+	}
+	if err := validateGitRepoURL(source.RepoURL); err != nil {
+		return err
+	}
+	if source.Branch == "" {
+		source.Branch = "main"
+	}
+	if strings.HasPrefix(source.Branch, "-") {
+		return errorx.New(errorx.Validation, "branch 无效")
+	}
+	if _, err := cleanGitSubPath(source.Path); err != nil {
+		return err
+	}
+	if source.IntervalSeconds < 0 {
+		return errorx.New(errorx.Validation, "interval_seconds 不能为负数")
+	}
+	if source.IntervalSeconds > 0 && source.IntervalSeconds < 60 {
+		source.IntervalSeconds = 60
+	}
+	if source.ID > 0 {
+		existing, err := s.repo.Get(ctx, source.ID)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			return errorx.New(errorx.NotFound, "Git 同步源不存在")
+		}
+		// 未传入密钥时保留原值，避免脱敏展示后回写清空
+		if source.Token == "" {
+			source.Token = existing.Token
+		}
+		if source.WebhookSecret == "" {
+			source.WebhookSecret = existing.WebhookSecret
+		}
+		source.LastCommit = existing.LastCommit
+		source.LastSyncAt = existing.LastSyncAt
+		source.LastStatus = existing.LastStatus
+		source.LastError = existing.LastError
+		source.LastResultJSON = existing.LastResultJSON
+		source.CreatedAt = existing.CreatedAt
+	}
+	return s.repo.Save(ctx, source)
+}
+
+func (s *promptGitSyncImpl) ListSources(ctx context.Context) ([]*entity.PromptGitSource, error) {
+	return s.repo.List(ctx, false)
+}
+
+// syncDue 定时触发：同步到期的启用源
+func (s *promptGitSyncImpl) syncDue(ctx context.Context) {
+	sources, err := s.repo.List(ctx, true)
+	if err != nil {
+		if s.logger != nil {
+			s.logger.Warn(ctx, "加载 Git 同步源失败", logging.Error(err))
+		}
+		return
+	}
+	now := time.Now()
+	for _, src := range sources {
+		if src.IntervalSeconds <= 0 {
+			continue
+		}
+		if src.LastSyncAt != nil && now.Sub(*src.LastSyncAt) < time.Duration(src.IntervalSeconds)*time.Second {
+			continue
+		}
+		if _, err := s.Sync(ctx, src.ID, false); err != nil && s.logger != nil {
+			s.logger.Warn(ctx, "定时同步提示词失败", logging.Int("source_id", int(src.ID)), logging.Error(err))
+		}
+	}
+}
+
+func (s *promptGitSyncImpl) Sync(ctx context.Context, sourceID int64, force bool) (*PromptGitSyncResult, error) {
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	src, err := s.getSource(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	files, commit, err := s.fetch(ctx, src)
+	if err != nil {
+		src.LastSyncAt = &now
+		src.LastStatus = entity.PromptGitSyncFailed
+		src.LastError = err.Error()
+		_ = s.repo.Save(ctx, src)
+		return nil, err
+	}
+
+	result := &PromptGitSyncResult{SourceID: src.ID, Commit: commit}
+	if !force && commit == src.LastCommit && src.LastStatus == entity.PromptGitSyncOK {
+		result.UpToDate = true
+		src.LastSyncAt = &now
+		return result, s.repo.Save(ctx, src)
+	}
+
+	report, err := s.prompt.ImportPromptsYAML(ctx, files, PromptImportOptions{Force: src.Overwrite})
+	if err != nil {
+		src.LastSyncAt = &now
+		src.LastStatus = entity.PromptGitSyncFailed
+		src.LastError = err.Error()
+		_ = s.repo.Save(ctx, src)
+		return nil, err
+	}
+	result.Import = report
+
+	data, _ := json.Marshal(report)
+	src.LastSyncAt = &now
+	src.LastResultJSON = string(data)
+	if report.Errors > 0 {
+		// 保留上次提交，下一轮重新尝试
+		src.LastStatus = entity.PromptGitSyncFailed
+		src.LastError = "部分模板导入失败，详见同步结果"
+	} else {
+		src.LastCommit = commit
+		src.LastStatus = entity.PromptGitSyncOK
+		src.LastError = ""
+	}
+	if err := s.repo.Save(ctx, src); err != nil {
+		return nil, err
+	}
+	if s.logger != nil {
+		s.logger.Info(ctx, "提示词 Git 同步完成",
+			logging.Int("source_id", int(src.ID)),
+			logging.String("commit", commit),
+			logging.Int("created", report.Created),
+			logging.Int("updated", report.Updated),
+			logging.Int("conflict", report.Conflict),
+			logging.Int("errors", report.Errors),
+		)
+	}
+	return result, nil
+}
+
+// Drift 以预演导入比较 Git 与数据库，并列出仅存在于数据库中的模板
+func (s *promptGitSyncImpl) Drift(ctx context.Context, sourceID int64) (*PromptDriftReport, error) {
+	src, err := s.getSource(ctx, sourceID)
+	if err != nil {
+		return nil, err
+	}
+	files, commit, err := s.fetch(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	preview, err := s.prompt.ImportPromptsYAML(ctx, files, PromptImportOptions{DryRun: true})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PromptDriftReport{SourceID: src.ID, Commit: commit}
+	gitPaths := map[string]bool{}
+	for _, item := range preview.Items {
+		gitPaths[item.Path] = true
+		d := &PromptDriftItem{Path: item.Path, Name: item.Name, Scope: item.Scope, ScopeID: item.ScopeID, Message: item.Message}
+		switch item.Action {
+		case PromptImportSkipped:
+			d.State = PromptDriftInSync
+		case PromptImportCreated:
+			d.State = PromptDriftMissingInDB
+		case PromptImportUpdated:
+			d.State = PromptDriftGitAhead
+		case PromptImportConflict:
+			d.State = PromptDriftDBAhead
+		default:
+			d.State = PromptDriftInvalid
+		}
+		report.Items = append(report.Items, d)
+	}
+
+	exported, err := s.prompt.ExportPromptsYAML(ctx, repo.PromptFilter{})
+	if err != nil {
+		return nil, err
+	}
+	dbOnly := make([]string, 0)
+	for p := range exported {
+		if !gitPaths[p] {
+			dbOnly = append(dbOnly, p)
+		}
+	}
+	sort.Strings(dbOnly)
+	for _, p := range dbOnly {
+		report.Items = append(report.Items, &PromptDriftItem{Path: p, State: PromptDriftDBOnly})
+	}
+
+	for _, item := range report.Items {
+		if item.State == PromptDriftInSync {
+			report.InSync++
+		} else {
+			report.Drifted++
+		}
+	}
+	return report, nil
+}
+
+func (s *promptGitSyncImpl) HandleWebhook(ctx context.Context, sourceID int64, body []byte, signature string) error {
+	src, err := s.getSource(ctx, sourceID)
+	if err != nil {
+		return err
+	}
+	if !src.Enabled {
+		return errorx.New(errorx.Validation, "Git 同步源未启用")
+	}
+	if src.WebhookSecret == "" {
+		return errorx.New(errorx.Unauthorized, "Git 同步源未配置 Webhook 密钥")
+	}
+	mac := hmac.New(sha256.New, []byte(src.WebhookSecret))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(strings.TrimSpace(signature))) {
+		return errorx.New(errorx.Unauthorized, "Webhook 签名无效")
+	}
+
+	s.lifecycleMu.Lock()
+	loopCtx := s.loopCtx
+	s.lifecycleMu.Unlock()
+	if loopCtx == nil {
+		return errorx.New(errorx.Internal, "PromptGitSync 未启动")
+	}
+	// 异步执行，避免 Webhook 调用方超时
+	s.super.Go(loopCtx, "webhook_sync", func(ctx context.Context) {
+		if _, err := s.Sync(ctx, src.ID, false); err != nil && s.logger != nil {
+			s.logger.Warn(ctx, "Webhook 触发提示词同步失败", logging.Int("source_id", int(src.ID)), logging.Error(err))
+		}
+	})
+	return nil
+}
+
+func (s *promptGitSyncImpl) getSource(ctx context.Context, id int64) (*entity.PromptGitSource, error) {
+	if id <= 0 {
+		return nil, errorx.New(errorx.InvalidInput, "source_id 无效")
+	}
+	src, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if src == nil {
+		return nil, errorx.New(errorx.NotFound, "Git 同步源不存在")
+	}
+	return src, nil
+}
+
+// fetch 浅克隆指定分支到临时目录，读取模板目录下的 YAML 文件（路径相对于模板目录）
+func (s *promptGitSyncImpl) fetch(ctx context.Context, src *entity.PromptGitSource) (map[string][]byte, string, error) {
+	subPath, err := cleanGitSubPath(src.Path)
+	if err != nil {
+		return nil, "", err
+	}
+	dir, err := os.MkdirTemp("", "gochen-llm-prompts-*")
+	if err != nil {
+		return nil, "", errorx.Wrap(err, errorx.Internal, "创建临时目录失败")
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(ctx, promptGitFetchTimeout)
+	defer cancel()
+
+	var env []string
+	if src.Token != "" {
+		// 通过环境变量中的 git 配置传递认证头，令牌不出现在 URL、进程参数（ps 可见）或错误信息中的远端地址里
+		user := src.Username
+		if user == "" {
+			user = "x-access-token"
+		}
+		cred := base64.StdEncoding.EncodeToString([]byte(user + ":" + src.Token))
+		env = append(env, "GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=http.extraHeader", "GIT_CONFIG_VALUE_0=Authorization: Basic "+cred)
+	}
+	args := []string{"clone", "--depth", "1", "--single-branch", "--branch", src.Branch, "--", src.RepoURL, dir}
+	if out, err := runGit(ctx, "", env, args...); err != nil {
+		return nil, "", errorx.Wrap(err, errorx.Internal, "拉取 Git 仓库失败: "+redactSecret(out, src.Token))
+	}
+	out, err := runGit(ctx, dir, nil, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, "", errorx.Wrap(err, errorx.Internal, "读取 Git 提交失败")
+	}
+	commit := strings.TrimSpace(out)
+
+	root, err := resolveGitRoot(dir, subPath)
+	if err != nil {
+		return nil, "", err
+	}
+	files := map[string][]byte{}
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// 仓库中的符号链接可指向宿主机任意文件，一律跳过
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(p))
+		if ext != ".yaml" && ext != ".yml" {
+			return nil
+		}
+		if len(files) >= promptGitMaxFiles {
+			return errorx.New(errorx.Validation, "Git 模板文件数量超出上限")
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > promptGitMaxFileSize {
+			return errorx.New(errorx.Validation, "Git 模板文件过大: "+d.Name())
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, "", errorx.Wrap(err, errorx.Internal, "读取 Git 模板目录失败")
+	}
+	return files, commit, nil
+}
+
+// resolveGitRoot 返回模板目录的真实路径；目录路径经符号链接指向克隆目录之外时拒绝
+func resolveGitRoot(dir, subPath string) (string, error) {
+	base, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", errorx.Wrap(err, errorx.Internal, "解析临时目录失败")
+	}
+	root, err := filepath.EvalSymlinks(filepath.Join(base, filepath.FromSlash(subPath)))
+	if err != nil {
+		return "", errorx.Wrap(err, errorx.Validation, "Git 模板目录不存在: "+subPath)
+	}
+	if root != base && !strings.HasPrefix(root, base+string(filepath.Separator)) {
+		return "", errorx.New(errorx.Validation, "Git 模板目录不能指向仓库之外: "+subPath)
+	}
+	return root, nil
+}
+
+// runGit 执行 git 命令，env 追加到当前进程环境之后
+func runGit(ctx context.Context, dir string, env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), env...)
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	return out.String(), err
+}
+
+// validateGitRepoURL 仅允许常见远程协议，禁止以 "-" 开头的地址与内嵌凭证
+func validateGitRepoURL(raw string) error {
+	if raw == "" {
+		return errorx.New(errorx.Validation, "repo_url 不能为空")
+	}
+	allowed := strings.HasPrefix(raw, "https://") || strings.HasPrefix(raw, "http://") ||
+		strings.HasPrefix(raw, "ssh://") || strings.HasPrefix(raw, "git@")
+	if !allowed {
+		return errorx.New(errorx.Validation, "repo_url 仅支持 https/http/ssh 地址")
+	}
+	if i := strings.Index(raw, "://"); i >= 0 {
+		host := raw[i+3:]
+		if j := strings.Index(host, "/"); j >= 0 {
+			host = host[:j]
+		}
+		if strings.Contains(host, ":") && strings.Contains(host, "@") {
+			return errorx.New(errorx.Validation, "repo_url 不能内嵌凭证，请使用 token 字段")
+		}
+	}
+	return nil
+}
+
+// cleanGitSubPath 规范化仓库内目录，禁止越出仓库根目录
+func cleanGitSubPath(p string) (string, error) {
+	p = strings.Trim(strings.TrimSpace(p), "/")
+	if p == "" {
+		return ".", nil
+	}
+	cleaned := path.Clean(p)
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", errorx.New(errorx.Validation, "path 不能越出仓库目录")
+	}
+	return cleaned, nil
+}
+
+func redactSecret(s, secret string) string {
+	s = strings.TrimSpace(s)
+	if secret != "" {
+		s = strings.ReplaceAll(s, secret, "***")
+	}
+	if len(s) > 500 {
+		s = s[:500]
+	}
+	return s
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+// maxPromptIncludes 单次渲染最多引入的外部模板数量
+const maxPromptIncludes = 32
+
+// resolveIncludes 将 {{template "name" .}} 引用的、当前模板集中未定义的名称按作用域查找
+// （当前作用域优先，沿回退链至全局）并解析进模板集；引入的模板可继续引用其他模板。返回引入的模板名称。
+// 引用按引用方模板的语言区域回退解析，与请求的区域无关，保证编译结果可按模板 ID 缓存。
+func (s *promptServiceImpl) resolveIncludes(ctx context.Context, root *template.Template, scope entity.PromptScope, scopeID int64, locale string) ([]string, error) {
+	var loaded []string
+	for {
+		missing := missingTemplateRefs(root)
+		if len(missing) == 0 {
+			break
+		}
+		for _, name := range missing {
+			if len(loaded) >= maxPromptIncludes {
+				return nil, errorx.New(errorx.Validation, "提示词模板引用数量过多")
+			}
+			inc, err := s.findLocalized(ctx, name, scope, scopeID, locale)
+			if err != nil {
+				return nil, err
+			}
+			if inc == nil || !inc.Enabled {
+				return nil, errorx.New(errorx.NotFound, fmt.Sprintf("引用的提示词模板不存在: %s", name))
+			}
+			if _, err := root.New(name).Parse(inc.Content); err != nil {
+				return nil, errorx.Wrap(err, errorx.Internal, fmt.Sprintf("解析引用的提示词模板失败: %s", name))
+			}
+			loaded = append(loaded, name)
+		}
+	}
+	return loaded, checkTemplateCycles(root)
+}
+
+// missingTemplateRefs 返回模板集中被引用但尚未定义的模板名称
+func missingTemplateRefs(root *template.Template) []string {
+	seen := map[string]bool{}
+	var missing []string
+	for _, t := range root.Templates() {
+		for _, ref := range templateRefs(t) {
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+			if lookup := root.Lookup(ref); lookup == nil || lookup.Tree == nil {
+				missing = append(missing, ref)
+			}
+		}
+	}
+	return missing
+}
+
+// checkTemplateCycles 检测模板间的循环引用（A 引用 B，B 又引用 A）
+func checkTemplateCycles(root *template.Template) error {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := map[string]int{}
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return errorx.New(errorx.Validation, fmt.Sprintf("提示词模板存在循环引用: %s -> %s", strings.Join(path, " -> "), name))
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		if t := root.Lookup(name); t != nil {
+			for _, ref := range templateRefs(t) {
+				if err := visit(ref); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = done
+		return nil
+	}
+	for _, t := range root.Templates() {
+		if err := visit(t.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func templateRefs(t *template.Template) []string {
+	if t == nil || t.Tree == nil || t.Tree.Root == nil {
+		return nil
+	}
+	var refs []string
+	collectTemplateRefs(t.Tree.Root, &refs)
+	return refs
+}
+
+func collectTemplateRefs(node parse.Node, refs *[]string) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectTemplateRefs(child, refs)
+		}
+	case *parse.TemplateNode:
+		*refs = append(*refs, n.Name)
+	case *parse.IfNode:
+		collectTemplateRefs(n.List, refs)
+		collectTemplateRefs(n.ElseList, refs)
+	case *parse.RangeNode:
+		collectTemplateRefs(n.List, refs)
+		collectTemplateRefs(n.ElseList, refs)
+	case *parse.WithNode:
+		collectTemplateRefs(n.List, refs)
+		collectTemplateRefs(n.ElseList, refs)
+	}
+}
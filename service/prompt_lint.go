@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+)
+
+// 校验结果级别
+const (
+	PromptFindingError   = "error"
+	PromptFindingWarning = "warning"
+)
+
+// largePromptTokens 渲染结果超过该估算 token 数时给出提示
+const largePromptTokens = 4000
+
+// PromptFinding 单条校验发现
+type PromptFinding struct {
+	Level    string `json:"level"`              // error / warning
+	Code     string `json:"code"`               // syntax_error / include_error / render_error / undeclared_variable / unused_variable / missing_sample_variable / large_prompt
+	Message  string `json:"message"`            // 说明
+	Variable string `json:"variable,omitempty"` // 相关变量名
+}
+
+// PromptValidation 提示词校验与试渲染结果
+type PromptValidation struct {
+	Valid           bool             `json:"valid"` // 不含 error 级别发现
+	Findings        []*PromptFinding `json:"findings"`
+	Rendered        string           `json:"rendered,omitempty"` // 使用样例变量试渲染的结果
+	EstimatedTokens int              `json:"estimated_tokens"`
+}
+
+func (v *PromptValidation) add(level, code, variable, message string) {
+	v.Findings = append(v.Findings, &PromptFinding{Level: level, Code: code, Variable: variable, Message: message})
+	if level == PromptFindingError {
+		v.Valid = false
+	}
+}
+
+// promptVariableDef VariablesJSON 中的单个变量定义
+type promptVariableDef struct {
+	Name    string `json:"name"`
+	Default any    `json:"default"`
+}
+
+// ValidatePrompt 检查模板语法、继承/引用解析、变量声明一致性，并用样例变量试渲染估算 token 数
+func (s *promptServiceImpl) ValidatePrompt(ctx context.Context, tmpl *entity.PromptTemplate, sampleVars map[string]any) (*PromptValidation, error) {
+	if tmpl == nil {
+		return nil, errorx.New(errorx.InvalidInput, "模板不能为空")
+	}
+	// 校验在预览模式下进行，允许引用尚未发布的模板
+	ctx = repo.WithPromptPreview(ctx)
+	result := &PromptValidation{Valid: true, Findings: []*PromptFinding{}}
+
+	if err := checkPromptSyntax(tmpl.Content); err != nil {
+		result.add(PromptFindingError, "syntax_error", "", err.Error())
+		return result, nil
+	}
+	compiled, err := s.compile(ctx, tmpl)
+	if err != nil {
+		result.add(PromptFindingError, "include_error", "", err.Error())
+		return result, nil
+	}
+
+	used := map[string]bool{}
+	for _, t := range compiled.root.Templates() {
+		if t.Tree != nil {
+			collectTemplateVars(t.Tree.Root, used)
+		}
+	}
+
+	var defs []promptVariableDef
+	if strings.TrimSpace(tmpl.VariablesJSON) != "" {
+		if err := json.Unmarshal([]byte(tmpl.VariablesJSON), &defs); err != nil {
+			result.add(PromptFindingError, "invalid_variables", "", fmt.Sprintf("VariablesJSON 解析失败: %v", err))
+		}
+	}
+	declared := map[string]promptVariableDef{}
+	for _, d := range defs {
+		if d.Name != "" {
+			declared[d.Name] = d
+		}
+	}
+
+	vars := map[string]any{}
+	for name, d := range declared {
+		if d.Default != nil {
+			vars[name] = d.Default
+		}
+	}
+	for k, v := range sampleVars {
+		vars[k] = v
+	}
+
+	for _, name := range sortedKeys(used) {
+		if len(declared) > 0 {
+			if _, ok := declared[name]; !ok {
+				result.add(PromptFindingWarning, "undeclared_variable", name, "模板使用了未在 VariablesJSON 中声明的变量")
+			}
+		}
+		if _, ok := vars[name]; !ok {
+			result.add(PromptFindingWarning, "missing_sample_variable", name, "未提供样例值或默认值，试渲染结果可能包含 <no value>")
+		}
+	}
+	for _, name := range sortedKeys(declared) {
+		if !used[name] {
+			result.add(PromptFindingWarning, "unused_variable", name, "变量已声明但模板未使用")
+		}
+	}
+
+	rendered, err := s.RenderPrompt(ctx, tmpl, vars)
+	if err != nil {
+		result.add(PromptFindingError, "render_error", "", err.Error())
+		return result, nil
+	}
+	result.Rendered = rendered
+	result.EstimatedTokens = (len([]rune(rendered)) + 3) / 4
+	if result.EstimatedTokens > largePromptTokens {
+		result.add(PromptFindingWarning, "large_prompt", "", fmt.Sprintf("渲染结果约 %d tokens，可能挤占对话上下文", result.EstimatedTokens))
+	}
+	return result, nil
+}
+
+// checkPromptSyntax 仅检查模板自身语法（不解析继承与引用）
+func checkPromptSyntax(content string) error {
+	if _, err := template.New("prompt").Funcs(promptFuncs).Parse(content); err != nil {
+		return errorx.Wrap(err, errorx.Validation, "提示词模板语法错误")
+	}
+	return nil
+}
+
+// collectTemplateVars 收集模板中引用的顶层变量（.name / $.name），range/with 内部的点已改变，不计入
+func collectTemplateVars(node parse.Node, out map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectTemplateVars(child, out)
+		}
+	case *parse.ActionNode:
+		collectTemplateVars(n.Pipe, out)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectTemplateVars(cmd, out)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectTemplateVars(arg, out)
+		}
+	case *parse.FieldNode:
+		if len(n.Ident) > 0 {
+			out[n.Ident[0]] = true
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			out[n.Ident[1]] = true
+		}
+	case *parse.ChainNode:
+		collectTemplateVars(n.Node, out)
+	case *parse.IfNode:
+		collectTemplateVars(n.Pipe, out)
+		collectTemplateVars(n.List, out)
+		collectTemplateVars(n.ElseList, out)
+	case *parse.RangeNode:
+		collectTemplateVars(n.Pipe, out)
+		collectTemplateVars(n.ElseList, out)
+	case *parse.WithNode:
+		collectTemplateVars(n.Pipe, out)
+		collectTemplateVars(n.ElseList, out)
+	case *parse.TemplateNode:
+		collectTemplateVars(n.Pipe, out)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
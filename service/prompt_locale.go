@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+)
+
+type promptLocaleKey struct{}
+
+// WithPromptLocale 指定 GetPrompt 解析的语言区域（如 zh-CN、en-US）
+func WithPromptLocale(ctx context.Context, locale string) context.Context {
+	locale = normalizeLocale(locale)
+	if locale == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, promptLocaleKey{}, locale)
+}
+
+func promptLocaleFrom(ctx context.Context) string {
+	v, _ := ctx.Value(promptLocaleKey{}).(string)
+	return v
+}
+
+// normalizeLocale 统一为 语言小写-地区大写 形式："zh_cn" -> "zh-CN"；auto 视为未指定
+func normalizeLocale(locale string) string {
+	locale = strings.TrimSpace(strings.ReplaceAll(locale, "_", "-"))
+	if locale == "" || strings.EqualFold(locale, LanguageAuto) {
+		return ""
+	}
+	parts := strings.Split(locale, "-")
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i])
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// localeCandidates 解析顺序：完整区域 → 语言 → 默认（空）
+func localeCandidates(locale string) []string {
+	locale = normalizeLocale(locale)
+	if locale == "" {
+		return []string{""}
+	}
+	candidates := []string{locale}
+	if lang, _, ok := strings.Cut(locale, "-"); ok && lang != "" {
+		candidates = append(candidates, lang)
+	}
+	return append(candidates, "")
+}
+
+// findLocalized 按语言区域回退顺序查找生效模板，每个候选区域内部按作用域回退链解析
+func (s *promptServiceImpl) findLocalized(ctx context.Context, name string, scope entity.PromptScope, scopeID int64, locale string) (*entity.PromptTemplate, error) {
+	chain := promptScopeChain(ctx, scope, scopeID)
+	for _, candidate := range localeCandidates(locale) {
+		tmpl, err := s.repo.FindEffective(ctx, name, chain, candidate)
+		if err != nil {
+			return nil, err
+		}
+		if tmpl != nil {
+			if repo.IsPromptPreview(ctx) {
+				return s.previewVersion(ctx, tmpl)
+			}
+			return tmpl, nil
+		}
+	}
+	return nil, nil
+}
+
+// previewVersion 预览模式下使用模板尚未发布的最新版本（归档除外）
+func (s *promptServiceImpl) previewVersion(ctx context.Context, tmpl *entity.PromptTemplate) (*entity.PromptTemplate, error) {
+	latest, err := s.repo.GetLatestVersion(ctx, tmpl.ID)
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil || latest.Version <= tmpl.Version || latest.Status == entity.PromptStatusArchived {
+		return tmpl, nil
+	}
+	pinned := *tmpl
+	pinned.Content, pinned.VariablesJSON, pinned.Version, pinned.Status = latest.Content, latest.VariablesJSON, latest.Version, latest.Status
+	if err := applyVersionSettings(&pinned, latest); err != nil {
+		return nil, err
+	}
+	return &pinned, nil
+}
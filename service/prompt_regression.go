@@ -0,0 +1,506 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gochen-llm/client"
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+	"gochen/logging"
+	runtime "gochen/task"
+)
+
+const defaultPromptRegressionInterval = 5 * time.Minute
+
+const promptRegressionJudgePrompt = `你是一名严格的评审员，请按以下评分标准对助手回答打分（0-10 分）：
+%s
+仅输出一个 JSON 对象，例如：{"score": 8, "comment": "..."}`
+
+// PromptAssertionResult 单条断言的判定结果
+type PromptAssertionResult struct {
+	entity.PromptTestAssertion
+	Passed  bool   `json:"passed"`
+	Message string `json:"message,omitempty"`
+}
+
+// PromptSuiteResult 模板回归测试汇总
+type PromptSuiteResult struct {
+	TemplateID int64                   `json:"template_id"`
+	Version    int                     `json:"version"`
+	Passed     int                     `json:"passed"`
+	Failed     int                     `json:"failed"`
+	Runs       []*entity.PromptTestRun `json:"runs"`
+}
+
+// PromptRegressionService 提示词回归测试：管理用例，按需或在模板版本变化时执行并记录通过/失败历史
+type PromptRegressionService interface {
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+	SaveCase(ctx context.Context, tc *entity.PromptTestCase) error
+	ListCases(ctx context.Context, templateID int64) ([]*entity.PromptTestCase, error)
+	// RunCase 执行单个用例，endpoint 为空时使用用例配置的端点
+	RunCase(ctx context.Context, caseID int64, endpoint, trigger string, actorID int64) (*entity.PromptTestRun, error)
+	// RunSuite 执行模板下全部启用的用例
+	RunSuite(ctx context.Context, templateID int64, endpoint, trigger string, actorID int64) (*PromptSuiteResult, error)
+	ListRuns(ctx context.Context, caseID, templateID int64, limit int) ([]*entity.PromptTestRun, error)
+	// CheckVersionChanges 对版本已变化（或从未执行）的 RunOnChange 用例执行一轮，返回本轮执行记录
+	CheckVersionChanges(ctx context.Context) ([]*entity.PromptTestRun, error)
+}
+
+type promptRegressionServiceImpl struct {
+	repo    repo.PromptTestRepo
+	prompt  PromptService
+	chat    ChatService
+	manager ProviderManager
+	logger  logging.ILogger
+	super   *runtime.TaskSupervisor
+
+	interval time.Duration
+
+	lifecycleMu sync.Mutex
+	started     bool
+	stopped     bool
+	cancel      context.CancelFunc
+}
+
+func NewPromptRegressionService(repo repo.PromptTestRepo, prompt PromptService, chat ChatService, manager ProviderManager, logger logging.ILogger) PromptRegressionService {
+	return &promptRegressionServiceImpl{
+		repo:     repo,
+		prompt:   prompt,
+		chat:     chat,
+		manager:  manager,
+		logger:   logger,
+		super:    runtime.NewTaskSupervisor("gochen-llm.prompt_regression"),
+		interval: defaultPromptRegressionInterval,
+	}
+}
+
+func (s *promptRegressionServiceImpl) Start(ctx context.Context) error {
+	if ctx == nil {
+		return errorx.New(errorx.InvalidInput, "ctx 不能为空")
+	}
+
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+
+	if s.stopped {
+		return errorx.New(errorx.Internal, "PromptRegressionService 已停止，无法再次启动")
+	}
+	if s.started {
+		return nil
+	}
+	loopCtx, cancel := context.WithCancel(ctx)
+	s.cancel = cancel
+	s.started = true
+
+	s.super.GoLoop(loopCtx, "version_change_loop", s.interval, func(ctx context.Context) error {
+		if _, err := s.CheckVersionChanges(ctx); err != nil && s.logger != nil {
+			s.logger.Warn(ctx, "提示词回归测试执行失败", logging.Error(err))
+		}
+		return nil
+	})
+	return nil
+}
+
+func (s *promptRegressionServiceImpl) Stop(ctx context.Context) error {
+	s.lifecycleMu.Lock()
+	if !s.started || s.stopped {
+		s.lifecycleMu.Unlock()
+		return nil
+	}
+	s.stopped = true
+	cancel := s.cancel
+	s.lifecycleMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.super.Stop()
+	return nil
+}
+
+func (s *promptRegressionServiceImpl) SaveCase(ctx context.Context, tc *entity.PromptTestCase) error {
+	if tc == nil {
+		return errorx.New(errorx.InvalidInput, "测试用例不能为空")
+	}
+	if s.repo == nil || s.prompt == nil {
+		return errorx.New(errorx.Internal, "提示词回归测试未配置")
+	}
+	if strings.TrimSpace(tc.Name) == "" {
+		return errorx.New(errorx.Validation, "name 不能为空")
+	}
+	tmpl, err := s.prompt.GetPromptByID(repo.WithPromptPreview(ctx), tc.TemplateID)
+	if err != nil {
+		return err
+	}
+	if tmpl == nil {
+		return errorx.New(errorx.NotFound, "提示词模板不存在")
+	}
+	if _, err := decodeTestVariables(tc.VariablesJSON); err != nil {
+		return err
+	}
+	messages, err := decodeTestMessages(tc.MessagesJSON)
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return errorx.New(errorx.Validation, "messages 不能为空")
+	}
+	assertions, err := decodeTestAssertions(tc.AssertionsJSON)
+	if err != nil {
+		return err
+	}
+	if len(assertions) == 0 && strings.TrimSpace(tc.JudgeRubric) == "" {
+		return errorx.New(errorx.Validation, "至少需要一条断言或裁判评分标准")
+	}
+	if tc.JudgeMinScore < 0 || tc.JudgeMinScore > 10 {
+		return errorx.New(errorx.Validation, "judge_min_score 需在 0-10 之间")
+	}
+	return s.repo.SaveCase(ctx, tc)
+}
+
+func (s *promptRegressionServiceImpl) ListCases(ctx context.Context, templateID int64) ([]*entity.PromptTestCase, error) {
+	if s.repo == nil {
+		return nil, errorx.New(errorx.Internal, "提示词回归测试仓储未配置")
+	}
+	return s.repo.ListCases(ctx, templateID, false)
+}
+
+func (s *promptRegressionServiceImpl) ListRuns(ctx context.Context, caseID, templateID int64, limit int) ([]*entity.PromptTestRun, error) {
+	if s.repo == nil {
+		return nil, errorx.New(errorx.Internal, "提示词回归测试仓储未配置")
+	}
+	return s.repo.ListRuns(ctx, caseID, templateID, limit)
+}
+
+func (s *promptRegressionServiceImpl) RunCase(ctx context.Context, caseID int64, endpoint, trigger string, actorID int64) (*entity.PromptTestRun, error) {
+	if s.repo == nil {
+		return nil, errorx.New(errorx.Internal, "提示词回归测试仓储未配置")
+	}
+	tc, err := s.repo.GetCase(ctx, caseID)
+	if err != nil {
+		return nil, err
+	}
+	if tc == nil {
+		return nil, errorx.New(errorx.NotFound, "测试用例不存在")
+	}
+	return s.runCase(ctx, tc, endpoint, trigger, actorID)
+}
+
+func (s *promptRegressionServiceImpl) RunSuite(ctx context.Context, templateID int64, endpoint, trigger string, actorID int64) (*PromptSuiteResult, error) {
+	if s.repo == nil {
+		return nil, errorx.New(errorx.Internal, "提示词回归测试仓储未配置")
+	}
+	cases, err := s.repo.ListCases(ctx, templateID, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(cases) == 0 {
+		return nil, errorx.New(errorx.NotFound, "模板没有启用的测试用例")
+	}
+	result := &PromptSuiteResult{TemplateID: templateID}
+	for _, tc := range cases {
+		run, err := s.runCase(ctx, tc, endpoint, trigger, actorID)
+		if err != nil {
+			return nil, err
+		}
+		if run.Passed {
+			result.Passed++
+		} else {
+			result.Failed++
+		}
+		result.Version = run.TemplateVersion
+		result.Runs = append(result.Runs, run)
+	}
+	return result, nil
+}
+
+func (s *promptRegressionServiceImpl) CheckVersionChanges(ctx context.Context) ([]*entity.PromptTestRun, error) {
+	if s.repo == nil || s.prompt == nil {
+		return nil, errorx.New(errorx.Internal, "提示词回归测试未配置")
+	}
+	cases, err := s.repo.ListCases(ctx, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	pctx := repo.WithPromptPreview(ctx)
+	versions := map[int64]int{}
+	var runs []*entity.PromptTestRun
+	for _, tc := range cases {
+		if !tc.RunOnChange {
+			continue
+		}
+		version, ok := versions[tc.TemplateID]
+		if !ok {
+			tmpl, err := s.prompt.GetPromptByID(pctx, tc.TemplateID)
+			if err != nil {
+				return runs, err
+			}
+			if tmpl != nil {
+				version = tmpl.Version
+			}
+			versions[tc.TemplateID] = version
+		}
+		if version == 0 {
+			continue
+		}
+		last, err := s.repo.LatestRun(ctx, tc.ID)
+		if err != nil {
+			return runs, err
+		}
+		if last != nil && last.TemplateVersion == version {
+			continue
+		}
+		run, err := s.runCase(ctx, tc, "", entity.PromptTestTriggerVersionChange, 0)
+		if err != nil {
+			if s.logger != nil {
+				s.logger.Warn(ctx, "执行提示词回归测试用例失败", logging.Int("case_id", int(tc.ID)), logging.Error(err))
+			}
+			continue
+		}
+		if !run.Passed && s.logger != nil {
+			s.logger.Warn(ctx, "提示词回归测试未通过",
+				logging.Int("case_id", int(tc.ID)),
+				logging.Int("template_id", int(tc.TemplateID)),
+				logging.Int("version", version))
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// runCase 执行用例并记录结果；模型调用失败记为未通过，仅在落库失败时返回错误
+func (s *promptRegressionServiceImpl) runCase(ctx context.Context, tc *entity.PromptTestCase, endpoint, trigger string, actorID int64) (*entity.PromptTestRun, error) {
+	if s.chat == nil {
+		return nil, errorx.New(errorx.Internal, "LLM chat service 未配置")
+	}
+	if endpoint == "" {
+		endpoint = tc.Endpoint
+	}
+	if trigger == "" {
+		trigger = entity.PromptTestTriggerManual
+	}
+	run := &entity.PromptTestRun{
+		CaseID:     tc.ID,
+		TemplateID: tc.TemplateID,
+		Endpoint:   endpoint,
+		Trigger:    trigger,
+	}
+
+	started := time.Now()
+	output, version, err := s.execute(ctx, tc, endpoint, actorID)
+	run.LatencyMs = time.Since(started).Milliseconds()
+	run.TemplateVersion = version
+	run.Output = output
+	if err != nil {
+		run.Error = err.Error()
+	} else {
+		run.Passed = s.judgeRun(ctx, tc, run, actorID)
+	}
+	if err := s.repo.SaveRun(ctx, run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+func (s *promptRegressionServiceImpl) execute(ctx context.Context, tc *entity.PromptTestCase, endpoint string, actorID int64) (string, int, error) {
+	vars, err := decodeTestVariables(tc.VariablesJSON)
+	if err != nil {
+		return "", 0, err
+	}
+	messages, err := decodeTestMessages(tc.MessagesJSON)
+	if err != nil {
+		return "", 0, err
+	}
+	result, err := s.chat.RunPlayground(ctx, &PlaygroundRequest{
+		UserID:     actorID,
+		TemplateID: tc.TemplateID,
+		Variables:  vars,
+		Execute:    true,
+		Endpoint:   endpoint,
+		Messages:   messages,
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	if result.Response == nil {
+		return "", result.Version, errorx.New(errorx.Internal, "模型未返回结果")
+	}
+	return result.Response.Content, result.Version, nil
+}
+
+// judgeRun 依次判定断言与裁判评分，结果写入 run.ResultJSON/JudgeScore
+func (s *promptRegressionServiceImpl) judgeRun(ctx context.Context, tc *entity.PromptTestCase, run *entity.PromptTestRun, actorID int64) bool {
+	assertions, _ := decodeTestAssertions(tc.AssertionsJSON)
+	results := make([]*PromptAssertionResult, 0, len(assertions))
+	passed := true
+	for _, a := range assertions {
+		res := checkPromptAssertion(a, run.Output)
+		passed = passed && res.Passed
+		results = append(results, res)
+	}
+
+	detail := map[string]any{"assertions": results}
+	if strings.TrimSpace(tc.JudgeRubric) != "" {
+		score, comment, err := s.judgeScore(ctx, tc.JudgeRubric, run.Output, actorID)
+		if err != nil {
+			detail["judge_error"] = err.Error()
+			passed = false
+		} else {
+			run.JudgeScore = &score
+			detail["judge_comment"] = comment
+			passed = passed && score >= tc.JudgeMinScore
+		}
+	}
+	data, _ := json.Marshal(detail)
+	run.ResultJSON = string(data)
+	return passed
+}
+
+func (s *promptRegressionServiceImpl) judgeScore(ctx context.Context, rubric, output string, actorID int64) (float64, string, error) {
+	if s.manager == nil {
+		return 0, "", errorx.New(errorx.Internal, "LLM ProviderManager 未配置")
+	}
+	resp, _, _, _, _, _, err := s.manager.ChatForUser(ctx, actorID, &client.ChatRequest{
+		System:      fmt.Sprintf(promptRegressionJudgePrompt, rubric),
+		Messages:    []client.ChatMessage{{Role: "user", Content: "[待评估的助手回答]\n" + output}},
+		Temperature: 0,
+		MaxTokens:   256,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+	result, err := parseEvalScores(resp.Content, []string{"score"})
+	if err != nil {
+		return 0, "", err
+	}
+	return result.Scores["score"], result.Comment, nil
+}
+
+// checkPromptAssertion 判定单条断言
+func checkPromptAssertion(a entity.PromptTestAssertion, output string) *PromptAssertionResult {
+	res := &PromptAssertionResult{PromptTestAssertion: a}
+	switch a.Type {
+	case entity.PromptAssertContains:
+		res.Passed = strings.Contains(output, a.Value)
+	case entity.PromptAssertNotContains:
+		res.Passed = !strings.Contains(output, a.Value)
+	case entity.PromptAssertRegex:
+		re, err := regexp.Compile(a.Value)
+		if err != nil {
+			res.Message = "正则无效"
+			return res
+		}
+		res.Passed = re.MatchString(output)
+	case entity.PromptAssertMaxLength:
+		limit, err := strconv.Atoi(a.Value)
+		if err != nil {
+			res.Message = "max_length 无效"
+			return res
+		}
+		n := len([]rune(output))
+		res.Passed = n <= limit
+		if !res.Passed {
+			res.Message = fmt.Sprintf("输出长度 %d 超过 %d", n, limit)
+		}
+	case entity.PromptAssertJSONField:
+		value, found, err := lookupJSONField(output, a.Field)
+		switch {
+		case err != nil:
+			res.Message = err.Error()
+		case !found:
+			res.Message = "缺少字段 " + a.Field
+		case a.Value != "" && fmt.Sprint(value) != a.Value:
+			res.Message = fmt.Sprintf("字段值为 %v", value)
+		default:
+			res.Passed = true
+		}
+	default:
+		res.Message = "未知断言类型"
+	}
+	return res
+}
+
+// lookupJSONField 从输出中解析 JSON 对象并按点号路径取值
+func lookupJSONField(output, field string) (any, bool, error) {
+	text, _ := trimCodeFenceProcessor{}.Process(context.Background(), output)
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end <= start {
+		return nil, false, errorx.New(errorx.Validation, "输出不是有效 JSON")
+	}
+	var cur any
+	if err := json.Unmarshal([]byte(text[start:end+1]), &cur); err != nil {
+		return nil, false, errorx.New(errorx.Validation, "输出不是有效 JSON")
+	}
+	for _, key := range strings.Split(field, ".") {
+		obj, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false, nil
+		}
+		if cur, ok = obj[key]; !ok {
+			return nil, false, nil
+		}
+	}
+	return cur, true, nil
+}
+
+func decodeTestVariables(raw string) (map[string]any, error) {
+	vars := map[string]any{}
+	if strings.TrimSpace(raw) == "" {
+		return vars, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &vars); err != nil {
+		return nil, errorx.Wrap(err, errorx.Validation, "variables 需为 JSON 对象")
+	}
+	return vars, nil
+}
+
+func decodeTestMessages(raw string) ([]Message, error) {
+	var messages []Message
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &messages); err != nil {
+		return nil, errorx.Wrap(err, errorx.Validation, "messages 需为 JSON 数组")
+	}
+	return messages, nil
+}
+
+func decodeTestAssertions(raw string) ([]entity.PromptTestAssertion, error) {
+	var assertions []entity.PromptTestAssertion
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &assertions); err != nil {
+		return nil, errorx.Wrap(err, errorx.Validation, "assertions 需为 JSON 数组")
+	}
+	for _, a := range assertions {
+		switch a.Type {
+		case entity.PromptAssertContains, entity.PromptAssertNotContains:
+		case entity.PromptAssertRegex:
+			if _, err := regexp.Compile(a.Value); err != nil {
+				return nil, errorx.Wrap(err, errorx.Validation, "regex 断言无效: "+a.Value)
+			}
+		case entity.PromptAssertMaxLength:
+			if n, err := strconv.Atoi(a.Value); err != nil || n <= 0 {
+				return nil, errorx.New(errorx.Validation, "max_length 断言需为正整数")
+			}
+		case entity.PromptAssertJSONField:
+			if strings.TrimSpace(a.Field) == "" {
+				return nil, errorx.New(errorx.Validation, "json_field 断言需指定 field")
+			}
+		default:
+			return nil, errorx.New(errorx.Validation, "未知断言类型: "+a.Type)
+		}
+	}
+	return assertions, nil
+}
@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"gochen-llm/entity"
+)
+
+type promptScopeParentsKey struct{}
+
+// WithPromptScopeChain 声明当前调用方所属的上级作用域（如用户所在项目、组织），
+// 模板解析按 user → project → org → global 回退。应由上层鉴权中间件按真实归属设置，不应取自请求参数；
+// 本模块的 HTTP 接口通过 router.SetPromptScopeResolver 注入。
+func WithPromptScopeChain(ctx context.Context, parents ...entity.PromptScopeRef) context.Context {
+	if len(parents) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, promptScopeParentsKey{}, append([]entity.PromptScopeRef(nil), parents...))
+}
+
+// promptScopeChain 生成由具体到宽泛的作用域回退链（不含全局，仓储层自动追加）：
+// 以请求作用域开头，追加 ctx 中层级更宽泛的上级作用域，每个层级仅保留第一个。
+func promptScopeChain(ctx context.Context, scope entity.PromptScope, scopeID int64) []entity.PromptScopeRef {
+	base := scope.Rank()
+	if base == 0 || scope == entity.PromptScopeGlobal {
+		return nil
+	}
+	chain := []entity.PromptScopeRef{{Scope: scope, ScopeID: scopeID}}
+	seen := map[entity.PromptScope]bool{scope: true}
+	parents, _ := ctx.Value(promptScopeParentsKey{}).([]entity.PromptScopeRef)
+	for _, ref := range parents {
+		rank := ref.Scope.Rank()
+		if rank <= base || ref.Scope == entity.PromptScopeGlobal || seen[ref.Scope] {
+			continue
+		}
+		seen[ref.Scope] = true
+		chain = append(chain, ref)
+	}
+	sort.SliceStable(chain, func(i, j int) bool {
+		return chain[i].Scope.Rank() < chain[j].Scope.Rank()
+	})
+	return chain
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"gochen-llm/entity"
+)
+
+func TestPromptScopeChain(t *testing.T) {
+	user := entity.PromptScopeRef{Scope: entity.PromptScopeUser, ScopeID: 1}
+	project := entity.PromptScopeRef{Scope: entity.PromptScopeProject, ScopeID: 2}
+	org := entity.PromptScopeRef{Scope: entity.PromptScopeOrg, ScopeID: 3}
+
+	tests := []struct {
+		name    string
+		scope   entity.PromptScope
+		scopeID int64
+		parents []entity.PromptScopeRef
+		want    []entity.PromptScopeRef
+	}{
+		{name: "global", scope: entity.PromptScopeGlobal, parents: []entity.PromptScopeRef{org}, want: nil},
+		{name: "unknown scope", scope: "team", scopeID: 7, parents: []entity.PromptScopeRef{org}, want: nil},
+		{name: "user without parents", scope: entity.PromptScopeUser, scopeID: 1, want: []entity.PromptScopeRef{user}},
+		{
+			name:    "user sorted to project then org",
+			scope:   entity.PromptScopeUser,
+			scopeID: 1,
+			parents: []entity.PromptScopeRef{org, project},
+			want:    []entity.PromptScopeRef{user, project, org},
+		},
+		{
+			name:    "narrower parents dropped",
+			scope:   entity.PromptScopeProject,
+			scopeID: 2,
+			parents: []entity.PromptScopeRef{{Scope: entity.PromptScopeUser, ScopeID: 9}, org},
+			want:    []entity.PromptScopeRef{project, org},
+		},
+		{
+			name:    "first parent per level kept",
+			scope:   entity.PromptScopeUser,
+			scopeID: 1,
+			parents: []entity.PromptScopeRef{project, {Scope: entity.PromptScopeProject, ScopeID: 5}, org},
+			want:    []entity.PromptScopeRef{user, project, org},
+		},
+		{
+			name:    "global and unknown parents ignored",
+			scope:   entity.PromptScopeUser,
+			scopeID: 1,
+			parents: []entity.PromptScopeRef{{Scope: entity.PromptScopeGlobal}, {Scope: "team", ScopeID: 4}, org},
+			want:    []entity.PromptScopeRef{user, org},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithPromptScopeChain(context.Background(), tt.parents...)
+			got := promptScopeChain(ctx, tt.scope, tt.scopeID)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("promptScopeChain() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -21,47 +21,189 @@ type PromptService interface {
 	ComposePrompts(ctx context.Context, names []string, scope entity.PromptScope, scopeID int64, vars map[string]any) (string, error)
 	SavePrompt(ctx context.Context, tmpl *entity.PromptTemplate) error
 	ListPrompts(ctx context.Context, filter repo.PromptFilter) ([]*entity.PromptTemplate, error)
+	SearchPrompts(ctx context.Context, filter repo.PromptFilter) ([]*entity.PromptTemplate, int64, error)
+	BulkSetEnabled(ctx context.Context, ids []int64, enabled bool) (*PromptBulkResult, error)
+	BulkUpdateTags(ctx context.Context, ids []int64, add, remove []string) (*PromptBulkResult, error)
+	CopyPromptsToScope(ctx context.Context, req *PromptScopeCopyRequest) (*PromptBulkResult, error)
 	CreateVersion(ctx context.Context, templateID int64, changeLog string) (*entity.PromptVersion, error)
 	RollbackVersion(ctx context.Context, templateID int64, version int) error
 	ExportPrompts(ctx context.Context, filter repo.PromptFilter) ([]byte, error)
 	ImportPrompts(ctx context.Context, data []byte) error
+	ExportPromptsYAML(ctx context.Context, filter repo.PromptFilter) (map[string][]byte, error)
+	ImportPromptsYAML(ctx context.Context, files map[string][]byte, opts PromptImportOptions) (*PromptImportReport, error)
 	StartABTest(ctx context.Context, test *entity.ABTest) error
 	GetABTestResult(ctx context.Context, testID int64) (*entity.ABTest, error)
 	AssignABVariant(ctx context.Context, testID int64, userID int64) (*entity.PromptTemplate, string, error)
+	// ValidatePrompt 校验模板并使用样例变量试渲染（不落库）
+	ValidatePrompt(ctx context.Context, tmpl *entity.PromptTemplate, sampleVars map[string]any) (*PromptValidation, error)
+	// TransitionPrompt 模板版本的草稿/审核/发布/归档状态流转，version<=0 表示最新版本（含草稿）
+	TransitionPrompt(ctx context.Context, templateID int64, version int, toStatus string, actorID int64, comment string) (*entity.PromptTemplate, error)
+	ListPromptReviews(ctx context.Context, templateID int64) ([]*entity.PromptReview, error)
+	GetPromptVersion(ctx context.Context, templateID int64, version int) (*entity.PromptVersion, error)
+	// GetPromptAtVersion 返回模板在指定历史版本时的副本（内容与变量取自版本记录），version<=0 返回当前模板
+	GetPromptAtVersion(ctx context.Context, templateID int64, version int) (*entity.PromptTemplate, error)
+	// FreezeABTest 冻结测试分配到指定变体（多臂老虎机达到置信度时自动调用）
+	FreezeABTest(ctx context.Context, testID int64, variant string) error
 }
 
 type promptServiceImpl struct {
-	repo repo.PromptTemplateRepo
+	repo    repo.PromptTemplateRepo
+	metrics repo.MetricsRepo
+	cache   *promptCache
+	bandit  *banditStatsCache
+	safety  SafetyService // 用于记录管理端变更审计，可为 nil
 }
 
-func NewPromptService(repo repo.PromptTemplateRepo) PromptService {
-	return &promptServiceImpl{repo: repo}
+func NewPromptService(repo repo.PromptTemplateRepo, metrics repo.MetricsRepo, safety SafetyService) PromptService {
+	return &promptServiceImpl{
+		repo:    repo,
+		metrics: metrics,
+		safety:  safety,
+		cache:   newPromptCache(defaultPromptCacheSize),
+		bandit:  newBanditStatsCache(),
+	}
+}
+
+// promptModelParams 解析模板 MetadataJSON 中的推荐模型参数，格式错误或越界的值忽略
+func promptModelParams(tmpl *entity.PromptTemplate) entity.PromptModelParams {
+	var params entity.PromptModelParams
+	if tmpl == nil || strings.TrimSpace(tmpl.MetadataJSON) == "" {
+		return params
+	}
+	if err := json.Unmarshal([]byte(tmpl.MetadataJSON), &params); err != nil {
+		return entity.PromptModelParams{}
+	}
+	if params.Temperature != nil && (*params.Temperature < 0 || *params.Temperature > 2) {
+		params.Temperature = nil
+	}
+	if params.MaxTokens < 0 {
+		params.MaxTokens = 0
+	}
+	return params
 }
 
+// GetPrompt 获取生效模板；ctx 通过 WithPromptLocale 指定语言区域时按 区域 → 语言 → 默认 回退
 func (s *promptServiceImpl) GetPrompt(ctx context.Context, name string, scope entity.PromptScope, scopeID int64) (*entity.PromptTemplate, error) {
-	return s.repo.FindEffective(ctx, name, scope, scopeID)
+	return s.findLocalized(ctx, name, scope, scopeID, promptLocaleFrom(ctx))
 }
 
 func (s *promptServiceImpl) GetPromptByID(ctx context.Context, id int64) (*entity.PromptTemplate, error) {
 	return s.repo.GetByID(ctx, id)
 }
 
+// RenderPrompt 渲染提示词模板。
+// 模板设置了 ParentID 时沿继承链解析：以最顶层祖先为骨架，子模板通过 {{define "name"}} 覆盖祖先中的
+// {{block "name" .}} 片段；子模板 define 之外的正文追加在骨架输出之后。
+// {{template "other_prompt" .}} 可引用其他命名模板（按当前模板作用域查找）。
 func (s *promptServiceImpl) RenderPrompt(ctx context.Context, tmpl *entity.PromptTemplate, vars map[string]any) (string, error) {
 	if tmpl == nil {
 		return "", errorx.New(errorx.InvalidInput, "模板不能为空")
 	}
-	t, err := template.New("prompt").Parse(tmpl.Content)
+	compiled, err := s.compile(ctx, tmpl)
 	if err != nil {
-		return "", errorx.Wrap(err, errorx.Internal, "解析提示词模板失败")
+		return "", err
 	}
-	var buf bytes.Buffer
+	root, names := compiled.root, compiled.names
+
 	if vars == nil {
 		vars = map[string]any{}
 	}
-	if err := t.Execute(&buf, vars); err != nil {
-		return "", errorx.Wrap(err, errorx.Internal, "渲染提示词模板失败")
+	if len(names) == 1 {
+		var buf bytes.Buffer
+		if err := root.Execute(&buf, vars); err != nil {
+			return "", errorx.Wrap(err, errorx.Internal, "渲染提示词模板失败")
+		}
+		return buf.String(), nil
 	}
-	return buf.String(), nil
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		var buf bytes.Buffer
+		if err := root.ExecuteTemplate(&buf, name, vars); err != nil {
+			return "", errorx.Wrap(err, errorx.Internal, "渲染提示词模板失败")
+		}
+		if part := strings.TrimSpace(buf.String()); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// compile 解析继承链与引用得到可执行的模板集，已保存的模板命中编译缓存时直接复用
+func (s *promptServiceImpl) compile(ctx context.Context, tmpl *entity.PromptTemplate) (*compiledPrompt, error) {
+	// 预览模式可能引入未发布的模板，不读写缓存
+	cache := s.cache
+	if repo.IsPromptPreview(ctx) {
+		cache = nil
+	}
+	if cached := cache.get(tmpl); cached != nil {
+		return cached, nil
+	}
+	chain, err := s.inheritanceChain(ctx, tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	compiled := &compiledPrompt{
+		root:    template.New("prompt").Funcs(promptFuncs),
+		names:   make([]string, len(chain)),
+		content: tmpl.Content,
+		ids:     map[int64]bool{},
+		refs:    map[string]bool{},
+	}
+	for i, item := range chain {
+		t := compiled.root
+		if i > 0 {
+			t = compiled.root.New(fmt.Sprintf("prompt_%d", i))
+		}
+		compiled.names[i] = t.Name()
+		compiled.ids[item.ID] = true
+		compiled.refs[item.Name] = true
+		if _, err := t.Parse(item.Content); err != nil {
+			return nil, errorx.Wrap(err, errorx.Internal, fmt.Sprintf("解析提示词模板失败: %s", item.Name))
+		}
+	}
+	included, err := s.resolveIncludes(ctx, compiled.root, tmpl.Scope, tmpl.ScopeID, tmpl.Locale)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range included {
+		compiled.refs[name] = true
+	}
+	cache.put(tmpl, compiled)
+	return compiled, nil
+}
+
+// maxPromptInheritanceDepth 继承链最大深度，防止配置错误导致过深的解析
+const maxPromptInheritanceDepth = 8
+
+// inheritanceChain 返回从最顶层祖先到 tmpl 的继承链，检测循环引用
+func (s *promptServiceImpl) inheritanceChain(ctx context.Context, tmpl *entity.PromptTemplate) ([]*entity.PromptTemplate, error) {
+	chain := []*entity.PromptTemplate{tmpl}
+	seen := map[int64]bool{}
+	if tmpl.ID > 0 {
+		seen[tmpl.ID] = true
+	}
+	cur := tmpl
+	for cur.ParentID != nil && *cur.ParentID > 0 {
+		if seen[*cur.ParentID] {
+			return nil, errorx.New(errorx.Validation, fmt.Sprintf("提示词模板继承存在循环: %d", *cur.ParentID))
+		}
+		if len(chain) >= maxPromptInheritanceDepth {
+			return nil, errorx.New(errorx.Validation, "提示词模板继承层级过深")
+		}
+		parent, err := s.repo.GetByID(ctx, *cur.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil {
+			return nil, errorx.New(errorx.NotFound, fmt.Sprintf("父提示词模板不存在: %d", *cur.ParentID))
+		}
+		seen[parent.ID] = true
+		chain = append([]*entity.PromptTemplate{parent}, chain...)
+		cur = parent
+	}
+	return chain, nil
 }
 
 func (s *promptServiceImpl) ComposePrompts(ctx context.Context, names []string, scope entity.PromptScope, scopeID int64, vars map[string]any) (string, error) {
@@ -102,26 +244,105 @@ func (s *promptServiceImpl) SavePrompt(ctx context.Context, tmpl *entity.PromptT
 	if tmpl.Version == 0 {
 		tmpl.Version = 1
 	}
+	tmpl.Locale = normalizeLocale(tmpl.Locale)
+	if err := checkPromptSyntax(tmpl.Content); err != nil {
+		return err
+	}
 
+	var before *entity.PromptTemplate
+	if tmpl.ID > 0 {
+		prev, err := s.repo.GetByID(ctx, tmpl.ID)
+		if err != nil {
+			return err
+		}
+		before = prev
+	}
 	if err := s.repo.Upsert(ctx, tmpl); err != nil {
 		return err
 	}
+	s.cache.invalidate(tmpl)
+	recordAdminChange(ctx, s.safety, "admin.upsert_prompt", "prompt_template", tmpl.ID, before, tmpl)
 
-	// 记录版本历史
+	// 记录版本历史；修改已发布模板时该版本（含设置）为草稿，经 TransitionPrompt 发布后才生效
+	settings, err := json.Marshal(tmpl.Settings())
+	if err != nil {
+		return errorx.Wrap(err, errorx.Internal, "序列化提示词模板设置失败")
+	}
 	version := &entity.PromptVersion{
 		TemplateID:    tmpl.ID,
 		Version:       tmpl.Version,
 		Content:       tmpl.Content,
 		VariablesJSON: tmpl.VariablesJSON,
+		Status:        tmpl.Status,
+		SettingsJSON:  string(settings),
 		CreatedAt:     time.Now(),
 	}
 	return s.repo.SaveVersion(ctx, version)
 }
 
+func (s *promptServiceImpl) GetPromptVersion(ctx context.Context, templateID int64, version int) (*entity.PromptVersion, error) {
+	if templateID <= 0 || version <= 0 {
+		return nil, errorx.New(errorx.InvalidInput, "templateID 或 version 无效")
+	}
+	return s.repo.GetVersion(ctx, templateID, version)
+}
+
+func (s *promptServiceImpl) GetPromptAtVersion(ctx context.Context, templateID int64, version int) (*entity.PromptTemplate, error) {
+	tmpl, err := s.repo.GetByID(ctx, templateID)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl == nil {
+		return nil, errorx.New(errorx.NotFound, "提示词模板不存在")
+	}
+	return s.pinVersion(ctx, tmpl, version)
+}
+
+// pinVersion 以版本记录覆盖模板内容；保留模板 ID，编译缓存按 ID+版本区分
+func (s *promptServiceImpl) pinVersion(ctx context.Context, tmpl *entity.PromptTemplate, version int) (*entity.PromptTemplate, error) {
+	if version <= 0 || version == tmpl.Version {
+		return tmpl, nil
+	}
+	v, err := s.repo.GetVersion(ctx, tmpl.ID, version)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, errorx.New(errorx.NotFound, fmt.Sprintf("提示词模板 %s 的版本 %d 不存在", tmpl.Name, version))
+	}
+	pinned := *tmpl
+	pinned.Content = v.Content
+	pinned.VariablesJSON = v.VariablesJSON
+	pinned.Version = v.Version
+	return &pinned, nil
+}
+
 func (s *promptServiceImpl) ListPrompts(ctx context.Context, filter repo.PromptFilter) ([]*entity.PromptTemplate, error) {
 	return s.repo.List(ctx, filter)
 }
 
+// SearchPrompts 分页检索模板（标签/全文/元数据），返回当前页与总数
+func (s *promptServiceImpl) SearchPrompts(ctx context.Context, filter repo.PromptFilter) ([]*entity.PromptTemplate, int64, error) {
+	if !repo.ValidPromptSort(filter.SortBy) {
+		return nil, 0, errorx.New(errorx.Validation, "不支持的排序字段: "+filter.SortBy)
+	}
+	if filter.Limit <= 0 || filter.Limit > 200 {
+		filter.Limit = 50
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	total, err := s.repo.Count(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	list, err := s.repo.List(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return list, total, nil
+}
+
 func (s *promptServiceImpl) CreateVersion(ctx context.Context, templateID int64, changeLog string) (*entity.PromptVersion, error) {
 	if templateID <= 0 {
 		return nil, errorx.New(errorx.InvalidInput, "templateID 无效")
@@ -134,26 +355,28 @@ func (s *promptServiceImpl) CreateVersion(ctx context.Context, templateID int64,
 		return nil, errorx.New(errorx.NotFound, "提示词模板不存在")
 	}
 
-	newVersion := tmpl.Version + 1
+	// 将模板版本号推进到现有版本（含草稿）之后，快照当前生效内容
+	tmpl.Version++
+	if tmpl.Status == "" {
+		tmpl.Status = entity.PromptStatusPublished
+	}
+	if err := s.repo.Upsert(ctx, tmpl); err != nil {
+		return nil, err
+	}
+	s.cache.invalidate(tmpl)
+
 	version := &entity.PromptVersion{
 		TemplateID:    tmpl.ID,
-		Version:       newVersion,
+		Version:       tmpl.Version,
 		Content:       tmpl.Content,
 		VariablesJSON: tmpl.VariablesJSON,
 		ChangeLog:     changeLog,
+		Status:        tmpl.Status,
 		CreatedAt:     time.Now(),
 	}
-
 	if err := s.repo.SaveVersion(ctx, version); err != nil {
 		return nil, err
 	}
-
-	// 将模板版本号推进，以便后续更新保持一致
-	tmpl.Version = newVersion
-	if err := s.repo.Upsert(ctx, tmpl); err != nil {
-		return nil, err
-	}
-
 	return version, nil
 }
 
@@ -178,7 +401,11 @@ func (s *promptServiceImpl) RollbackVersion(ctx context.Context, templateID int6
 		return errorx.New(errorx.NotFound, "提示词模板不存在")
 	}
 
-	// 回滚内容并创建新的版本记录，便于审计
+	// 回滚内容并创建新的版本记录，便于审计；回滚到已审核过的内容，直接生效
+	before := *tmpl
+	if tmpl.Status == "" {
+		tmpl.Status = entity.PromptStatusPublished
+	}
 	tmpl.Content = target.Content
 	tmpl.VariablesJSON = target.VariablesJSON
 	tmpl.Version = target.Version + 1
@@ -186,6 +413,8 @@ func (s *promptServiceImpl) RollbackVersion(ctx context.Context, templateID int6
 	if err := s.repo.Upsert(ctx, tmpl); err != nil {
 		return err
 	}
+	s.cache.invalidate(tmpl)
+	recordAdminChange(ctx, s.safety, "admin.rollback_prompt", "prompt_template", tmpl.ID, &before, tmpl)
 
 	rollbackVersion := &entity.PromptVersion{
 		TemplateID:    tmpl.ID,
@@ -193,6 +422,7 @@ func (s *promptServiceImpl) RollbackVersion(ctx context.Context, templateID int6
 		Content:       tmpl.Content,
 		VariablesJSON: tmpl.VariablesJSON,
 		ChangeLog:     fmt.Sprintf("rollback to version %d", version),
+		Status:        tmpl.Status,
 		CreatedAt:     time.Now(),
 	}
 	return s.repo.SaveVersion(ctx, rollbackVersion)
@@ -223,21 +453,61 @@ func (s *promptServiceImpl) StartABTest(ctx context.Context, test *entity.ABTest
 	if test == nil {
 		return errorx.New(errorx.InvalidInput, "A/B 测试不能为空")
 	}
-	if test.TemplateAID <= 0 || test.TemplateBID <= 0 {
+	if strings.TrimSpace(test.VariantsJSON) == "" && (test.TemplateAID <= 0 || test.TemplateBID <= 0) {
 		return errorx.New(errorx.Validation, "A/B 测试模板 ID 无效")
 	}
-
-	// 校验模板存在
-	if _, err := s.repo.GetByID(ctx, test.TemplateAID); err != nil {
+	variants, err := abTestVariants(test)
+	if err != nil {
 		return err
 	}
-	if _, err := s.repo.GetByID(ctx, test.TemplateBID); err != nil {
+	if err := validateABVariants(variants, test.Holdout); err != nil {
 		return err
 	}
 
+	// 校验模板存在，并将未指定版本的变体固定为当前版本，避免实验期间的模板编辑污染结果
+	for i, v := range variants {
+		tmpl, err := s.repo.GetByID(ctx, v.TemplateID)
+		if err != nil {
+			return err
+		}
+		if tmpl == nil {
+			return errorx.New(errorx.NotFound, fmt.Sprintf("变体 %s 的模板不存在", v.Key))
+		}
+		if v.Version <= 0 {
+			variants[i].Version = tmpl.Version
+		} else if _, err := s.pinVersion(ctx, tmpl, v.Version); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(variants)
+	if err != nil {
+		return errorx.Wrap(err, errorx.Internal, "序列化 A/B 测试变体失败")
+	}
+	test.VariantsJSON = string(data)
+	switch test.Mode {
+	case "":
+		test.Mode = entity.ABTestModeFixed
+	case entity.ABTestModeFixed, entity.ABTestModeThompson, entity.ABTestModeEpsilonGreedy:
+	default:
+		return errorx.New(errorx.Validation, "A/B 测试分配模式无效: "+test.Mode)
+	}
+	if test.FreezeConfidence < 0 || test.FreezeConfidence >= 1 {
+		return errorx.New(errorx.Validation, "freeze_confidence 需在 [0, 1) 之间")
+	}
+	test.FrozenVariant = ""
+	test.FrozenAt = nil
+
+	// 兼容旧字段：A/B 模板取前两个变体
+	test.TemplateAID = variants[0].TemplateID
+	test.TemplateBID = variants[1].TemplateID
+
 	test.Status = "running"
 	test.StartAt = time.Now()
-	return s.repo.SaveABTest(ctx, test)
+	if err := s.repo.SaveABTest(ctx, test); err != nil {
+		return err
+	}
+	recordAdminChange(ctx, s.safety, "admin.start_ab_test", "ab_test", test.ID, nil, test)
+	return nil
 }
 
 func (s *promptServiceImpl) GetABTestResult(ctx context.Context, testID int64) (*entity.ABTest, error) {
@@ -245,10 +515,15 @@ func (s *promptServiceImpl) GetABTestResult(ctx context.Context, testID int64) (
 	if err != nil || test == nil {
 		return test, err
 	}
+	exposures, err := s.repo.ListABExposures(ctx, testID)
+	if err != nil {
+		return nil, err
+	}
+	test.Exposures = exposures
 	return test, nil
 }
 
-// AssignABVariant 基于 TrafficSplit 分配 A/B 变体，并记录简单曝光计数
+// AssignABVariant 分配变体：留出组优先，其次冻结变体，再按模式（固定权重 / 多臂老虎机）选择，并记录曝光计数
 func (s *promptServiceImpl) AssignABVariant(ctx context.Context, testID int64, userID int64) (*entity.PromptTemplate, string, error) {
 	if testID <= 0 {
 		return nil, "", errorx.New(errorx.InvalidInput, "ab_test_id 无效")
@@ -260,51 +535,47 @@ func (s *promptServiceImpl) AssignABVariant(ctx context.Context, testID int64, u
 	if test == nil || test.Status != "running" {
 		return nil, "", errorx.New(errorx.NotFound, "A/B 测试不可用")
 	}
-
-	traffic := test.TrafficSplit
-	if traffic <= 0 || traffic >= 100 {
-		traffic = 50
+	variants, err := abTestVariants(test)
+	if err != nil {
+		return nil, "", err
 	}
-	// 简单 hash 分配，保证同一 user 稳定
-	hash := userID
-	if hash < 0 {
-		hash = -hash
+	if err := validateABVariants(variants, test.Holdout); err != nil {
+		return nil, "", err
 	}
-	slot := hash % 100
-	var chosenID int64
-	var variant string
-	if slot < int64(traffic) {
-		chosenID = test.TemplateAID
-		variant = "A"
-	} else {
-		chosenID = test.TemplateBID
-		variant = "B"
+
+	var chosen entity.ABTestVariant
+	variant := ""
+	frozen, isFrozen := findABVariant(variants, test.FrozenVariant)
+	switch {
+	case inABHoldout(test.ID, userID, test.Holdout):
+		chosen, variant = variants[0], entity.ABVariantHoldout
+	case isFrozen:
+		chosen = frozen
+	case test.Mode == entity.ABTestModeThompson || test.Mode == entity.ABTestModeEpsilonGreedy:
+		chosen, err = s.banditPick(ctx, test, variants)
+		if err != nil {
+			return nil, "", err
+		}
+	default:
+		chosen = pickWeightedVariant(userID, variants)
+	}
+	if variant == "" {
+		variant = chosen.Key
 	}
 
-	tmpl, err := s.repo.GetByID(ctx, chosenID)
+	tmpl, err := s.repo.GetByID(ctx, chosen.TemplateID)
 	if err != nil {
 		return nil, "", err
 	}
 	if tmpl == nil {
 		return nil, "", errorx.New(errorx.NotFound, "A/B 变体模板不存在")
 	}
-
-	// 记录简单曝光计数到 ResultJSON
-	var result struct {
-		TemplateAUses int `json:"template_a_uses"`
-		TemplateBUses int `json:"template_b_uses"`
-	}
-	if strings.TrimSpace(test.ResultJSON) != "" {
-		_ = json.Unmarshal([]byte(test.ResultJSON), &result)
-	}
-	if variant == "A" {
-		result.TemplateAUses++
-	} else {
-		result.TemplateBUses++
+	if tmpl, err = s.pinVersion(ctx, tmpl, chosen.Version); err != nil {
+		return nil, "", err
 	}
-	data, _ := json.Marshal(result)
-	test.ResultJSON = string(data)
-	_ = s.repo.UpdateABTest(ctx, test)
+
+	// 曝光计数走独立表的行锁自增，避免并发下对 ResultJSON 读-改-写丢失计数或覆盖冻结/结果字段
+	_ = s.repo.IncrABExposure(ctx, test.ID, variant)
 
 	return tmpl, variant, nil
 }
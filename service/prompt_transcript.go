@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+)
+
+const (
+	// maxTranscriptPromptMessages 单次转换读取的会话消息上限
+	maxTranscriptPromptMessages = 200
+	// maxTranscriptPromptRunes 生成的模板内容字符上限
+	maxTranscriptPromptRunes = 60000
+)
+
+// TranscriptPromptRequest 将会话片段转换为提示词模板的请求；模板以草稿状态保存，需经审核流程发布
+type TranscriptPromptRequest struct {
+	ConversationID int64 `json:"conversation_id"`
+	// FromMessageID/ToMessageID 片段起止消息 ID（均含），0 分别表示会话开头与最新消息
+	FromMessageID int64 `json:"from_message_id"`
+	ToMessageID   int64 `json:"to_message_id"`
+	// System 模板的系统部分；为空时使用片段内的 system 消息
+	System string `json:"system"`
+
+	Name     string             `json:"name"`
+	Scope    entity.PromptScope `json:"scope"`
+	ScopeID  int64              `json:"scope_id"`
+	Locale   string             `json:"locale"`
+	Category string             `json:"category"`
+	Tags     []string           `json:"tags"`
+}
+
+// TranscriptExample 由一轮用户消息与随后的助手回复构成的示例
+type TranscriptExample struct {
+	User      string `json:"user"`
+	Assistant string `json:"assistant"`
+}
+
+// PromptTranscriptConverter 将优质会话片段沉淀为可复用的提示词模板（系统部分 + few-shot 示例）
+type PromptTranscriptConverter interface {
+	// ConvertTranscript 读取会话片段生成模板并通过 PromptService 保存；同作用域下已有同名模板时报错
+	ConvertTranscript(ctx context.Context, req *TranscriptPromptRequest) (*entity.PromptTemplate, error)
+}
+
+type promptTranscriptConverter struct {
+	conversations ConversationService
+	prompts       PromptService
+}
+
+func NewPromptTranscriptConverter(conversations ConversationService, prompts PromptService) PromptTranscriptConverter {
+	return &promptTranscriptConverter{conversations: conversations, prompts: prompts}
+}
+
+func (c *promptTranscriptConverter) ConvertTranscript(ctx context.Context, req *TranscriptPromptRequest) (*entity.PromptTemplate, error) {
+	if req == nil || req.ConversationID <= 0 {
+		return nil, errorx.New(errorx.Validation, "conversation_id 无效")
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 200 {
+		return nil, errorx.New(errorx.Validation, "模板名称不能为空且不超过 200 个字符")
+	}
+	if req.FromMessageID < 0 || req.ToMessageID < 0 || (req.ToMessageID > 0 && req.ToMessageID < req.FromMessageID) {
+		return nil, errorx.New(errorx.Validation, "消息范围无效")
+	}
+	if req.Scope == "" {
+		req.Scope = entity.PromptScopeGlobal
+	}
+	if req.Scope.Rank() == 0 {
+		return nil, errorx.New(errorx.Validation, "不支持的作用域: "+string(req.Scope))
+	}
+
+	conv, err := c.conversations.GetConversation(ctx, req.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if conv == nil {
+		return nil, errorx.New(errorx.NotFound, "会话不存在")
+	}
+	msgs, err := c.conversations.GetMessagesAfter(ctx, conv.ID, req.FromMessageID-1, maxTranscriptPromptMessages)
+	if err != nil {
+		return nil, err
+	}
+	if req.ToMessageID > 0 {
+		end := 0
+		for end < len(msgs) && msgs[end].ID <= req.ToMessageID {
+			end++
+		}
+		msgs = msgs[:end]
+	}
+
+	system, examples := TranscriptExamples(msgs)
+	if s := strings.TrimSpace(req.System); s != "" {
+		system = s
+	}
+	if len(examples) == 0 {
+		return nil, errorx.New(errorx.Validation, "片段中没有完整的用户/助手问答")
+	}
+	content := RenderTranscriptPrompt(system, examples)
+	if len([]rune(content)) > maxTranscriptPromptRunes {
+		return nil, errorx.New(errorx.Validation, fmt.Sprintf("生成的模板超过 %d 个字符，请缩小消息范围", maxTranscriptPromptRunes))
+	}
+
+	locale := normalizeLocale(req.Locale)
+	existing, err := c.prompts.ListPrompts(ctx, repo.PromptFilter{
+		Name:    req.Name,
+		Scope:   &req.Scope,
+		ScopeID: &req.ScopeID,
+		Locale:  &locale,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) > 0 {
+		return nil, errorx.New(errorx.Validation, "同作用域下已存在同名模板: "+req.Name)
+	}
+
+	meta, _ := json.Marshal(map[string]any{
+		"source":                 "conversation",
+		"source_conversation_id": conv.ID,
+		"source_from_message_id": msgs[0].ID,
+		"source_to_message_id":   msgs[len(msgs)-1].ID,
+		"example_count":          len(examples),
+	})
+	tmpl := &entity.PromptTemplate{
+		Name:         req.Name,
+		Scope:        req.Scope,
+		ScopeID:      req.ScopeID,
+		Locale:       locale,
+		Category:     req.Category,
+		Content:      content,
+		Enabled:      true,
+		Status:       entity.PromptStatusDraft,
+		MetadataJSON: string(meta),
+	}
+	if len(req.Tags) > 0 {
+		tags, _ := json.Marshal(req.Tags)
+		tmpl.TagsJSON = string(tags)
+	}
+	if err := c.prompts.SavePrompt(ctx, tmpl); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// TranscriptExamples 从按时间正序的消息中提取系统部分与示例：每条用户消息与其后连续的助手回复构成一个示例，
+// 没有回复的用户消息与片段开头的助手消息被丢弃；多条 system 消息按顺序合并
+func TranscriptExamples(msgs []*entity.Message) (string, []TranscriptExample) {
+	var system string
+	var examples []TranscriptExample
+	var current *TranscriptExample
+	flush := func() {
+		if current != nil && current.Assistant != "" {
+			examples = append(examples, *current)
+		}
+		current = nil
+	}
+	for _, m := range msgs {
+		content := strings.TrimSpace(m.Content)
+		if content == "" {
+			continue
+		}
+		switch m.Role {
+		case "system":
+			system = joinNonEmpty(system, content)
+		case "user":
+			flush()
+			current = &TranscriptExample{User: content}
+		case "assistant":
+			if current != nil {
+				current.Assistant = joinNonEmpty(current.Assistant, content)
+			}
+		}
+	}
+	flush()
+	return system, examples
+}
+
+// RenderTranscriptPrompt 渲染模板内容；会话文本中的模板定界符会被转义，保证按原文输出
+func RenderTranscriptPrompt(system string, examples []TranscriptExample) string {
+	var sb strings.Builder
+	if system != "" {
+		sb.WriteString(escapeTemplateText(system))
+		sb.WriteString("\n\n")
+	}
+	sb.WriteString("以下是示例对话，请参考其中的风格与回答方式：\n")
+	for i, ex := range examples {
+		sb.WriteString(fmt.Sprintf("\n<example index=\"%d\">\n", i+1))
+		sb.WriteString("<user>\n" + escapeTemplateText(ex.User) + "\n</user>\n")
+		sb.WriteString("<assistant>\n" + escapeTemplateText(ex.Assistant) + "\n</assistant>\n")
+		sb.WriteString("</example>\n")
+	}
+	return sb.String()
+}
+
+// escapeTemplateText 将 {{ 与 }} 改写为输出字面量的模板动作
+func escapeTemplateText(s string) string {
+	return strings.NewReplacer("{{", `{{"{{"}}`, "}}", `{{"}}"}}`).Replace(s)
+}
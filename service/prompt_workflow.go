@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+// promptTransitions 允许的状态流转：草稿 -> 审核 -> 发布 -> 归档，审核可驳回为草稿，归档可重新起草
+var promptTransitions = map[string][]string{
+	entity.PromptStatusDraft:     {entity.PromptStatusInReview, entity.PromptStatusArchived},
+	entity.PromptStatusInReview:  {entity.PromptStatusDraft, entity.PromptStatusPublished},
+	entity.PromptStatusPublished: {entity.PromptStatusDraft, entity.PromptStatusArchived},
+	entity.PromptStatusArchived:  {entity.PromptStatusDraft},
+}
+
+func canTransitPrompt(from, to string) bool {
+	for _, s := range promptTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionPrompt 变更模板某一版本的发布状态并记录流转。
+// 发布版本时将其内容替换为模板的生效内容，并记录审核人与时间；在此之前模板继续使用上一个发布的版本。
+// 变更当前生效版本的状态（驳回为草稿或归档）时模板随之停止生效。返回该版本对应的模板副本
+func (s *promptServiceImpl) TransitionPrompt(ctx context.Context, templateID int64, version int, toStatus string, actorID int64, comment string) (*entity.PromptTemplate, error) {
+	if templateID <= 0 {
+		return nil, errorx.New(errorx.InvalidInput, "templateID 无效")
+	}
+	if _, ok := promptTransitions[toStatus]; !ok {
+		return nil, errorx.New(errorx.Validation, fmt.Sprintf("未知的提示词状态: %s", toStatus))
+	}
+	tmpl, err := s.repo.GetByID(ctx, templateID)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl == nil {
+		return nil, errorx.New(errorx.NotFound, "提示词模板不存在")
+	}
+	var v *entity.PromptVersion
+	if version > 0 {
+		v, err = s.repo.GetVersion(ctx, tmpl.ID, version)
+	} else {
+		v, err = s.repo.GetLatestVersion(ctx, tmpl.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, errorx.New(errorx.NotFound, fmt.Sprintf("提示词模板 %s 的版本 %d 不存在", tmpl.Name, version))
+	}
+	from := v.Status
+	if from == "" {
+		from = entity.PromptStatusPublished
+	}
+	if !canTransitPrompt(from, toStatus) {
+		return nil, errorx.New(errorx.Validation, fmt.Sprintf("不允许从 %s 流转到 %s", from, toStatus))
+	}
+
+	before := *tmpl
+	serving := v.Version == tmpl.Version
+	if toStatus == entity.PromptStatusPublished {
+		if err := checkPromptSyntax(v.Content); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		if err := s.repo.PublishVersion(ctx, v, actorID, now); err != nil {
+			return nil, err
+		}
+		tmpl.Content, tmpl.VariablesJSON, tmpl.Version = v.Content, v.VariablesJSON, v.Version
+		tmpl.Status, tmpl.ApprovedBy, tmpl.ApprovedAt = toStatus, &actorID, &now
+		if err := applyVersionSettings(tmpl, v); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := s.repo.UpdateVersionStatus(ctx, tmpl.ID, v.Version, toStatus, nil, nil); err != nil {
+			return nil, err
+		}
+		if serving {
+			if err := s.repo.UpdateStatus(ctx, tmpl.ID, toStatus, nil, nil); err != nil {
+				return nil, err
+			}
+			tmpl.Status = toStatus
+		}
+	}
+	if toStatus == entity.PromptStatusPublished || serving {
+		s.cache.invalidate(&before)
+		recordAdminChange(ctx, s.safety, "admin.transition_prompt", "prompt_template", tmpl.ID, &before, tmpl)
+	}
+
+	if err := s.repo.SaveReview(ctx, &entity.PromptReview{
+		TemplateID: tmpl.ID,
+		Version:    v.Version,
+		FromStatus: from,
+		ToStatus:   toStatus,
+		ActorID:    actorID,
+		Comment:    comment,
+		CreatedAt:  time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+	if tmpl.Version == v.Version {
+		return tmpl, nil
+	}
+	pinned := *tmpl
+	pinned.Content, pinned.VariablesJSON, pinned.Version, pinned.Status = v.Content, v.VariablesJSON, v.Version, toStatus
+	if err := applyVersionSettings(&pinned, v); err != nil {
+		return nil, err
+	}
+	return &pinned, nil
+}
+
+// applyVersionSettings 将版本暂存的设置覆盖到模板副本上；历史版本未暂存设置时保持不变
+func applyVersionSettings(tmpl *entity.PromptTemplate, v *entity.PromptVersion) error {
+	if v.SettingsJSON == "" {
+		return nil
+	}
+	var settings entity.PromptSettings
+	if err := json.Unmarshal([]byte(v.SettingsJSON), &settings); err != nil {
+		return errorx.Wrap(err, errorx.Validation, "解析提示词版本设置失败")
+	}
+	tmpl.ApplySettings(settings)
+	return nil
+}
+
+func (s *promptServiceImpl) ListPromptReviews(ctx context.Context, templateID int64) ([]*entity.PromptReview, error) {
+	if templateID <= 0 {
+		return nil, errorx.New(errorx.InvalidInput, "templateID 无效")
+	}
+	return s.repo.ListReviews(ctx, templateID)
+}
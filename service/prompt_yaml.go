@@ -0,0 +1,323 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+	"gopkg.in/yaml.v3"
+)
+
+// PromptFile 单个模板的 YAML 文件结构，一个文件对应一个模板，便于放入 Git 做代码评审。
+// ParentID 与数据库 ID 强绑定，不参与导入导出。
+type PromptFile struct {
+	Name      string             `yaml:"name"`
+	Scope     entity.PromptScope `yaml:"scope"`
+	ScopeID   int64              `yaml:"scope_id,omitempty"`
+	Locale    string             `yaml:"locale,omitempty"`
+	Category  string             `yaml:"category"`
+	Priority  int                `yaml:"priority,omitempty"`
+	Enabled   bool               `yaml:"enabled"`
+	Version   int                `yaml:"version"` // 导出时的版本号，导入时用于冲突检测
+	Tags      []string           `yaml:"tags,omitempty"`
+	Variables any                `yaml:"variables,omitempty"`
+	Metadata  any                `yaml:"metadata,omitempty"`
+	Content   string             `yaml:"content"`
+}
+
+// PromptImportOptions 导入选项
+type PromptImportOptions struct {
+	DryRun bool `json:"dry_run"` // 仅计算结果，不落库
+	Force  bool `json:"force"`   // 数据库版本比文件更新时仍然覆盖
+}
+
+// 导入结果动作
+const (
+	PromptImportCreated  = "created"
+	PromptImportUpdated  = "updated"
+	PromptImportSkipped  = "skipped"
+	PromptImportConflict = "conflict"
+	PromptImportError    = "error"
+)
+
+// PromptImportItem 单个文件的导入结果
+type PromptImportItem struct {
+	Path       string             `json:"path"`
+	Name       string             `json:"name,omitempty"`
+	Scope      entity.PromptScope `json:"scope,omitempty"`
+	ScopeID    int64              `json:"scope_id,omitempty"`
+	Action     string             `json:"action"`
+	Message    string             `json:"message,omitempty"`
+	TemplateID int64              `json:"template_id,omitempty"`
+	Version    int                `json:"version,omitempty"`
+}
+
+// PromptImportReport 导入汇总
+type PromptImportReport struct {
+	DryRun   bool                `json:"dry_run"`
+	Created  int                 `json:"created"`
+	Updated  int                 `json:"updated"`
+	Skipped  int                 `json:"skipped"`
+	Conflict int                 `json:"conflict"`
+	Errors   int                 `json:"errors"`
+	Items    []*PromptImportItem `json:"items"`
+}
+
+var promptFileNameSanitizer = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// promptFilePath 目录布局：<scope>/<name>.yaml（全局），<scope>/<scope_id>/<name>.yaml（其他作用域）；
+// 本地化变体为 <name>.<locale>.yaml
+func promptFilePath(tmpl *entity.PromptTemplate) string {
+	name := promptFileNameSanitizer.ReplaceAllString(tmpl.Name, "_")
+	if tmpl.Locale != "" {
+		name += "." + promptFileNameSanitizer.ReplaceAllString(tmpl.Locale, "_")
+	}
+	scope := string(tmpl.Scope)
+	if scope == "" {
+		scope = string(entity.PromptScopeGlobal)
+	}
+	if tmpl.Scope == entity.PromptScopeGlobal || tmpl.Scope == "" {
+		return path.Join(scope, name+".yaml")
+	}
+	return path.Join(scope, strconv.FormatInt(tmpl.ScopeID, 10), name+".yaml")
+}
+
+func toPromptFile(tmpl *entity.PromptTemplate) *PromptFile {
+	f := &PromptFile{
+		Name:     tmpl.Name,
+		Scope:    tmpl.Scope,
+		ScopeID:  tmpl.ScopeID,
+		Locale:   tmpl.Locale,
+		Category: tmpl.Category,
+		Priority: tmpl.Priority,
+		Enabled:  tmpl.Enabled,
+		Version:  tmpl.Version,
+		Content:  tmpl.Content,
+	}
+	if strings.TrimSpace(tmpl.TagsJSON) != "" {
+		_ = json.Unmarshal([]byte(tmpl.TagsJSON), &f.Tags)
+	}
+	if strings.TrimSpace(tmpl.VariablesJSON) != "" {
+		_ = json.Unmarshal([]byte(tmpl.VariablesJSON), &f.Variables)
+	}
+	if strings.TrimSpace(tmpl.MetadataJSON) != "" {
+		_ = json.Unmarshal([]byte(tmpl.MetadataJSON), &f.Metadata)
+	}
+	return f
+}
+
+// fromPromptFile 转换为模板实体；Variables/Metadata 重新编码为 JSON 存储
+func fromPromptFile(f *PromptFile) (*entity.PromptTemplate, error) {
+	if strings.TrimSpace(f.Name) == "" {
+		return nil, errorx.New(errorx.Validation, "name 不能为空")
+	}
+	if strings.TrimSpace(f.Content) == "" {
+		return nil, errorx.New(errorx.Validation, "content 不能为空")
+	}
+	tmpl := &entity.PromptTemplate{
+		Name:     f.Name,
+		Scope:    f.Scope,
+		ScopeID:  f.ScopeID,
+		Locale:   normalizeLocale(f.Locale),
+		Category: f.Category,
+		Priority: f.Priority,
+		Enabled:  f.Enabled,
+		Version:  f.Version,
+		Content:  f.Content,
+	}
+	if tmpl.Scope == "" {
+		tmpl.Scope = entity.PromptScopeGlobal
+	}
+	if tmpl.Category == "" {
+		tmpl.Category = "system"
+	}
+	if tmpl.Priority == 0 {
+		tmpl.Priority = 100
+	}
+	encode := func(v any) (string, error) {
+		if v == nil {
+			return "", nil
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return "", errorx.Wrap(err, errorx.Validation, "YAML 字段无法转换为 JSON")
+		}
+		return string(data), nil
+	}
+	var err error
+	if len(f.Tags) > 0 {
+		if tmpl.TagsJSON, err = encode(f.Tags); err != nil {
+			return nil, err
+		}
+	}
+	if tmpl.VariablesJSON, err = encode(f.Variables); err != nil {
+		return nil, err
+	}
+	if tmpl.MetadataJSON, err = encode(f.Metadata); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// ExportPromptsYAML 按目录布局导出，返回 相对路径 -> YAML 内容
+func (s *promptServiceImpl) ExportPromptsYAML(ctx context.Context, filter repo.PromptFilter) (map[string][]byte, error) {
+	list, err := s.ListPrompts(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte, len(list))
+	for _, tmpl := range list {
+		p := promptFilePath(tmpl)
+		if _, dup := files[p]; dup {
+			p = strings.TrimSuffix(p, ".yaml") + fmt.Sprintf("-%d.yaml", tmpl.ID)
+		}
+		data, err := yaml.Marshal(toPromptFile(tmpl))
+		if err != nil {
+			return nil, errorx.Wrap(err, errorx.Internal, "序列化提示词模板失败: "+tmpl.Name)
+		}
+		files[p] = data
+	}
+	return files, nil
+}
+
+// ImportPromptsYAML 逐个文件导入并报告 created/updated/skipped/conflict；
+// 数据库中的版本高于文件记录的版本（文件导出后库中又有修改）时视为冲突，除非 Force。
+func (s *promptServiceImpl) ImportPromptsYAML(ctx context.Context, files map[string][]byte, opts PromptImportOptions) (*PromptImportReport, error) {
+	report := &PromptImportReport{DryRun: opts.DryRun}
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		ext := strings.ToLower(path.Ext(p))
+		if ext == ".yaml" || ext == ".yml" {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, p := range paths {
+		item := s.importPromptFile(ctx, p, files[p], opts)
+		switch item.Action {
+		case PromptImportCreated:
+			report.Created++
+		case PromptImportUpdated:
+			report.Updated++
+		case PromptImportSkipped:
+			report.Skipped++
+		case PromptImportConflict:
+			report.Conflict++
+		default:
+			report.Errors++
+		}
+		report.Items = append(report.Items, item)
+	}
+	return report, nil
+}
+
+func (s *promptServiceImpl) importPromptFile(ctx context.Context, p string, data []byte, opts PromptImportOptions) *PromptImportItem {
+	item := &PromptImportItem{Path: p}
+	fail := func(err error) *PromptImportItem {
+		item.Action = PromptImportError
+		item.Message = err.Error()
+		return item
+	}
+
+	var f PromptFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return fail(errorx.Wrap(err, errorx.InvalidInput, "解析 YAML 失败"))
+	}
+	incoming, err := fromPromptFile(&f)
+	if err != nil {
+		return fail(err)
+	}
+	item.Name, item.Scope, item.ScopeID = incoming.Name, incoming.Scope, incoming.ScopeID
+	if err := checkPromptSyntax(incoming.Content); err != nil {
+		return fail(err)
+	}
+
+	scope, scopeID, locale := incoming.Scope, incoming.ScopeID, incoming.Locale
+	existingList, err := s.repo.List(ctx, repo.PromptFilter{Name: incoming.Name, Scope: &scope, ScopeID: &scopeID, Locale: &locale})
+	if err != nil {
+		return fail(err)
+	}
+
+	if len(existingList) == 0 {
+		item.Action = PromptImportCreated
+		if incoming.Version <= 0 {
+			incoming.Version = 1
+		}
+		item.Version = incoming.Version
+		if opts.DryRun {
+			return item
+		}
+		if err := s.SavePrompt(ctx, incoming); err != nil {
+			return fail(err)
+		}
+		item.TemplateID = incoming.ID
+		return item
+	}
+
+	existing := existingList[0]
+	item.TemplateID = existing.ID
+	item.Version = existing.Version
+	if samePromptDefinition(existing, incoming) {
+		item.Action = PromptImportSkipped
+		item.Message = "内容未变化"
+		return item
+	}
+	if !opts.Force && incoming.Version > 0 && existing.Version > incoming.Version {
+		item.Action = PromptImportConflict
+		item.Message = fmt.Sprintf("数据库版本 %d 高于文件版本 %d", existing.Version, incoming.Version)
+		return item
+	}
+
+	updated := *existing
+	updated.Category = incoming.Category
+	updated.Priority = incoming.Priority
+	updated.Enabled = incoming.Enabled
+	updated.Content = incoming.Content
+	updated.VariablesJSON = incoming.VariablesJSON
+	updated.MetadataJSON = incoming.MetadataJSON
+	updated.TagsJSON = incoming.TagsJSON
+	updated.Version = existing.Version + 1
+	updated.Status = ""
+	item.Action = PromptImportUpdated
+	item.Version = updated.Version
+	if opts.DryRun {
+		return item
+	}
+	if err := s.SavePrompt(ctx, &updated); err != nil {
+		return fail(err)
+	}
+	return item
+}
+
+// samePromptDefinition 比较可导入字段；JSON 字段按解析后的值比较，忽略格式差异
+func samePromptDefinition(a, b *entity.PromptTemplate) bool {
+	return a.Category == b.Category &&
+		a.Priority == b.Priority &&
+		a.Enabled == b.Enabled &&
+		a.Content == b.Content &&
+		sameJSON(a.VariablesJSON, b.VariablesJSON) &&
+		sameJSON(a.MetadataJSON, b.MetadataJSON) &&
+		sameJSON(a.TagsJSON, b.TagsJSON)
+}
+
+func sameJSON(a, b string) bool {
+	if strings.TrimSpace(a) == "" || strings.TrimSpace(b) == "" {
+		return strings.TrimSpace(a) == strings.TrimSpace(b)
+	}
+	var va, vb any
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return a == b
+	}
+	ca, _ := json.Marshal(va)
+	cb, _ := json.Marshal(vb)
+	return string(ca) == string(cb)
+}
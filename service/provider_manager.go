@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"net/url"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -171,9 +172,22 @@ func (m *providerManagerImpl) ChatForUser(ctx context.Context, userID int64, req
 	}
 
 	now := time.Now()
-	candidates := m.selectCandidates(eps, now)
-	if len(candidates) == 0 {
-		candidates = m.selectAllByMinPriority(eps)
+	var candidates []int
+	if name := pinnedEndpointFromContext(ctx); name != "" {
+		candidates = m.selectByName(eps, name)
+		if len(candidates) == 0 {
+			return nil, "", "", 0, 0, 0, errorx.New(errorx.NotFound, fmt.Sprintf("指定的 LLM 端点不存在: %s", name))
+		}
+	} else {
+		candidates = m.selectCandidates(eps, now)
+		if tag := preferredEndpointFromContext(ctx); tag != "" {
+			if preferred := m.selectPreferred(eps, tag, now); len(preferred) > 0 {
+				candidates = preferred
+			}
+		}
+		if len(candidates) == 0 {
+			candidates = m.selectAllByMinPriority(eps)
+		}
 	}
 	if len(candidates) == 0 {
 		return nil, "", "", 0, 0, 0, errorx.New(errorx.Internal, "没有可用的 LLM 端点")
@@ -233,6 +247,7 @@ func (m *providerManagerImpl) ChatForUser(ctx context.Context, userID int64, req
 			} else {
 				atomic.StoreUint32(&ep.healthFailedStreak, 0)
 			}
+			recordCallEndpoint(ctx, ep.cfg)
 			return resp, ep.cfg.Provider, ep.cfg.Model, latency, ep.cfg.InputPricePer1k, ep.cfg.OutputPricePer1k, nil
 		}
 
@@ -248,6 +263,7 @@ func (m *providerManagerImpl) ChatForUser(ctx context.Context, userID int64, req
 		if firstErr == nil {
 			firstErr = err
 		}
+		recordCallFailure(ctx, ep.cfg)
 
 		base := ep.cfg.CooldownSeconds
 		if base <= 0 {
@@ -570,6 +586,8 @@ type EndpointStatus struct {
 	RateTokensRemaining   float64            `json:"rate_tokens_remaining"`
 	RateBucketCapacity    float64            `json:"rate_bucket_capacity"`
 	RateRefillPerSec      float64            `json:"rate_refill_per_sec"`
+	// MetricsQuery 查询该端点历史指标的参数（如 endpoint=xxx），可直接追加到 /admin/llm/metrics 下的接口
+	MetricsQuery string `json:"metrics_query"`
 }
 
 type HealthSampleView struct {
@@ -690,6 +708,7 @@ func (m *providerManagerImpl) ListStatus(ctx context.Context) ([]*EndpointStatus
 			RateTokensRemaining:   rateTokens,
 			RateBucketCapacity:    rateCapacity,
 			RateRefillPerSec:      rateRefillPerSec,
+			MetricsQuery:          url.Values{"endpoint": {cfg.Name}}.Encode(),
 		}
 
 		if lastErrAt > 0 {
@@ -842,6 +861,129 @@ func (m *providerManagerImpl) selectCandidates(eps []*endpointState, now time.Ti
 	return candidates
 }
 
+type pinnedEndpointKey struct{}
+
+// WithPinnedEndpoint 指定本次调用只使用名称为 name 的端点（不做故障切换）
+func WithPinnedEndpoint(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, pinnedEndpointKey{}, name)
+}
+
+func pinnedEndpointFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(pinnedEndpointKey{}).(string)
+	return name
+}
+
+type preferredEndpointKey struct{}
+
+// WithPreferredEndpoint 优先使用名称或模型名为 tag 的端点；这些端点均不可用时按常规路由
+func WithPreferredEndpoint(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, preferredEndpointKey{}, tag)
+}
+
+func preferredEndpointFromContext(ctx context.Context) string {
+	tag, _ := ctx.Value(preferredEndpointKey{}).(string)
+	return tag
+}
+
+type callEndpointKey struct{}
+
+// callEndpoint 一次 ChatForUser 调用所使用的端点
+type callEndpoint struct {
+	Name     string
+	Provider string
+	Model    string
+	// Failovers 调用过程中失败后转移到其他端点的次数
+	Failovers int
+}
+
+// callEndpointSink 收集 ChatForUser 成功使用的端点，全部失败时为首个失败的端点
+type callEndpointSink struct {
+	mu        sync.Mutex
+	endpoint  *callEndpoint
+	failures  int
+	succeeded bool
+}
+
+func (s *callEndpointSink) set(cfg *entity.ProviderConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.endpoint = &callEndpoint{Name: cfg.Name, Provider: cfg.Provider, Model: cfg.Model}
+	s.succeeded = true
+}
+
+func (s *callEndpointSink) fail(cfg *entity.ProviderConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.endpoint == nil {
+		s.endpoint = &callEndpoint{Name: cfg.Name, Provider: cfg.Provider, Model: cfg.Model}
+	}
+	s.failures++
+}
+
+// take 取出并清空端点；ctx 内的嵌套调用（如裁判模型）也会写入，须在主调用返回后立即读取
+func (s *callEndpointSink) take() *callEndpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ep := s.endpoint
+	failures, succeeded := s.failures, s.succeeded
+	s.endpoint, s.failures, s.succeeded = nil, 0, false
+	if ep == nil {
+		return &callEndpoint{}
+	}
+	// 全部失败时最后一次失败之后没有再转移
+	if !succeeded && failures > 0 {
+		failures--
+	}
+	ep.Failovers = failures
+	return ep
+}
+
+// withCallEndpointSink 在 ctx 中挂载端点收集器
+func withCallEndpointSink(ctx context.Context) (context.Context, *callEndpointSink) {
+	sink := &callEndpointSink{}
+	return context.WithValue(ctx, callEndpointKey{}, sink), sink
+}
+
+func recordCallEndpoint(ctx context.Context, cfg *entity.ProviderConfig) {
+	if sink, ok := ctx.Value(callEndpointKey{}).(*callEndpointSink); ok {
+		sink.set(cfg)
+	}
+}
+
+func recordCallFailure(ctx context.Context, cfg *entity.ProviderConfig) {
+	if sink, ok := ctx.Value(callEndpointKey{}).(*callEndpointSink); ok {
+		sink.fail(cfg)
+	}
+}
+
+// selectPreferred 选出名称或模型名匹配 tag、且未熔断/冷却的端点，忽略优先级
+func (m *providerManagerImpl) selectPreferred(eps []*endpointState, tag string, now time.Time) []int {
+	var candidates []int
+	for i, ep := range eps {
+		if ep == nil || ep.cfg == nil || (ep.cfg.Name != tag && ep.cfg.Model != tag) {
+			continue
+		}
+		if atomic.LoadUint32(&ep.inCircuitOpen) == 1 {
+			continue
+		}
+		if cd := atomic.LoadInt64(&ep.cooldownUntil); cd > 0 && now.Before(time.Unix(0, cd)) {
+			continue
+		}
+		candidates = append(candidates, i)
+	}
+	return candidates
+}
+
+// selectByName 按端点名称选择（忽略优先级与冷却，由调用方显式指定）。
+func (m *providerManagerImpl) selectByName(eps []*endpointState, name string) []int {
+	for i, ep := range eps {
+		if ep != nil && ep.cfg != nil && ep.cfg.Name == name {
+			return []int{i}
+		}
+	}
+	return nil
+}
+
 // selectAllByMinPriority 忽略冷却，选出优先级最高的一批端点。
 func (m *providerManagerImpl) selectAllByMinPriority(eps []*endpointState) []int {
 	if len(eps) == 0 {
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+
+	"gochen/errorx"
+	"gochen/policy/ratelimit"
+)
+
+// RateLimitBackend 用户请求频率的判定后端。默认为进程内令牌桶，
+// 多实例部署时应通过 SetRateLimitBackend 切换为共享存储（如 Redis），否则总 QPS 随实例数放大。
+type RateLimitBackend interface {
+	// Allow 消耗 key 的一次额度：每分钟补充 perMinute 次，桶容量为 perMinute+burst；返回是否放行及建议的重试秒数
+	Allow(ctx context.Context, key string, perMinute, burst int) (bool, int, error)
+	// Shared 是否跨实例共享；共享后端生效时数据库限流窗口仅用于审计统计
+	Shared() bool
+}
+
+// localRateLimitBackend 进程内令牌桶，按 (perMinute, burst) 组合复用限流器
+type localRateLimitBackend struct {
+	mu       sync.Mutex
+	limiters map[string]*ratelimit.Limiter
+}
+
+func newLocalRateLimitBackend() *localRateLimitBackend {
+	return &localRateLimitBackend{limiters: map[string]*ratelimit.Limiter{}}
+}
+
+func (b *localRateLimitBackend) Allow(ctx context.Context, key string, perMinute, burst int) (bool, int, error) {
+	if perMinute <= 0 {
+		return true, 0, nil
+	}
+	cfgKey := fmt.Sprintf("%d/%d", perMinute, burst)
+	b.mu.Lock()
+	l, ok := b.limiters[cfgKey]
+	if !ok {
+		l = newUserRateLimiter(perMinute, burst)
+		b.limiters[cfgKey] = l
+	}
+	b.mu.Unlock()
+
+	if l.Allow(key) {
+		return true, 0, nil
+	}
+	return false, estimateRetryAfter(perMinute), nil
+}
+
+func (b *localRateLimitBackend) Shared() bool { return false }
+
+// RedisEvaler 执行 Lua 脚本的最小 Redis 客户端接口，由上层用所选客户端适配（如 go-redis 的 Eval(...).Result()）
+type RedisEvaler interface {
+	Eval(ctx context.Context, script string, keys []string, args ...any) (any, error)
+}
+
+// redisTokenBucketScript 原子令牌桶：以 Redis 服务端时间计算补充量，返回 {是否放行, 需等待毫秒数}
+const redisTokenBucketScript = `
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1]) or capacity
+local ts = tonumber(data[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed, wait = 0, 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  wait = math.ceil((1 - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate) + 1000)
+return {allowed, wait}
+`
+
+// redisRateLimitBackend 基于 Redis 的共享令牌桶
+type redisRateLimitBackend struct {
+	client RedisEvaler
+	prefix string
+}
+
+// NewRedisRateLimitBackend 创建 Redis 令牌桶后端；prefix 为空时使用 "llm:ratelimit:"
+func NewRedisRateLimitBackend(client RedisEvaler, prefix string) RateLimitBackend {
+	if prefix == "" {
+		prefix = "llm:ratelimit:"
+	}
+	return &redisRateLimitBackend{client: client, prefix: prefix}
+}
+
+func (b *redisRateLimitBackend) Allow(ctx context.Context, key string, perMinute, burst int) (bool, int, error) {
+	if perMinute <= 0 {
+		return true, 0, nil
+	}
+	capacity := perMinute + burst
+	ratePerMs := float64(perMinute) / 60000.0
+	// 配置参与键名，等级额度调整后使用新桶
+	redisKey := b.prefix + strconv.Itoa(perMinute) + "/" + strconv.Itoa(burst) + ":" + key
+	res, err := b.client.Eval(ctx, redisTokenBucketScript, []string{redisKey}, capacity, strconv.FormatFloat(ratePerMs, 'f', -1, 64))
+	if err != nil {
+		return false, 0, errorx.Wrap(err, errorx.Internal, "Redis 限流脚本执行失败")
+	}
+	values, ok := res.([]any)
+	if !ok || len(values) != 2 {
+		return false, 0, errorx.New(errorx.Internal, fmt.Sprintf("Redis 限流脚本返回值无效: %v", res))
+	}
+	allowed, _ := values[0].(int64)
+	waitMs, _ := values[1].(int64)
+	if allowed == 1 {
+		return true, 0, nil
+	}
+	return false, int(math.Max(1, math.Ceil(float64(waitMs)/1000))), nil
+}
+
+func (b *redisRateLimitBackend) Shared() bool { return true }
+
+// RateLimitedError 限流拒绝的结构化错误，携带重试时间与生效额度，路由层据此返回 429 与 Retry-After；
+// 底层仍为 Validation 错误，按错误码分类的调用方不受影响
+type RateLimitedError struct {
+	Reason     string `json:"reason"`                // rate_limited / token_limited / cooldown
+	RetryAfter int    `json:"retry_after,omitempty"` // 建议的重试秒数
+	Tier       string `json:"tier,omitempty"`
+	PerMinute  int    `json:"per_minute,omitempty"`
+	Burst      int    `json:"burst,omitempty"`
+	TokenLimit int    `json:"token_limit,omitempty"`
+
+	cause error
+}
+
+func newRateLimitedError(reason string, retryAfter int, msg string) *RateLimitedError {
+	return &RateLimitedError{Reason: reason, RetryAfter: retryAfter, cause: errorx.New(errorx.Validation, msg)}
+}
+
+func (e *RateLimitedError) Error() string { return e.cause.Error() }
+
+func (e *RateLimitedError) Unwrap() error { return e.cause }
+
+// AsRateLimited 从错误链中提取 RateLimitedError
+func AsRateLimited(err error) (*RateLimitedError, bool) {
+	var rl *RateLimitedError
+	if errors.As(err, &rl) {
+		return rl, true
+	}
+	return nil, false
+}
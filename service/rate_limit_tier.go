@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/clock"
+	"gochen/errorx"
+	"gochen/logging"
+	"gochen/policy/ratelimit"
+)
+
+// RateLimitTierResolver 由上层按用户身份（如订阅套餐、角色）返回限流等级名称；返回空字符串时回退到等级分配表
+type RateLimitTierResolver func(ctx context.Context, userID int64) (string, error)
+
+// builtinRateLimitTiers 未在数据库中配置时使用的内置等级；admin 不限制请求频率
+var builtinRateLimitTiers = map[string]entity.RateLimitTier{
+	entity.RateLimitTierFree:  {Name: entity.RateLimitTierFree, Description: "默认等级", PerMinute: 60, Burst: 30},
+	entity.RateLimitTierPro:   {Name: entity.RateLimitTierPro, Description: "付费等级", PerMinute: 300, Burst: 100},
+	entity.RateLimitTierAdmin: {Name: entity.RateLimitTierAdmin, Description: "管理员，不限流"},
+}
+
+// rateLimitTierCacheTTL 等级配置的缓存时间，管理端修改后立即失效
+const rateLimitTierCacheTTL = 30 * time.Second
+
+// ValidateRateLimitTier 校验等级配置
+func ValidateRateLimitTier(tier *entity.RateLimitTier) error {
+	if tier == nil || tier.Name == "" {
+		return errorx.New(errorx.Validation, "限流等级名称不能为空")
+	}
+	if tier.PerMinute < 0 || tier.Burst < 0 || tier.TokensPerMinute < 0 {
+		return errorx.New(errorx.Validation, "限流等级的额度不能为负数")
+	}
+	return nil
+}
+
+func (s *safetyServiceImpl) SetRateLimitTierResolver(resolver RateLimitTierResolver) {
+	s.tiersMu.Lock()
+	defer s.tiersMu.Unlock()
+	s.tierResolver = resolver
+}
+
+func (s *safetyServiceImpl) ListRateLimitTiers(ctx context.Context) ([]*entity.RateLimitTier, error) {
+	tiers, err := s.rateLimitTiers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*entity.RateLimitTier, 0, len(tiers))
+	for _, t := range tiers {
+		t := t
+		list = append(list, &t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (s *safetyServiceImpl) SaveRateLimitTier(ctx context.Context, tier *entity.RateLimitTier) error {
+	if err := ValidateRateLimitTier(tier); err != nil {
+		return err
+	}
+	if s.tierRepo == nil {
+		return errorx.New(errorx.Internal, "限流等级 repo 未配置")
+	}
+	var before any
+	if tiers, err := s.rateLimitTiers(ctx); err == nil {
+		if prev, ok := tiers[tier.Name]; ok {
+			before = prev
+		}
+	}
+	if err := s.tierRepo.SaveTier(ctx, tier); err != nil {
+		return err
+	}
+	s.tiersMu.Lock()
+	s.tiersLoadedAt = time.Time{}
+	s.tiersMu.Unlock()
+	s.RecordAdminChange(ctx, "admin.save_rate_limit_tier", "rate_limit_tier", tier.ID, before, tier)
+	return nil
+}
+
+func (s *safetyServiceImpl) SetUserRateLimitTier(ctx context.Context, userID int64, tier string, actorID int64) error {
+	if s.tierRepo == nil {
+		return errorx.New(errorx.Internal, "限流等级 repo 未配置")
+	}
+	if tier != "" {
+		tiers, err := s.rateLimitTiers(ctx)
+		if err != nil {
+			return err
+		}
+		if _, ok := tiers[tier]; !ok {
+			return errorx.New(errorx.Validation, "限流等级不存在: "+tier)
+		}
+	}
+	before, err := s.tierRepo.GetUserTier(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.tierRepo.SetUserTier(ctx, userID, tier, actorID); err != nil {
+		return err
+	}
+	s.RecordAdminChange(ctx, "admin.set_user_rate_limit_tier", "user_rate_limit_tier", userID,
+		map[string]string{"tier": before}, map[string]string{"tier": tier})
+	return nil
+}
+
+func (s *safetyServiceImpl) ResolveRateLimitTier(ctx context.Context, userID int64) (*entity.RateLimitTier, error) {
+	tiers, err := s.rateLimitTiers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.tiersMu.RLock()
+	resolver := s.tierResolver
+	s.tiersMu.RUnlock()
+
+	name := ""
+	if resolver != nil {
+		if name, err = resolver(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	if name == "" && s.tierRepo != nil {
+		if name, err = s.tierRepo.GetUserTier(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+	tier, ok := tiers[name]
+	if !ok {
+		// 未分配或等级已被删除时使用默认等级
+		tier = tiers[entity.RateLimitTierFree]
+	}
+	return &tier, nil
+}
+
+// rateLimitTiers 内置等级与数据库配置合并，数据库中的同名等级覆盖内置值；结果缓存 rateLimitTierCacheTTL
+func (s *safetyServiceImpl) rateLimitTiers(ctx context.Context) (map[string]entity.RateLimitTier, error) {
+	s.tiersMu.RLock()
+	if s.tiers != nil && time.Since(s.tiersLoadedAt) < rateLimitTierCacheTTL {
+		tiers := s.tiers
+		s.tiersMu.RUnlock()
+		return tiers, nil
+	}
+	s.tiersMu.RUnlock()
+
+	tiers := make(map[string]entity.RateLimitTier, len(builtinRateLimitTiers))
+	for name, t := range builtinRateLimitTiers {
+		tiers[name] = t
+	}
+	if s.tierRepo != nil {
+		list, err := s.tierRepo.ListTiers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range list {
+			tiers[t.Name] = *t
+		}
+	}
+
+	s.tiersMu.Lock()
+	s.tiers, s.tiersLoadedAt = tiers, time.Now()
+	s.tiersMu.Unlock()
+	return tiers, nil
+}
+
+// allowUser 按等级额度在限流后端判定；共享后端出错时计数并按间隔告警，
+// 默认退化为进程内令牌桶（DB 计数兜底跨实例总量），SetRateLimitFailClosed(true) 时直接拒绝。
+// 返回是否放行、建议的重试秒数，以及判定是否来自共享后端
+func (s *safetyServiceImpl) allowUser(ctx context.Context, tier *entity.RateLimitTier, userID int64) (bool, int, bool) {
+	s.tiersMu.RLock()
+	backend, failClosed := s.rateBackend, s.rateFailClosed
+	s.tiersMu.RUnlock()
+
+	key := strconv.FormatInt(userID, 10)
+	if backend != nil {
+		allowed, retryAfter, err := backend.Allow(ctx, key, tier.PerMinute, tier.Burst)
+		if err == nil {
+			return allowed, retryAfter, backend.Shared()
+		}
+		s.rateBackendFailed(ctx, err, failClosed)
+		if failClosed {
+			return false, 1, backend.Shared()
+		}
+	}
+	allowed, retryAfter, _ := s.localRate.Allow(ctx, key, tier.PerMinute, tier.Burst)
+	return allowed, retryAfter, false
+}
+
+// rateBackendWarnEvery 限流后端故障告警日志的最小间隔，避免故障期间每个请求都打日志
+const rateBackendWarnEvery = time.Minute
+
+// rateBackendFailed 累计限流后端故障次数（见 RateLimitSettings.BackendFailures），并按间隔输出告警
+func (s *safetyServiceImpl) rateBackendFailed(ctx context.Context, err error, failClosed bool) {
+	failures := s.rateBackendFailures.Add(1)
+	if s.logger == nil {
+		return
+	}
+	now := time.Now()
+	s.tiersMu.Lock()
+	warn := now.Sub(s.rateBackendWarnedAt) >= rateBackendWarnEvery
+	if warn {
+		s.rateBackendWarnedAt = now
+	}
+	s.tiersMu.Unlock()
+	if !warn {
+		return
+	}
+	fallback := "local"
+	if failClosed {
+		fallback = "reject"
+	}
+	s.logger.Warn(ctx, "[LLMSafety] 限流后端调用失败",
+		logging.String("fallback", fallback),
+		logging.Int("failures", int(failures)),
+		logging.Error(err),
+	)
+}
+
+// SetRateLimitFailClosed 共享限流后端出错时是否拒绝请求；默认 false，退化为进程内令牌桶
+func (s *safetyServiceImpl) SetRateLimitFailClosed(failClosed bool) {
+	s.tiersMu.Lock()
+	defer s.tiersMu.Unlock()
+	s.rateFailClosed = failClosed
+}
+
+func (s *safetyServiceImpl) SetRateLimitBackend(backend RateLimitBackend) {
+	s.tiersMu.Lock()
+	defer s.tiersMu.Unlock()
+	s.rateBackend = backend
+}
+
+// newUserRateLimiter 每分钟 perMinute 次、额外突发 burst 次的令牌桶；非整秒速率时通过缩放时钟实现
+func newUserRateLimiter(perMinute, burst int) *ratelimit.Limiter {
+	capacity := perMinute + burst
+	if capacity <= 0 {
+		capacity = perMinute
+	}
+
+	baseClock := clock.NewRealClock()
+	cleanupWindow := 10 * time.Minute
+
+	if perMinute%60 == 0 {
+		return ratelimit.New(ratelimit.Config{
+			RequestsPerSecond: perMinute / 60,
+			BurstSize:         capacity,
+			WindowSize:        cleanupWindow,
+			Clock:             baseClock,
+		})
+	}
+
+	scaleFactor := 60.0
+	scaledClock := newScaledClock(baseClock, scaleFactor)
+	scaledCleanupWindow := time.Duration(float64(cleanupWindow) / scaleFactor)
+	if scaledCleanupWindow <= 0 {
+		scaledCleanupWindow = time.Second
+	}
+
+	return ratelimit.New(ratelimit.Config{
+		RequestsPerSecond: perMinute,
+		BurstSize:         capacity,
+		WindowSize:        scaledCleanupWindow,
+		Clock:             scaledClock,
+	})
+}
+
+func estimateRetryAfter(perMinute int) int {
+	if perMinute <= 0 {
+		return 1
+	}
+	refillPerSec := float64(perMinute) / 60.0
+	retryAfter := int(math.Ceil(1.0 / refillPerSec))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	return retryAfter
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+)
+
+// minSamplingRate 最低采样率，对应最大样本权重 1000
+const minSamplingRate = 0.001
+
+// RecordSamplingConfig 写入采样配置，采样率取值 (0, 1]，0 表示全部保存。
+// 调用指标按状态采样，保存的记录带样本权重（1/采样率，取整）供聚合统计还原总体；
+// A/B 测试与提示词模板调用、转化与评估记录始终全部保存，保证显著性与漏斗按用户统计有效。
+// 审计日志只对成功记录的请求/响应正文采样，失败、告警记录与管理操作始终保存正文
+type RecordSamplingConfig struct {
+	MetricsSuccessRate float64 `json:"metrics_success_rate"`
+	MetricsErrorRate   float64 `json:"metrics_error_rate"`
+	// AuditPayloadRate 成功审计记录保存正文的比例；未保存时记录本身仍写入并标记 payload_omitted
+	AuditPayloadRate float64 `json:"audit_payload_rate"`
+}
+
+// RecordSamplingService 管理调用指标与审计日志的写入采样，构造时注册到对应仓储
+type RecordSamplingService interface {
+	SetConfig(cfg RecordSamplingConfig) error
+	GetConfig() RecordSamplingConfig
+}
+
+type recordSamplingServiceImpl struct {
+	cfgMu sync.RWMutex
+	cfg   RecordSamplingConfig
+}
+
+func NewRecordSamplingService(metrics repo.MetricsRepo, audit repo.AuditLogRepo) RecordSamplingService {
+	cfg, _ := normalizeRecordSamplingConfig(RecordSamplingConfig{})
+	s := &recordSamplingServiceImpl{cfg: cfg}
+	if metrics != nil {
+		metrics.SetSampler(s)
+	}
+	if audit != nil {
+		audit.SetSampler(s)
+	}
+	return s
+}
+
+func (s *recordSamplingServiceImpl) SetConfig(cfg RecordSamplingConfig) error {
+	cfg, err := normalizeRecordSamplingConfig(cfg)
+	if err != nil {
+		return err
+	}
+	s.cfgMu.Lock()
+	defer s.cfgMu.Unlock()
+	s.cfg = cfg
+	return nil
+}
+
+func (s *recordSamplingServiceImpl) GetConfig() RecordSamplingConfig {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.cfg
+}
+
+// normalizeRecordSamplingConfig 未设置的采样率取 1，其余按样本权重取整，使保存概率与权重严格互为倒数
+func normalizeRecordSamplingConfig(cfg RecordSamplingConfig) (RecordSamplingConfig, error) {
+	for _, rate := range []*float64{&cfg.MetricsSuccessRate, &cfg.MetricsErrorRate, &cfg.AuditPayloadRate} {
+		if *rate == 0 {
+			*rate = 1
+		}
+		if *rate < minSamplingRate || *rate > 1 {
+			return cfg, errorx.New(errorx.Validation, "采样率须在 0.001 到 1 之间")
+		}
+		*rate = 1 / float64(samplingWeight(*rate))
+	}
+	return cfg, nil
+}
+
+func samplingWeight(rate float64) int {
+	return int(math.Round(1 / rate))
+}
+
+func (s *recordSamplingServiceImpl) MetricsWeight(m *entity.Metrics) int {
+	if m.ABTestID > 0 || m.PromptTemplate > 0 {
+		return 1
+	}
+	cfg := s.GetConfig()
+	var rate float64
+	switch m.Status {
+	case "ok":
+		rate = cfg.MetricsSuccessRate
+	case "error":
+		rate = cfg.MetricsErrorRate
+	default:
+		return 1
+	}
+	return sampleWeight(rate)
+}
+
+func (s *recordSamplingServiceImpl) KeepAuditPayload(log *entity.AuditLog) bool {
+	if strings.HasPrefix(log.Action, "admin.") {
+		return true
+	}
+	if log.Status != "ok" && log.Status != "success" {
+		return true
+	}
+	return sampleWeight(s.GetConfig().AuditPayloadRate) > 0
+}
+
+// sampleWeight 以 rate 的概率保存：保存时返回样本权重，否则返回 0
+func sampleWeight(rate float64) int {
+	w := samplingWeight(rate)
+	if w <= 1 {
+		return 1
+	}
+	if rand.Intn(w) != 0 {
+		return 0
+	}
+	return w
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// maxRequestIDLen 请求 ID 的最大长度，与指标、审计日志的列宽一致
+const maxRequestIDLen = 64
+
+type requestIDKey struct{}
+
+// WithRequestID 声明当前请求的 ID（如上游网关或链路追踪的 X-Request-ID），Chat 调用沿用该 ID 而不再生成；
+// 同一 ctx 内的多次调用（如批量）共用该 ID；空值或超长时忽略
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if id == "" || len(id) > maxRequestIDLen {
+		return ctx
+	}
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// withRequestID 返回一次 Chat 调用的请求 ID：ctx 中已声明时沿用，否则生成；该调用记录的指标与审计日志均携带此 ID，
+// 并通过响应元数据 request_id 返回给调用方
+func withRequestID(ctx context.Context) (context.Context, string) {
+	if id := requestIDFromContext(ctx); id != "" {
+		return ctx, id
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ctx, ""
+	}
+	id := hex.EncodeToString(buf)
+	return context.WithValue(ctx, requestIDKey{}, id), id
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
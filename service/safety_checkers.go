@@ -0,0 +1,615 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+// SafetyFinding 检查器的单条判定结果
+type SafetyFinding struct {
+	Checker  string `json:"checker"`
+	Category string `json:"category"`
+	Severity string `json:"severity"`
+	Action   string `json:"action"`
+	Message  string `json:"message,omitempty"`
+	// Terms 命中的关键词或片段，仅用于可安全回显的检查器（凭据、PII 不填）
+	Terms []string `json:"terms,omitempty"`
+}
+
+// SafetyCheckInput 检查器输入；Text 为前序检查器掩码后的文本
+type SafetyCheckInput struct {
+	Direction string
+	Text      string
+	Policy    *entity.SafetyPolicy
+	Config    json.RawMessage
+}
+
+// SafetyCheckOutput 检查器输出；Text 为掩码后的文本，仅当存在 mask 动作的判定时传给后续检查器
+type SafetyCheckOutput struct {
+	Findings []*SafetyFinding
+	Text     string
+	Modified bool
+}
+
+// SafetyChecker 安全检查链中的检查器，内置 keyword/regex/pii/length/secret/moderation_api/llm_moderation/age_rating，可通过 RegisterChecker 扩展
+type SafetyChecker interface {
+	Name() string
+	// Directions 默认作用方向，策略未配置 directions 时使用
+	Directions() []string
+	Check(ctx context.Context, in *SafetyCheckInput) (*SafetyCheckOutput, error)
+}
+
+// SafetyConfigValidator 检查器可选实现，用于保存策略前校验自身配置
+type SafetyConfigValidator interface {
+	ValidateConfig(config json.RawMessage) error
+}
+
+// maxSafetyTerms 单条判定最多记录的命中片段数
+const maxSafetyTerms = 5
+
+var bothSafetyDirections = []string{entity.SafetyDirectionInput, entity.SafetyDirectionOutput}
+
+// defaultSafetyCheckers 策略未配置检查链时的默认链：关键词过滤 + 输出凭据泄露掩码
+var defaultSafetyCheckers = []entity.SafetyCheckerConfig{{Name: "keyword"}, {Name: "secret"}}
+
+// keywordChecker 命中策略 BlockedKeywordsJSON 中的关键词（忽略大小写）即拒绝；动作映射为 mask 时替换为 ***。
+// 完全落在 AllowedPhrasesJSON 白名单短语内的命中不计入
+type keywordChecker struct{}
+
+func (keywordChecker) Name() string         { return "keyword" }
+func (keywordChecker) Directions() []string { return bothSafetyDirections }
+
+func (keywordChecker) Check(ctx context.Context, in *SafetyCheckInput) (*SafetyCheckOutput, error) {
+	var kws []string
+	if in.Policy != nil && strings.TrimSpace(in.Policy.BlockedKeywordsJSON) != "" {
+		_ = json.Unmarshal([]byte(in.Policy.BlockedKeywordsJSON), &kws)
+	}
+	out := &SafetyCheckOutput{Text: in.Text}
+	allowed := allowedPhraseSpans(in.Policy, in.Text)
+	var terms []string
+	var hits [][]int
+	for _, kw := range kws {
+		kw = strings.TrimSpace(kw)
+		if kw == "" {
+			continue
+		}
+		re := regexp.MustCompile("(?i)" + regexp.QuoteMeta(kw))
+		matched := false
+		for _, loc := range re.FindAllStringIndex(in.Text, -1) {
+			if !withinSpans(allowed, loc) {
+				hits = append(hits, loc)
+				matched = true
+			}
+		}
+		if matched {
+			terms = append(terms, kw)
+		}
+	}
+	if len(hits) > 0 {
+		out.Text = maskSpans(in.Text, hits, "***")
+		out.Modified = true
+	}
+	if len(terms) > 0 {
+		out.Findings = []*SafetyFinding{{
+			Category: "keyword",
+			Severity: entity.SafetySeverityMedium,
+			Action:   entity.SafetyActionBlock,
+			Message:  "命中敏感词",
+			Terms:    terms,
+		}}
+	}
+	return out, nil
+}
+
+// allowedPhraseSpans 返回文本中白名单短语（忽略大小写）出现的位置
+func allowedPhraseSpans(policy *entity.SafetyPolicy, text string) [][]int {
+	if policy == nil || strings.TrimSpace(policy.AllowedPhrasesJSON) == "" {
+		return nil
+	}
+	var phrases []string
+	_ = json.Unmarshal([]byte(policy.AllowedPhrasesJSON), &phrases)
+	var spans [][]int
+	for _, phrase := range phrases {
+		if phrase = strings.TrimSpace(phrase); phrase == "" {
+			continue
+		}
+		re := regexp.MustCompile("(?i)" + regexp.QuoteMeta(phrase))
+		spans = append(spans, re.FindAllStringIndex(text, -1)...)
+	}
+	return spans
+}
+
+func withinSpans(spans [][]int, loc []int) bool {
+	for _, span := range spans {
+		if loc[0] >= span[0] && loc[1] <= span[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// maskSpans 将命中区间（可重叠）替换为 mask，重叠区间合并后只替换一次
+func maskSpans(text string, spans [][]int, mask string) string {
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	var b strings.Builder
+	pos := 0
+	for _, span := range spans {
+		if span[1] <= pos {
+			continue
+		}
+		if span[0] >= pos {
+			b.WriteString(text[pos:span[0]])
+			b.WriteString(mask)
+		}
+		pos = span[1]
+	}
+	b.WriteString(text[pos:])
+	return b.String()
+}
+
+// ValidateAllowedPhrases 校验白名单短语配置（JSON 字符串数组）
+func ValidateAllowedPhrases(raw string) error {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	var phrases []string
+	if err := json.Unmarshal([]byte(raw), &phrases); err != nil {
+		return errorx.Wrap(err, errorx.Validation, "白名单短语配置无效，应为字符串数组")
+	}
+	return nil
+}
+
+// regexCheckerConfig regex 检查器配置
+type regexCheckerConfig struct {
+	Patterns []struct {
+		Pattern  string `json:"pattern"`
+		Category string `json:"category"`
+		Severity string `json:"severity"`
+		Action   string `json:"action"` // 默认 block；最终动作为 mask 时替换为 Mask
+		Mask     string `json:"mask"`
+	} `json:"patterns"`
+}
+
+// regexChecker 按配置的正则逐条匹配
+type regexChecker struct{}
+
+func (regexChecker) Name() string         { return "regex" }
+func (regexChecker) Directions() []string { return bothSafetyDirections }
+
+func (regexChecker) parse(config json.RawMessage) (*regexCheckerConfig, []*regexp.Regexp, error) {
+	var cfg regexCheckerConfig
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &cfg); err != nil {
+			return nil, nil, errorx.Wrap(err, errorx.Validation, "regex 检查器配置无效")
+		}
+	}
+	res := make([]*regexp.Regexp, len(cfg.Patterns))
+	for i, p := range cfg.Patterns {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, nil, errorx.Wrap(err, errorx.Validation, "regex 检查器正则无效: "+p.Pattern)
+		}
+		if err := validateSafetyAction(p.Action); err != nil {
+			return nil, nil, err
+		}
+		if err := validateSafetySeverity(p.Severity); err != nil {
+			return nil, nil, err
+		}
+		res[i] = re
+	}
+	return &cfg, res, nil
+}
+
+func (c regexChecker) ValidateConfig(config json.RawMessage) error {
+	_, _, err := c.parse(config)
+	return err
+}
+
+func (c regexChecker) Check(ctx context.Context, in *SafetyCheckInput) (*SafetyCheckOutput, error) {
+	cfg, res, err := c.parse(in.Config)
+	if err != nil {
+		return nil, err
+	}
+	out := &SafetyCheckOutput{Text: in.Text}
+	for i, p := range cfg.Patterns {
+		matches := res[i].FindAllString(out.Text, maxSafetyTerms)
+		if len(matches) == 0 {
+			continue
+		}
+		finding := &SafetyFinding{
+			Category: p.Category,
+			Severity: p.Severity,
+			Action:   p.Action,
+			Message:  "命中规则 " + p.Pattern,
+			Terms:    matches,
+		}
+		if finding.Category == "" {
+			finding.Category = "regex"
+		}
+		if finding.Severity == "" {
+			finding.Severity = entity.SafetySeverityMedium
+		}
+		if finding.Action == "" {
+			finding.Action = entity.SafetyActionBlock
+		}
+		mask := p.Mask
+		if mask == "" {
+			mask = "***"
+		}
+		out.Text = res[i].ReplaceAllString(out.Text, mask)
+		out.Modified = true
+		out.Findings = append(out.Findings, finding)
+	}
+	return out, nil
+}
+
+// piiChecker 按策略 PIIConfigJSON 检测 PII；输入侧的逐条消息掩码由聊天流程处理，默认仅作用于输出
+type piiChecker struct {
+	cache *piiDetectorCache
+	vault *piiVaultHolder
+}
+
+func (piiChecker) Name() string         { return "pii" }
+func (piiChecker) Directions() []string { return []string{entity.SafetyDirectionOutput} }
+
+func (c piiChecker) Check(ctx context.Context, in *SafetyCheckInput) (*SafetyCheckOutput, error) {
+	raw := ""
+	if in.Policy != nil {
+		raw = in.Policy.PIIConfigJSON
+	}
+	detectors, err := c.cache.get(raw)
+	if err != nil {
+		return nil, err
+	}
+	vault := c.vault.get()
+	if isSafetyDryRun(ctx) {
+		// 回放不写令牌库，tokenize 退化为整体替换
+		vault = nil
+	}
+	res := scanPIIWithVault(ctx, detectors, in.Text, false, vault)
+	out := &SafetyCheckOutput{Text: res.Content, Modified: res.Content != in.Text}
+	for _, hit := range res.Hits {
+		severity := entity.SafetySeverityMedium
+		if hit.Action == entity.PIIActionBlock {
+			severity = entity.SafetySeverityHigh
+		}
+		out.Findings = append(out.Findings, &SafetyFinding{
+			Category: "pii:" + hit.Detector,
+			Severity: severity,
+			Action:   hit.Action,
+			Message:  fmt.Sprintf("命中 %d 处", hit.Count),
+		})
+	}
+	return out, nil
+}
+
+// lengthChecker 文本字符数超过 max_chars 时拒绝；输出长度由 MaxContentLength 截断，默认仅作用于输入
+type lengthChecker struct{}
+
+type lengthCheckerConfig struct {
+	MaxChars int `json:"max_chars"`
+}
+
+func (lengthChecker) Name() string         { return "length" }
+func (lengthChecker) Directions() []string { return []string{entity.SafetyDirectionInput} }
+
+func (lengthChecker) ValidateConfig(config json.RawMessage) error {
+	var cfg lengthCheckerConfig
+	if err := json.Unmarshal(config, &cfg); err != nil || cfg.MaxChars <= 0 {
+		return errorx.New(errorx.Validation, "length 检查器需配置正整数 max_chars")
+	}
+	return nil
+}
+
+func (lengthChecker) Check(ctx context.Context, in *SafetyCheckInput) (*SafetyCheckOutput, error) {
+	var cfg lengthCheckerConfig
+	if len(in.Config) > 0 {
+		_ = json.Unmarshal(in.Config, &cfg)
+	}
+	if cfg.MaxChars <= 0 {
+		return &SafetyCheckOutput{}, nil
+	}
+	if n := len([]rune(in.Text)); n > cfg.MaxChars {
+		return &SafetyCheckOutput{Findings: []*SafetyFinding{{
+			Category: "length",
+			Severity: entity.SafetySeverityLow,
+			Action:   entity.SafetyActionBlock,
+			Message:  fmt.Sprintf("内容长度 %d 超过上限 %d", n, cfg.MaxChars),
+		}}}, nil
+	}
+	return &SafetyCheckOutput{}, nil
+}
+
+// moderationAPIChecker 调用外部审核接口（OpenAI moderation 兼容格式）：
+// 请求 {"input": text}，响应 {"results":[{"flagged":bool,"categories":{...},"category_scores":{...}}]}
+type moderationAPIChecker struct {
+	http *http.Client
+}
+
+type moderationAPIConfig struct {
+	URL       string  `json:"url"`
+	Token     string  `json:"token"`
+	Model     string  `json:"model"`
+	Threshold float64 `json:"threshold"` // 按 category_scores 判定的阈值，0 表示仅依据 flagged/categories
+}
+
+func (moderationAPIChecker) Name() string         { return "moderation_api" }
+func (moderationAPIChecker) Directions() []string { return bothSafetyDirections }
+
+func (moderationAPIChecker) ValidateConfig(config json.RawMessage) error {
+	var cfg moderationAPIConfig
+	if err := json.Unmarshal(config, &cfg); err != nil || strings.TrimSpace(cfg.URL) == "" {
+		return errorx.New(errorx.Validation, "moderation_api 检查器需配置 url")
+	}
+	if cfg.Threshold < 0 || cfg.Threshold > 1 {
+		return errorx.New(errorx.Validation, "moderation_api threshold 需在 0-1 之间")
+	}
+	return nil
+}
+
+func (c moderationAPIChecker) Check(ctx context.Context, in *SafetyCheckInput) (*SafetyCheckOutput, error) {
+	var cfg moderationAPIConfig
+	if len(in.Config) > 0 {
+		_ = json.Unmarshal(in.Config, &cfg)
+	}
+	if cfg.URL == "" || strings.TrimSpace(in.Text) == "" {
+		return &SafetyCheckOutput{}, nil
+	}
+	results, err := fetchModerationScores(ctx, c.http, cfg.URL, cfg.Token, cfg.Model, in.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &SafetyCheckOutput{}
+	for _, r := range results {
+		for _, category := range sortedKeys(r.Scores) {
+			score := r.Scores[category]
+			hit := r.Categories[category]
+			if cfg.Threshold > 0 {
+				hit = score >= cfg.Threshold
+			}
+			if !hit {
+				continue
+			}
+			out.Findings = append(out.Findings, &SafetyFinding{
+				Category: category,
+				Severity: moderationSeverity(score),
+				Action:   entity.SafetyActionBlock,
+				Message:  fmt.Sprintf("score=%.2f", score),
+			})
+		}
+		if r.Flagged && len(out.Findings) == 0 && cfg.Threshold == 0 {
+			out.Findings = append(out.Findings, &SafetyFinding{
+				Category: "flagged",
+				Severity: entity.SafetySeverityMedium,
+				Action:   entity.SafetyActionBlock,
+			})
+		}
+	}
+	return out, nil
+}
+
+func moderationSeverity(score float64) string {
+	switch {
+	case score >= 0.95:
+		return entity.SafetySeverityCritical
+	case score >= 0.8:
+		return entity.SafetySeverityHigh
+	case score >= 0.5:
+		return entity.SafetySeverityMedium
+	default:
+		return entity.SafetySeverityLow
+	}
+}
+
+func validateSafetyAction(action string) error {
+	switch action {
+	case "", entity.SafetyActionBlock, entity.SafetyActionBlockBan, entity.SafetyActionMask, entity.SafetyActionLog:
+		return nil
+	default:
+		return errorx.New(errorx.Validation, "安全检查动作仅支持 block/block_ban/mask/log: "+action)
+	}
+}
+
+func validateSafetySeverity(severity string) error {
+	if severity != "" && safetySeverityRank(severity) == 0 {
+		return errorx.New(errorx.Validation, "严重程度仅支持 low/medium/high/critical: "+severity)
+	}
+	return nil
+}
+
+func parseSeverityActions(raw string) (map[string]string, error) {
+	actions := map[string]string{}
+	if strings.TrimSpace(raw) == "" {
+		return actions, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &actions); err != nil {
+		return nil, errorx.Wrap(err, errorx.Validation, "严重程度动作映射需为 JSON 对象")
+	}
+	for severity, action := range actions {
+		if err := validateSafetySeverity(severity); err != nil {
+			return nil, err
+		}
+		if action == "" {
+			return nil, errorx.New(errorx.Validation, "严重程度动作不能为空: "+severity)
+		}
+		if err := validateSafetyAction(action); err != nil {
+			return nil, err
+		}
+	}
+	return actions, nil
+}
+
+// ValidateSeverityActions 校验严重程度动作映射
+func ValidateSeverityActions(raw string) error {
+	_, err := parseSeverityActions(raw)
+	return err
+}
+
+// safetyActionRank 动作强度：block_ban > block > mask > log
+func safetyActionRank(action string) int {
+	switch action {
+	case entity.SafetyActionBlockBan:
+		return 4
+	case entity.SafetyActionBlock:
+		return 3
+	case entity.SafetyActionMask:
+		return 2
+	case entity.SafetyActionLog:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func isBlockingSafetyAction(action string) bool {
+	return action == entity.SafetyActionBlock || action == entity.SafetyActionBlockBan
+}
+
+func parseSafetyCheckers(raw string) ([]entity.SafetyCheckerConfig, error) {
+	if strings.TrimSpace(raw) == "" {
+		return defaultSafetyCheckers, nil
+	}
+	var list []entity.SafetyCheckerConfig
+	if err := json.Unmarshal([]byte(raw), &list); err != nil {
+		return nil, errorx.Wrap(err, errorx.Validation, "安全检查链配置需为 JSON 数组")
+	}
+	return list, nil
+}
+
+// ValidateSafetyCheckers 校验检查链配置；checkers 为已注册的检查器，未注册的名称视为无效
+func ValidateSafetyCheckers(raw string, checkers map[string]SafetyChecker) error {
+	list, err := parseSafetyCheckers(raw)
+	if err != nil {
+		return err
+	}
+	for _, cfg := range list {
+		checker, ok := checkers[cfg.Name]
+		if !ok {
+			return errorx.New(errorx.Validation, "未知的安全检查器: "+cfg.Name)
+		}
+		if err := validateSafetyAction(cfg.Action); err != nil {
+			return err
+		}
+		for _, d := range cfg.Directions {
+			if d != entity.SafetyDirectionInput && d != entity.SafetyDirectionOutput {
+				return errorx.New(errorx.Validation, "安全检查方向仅支持 input/output: "+d)
+			}
+		}
+		if v, ok := checker.(SafetyConfigValidator); ok && !cfg.Disabled {
+			if err := v.ValidateConfig(cfg.Config); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func newBuiltinSafetyCheckers(pii *piiDetectorCache, vault *piiVaultHolder, manager ProviderManager) map[string]SafetyChecker {
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	checkers := map[string]SafetyChecker{}
+	for _, c := range []SafetyChecker{
+		keywordChecker{},
+		regexChecker{},
+		piiChecker{cache: pii, vault: vault},
+		lengthChecker{},
+		secretChecker{},
+		moderationAPIChecker{http: httpClient},
+		llmModerationChecker{manager: manager, http: httpClient},
+		ageRatingChecker{manager: manager},
+	} {
+		checkers[c.Name()] = c
+	}
+	return checkers
+}
+
+func containsDirection(directions []string, direction string) bool {
+	for _, d := range directions {
+		if d == direction {
+			return true
+		}
+	}
+	return false
+}
+
+// checkerExemption 当前请求豁免的检查器；all 表示全部豁免
+type checkerExemption struct {
+	all      bool
+	checkers map[string]bool
+}
+
+func (e checkerExemption) covers(name string) bool {
+	return e.all || e.checkers[name]
+}
+
+func parseSafetyExemptions(raw string) ([]entity.SafetyExemption, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var rules []entity.SafetyExemption
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, errorx.Wrap(err, errorx.Validation, "豁免规则配置无效")
+	}
+	for i, rule := range rules {
+		if len(rule.UserIDs) == 0 && len(rule.Roles) == 0 {
+			return nil, errorx.New(errorx.Validation, fmt.Sprintf("第 %d 条豁免规则未指定 user_ids 或 roles", i+1))
+		}
+	}
+	return rules, nil
+}
+
+// ValidateSafetyExemptions 校验豁免规则配置
+func ValidateSafetyExemptions(raw string) error {
+	_, err := parseSafetyExemptions(raw)
+	return err
+}
+
+// exemptCheckers 按用户 ID 与角色匹配策略的豁免规则，合并命中规则的检查器
+func exemptCheckers(policy *entity.SafetyPolicy, scope safetyScope) (checkerExemption, error) {
+	exempt := checkerExemption{checkers: map[string]bool{}}
+	if policy == nil || (scope.userID <= 0 && len(scope.roles) == 0) {
+		return exempt, nil
+	}
+	rules, err := parseSafetyExemptions(policy.ExemptionsJSON)
+	if err != nil {
+		return exempt, err
+	}
+	for _, rule := range rules {
+		if !exemptionMatches(rule, scope) {
+			continue
+		}
+		if len(rule.Checkers) == 0 {
+			exempt.all = true
+			return exempt, nil
+		}
+		for _, name := range rule.Checkers {
+			exempt.checkers[name] = true
+		}
+	}
+	return exempt, nil
+}
+
+func exemptionMatches(rule entity.SafetyExemption, scope safetyScope) bool {
+	for _, id := range rule.UserIDs {
+		if scope.userID > 0 && id == scope.userID {
+			return true
+		}
+	}
+	for _, role := range rule.Roles {
+		for _, r := range scope.roles {
+			if role != "" && role == r {
+				return true
+			}
+		}
+	}
+	return false
+}
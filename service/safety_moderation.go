@@ -0,0 +1,301 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"gochen-llm/client"
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+const (
+	defaultOpenAIModerationURL   = "https://api.openai.com/v1/moderations"
+	defaultOpenAIModerationModel = "omni-moderation-latest"
+	// defaultModerationThreshold BlockedCategoriesJSON 仅给出类别名称时使用的阈值
+	defaultModerationThreshold = 0.5
+	// defaultModerationMaxChars 送审文本的默认字符上限，控制审核成本
+	defaultModerationMaxChars = 4000
+)
+
+// 审核模型模式
+const (
+	ModerationProviderOpenAI = "openai" // OpenAI moderation 接口
+	ModerationProviderModel  = "model"  // 通过已配置的（小）模型端点打分
+)
+
+const moderationModelPrompt = `你是内容审核模型。请评估用户给出的文本在以下类别上的风险分数（0 到 1 之间的小数，越高风险越大）：
+%s
+仅输出一个 JSON 对象，键为类别，值为分数，例如：{"hate": 0.02, "violence": 0.91}`
+
+// defaultModerationCategories 模型模式下策略未配置类别时的评估类别
+var defaultModerationCategories = []string{"hate", "harassment", "self-harm", "sexual", "violence", "illicit"}
+
+// moderationCategoryRule BlockedCategoriesJSON 中单个类别的判定规则
+type moderationCategoryRule struct {
+	Threshold float64 `json:"threshold"`
+	Action    string  `json:"action"` // block（默认）/block_ban/log（仅标记）
+}
+
+// parseBlockedCategories 解析 BlockedCategoriesJSON，支持两种格式：
+// ["hate","violence"]（默认阈值 0.5，block）或 {"hate":{"threshold":0.4,"action":"block"},"sexual":{"threshold":0.7,"action":"log"}}
+func parseBlockedCategories(raw string) (map[string]moderationCategoryRule, error) {
+	rules := map[string]moderationCategoryRule{}
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return rules, nil
+	}
+	if strings.HasPrefix(raw, "[") {
+		var names []string
+		if err := json.Unmarshal([]byte(raw), &names); err != nil {
+			return nil, errorx.Wrap(err, errorx.Validation, "屏蔽类别配置无效")
+		}
+		for _, name := range names {
+			if name = strings.TrimSpace(name); name != "" {
+				rules[name] = moderationCategoryRule{Threshold: defaultModerationThreshold, Action: entity.SafetyActionBlock}
+			}
+		}
+		return rules, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, errorx.Wrap(err, errorx.Validation, "屏蔽类别配置无效")
+	}
+	for name, rule := range rules {
+		if rule.Threshold < 0 || rule.Threshold > 1 {
+			return nil, errorx.New(errorx.Validation, "屏蔽类别阈值需在 0-1 之间: "+name)
+		}
+		if rule.Threshold == 0 {
+			rule.Threshold = defaultModerationThreshold
+		}
+		switch rule.Action {
+		case "":
+			rule.Action = entity.SafetyActionBlock
+		case entity.SafetyActionBlock, entity.SafetyActionBlockBan, entity.SafetyActionLog:
+		default:
+			return nil, errorx.New(errorx.Validation, "屏蔽类别动作仅支持 block/block_ban/log: "+name)
+		}
+		rules[name] = rule
+	}
+	return rules, nil
+}
+
+// ValidateBlockedCategories 校验屏蔽类别配置
+func ValidateBlockedCategories(raw string) error {
+	_, err := parseBlockedCategories(raw)
+	return err
+}
+
+type moderationScores struct {
+	Flagged    bool
+	Categories map[string]bool
+	Scores     map[string]float64
+}
+
+// fetchModerationScores 调用 OpenAI moderation 兼容接口
+func fetchModerationScores(ctx context.Context, httpClient *http.Client, url, token, model, text string) ([]*moderationScores, error) {
+	payload := map[string]any{"input": text}
+	if model != "" {
+		payload["model"] = model
+	}
+	body, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "创建审核请求失败")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "调用审核接口失败")
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode/100 != 2 {
+		return nil, errorx.New(errorx.Internal, fmt.Sprintf("审核接口返回 %d", resp.StatusCode))
+	}
+	var parsed struct {
+		Results []struct {
+			Flagged        bool               `json:"flagged"`
+			Categories     map[string]bool    `json:"categories"`
+			CategoryScores map[string]float64 `json:"category_scores"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "解析审核接口响应失败")
+	}
+	results := make([]*moderationScores, 0, len(parsed.Results))
+	for _, r := range parsed.Results {
+		results = append(results, &moderationScores{Flagged: r.Flagged, Categories: r.Categories, Scores: r.CategoryScores})
+	}
+	return results, nil
+}
+
+// llmModerationConfig llm_moderation 检查器配置
+type llmModerationConfig struct {
+	Provider string `json:"provider"`  // openai（默认）/model
+	URL      string `json:"url"`       // openai 模式的接口地址
+	Token    string `json:"token"`     // openai 模式的访问令牌
+	Model    string `json:"model"`     // openai 模式的审核模型
+	Endpoint string `json:"endpoint"`  // model 模式使用的端点名称，为空按常规路由
+	MaxChars int    `json:"max_chars"` // 送审文本字符上限
+}
+
+// llmModerationChecker 使用审核模型对输入/输出打分，按策略 BlockedCategoriesJSON 的类别阈值拒绝或标记
+type llmModerationChecker struct {
+	manager ProviderManager
+	http    *http.Client
+}
+
+func (llmModerationChecker) Name() string         { return "llm_moderation" }
+func (llmModerationChecker) Directions() []string { return bothSafetyDirections }
+
+func (llmModerationChecker) ValidateConfig(config json.RawMessage) error {
+	var cfg llmModerationConfig
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &cfg); err != nil {
+			return errorx.Wrap(err, errorx.Validation, "llm_moderation 检查器配置无效")
+		}
+	}
+	switch cfg.Provider {
+	case "", ModerationProviderOpenAI:
+		if cfg.Token == "" && cfg.URL == "" {
+			return errorx.New(errorx.Validation, "llm_moderation openai 模式需配置 token 或自定义 url")
+		}
+	case ModerationProviderModel:
+	default:
+		return errorx.New(errorx.Validation, "llm_moderation provider 仅支持 openai/model")
+	}
+	return nil
+}
+
+func (c llmModerationChecker) Check(ctx context.Context, in *SafetyCheckInput) (*SafetyCheckOutput, error) {
+	var cfg llmModerationConfig
+	if len(in.Config) > 0 {
+		_ = json.Unmarshal(in.Config, &cfg)
+	}
+	text := strings.TrimSpace(in.Text)
+	if text == "" {
+		return &SafetyCheckOutput{}, nil
+	}
+	maxChars := cfg.MaxChars
+	if maxChars <= 0 {
+		maxChars = defaultModerationMaxChars
+	}
+	text, _ = truncateRunes(text, maxChars)
+
+	rules := map[string]moderationCategoryRule{}
+	if in.Policy != nil {
+		parsed, err := parseBlockedCategories(in.Policy.BlockedCategoriesJSON)
+		if err != nil {
+			return nil, err
+		}
+		rules = parsed
+	}
+
+	var scores *moderationScores
+	var err error
+	if cfg.Provider == ModerationProviderModel {
+		scores, err = c.scoreWithModel(ctx, cfg, rules, text)
+	} else {
+		scores, err = c.scoreWithOpenAI(ctx, cfg, text)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &SafetyCheckOutput{Findings: moderationFindings(scores, rules)}, nil
+}
+
+func (c llmModerationChecker) scoreWithOpenAI(ctx context.Context, cfg llmModerationConfig, text string) (*moderationScores, error) {
+	url, model := cfg.URL, cfg.Model
+	if url == "" {
+		url = defaultOpenAIModerationURL
+	}
+	if model == "" && url == defaultOpenAIModerationURL {
+		model = defaultOpenAIModerationModel
+	}
+	results, err := fetchModerationScores(ctx, c.http, url, cfg.Token, model, text)
+	if err != nil {
+		return nil, err
+	}
+	merged := &moderationScores{Categories: map[string]bool{}, Scores: map[string]float64{}}
+	for _, r := range results {
+		merged.Flagged = merged.Flagged || r.Flagged
+		for k, v := range r.Categories {
+			merged.Categories[k] = merged.Categories[k] || v
+		}
+		for k, v := range r.Scores {
+			if v > merged.Scores[k] {
+				merged.Scores[k] = v
+			}
+		}
+	}
+	return merged, nil
+}
+
+// scoreWithModel 通过已配置的模型端点按类别打分，调用不计入用户限流
+func (c llmModerationChecker) scoreWithModel(ctx context.Context, cfg llmModerationConfig, rules map[string]moderationCategoryRule, text string) (*moderationScores, error) {
+	if c.manager == nil {
+		return nil, errorx.New(errorx.Internal, "LLM ProviderManager 未配置")
+	}
+	categories := sortedKeys(rules)
+	if len(categories) == 0 {
+		categories = defaultModerationCategories
+	}
+	mctx := ctx
+	if cfg.Endpoint != "" {
+		mctx = WithPinnedEndpoint(ctx, cfg.Endpoint)
+	}
+	resp, _, _, _, _, _, err := c.manager.ChatForUser(mctx, 0, &client.ChatRequest{
+		System:      fmt.Sprintf(moderationModelPrompt, strings.Join(categories, ", ")),
+		Messages:    []client.ChatMessage{{Role: "user", Content: text}},
+		Temperature: 0,
+		MaxTokens:   200,
+	})
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseEvalScores(resp.Content, categories)
+	if err != nil {
+		return nil, err
+	}
+	return &moderationScores{Scores: parsed.Scores}, nil
+}
+
+// moderationFindings 按类别规则判定；未配置任何类别时退化为审核接口自身的 flagged 类别并拒绝
+func moderationFindings(scores *moderationScores, rules map[string]moderationCategoryRule) []*SafetyFinding {
+	var findings []*SafetyFinding
+	if len(rules) == 0 {
+		for _, category := range sortedKeys(scores.Categories) {
+			if scores.Categories[category] {
+				findings = append(findings, &SafetyFinding{
+					Category: category,
+					Severity: moderationSeverity(scores.Scores[category]),
+					Action:   entity.SafetyActionBlock,
+					Message:  fmt.Sprintf("score=%.2f", scores.Scores[category]),
+				})
+			}
+		}
+		return findings
+	}
+	for _, category := range sortedKeys(rules) {
+		rule := rules[category]
+		score, ok := scores.Scores[category]
+		if !ok || score < rule.Threshold {
+			continue
+		}
+		findings = append(findings, &SafetyFinding{
+			Category: category,
+			Severity: moderationSeverity(score),
+			Action:   rule.Action,
+			Message:  fmt.Sprintf("score=%.2f threshold=%.2f", score, rule.Threshold),
+		})
+	}
+	return findings
+}
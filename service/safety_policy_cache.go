@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"gochen-llm/entity"
+)
+
+// safetyPolicyCacheTTL 作用域策略解析结果的缓存时间；一次聊天请求会多次读取策略，
+// 本实例的管理端修改经 InvalidatePolicyCache 立即失效，其他实例最多延迟一个 TTL
+const safetyPolicyCacheTTL = 10 * time.Second
+
+type policyCacheEntry struct {
+	policy   *entity.SafetyPolicy // 未配置任何策略时为 nil
+	loadedAt time.Time
+}
+
+// resolvePolicy 按作用域链解析策略，结果按链缓存 safetyPolicyCacheTTL。
+// 返回的策略为共享快照，调用方不得修改
+func (s *safetyServiceImpl) resolvePolicy(ctx context.Context, chain []entity.SafetyScopeRef) (*entity.SafetyPolicy, error) {
+	key := policyChainKey(chain)
+	now := time.Now()
+	s.policiesMu.Lock()
+	entry, ok := s.policies[key]
+	s.policiesMu.Unlock()
+	if ok && now.Sub(entry.loadedAt) < safetyPolicyCacheTTL {
+		return entry.policy, nil
+	}
+
+	policy, err := s.repo.Resolve(ctx, chain)
+	if err != nil {
+		return nil, err
+	}
+	s.policiesMu.Lock()
+	if s.policies == nil || now.Sub(s.policiesSweptAt) >= safetyPolicyCacheTTL {
+		// 作用域链随组织/项目增长，顺带清理过期项
+		s.policiesSweptAt = now
+		for k, e := range s.policies {
+			if now.Sub(e.loadedAt) >= safetyPolicyCacheTTL {
+				delete(s.policies, k)
+			}
+		}
+		if s.policies == nil {
+			s.policies = map[string]policyCacheEntry{}
+		}
+	}
+	s.policies[key] = policyCacheEntry{policy: policy, loadedAt: now}
+	s.policiesMu.Unlock()
+	return policy, nil
+}
+
+func (s *safetyServiceImpl) InvalidatePolicyCache() {
+	s.policiesMu.Lock()
+	s.policies = nil
+	s.policiesMu.Unlock()
+}
+
+func policyChainKey(chain []entity.SafetyScopeRef) string {
+	var b strings.Builder
+	for _, ref := range chain {
+		b.WriteString(ref.Scope)
+		b.WriteByte(':')
+		b.WriteString(ref.Key)
+		b.WriteByte('|')
+	}
+	return b.String()
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+)
+
+const (
+	// defaultSafetyReplayLimit 单次回放默认读取的审计日志条数
+	defaultSafetyReplayLimit = 1000
+	// maxSafetyReplayLimit 单次回放读取的审计日志条数上限
+	maxSafetyReplayLimit = 10000
+	// safetyReplayBatchSize 回放时每批读取的审计日志条数
+	safetyReplayBatchSize = 200
+	// safetyReplayMaxChanges 报告中保留的变化明细条数上限
+	safetyReplayMaxChanges = 200
+	// safetyReplayExcerptChars 变化明细中文本摘录的字符数
+	safetyReplayExcerptChars = 200
+)
+
+// remoteSafetyCheckers 调用外部模型或接口的内置检查器，回放时默认跳过以免产生费用
+var remoteSafetyCheckers = []string{"moderation_api", "llm_moderation", "age_rating"}
+
+// 回放判定变化类型
+const (
+	SafetyReplayNewlyBlocked = "newly_blocked"
+	SafetyReplayNewlyAllowed = "newly_allowed"
+)
+
+// SafetyReplayRequest 安全策略回放请求
+type SafetyReplayRequest struct {
+	// Candidate 待评估的候选策略，无需保存
+	Candidate *entity.SafetyPolicy `json:"candidate"`
+	// Filter 审计日志筛选条件，Action 为空时回放 llm.chat
+	Filter repo.AuditLogFilter `json:"-"`
+	// Limit 最多回放的审计日志条数，默认 1000，上限 10000
+	Limit int `json:"limit"`
+	// IncludeRemoteCheckers 同时执行调用外部模型的检查器（moderation_api/llm_moderation/age_rating）
+	IncludeRemoteCheckers bool `json:"include_remote_checkers"`
+}
+
+// SafetyReplayChange 单条审计日志在候选策略下的判定变化
+type SafetyReplayChange struct {
+	AuditLogID      int64     `json:"audit_log_id"`
+	UserID          int64     `json:"user_id"`
+	Direction       string    `json:"direction"`
+	Change          string    `json:"change"`
+	BaselineReason  string    `json:"baseline_reason,omitempty"`
+	CandidateReason string    `json:"candidate_reason,omitempty"`
+	Category        string    `json:"category,omitempty"`
+	Excerpt         string    `json:"excerpt"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// SafetyReplayReport 回放结果：对比记录时生效的策略版本与候选策略的判定差异
+type SafetyReplayReport struct {
+	Scanned         int                   `json:"scanned"`          // 读取的审计日志条数
+	Skipped         int                   `json:"skipped"`          // 正文缺失（按 metadata/hash 级别记录）或无法解析的条数
+	Evaluated       int                   `json:"evaluated"`        // 实际评估的文本条数（输入与输出分别计数）
+	NewlyBlocked    int                   `json:"newly_blocked"`    // 基线放行、候选拒绝
+	NewlyAllowed    int                   `json:"newly_allowed"`    // 基线拒绝、候选放行
+	BlockedBoth     int                   `json:"blocked_both"`     // 两者均拒绝
+	ByCategory      map[string]int        `json:"by_category"`      // 新增拒绝按判定类别计数
+	SkippedCheckers []string              `json:"skipped_checkers"` // 未执行的检查器
+	Changes         []*SafetyReplayChange `json:"changes"`          // 变化明细（最多 200 条）
+	CandidateErrors map[string]int        `json:"candidate_errors"` // 候选策略下出错的检查器及次数
+}
+
+type safetyDryRunKey struct{}
+
+// withSafetyDryRun 标记当前检查为离线回放，检查器不应产生写入类副作用
+func withSafetyDryRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, safetyDryRunKey{}, true)
+}
+
+func isSafetyDryRun(ctx context.Context) bool {
+	v, _ := ctx.Value(safetyDryRunKey{}).(bool)
+	return v
+}
+
+// errSafetyReplayLimit 达到回放条数上限时终止遍历
+var errSafetyReplayLimit = errorx.New(errorx.Internal, "safety replay limit reached")
+
+// ReplaySafetyPolicy 将历史聊天审计日志中的输入（最后一条用户消息）与输出重新送入候选策略的检查链，
+// 与记录时生效的策略版本对比，统计新增拒绝与新增放行。回放不写审计、违规与封禁记录。
+func (s *safetyServiceImpl) ReplaySafetyPolicy(ctx context.Context, req *SafetyReplayRequest) (*SafetyReplayReport, error) {
+	if req == nil || req.Candidate == nil {
+		return nil, errorx.New(errorx.InvalidInput, "候选策略不能为空")
+	}
+	if s.auditRepo == nil {
+		return nil, errorx.New(errorx.Internal, "LLM audit repo 未配置")
+	}
+	if err := s.ValidateCheckers(req.Candidate.CheckersJSON); err != nil {
+		return nil, err
+	}
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultSafetyReplayLimit
+	}
+	if limit > maxSafetyReplayLimit {
+		limit = maxSafetyReplayLimit
+	}
+	filter := req.Filter
+	if filter.Action == "" {
+		filter.Action = "llm.chat"
+	}
+	var skip map[string]bool
+	report := &SafetyReplayReport{ByCategory: map[string]int{}, CandidateErrors: map[string]int{}}
+	if !req.IncludeRemoteCheckers {
+		skip = map[string]bool{}
+		for _, name := range remoteSafetyCheckers {
+			skip[name] = true
+		}
+		report.SkippedCheckers = append(report.SkippedCheckers, remoteSafetyCheckers...)
+	}
+
+	baselines := map[[2]int64]*entity.SafetyPolicy{}
+	dryCtx := withSafetyDryRun(ctx)
+	err := s.auditRepo.Iterate(ctx, filter, safetyReplayBatchSize, func(batch []*entity.AuditLog) error {
+		for _, log := range batch {
+			if report.Scanned >= limit {
+				return errSafetyReplayLimit
+			}
+			report.Scanned++
+			input, output, ok := safetyReplayTexts(log)
+			if !ok {
+				report.Skipped++
+				continue
+			}
+			baseline, err := s.replayBaseline(ctx, baselines, log)
+			if err != nil {
+				return err
+			}
+			lctx := WithSafetyUser(dryCtx, log.UserID)
+			for _, item := range []struct{ direction, text string }{
+				{entity.SafetyDirectionInput, input},
+				{entity.SafetyDirectionOutput, output},
+			} {
+				if strings.TrimSpace(item.text) == "" {
+					continue
+				}
+				report.Evaluated++
+				before := s.replayEvaluate(lctx, baseline, item.direction, item.text, skip)
+				after := s.replayEvaluate(lctx, req.Candidate, item.direction, item.text, skip)
+				for _, f := range after.Findings {
+					if f.Category == "checker_error" {
+						report.CandidateErrors[f.Checker]++
+					}
+				}
+				report.record(log, item.direction, item.text, before, after)
+			}
+		}
+		return nil
+	})
+	if err != nil && err != errSafetyReplayLimit {
+		return nil, err
+	}
+	return report, nil
+}
+
+// replayBaseline 返回审计日志记录时生效的策略版本；版本快照缺失时退回该策略的当前内容，均无则视为未启用策略
+func (s *safetyServiceImpl) replayBaseline(ctx context.Context, cache map[[2]int64]*entity.SafetyPolicy, log *entity.AuditLog) (*entity.SafetyPolicy, error) {
+	key := [2]int64{log.PolicyID, int64(log.PolicyVersion)}
+	if policy, ok := cache[key]; ok {
+		return policy, nil
+	}
+	var policy *entity.SafetyPolicy
+	if s.repo != nil && log.PolicyID > 0 {
+		v, err := s.repo.GetVersion(ctx, log.PolicyID, log.PolicyVersion)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			var snapshot entity.SafetyPolicy
+			if err := json.Unmarshal([]byte(v.SnapshotJSON), &snapshot); err == nil {
+				policy = &snapshot
+			}
+		}
+		if policy == nil {
+			if policy, err = s.repo.GetByID(ctx, log.PolicyID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	cache[key] = policy
+	return policy, nil
+}
+
+// replayEvaluate 执行检查链；策略为空或未启用时视为放行，策略配置错误时视为放行并记录 checker_error
+func (s *safetyServiceImpl) replayEvaluate(ctx context.Context, policy *entity.SafetyPolicy, direction, text string, skip map[string]bool) *SafetyResult {
+	if policy == nil || !policy.Enabled {
+		return &SafetyResult{Allowed: true, Content: text}
+	}
+	result, err := s.evaluateCheckers(ctx, policy, direction, text, skip)
+	if err != nil {
+		result = &SafetyResult{Allowed: true, Content: text}
+		result.Findings = append(result.Findings, &SafetyFinding{
+			Checker:  "policy",
+			Category: "checker_error",
+			Severity: entity.SafetySeverityLow,
+			Action:   entity.SafetyActionLog,
+			Message:  err.Error(),
+		})
+	}
+	return result
+}
+
+func (r *SafetyReplayReport) record(log *entity.AuditLog, direction, text string, before, after *SafetyResult) {
+	var change string
+	switch {
+	case before.Allowed && !after.Allowed:
+		change = SafetyReplayNewlyBlocked
+		r.NewlyBlocked++
+		r.ByCategory[after.Category]++
+	case !before.Allowed && after.Allowed:
+		change = SafetyReplayNewlyAllowed
+		r.NewlyAllowed++
+	case !before.Allowed && !after.Allowed:
+		r.BlockedBoth++
+		return
+	default:
+		return
+	}
+	if len(r.Changes) >= safetyReplayMaxChanges {
+		return
+	}
+	excerpt, _ := truncateRunes(text, safetyReplayExcerptChars)
+	category := after.Category
+	if change == SafetyReplayNewlyAllowed {
+		category = before.Category
+	}
+	r.Changes = append(r.Changes, &SafetyReplayChange{
+		AuditLogID:      log.ID,
+		UserID:          log.UserID,
+		Direction:       direction,
+		Change:          change,
+		BaselineReason:  before.Reason,
+		CandidateReason: after.Reason,
+		Category:        category,
+		Excerpt:         excerpt,
+		CreatedAt:       log.CreatedAt,
+	})
+}
+
+// safetyReplayTexts 从 llm.chat 审计日志中取出最后一条用户消息与模型输出；正文被摘要或清空时返回 false
+func safetyReplayTexts(log *entity.AuditLog) (input, output string, ok bool) {
+	var body struct {
+		Messages []Message `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(log.RequestJSON), &body); err != nil {
+		return "", "", false
+	}
+	for i := len(body.Messages) - 1; i >= 0; i-- {
+		if body.Messages[i].Role == "user" {
+			input = body.Messages[i].Content
+			break
+		}
+	}
+	var resp ChatResponse
+	if log.ResponseJSON != "" {
+		_ = json.Unmarshal([]byte(log.ResponseJSON), &resp)
+	}
+	output = resp.Content
+	return input, output, input != "" || output != ""
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"strconv"
+
+	"gochen-llm/entity"
+)
+
+type safetyScopeKey struct{}
+
+type safetyScope struct {
+	userID           int64
+	roles            []string
+	orgID            int64
+	projectID        int64
+	conversationType string
+}
+
+// WithSafetyScope 声明当前调用方所属的组织/项目，用于解析作用域安全策略。
+// 应由上层鉴权中间件按真实归属设置；未设置时沿用 WithPromptScopeChain 中的组织/项目。
+func WithSafetyScope(ctx context.Context, orgID, projectID int64) context.Context {
+	scope := safetyScopeFrom(ctx)
+	scope.orgID, scope.projectID = orgID, projectID
+	return context.WithValue(ctx, safetyScopeKey{}, scope)
+}
+
+// WithSafetyConversationType 声明会话类型（如 story），聊天流程加载会话时自动设置。
+// 类型策略优先于组织/项目策略，而用户可选择会话类型或不指定会话，故不应以类型承载比组织更严格的要求；
+// 面向用户的创建接口仅允许 router.SetCreatableConversationTypes 中的类型
+func WithSafetyConversationType(ctx context.Context, conversationType string) context.Context {
+	if conversationType == "" {
+		return ctx
+	}
+	scope := safetyScopeFrom(ctx)
+	scope.conversationType = conversationType
+	return context.WithValue(ctx, safetyScopeKey{}, scope)
+}
+
+// WithSafetyUser 声明当前请求的用户，block_ban 动作据此对用户施加冷却期
+func WithSafetyUser(ctx context.Context, userID int64) context.Context {
+	if userID <= 0 {
+		return ctx
+	}
+	scope := safetyScopeFrom(ctx)
+	scope.userID = userID
+	return context.WithValue(ctx, safetyScopeKey{}, scope)
+}
+
+// WithSafetyRoles 声明当前用户的角色，用于匹配策略中的豁免规则（ExemptionsJSON）
+func WithSafetyRoles(ctx context.Context, roles ...string) context.Context {
+	if len(roles) == 0 {
+		return ctx
+	}
+	scope := safetyScopeFrom(ctx)
+	scope.roles = roles
+	return context.WithValue(ctx, safetyScopeKey{}, scope)
+}
+
+func safetyScopeFrom(ctx context.Context) safetyScope {
+	scope, ok := ctx.Value(safetyScopeKey{}).(safetyScope)
+	if !ok {
+		parents, _ := ctx.Value(promptScopeParentsKey{}).([]entity.PromptScopeRef)
+		for _, ref := range parents {
+			switch ref.Scope {
+			case entity.PromptScopeOrg:
+				scope.orgID = ref.ScopeID
+			case entity.PromptScopeProject:
+				scope.projectID = ref.ScopeID
+			}
+		}
+	}
+	return scope
+}
+
+// safetyScopeChain 由具体到宽泛：conversation_type → project → org（全局由仓储层追加）
+func safetyScopeChain(ctx context.Context) []entity.SafetyScopeRef {
+	scope := safetyScopeFrom(ctx)
+	var chain []entity.SafetyScopeRef
+	if scope.conversationType != "" {
+		chain = append(chain, entity.SafetyScopeRef{Scope: entity.SafetyScopeConversationType, Key: scope.conversationType})
+	}
+	if scope.projectID > 0 {
+		chain = append(chain, entity.SafetyScopeRef{Scope: entity.SafetyScopeProject, Key: strconv.FormatInt(scope.projectID, 10)})
+	}
+	if scope.orgID > 0 {
+		chain = append(chain, entity.SafetyScopeRef{Scope: entity.SafetyScopeOrg, Key: strconv.FormatInt(scope.orgID, 10)})
+	}
+	return chain
+}
+
+// ValidSafetyScope 校验作用域类型与键
+func ValidSafetyScope(scope, key string) bool {
+	switch scope {
+	case "", entity.SafetyScopeGlobal:
+		return key == ""
+	case entity.SafetyScopeOrg, entity.SafetyScopeProject:
+		id, err := strconv.ParseInt(key, 10, 64)
+		return err == nil && id > 0
+	case entity.SafetyScopeConversationType:
+		return key != ""
+	default:
+		return false
+	}
+}
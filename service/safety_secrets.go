@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+// secretPatterns 凭据类字符串的检测规则，按顺序执行；私钥块优先，避免其内容被其他规则部分掩码
+var secretPatterns = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"private_key", regexp.MustCompile(`(?s)-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY-----.*?(?:-----END (?:[A-Z0-9]+ )*PRIVATE KEY-----|$)`)},
+	{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA|AIPA)[A-Z0-9]{16}\b`)},
+	{"aws_secret_key", regexp.MustCompile(`(?i)\baws_?secret_?(?:access_?)?key\b["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}`)},
+	{"github_token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{60,})\b`)},
+	{"google_api_key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{"openai_api_key", regexp.MustCompile(`\bsk-(?:proj-|ant-)?[A-Za-z0-9_-]{20,}\b`)},
+	{"slack_token", regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`)},
+}
+
+// secretCheckerConfig secret 检查器配置
+type secretCheckerConfig struct {
+	Disabled []string `json:"disabled"` // 停用的规则名称
+}
+
+// secretChecker 检测模型输出中回显的凭据（云厂商密钥、JWT、私钥块等），默认掩码并记为高严重度
+type secretChecker struct{}
+
+func (secretChecker) Name() string         { return "secret" }
+func (secretChecker) Directions() []string { return []string{entity.SafetyDirectionOutput} }
+
+func (secretChecker) ValidateConfig(config json.RawMessage) error {
+	if len(config) == 0 {
+		return nil
+	}
+	var cfg secretCheckerConfig
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return errorx.Wrap(err, errorx.Validation, "secret 检查器配置无效")
+	}
+	for _, name := range cfg.Disabled {
+		known := false
+		for _, p := range secretPatterns {
+			known = known || p.name == name
+		}
+		if !known {
+			return errorx.New(errorx.Validation, "未知的凭据规则: "+name)
+		}
+	}
+	return nil
+}
+
+func (secretChecker) Check(ctx context.Context, in *SafetyCheckInput) (*SafetyCheckOutput, error) {
+	var cfg secretCheckerConfig
+	if len(in.Config) > 0 {
+		_ = json.Unmarshal(in.Config, &cfg)
+	}
+	disabled := map[string]bool{}
+	for _, name := range cfg.Disabled {
+		disabled[name] = true
+	}
+
+	out := &SafetyCheckOutput{Text: in.Text}
+	for _, p := range secretPatterns {
+		if disabled[p.name] {
+			continue
+		}
+		count := 0
+		out.Text = p.re.ReplaceAllStringFunc(out.Text, func(string) string {
+			count++
+			return "[SECRET:" + p.name + "]"
+		})
+		if count == 0 {
+			continue
+		}
+		out.Modified = true
+		out.Findings = append(out.Findings, &SafetyFinding{
+			Category: "secret:" + p.name,
+			Severity: entity.SafetySeverityHigh,
+			Action:   entity.SafetyActionMask,
+			Message:  fmt.Sprintf("疑似凭据泄露 %d 处", count),
+		})
+	}
+	return out, nil
+}
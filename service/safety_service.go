@@ -1,98 +1,146 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"math"
-	"regexp"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	"gochen-llm/entity"
 	"gochen-llm/repo"
 	"gochen/clock"
 	"gochen/errorx"
-	"gochen/policy/ratelimit"
+	"gochen/logging"
 )
 
 // SafetyService 聚合安全与审计能力（首版提供关键词过滤与系统安全提示）
 type SafetyService interface {
+	// GetActivePolicy 按 ctx 中的会话类型/项目/组织解析最具体的安全策略，均未配置时返回全局策略
 	GetActivePolicy(ctx context.Context) (*entity.SafetyPolicy, error)
+	// InvalidatePolicyCache 清空策略解析缓存，绕过本服务直接写入策略后调用
+	InvalidatePolicyCache()
 	BuildSystemPrompt(ctx context.Context) (string, error)
+	// ComposeSystemPrompt 按策略的组合方式合并安全提示与业务 System Prompt
+	ComposeSystemPrompt(ctx context.Context, business string) (string, error)
 	ValidateInput(ctx context.Context, input string) (*SafetyResult, error)
 	ValidateOutput(ctx context.Context, output string) (*SafetyResult, error)
 	FilterContent(ctx context.Context, content string) (string, error)
 	CheckRateLimit(ctx context.Context, userID int64) (*RateLimitResult, error)
+	// RecordTokenUsage 将实际消耗的 token 计入当前限流窗口
+	RecordTokenUsage(ctx context.Context, userID int64, tokens int) error
 	RecordAuditLog(ctx context.Context, log *entity.AuditLog) error
+	// RecordAdminChange 记录管理端写操作及其变更前后的字段差异
+	RecordAdminChange(ctx context.Context, action, resourceType string, resourceID int64, before, after any)
+	// SafetyViolationReport 汇总被拒绝的请求（按原因/类别/命中词/日期/用户），top 为各维度返回的条数
+	SafetyViolationReport(ctx context.Context, filter entity.SafetyViolationFilter, top int) (*entity.SafetyViolationReport, error)
 	DetectPII(ctx context.Context, content string) (*SafetyResult, error)
 	MaskPII(ctx context.Context, content string) (string, error)
+	// ListUserBans 列出当前生效的用户封禁
+	ListUserBans(ctx context.Context, limit, offset int) ([]*entity.UserBan, int64, error)
+	// BanUser 手动封禁用户 seconds 秒
+	BanUser(ctx context.Context, userID int64, seconds int, reason string, actorID int64) (*entity.UserBan, error)
+	// LiftUserBan 提前解除用户的全部生效封禁
+	LiftUserBan(ctx context.Context, userID, actorID int64) error
+	// SetPIIVault 替换 tokenize 掩码策略使用的令牌库，nil 时 tokenize 退化为整体替换
+	SetPIIVault(vault PIIVault)
+	// DetokenizePII 将 tokenize 策略生成的占位符还原为原文
+	DetokenizePII(ctx context.Context, text string) (string, error)
+	// ReplaySafetyPolicy 用候选策略离线回放历史聊天审计日志，报告相对记录时生效策略新增拒绝/放行的请求
+	ReplaySafetyPolicy(ctx context.Context, req *SafetyReplayRequest) (*SafetyReplayReport, error)
+	// RollbackPolicy 将策略恢复为指定历史版本的内容（生成新版本，立即生效）
+	RollbackPolicy(ctx context.Context, policyID int64, version int, actorID int64) (*entity.SafetyPolicy, error)
+	// RegisterChecker 注册自定义检查器，策略的 CheckersJSON 中可按名称引用
+	RegisterChecker(checker SafetyChecker)
+	// ValidateCheckers 校验检查链配置（检查器名称、方向、动作与各自配置）
+	ValidateCheckers(raw string) error
+	// ScanPII 按策略的 PII 配置执行检测器并应用 block/mask/log 动作；策略未配置 PII 时返回 nil
+	ScanPII(ctx context.Context, content string) (*PIIScanResult, error)
 	GetRateLimitSettings() RateLimitSettings
+	// SetRateLimitTierResolver 注册按用户解析限流等级的回调，优先于等级分配表
+	SetRateLimitTierResolver(resolver RateLimitTierResolver)
+	// ResolveRateLimitTier 返回用户生效的限流等级，未分配时为 free
+	ResolveRateLimitTier(ctx context.Context, userID int64) (*entity.RateLimitTier, error)
+	// SetRateLimitBackend 切换请求频率的判定后端（如 NewRedisRateLimitBackend），nil 恢复为进程内令牌桶
+	SetRateLimitBackend(backend RateLimitBackend)
+	// SetRateLimitFailClosed 共享限流后端出错时是否拒绝请求，默认 false（退化为进程内令牌桶）
+	SetRateLimitFailClosed(failClosed bool)
+	// ListRateLimitTiers 列出内置与自定义限流等级
+	ListRateLimitTiers(ctx context.Context) ([]*entity.RateLimitTier, error)
+	SaveRateLimitTier(ctx context.Context, tier *entity.RateLimitTier) error
+	// SetUserRateLimitTier 为用户分配限流等级，tier 为空时恢复默认等级
+	SetUserRateLimitTier(ctx context.Context, userID int64, tier string, actorID int64) error
 }
 
 type safetyServiceImpl struct {
-	repo           repo.SafetyPolicyRepo
-	auditRepo      repo.AuditLogRepo
-	rateRepo       repo.RateLimitRepo
-	rateLimitPerM  int
-	rateLimitBurst int
-	rateLimiter    *ratelimit.Limiter
+	repo          repo.SafetyPolicyRepo
+	auditRepo     repo.AuditLogRepo
+	rateRepo      repo.RateLimitRepo
+	tierRepo      repo.RateLimitTierRepo
+	violationRepo repo.SafetyViolationRepo
+	pii           piiDetectorCache
+	vault         piiVaultHolder
+
+	tiersMu       sync.RWMutex
+	tiers         map[string]entity.RateLimitTier
+	tiersLoadedAt time.Time
+	tierResolver  RateLimitTierResolver
+	rateBackend   RateLimitBackend // 为 nil 时使用 localRate
+	// rateFailClosed 共享后端出错时拒绝请求而非退化为 localRate
+	rateFailClosed      bool
+	rateBackendFailures atomic.Int64 // 共享后端出错次数
+	rateBackendWarnedAt time.Time    // 上次输出后端故障告警的时间
+
+	localRate *localRateLimitBackend
+
+	checkersMu sync.RWMutex
+	checkers   map[string]SafetyChecker
+
+	logger logging.ILogger
+
+	banRepo repo.UserBanRepo
+	bansMu  sync.Mutex
+	bans    map[int64]banCacheEntry // 用户 ID → 封禁状态缓存
+	// bansSweptAt 上次清理过期缓存项的时间，见 putBanLocked
+	bansSweptAt time.Time
+
+	policiesMu      sync.Mutex
+	policies        map[string]policyCacheEntry // 作用域链 → 策略解析结果，见 resolvePolicy
+	policiesSweptAt time.Time
 }
 
-func NewSafetyService(repo repo.SafetyPolicyRepo, audit repo.AuditLogRepo, rate repo.RateLimitRepo) SafetyService {
-	svc := &safetyServiceImpl{
-		repo:           repo,
-		auditRepo:      audit,
-		rateRepo:       rate,
-		rateLimitPerM:  60,
-		rateLimitBurst: 30,
-	}
-	svc.initRateLimiter()
-	return svc
-}
-
-func (s *safetyServiceImpl) initRateLimiter() {
-	if s.rateLimitPerM <= 0 {
-		return
-	}
-	burst := s.rateLimitPerM + s.rateLimitBurst
-	if burst <= 0 {
-		burst = s.rateLimitPerM
-	}
-
-	baseClock := clock.NewRealClock()
-	cleanupWindow := 10 * time.Minute
+// defaultBanCooldown block_ban 动作的默认冷却时长
+const defaultBanCooldown = 10 * time.Minute
 
-	if s.rateLimitPerM%60 == 0 {
-		s.rateLimiter = ratelimit.New(ratelimit.Config{
-			RequestsPerSecond: s.rateLimitPerM / 60,
-			BurstSize:         burst,
-			WindowSize:        cleanupWindow,
-			Clock:             baseClock,
-		})
-		return
+func NewSafetyService(repo repo.SafetyPolicyRepo, audit repo.AuditLogRepo, rate repo.RateLimitRepo, tiers repo.RateLimitTierRepo, violations repo.SafetyViolationRepo, bans repo.UserBanRepo, vault repo.PIIVaultRepo, manager ProviderManager, logger logging.ILogger) SafetyService {
+	svc := &safetyServiceImpl{
+		repo:          repo,
+		auditRepo:     audit,
+		rateRepo:      rate,
+		tierRepo:      tiers,
+		violationRepo: violations,
+		localRate:     newLocalRateLimitBackend(),
+		banRepo:       bans,
+		bans:          map[int64]banCacheEntry{},
+		logger:        logger,
 	}
-
-	scaleFactor := 60.0
-	scaledClock := newScaledClock(baseClock, scaleFactor)
-	scaledCleanupWindow := time.Duration(float64(cleanupWindow) / scaleFactor)
-	if scaledCleanupWindow <= 0 {
-		scaledCleanupWindow = time.Second
+	if vault != nil {
+		svc.vault.set(vault)
 	}
-
-	s.rateLimiter = ratelimit.New(ratelimit.Config{
-		RequestsPerSecond: s.rateLimitPerM,
-		BurstSize:         burst,
-		WindowSize:        scaledCleanupWindow,
-		Clock:             scaledClock,
-	})
+	svc.checkers = newBuiltinSafetyCheckers(&svc.pii, &svc.vault, manager)
+	return svc
 }
 
 func (s *safetyServiceImpl) GetActivePolicy(ctx context.Context) (*entity.SafetyPolicy, error) {
 	if s.repo == nil {
 		return nil, nil
 	}
-	return s.repo.GetActive(ctx)
+	return s.resolvePolicy(ctx, safetyScopeChain(ctx))
 }
 
 func (s *safetyServiceImpl) BuildSystemPrompt(ctx context.Context) (string, error) {
@@ -103,40 +151,148 @@ func (s *safetyServiceImpl) BuildSystemPrompt(ctx context.Context) (string, erro
 	return strings.TrimSpace(policy.GlobalSystemPrompt), nil
 }
 
+func (s *safetyServiceImpl) ComposeSystemPrompt(ctx context.Context, business string) (string, error) {
+	business = strings.TrimSpace(business)
+	policy, err := s.GetActivePolicy(ctx)
+	if err != nil {
+		return "", err
+	}
+	if policy == nil || !policy.Enabled {
+		return business, nil
+	}
+	safety := strings.TrimSpace(policy.GlobalSystemPrompt)
+
+	switch policy.SystemPromptMode {
+	case entity.SystemPromptModeAppend:
+		return joinNonEmpty(business, safety), nil
+	case entity.SystemPromptModeTemplate:
+		if strings.TrimSpace(policy.SystemPromptTemplate) == "" {
+			return joinNonEmpty(safety, business), nil
+		}
+		t, err := template.New("system_prompt").Parse(policy.SystemPromptTemplate)
+		if err != nil {
+			return "", errorx.Wrap(err, errorx.Internal, "解析 System Prompt 组合模板失败")
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, map[string]string{"Safety": safety, "Business": business}); err != nil {
+			return "", errorx.Wrap(err, errorx.Internal, "渲染 System Prompt 组合模板失败")
+		}
+		return strings.TrimSpace(buf.String()), nil
+	default:
+		return joinNonEmpty(safety, business), nil
+	}
+}
+
+// ValidateSystemPromptComposition 校验 System Prompt 组合方式与模板
+func ValidateSystemPromptComposition(mode string, tmpl string) error {
+	switch mode {
+	case "", entity.SystemPromptModePrepend, entity.SystemPromptModeAppend:
+		return nil
+	case entity.SystemPromptModeTemplate:
+		if _, err := template.New("system_prompt").Parse(tmpl); err != nil {
+			return errorx.Wrap(err, errorx.Validation, "System Prompt 组合模板无效")
+		}
+		return nil
+	default:
+		return errorx.New(errorx.Validation, "不支持的 System Prompt 组合方式: "+mode)
+	}
+}
+
+func joinNonEmpty(first, second string) string {
+	if first == "" {
+		return second
+	}
+	if second == "" {
+		return first
+	}
+	return first + "\n\n" + second
+}
+
+// GetRateLimitSettings 返回内置默认等级（free）的限流参数
 func (s *safetyServiceImpl) GetRateLimitSettings() RateLimitSettings {
+	free := builtinRateLimitTiers[entity.RateLimitTierFree]
+	s.tiersMu.RLock()
+	failClosed := s.rateFailClosed
+	s.tiersMu.RUnlock()
 	return RateLimitSettings{
-		PerMinute: s.rateLimitPerM,
-		Burst:     s.rateLimitBurst,
+		PerMinute:       free.PerMinute,
+		Burst:           free.Burst,
+		FailClosed:      failClosed,
+		BackendFailures: s.rateBackendFailures.Load(),
 	}
 }
 
 func (s *safetyServiceImpl) ValidateInput(ctx context.Context, input string) (*SafetyResult, error) {
-	return s.validateText(ctx, input)
+	return s.runCheckers(ctx, entity.SafetyDirectionInput, input)
 }
 
 func (s *safetyServiceImpl) ValidateOutput(ctx context.Context, output string) (*SafetyResult, error) {
-	return s.validateText(ctx, output)
+	return s.runCheckers(ctx, entity.SafetyDirectionOutput, output)
 }
 
+// FilterContent 对输出执行检查链：拒绝时替换为提示语，掩码时返回掩码后的内容
 func (s *safetyServiceImpl) FilterContent(ctx context.Context, content string) (string, error) {
-	res, err := s.validateText(ctx, content)
-	if err != nil || res == nil || res.Allowed {
+	res, err := s.runCheckers(ctx, entity.SafetyDirectionOutput, content)
+	if res == nil {
 		return content, err
 	}
-	return "内容涉及不适宜主题，已被过滤。", nil
+	if !res.Allowed {
+		return "内容涉及不适宜主题，已被过滤。", nil
+	}
+	return res.Content, nil
+}
+
+func (s *safetyServiceImpl) RegisterChecker(checker SafetyChecker) {
+	if checker == nil || checker.Name() == "" {
+		return
+	}
+	s.checkersMu.Lock()
+	defer s.checkersMu.Unlock()
+	// 写时复制，执行中的检查链持有旧 map 不受影响
+	checkers := make(map[string]SafetyChecker, len(s.checkers)+1)
+	for name, c := range s.checkers {
+		checkers[name] = c
+	}
+	checkers[checker.Name()] = checker
+	s.checkers = checkers
+}
+
+func (s *safetyServiceImpl) ValidateCheckers(raw string) error {
+	s.checkersMu.RLock()
+	defer s.checkersMu.RUnlock()
+	return ValidateSafetyCheckers(raw, s.checkers)
 }
 
 func (s *safetyServiceImpl) CheckRateLimit(ctx context.Context, userID int64) (*RateLimitResult, error) {
 	if userID <= 0 {
 		return &RateLimitResult{Allowed: true}, nil
 	}
-
-	if s.rateLimitPerM <= 0 {
-		return &RateLimitResult{Allowed: true}, nil
+	if until, banned := s.bannedUntil(ctx, userID); banned {
+		retryAfter := int(math.Ceil(time.Until(until).Seconds()))
+		rl := newRateLimitedError("banned", retryAfter, fmt.Sprintf("因多次违规已被暂停使用，请在 %d 秒后再试", retryAfter))
+		return &RateLimitResult{Allowed: false, Reason: "banned"}, rl
+	}
+	tier, err := s.ResolveRateLimitTier(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	tokenLimit := tier.TokensPerMinute
+	if tokenLimit <= 0 {
+		tokenLimit = s.tokenLimitPerMinute(ctx)
+	}
+	result := &RateLimitResult{
+		Allowed:    true,
+		Tier:       tier.Name,
+		PerMinute:  tier.PerMinute,
+		Burst:      tier.Burst,
+		TokenLimit: tokenLimit,
+	}
+	if tier.PerMinute <= 0 && tokenLimit <= 0 {
+		return result, nil
 	}
 
 	now := time.Now()
-	allowed, retryAfter := s.allowUser(userID)
+	allowed, retryAfter, shared := s.allowUser(ctx, tier, userID)
 	windowStart := now.Truncate(time.Minute)
 
 	if s.rateRepo != nil {
@@ -144,15 +300,21 @@ func (s *safetyServiceImpl) CheckRateLimit(ctx context.Context, userID int64) (*
 		if err != nil {
 			return nil, err
 		}
-		// DB 计数作为兜底，超过 (perMin+burst) 视为超限
+		// 进程内限流时 DB 计数作为跨实例兜底，超过 (perMin+burst) 视为超限；共享后端生效时仅用于审计统计
 		if state != nil {
-			limitCap := s.rateLimitPerM + s.rateLimitBurst
+			limitCap := tier.PerMinute + tier.Burst
 			if limitCap <= 0 {
-				limitCap = s.rateLimitPerM
+				limitCap = tier.PerMinute
 			}
-			if state.RequestCount > limitCap {
+			if !shared && limitCap > 0 && state.RequestCount > limitCap {
 				allowed = false
 			}
+			// token 维度：窗口内已消耗 token 达到上限即拒绝
+			if allowed && tokenLimit > 0 && state.TokenCount >= tokenLimit {
+				result.Allowed, result.Reason = false, "token_limited"
+				retryAfter := int(math.Ceil(windowStart.Add(time.Minute).Sub(now).Seconds()))
+				return result, result.limitedError(retryAfter, "本分钟 token 用量已达上限，请稍后再试")
+			}
 		}
 	}
 
@@ -161,13 +323,28 @@ func (s *safetyServiceImpl) CheckRateLimit(ctx context.Context, userID int64) (*
 		if retryAfter > 0 {
 			msg = fmt.Sprintf("请求过于频繁，请在 %d 秒后再试", retryAfter)
 		}
-		return &RateLimitResult{
-			Allowed: false,
-			Reason:  "rate_limited",
-		}, errorx.New(errorx.Validation, msg)
+		result.Allowed, result.Reason = false, "rate_limited"
+		return result, result.limitedError(retryAfter, msg)
 	}
 
-	return &RateLimitResult{Allowed: true}, nil
+	return result, nil
+}
+
+func (s *safetyServiceImpl) RecordTokenUsage(ctx context.Context, userID int64, tokens int) error {
+	if userID <= 0 || tokens <= 0 || s.rateRepo == nil {
+		return nil
+	}
+	windowStart := time.Now().Truncate(time.Minute)
+	_, err := s.rateRepo.Increment(ctx, userID, "chat", windowStart, 60, 0, tokens)
+	return err
+}
+
+func (s *safetyServiceImpl) tokenLimitPerMinute(ctx context.Context) int {
+	policy, err := s.GetActivePolicy(ctx)
+	if err != nil || policy == nil || !policy.Enabled {
+		return 0
+	}
+	return policy.TokenLimitPerMinute
 }
 
 func (s *safetyServiceImpl) RecordAuditLog(ctx context.Context, log *entity.AuditLog) error {
@@ -178,74 +355,308 @@ func (s *safetyServiceImpl) RecordAuditLog(ctx context.Context, log *entity.Audi
 		// 兜底：无持久化时不阻断主流程
 		return nil
 	}
+	applyAuditCallsite(ctx, log)
+	if log.RequestID == "" {
+		log.RequestID = requestIDFromContext(ctx)
+	}
+	policy, err := s.GetActivePolicy(ctx)
+	if err == nil && policy != nil {
+		// 记录当时生效的策略版本，便于追溯
+		if log.PolicyID == 0 {
+			log.PolicyID, log.PolicyVersion = policy.ID, policy.Version
+		}
+		s.redactAuditLog(policy, log)
+	}
 	return s.auditRepo.Save(ctx, log)
 }
 
-func (s *safetyServiceImpl) DetectPII(ctx context.Context, content string) (*SafetyResult, error) {
-	piiRegex := regexp.MustCompile(`(?i)([A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}|\d{3,4}[- ]?\d{6,8})`)
-	if piiRegex.MatchString(content) {
-		return &SafetyResult{Allowed: false, Reason: "pii_detected"}, errorx.New(errorx.Validation, "内容包含敏感信息")
+func (s *safetyServiceImpl) RollbackPolicy(ctx context.Context, policyID int64, version int, actorID int64) (*entity.SafetyPolicy, error) {
+	if s.repo == nil {
+		return nil, errorx.New(errorx.Internal, "LLM safety repo 未配置")
 	}
-	return &SafetyResult{Allowed: true}, nil
+	current, err := s.repo.GetByID(ctx, policyID)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, errorx.New(errorx.NotFound, "安全策略不存在")
+	}
+	v, err := s.repo.GetVersion(ctx, policyID, version)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, errorx.New(errorx.NotFound, "指定版本不存在")
+	}
+	var restored entity.SafetyPolicy
+	if err := json.Unmarshal([]byte(v.SnapshotJSON), &restored); err != nil {
+		return nil, errorx.Wrap(err, errorx.Internal, "解析安全策略版本快照失败")
+	}
+	// 作用域以当前记录为准，避免快照与当前记录不一致时写到其他作用域
+	restored.Scope, restored.ScopeKey = current.Scope, current.ScopeKey
+	restored.UpdatedBy = actorID
+	if err := s.repo.Save(ctx, &restored, fmt.Sprintf("回滚到版本 %d", version)); err != nil {
+		return nil, err
+	}
+	s.InvalidatePolicyCache()
+	s.RecordAdminChange(ctx, "admin.rollback_safety_policy", "safety_policy", current.ID, current, &restored)
+	return &restored, nil
 }
 
-func (s *safetyServiceImpl) MaskPII(ctx context.Context, content string) (string, error) {
-	piiRegex := regexp.MustCompile(`(?i)([A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}|\d{3,4}[- ]?\d{6,8})`)
-	masked := piiRegex.ReplaceAllString(content, "[PII]")
-	return masked, nil
+// piiDetectors 返回策略配置的检测器，策略未启用或未配置时使用内置默认检测器
+func (s *safetyServiceImpl) piiDetectors(ctx context.Context) ([]*compiledPIIDetector, error) {
+	policy, err := s.GetActivePolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil || !policy.Enabled {
+		return defaultPIIDetectors, nil
+	}
+	return s.pii.get(policy.PIIConfigJSON)
 }
 
-func (s *safetyServiceImpl) allowUser(userID int64) (bool, int) {
-	if s.rateLimiter == nil {
-		return true, 0
+// DetectPII 存在 block/mask 动作的命中时判定为不允许，仅 log 动作的命中不影响结果
+func (s *safetyServiceImpl) DetectPII(ctx context.Context, content string) (*SafetyResult, error) {
+	detectors, err := s.piiDetectors(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var matched []string
+	for _, hit := range scanPII(detectors, content, false).Hits {
+		if hit.Action != entity.PIIActionLog {
+			matched = append(matched, hit.Detector)
+		}
 	}
-	key := fmt.Sprintf("%d", userID)
-	if s.rateLimiter.Allow(key) {
-		return true, 0
+	if len(matched) > 0 {
+		return &SafetyResult{Allowed: false, Reason: "pii_detected", Matched: matched}, errorx.New(errorx.Validation, "内容包含敏感信息")
 	}
-	return false, s.estimateRetryAfter()
+	return &SafetyResult{Allowed: true}, nil
 }
 
-func (s *safetyServiceImpl) estimateRetryAfter() int {
-	if s.rateLimitPerM <= 0 {
-		return 1
+// MaskPII 掩码全部命中（含 log 动作）
+func (s *safetyServiceImpl) MaskPII(ctx context.Context, content string) (string, error) {
+	detectors, err := s.piiDetectors(ctx)
+	if err != nil {
+		return content, err
 	}
-	refillPerSec := float64(s.rateLimitPerM) / 60.0
-	if refillPerSec <= 0 {
-		return 1
+	return scanPIIWithVault(ctx, detectors, content, true, s.vault.get()).Content, nil
+}
+
+func (s *safetyServiceImpl) ScanPII(ctx context.Context, content string) (*PIIScanResult, error) {
+	policy, err := s.GetActivePolicy(ctx)
+	if err != nil || policy == nil || !policy.Enabled || strings.TrimSpace(policy.PIIConfigJSON) == "" {
+		return nil, err
 	}
-	retryAfter := int(math.Ceil(1.0 / refillPerSec))
-	if retryAfter < 1 {
-		retryAfter = 1
+	detectors, err := s.pii.get(policy.PIIConfigJSON)
+	if err != nil {
+		return nil, err
 	}
-	return retryAfter
+	return scanPIIWithVault(ctx, detectors, content, false, s.vault.get()), nil
 }
 
-func (s *safetyServiceImpl) validateText(ctx context.Context, text string) (*SafetyResult, error) {
+// runCheckers 按策略的检查链顺序执行检查器：阻断类动作立即终止，mask 后的文本传给后续检查器；
+// 检查器自身出错时记为 log 级别的 checker_error 并继续（失败放行）。存在判定结果时写入审计日志。
+// 判定的最终动作优先取检查链配置的 action，其次取策略的严重程度动作映射，最后沿用检查器给出的动作。
+func (s *safetyServiceImpl) runCheckers(ctx context.Context, direction, text string) (*SafetyResult, error) {
+	result := &SafetyResult{Allowed: true, Content: text}
 	policy, err := s.GetActivePolicy(ctx)
 	if err != nil || policy == nil || !policy.Enabled {
-		return &SafetyResult{Allowed: true}, err
+		return result, err
+	}
+	userID := safetyScopeFrom(ctx).userID
+	if direction == entity.SafetyDirectionInput {
+		if until, banned := s.bannedUntil(ctx, userID); banned {
+			result.Allowed = false
+			result.Reason = "cooldown"
+			result.Action = entity.SafetyActionBlockBan
+			s.recordViolation(ctx, direction, policy, result)
+			retryAfter := int(math.Ceil(time.Until(until).Seconds()))
+			return result, newRateLimitedError("cooldown", retryAfter, fmt.Sprintf("因违规处于冷却期，请在 %d 秒后再试", retryAfter))
+		}
+	}
+	result, err = s.evaluateCheckers(ctx, policy, direction, text, nil)
+	if err != nil {
+		return result, err
+	}
+	if result.Action == entity.SafetyActionBlockBan {
+		cooldown := defaultBanCooldown
+		if policy.BanCooldownSeconds > 0 {
+			cooldown = time.Duration(policy.BanCooldownSeconds) * time.Second
+		}
+		s.ban(ctx, &entity.UserBan{
+			UserID: userID,
+			Source: entity.UserBanSourceBlockBan,
+			Reason: result.Category,
+			Until:  time.Now().Add(cooldown),
+		})
 	}
+	if len(result.Findings) > 0 {
+		s.recordFindings(ctx, direction, result)
+	}
+	if !result.Allowed {
+		s.recordViolation(ctx, direction, policy, result)
+	}
+	if !result.Allowed {
+		return result, errorx.New(errorx.Validation, "内容未通过安全检查："+result.Reason)
+	}
+	return result, nil
+}
 
-	var kws []string
-	if strings.TrimSpace(policy.BlockedKeywordsJSON) != "" {
-		_ = json.Unmarshal([]byte(policy.BlockedKeywordsJSON), &kws)
+// evaluateCheckers 对给定策略执行检查链并汇总判定，不产生封禁、审计与违规记录等副作用；
+// skip 中的检查器不执行（用于离线回放时跳过调用外部模型的检查器）
+func (s *safetyServiceImpl) evaluateCheckers(ctx context.Context, policy *entity.SafetyPolicy, direction, text string, skip map[string]bool) (*SafetyResult, error) {
+	result := &SafetyResult{Allowed: true, Content: text}
+	chain, err := parseSafetyCheckers(policy.CheckersJSON)
+	if err != nil {
+		return result, err
+	}
+	severityActions, err := parseSeverityActions(policy.SeverityActionsJSON)
+	if err != nil {
+		return result, err
+	}
+	exempt, err := exemptCheckers(policy, safetyScopeFrom(ctx))
+	if err != nil {
+		return result, err
 	}
 
-	lower := strings.ToLower(text)
-	for _, kw := range kws {
-		kw = strings.TrimSpace(kw)
-		if kw == "" {
+	s.checkersMu.RLock()
+	checkers := s.checkers
+	s.checkersMu.RUnlock()
+
+	for _, cfg := range chain {
+		checker, ok := checkers[cfg.Name]
+		if !ok || cfg.Disabled || skip[cfg.Name] {
+			continue
+		}
+		if exempt.covers(cfg.Name) {
+			// 豁免同样留痕，便于审查红队等账号的使用情况
+			result.Findings = append(result.Findings, &SafetyFinding{
+				Checker:  cfg.Name,
+				Category: "exempted",
+				Severity: entity.SafetySeverityLow,
+				Action:   entity.SafetyActionLog,
+				Message:  "命中豁免规则，跳过检查",
+			})
 			continue
 		}
-		if strings.Contains(lower, strings.ToLower(kw)) {
-			return &SafetyResult{
-				Allowed: false,
-				Reason:  "命中敏感词",
-			}, errorx.New(errorx.Validation, "内容命中敏感词")
+		directions := cfg.Directions
+		if len(directions) == 0 {
+			directions = checker.Directions()
+		}
+		if !containsDirection(directions, direction) {
+			continue
+		}
+		out, err := checker.Check(ctx, &SafetyCheckInput{
+			Direction: direction,
+			Text:      result.Content,
+			Policy:    policy,
+			Config:    cfg.Config,
+		})
+		if err != nil {
+			result.Findings = append(result.Findings, &SafetyFinding{
+				Checker:  cfg.Name,
+				Category: "checker_error",
+				Severity: entity.SafetySeverityLow,
+				Action:   entity.SafetyActionLog,
+				Message:  err.Error(),
+			})
+			continue
+		}
+		if out == nil {
+			continue
+		}
+		masked := false
+		for _, f := range out.Findings {
+			f.Checker = cfg.Name
+			switch {
+			case cfg.Action != "":
+				f.Action = cfg.Action
+			case severityActions[f.Severity] != "":
+				f.Action = severityActions[f.Severity]
+			}
+			result.Findings = append(result.Findings, f)
+			if isBlockingSafetyAction(f.Action) && result.Allowed {
+				result.Allowed = false
+				result.Reason = f.Message
+				if result.Reason == "" {
+					result.Reason = f.Category
+				}
+			}
+			if f.Action != entity.SafetyActionLog {
+				result.Matched = append(result.Matched, f.Category)
+			}
+			masked = masked || f.Action == entity.SafetyActionMask
+		}
+		if !result.Allowed {
+			break
+		}
+		if out.Modified && masked {
+			result.Content = out.Text
 		}
 	}
-	return &SafetyResult{Allowed: true}, nil
+
+	summarizeFindings(result)
+	return result, nil
+}
+
+// summarizeFindings 汇总判定：Action 取最强动作，Category/Severity 取最严重的判定（同级取动作更强者）
+func summarizeFindings(result *SafetyResult) {
+	var top *SafetyFinding
+	seen := map[string]bool{}
+	for _, f := range result.Findings {
+		if safetyActionRank(f.Action) > safetyActionRank(result.Action) {
+			result.Action = f.Action
+		}
+		if top == nil || safetySeverityRank(f.Severity) > safetySeverityRank(top.Severity) ||
+			(safetySeverityRank(f.Severity) == safetySeverityRank(top.Severity) && safetyActionRank(f.Action) > safetyActionRank(top.Action)) {
+			top = f
+		}
+		for _, term := range f.Terms {
+			if !seen[term] {
+				seen[term] = true
+				result.MatchedTerms = append(result.MatchedTerms, term)
+			}
+		}
+	}
+	if top != nil {
+		result.Category, result.Severity = top.Category, top.Severity
+	}
+}
+
+func (s *safetyServiceImpl) recordFindings(ctx context.Context, direction string, result *SafetyResult) {
+	status := entity.SafetyActionLog
+	if result.Action != "" {
+		status = result.Action
+	}
+	detail, _ := json.Marshal(map[string]any{
+		"direction":     direction,
+		"category":      result.Category,
+		"severity":      result.Severity,
+		"matched_terms": result.MatchedTerms,
+		"findings":      result.Findings,
+	})
+	_ = s.RecordAuditLog(ctx, &entity.AuditLog{
+		UserID:       safetyScopeFrom(ctx).userID,
+		Action:       "llm.safety_check",
+		ResourceType: "chat",
+		RequestJSON:  string(detail),
+		Status:       status,
+	})
+}
+
+func safetySeverityRank(severity string) int {
+	switch severity {
+	case entity.SafetySeverityCritical:
+		return 4
+	case entity.SafetySeverityHigh:
+		return 3
+	case entity.SafetySeverityMedium:
+		return 2
+	case entity.SafetySeverityLow:
+		return 1
+	default:
+		return 0
+	}
 }
 
 type scaledClock struct {
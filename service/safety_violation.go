@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"unicode/utf8"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+// maxViolationReasonRunes 违规原因的最大保存长度（与表字段长度一致）
+const maxViolationReasonRunes = 200
+
+// recordViolation 记录一次被拒绝的请求，仅保存判定元数据；写入失败不影响检查结果
+func (s *safetyServiceImpl) recordViolation(ctx context.Context, direction string, policy *entity.SafetyPolicy, result *SafetyResult) {
+	if s.violationRepo == nil || result == nil || result.Allowed {
+		return
+	}
+	v := &entity.SafetyViolation{
+		UserID:    safetyScopeFrom(ctx).userID,
+		Direction: direction,
+		Action:    result.Action,
+		Reason:    result.Reason,
+		Category:  result.Category,
+		Severity:  result.Severity,
+	}
+	if utf8.RuneCountInString(v.Reason) > maxViolationReasonRunes {
+		v.Reason = string([]rune(v.Reason)[:maxViolationReasonRunes])
+	}
+	if policy != nil {
+		v.PolicyID = policy.ID
+	}
+	for _, f := range result.Findings {
+		if isBlockingSafetyAction(f.Action) {
+			v.Checker = f.Checker
+			break
+		}
+	}
+	if len(result.MatchedTerms) > 0 {
+		data, _ := json.Marshal(result.MatchedTerms)
+		v.MatchedTermsJSON = string(data)
+	}
+	if err := s.violationRepo.Save(ctx, v); err != nil || result.Reason == "cooldown" {
+		return
+	}
+	s.escalate(ctx, policy, v.UserID)
+}
+
+func (s *safetyServiceImpl) SafetyViolationReport(ctx context.Context, filter entity.SafetyViolationFilter, top int) (*entity.SafetyViolationReport, error) {
+	if s.violationRepo == nil {
+		return nil, errorx.New(errorx.Internal, "违规记录 repo 未配置")
+	}
+	return s.violationRepo.Report(ctx, filter, top)
+}
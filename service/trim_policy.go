@@ -0,0 +1,374 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gochen-llm/client"
+	"gochen-llm/entity"
+)
+
+// 历史消息裁剪策略
+const (
+	// TrimStrategyDropOldest 从最早的消息开始丢弃
+	TrimStrategyDropOldest = "drop_oldest"
+	// TrimStrategyDropMiddle 保留开头（设定/首轮问题）与最近消息，丢弃中间部分
+	TrimStrategyDropMiddle = "drop_middle"
+	// TrimStrategySummarizeOldest 将被丢弃的早期消息压缩为摘要注入 System Prompt
+	TrimStrategySummarizeOldest = "summarize_oldest"
+	// TrimStrategyImportance 按重要度评分保留消息（近期、用户提问、含“记住/重要”等优先）
+	TrimStrategyImportance = "importance"
+)
+
+// trimSummaryCacheTTL summarize_oldest 生成的早期对话摘要的缓存时间
+const trimSummaryCacheTTL = 10 * time.Minute
+
+const trimSummaryPrefix = "[此前对话摘要]\n"
+
+type trimSummaryEntry struct {
+	summary   string
+	createdAt time.Time
+}
+
+const (
+	defaultTrimMaxTokens  = 3000
+	defaultTrimKeepRecent = 4
+	// drop_middle 保留的开头消息数
+	trimHeadMessages = 2
+)
+
+// TrimPolicy 会话历史裁剪策略，按会话类型配置，会话元数据中的 trim_policy 可覆盖
+type TrimPolicy struct {
+	Strategy   string `json:"strategy"`    // 裁剪策略，默认 drop_oldest
+	MaxTokens  int    `json:"max_tokens"`  // 历史消息的估算 token 预算，默认 3000
+	KeepRecent int    `json:"keep_recent"` // 始终保留的最近消息数，默认 4
+}
+
+// defaultTrimPolicies 各会话类型的默认裁剪策略
+func defaultTrimPolicies() map[string]*TrimPolicy {
+	return map[string]*TrimPolicy{
+		entity.ConversationTypeChat:  {Strategy: TrimStrategyDropOldest, MaxTokens: defaultTrimMaxTokens, KeepRecent: defaultTrimKeepRecent},
+		entity.ConversationTypeStory: {Strategy: TrimStrategySummarizeOldest, MaxTokens: 6000, KeepRecent: 6},
+	}
+}
+
+func (p *TrimPolicy) normalized() TrimPolicy {
+	out := TrimPolicy{Strategy: TrimStrategyDropOldest, MaxTokens: defaultTrimMaxTokens, KeepRecent: defaultTrimKeepRecent}
+	if p == nil {
+		return out
+	}
+	if s := strings.TrimSpace(p.Strategy); s != "" {
+		out.Strategy = s
+	}
+	if p.MaxTokens > 0 {
+		out.MaxTokens = p.MaxTokens
+	}
+	if p.KeepRecent > 0 {
+		out.KeepRecent = p.KeepRecent
+	}
+	return out
+}
+
+func (s *chatServiceImpl) SetTrimPolicy(conversationType string, policy *TrimPolicy) {
+	conversationType = strings.TrimSpace(conversationType)
+	if conversationType == "" {
+		return
+	}
+	s.trimMu.Lock()
+	defer s.trimMu.Unlock()
+	if policy == nil {
+		delete(s.trimPolicies, conversationType)
+		return
+	}
+	p := *policy
+	s.trimPolicies[conversationType] = &p
+}
+
+// resolveTrimPolicy 会话元数据 trim_policy 优先，其次按会话类型配置
+func (s *chatServiceImpl) resolveTrimPolicy(conv *entity.Conversation) TrimPolicy {
+	if conv != nil && strings.TrimSpace(conv.MetadataJSON) != "" {
+		var meta struct {
+			TrimPolicy *TrimPolicy `json:"trim_policy"`
+		}
+		if err := json.Unmarshal([]byte(conv.MetadataJSON), &meta); err == nil && meta.TrimPolicy != nil {
+			return meta.TrimPolicy.normalized()
+		}
+	}
+	convType := entity.ConversationTypeChat
+	if conv != nil && conv.Type != "" {
+		convType = conv.Type
+	}
+	s.trimMu.RLock()
+	defer s.trimMu.RUnlock()
+	return s.trimPolicies[convType].normalized()
+}
+
+// trimHistory 按会话的裁剪策略裁剪历史消息，返回保留的消息与（可选的）早期对话摘要
+func (s *chatServiceImpl) trimHistory(ctx context.Context, req *ChatRequest, conv *entity.Conversation) ([]Message, string) {
+	policy := s.resolveTrimPolicy(conv)
+	if estimateMessagesTokens(req.Messages) <= policy.MaxTokens {
+		return req.Messages, ""
+	}
+
+	var kept []Message
+	var summary string
+	switch policy.Strategy {
+	case TrimStrategyDropMiddle:
+		kept = trimDropMiddle(req.Messages, policy)
+	case TrimStrategySummarizeOldest:
+		kept = trimDropOldest(req.Messages, policy)
+		dropped := req.Messages[:len(req.Messages)-len(kept)]
+		summary = s.summarizeDropped(ctx, req, conv, dropped)
+	case TrimStrategyImportance:
+		kept = trimByImportance(req.Messages, policy)
+	default:
+		kept = trimDropOldest(req.Messages, policy)
+	}
+
+	if req.Metadata == nil {
+		req.Metadata = map[string]interface{}{}
+	}
+	req.Metadata["history_trimmed"] = map[string]any{
+		"strategy": policy.Strategy,
+		"original": len(req.Messages),
+		"kept":     len(kept),
+	}
+	return kept, summary
+}
+
+// summarizeDropped 返回被裁剪的早期对话摘要：会话已有滚动摘要时直接复用（由会话服务随新消息增量维护），
+// 否则调用模型压缩，结果按用户、会话与被裁剪消息缓存 trimSummaryCacheTTL，避免每次请求重复压缩
+func (s *chatServiceImpl) summarizeDropped(ctx context.Context, req *ChatRequest, conv *entity.Conversation, dropped []Message) string {
+	if len(dropped) == 0 {
+		return ""
+	}
+	if conv != nil && strings.TrimSpace(conv.Summary) != "" {
+		return trimSummaryPrefix + strings.TrimSpace(conv.Summary)
+	}
+	key := trimSummaryKey(req, dropped)
+	now := time.Now()
+	s.trimMu.RLock()
+	entry, ok := s.trimSummaries[key]
+	s.trimMu.RUnlock()
+	if ok && now.Sub(entry.createdAt) < trimSummaryCacheTTL {
+		return entry.summary
+	}
+
+	summary := s.summarizeMessages(ctx, req, dropped)
+	if summary == "" {
+		return ""
+	}
+	s.trimMu.Lock()
+	if now.Sub(s.trimSummariesSweptAt) >= trimSummaryCacheTTL {
+		s.trimSummariesSweptAt = now
+		for k, e := range s.trimSummaries {
+			if now.Sub(e.createdAt) >= trimSummaryCacheTTL {
+				delete(s.trimSummaries, k)
+			}
+		}
+	}
+	s.trimSummaries[key] = trimSummaryEntry{summary: summary, createdAt: now}
+	s.trimMu.Unlock()
+	return summary
+}
+
+// summarizeMessages 调用模型压缩早期对话并记录该次调用的指标、成本与审计，失败时返回空字符串（退化为直接丢弃）
+func (s *chatServiceImpl) summarizeMessages(ctx context.Context, req *ChatRequest, msgs []Message) string {
+	if s.manager == nil || len(msgs) == 0 {
+		return ""
+	}
+	clientReq := &client.ChatRequest{
+		System:      "请将以下对话压缩为简洁的要点摘要，保留人物、事实、约定与未完成的问题，不要添加新内容。",
+		Messages:    []client.ChatMessage{{Role: "user", Content: joinMessages(msgs)}},
+		Temperature: 0,
+		MaxTokens:   512,
+	}
+	resp, provider, model, latencyMs, inPricePer1k, outPricePer1k, err := s.manager.ChatForUser(ctx, req.UserID, clientReq)
+	if err != nil || resp == nil || strings.TrimSpace(resp.Content) == "" {
+		return ""
+	}
+	usage := providerUsage(resp.Usage)
+	if usage == nil {
+		usage = estimateUsage(clientReq.System, msgs, resp.Content)
+	}
+	s.recordTrimSummaryUsage(ctx, req, provider, model, latencyMs, inPricePer1k, outPricePer1k, usage)
+	return trimSummaryPrefix + strings.TrimSpace(resp.Content)
+}
+
+// recordTrimSummaryUsage 早期对话压缩同样消耗 token，按与主调用相同的口径计入指标、成本、限流窗口、会话用量与审计
+func (s *chatServiceImpl) recordTrimSummaryUsage(ctx context.Context, req *ChatRequest, provider, model string, latencyMs int64, inPricePer1k, outPricePer1k float64, usage *TokenUsage) {
+	cost := 0.0
+	if s.costCalc != nil {
+		cost = s.costCalc.EstimateCost(ctx, provider, model, usage, inPricePer1k, outPricePer1k)
+	}
+	if s.metricsRepo != nil {
+		_ = s.metricsRepo.Save(ctx, &entity.Metrics{
+			Provider:       provider,
+			Model:          model,
+			RequestID:      requestIDFromContext(ctx),
+			UserID:         req.UserID,
+			ConversationID: req.ConversationID,
+			OrgID:          safetyScopeFrom(ctx).orgID,
+			RequestTokens:  usage.RequestTokens,
+			ResponseTokens: usage.ResponseTokens,
+			TotalTokens:    usage.TotalTokens,
+			CachedTokens:   usage.CachedTokens,
+			LatencyMs:      int(latencyMs),
+			Status:         "ok",
+			Outcome:        "trim_summary",
+			CostUSD:        cost,
+			IsTest:         isTestTraffic(req),
+			CreatedAt:      time.Now(),
+		})
+	}
+	if s.safety != nil {
+		_ = s.safety.RecordTokenUsage(ctx, req.UserID, usage.TotalTokens)
+	}
+	if req.ConversationID > 0 && s.conversations != nil {
+		_ = s.conversations.RecordUsage(ctx, req.ConversationID, usage, cost)
+	}
+	if s.safety != nil {
+		detail, _ := json.Marshal(map[string]any{
+			"provider":     provider,
+			"model":        model,
+			"total_tokens": usage.TotalTokens,
+			"cost_usd":     cost,
+		})
+		_ = s.safety.RecordAuditLog(ctx, &entity.AuditLog{
+			UserID:       req.UserID,
+			Action:       "llm.trim_summary",
+			ResourceType: "conversation",
+			ResourceID:   req.ConversationID,
+			RequestJSON:  string(detail),
+			Status:       "ok",
+		})
+	}
+}
+
+// trimSummaryKey 被裁剪消息的指纹，同一会话的裁剪边界不变时命中缓存
+func trimSummaryKey(req *ChatRequest, dropped []Message) string {
+	h := sha256.New()
+	for _, m := range dropped {
+		h.Write([]byte(m.Role))
+		h.Write([]byte{0})
+		h.Write([]byte(m.Content))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%d:%d:%s", req.UserID, req.ConversationID, hex.EncodeToString(h.Sum(nil)))
+}
+
+func estimateMessageTokens(m Message) int {
+	return (len([]rune(m.Content)) + 3) / 4
+}
+
+func estimateMessagesTokens(msgs []Message) int {
+	total := 0
+	for _, m := range msgs {
+		total += estimateMessageTokens(m)
+	}
+	return total
+}
+
+// trimDropOldest 从末尾向前保留消息直到用尽预算，最近 KeepRecent 条始终保留
+func trimDropOldest(msgs []Message, policy TrimPolicy) []Message {
+	used := 0
+	start := len(msgs)
+	for i := len(msgs) - 1; i >= 0; i-- {
+		cost := estimateMessageTokens(msgs[i])
+		if len(msgs)-i > policy.KeepRecent && used+cost > policy.MaxTokens {
+			break
+		}
+		used += cost
+		start = i
+	}
+	return msgs[start:]
+}
+
+// trimDropMiddle 保留开头若干条与尽可能多的近期消息
+func trimDropMiddle(msgs []Message, policy TrimPolicy) []Message {
+	head := trimHeadMessages
+	if head > len(msgs)-policy.KeepRecent {
+		head = len(msgs) - policy.KeepRecent
+	}
+	if head <= 0 {
+		return trimDropOldest(msgs, policy)
+	}
+	headTokens := estimateMessagesTokens(msgs[:head])
+	rest := policy
+	rest.MaxTokens = policy.MaxTokens - headTokens
+	tail := trimDropOldest(msgs[head:], rest)
+
+	kept := make([]Message, 0, head+len(tail))
+	kept = append(kept, msgs[:head]...)
+	return append(kept, tail...)
+}
+
+var importanceKeywords = []string{"记住", "重要", "务必", "不要忘", "remember", "important", "must", "always", "never"}
+
+// trimByImportance 最近 KeepRecent 条必留，其余按重要度从高到低填充预算，保持原有顺序
+func trimByImportance(msgs []Message, policy TrimPolicy) []Message {
+	n := len(msgs)
+	keep := make([]bool, n)
+	used := 0
+	for i := n - 1; i >= 0 && n-i <= policy.KeepRecent; i-- {
+		keep[i] = true
+		used += estimateMessageTokens(msgs[i])
+	}
+
+	type scored struct {
+		idx   int
+		score float64
+	}
+	candidates := make([]scored, 0, n)
+	for i := 0; i < n; i++ {
+		if !keep[i] {
+			candidates = append(candidates, scored{idx: i, score: messageImportance(msgs[i], i, n)})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	for _, c := range candidates {
+		cost := estimateMessageTokens(msgs[c.idx])
+		if used+cost > policy.MaxTokens {
+			continue
+		}
+		keep[c.idx] = true
+		used += cost
+	}
+
+	kept := make([]Message, 0, n)
+	for i, m := range msgs {
+		if keep[i] {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+func messageImportance(m Message, idx int, total int) float64 {
+	score := float64(idx+1) / float64(total) // 越新越重要
+	if m.Role == "" || m.Role == "user" {
+		score += 0.3
+	}
+	if idx == 0 {
+		score += 0.5 // 首条消息通常包含任务设定
+	}
+	lower := strings.ToLower(m.Content)
+	for _, kw := range importanceKeywords {
+		if strings.Contains(lower, kw) {
+			score += 1
+			break
+		}
+	}
+	if strings.ContainsAny(m.Content, "?？") {
+		score += 0.2
+	}
+	return score
+}
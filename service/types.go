@@ -1,20 +1,31 @@
 package service
 
-import "gochen-llm/entity"
+import (
+	"context"
+	"time"
+
+	"gochen-llm/entity"
+)
 
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// Attachments 消息附件，发送前抽取文本渲染进 Content，图片按多模态内容传给支持的 provider
+	Attachments []*Attachment `json:"attachments,omitempty"`
 }
 
 // ChatRequest 通用聊天请求
 type ChatRequest struct {
-	UserID      int64                  `json:"user_id"`
-	System      string                 `json:"system"`
-	Messages    []Message              `json:"messages"`
-	Temperature float32                `json:"temperature"`
-	MaxTokens   int                    `json:"max_tokens"`
-	Metadata    map[string]interface{} `json:"metadata"`
+	UserID         int64                  `json:"user_id"`
+	ConversationID int64                  `json:"conversation_id,omitempty"` // 所属会话，绑定模板时自动作为 System Prompt
+	System         string                 `json:"system"`
+	Messages       []Message              `json:"messages"`
+	Temperature    float32                `json:"temperature"`
+	MaxTokens      int                    `json:"max_tokens"`
+	Metadata       map[string]interface{} `json:"metadata"`
+	Language       string                 `json:"language,omitempty"` // 期望输出语言（如 zh/en），auto 或空表示按策略检测
+	// NoDedup 跳过重复请求合并（如 best-of-N 需要独立采样）
+	NoDedup bool `json:"-"`
 }
 
 // PromptChatRequest 基于提示词的聊天请求
@@ -23,58 +34,130 @@ type PromptChatRequest struct {
 	PromptName    string                 `json:"prompt_name"`
 	PromptScope   entity.PromptScope     `json:"prompt_scope"`
 	PromptScopeID int64                  `json:"prompt_scope_id"`
+	PromptVersion int                    `json:"prompt_version,omitempty"` // 固定模板版本，为空使用最新版本
 	ABTestID      int64                  `json:"ab_test_id,omitempty"`
 	Variables     map[string]interface{} `json:"variables"`
 	Messages      []Message              `json:"messages"`
-	Temperature   float32                `json:"temperature"`
+	Temperature   *float32               `json:"temperature,omitempty"` // 为空时采用模板推荐值，显式 0 表示确定性输出
 	MaxTokens     int                    `json:"max_tokens"`
 	Metadata      map[string]interface{} `json:"metadata"`
+	Language      string                 `json:"language,omitempty"`
+	Locale        string                 `json:"locale,omitempty"` // 模板语言区域（如 zh-CN），为空时按 Language 解析
 }
 
 type ChatResponse struct {
 	Content      string                 `json:"content"`
 	FinishReason string                 `json:"finish_reason"`
+	Degraded     bool                   `json:"degraded,omitempty"` // 是否为降级（兜底）回复
 	Usage        *TokenUsage            `json:"usage,omitempty"`
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
 }
 
+// BestOfN 采样模式
+const (
+	// BestOfNModeSamples 同一请求重复采样 N 次（按常规路由选端点）
+	BestOfNModeSamples = "samples"
+	// BestOfNModeProviders 同一请求分发到 N 个不同端点
+	BestOfNModeProviders = "providers"
+)
+
+// CandidateScorer 对候选响应打分，分数越高越好
+type CandidateScorer func(ctx context.Context, req *ChatRequest, candidate *ChatResponse, all []*ChatResponse) (float64, error)
+
+// BestOfNRequest 多候选采样请求，适用于高风险/高价值的生成场景
+type BestOfNRequest struct {
+	ChatRequest
+	N           int             `json:"n"`            // 候选数量，默认 3，最大 8
+	Mode        string          `json:"mode"`         // samples / providers，默认 samples
+	JudgePrompt string          `json:"judge_prompt"` // 非空时使用裁判模型打分（System Prompt）
+	Scorer      CandidateScorer `json:"-"`            // 自定义打分函数，优先级高于 JudgePrompt
+}
+
+// ChatChunk 流式回复分片；流的最后一个分片 Done 为 true，携带结束原因、用量与元数据（含 request_id），
+// 调用失败时最后一个分片只携带 Err
 type ChatChunk struct {
-	Content string `json:"content"`
+	Content      string                 `json:"content"`
+	Done         bool                   `json:"done,omitempty"`
+	FinishReason string                 `json:"finish_reason,omitempty"`
+	Usage        *TokenUsage            `json:"usage,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	Err          error                  `json:"-"`
 }
 
 type TokenUsage struct {
 	RequestTokens  int `json:"request_tokens"`
 	ResponseTokens int `json:"response_tokens"`
 	TotalTokens    int `json:"total_tokens"`
+	// CachedTokens RequestTokens 中命中 provider 提示缓存的部分，仅 provider 返回用量时可用
+	CachedTokens int `json:"cached_tokens,omitempty"`
 }
 
 type SafetyResult struct {
-	Allowed bool   `json:"allowed"`
-	Reason  string `json:"reason,omitempty"`
+	Allowed bool     `json:"allowed"`
+	Reason  string   `json:"reason,omitempty"`
+	Matched []string `json:"matched,omitempty"` // 命中的检测器/类别名称
+
+	// 以下为最严重判定的汇总：Action 为实际生效的最强动作（log/mask/block/block_ban）
+	Category     string   `json:"category,omitempty"`
+	Severity     string   `json:"severity,omitempty"`
+	Action       string   `json:"action,omitempty"`
+	MatchedTerms []string `json:"matched_terms,omitempty"` // 命中的关键词/片段（凭据与 PII 不回显原文）
+
+	Findings []*SafetyFinding `json:"findings,omitempty"` // 检查链的全部判定结果
+	Content  string           `json:"-"`                  // 掩码后的内容
 }
 
 type RateLimitResult struct {
 	Allowed bool   `json:"allowed"`
 	Reason  string `json:"reason,omitempty"`
+
+	// 生效的限流等级及其额度（0 表示该维度不限制）
+	Tier       string `json:"tier,omitempty"`
+	PerMinute  int    `json:"per_minute,omitempty"`
+	Burst      int    `json:"burst,omitempty"`
+	TokenLimit int    `json:"token_limit,omitempty"`
+}
+
+// limitedError 由拒绝结果生成携带额度信息的 RateLimitedError
+func (r *RateLimitResult) limitedError(retryAfter int, msg string) *RateLimitedError {
+	e := newRateLimitedError(r.Reason, retryAfter, msg)
+	e.Tier, e.PerMinute, e.Burst, e.TokenLimit = r.Tier, r.PerMinute, r.Burst, r.TokenLimit
+	return e
 }
 
 type RateLimitSettings struct {
-	PerMinute int `json:"per_minute"`
-	Burst     int `json:"burst"`
+	PerMinute       int   `json:"per_minute"`
+	Burst           int   `json:"burst"`
+	FailClosed      bool  `json:"fail_closed"`      // 共享限流后端出错时是否拒绝请求
+	BackendFailures int64 `json:"backend_failures"` // 进程启动以来共享限流后端出错次数
 }
 
+// CostFilter 成本报表的筛选与分组条件；GroupBy 取 user/org/prompt_template/model/endpoint，Top<=0 时取默认值
 type CostFilter struct {
-	Provider string
-	Model    string
-	UserID   *int64
+	Provider         string
+	Model            string
+	Endpoint         string
+	UserID           *int64
+	OrgID            *int64
+	PromptTemplateID *int64
+	StartAt          *time.Time
+	EndAt            *time.Time
+	GroupBy          string
+	Top              int
 }
 
+// CostReport 成本报表：EstimatedCostUSD/TotalTokens 为筛选范围内的总量，Items 为成本最高的前 Top 组，
+// Others 为其余各组的合计（无剩余时为空）
 type CostReport struct {
-	EstimatedCostUSD float64 `json:"estimated_cost_usd"`
-	TotalTokens      int     `json:"total_tokens"`
+	EstimatedCostUSD float64                 `json:"estimated_cost_usd"`
+	TotalTokens      int                     `json:"total_tokens"`
+	TotalCalls       int                     `json:"total_calls"`
+	GroupBy          string                  `json:"group_by"`
+	Items            []*entity.CostBreakdown `json:"items"`
+	Others           *entity.CostBreakdown   `json:"others,omitempty"`
 }
 
-// CostCalculator 估算成本（简化：按 provider/model 的固定单价）
+// CostCalculator 估算成本：按价格表（ModelPricingService）中当前生效的计费规则计算，端点配置的单价覆盖其中的基础输入/输出单价
 type CostCalculator interface {
-	EstimateCost(provider string, model string, requestTokens int, responseTokens int, inputPer1k float64, outputPer1k float64) float64
+	EstimateCost(ctx context.Context, provider string, model string, usage *TokenUsage, inputPer1k float64, outputPer1k float64) float64
 }
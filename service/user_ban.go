@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen/errorx"
+)
+
+// banCacheTTL 封禁状态的本地缓存时长；其他实例解除封禁后，本实例最多延迟该时长生效
+const banCacheTTL = 30 * time.Second
+
+// banCacheEntry 本地缓存的封禁状态，until 为零值表示未封禁
+type banCacheEntry struct {
+	until     time.Time
+	checkedAt time.Time
+}
+
+func parseBanEscalation(raw string) ([]entity.BanEscalationRule, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var rules []entity.BanEscalationRule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, errorx.Wrap(err, errorx.Validation, "违规升级规则配置无效")
+	}
+	for i, rule := range rules {
+		if rule.Violations <= 0 || rule.WindowSeconds <= 0 || rule.BanSeconds <= 0 {
+			return nil, errorx.New(errorx.Validation, fmt.Sprintf("第 %d 条违规升级规则的 violations/window_seconds/ban_seconds 需为正数", i+1))
+		}
+	}
+	return rules, nil
+}
+
+// ValidateBanEscalation 校验违规升级规则配置
+func ValidateBanEscalation(raw string) error {
+	_, err := parseBanEscalation(raw)
+	return err
+}
+
+// escalate 统计用户在各规则窗口内的违规次数，命中规则时按最长的封禁时长封禁；已有更长的封禁时不重复写入
+func (s *safetyServiceImpl) escalate(ctx context.Context, policy *entity.SafetyPolicy, userID int64) {
+	if policy == nil || userID <= 0 || s.violationRepo == nil {
+		return
+	}
+	rules, err := parseBanEscalation(policy.BanEscalationJSON)
+	if err != nil || len(rules) == 0 {
+		return
+	}
+	now := time.Now()
+	var hit *entity.BanEscalationRule
+	var hitCount int64
+	for i, rule := range rules {
+		if hit != nil && rule.BanSeconds <= hit.BanSeconds {
+			continue
+		}
+		count, err := s.violationRepo.CountSince(ctx, userID, now.Add(-time.Duration(rule.WindowSeconds)*time.Second))
+		if err != nil {
+			return
+		}
+		if count >= int64(rule.Violations) {
+			hit, hitCount = &rules[i], count
+		}
+	}
+	if hit == nil {
+		return
+	}
+	until := now.Add(time.Duration(hit.BanSeconds) * time.Second)
+	if current, banned := s.bannedUntil(ctx, userID); banned && !current.Before(until) {
+		return
+	}
+	s.ban(ctx, &entity.UserBan{
+		UserID:         userID,
+		Source:         entity.UserBanSourceEscalation,
+		Reason:         fmt.Sprintf("%d 秒内违规 %d 次", hit.WindowSeconds, hitCount),
+		ViolationCount: int(hitCount),
+		Until:          until,
+	})
+}
+
+// ban 施加封禁：写入本地缓存，并在配置了仓储时持久化（写入失败时仅本实例生效）
+func (s *safetyServiceImpl) ban(ctx context.Context, ban *entity.UserBan) {
+	if ban.UserID <= 0 {
+		return
+	}
+	if s.banRepo != nil {
+		_ = s.banRepo.Create(ctx, ban)
+	}
+	s.bansMu.Lock()
+	defer s.bansMu.Unlock()
+	if entry := s.bans[ban.UserID]; entry.until.Before(ban.Until) {
+		s.putBanLocked(ban.UserID, banCacheEntry{until: ban.Until, checkedAt: time.Now()})
+	}
+}
+
+// putBanLocked 写入缓存项；每隔 banCacheTTL 顺带清理封禁已结束且超过缓存时长的项，
+// 避免大量未封禁用户的查询结果使缓存无限增长。调用方须持有 bansMu
+func (s *safetyServiceImpl) putBanLocked(userID int64, entry banCacheEntry) {
+	s.bans[userID] = entry
+	now := entry.checkedAt
+	if now.Sub(s.bansSweptAt) < banCacheTTL {
+		return
+	}
+	s.bansSweptAt = now
+	for id, e := range s.bans {
+		if !now.Before(e.until) && now.Sub(e.checkedAt) >= banCacheTTL {
+			delete(s.bans, id)
+		}
+	}
+}
+
+// bannedUntil 返回用户的封禁截止时间；本地缓存过期后回源仓储
+func (s *safetyServiceImpl) bannedUntil(ctx context.Context, userID int64) (time.Time, bool) {
+	if userID <= 0 {
+		return time.Time{}, false
+	}
+	now := time.Now()
+	s.bansMu.Lock()
+	entry, ok := s.bans[userID]
+	s.bansMu.Unlock()
+	if ok && (s.banRepo == nil || now.Sub(entry.checkedAt) < banCacheTTL) {
+		if now.Before(entry.until) {
+			return entry.until, true
+		}
+		if s.banRepo == nil {
+			s.bansMu.Lock()
+			delete(s.bans, userID)
+			s.bansMu.Unlock()
+		}
+		return time.Time{}, false
+	}
+	if s.banRepo == nil {
+		return time.Time{}, false
+	}
+	ban, err := s.banRepo.GetActive(ctx, userID, now)
+	if err != nil {
+		// 查询失败时沿用本地缓存，避免数据库抖动导致封禁失效
+		return entry.until, now.Before(entry.until)
+	}
+	entry = banCacheEntry{checkedAt: now}
+	if ban != nil {
+		entry.until = ban.Until
+	}
+	s.bansMu.Lock()
+	s.putBanLocked(userID, entry)
+	s.bansMu.Unlock()
+	return entry.until, now.Before(entry.until)
+}
+
+func (s *safetyServiceImpl) ListUserBans(ctx context.Context, limit, offset int) ([]*entity.UserBan, int64, error) {
+	if s.banRepo == nil {
+		return nil, 0, errorx.New(errorx.Internal, "用户封禁 repo 未配置")
+	}
+	return s.banRepo.ListActive(ctx, time.Now(), limit, offset)
+}
+
+func (s *safetyServiceImpl) BanUser(ctx context.Context, userID int64, seconds int, reason string, actorID int64) (*entity.UserBan, error) {
+	if userID <= 0 {
+		return nil, errorx.New(errorx.InvalidInput, "userID 无效")
+	}
+	if seconds <= 0 {
+		return nil, errorx.New(errorx.Validation, "封禁时长需为正数")
+	}
+	if s.banRepo == nil {
+		return nil, errorx.New(errorx.Internal, "用户封禁 repo 未配置")
+	}
+	ban := &entity.UserBan{
+		UserID:    userID,
+		Source:    entity.UserBanSourceManual,
+		Reason:    reason,
+		Until:     time.Now().Add(time.Duration(seconds) * time.Second),
+		CreatedBy: actorID,
+	}
+	if err := s.banRepo.Create(ctx, ban); err != nil {
+		return nil, err
+	}
+	s.bansMu.Lock()
+	s.putBanLocked(userID, banCacheEntry{until: ban.Until, checkedAt: time.Now()})
+	s.bansMu.Unlock()
+	s.RecordAdminChange(ctx, "admin.ban_user", "user_ban", ban.ID, nil, ban)
+	return ban, nil
+}
+
+func (s *safetyServiceImpl) LiftUserBan(ctx context.Context, userID, actorID int64) error {
+	if userID <= 0 {
+		return errorx.New(errorx.InvalidInput, "userID 无效")
+	}
+	var lifted int64
+	if s.banRepo != nil {
+		n, err := s.banRepo.Lift(ctx, userID, actorID, time.Now())
+		if err != nil {
+			return err
+		}
+		lifted = n
+	}
+	s.bansMu.Lock()
+	cached := time.Now().Before(s.bans[userID].until)
+	delete(s.bans, userID)
+	s.bansMu.Unlock()
+	if lifted == 0 && !cached {
+		return errorx.New(errorx.NotFound, "用户当前没有生效的封禁")
+	}
+	s.RecordAdminChange(ctx, "admin.lift_user_ban", "user_ban", userID, map[string]bool{"banned": true}, map[string]bool{"banned": false})
+	return nil
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"gochen-llm/entity"
+	"gochen-llm/repo"
+	"gochen/errorx"
+)
+
+// userErasureRetained 删除后按设计保留或本模块无法覆盖的数据
+var userErasureRetained = []string{
+	"封禁记录（llm_user_bans）按用户 ID 保留，用于防止被封禁用户借删除规避处罚",
+	"限流档位（llm_user_rate_limit_tiers）属于账户配置，随账户注销由宿主清理",
+	"通过 SetVectorStore 替换的外部向量存储中的索引需由宿主按用户 ID 清理",
+	"PII 令牌库（llm_pii_vault）中未记录所属用户（user_id=0）的令牌无法按用户定位，通过 SetPIIVault 替换的外部令牌库需由宿主清理",
+	"他人会话的标题（含自动生成的标题）归会话所有者管理，不随该用户删除而修改",
+}
+
+// UserErasureService 用户数据删除（被遗忘权）：跨会话、审计日志与调用指标删除或匿名化指定用户的个人数据
+type UserErasureService interface {
+	// ForgetUser 依次删除用户的会话与消息、长期记忆、异步任务、限流窗口与 PII 令牌，匿名化审计日志、调用指标与违规记录；
+	// 各步骤幂等，任一步骤失败时返回已完成部分的报告（Completed=false）与错误，可重复执行直至完成
+	ForgetUser(ctx context.Context, userID int64) (*entity.UserErasureReport, error)
+}
+
+type userErasureServiceImpl struct {
+	conversations repo.ConversationRepo
+	audit         repo.AuditLogRepo
+	metrics       repo.MetricsRepo
+	violations    repo.SafetyViolationRepo
+	memories      repo.UserMemoryRepo
+	jobs          repo.ChatJobRepo
+	rate          repo.RateLimitRepo
+	vault         repo.PIIVaultRepo
+}
+
+func NewUserErasureService(conversations repo.ConversationRepo, audit repo.AuditLogRepo, metrics repo.MetricsRepo, violations repo.SafetyViolationRepo, memories repo.UserMemoryRepo, jobs repo.ChatJobRepo, rate repo.RateLimitRepo, vault repo.PIIVaultRepo) UserErasureService {
+	return &userErasureServiceImpl{
+		conversations: conversations,
+		audit:         audit,
+		metrics:       metrics,
+		violations:    violations,
+		memories:      memories,
+		jobs:          jobs,
+		rate:          rate,
+		vault:         vault,
+	}
+}
+
+func (s *userErasureServiceImpl) ForgetUser(ctx context.Context, userID int64) (*entity.UserErasureReport, error) {
+	if userID <= 0 {
+		return nil, errorx.New(errorx.Validation, "user_id 无效")
+	}
+	report := &entity.UserErasureReport{
+		UserID:    userID,
+		Retained:  userErasureRetained,
+		StartedAt: time.Now(),
+	}
+	defer func() { report.FinishedAt = time.Now() }()
+
+	var err error
+	if report.ConversationsDeleted, report.MessagesAnonymized, err = s.conversations.EraseUser(ctx, userID); err != nil {
+		return report, err
+	}
+	steps := []struct {
+		count *int64
+		run   func(context.Context, int64) (int64, error)
+	}{
+		{&report.MemoriesDeleted, s.memories.DeleteByUser},
+		{&report.ChatJobsDeleted, s.jobs.DeleteByUser},
+		{&report.RateLimitsDeleted, s.rate.DeleteByUser},
+		{&report.PIITokensDeleted, s.vault.DeleteByUser},
+		{&report.AuditLogsAnonymized, s.audit.AnonymizeUser},
+		{&report.MetricsAnonymized, s.metrics.AnonymizeUser},
+		{&report.ViolationsAnonymized, s.violations.AnonymizeUser},
+	}
+	for _, step := range steps {
+		if *step.count, err = step.run(ctx, userID); err != nil {
+			return report, err
+		}
+	}
+	report.Completed = true
+	return report, nil
+}